@@ -0,0 +1,16 @@
+//go:build !windows
+
+package acp_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(t *testing.T) (agentrun.Engine, agentrun.Session) {
+		return newEngine(t), agentrun.Session{CWD: t.TempDir()}
+	})
+}
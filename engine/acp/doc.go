@@ -12,4 +12,8 @@
 //
 //	engine := acp.NewEngine(acp.WithBinary("opencode"), acp.WithArgs("acp"))
 //	proc, err := engine.Start(ctx, session)
+//
+// With WithSharedConnection, every Start opens a new ACP session on a single
+// agent subprocess instead of spawning one per session. Updates and
+// permission requests are routed to the owning process by sessionId.
 package acp
@@ -4,7 +4,6 @@ package acp
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -14,19 +13,20 @@ import (
 	"time"
 
 	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/procutil"
+	"github.com/dmora/agentrun/engine/jsonrpc"
 )
 
-// updateQueueSize is the buffer for decoupling notification dispatch from
-// ReadLoop, preventing deadlock when the output channel is full during Send().
-// If the agent emits more than updateQueueSize notifications before the
-// consumer drains any from Output(), ReadLoop blocks, stalling RPC dispatch.
-// Consumers MUST drain Output() concurrently with Send() for long turns.
-const updateQueueSize = 1024
-
 // Engine is an ACP engine that communicates with agents via JSON-RPC 2.0
 // over a persistent subprocess's stdin/stdout.
+//
+// By default each Start spawns a dedicated subprocess. With
+// WithSharedConnection, all sessions share one subprocess.
 type Engine struct {
 	opts EngineOptions
+
+	sharedMu sync.Mutex   // guards shared
+	shared   *sharedAgent // current shared-connection agent; nil until first Start
 }
 
 var _ agentrun.Engine = (*Engine)(nil)
@@ -87,6 +87,10 @@ func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...ag
 	}
 	env := agentrun.MergeEnv(os.Environ(), session.Env)
 
+	if e.opts.SharedConnection {
+		return e.startShared(ctx, session, hitl)
+	}
+
 	// Spawn subprocess.
 	cmd, stdin, stdout, err := e.spawnSubprocess(session.CWD, env)
 	if err != nil {
@@ -94,26 +98,19 @@ func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...ag
 	}
 
 	p := newProcess(cmd, stdin, e.opts)
-	conn := newConn(stdout, stdin, connConfig{
-		maxMessageSize: e.opts.MaxMessageSize,
-		onParseError: func(_ []byte, err error) {
-			p.emit(agentrun.Message{
-				Type:      agentrun.MessageError,
-				Content:   fmt.Sprintf("acp: malformed JSON from agent: %v", err),
-				Timestamp: time.Now(),
-			})
-		},
+	conn := e.newConn(stdout, stdin, func(_ []byte, err error) {
+		p.emit(agentrun.Message{
+			Type:      agentrun.MessageError,
+			Content:   fmt.Sprintf("acp: malformed JSON from agent: %v", err),
+			Timestamp: time.Now(),
+		})
 	})
 
 	wireReadLoop(conn, p, hitl, e.opts)
 
 	// Handshake with timeout.
-	hsCtx := ctx
-	if e.opts.HandshakeTimeout > 0 {
-		var hsCancel context.CancelFunc
-		hsCtx, hsCancel = context.WithTimeout(ctx, e.opts.HandshakeTimeout)
-		defer hsCancel()
-	}
+	hsCtx, hsCancel := e.handshakeContext(ctx)
+	defer hsCancel()
 
 	if err := p.handshake(hsCtx, session); err != nil {
 		p.kill()
@@ -123,6 +120,65 @@ func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...ag
 	return p, nil
 }
 
+// handshakeContext bounds ctx by HandshakeTimeout, when configured.
+func (e *Engine) handshakeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if e.opts.HandshakeTimeout > 0 {
+		return context.WithTimeout(ctx, e.opts.HandshakeTimeout)
+	}
+	return ctx, func() {}
+}
+
+// startShared opens a session on the engine's shared agent subprocess,
+// spawning it first if no live one exists.
+func (e *Engine) startShared(ctx context.Context, session agentrun.Session, hitl agentrun.HITL) (agentrun.Process, error) {
+	if len(session.Env) > 0 {
+		return nil, fmt.Errorf("acp: Session.Env is not supported with a shared connection")
+	}
+
+	hsCtx, hsCancel := e.handshakeContext(ctx)
+	defer hsCancel()
+
+	a, err := e.acquireShared(hsCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProcess(a.cmd, nil, e.opts)
+	p.hitl = hitl
+	p.conn = a.conn
+	p.shared = a
+	p.updates = newUpdateQueue(p.emit)
+
+	if err := p.startSession(hsCtx, session, &a.initResult); err != nil {
+		p.kill()
+		return nil, err
+	}
+	return p, nil
+}
+
+// acquireShared returns the live shared agent with a reference taken for the
+// caller, spawning a new one if none exists or the previous one is closing.
+// Waits for the connection-level initialize handshake to complete.
+func (e *Engine) acquireShared(ctx context.Context) (*sharedAgent, error) {
+	e.sharedMu.Lock()
+	a := e.shared
+	if a == nil || !a.acquire() {
+		var err error
+		if a, err = e.spawnShared(); err != nil {
+			e.sharedMu.Unlock()
+			return nil, err
+		}
+		e.shared = a
+	}
+	e.sharedMu.Unlock()
+
+	if err := a.waitReady(ctx); err != nil {
+		a.release(context.Background())
+		return nil, err
+	}
+	return a, nil
+}
+
 // spawnSubprocess resolves the binary and starts the ACP agent process.
 // env is passed directly to cmd.Env — nil inherits the parent environment.
 func (e *Engine) spawnSubprocess(cwd string, env []string) (*exec.Cmd, io.WriteCloser, io.ReadCloser, error) {
@@ -152,53 +208,49 @@ func (e *Engine) spawnSubprocess(cwd string, env []string) (*exec.Cmd, io.WriteC
 	return cmd, stdin, stdout, nil
 }
 
-// wireReadLoop registers handlers on the Conn, starts the dispatch goroutine,
-// and launches ReadLoop in the background. On ReadLoop exit, queued updates
-// are drained and the process is finished.
-func wireReadLoop(conn *Conn, p *process, hitl agentrun.HITL, _ EngineOptions) {
-	p.hitl = hitl
+// newConn creates the JSON-RPC connection to an agent subprocess, applying
+// the engine's message size limit, wire trace and extension handler.
+func (e *Engine) newConn(r io.Reader, w io.Writer, onParseError func([]byte, error)) *jsonrpc.Conn {
+	conn := jsonrpc.NewConn(r, w,
+		jsonrpc.WithMaxMessageSize(e.opts.MaxMessageSize),
+		jsonrpc.WithParseErrorHandler(onParseError),
+		jsonrpc.WithTrace(e.opts.WireTrace),
+		jsonrpc.WithRedactor(e.opts.WireRedactor),
+	)
+	if e.opts.ExtensionHandler != nil {
+		conn.OnExtension(e.opts.ExtensionHandler)
+	}
+	return conn
+}
 
-	updateCh := make(chan agentrun.Message, updateQueueSize)
-	conn.OnNotification(MethodSessionUpdate, makeUpdateHandler(p, updateCh))
+// wireReadLoop registers handlers on the Conn, starts the update dispatch
+// goroutine, and launches ReadLoop in the background. On ReadLoop exit,
+// queued updates are drained and the process is finished.
+func wireReadLoop(conn *jsonrpc.Conn, p *process, hitl agentrun.HITL, _ EngineOptions) {
+	p.hitl = hitl
 
-	// Register a delegating wrapper. The real handler is swapped per-turn
-	// via p.permHandler (atomic pointer). Between turns, a deny-all handler
-	// is installed to prevent stale requests from contaminating the next turn.
-	conn.OnMethod(MethodRequestPerm, func(params json.RawMessage) (any, error) {
-		if h := p.permHandler.Load(); h != nil {
-			return (*h)(params)
-		}
-		return cancelledPermission(), nil // no active turn — cancel
-	})
+	p.updates = newUpdateQueue(p.emit)
+	conn.OnNotification(MethodSessionUpdate, makeUpdateHandler(p))
+	conn.OnMethod(MethodRequestPerm, p.handlePermission)
 	p.conn = conn
 
-	// Dispatch goroutine: drains updateCh → output channel.
-	var dispatchDone sync.WaitGroup
-	dispatchDone.Add(1)
-	go func() {
-		defer dispatchDone.Done()
-		for msg := range updateCh {
-			p.emit(msg)
-		}
-	}()
-
-	// ReadLoop goroutine: sole writer to output channel.
+	// ReadLoop goroutine: feeds the update queue, finishes the process on exit.
 	go func() {
 		conn.ReadLoop()
-		close(updateCh)     // signal dispatch goroutine to finish
-		dispatchDone.Wait() // wait for all queued updates to be emitted
+		p.updates.close() // signal dispatch goroutine to finish
+		p.updates.wait()  // wait for all queued updates to be emitted
 
 		// If ReadLoop failed (e.g., line too long), kill the subprocess
 		// and surface the read error. Do NOT set stopping — this is not
 		// a user-initiated stop, and finish() would rewrite the error
 		// to ErrTerminated if stopping is true (process.go:242).
 		if readErr := conn.Err(); readErr != nil {
-			_ = signalProcess(p.cmd.Process, os.Kill)
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
 			_ = p.cmd.Wait() // reap zombie
 			p.finish(fmt.Errorf("acp: reader: %w", readErr))
 			return
 		}
-		p.finish(wrapExitError(p.waitCmd()))
+		p.finish(procutil.WrapExitError(p.waitCmd()))
 	}()
 }
 
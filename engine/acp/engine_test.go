@@ -4,6 +4,7 @@ package acp_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/acp"
+	"github.com/dmora/agentrun/engine/jsonrpc"
 	"github.com/dmora/agentrun/filter"
 )
 
@@ -324,6 +326,150 @@ func TestEngine_ResumeID_SessionLoad(t *testing.T) {
 	}
 }
 
+// startReplay resumes a session against the replay mock and returns the process.
+func startReplay(t *testing.T, ctx context.Context, opts ...acp.EngineOption) agentrun.Process {
+	t.Helper()
+	engine := acp.NewEngine(append([]acp.EngineOption{acp.WithBinary(writeScript(t, "replay"))}, opts...)...)
+	proc, err := engine.Start(ctx, agentrun.Session{
+		CWD:     t.TempDir(),
+		Options: map[string]string{agentrun.OptionResumeID: "existing-session-123"},
+	})
+	if err != nil {
+		t.Fatalf("start with resume: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc
+}
+
+func TestEngine_ResumeID_HistoryReplayFlagged(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+	proc := startReplay(t, ctx)
+
+	want := []struct {
+		typ     agentrun.MessageType
+		content string
+		replay  bool
+	}{
+		{agentrun.MessageInit, "", false},
+		{agentrun.MessageSystem, "earlier question", true},
+		{agentrun.MessageTextDelta, "earlier answer", true},
+		{agentrun.MessageTextDelta, "live", false},
+	}
+	for i, w := range want {
+		msg := <-proc.Output()
+		if msg.Type != w.typ || msg.Content != w.content || msg.Replay != w.replay {
+			t.Errorf("msg[%d] = {%s %q replay=%v}, want {%s %q replay=%v}",
+				i, msg.Type, msg.Content, msg.Replay, w.typ, w.content, w.replay)
+		}
+	}
+
+	// Live turns are never marked as replay.
+	if err := proc.Send(ctx, "next"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	for _, m := range collectUntilResult(proc.Output()) {
+		if m.Replay {
+			t.Errorf("live %s message marked as replay", m.Type)
+		}
+	}
+}
+
+func TestEngine_ResumeID_HistoryTranscript(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+	proc := startReplay(t, ctx, acp.WithHistoryTranscript())
+
+	h := acp.History(proc)
+	if len(h) != 2 {
+		t.Fatalf("History = %+v, want 2 replayed messages", h)
+	}
+	if h[0].Content != "earlier question" || h[1].Content != "earlier answer" || !h[0].Replay || !h[1].Replay {
+		t.Errorf("history = %+v", h)
+	}
+	if init := <-proc.Output(); init.Type != agentrun.MessageInit {
+		t.Fatalf("type = %q, want %q", init.Type, agentrun.MessageInit)
+	}
+
+	// History is not emitted again; the next message is live output.
+	if msg := <-proc.Output(); msg.Content != "live" || msg.Replay {
+		t.Errorf("next message = {%s %q replay=%v}, want live text", msg.Type, msg.Content, msg.Replay)
+	}
+}
+
+func TestEngine_WireTrace(t *testing.T) {
+	var mu sync.Mutex
+	var frames []string
+	engine := newEngine(t,
+		acp.WithWireTrace(func(dir jsonrpc.Direction, frame []byte) {
+			mu.Lock()
+			frames = append(frames, dir.String()+" "+string(frame))
+			mu.Unlock()
+		}),
+		acp.WithWireRedactor(jsonrpc.RedactFields("text")),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+	proc, err := engine.Start(ctx, agentrun.Session{CWD: t.TempDir()})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	<-proc.Output() // init
+
+	if err := proc.Send(ctx, "top secret prompt"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	collectUntilResult(proc.Output())
+
+	mu.Lock()
+	defer mu.Unlock()
+	all := strings.Join(frames, "\n")
+	for _, want := range []string{`"method":"initialize"`, `"method":"session/prompt"`, `in {`} {
+		if !strings.Contains(all, want) {
+			t.Errorf("trace missing %q", want)
+		}
+	}
+	for _, leak := range []string{"top secret prompt", "Hello"} {
+		if strings.Contains(all, leak) {
+			t.Errorf("trace leaked redacted text %q", leak)
+		}
+	}
+}
+
+func TestEngine_ExtensionHandler(t *testing.T) {
+	got := make(chan string, 1)
+	engine := acp.NewEngine(
+		acp.WithBinary(writeScript(t, "extension")),
+		acp.WithExtensionHandler(func(method string, _ json.RawMessage) (any, error) {
+			got <- method
+			return nil, nil
+		}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+	proc, err := engine.Start(ctx, agentrun.Session{CWD: t.TempDir()})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	<-proc.Output() // init
+
+	if err := proc.Send(ctx, "test"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	collectUntilResult(proc.Output())
+	select {
+	case m := <-got:
+		if m != "_mock/notice" {
+			t.Errorf("method = %q, want _mock/notice", m)
+		}
+	default:
+		t.Fatal("extension notification not delivered")
+	}
+}
+
 func TestEngine_ResumeID_SessionNotFound(t *testing.T) {
 	wrapper := writeScript(t, "session-not-found")
 	engine := acp.NewEngine(acp.WithBinary(wrapper))
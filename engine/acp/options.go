@@ -3,6 +3,8 @@ package acp
 import (
 	"context"
 	"time"
+
+	"github.com/dmora/agentrun/engine/jsonrpc"
 )
 
 // Default engine configuration values.
@@ -60,8 +62,29 @@ type EngineOptions struct {
 
 	// PermissionHandler is called when the agent requests client-side permission.
 	PermissionHandler PermissionHandler
+
+	// SharedConnection multiplexes every session started by the engine over
+	// a single agent subprocess. See WithSharedConnection.
+	SharedConnection bool
+
+	// HistoryTranscript collects history replayed during session/load for
+	// History instead of emitting it. See WithHistoryTranscript.
+	HistoryTranscript bool
+
+	// WireTrace receives every JSON-RPC frame exchanged with the agent.
+	WireTrace jsonrpc.TraceFunc
+
+	// WireRedactor rewrites frames before they reach WireTrace.
+	WireRedactor jsonrpc.Redactor
+
+	// ExtensionHandler answers underscore-prefixed extension methods and
+	// notifications from the agent.
+	ExtensionHandler jsonrpc.ExtensionHandler
 }
 
+// RPCError is the error returned for JSON-RPC error responses from the agent.
+type RPCError = jsonrpc.Error
+
 // EngineOption configures an Engine at construction time.
 type EngineOption func(*EngineOptions)
 
@@ -136,6 +159,66 @@ func WithMaxMessageSize(size int) EngineOption {
 	}
 }
 
+// WithSharedConnection enables shared-connection mode: the engine keeps one
+// agent subprocess and opens each Session as a separate ACP session on it,
+// instead of spawning a subprocess per Start.
+//
+// session/update notifications and permission requests are routed to the
+// owning Process by sessionId. The subprocess is spawned on the first Start
+// and shut down when the last Process attached to it is stopped; a later
+// Start spawns a fresh one. Stopping a Process detaches its session without
+// affecting the others.
+//
+// Because the subprocess outlives individual sessions, Session.Env cannot be
+// applied per session — Start rejects sessions that set it. Session.CWD is
+// still honored (it is sent in session/new and session/load).
+func WithSharedConnection() EngineOption {
+	return func(o *EngineOptions) {
+		o.SharedConnection = true
+	}
+}
+
+// WithHistoryTranscript collects the conversation history an agent replays
+// while resuming a session (session/load) for History, instead of emitting
+// it on Output() as Replay-flagged messages.
+//
+// Without this option, replayed history is emitted right after MessageInit
+// with Message.Replay set. Either way, live output never carries Replay.
+func WithHistoryTranscript() EngineOption {
+	return func(o *EngineOptions) {
+		o.HistoryTranscript = true
+	}
+}
+
+// WithWireTrace sets a callback receiving every JSON-RPC frame exchanged
+// with the agent subprocess, for debugging and audit logging. Frames carry
+// prompts and tool output — combine with WithWireRedactor before persisting
+// traces. The callback runs synchronously on the connection and must not block.
+func WithWireTrace(fn jsonrpc.TraceFunc) EngineOption {
+	return func(o *EngineOptions) {
+		o.WireTrace = fn
+	}
+}
+
+// WithWireRedactor sets the redactor applied to frames before WireTrace,
+// e.g. jsonrpc.RedactFields("text", "apiKey").
+func WithWireRedactor(r jsonrpc.Redactor) EngineOption {
+	return func(o *EngineOptions) {
+		o.WireRedactor = r
+	}
+}
+
+// WithExtensionHandler sets the handler for ACP extension methods
+// (underscore-prefixed, e.g. "_zed.dev/workspace") the agent sends.
+// Without it, extension requests are answered with method-not-found and
+// extension notifications are ignored. In shared-connection mode the handler
+// is shared by all sessions on the connection.
+func WithExtensionHandler(h jsonrpc.ExtensionHandler) EngineOption {
+	return func(o *EngineOptions) {
+		o.ExtensionHandler = h
+	}
+}
+
 func resolveEngineOptions(opts ...EngineOption) EngineOptions {
 	o := EngineOptions{
 		OutputBuffer:      defaultOutputBuffer,
@@ -5,12 +5,12 @@ package acp
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -18,7 +18,9 @@ import (
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/procutil"
 	"github.com/dmora/agentrun/engine/internal/stoputil"
+	"github.com/dmora/agentrun/engine/jsonrpc"
 )
 
 // permHandlerFunc is the signature for the swappable permission handler.
@@ -26,7 +28,7 @@ type permHandlerFunc = func(json.RawMessage) (any, error)
 
 // process implements agentrun.Process for ACP subprocess sessions.
 type process struct {
-	conn *Conn
+	conn *jsonrpc.Conn
 	// cmd is immutable after newProcess() returns — assigned once, never
 	// reassigned. processMetaSnapshot reads it without a lock.
 	cmd       *exec.Cmd
@@ -53,8 +55,37 @@ type process struct {
 	hitl        agentrun.HITL                   // session-scoped, set in wireReadLoop
 	permHandler atomic.Pointer[permHandlerFunc] // delegated permission handler
 	rpcDone     chan struct{}                   // closed when current turn's conn.Call goroutine exits
+
+	// updates feeds session/update messages to output in wire order.
+	// Set before ReadLoop starts; nil only in unit tests.
+	updates *updateQueue
+
+	// shared is the multiplexed agent this session lives on; nil for a
+	// dedicated subprocess. In shared mode cmd and conn belong to the agent
+	// and stdin is nil — Stop detaches instead of killing the subprocess.
+	shared *sharedAgent
+	inTurn atomic.Bool // true while a session/prompt RPC is in flight
+
+	// History replay on session/load — see holdReplay.
+	replayMu    sync.Mutex
+	replayPhase replayPhase
+	replayed    []agentrun.Message // history captured during session/load
+	held        []agentrun.Message // live updates held until history is released
+
+	// history is the replay collected with WithHistoryTranscript. Written
+	// during Start and read-only afterwards.
+	history []agentrun.Message
 }
 
+// replayPhase tracks where a resuming session is in its history replay.
+type replayPhase int
+
+const (
+	replayOff     replayPhase = iota // updates are live output
+	replayCapture                    // session/load in flight: updates are history
+	replayHold                       // load answered, history not yet released
+)
+
 var _ agentrun.Process = (*process)(nil)
 
 // newProcess creates a process shell. The Conn and ReadLoop are wired up
@@ -99,7 +130,7 @@ func (p *process) Send(ctx context.Context, message string) error {
 	}
 
 	// --- Fence: wait for previous turn's RPC goroutine to exit ---
-	// Conn.Call returns immediately on ctx cancel (conn.go:110-112),
+	// jsonrpc.Conn.Call returns immediately on ctx cancel,
 	// so this wait is fast. Ensures clean RPC state before new turn.
 	if p.rpcDone != nil {
 		select {
@@ -133,8 +164,10 @@ func (p *process) Send(ctx context.Context, message string) error {
 	rpcDone := make(chan struct{})
 	p.rpcDone = rpcDone
 	errCh := make(chan error, 1)
+	p.inTurn.Store(true)
 	go func() {
 		defer close(rpcDone)
+		defer p.inTurn.Store(false)
 		errCh <- p.conn.Call(ctx, MethodSessionPrompt, params, &result)
 	}()
 
@@ -143,6 +176,11 @@ func (p *process) Send(ctx context.Context, message string) error {
 	select {
 	case err := <-errCh:
 		p.rpcDone = nil // normal completion — no fencing needed next time
+		if err == nil {
+			// Updates streamed before the response must reach Output()
+			// before MessageResult.
+			p.flushUpdates()
+		}
 		return p.handlePromptResult(err, &result, td)
 	case <-p.done:
 		td.seal() // discard
@@ -204,8 +242,14 @@ func (p *process) handlePromptResult(err error, result *promptResult, td *turnDe
 }
 
 // Stop terminates the session. Safe to call multiple times.
+// In shared-connection mode, Stop detaches the session and only shuts the
+// agent subprocess down when no other session is attached.
 func (p *process) Stop(ctx context.Context) error {
 	p.stopOnce.Do(func() {
+		if p.shared != nil {
+			p.detach(ctx)
+			return
+		}
 		p.stopping.Store(true)
 
 		// Send shutdown notification (best-effort).
@@ -222,15 +266,15 @@ func (p *process) Stop(ctx context.Context) error {
 		p.cancel()
 
 		// SIGTERM → grace → SIGKILL.
-		_ = signalProcess(p.cmd.Process, syscall.SIGTERM)
+		_ = procutil.Signal(p.cmd.Process, syscall.SIGTERM)
 
 		select {
 		case <-p.done:
 		case <-time.After(p.opts.GracePeriod):
-			_ = signalProcess(p.cmd.Process, os.Kill)
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
 			<-p.done
 		case <-ctx.Done():
-			_ = signalProcess(p.cmd.Process, os.Kill)
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
 			<-p.done
 		}
 	})
@@ -311,41 +355,41 @@ func (p *process) waitCmd() error {
 // kill forcefully terminates the subprocess and waits for the ReadLoop
 // goroutine to call finish(). Does not call cmd.Wait() directly — the
 // ReadLoop goroutine is the sole caller to avoid races.
+// In shared-connection mode the subprocess is not ours to kill: kill
+// detaches the session instead.
 func (p *process) kill() {
+	if p.shared != nil {
+		p.stopOnce.Do(func() { p.detach(context.Background()) })
+		return
+	}
 	p.stopping.Store(true)
 	p.cancel()
-	_ = signalProcess(p.cmd.Process, os.Kill)
+	_ = procutil.Signal(p.cmd.Process, os.Kill)
 	<-p.done // ReadLoop goroutine calls finish(waitCmd())
 }
 
-// signalProcess sends sig to a process, returning nil if the process
-// has already exited (os.ErrProcessDone).
-func signalProcess(proc *os.Process, sig os.Signal) error {
-	err := proc.Signal(sig)
-	if errors.Is(err, os.ErrProcessDone) {
-		return nil
+// detach ends a shared-connection session: stops routing its traffic,
+// cancels an in-flight turn, finishes the process with ErrTerminated, and
+// releases its reference on the shared agent (the last release shuts the
+// subprocess down, bounded by ctx).
+func (p *process) detach(ctx context.Context) {
+	p.stopping.Store(true)
+	p.cancel() // unblock emit() and queue pushes before closing the queue
+
+	if p.sessionID != "" {
+		p.shared.unregister(p.sessionID, p)
+		if p.inTurn.Load() {
+			sid := p.sessionID
+			go func() {
+				_ = p.conn.Notify(MethodSessionCancel, map[string]string{"sessionId": sid})
+			}()
+		}
 	}
-	return err
-}
 
-// wrapExitError converts a non-zero *exec.ExitError to *agentrun.ExitError.
-// nil → nil, non-ExitError → passthrough, code 0 → nil (clean exit).
-// Preserves the error chain via ExitError.Unwrap.
-//
-// NOTE: intentionally duplicated in engine/cli/process.go — keep in sync.
-func wrapExitError(err error) error {
-	if err == nil {
-		return nil
-	}
-	var ee *exec.ExitError
-	if !errors.As(err, &ee) {
-		return err
-	}
-	code := ee.ExitCode()
-	if code == 0 {
-		return nil
-	}
-	return &agentrun.ExitError{Code: code, Err: err}
+	p.updates.close()
+	p.updates.wait()
+	p.finish(agentrun.ErrTerminated)
+	p.shared.release(ctx)
 }
 
 // processMetaSnapshot returns subprocess metadata for MessageInit enrichment.
@@ -367,33 +411,141 @@ func (p *process) processMetaSnapshot() *agentrun.ProcessMeta {
 // --- Handshake ---
 
 // makeUpdateHandler returns a notification handler that parses session/update
-// params and sends the resulting message to updateCh. Runs synchronously in
-// ReadLoop but writes to updateCh (not the output channel) to avoid blocking
-// RPC response dispatch.
-func makeUpdateHandler(p *process, updateCh chan<- agentrun.Message) func(json.RawMessage) {
+// params and enqueues the resulting message on p.updates. Runs synchronously
+// in ReadLoop but writes to the update queue (not the output channel) to
+// avoid blocking RPC response dispatch.
+func makeUpdateHandler(p *process) func(json.RawMessage) {
 	return func(params json.RawMessage) {
 		var notif sessionNotification
 		if err := json.Unmarshal(params, &notif); err != nil {
-			msg := agentrun.Message{
+			p.enqueue(agentrun.Message{
 				Type:      agentrun.MessageError,
 				Content:   fmt.Sprintf("acp: unmarshal update params: %v", err),
 				Timestamp: time.Now(),
-			}
-			select {
-			case updateCh <- msg:
-			case <-p.ctx.Done():
-			}
+			})
 			return
 		}
-		msg := parseSessionUpdate(notif.Update)
-		if msg == nil {
-			return // parser returned nil (no data to report)
+		p.enqueueUpdate(notif.Update)
+	}
+}
+
+// enqueueUpdate parses the inner session/update payload and enqueues the
+// resulting message. Updates the parser consumes silently are dropped.
+func (p *process) enqueueUpdate(update json.RawMessage) {
+	msg := parseSessionUpdate(update)
+	if msg == nil {
+		return // parser returned nil (no data to report)
+	}
+	if p.holdReplay(msg) {
+		return
+	}
+	p.enqueue(*msg)
+}
+
+// holdReplay diverts msg while a resumed session's history is pending.
+// During session/load, msg is marked Replay and captured as history. Once
+// the load is answered and until releaseReplay runs, live updates are held
+// so they cannot overtake MessageInit and the replayed history.
+// Returns false when msg should be enqueued normally.
+func (p *process) holdReplay(msg *agentrun.Message) bool {
+	p.replayMu.Lock()
+	defer p.replayMu.Unlock()
+	switch p.replayPhase {
+	case replayCapture:
+		msg.Replay = true
+		p.replayed = append(p.replayed, *msg)
+		return true
+	case replayHold:
+		p.held = append(p.held, *msg)
+		return true
+	default:
+		return false
+	}
+}
+
+// beginReplay starts capturing updates as history. Called before session/load.
+func (p *process) beginReplay() {
+	p.replayMu.Lock()
+	p.replayPhase = replayCapture
+	p.replayMu.Unlock()
+}
+
+// holdLiveUpdates ends history capture: later updates are held until
+// releaseReplay. Runs on ReadLoop as the session/load response arrives.
+func (p *process) holdLiveUpdates() {
+	p.replayMu.Lock()
+	p.replayPhase = replayHold
+	p.replayMu.Unlock()
+}
+
+// endReplayCapture stops capturing history (if the load response hook did
+// not already) and returns it. Later updates are held until releaseReplay.
+func (p *process) endReplayCapture() []agentrun.Message {
+	p.replayMu.Lock()
+	defer p.replayMu.Unlock()
+	p.replayPhase = replayHold
+	history := p.replayed
+	p.replayed = nil
+	return history
+}
+
+// releaseReplay enqueues history (if any) followed by held live updates,
+// then returns to live delivery. Runs in its own goroutine so Start can
+// return before the consumer drains Output(); replayMu stays held until
+// the backlog is queued, keeping ReadLoop's later updates behind it.
+func (p *process) releaseReplay(history []agentrun.Message) {
+	go func() {
+		p.replayMu.Lock()
+		defer p.replayMu.Unlock()
+		for _, m := range history {
+			p.enqueue(m)
 		}
-		select {
-		case updateCh <- *msg:
-		case <-p.ctx.Done():
+		for _, m := range p.held {
+			p.enqueue(m)
 		}
+		p.held = nil
+		p.replayPhase = replayOff
+	}()
+}
+
+// History returns the conversation history the agent replayed while
+// resuming proc's session, in wire order and with Replay set, when the
+// Engine was created with WithHistoryTranscript. Returns nil when nothing
+// was replayed, and for processes not started by an ACP Engine, including
+// ones wrapped by middleware.
+func History(proc agentrun.Process) []agentrun.Message {
+	p, ok := proc.(*process)
+	if !ok {
+		return nil
 	}
+	return slices.Clone(p.history)
+}
+
+// enqueue queues msg for in-order delivery to Output(). Blocks while the
+// queue is full until the process is stopped.
+func (p *process) enqueue(msg agentrun.Message) {
+	if p.updates == nil {
+		return
+	}
+	p.updates.push(queuedUpdate{msg: msg}, p.ctx.Done())
+}
+
+// flushUpdates waits until every queued update has been emitted.
+func (p *process) flushUpdates() {
+	if p.updates != nil {
+		p.updates.flush(p.ctx)
+	}
+}
+
+// handlePermission is the session/request_permission entry point. It
+// delegates to the per-turn handler swapped in by Send via p.permHandler
+// (atomic pointer). Between turns a deny-all handler is installed to prevent
+// stale requests from contaminating the next turn.
+func (p *process) handlePermission(params json.RawMessage) (any, error) {
+	if h := p.permHandler.Load(); h != nil {
+		return (*h)(params)
+	}
+	return cancelledPermission(), nil // no active turn — cancel
 }
 
 // handshakeResult groups the outputs of openSession/resumeSession.
@@ -403,6 +555,8 @@ type handshakeResult struct {
 	modes         *sessionModeState
 	models        *sessionModelState
 	configOptions []sessionConfigOption
+	resumed       bool               // session/load: history replay pending release
+	history       []agentrun.Message // updates replayed during session/load
 }
 
 // buildInitMeta constructs InitMeta from initialize + session results.
@@ -426,19 +580,36 @@ func buildInitMeta(initResult *initializeResult, models *sessionModelState) *age
 	return &meta
 }
 
-// handshake performs initialize + session/new (or session/load) and emits MessageInit.
-// After emitting MessageInit, applies session configuration (mode, model).
-func (p *process) handshake(ctx context.Context, session agentrun.Session) error {
-	// Step 1: Initialize.
-	initParams := initializeParams{
+// newInitializeParams returns the client side of the initialize handshake.
+func newInitializeParams() initializeParams {
+	return initializeParams{
 		ProtocolVersion:    protocolVersion,
 		ClientInfo:         &implementation{Name: clientName, Version: clientVersion},
 		ClientCapabilities: &clientCapabilities{}, // no fs/terminal for MVP
 	}
+}
+
+// handshake performs initialize + session/new (or session/load) and emits MessageInit.
+// After emitting MessageInit, applies session configuration (mode, model).
+func (p *process) handshake(ctx context.Context, session agentrun.Session) error {
+	// Step 1: Initialize.
 	var initResult initializeResult
-	if err := p.conn.Call(ctx, MethodInitialize, initParams, &initResult); err != nil {
+	if err := p.conn.Call(ctx, MethodInitialize, newInitializeParams(), &initResult); err != nil {
 		return fmt.Errorf("acp: initialize: %w", err)
 	}
+	return p.startSession(ctx, session, &initResult)
+}
+
+// startSession runs the per-session part of the handshake on an initialized
+// connection: session/new (or session/load), MessageInit, session config.
+// In shared-connection mode it also registers the session for routing.
+func (p *process) startSession(ctx context.Context, session agentrun.Session, initResult *initializeResult) error {
+	if p.shared != nil {
+		// Keep updates the agent sends between the session/new response
+		// and attach, e.g. its available commands.
+		p.shared.beginOpen()
+		defer p.shared.endOpen()
+	}
 
 	// Step 2: Session — resume existing or create new.
 	var hr handshakeResult
@@ -457,15 +628,26 @@ func (p *process) handshake(ctx context.Context, session agentrun.Session) error
 		return fmt.Errorf("acp: invalid session ID from agent: %w", err)
 	}
 	p.sessionID = hr.sessionID
+	if err := p.attach(); err != nil {
+		return err
+	}
 
 	// Step 3: Emit MessageInit (before config application — consumers need session ID).
+	meta := buildInitMeta(initResult, hr.models)
+	if p.opts.HistoryTranscript && len(hr.history) > 0 {
+		p.history = hr.history
+		hr.history = nil
+	}
 	p.emit(agentrun.Message{
 		Type:      agentrun.MessageInit,
 		ResumeID:  p.sessionID,
-		Init:      buildInitMeta(&initResult, hr.models),
+		Init:      meta,
 		Process:   p.processMetaSnapshot(),
 		Timestamp: time.Now(),
 	})
+	if hr.resumed {
+		p.releaseReplay(hr.history) // replayed history follows MessageInit
+	}
 
 	// Step 4: Apply session configuration.
 	return p.applySessionConfig(ctx, session, hr.modes, hr.configOptions)
@@ -477,13 +659,24 @@ func (p *process) resumeSession(ctx context.Context, resumeID, cwd string) (hand
 	if err := validateSessionID(resumeID); err != nil {
 		return handshakeResult{}, fmt.Errorf("%w: invalid resume ID: %w", agentrun.ErrSessionNotFound, err)
 	}
+	// Shared mode: route updates to this process before loading, so anything
+	// the agent streams during session/load reaches the right session.
+	p.sessionID = resumeID
+	if err := p.attach(); err != nil {
+		return handshakeResult{}, err
+	}
 	params := loadSessionParams{
 		SessionID:  resumeID,
 		CWD:        cwd,
 		MCPServers: []mcpServer{}, // empty slice, never nil
 	}
 	var result loadSessionResult
-	if err := p.conn.Call(ctx, MethodSessionLoad, params, &result); err != nil {
+	// Updates streamed before the load response are the session's history.
+	// The hook ends capture on ReadLoop, before any update after the response.
+	p.beginReplay()
+	err := p.conn.Call(ctx, MethodSessionLoad, params, &result, jsonrpc.OnResponse(p.holdLiveUpdates))
+	history := p.endReplayCapture()
+	if err != nil {
 		return handshakeResult{}, fmt.Errorf("%w: session/load: %w", agentrun.ErrSessionNotFound, err)
 	}
 	// LoadSessionResult has NO sessionId — use resumeID directly.
@@ -492,6 +685,8 @@ func (p *process) resumeSession(ctx context.Context, resumeID, cwd string) (hand
 		modes:         result.Modes,
 		models:        result.Models,
 		configOptions: result.ConfigOptions,
+		resumed:       true,
+		history:       history,
 	}, nil
 }
 
@@ -513,6 +708,15 @@ func (p *process) openSession(ctx context.Context, session agentrun.Session) (ha
 	}, nil
 }
 
+// attach registers p under its session ID on the shared agent.
+// No-op for dedicated-subprocess sessions.
+func (p *process) attach() error {
+	if p.shared == nil {
+		return nil
+	}
+	return p.shared.register(p.sessionID, p)
+}
+
 // sessionIDPattern matches safe session identifiers (relaxed to 256 for real agent IDs).
 var sessionIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_\-]{1,256}$`)
 
@@ -576,9 +780,10 @@ func (p *process) applySessionConfig(ctx context.Context, session agentrun.Sessi
 			}
 			// Non-fatal: emit error and continue.
 			p.emit(agentrun.Message{
-				Type:      agentrun.MessageError,
-				Content:   fmt.Sprintf("acp: %s: %v", c.Method, err),
-				Timestamp: time.Now(),
+				Type:          agentrun.MessageError,
+				Content:       fmt.Sprintf("acp: %s: %v", c.Method, err),
+				ErrorCategory: agentrun.ErrorCategoryOf(err),
+				Timestamp:     time.Now(),
 			})
 		}
 	}
@@ -0,0 +1,113 @@
+package acp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// updateQueueSize is the buffer for decoupling notification dispatch from
+// ReadLoop, preventing deadlock when the output channel is full during Send().
+// If the agent emits more than updateQueueSize notifications before the
+// consumer drains any from Output(), ReadLoop blocks, stalling RPC dispatch.
+// Consumers MUST drain Output() concurrently with Send() for long turns.
+const updateQueueSize = 1024
+
+// queuedUpdate is one entry in an updateQueue: either a message to emit or,
+// when flush is non-nil, a barrier that is acknowledged once every message
+// queued before it has been emitted.
+type queuedUpdate struct {
+	msg   agentrun.Message
+	flush chan struct{}
+}
+
+// updateQueue decouples session/update dispatch (ReadLoop) from delivery to
+// a process output channel. One queue per process; a dedicated goroutine
+// drains it in FIFO order.
+//
+// The flush barrier lets Send order MessageResult after every update the
+// agent streamed before its prompt response. ReadLoop enqueues notifications
+// synchronously, so by the time a Call returns, all preceding updates are
+// already in the queue — flushing before emitting the result preserves wire
+// order on Output().
+type updateQueue struct {
+	mu     sync.Mutex // guards closed and serializes push against close
+	ch     chan queuedUpdate
+	closed bool
+	done   chan struct{} // closed when the dispatch goroutine exits
+}
+
+// newUpdateQueue creates a queue and starts its dispatch goroutine, which
+// calls emit for each queued message until close is called.
+func newUpdateQueue(emit func(agentrun.Message)) *updateQueue {
+	q := &updateQueue{
+		ch:   make(chan queuedUpdate, updateQueueSize),
+		done: make(chan struct{}),
+	}
+	go q.run(emit)
+	return q
+}
+
+// run is the dispatch goroutine: drains ch → emit.
+func (q *updateQueue) run(emit func(agentrun.Message)) {
+	defer close(q.done)
+	for u := range q.ch {
+		if u.flush != nil {
+			close(u.flush)
+			continue
+		}
+		emit(u.msg)
+	}
+}
+
+// push enqueues u, blocking while the queue is full until cancel fires.
+// Returns false if the queue is closed or cancel fired first.
+//
+// Holds mu for the whole send so close cannot close ch underneath a blocked
+// sender. Callers that close a queue with concurrent producers must fire
+// cancel first so blocked pushes release the lock.
+func (q *updateQueue) push(u queuedUpdate, cancel <-chan struct{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.ch <- u:
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+// flush blocks until every message queued before the call has been emitted,
+// ctx is cancelled, or the queue shuts down.
+func (q *updateQueue) flush(ctx context.Context) {
+	ack := make(chan struct{})
+	if !q.push(queuedUpdate{flush: ack}, ctx.Done()) {
+		return
+	}
+	select {
+	case <-ack:
+	case <-ctx.Done():
+	case <-q.done:
+	}
+}
+
+// close stops accepting updates and lets the dispatch goroutine drain what
+// is already queued. Safe to call multiple times.
+func (q *updateQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.ch)
+}
+
+// wait blocks until the dispatch goroutine has emitted every queued update.
+func (q *updateQueue) wait() {
+	<-q.done
+}
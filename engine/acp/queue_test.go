@@ -0,0 +1,65 @@
+package acp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestUpdateQueue_FlushOrdersAfterQueued(t *testing.T) {
+	out := make(chan agentrun.Message, 8)
+	q := newUpdateQueue(func(m agentrun.Message) { out <- m })
+	defer q.close()
+
+	cancel := make(chan struct{})
+	for _, s := range []string{"a", "b", "c"} {
+		if !q.push(queuedUpdate{msg: agentrun.Message{Content: s}}, cancel) {
+			t.Fatalf("push %q failed", s)
+		}
+	}
+	q.flush(context.Background())
+
+	if got := len(out); got != 3 {
+		t.Fatalf("emitted %d messages before flush returned, want 3", got)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		if m := <-out; m.Content != want {
+			t.Errorf("content = %q, want %q", m.Content, want)
+		}
+	}
+}
+
+func TestUpdateQueue_CloseDrainsAndIsIdempotent(t *testing.T) {
+	out := make(chan agentrun.Message, 2)
+	q := newUpdateQueue(func(m agentrun.Message) { out <- m })
+
+	q.push(queuedUpdate{msg: agentrun.Message{Content: "x"}}, nil)
+	q.close()
+	q.close()
+	q.wait()
+
+	if len(out) != 1 {
+		t.Fatalf("emitted %d messages, want 1", len(out))
+	}
+	if q.push(queuedUpdate{msg: agentrun.Message{Content: "y"}}, nil) {
+		t.Error("push after close should fail")
+	}
+}
+
+func TestUpdateQueue_FlushAfterCloseReturns(t *testing.T) {
+	q := newUpdateQueue(func(agentrun.Message) {})
+	q.close()
+
+	done := make(chan struct{})
+	go func() {
+		q.flush(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("flush blocked on a closed queue")
+	}
+}
@@ -0,0 +1,312 @@
+//go:build !windows
+
+package acp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/procutil"
+	"github.com/dmora/agentrun/engine/jsonrpc"
+)
+
+// sharedAgent is a single ACP agent subprocess multiplexing many sessions
+// (shared-connection mode, see WithSharedConnection).
+//
+// The engine creates it lazily on the first Start and every attached process
+// holds one reference. When the last reference is released the subprocess
+// is shut down; the engine then spawns a new one on the next Start.
+//
+// Inbound session/update notifications and session/request_permission calls
+// are routed to the owning process by sessionId. Updates for a session the
+// agent announces before its session/new response reaches Start are held
+// until the process registers; other updates for unknown sessions are
+// dropped, and permission requests for them are cancelled.
+type sharedAgent struct {
+	cmd   *exec.Cmd // immutable after spawn
+	stdin io.WriteCloser
+	conn  *jsonrpc.Conn
+	opts  EngineOptions
+
+	ready      chan struct{} // closed when initialize completes (or fails)
+	initResult initializeResult
+	initErr    error
+
+	mu       sync.Mutex
+	sessions map[string]*process
+	refs     int
+	closing  bool // set when refs drops to zero or the subprocess exits
+
+	// opening counts session/new calls in flight. While it is non-zero,
+	// updates for unregistered sessions are kept in early for register.
+	opening int
+	early   map[string][]json.RawMessage
+
+	shutdownOnce sync.Once
+	done         chan struct{} // closed after the subprocess exits and sessions are finished
+}
+
+// spawnShared starts the shared agent subprocess, wires its ReadLoop and
+// begins the initialize handshake in the background. The returned agent
+// holds one reference on behalf of the caller.
+func (e *Engine) spawnShared() (*sharedAgent, error) {
+	// The subprocess outlives individual sessions: no per-session CWD or env.
+	cmd, stdin, stdout, err := e.spawnSubprocess("", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &sharedAgent{
+		cmd:      cmd,
+		stdin:    stdin,
+		opts:     e.opts,
+		ready:    make(chan struct{}),
+		sessions: make(map[string]*process),
+		refs:     1,
+		done:     make(chan struct{}),
+	}
+	a.conn = e.newConn(stdout, stdin, func(_ []byte, err error) {
+		// Malformed lines cannot be attributed to a session — report to all.
+		a.broadcast(agentrun.Message{
+			Type:      agentrun.MessageError,
+			Content:   fmt.Sprintf("acp: malformed JSON from agent: %v", err),
+			Timestamp: time.Now(),
+		})
+	})
+	a.conn.OnNotification(MethodSessionUpdate, a.routeUpdate)
+	a.conn.OnMethod(MethodRequestPerm, a.routePermission)
+
+	go a.readLoop()
+	go a.initialize()
+	return a, nil
+}
+
+// initialize performs the connection-level initialize handshake once.
+// Per-session handshakes (session/new, session/load) run in Engine.Start.
+func (a *sharedAgent) initialize() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.HandshakeTimeout)
+	defer cancel()
+	if err := a.conn.Call(ctx, MethodInitialize, newInitializeParams(), &a.initResult); err != nil {
+		a.initErr = fmt.Errorf("acp: initialize: %w", err)
+	}
+	close(a.ready)
+	if a.initErr != nil {
+		a.mu.Lock()
+		a.closing = true
+		a.mu.Unlock()
+		a.shutdown(context.Background())
+	}
+}
+
+// waitReady blocks until the initialize handshake completes.
+func (a *sharedAgent) waitReady(ctx context.Context) error {
+	select {
+	case <-a.ready:
+		return a.initErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire takes a reference for a new session. Returns false once the agent
+// is closing or has exited — the caller must spawn a replacement.
+func (a *sharedAgent) acquire() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closing {
+		return false
+	}
+	a.refs++
+	return true
+}
+
+// release drops a reference. The last release shuts the subprocess down,
+// blocking until it exits (bounded by GracePeriod and ctx).
+func (a *sharedAgent) release(ctx context.Context) {
+	a.mu.Lock()
+	a.refs--
+	last := a.refs == 0
+	if last {
+		a.closing = true
+	}
+	a.mu.Unlock()
+	if last {
+		a.shutdown(ctx)
+	}
+}
+
+// register routes inbound traffic for sessionID to p and hands it the
+// updates that arrived for the session before. Registering the same
+// process twice is a no-op; a different live process already holding the
+// session ID is an error, as is registering once the agent is closing:
+// its sessions have been finished and p's would never be.
+func (a *sharedAgent) register(sessionID string, p *process) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closing {
+		return fmt.Errorf("acp: shared agent exited: %w", agentrun.ErrTerminated)
+	}
+	if cur, ok := a.sessions[sessionID]; ok && cur != p {
+		return fmt.Errorf("acp: session %s is already attached to this connection", sessionID)
+	}
+	a.sessions[sessionID] = p
+	// Under mu, so routeUpdate cannot slip a later update in between.
+	for _, update := range a.early[sessionID] {
+		p.enqueueUpdate(update)
+	}
+	delete(a.early, sessionID)
+	return nil
+}
+
+// beginOpen marks a session/new call in flight; updates for sessions not
+// yet registered are kept until endOpen.
+func (a *sharedAgent) beginOpen() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.opening++
+}
+
+// endOpen ends a session/new call begun with beginOpen. The last one drops
+// updates no session registered for.
+func (a *sharedAgent) endOpen() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.opening--
+	if a.opening == 0 {
+		a.early = nil
+	}
+}
+
+// unregister stops routing traffic for sessionID, if it still belongs to p.
+func (a *sharedAgent) unregister(sessionID string, p *process) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.sessions[sessionID] == p {
+		delete(a.sessions, sessionID)
+	}
+}
+
+// lookup returns the process registered for sessionID, or nil.
+func (a *sharedAgent) lookup(sessionID string) *process {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sessions[sessionID]
+}
+
+// routeUpdate dispatches a session/update notification to its session, or
+// keeps it for register while a session/new call is in flight.
+// Runs synchronously in ReadLoop; the per-process queue keeps it non-blocking.
+func (a *sharedAgent) routeUpdate(params json.RawMessage) {
+	var notif sessionNotification
+	if err := json.Unmarshal(params, &notif); err != nil {
+		return // no sessionId to route by — drop
+	}
+	a.mu.Lock()
+	p := a.sessions[notif.SessionID]
+	if p == nil && a.opening > 0 {
+		if a.early == nil {
+			a.early = make(map[string][]json.RawMessage)
+		}
+		a.early[notif.SessionID] = append(a.early[notif.SessionID], notif.Update)
+	}
+	a.mu.Unlock()
+	if p != nil {
+		p.enqueueUpdate(notif.Update)
+	}
+}
+
+// routePermission dispatches a permission request to its session's handler.
+// Requests for unknown sessions are cancelled without recording denials.
+func (a *sharedAgent) routePermission(params json.RawMessage) (any, error) {
+	var hdr struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(params, &hdr); err != nil {
+		return cancelledPermission(), nil
+	}
+	if p := a.lookup(hdr.SessionID); p != nil {
+		return p.handlePermission(params)
+	}
+	return cancelledPermission(), nil
+}
+
+// broadcast enqueues msg on every attached session.
+func (a *sharedAgent) broadcast(msg agentrun.Message) {
+	a.mu.Lock()
+	procs := make([]*process, 0, len(a.sessions))
+	for _, p := range a.sessions {
+		procs = append(procs, p)
+	}
+	a.mu.Unlock()
+	for _, p := range procs {
+		p.enqueue(msg)
+	}
+}
+
+// readLoop runs the connection's ReadLoop. When the subprocess goes away,
+// every attached session is finished with the terminal error — or with
+// ErrTerminated when the shutdown was a deliberate last release.
+func (a *sharedAgent) readLoop() {
+	a.conn.ReadLoop()
+
+	var err error
+	if readErr := a.conn.Err(); readErr != nil {
+		_ = procutil.Signal(a.cmd.Process, os.Kill)
+		_ = a.cmd.Wait() // reap zombie
+		err = fmt.Errorf("acp: reader: %w", readErr)
+	} else {
+		err = procutil.WrapExitError(a.cmd.Wait())
+	}
+
+	a.mu.Lock()
+	if a.closing {
+		err = agentrun.ErrTerminated
+	}
+	a.closing = true
+	procs := make([]*process, 0, len(a.sessions))
+	for id, p := range a.sessions {
+		procs = append(procs, p)
+		delete(a.sessions, id)
+	}
+	a.mu.Unlock()
+
+	if err == nil {
+		// Clean exit while sessions were still attached is still the end
+		// of those sessions.
+		err = agentrun.ErrTerminated
+	}
+	for _, p := range procs {
+		p.updates.close()
+		p.updates.wait()
+		p.finish(err)
+	}
+	close(a.done)
+}
+
+// shutdown terminates the subprocess: shutdown notification, stdin EOF,
+// SIGTERM, then SIGKILL after GracePeriod or when ctx expires.
+// Blocks until the ReadLoop goroutine has finished. Safe to call repeatedly.
+func (a *sharedAgent) shutdown(ctx context.Context) {
+	a.shutdownOnce.Do(func() {
+		_ = a.conn.Notify(MethodShutdown, nil)
+		_ = a.stdin.Close()
+		_ = procutil.Signal(a.cmd.Process, syscall.SIGTERM)
+
+		select {
+		case <-a.done:
+		case <-time.After(a.opts.GracePeriod):
+			_ = procutil.Signal(a.cmd.Process, os.Kill)
+		case <-ctx.Done():
+			_ = procutil.Signal(a.cmd.Process, os.Kill)
+		}
+	})
+	<-a.done
+}
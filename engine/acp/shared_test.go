@@ -0,0 +1,197 @@
+//go:build !windows
+
+package acp_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/acp"
+)
+
+// startShared starts a session on a shared-connection engine and returns the
+// process with its MessageInit.
+func startShared(t *testing.T, ctx context.Context, engine *acp.Engine) (agentrun.Process, agentrun.Message) {
+	t.Helper()
+	proc, err := engine.Start(ctx, agentrun.Session{CWD: t.TempDir()})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	init := <-proc.Output()
+	if init.Type != agentrun.MessageInit {
+		t.Fatalf("first message = %s, want init", init.Type)
+	}
+	return proc, init
+}
+
+func sharedPID(t *testing.T, init agentrun.Message) int {
+	t.Helper()
+	if init.Process == nil || init.Process.PID == 0 {
+		t.Fatal("MessageInit has no process metadata")
+	}
+	return init.Process.PID
+}
+
+func TestEngine_Shared_SessionsShareSubprocess(t *testing.T) {
+	engine := acp.NewEngine(acp.WithBinary(writeScript(t, "multi-session")), acp.WithSharedConnection())
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+
+	p1, init1 := startShared(t, ctx, engine)
+	p2, init2 := startShared(t, ctx, engine)
+
+	if sharedPID(t, init1) != sharedPID(t, init2) {
+		t.Errorf("PIDs differ: %d vs %d", init1.Process.PID, init2.Process.PID)
+	}
+	if init1.ResumeID == init2.ResumeID {
+		t.Errorf("sessions share ResumeID %q", init1.ResumeID)
+	}
+
+	// Run turns concurrently; each session sees only its own echo.
+	var wg sync.WaitGroup
+	for _, tc := range []struct {
+		proc   agentrun.Process
+		prompt string
+	}{{p1, "one"}, {p2, "two"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var msgs []agentrun.Message
+			err := agentrun.RunTurn(ctx, tc.proc, tc.prompt, func(m agentrun.Message) error {
+				msgs = append(msgs, m)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("%s: RunTurn: %v", tc.prompt, err)
+				return
+			}
+			text := concatContent(msgs, agentrun.MessageTextDelta)
+			if want := mockTextContent + "[" + tc.prompt + "]"; text != want {
+				t.Errorf("%s: text = %q, want %q", tc.prompt, text, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEngine_Shared_StopOneKeepsOthers(t *testing.T) {
+	engine := acp.NewEngine(acp.WithBinary(writeScript(t, "multi-session")), acp.WithSharedConnection())
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+
+	p1, _ := startShared(t, ctx, engine)
+	p2, _ := startShared(t, ctx, engine)
+
+	if err := p1.Stop(ctx); err != nil && !errors.Is(err, agentrun.ErrTerminated) {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := p1.Send(ctx, "late"); err == nil {
+		t.Error("Send after Stop should fail")
+	}
+
+	if err := p2.Send(ctx, "still here"); err != nil {
+		t.Fatalf("send on surviving session: %v", err)
+	}
+	msgs := collectUntilResult(p2.Output())
+	if findResult(msgs) == nil {
+		t.Fatal("expected MessageResult on surviving session")
+	}
+	if text := concatContent(msgs, agentrun.MessageTextDelta); !strings.Contains(text, "[still here]") {
+		t.Errorf("text = %q, want echo of prompt", text)
+	}
+}
+
+func TestEngine_Shared_RespawnAfterLastRelease(t *testing.T) {
+	engine := acp.NewEngine(acp.WithBinary(writeScript(t, "multi-session")), acp.WithSharedConnection())
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+
+	p1, init1 := startShared(t, ctx, engine)
+	if err := p1.Stop(ctx); err != nil && !errors.Is(err, agentrun.ErrTerminated) {
+		t.Fatalf("stop: %v", err)
+	}
+
+	_, init2 := startShared(t, ctx, engine)
+	if sharedPID(t, init1) == sharedPID(t, init2) {
+		t.Errorf("expected a new subprocess after the last session stopped, PID %d reused", init2.Process.PID)
+	}
+}
+
+func TestEngine_Shared_PermissionRouting(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	handler := func(_ context.Context, req acp.PermissionRequest) (bool, error) {
+		mu.Lock()
+		seen[req.SessionID] = true
+		mu.Unlock()
+		return true, nil
+	}
+	engine := acp.NewEngine(
+		acp.WithBinary(writeScript(t, "permission")),
+		acp.WithSharedConnection(),
+		acp.WithPermissionHandler(handler),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+
+	p1, init1 := startShared(t, ctx, engine)
+	p2, init2 := startShared(t, ctx, engine)
+
+	for _, p := range []agentrun.Process{p1, p2} {
+		if err := p.Send(ctx, "perm"); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if findResult(collectUntilResult(p.Output())) == nil {
+			t.Fatal("expected MessageResult")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, id := range []string{init1.ResumeID, init2.ResumeID} {
+		if !seen[id] {
+			t.Errorf("no permission request routed for session %q (seen %v)", id, seen)
+		}
+	}
+}
+
+func TestEngine_Shared_UpdateBeforeAttach(t *testing.T) {
+	engine := acp.NewEngine(acp.WithBinary(writeScript(t, "early-update")), acp.WithSharedConnection())
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+
+	// Not startShared: the update may be emitted ahead of MessageInit.
+	proc, err := engine.Start(ctx, agentrun.Session{CWD: t.TempDir()})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	if err := proc.Send(ctx, "hi"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	for _, m := range collectUntilResult(proc.Output()) {
+		if m.Type == agentrun.MessageSystem && m.Content == "available_commands_update" {
+			return
+		}
+	}
+	t.Error("update sent right after session/new was dropped")
+}
+
+func TestEngine_Shared_RejectsEnv(t *testing.T) {
+	engine := acp.NewEngine(acp.WithBinary(writeScript(t, "multi-session")), acp.WithSharedConnection())
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+
+	_, err := engine.Start(ctx, agentrun.Session{
+		CWD: t.TempDir(),
+		Env: map[string]string{"FOO": "bar"},
+	})
+	if err == nil {
+		t.Fatal("expected error for Session.Env in shared mode")
+	}
+}
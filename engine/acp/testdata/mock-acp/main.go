@@ -20,6 +20,12 @@
 //	ACP_MOCK_MODE=rich-usage        — respond with extended usage (cache, thinking tokens)
 //	ACP_MOCK_MODE=no-usage          — respond with no usage at all (nil)
 //	ACP_MOCK_MODE=oversized-line    — emit an oversized notification line after session/new
+//	ACP_MOCK_MODE=multi-session     — echo prompt text (for shared-connection routing tests)
+//	ACP_MOCK_MODE=extension         — send a "_mock/notice" extension notification during prompt
+//	ACP_MOCK_MODE=replay            — stream history during session/load, then one live update
+//	ACP_MOCK_MODE=early-update      — send available_commands_update right after session/new
+//
+// Each session/new returns the next sequential ID (mock-session-001, -002, ...).
 package main
 
 import (
@@ -55,6 +61,7 @@ var (
 	scanner         = bufio.NewScanner(os.Stdin)
 	mode            = os.Getenv("ACP_MOCK_MODE")
 	nextID          int64
+	sessionCount    int
 	pendingRequests []*rpcRequest // buffered by sendPermissionRequest
 )
 
@@ -126,7 +133,8 @@ func handleSessionNew(req *rpcRequest) {
 	}
 	_ = json.Unmarshal(req.Params, &params)
 
-	sessionID := "mock-session-001"
+	sessionCount++
+	sessionID := fmt.Sprintf("mock-session-%03d", sessionCount)
 	if mode == "echo-cwd" {
 		sessionID = "cwd-" + sanitizeCWD(params.CWD)
 	}
@@ -155,6 +163,14 @@ func handleSessionNew(req *rpcRequest) {
 		},
 	})
 
+	// Announce commands before the client has seen the new session ID.
+	if mode == "early-update" {
+		notifyUpdate(sessionID, map[string]any{
+			"sessionUpdate":     "available_commands_update",
+			"availableCommands": []any{},
+		})
+	}
+
 	// Emit an oversized notification line after session/new to trigger ErrLineTooLong.
 	if mode == "oversized-line" {
 		bigData := strings.Repeat("X", 8192)
@@ -170,6 +186,23 @@ func handleSessionLoad(req *rpcRequest) {
 		respondError(req.ID, -32000, "session not found")
 		return
 	}
+	var params struct {
+		SessionID string `json:"sessionId"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+
+	// Replay the prior conversation before answering, as ACP agents do.
+	if mode == "replay" {
+		notifyUpdate(params.SessionID, map[string]any{
+			"sessionUpdate": "user_message_chunk",
+			"content":       map[string]string{"type": "text", "text": "earlier question"},
+		})
+		notifyUpdate(params.SessionID, map[string]any{
+			"sessionUpdate": "agent_message_chunk",
+			"content":       map[string]string{"type": "text", "text": "earlier answer"},
+		})
+	}
+
 	// LoadSessionResult has NO sessionId field.
 	respond(req.ID, map[string]any{
 		"modes": map[string]any{
@@ -180,6 +213,14 @@ func handleSessionLoad(req *rpcRequest) {
 		},
 		"configOptions": []map[string]any{},
 	})
+
+	// A live update right after the load response — must not be marked replay.
+	if mode == "replay" {
+		notifyUpdate(params.SessionID, map[string]any{
+			"sessionUpdate": "agent_message_chunk",
+			"content":       map[string]string{"type": "text", "text": "live"},
+		})
+	}
 }
 
 func handleSessionPrompt(req *rpcRequest) {
@@ -200,7 +241,15 @@ func handleSessionPrompt(req *rpcRequest) {
 
 	// If permission mode, send a permission request first.
 	if mode == "permission" {
-		sendPermissionRequest()
+		sendPermissionRequest(sid)
+	}
+
+	if mode == "extension" {
+		_ = enc.Encode(map[string]any{
+			"jsonrpc": "2.0",
+			"method":  "_mock/notice",
+			"params":  map[string]string{"sessionId": sid},
+		})
 	}
 
 	// Emit streaming updates as notifications with new envelope format.
@@ -240,8 +289,9 @@ func handleSessionPrompt(req *rpcRequest) {
 		},
 	})
 
-	// In permission mode, echo prompt text for turn identification in tests.
-	if mode == "permission" && len(params.Prompt) > 0 && params.Prompt[0].Text != "" {
+	// In permission and multi-session modes, echo prompt text for turn
+	// (and session) identification in tests.
+	if (mode == "permission" || mode == "multi-session") && len(params.Prompt) > 0 && params.Prompt[0].Text != "" {
 		notifyUpdate(sid, map[string]any{
 			"sessionUpdate": "agent_message_chunk",
 			"content":       map[string]string{"type": "text", "text": "[" + params.Prompt[0].Text + "]"},
@@ -307,7 +357,7 @@ func handleSetConfigOption(req *rpcRequest) {
 	})
 }
 
-func sendPermissionRequest() {
+func sendPermissionRequest(sessionID string) {
 	nextID++
 	permID := nextID
 	req := map[string]any{
@@ -315,7 +365,7 @@ func sendPermissionRequest() {
 		"id":      permID,
 		"method":  "session/request_permission",
 		"params": map[string]any{
-			"sessionId": "mock-session-001",
+			"sessionId": sessionID,
 			"toolCall": map[string]any{
 				"toolCallId": "call_perm_001",
 				"title":      "write_file",
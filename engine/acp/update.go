@@ -168,9 +168,10 @@ func parseToolCallUpdate(update json.RawMessage) *agentrun.Message {
 
 	case "failed":
 		msg := agentrun.Message{
-			Type:      agentrun.MessageError,
-			ErrorCode: ErrCodeToolCallFailed,
-			Content:   errfmt.Truncate(fmt.Sprintf("tool_call failed: %s", d.Title)),
+			Type:          agentrun.MessageError,
+			ErrorCode:     ErrCodeToolCallFailed,
+			ErrorCategory: agentrun.CategoryToolFailed,
+			Content:       errfmt.Truncate(fmt.Sprintf("tool_call failed: %s", d.Title)),
 		}
 		return &msg
 
@@ -0,0 +1,273 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/sse"
+)
+
+// maxErrorBody bounds how much of a non-2xx response body is read.
+const maxErrorBody = 4 << 10
+
+// APIError is returned for non-2xx responses and for error events sent on
+// the stream.
+type APIError struct {
+	StatusCode int    // HTTP status; 0 for errors reported mid-stream
+	Type       string // error.type, e.g. "overloaded_error"
+	Message    string // error.message, or the raw body when not JSON
+
+	retryAfter time.Duration       // from the Retry-After header
+	rateLimit  *agentrun.RateLimit // from the rate limit headers of a 429
+}
+
+func (e *APIError) Error() string {
+	msg := "anthropic: "
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	} else {
+		msg += "stream error"
+	}
+	if e.Type != "" {
+		msg += ": " + e.Type
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// ErrorCategory classifies the error from its type and message, falling back
+// to the HTTP status. See [agentrun.ErrorCategoryOf].
+func (e *APIError) ErrorCategory() agentrun.ErrorCategory {
+	if c := errcat.Classify(e.Type, e.Message); c != "" {
+		return c
+	}
+	return errcat.FromStatus(e.StatusCode)
+}
+
+// RetryAfter returns the delay from the response's Retry-After header, or
+// 0 when absent. See [agentrun.RetryAfterOf].
+func (e *APIError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// RateLimit returns the limit that was hit, from the rate limit headers of
+// a 429 response. Nil for other errors. See [agentrun.RateLimitOf].
+func (e *APIError) RateLimit() *agentrun.RateLimit {
+	return e.rateLimit
+}
+
+// client streams message creations from the Messages API.
+type client struct {
+	endpoint   string
+	apiKey     string
+	apiVersion string
+	headers    http.Header
+	http       *http.Client
+	maxEvent   int
+}
+
+// newClient validates the base URL and returns a client for its
+// /v1/messages endpoint.
+func newClient(opts EngineOptions) (*client, error) {
+	base := strings.TrimRight(opts.BaseURL, "/")
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic: invalid base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("anthropic: invalid base URL %q: must be an absolute http or https URL", opts.BaseURL)
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &client{
+		endpoint:   base + "/v1/messages",
+		apiKey:     opts.APIKey,
+		apiVersion: opts.APIVersion,
+		headers:    opts.Headers,
+		http:       httpClient,
+		maxEvent:   opts.MaxEventSize,
+	}, nil
+}
+
+// stream posts req and calls fn for every stream event until the end of
+// the body. Error events end the stream with an APIError.
+func (c *client) stream(ctx context.Context, req *messagesRequest, fn func(*streamEvent)) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("anthropic: encode request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("anthropic: %w", err)
+	}
+	for k, v := range c.headers {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("anthropic-version", c.apiVersion)
+	if c.apiKey != "" {
+		httpReq.Header.Set("x-api-key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("anthropic: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp)
+	}
+
+	err = sse.Read(resp.Body, c.maxEvent, func(ev sse.Event) error {
+		var se streamEvent
+		if err := json.Unmarshal(ev.Data, &se); err != nil {
+			return fmt.Errorf("malformed event: %w", err)
+		}
+		if se.Type == "error" && se.Error != nil {
+			return se.Error.apiError(0)
+		}
+		fn(&se)
+		return nil
+	})
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err == nil:
+		return nil
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return fmt.Errorf("anthropic: read stream: %w", err)
+}
+
+// statusError builds an APIError from a non-2xx response.
+func statusError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var env struct {
+		Error *errorBody `json:"error"`
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	if json.Unmarshal(data, &env) == nil && env.Error != nil {
+		apiErr = env.Error.apiError(resp.StatusCode)
+	}
+	now := time.Now()
+	apiErr.retryAfter = errcat.RetryAfterHeader(resp.Header.Get("Retry-After"), now)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		apiErr.rateLimit = errcat.RateLimitHeaders(resp.Header, now)
+		if apiErr.rateLimit == nil {
+			apiErr.rateLimit = &agentrun.RateLimit{}
+		}
+		apiErr.rateLimit.Exceeded = true
+	}
+	return apiErr
+}
+
+// --- Wire shapes ---
+
+type messagesRequest struct {
+	Model        string          `json:"model"`
+	MaxTokens    int             `json:"max_tokens"`
+	System       string          `json:"system,omitempty"`
+	Messages     []message       `json:"messages"`
+	Tools        []toolSpec      `json:"tools,omitempty"`
+	Thinking     *thinkingConfig `json:"thinking,omitempty"`
+	OutputConfig *outputConfig   `json:"output_config,omitempty"`
+	Stream       bool            `json:"stream"`
+}
+
+type thinkingConfig struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type outputConfig struct {
+	Effort string `json:"effort"`
+}
+
+type toolSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+// contentBlock is the union of the content block types the engine sends
+// and receives: text, thinking, redacted_thinking, tool_use, tool_result.
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	Signature string          `json:"signature,omitempty"`
+	Data      string          `json:"data,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// streamEvent is one Messages streaming event: message_start,
+// content_block_start, content_block_delta, content_block_stop,
+// message_delta, message_stop, ping or error.
+type streamEvent struct {
+	Type         string        `json:"type"`
+	Message      *startMessage `json:"message,omitempty"`
+	Index        int           `json:"index"`
+	ContentBlock *contentBlock `json:"content_block,omitempty"`
+	Delta        *eventDelta   `json:"delta,omitempty"`
+	Usage        *usage        `json:"usage,omitempty"`
+	Error        *errorBody    `json:"error,omitempty"`
+}
+
+type startMessage struct {
+	Model string `json:"model"`
+	Usage usage  `json:"usage"`
+}
+
+// eventDelta is a content_block_delta or message_delta payload.
+type eventDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Thinking    string `json:"thinking"`
+	PartialJSON string `json:"partial_json"`
+	Signature   string `json:"signature"`
+	StopReason  string `json:"stop_reason"`
+}
+
+type usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type errorBody struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (e *errorBody) apiError(status int) *APIError {
+	return &APIError{StatusCode: status, Type: e.Type, Message: e.Message}
+}
@@ -0,0 +1,59 @@
+// Package anthropic provides an engine for the Anthropic Messages API,
+// for deployments where the claude CLI cannot be installed.
+//
+// The engine streams POST {BaseURL}/v1/messages over server-sent events
+// and keeps the conversation in memory, so every Send continues the same
+// conversation. Thinking blocks, including their signatures, are kept in
+// the history as the API requires for tool use with extended thinking.
+//
+//	engine := anthropic.NewEngine(
+//	    anthropic.WithAPIKey(os.Getenv("ANTHROPIC_API_KEY")),
+//	    anthropic.WithModel("claude-sonnet-4-5"),
+//	    anthropic.WithTools(registry),
+//	)
+//	proc, err := engine.Start(ctx, agentrun.Session{})
+//	err = agentrun.RunTurn(ctx, proc, "Summarize README.md", handle)
+//
+// # Streaming
+//
+// Stream events map as the claude CLI backend maps its stream_event
+// lines: text_delta → MessageTextDelta, thinking_delta →
+// MessageThinkingDelta, input_json_delta → MessageToolUseDelta;
+// signature_delta is kept for the history only. Each request's complete
+// thinking and text follow as MessageThinking and MessageText, and each
+// tool_use block as MessageToolUse once executed. Each Send ends with
+// MessageResult carrying the final text, the usage summed over the turn's
+// requests (including cache reads and writes), and the API's stop_reason
+// as StopReason. Output() must be drained concurrently with Send.
+//
+// # Tool loop
+//
+// Tools from the engine's tool.Registry are advertised on every request.
+// While the model stops with tool_use, the requested tools run in-process
+// and in parallel via tool.Registry.Run (MessageToolUse, MessageToolResult)
+// and their results are sent back in
+// one user message. The loop ends on any other stop reason, or after
+// OptionMaxTurns requests (default WithMaxTurns, 20) with StopReason
+// "max_turns". Tool errors are sent back with is_error and flagged with
+// Tool.IsError on the MessageToolResult.
+//
+// A failed request (APIError, transport error, cancelled ctx) discards the
+// turn from the conversation and is returned by Send; API errors are also
+// emitted as MessageError with the error type (e.g. "overloaded_error") as
+// ErrorCode, its ErrorCategory, and the Retry-After header as RetryAfter.
+// The process stays usable. Stop cancels any in-flight request.
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - Session.Model → model (falls back to WithModel; one is required)
+//   - OptionSystemPrompt → system
+//   - OptionThinkingBudget → thinking budget_tokens (max_tokens is raised
+//     above the budget when needed)
+//   - OptionMaxTurns → request limit per Send
+//   - OptionEffort → output_config.effort (low, medium, high; max → high;
+//     other values fail Start)
+//
+// Session.Prompt is not sent automatically, and OptionResumeID is ignored:
+// the conversation lives only in the Process.
+package anthropic
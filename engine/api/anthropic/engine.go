@@ -0,0 +1,131 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// Engine runs sessions against the Anthropic Messages API without the
+// Claude CLI. Each Start opens an in-memory conversation; every Send
+// streams one message (plus one per tool round) from the API.
+type Engine struct {
+	opts EngineOptions
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine creates an Anthropic Messages engine.
+func NewEngine(opts ...EngineOption) *Engine {
+	return &Engine{opts: resolveEngineOptions(opts...)}
+}
+
+// Validate checks that the configured base URL is well-formed. It does
+// not contact the API.
+func (e *Engine) Validate() error {
+	if _, err := newClient(e.opts); err != nil {
+		return fmt.Errorf("%w: %w", agentrun.ErrUnavailable, err)
+	}
+	return nil
+}
+
+// Start resolves the session's model and options and emits MessageInit.
+// No request is made until Send. Session.Prompt is not sent automatically.
+// Returns an error for invalid OptionMaxTurns or OptionThinkingBudget values.
+func (e *Engine) Start(_ context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	startOpts := agentrun.ResolveOptions(opts...)
+	session = session.Clone()
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+	if session.Model == "" {
+		session.Model = e.opts.Model
+	}
+	if session.Model == "" {
+		return nil, errors.New("anthropic: no model: set Session.Model or WithModel")
+	}
+
+	c, err := newClient(e.opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := e.resolveConfig(session)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProcess(c, cfg, e.opts)
+	p.emit(agentrun.Message{
+		Type:      agentrun.MessageInit,
+		Init:      &agentrun.InitMeta{Model: session.Model, AgentName: "anthropic"},
+		Timestamp: time.Now(),
+	})
+	return p, nil
+}
+
+// sessionConfig is the per-session request configuration resolved at Start.
+type sessionConfig struct {
+	model     string
+	system    string
+	maxTokens int
+	maxTurns  int
+	thinking  *thinkingConfig
+	output    *outputConfig
+}
+
+// resolveConfig maps session options onto request parameters.
+func (e *Engine) resolveConfig(session agentrun.Session) (sessionConfig, error) {
+	cfg := sessionConfig{
+		model:     session.Model,
+		system:    session.Options[agentrun.OptionSystemPrompt],
+		maxTokens: e.opts.MaxTokens,
+		maxTurns:  e.opts.MaxTurns,
+	}
+
+	maxTurns, ok, err := agentrun.ParsePositiveIntOption(session.Options, agentrun.OptionMaxTurns)
+	if err != nil {
+		return cfg, fmt.Errorf("anthropic: %w", err)
+	}
+	if ok {
+		cfg.maxTurns = maxTurns
+	}
+
+	budget, ok, err := agentrun.ParsePositiveIntOption(session.Options, agentrun.OptionThinkingBudget)
+	if err != nil {
+		return cfg, fmt.Errorf("anthropic: %w", err)
+	}
+	if ok {
+		cfg.thinking = &thinkingConfig{Type: "enabled", BudgetTokens: budget}
+		// max_tokens must exceed the thinking budget.
+		if cfg.maxTokens <= budget {
+			cfg.maxTokens = budget + e.opts.MaxTokens
+		}
+	}
+
+	effort, err := outputEffort(session.Options)
+	if err != nil {
+		return cfg, err
+	}
+	if effort != "" {
+		cfg.output = &outputConfig{Effort: effort}
+	}
+	return cfg, nil
+}
+
+// outputEffort maps OptionEffort to output_config.effort. max has no
+// equivalent and maps to "high"; unknown values are an error.
+func outputEffort(opts map[string]string) (string, error) {
+	switch e := agentrun.Effort(opts[agentrun.OptionEffort]); e {
+	case "":
+		return "", nil
+	case agentrun.EffortLow, agentrun.EffortMedium, agentrun.EffortHigh:
+		return string(e), nil
+	case agentrun.EffortMax:
+		return string(agentrun.EffortHigh), nil
+	default:
+		return "", fmt.Errorf("anthropic: unknown effort %q: valid: low, medium, high, max", e)
+	}
+}
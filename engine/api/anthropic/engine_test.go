@@ -0,0 +1,536 @@
+package anthropic_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/api/anthropic"
+	"github.com/dmora/agentrun/engine/api/tool"
+)
+
+const testTimeout = 10 * time.Second
+
+// --- Fake server ---
+
+// fakeServer is an httptest stand-in for /v1/messages. Each request is
+// recorded and answered by reply, which writes the SSE body.
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []messagesRequest
+	headers  []http.Header
+
+	reply func(w http.ResponseWriter, n int, req messagesRequest)
+}
+
+type messagesRequest struct {
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+	System    string `json:"system"`
+	Messages  []struct {
+		Role    string         `json:"role"`
+		Content []contentBlock `json:"content"`
+	} `json:"messages"`
+	Tools []struct {
+		Name        string          `json:"name"`
+		InputSchema json.RawMessage `json:"input_schema"`
+	} `json:"tools"`
+	Thinking *struct {
+		Type         string `json:"type"`
+		BudgetTokens int    `json:"budget_tokens"`
+	} `json:"thinking"`
+	OutputConfig *struct {
+		Effort string `json:"effort"`
+	} `json:"output_config"`
+	Stream bool `json:"stream"`
+}
+
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	Signature string          `json:"signature"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   string          `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	f := &fakeServer{reply: textReply("Hello!")}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/messages", f.handle)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	var req messagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.headers = append(f.headers, r.Header.Clone())
+	n := len(f.requests)
+	reply := f.reply
+	f.mu.Unlock()
+	reply(w, n, req)
+}
+
+func (f *fakeServer) request(i int) messagesRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[i]
+}
+
+func (f *fakeServer) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+func (f *fakeServer) engine(opts ...anthropic.EngineOption) *anthropic.Engine {
+	return anthropic.NewEngine(append([]anthropic.EngineOption{
+		anthropic.WithBaseURL(f.URL),
+		anthropic.WithModel("test-model"),
+	}, opts...)...)
+}
+
+// writeSSE writes events as named SSE events; the name is taken from each
+// payload's type field, as the API does.
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, e := range events {
+		var typed struct{ Type string }
+		_ = json.Unmarshal([]byte(e), &typed)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, e)
+		w.(http.Flusher).Flush()
+	}
+}
+
+const (
+	messageStart = `{"type":"message_start","message":{"model":"test-model","usage":{"input_tokens":10,"output_tokens":1,"cache_read_input_tokens":3,"cache_creation_input_tokens":2}}}`
+	messageStop  = `{"type":"message_stop"}`
+)
+
+func messageDelta(stop string, out int) string {
+	return fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":%q},"usage":{"output_tokens":%d}}`, stop, out)
+}
+
+// textReply streams text in two deltas, then end_turn.
+func textReply(text string) func(http.ResponseWriter, int, messagesRequest) {
+	half := len(text) / 2
+	return func(w http.ResponseWriter, _ int, _ messagesRequest) {
+		writeSSE(w,
+			messageStart,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, text[:half]),
+			fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, text[half:]),
+			`{"type":"content_block_stop","index":0}`,
+			messageDelta("end_turn", 4),
+			messageStop,
+		)
+	}
+}
+
+// toolThenText requests the "add" tool on the first request of a turn
+// (last message is the prompt) and answers with the tool result afterwards.
+func toolThenText(w http.ResponseWriter, _ int, req messagesRequest) {
+	last := req.Messages[len(req.Messages)-1]
+	if len(last.Content) > 0 && last.Content[0].Type == "tool_result" {
+		writeSSE(w,
+			messageStart,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%q}}`, "sum is "+last.Content[0].Content),
+			`{"type":"content_block_stop","index":0}`,
+			messageDelta("end_turn", 5),
+			messageStop,
+		)
+		return
+	}
+	writeSSE(w,
+		messageStart,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Use the tool."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"add","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\":2,"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"b\":3}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		messageDelta("tool_use", 7),
+		messageStop,
+	)
+}
+
+func addRegistry(t *testing.T) *tool.Registry {
+	t.Helper()
+	r, err := tool.NewRegistry(tool.Tool{
+		Name:        "add",
+		Description: "Adds two integers.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"a":{"type":"integer"},"b":{"type":"integer"}}}`),
+		Handler: func(_ context.Context, input json.RawMessage) (json.RawMessage, error) {
+			var in struct{ A, B int }
+			if err := json.Unmarshal(input, &in); err != nil {
+				return nil, err
+			}
+			return json.Marshal(in.A + in.B)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// --- Helpers ---
+
+func start(t *testing.T, e *anthropic.Engine, session agentrun.Session) agentrun.Process {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	proc, err := e.Start(ctx, session)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	init := <-proc.Output()
+	if init.Type != agentrun.MessageInit {
+		t.Fatalf("first message = %+v, want init", init)
+	}
+	return proc
+}
+
+func turn(t *testing.T, proc agentrun.Process, message string) ([]agentrun.Message, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	var msgs []agentrun.Message
+	err := agentrun.RunTurn(ctx, proc, message, func(m agentrun.Message) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	return msgs, err
+}
+
+func ofType(msgs []agentrun.Message, typ agentrun.MessageType) []agentrun.Message {
+	var out []agentrun.Message
+	for _, m := range msgs {
+		if m.Type == typ {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// --- Tests ---
+
+func TestStart_Init(t *testing.T) {
+	f := newFakeServer(t)
+	proc, err := f.engine().Start(context.Background(), agentrun.Session{Model: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Stop(context.Background())
+	init := <-proc.Output()
+	if init.Type != agentrun.MessageInit || init.Init == nil || init.Init.Model != "m1" || init.Init.AgentName != "anthropic" {
+		t.Errorf("init = %+v", init)
+	}
+	if f.requestCount() != 0 {
+		t.Error("Start must not make requests")
+	}
+}
+
+func TestStart_Errors(t *testing.T) {
+	if _, err := anthropic.NewEngine().Start(context.Background(), agentrun.Session{}); err == nil {
+		t.Error("Start without model should fail")
+	}
+	e := anthropic.NewEngine(anthropic.WithModel("m"))
+	_, err := e.Start(context.Background(), agentrun.Session{Options: map[string]string{agentrun.OptionThinkingBudget: "lots"}})
+	if err == nil {
+		t.Error("Start with invalid thinking budget should fail")
+	}
+	_, err = e.Start(context.Background(), agentrun.Session{Options: map[string]string{agentrun.OptionEffort: "extreme"}})
+	if err == nil || !strings.Contains(err.Error(), "unknown effort") {
+		t.Errorf("Start with unknown effort = %v, want error", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := anthropic.NewEngine().Validate(); err != nil {
+		t.Errorf("default Validate: %v", err)
+	}
+	err := anthropic.NewEngine(anthropic.WithBaseURL("ftp://x")).Validate()
+	if !errors.Is(err, agentrun.ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestSend_StreamsText(t *testing.T) {
+	f := newFakeServer(t)
+	proc := start(t, f.engine(
+		anthropic.WithAPIKey("sk-ant-test"),
+		anthropic.WithHeader("anthropic-beta", "b1"),
+		anthropic.WithMaxTokens(1024),
+	), agentrun.Session{
+		Options: map[string]string{
+			agentrun.OptionSystemPrompt:   "Be brief.",
+			agentrun.OptionThinkingBudget: "2048",
+			agentrun.OptionEffort:         "medium",
+		},
+	})
+
+	msgs, err := turn(t, proc, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed strings.Builder
+	for _, m := range ofType(msgs, agentrun.MessageTextDelta) {
+		streamed.WriteString(m.Content)
+	}
+	if streamed.String() != "Hello!" {
+		t.Errorf("deltas = %q", streamed.String())
+	}
+	if text := ofType(msgs, agentrun.MessageText); len(text) != 1 || text[0].Content != "Hello!" {
+		t.Errorf("text = %+v", text)
+	}
+	result := msgs[len(msgs)-1]
+	if result.Type != agentrun.MessageResult || result.Content != "Hello!" || result.StopReason != agentrun.StopEndTurn {
+		t.Fatalf("result = %+v", result)
+	}
+	want := agentrun.Usage{InputTokens: 10, OutputTokens: 4, CacheReadTokens: 3, CacheWriteTokens: 2}
+	if result.Usage == nil || *result.Usage != want {
+		t.Errorf("usage = %+v, want %+v", result.Usage, want)
+	}
+
+	req := f.request(0)
+	if req.Model != "test-model" || !req.Stream || req.System != "Be brief." {
+		t.Errorf("request = %+v", req)
+	}
+	if req.Thinking == nil || req.Thinking.Type != "enabled" || req.Thinking.BudgetTokens != 2048 || req.MaxTokens <= 2048 {
+		t.Errorf("thinking = %+v, max_tokens = %d", req.Thinking, req.MaxTokens)
+	}
+	if req.OutputConfig == nil || req.OutputConfig.Effort != "medium" {
+		t.Errorf("output_config = %+v", req.OutputConfig)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Role != "user" || req.Messages[0].Content[0].Text != "hi" {
+		t.Errorf("messages = %+v", req.Messages)
+	}
+	f.mu.Lock()
+	h := f.headers[0]
+	f.mu.Unlock()
+	if h.Get("x-api-key") != "sk-ant-test" || h.Get("anthropic-version") != "2023-06-01" || h.Get("anthropic-beta") != "b1" {
+		t.Errorf("headers = %v", h)
+	}
+}
+
+func TestSend_MultiTurnHistory(t *testing.T) {
+	f := newFakeServer(t)
+	proc := start(t, f.engine(), agentrun.Session{})
+	if _, err := turn(t, proc, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := turn(t, proc, "second"); err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	for _, m := range f.request(1).Messages {
+		roles = append(roles, m.Role+":"+m.Content[0].Text)
+	}
+	want := "user:first assistant:Hello! user:second"
+	if got := strings.Join(roles, " "); got != want {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+}
+
+func TestSend_ToolLoop(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = toolThenText
+	proc := start(t, f.engine(anthropic.WithTools(addRegistry(t))), agentrun.Session{})
+
+	msgs, err := turn(t, proc, "add 2 and 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th := ofType(msgs, agentrun.MessageThinking); len(th) != 1 || th[0].Content != "Use the tool." {
+		t.Errorf("thinking = %+v", th)
+	}
+	if d := ofType(msgs, agentrun.MessageToolUseDelta); len(d) != 2 {
+		t.Errorf("tool use deltas = %+v", d)
+	}
+	uses := ofType(msgs, agentrun.MessageToolUse)
+	if len(uses) != 1 || uses[0].Tool.Name != "add" || string(uses[0].Tool.Input) != `{"a":2,"b":3}` {
+		t.Fatalf("tool uses = %+v", uses)
+	}
+	results := ofType(msgs, agentrun.MessageToolResult)
+	if len(results) != 1 || string(results[0].Tool.Output) != "5" || results[0].Tool.IsError {
+		t.Fatalf("tool results = %+v", results)
+	}
+	result := msgs[len(msgs)-1]
+	if result.Content != "sum is 5" || result.Usage.InputTokens != 20 || result.Usage.OutputTokens != 12 {
+		t.Errorf("result = %+v usage %+v", result, result.Usage)
+	}
+
+	first := f.request(0)
+	if len(first.Tools) != 1 || first.Tools[0].Name != "add" || len(first.Tools[0].InputSchema) == 0 {
+		t.Errorf("tools = %+v", first.Tools)
+	}
+	second := f.request(1).Messages
+	if len(second) != 3 {
+		t.Fatalf("follow-up messages = %+v", second)
+	}
+	asst := second[1]
+	if asst.Role != "assistant" || len(asst.Content) != 2 ||
+		asst.Content[0].Type != "thinking" || asst.Content[0].Signature != "c2ln" ||
+		asst.Content[1].Type != "tool_use" || asst.Content[1].ID != "toolu_1" || string(asst.Content[1].Input) != `{"a":2,"b":3}` {
+		t.Errorf("assistant message = %+v", asst)
+	}
+	res := second[2]
+	if res.Role != "user" || res.Content[0].Type != "tool_result" || res.Content[0].ToolUseID != "toolu_1" ||
+		res.Content[0].Content != "5" || res.Content[0].IsError {
+		t.Errorf("tool result message = %+v", res)
+	}
+}
+
+func TestSend_UnknownTool(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = toolThenText
+	proc := start(t, f.engine(), agentrun.Session{}) // no tools registered
+
+	msgs, err := turn(t, proc, "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := ofType(msgs, agentrun.MessageToolResult)
+	if len(results) != 1 || !results[0].Tool.IsError || results[0].ErrorCode != "" {
+		t.Fatalf("tool results = %+v", results)
+	}
+	res := f.request(1).Messages[2].Content[0]
+	if !res.IsError || !strings.Contains(res.Content, "unknown tool") {
+		t.Errorf("tool result = %+v", res)
+	}
+}
+
+func TestSend_MaxTurns(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, n int, req messagesRequest) {
+		// Always call the tool, never answer.
+		req.Messages = req.Messages[:1]
+		toolThenText(w, n, req)
+	}
+	proc := start(t, f.engine(anthropic.WithTools(addRegistry(t))), agentrun.Session{
+		Options: map[string]string{agentrun.OptionMaxTurns: "2"},
+	})
+
+	msgs, err := turn(t, proc, "loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := msgs[len(msgs)-1]; r.Type != agentrun.MessageResult || r.StopReason != agentrun.StopMaxTurns {
+		t.Errorf("result = %+v", r)
+	}
+	if n := f.requestCount(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestSend_APIErrorDiscardsTurn(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, n int, req messagesRequest) {
+		if n == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(529)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+			return
+		}
+		textReply("ok")(w, n, req)
+	}
+	proc := start(t, f.engine(), agentrun.Session{})
+
+	msgs, err := turn(t, proc, "lost")
+	var apiErr *anthropic.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 529 || apiErr.Type != "overloaded_error" {
+		t.Fatalf("err = %v, want 529 APIError", err)
+	}
+	if e := ofType(msgs, agentrun.MessageError); len(e) != 1 || e[0].ErrorCode != "overloaded_error" ||
+		e[0].ErrorCategory != agentrun.CategoryOverloaded || e[0].RetryAfter != 7*time.Second {
+		t.Errorf("errors = %+v", e)
+	}
+	if agentrun.ErrorCategoryOf(err) != agentrun.CategoryOverloaded || agentrun.RetryAfterOf(err) != 7*time.Second {
+		t.Errorf("category = %q, retry after = %v", agentrun.ErrorCategoryOf(err), agentrun.RetryAfterOf(err))
+	}
+
+	if _, err := turn(t, proc, "kept"); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := f.request(1).Messages; len(msgs) != 1 || msgs[0].Content[0].Text != "kept" {
+		t.Errorf("history after failure = %+v", msgs)
+	}
+}
+
+func TestSend_StreamError(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, _ int, _ messagesRequest) {
+		writeSSE(w, messageStart, `{"type":"error","error":{"type":"api_error","message":"boom"}}`)
+	}
+	proc := start(t, f.engine(), agentrun.Session{})
+	_, err := turn(t, proc, "x")
+	var apiErr *anthropic.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 0 || apiErr.Type != "api_error" {
+		t.Errorf("err = %v, want stream APIError", err)
+	}
+}
+
+func TestStop_CancelsInFlight(t *testing.T) {
+	f := newFakeServer(t)
+	started := make(chan struct{})
+	// Block until the client goes away.
+	f.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req messagesRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		writeSSE(w, messageStart)
+		close(started)
+		<-r.Context().Done()
+	})
+	proc := start(t, f.engine(), agentrun.Session{})
+
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- proc.Send(context.Background(), "long") }()
+	go func() {
+		for range proc.Output() { //nolint:revive // drain
+		}
+	}()
+	<-started
+	if err := proc.Stop(context.Background()); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+	select {
+	case err := <-sendErr:
+		if !errors.Is(err, agentrun.ErrTerminated) {
+			t.Errorf("Send = %v, want ErrTerminated", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Send did not return after Stop")
+	}
+	if err := proc.Send(context.Background(), "again"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send after Stop = %v, want ErrTerminated", err)
+	}
+}
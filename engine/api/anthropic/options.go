@@ -0,0 +1,178 @@
+package anthropic
+
+import (
+	"net/http"
+
+	"github.com/dmora/agentrun/engine/api/tool"
+)
+
+// Default engine configuration values.
+const (
+	defaultBaseURL      = "https://api.anthropic.com"
+	defaultAPIVersion   = "2023-06-01"
+	defaultMaxTokens    = 8192
+	defaultOutputBuffer = 4096
+	defaultMaxTurns     = 20
+	defaultMaxEventSize = 4 << 20 // 4 MB — max SSE line size
+)
+
+// EngineOptions holds resolved construction-time configuration for an
+// Anthropic Messages engine.
+type EngineOptions struct {
+	// BaseURL is the API root that /v1/messages is appended to.
+	BaseURL string
+
+	// APIKey is sent in the x-api-key header. Empty sends no key (for
+	// gateways that authenticate by other means).
+	APIKey string
+
+	// APIVersion is sent in the anthropic-version header.
+	APIVersion string
+
+	// MaxTokens is the max_tokens sent with every request. It is raised
+	// above the thinking budget when OptionThinkingBudget requires it.
+	MaxTokens int
+
+	// Model is used when neither Session.Model nor agentrun.WithModel is set.
+	Model string
+
+	// Headers are added to every request (e.g. anthropic-beta feature
+	// flags).
+	Headers http.Header
+
+	// HTTPClient is used for all API requests. nil uses http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Tools are offered to the model on every request. nil offers none.
+	Tools *tool.Registry
+
+	// MaxTurns bounds the model requests per Send (one per tool round) when
+	// agentrun.OptionMaxTurns is not set.
+	MaxTurns int
+
+	// OutputBuffer is the channel buffer size for process output messages.
+	OutputBuffer int
+
+	// MaxEventSize is the maximum SSE line size in bytes.
+	MaxEventSize int
+}
+
+// EngineOption configures an Engine at construction time.
+type EngineOption func(*EngineOptions)
+
+// WithBaseURL sets the API root (default "https://api.anthropic.com").
+func WithBaseURL(u string) EngineOption {
+	return func(o *EngineOptions) {
+		if u != "" {
+			o.BaseURL = u
+		}
+	}
+}
+
+// WithAPIKey sets the API key sent with every request.
+func WithAPIKey(key string) EngineOption {
+	return func(o *EngineOptions) {
+		o.APIKey = key
+	}
+}
+
+// WithAPIVersion overrides the anthropic-version header (default "2023-06-01").
+func WithAPIVersion(v string) EngineOption {
+	return func(o *EngineOptions) {
+		if v != "" {
+			o.APIVersion = v
+		}
+	}
+}
+
+// WithMaxTokens sets max_tokens for every request (default 8192).
+// Values <= 0 are ignored.
+func WithMaxTokens(n int) EngineOption {
+	return func(o *EngineOptions) {
+		if n > 0 {
+			o.MaxTokens = n
+		}
+	}
+}
+
+// WithModel sets the default model for sessions that do not name one.
+func WithModel(model string) EngineOption {
+	return func(o *EngineOptions) {
+		o.Model = model
+	}
+}
+
+// WithHeader adds a header to every request.
+func WithHeader(key, value string) EngineOption {
+	return func(o *EngineOptions) {
+		if o.Headers == nil {
+			o.Headers = make(http.Header)
+		}
+		o.Headers.Add(key, value)
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for API requests. The client
+// should not set a short Timeout: responses stream for the whole
+// generation.
+func WithHTTPClient(c *http.Client) EngineOption {
+	return func(o *EngineOptions) {
+		o.HTTPClient = c
+	}
+}
+
+// WithTools sets the tools offered to the model. Tool calls are executed
+// in-process and their results sent back until the model stops calling
+// tools or MaxTurns is reached.
+func WithTools(r *tool.Registry) EngineOption {
+	return func(o *EngineOptions) {
+		o.Tools = r
+	}
+}
+
+// WithMaxTurns sets the default bound on model requests per Send.
+// Values <= 0 are ignored.
+func WithMaxTurns(n int) EngineOption {
+	return func(o *EngineOptions) {
+		if n > 0 {
+			o.MaxTurns = n
+		}
+	}
+}
+
+// WithOutputBuffer sets the channel buffer size for process output messages.
+// Values <= 0 are ignored.
+func WithOutputBuffer(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.OutputBuffer = size
+		}
+	}
+}
+
+// WithMaxEventSize sets the maximum SSE line size in bytes.
+// Values <= 0 are ignored.
+func WithMaxEventSize(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.MaxEventSize = size
+		}
+	}
+}
+
+func resolveEngineOptions(opts ...EngineOption) EngineOptions {
+	o := EngineOptions{
+		BaseURL:      defaultBaseURL,
+		APIVersion:   defaultAPIVersion,
+		MaxTokens:    defaultMaxTokens,
+		MaxTurns:     defaultMaxTurns,
+		OutputBuffer: defaultOutputBuffer,
+		MaxEventSize: defaultMaxEventSize,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
@@ -0,0 +1,465 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/api/tool"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/stoputil"
+)
+
+// process implements agentrun.Process for one in-memory conversation.
+type process struct {
+	client *client
+	opts   EngineOptions
+	cfg    sessionConfig
+	tools  []toolSpec
+
+	turnMu  sync.Mutex // serializes turns; guards history
+	history []message
+
+	output       chan agentrun.Message
+	outputMu     sync.Mutex // guards output channel close
+	outputClosed bool
+	done         chan struct{}
+
+	termErr    error
+	stopping   atomic.Bool
+	stopOnce   sync.Once
+	finishOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var _ agentrun.Process = (*process)(nil)
+
+func newProcess(c *client, cfg sessionConfig, opts EngineOptions) *process {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &process{
+		client: c,
+		opts:   opts,
+		cfg:    cfg,
+		tools:  toolSpecs(opts.Tools),
+		output: make(chan agentrun.Message, opts.OutputBuffer),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// toolSpecs converts the registry into the request's tools array.
+func toolSpecs(r *tool.Registry) []toolSpec {
+	var specs []toolSpec
+	for _, t := range r.Tools() {
+		specs = append(specs, toolSpec{Name: t.Name, Description: t.Description, InputSchema: t.Schema()})
+	}
+	return specs
+}
+
+// Output returns the channel for receiving messages from the agent.
+func (p *process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send appends message to the conversation and runs the turn: it streams
+// messages, executing requested tools between them, until the model stops
+// for a reason other than tool_use or the turn limit is reached, then
+// emits MessageResult. Blocks until the turn ends; the caller must drain
+// Output() concurrently.
+//
+// On failure (API error, ctx expiry) the turn is discarded from the
+// conversation, MessageError is emitted for API errors, and the error is
+// returned. The process stays usable.
+func (p *process) Send(ctx context.Context, msg string) error {
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+	p.turnMu.Lock()
+	defer p.turnMu.Unlock()
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+
+	// Stop cancels the in-flight request.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(p.ctx, cancel)()
+
+	mark := len(p.history)
+	p.history = append(p.history, message{Role: "user", Content: []contentBlock{{Type: "text", Text: msg}}})
+	if err := p.runTurn(ctx); err != nil {
+		p.history = p.history[:mark]
+		if p.stopping.Load() {
+			return agentrun.ErrTerminated
+		}
+		if ctx.Err() == nil {
+			p.emitError(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// runTurn runs rounds until the model stops calling tools or maxTurns
+// requests have been made, then emits MessageResult.
+func (p *process) runTurn(ctx context.Context) error {
+	var total agentrun.Usage
+	for n := 1; ; n++ {
+		r, err := p.complete(ctx)
+		if err != nil {
+			return err
+		}
+		addUsage(&total, &r.usage)
+		p.emitRound(r)
+
+		uses := r.toolUses()
+		if len(uses) == 0 || r.stop != "tool_use" {
+			// Unanswered tool_use blocks (e.g. cut off by max_tokens)
+			// would make the next request invalid; keep the rest.
+			// An empty reply is left out: the API rejects empty content
+			// and merges the consecutive user messages that result.
+			if m := r.assistantMessage(len(uses) == 0); len(m.Content) > 0 {
+				p.history = append(p.history, m)
+			}
+			p.emitResult(r.text(), stopReason(r.stop), &total)
+			return nil
+		}
+		p.history = append(p.history, r.assistantMessage(true))
+		if err := p.runTools(ctx, uses); err != nil {
+			return err
+		}
+		if n >= p.cfg.maxTurns {
+			p.emitResult(r.text(), agentrun.StopMaxTurns, &total)
+			return nil
+		}
+	}
+}
+
+// complete streams one message for the current history, emitting text,
+// thinking and tool input deltas as they arrive.
+func (p *process) complete(ctx context.Context) (*round, error) {
+	req := &messagesRequest{
+		Model:        p.cfg.model,
+		MaxTokens:    p.cfg.maxTokens,
+		System:       p.cfg.system,
+		Messages:     p.history,
+		Tools:        p.tools,
+		Thinking:     p.cfg.thinking,
+		OutputConfig: p.cfg.output,
+		Stream:       true,
+	}
+	r := &round{}
+	err := p.client.stream(ctx, req, func(ev *streamEvent) {
+		if msg, ok := r.apply(ev); ok {
+			p.emit(msg)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// emitRound emits the round's complete thinking and text.
+func (p *process) emitRound(r *round) {
+	if th := r.thinking(); th != "" {
+		p.emit(agentrun.Message{Type: agentrun.MessageThinking, Content: th})
+	}
+	if text := r.text(); text != "" {
+		p.emit(agentrun.Message{Type: agentrun.MessageText, Content: text})
+	}
+}
+
+// runTools executes tool_use blocks in parallel (emitting MessageToolUse
+// and MessageToolResult) and appends one user message carrying every
+// tool_result in call order. Tool failures are reported to the model with
+// is_error, not returned; only ctx expiry aborts the turn.
+func (p *process) runTools(ctx context.Context, uses []contentBlock) error {
+	calls := make([]tool.Call, len(uses))
+	for i, use := range uses {
+		calls[i] = tool.Call{ID: use.ID, Name: use.Name, Input: use.Input}
+	}
+	results, err := p.opts.Tools.Run(ctx, calls, p.emit)
+	if err != nil {
+		return err
+	}
+	blocks := make([]contentBlock, len(results))
+	for i, res := range results {
+		blocks[i] = contentBlock{Type: "tool_result", ToolUseID: res.Call.ID, Content: res.Text(), IsError: res.Err != nil}
+	}
+	p.history = append(p.history, message{Role: "user", Content: blocks})
+	return nil
+}
+
+// emitResult emits the turn's MessageResult.
+func (p *process) emitResult(text string, stop agentrun.StopReason, total *agentrun.Usage) {
+	msg := agentrun.Message{Type: agentrun.MessageResult, Content: text, StopReason: stop}
+	if *total != (agentrun.Usage{}) {
+		u := *total
+		msg.Usage = &u
+	}
+	p.emit(msg)
+}
+
+// emitError emits MessageError for a failed turn.
+func (p *process) emitError(err error) {
+	msg := agentrun.Message{Type: agentrun.MessageError, Content: errfmt.Truncate(err.Error())}
+	msg.ErrorCategory = agentrun.ErrorCategoryOf(err)
+	msg.RetryAfter = agentrun.RetryAfterOf(err)
+	msg.RateLimit = agentrun.RateLimitOf(err)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		msg.ErrorCode = errfmt.SanitizeCode(apiErr.Type)
+	}
+	errcat.Apply(&msg)
+	p.emit(msg)
+}
+
+// --- round ---
+
+// round accumulates one streamed message.
+type round struct {
+	blocks []contentBlock // by stream index
+	inputs map[int]*strings.Builder
+	stop   string
+	usage  usage
+}
+
+// apply folds a stream event into the round. Returns the delta message to
+// emit, if any — the same mapping the claude CLI parser applies to
+// stream_event lines.
+func (r *round) apply(ev *streamEvent) (agentrun.Message, bool) {
+	switch ev.Type {
+	case "message_start":
+		if ev.Message != nil {
+			r.usage = ev.Message.Usage
+		}
+	case "content_block_start":
+		if ev.ContentBlock != nil && ev.Index == len(r.blocks) {
+			b := *ev.ContentBlock
+			b.Input = nil // streamed via input_json_delta
+			r.blocks = append(r.blocks, b)
+		}
+	case "content_block_delta":
+		return r.applyDelta(ev)
+	case "content_block_stop":
+		if b := r.block(ev.Index); b != nil && b.Type == "tool_use" {
+			b.Input = toolInput(r.inputs[ev.Index])
+		}
+	case "message_delta":
+		if ev.Delta != nil && ev.Delta.StopReason != "" {
+			r.stop = ev.Delta.StopReason
+		}
+		if ev.Usage != nil {
+			r.usage.OutputTokens = ev.Usage.OutputTokens
+		}
+	}
+	return agentrun.Message{}, false
+}
+
+// applyDelta handles content_block_delta events.
+func (r *round) applyDelta(ev *streamEvent) (agentrun.Message, bool) {
+	b := r.block(ev.Index)
+	if b == nil || ev.Delta == nil {
+		return agentrun.Message{}, false
+	}
+	d := ev.Delta
+	switch d.Type {
+	case "text_delta":
+		b.Text += d.Text
+		return agentrun.Message{Type: agentrun.MessageTextDelta, Content: d.Text}, d.Text != ""
+	case "thinking_delta":
+		b.Thinking += d.Thinking
+		return agentrun.Message{Type: agentrun.MessageThinkingDelta, Content: d.Thinking}, d.Thinking != ""
+	case "input_json_delta":
+		if r.inputs == nil {
+			r.inputs = make(map[int]*strings.Builder)
+		}
+		if r.inputs[ev.Index] == nil {
+			r.inputs[ev.Index] = &strings.Builder{}
+		}
+		r.inputs[ev.Index].WriteString(d.PartialJSON)
+		return agentrun.Message{Type: agentrun.MessageToolUseDelta, Content: d.PartialJSON}, d.PartialJSON != ""
+	case "signature_delta":
+		b.Signature += d.Signature
+	}
+	return agentrun.Message{}, false
+}
+
+// block returns the block at index, or nil when out of range.
+func (r *round) block(index int) *contentBlock {
+	if index < 0 || index >= len(r.blocks) {
+		return nil
+	}
+	return &r.blocks[index]
+}
+
+// text returns the concatenated text blocks.
+func (r *round) text() string {
+	var sb strings.Builder
+	for _, b := range r.blocks {
+		if b.Type == "text" {
+			sb.WriteString(b.Text)
+		}
+	}
+	return sb.String()
+}
+
+// thinking returns the concatenated thinking blocks.
+func (r *round) thinking() string {
+	var sb strings.Builder
+	for _, b := range r.blocks {
+		if b.Type == "thinking" {
+			sb.WriteString(b.Thinking)
+		}
+	}
+	return sb.String()
+}
+
+// toolUses returns the round's tool_use blocks.
+func (r *round) toolUses() []contentBlock {
+	var uses []contentBlock
+	for _, b := range r.blocks {
+		if b.Type == "tool_use" {
+			uses = append(uses, b)
+		}
+	}
+	return uses
+}
+
+// assistantMessage returns the round as a conversation message. Empty
+// text blocks are dropped (the API rejects them), as are tool_use blocks
+// unless withTools is set. The result may have no content.
+func (r *round) assistantMessage(withTools bool) message {
+	content := make([]contentBlock, 0, len(r.blocks))
+	for _, b := range r.blocks {
+		switch {
+		case b.Type == "text" && b.Text == "":
+			continue
+		case b.Type == "tool_use" && !withTools:
+			continue
+		}
+		content = append(content, b)
+	}
+	return message{Role: "assistant", Content: content}
+}
+
+// --- helpers ---
+
+// toolInput returns streamed tool input as raw JSON, or as a JSON string
+// when the model produced invalid JSON. Empty input becomes "{}".
+func toolInput(sb *strings.Builder) json.RawMessage {
+	if sb == nil || strings.TrimSpace(sb.String()) == "" {
+		return json.RawMessage(`{}`)
+	}
+	s := sb.String()
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// stopReason maps stop_reason to a StopReason. The API's values
+// (end_turn, max_tokens, tool_use, stop_sequence, pause_turn, refusal)
+// pass through.
+func stopReason(reason string) agentrun.StopReason {
+	if reason == "" {
+		return agentrun.StopEndTurn
+	}
+	return stoputil.Sanitize(reason)
+}
+
+// addUsage adds a round's usage to total.
+func addUsage(total *agentrun.Usage, u *usage) {
+	total.InputTokens += u.InputTokens
+	total.OutputTokens += u.OutputTokens
+	total.CacheReadTokens += u.CacheReadInputTokens
+	total.CacheWriteTokens += u.CacheCreationInputTokens
+}
+
+// --- Lifecycle ---
+
+// Stop cancels any in-flight request and ends the process.
+// Safe to call multiple times.
+func (p *process) Stop(context.Context) error {
+	p.stopOnce.Do(func() {
+		p.stopping.Store(true)
+		p.cancel()
+		p.finish(agentrun.ErrTerminated)
+	})
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends.
+func (p *process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// terminated reports whether the process is stopping or has ended.
+func (p *process) terminated() bool {
+	if p.stopping.Load() {
+		return true
+	}
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// emit sends a message to the output channel. Blocks until delivered,
+// context is cancelled, or the channel is marked closed by finish().
+func (p *process) emit(msg agentrun.Message) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+	if p.outputClosed {
+		return
+	}
+	select {
+	case p.output <- msg:
+	case <-p.ctx.Done():
+	}
+}
+
+// finish sets the terminal error and closes done+output channels.
+// done closes before output so Err() is valid once a consumer's range
+// over Output() exits.
+func (p *process) finish(err error) {
+	p.finishOnce.Do(func() {
+		p.termErr = err
+		p.cancel()
+
+		close(p.done)
+
+		p.outputMu.Lock()
+		p.outputClosed = true
+		close(p.output)
+		p.outputMu.Unlock()
+	})
+}
@@ -0,0 +1,109 @@
+package anthropic
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestRound_Apply(t *testing.T) {
+	r := &round{}
+	events := []streamEvent{
+		{Type: "message_start", Message: &startMessage{Usage: usage{InputTokens: 12, CacheReadInputTokens: 100}}},
+		{Type: "content_block_start", Index: 0, ContentBlock: &contentBlock{Type: "thinking"}},
+		{Type: "content_block_delta", Index: 0, Delta: &eventDelta{Type: "thinking_delta", Thinking: "hmm"}},
+		{Type: "content_block_delta", Index: 0, Delta: &eventDelta{Type: "signature_delta", Signature: "sig"}},
+		{Type: "content_block_stop", Index: 0},
+		{Type: "content_block_start", Index: 1, ContentBlock: &contentBlock{Type: "text"}},
+		{Type: "content_block_delta", Index: 1, Delta: &eventDelta{Type: "text_delta", Text: "Checking."}},
+		{Type: "content_block_stop", Index: 1},
+		{Type: "content_block_start", Index: 2, ContentBlock: &contentBlock{Type: "tool_use", ID: "toolu_1", Name: "add"}},
+		{Type: "content_block_delta", Index: 2, Delta: &eventDelta{Type: "input_json_delta", PartialJSON: `{"a":`}},
+		{Type: "content_block_delta", Index: 2, Delta: &eventDelta{Type: "input_json_delta", PartialJSON: `1}`}},
+		{Type: "content_block_stop", Index: 2},
+		{Type: "content_block_delta", Index: 9, Delta: &eventDelta{Type: "text_delta", Text: "out of range"}},
+		{Type: "message_delta", Delta: &eventDelta{StopReason: "tool_use"}, Usage: &usage{OutputTokens: 30}},
+		{Type: "message_stop"},
+	}
+	var deltas []agentrun.MessageType
+	for i := range events {
+		if msg, ok := r.apply(&events[i]); ok {
+			deltas = append(deltas, msg.Type)
+		}
+	}
+
+	want := []agentrun.MessageType{
+		agentrun.MessageThinkingDelta, agentrun.MessageTextDelta,
+		agentrun.MessageToolUseDelta, agentrun.MessageToolUseDelta,
+	}
+	if len(deltas) != len(want) {
+		t.Fatalf("deltas = %v, want %v", deltas, want)
+	}
+	for i := range want {
+		if deltas[i] != want[i] {
+			t.Errorf("delta %d = %s, want %s", i, deltas[i], want[i])
+		}
+	}
+	if r.thinking() != "hmm" || r.blocks[0].Signature != "sig" || r.text() != "Checking." {
+		t.Errorf("round = %+v", r.blocks)
+	}
+	uses := r.toolUses()
+	if len(uses) != 1 || uses[0].ID != "toolu_1" || string(uses[0].Input) != `{"a":1}` {
+		t.Errorf("tool uses = %+v", uses)
+	}
+	if r.stop != "tool_use" || r.usage.InputTokens != 12 || r.usage.OutputTokens != 30 || r.usage.CacheReadInputTokens != 100 {
+		t.Errorf("stop = %q, usage = %+v", r.stop, r.usage)
+	}
+}
+
+func TestRound_AssistantMessage(t *testing.T) {
+	r := &round{blocks: []contentBlock{
+		{Type: "text"},
+		{Type: "tool_use", ID: "t", Name: "x", Input: []byte(`{}`)},
+	}}
+	if m := r.assistantMessage(true); len(m.Content) != 1 || m.Content[0].Type != "tool_use" {
+		t.Errorf("with tools = %+v", m.Content)
+	}
+	if m := r.assistantMessage(false); len(m.Content) != 0 {
+		t.Errorf("without tools = %+v", m.Content)
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	tests := map[string]agentrun.StopReason{
+		"":           agentrun.StopEndTurn,
+		"end_turn":   agentrun.StopEndTurn,
+		"max_tokens": agentrun.StopMaxTokens,
+		"refusal":    "refusal",
+	}
+	for in, want := range tests {
+		if got := stopReason(in); got != want {
+			t.Errorf("stopReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestResolveConfig(t *testing.T) {
+	e := NewEngine(WithMaxTokens(4096))
+	cfg, err := e.resolveConfig(agentrun.Session{Model: "m", Options: map[string]string{
+		agentrun.OptionSystemPrompt:   "sys",
+		agentrun.OptionThinkingBudget: "10000",
+		agentrun.OptionMaxTurns:       "3",
+		agentrun.OptionEffort:         "max",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.system != "sys" || cfg.maxTurns != 3 || cfg.output == nil || cfg.output.Effort != "high" {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if cfg.thinking == nil || cfg.thinking.BudgetTokens != 10000 || cfg.maxTokens != 14096 {
+		t.Errorf("thinking = %+v, maxTokens = %d", cfg.thinking, cfg.maxTokens)
+	}
+
+	for _, key := range []string{agentrun.OptionThinkingBudget, agentrun.OptionMaxTurns} {
+		if _, err := e.resolveConfig(agentrun.Session{Options: map[string]string{key: "-1"}}); err == nil {
+			t.Errorf("%s=-1 should fail", key)
+		}
+	}
+}
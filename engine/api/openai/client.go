@@ -0,0 +1,284 @@
+package openai
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/sse"
+)
+
+// maxErrorBody bounds how much of a non-2xx response body is read.
+const maxErrorBody = 4 << 10
+
+// doneData is the sentinel data of the final stream event.
+const doneData = "[DONE]"
+
+// APIError is returned for non-2xx responses and for error objects sent
+// on the stream.
+type APIError struct {
+	StatusCode int    // HTTP status; 0 for errors reported mid-stream
+	Type       string // error.type, if reported
+	Code       string // error.code, if reported
+	Message    string // error.message, or the raw body when not JSON
+
+	retryAfter time.Duration       // from the Retry-After header
+	rateLimit  *agentrun.RateLimit // from the rate limit headers of a 429
+}
+
+func (e *APIError) Error() string {
+	msg := "openai: "
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	} else {
+		msg += "stream error"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// ErrorCategory classifies the error from its code or type and message,
+// falling back to the HTTP status. See [agentrun.ErrorCategoryOf].
+func (e *APIError) ErrorCategory() agentrun.ErrorCategory {
+	if c := errcat.Classify(cmp.Or(e.Code, e.Type), e.Message); c != "" {
+		return c
+	}
+	return errcat.FromStatus(e.StatusCode)
+}
+
+// RetryAfter returns the delay from the response's Retry-After header, or
+// 0 when absent. See [agentrun.RetryAfterOf].
+func (e *APIError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// RateLimit returns the limit that was hit, from the rate limit headers of
+// a 429 response. Nil for other errors. See [agentrun.RateLimitOf].
+func (e *APIError) RateLimit() *agentrun.RateLimit {
+	return e.rateLimit
+}
+
+// client streams chat completions from one OpenAI-compatible endpoint.
+type client struct {
+	endpoint string
+	apiKey   string
+	headers  http.Header
+	http     *http.Client
+	maxEvent int
+}
+
+// newClient validates baseURL and returns a client for its
+// /chat/completions endpoint.
+func newClient(opts EngineOptions) (*client, error) {
+	base := strings.TrimRight(opts.BaseURL, "/")
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("openai: invalid base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("openai: invalid base URL %q: must be an absolute http or https URL", opts.BaseURL)
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &client{
+		endpoint: base + "/chat/completions",
+		apiKey:   opts.APIKey,
+		headers:  opts.Headers,
+		http:     httpClient,
+		maxEvent: opts.MaxEventSize,
+	}, nil
+}
+
+// stream posts req and calls fn for every chunk until the [DONE] event or
+// the end of the body.
+func (c *client) stream(ctx context.Context, req *chatRequest, fn func(*chunk)) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("openai: encode request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("openai: %w", err)
+	}
+	for k, v := range c.headers {
+		httpReq.Header[k] = v
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("openai: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError(resp)
+	}
+
+	errDone := errors.New("done")
+	err = sse.Read(resp.Body, c.maxEvent, func(ev sse.Event) error {
+		if string(ev.Data) == doneData {
+			return errDone
+		}
+		var ch chunk
+		if err := json.Unmarshal(ev.Data, &ch); err != nil {
+			return fmt.Errorf("malformed chunk: %w", err)
+		}
+		if ch.Error != nil {
+			return ch.Error.apiError(0)
+		}
+		fn(&ch)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errDone):
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err == nil:
+		return nil // some servers end the body without [DONE]
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return fmt.Errorf("openai: read stream: %w", err)
+}
+
+// statusError builds an APIError from a non-2xx response.
+func statusError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var env struct {
+		Error *errorBody `json:"error"`
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+	if json.Unmarshal(data, &env) == nil && env.Error != nil {
+		apiErr = env.Error.apiError(resp.StatusCode)
+	}
+	now := time.Now()
+	apiErr.retryAfter = errcat.RetryAfterHeader(resp.Header.Get("Retry-After"), now)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		apiErr.rateLimit = errcat.RateLimitHeaders(resp.Header, now)
+		if apiErr.rateLimit == nil {
+			apiErr.rateLimit = &agentrun.RateLimit{}
+		}
+		apiErr.rateLimit.Exceeded = true
+	}
+	return apiErr
+}
+
+// --- Wire shapes ---
+
+type chatRequest struct {
+	Model           string         `json:"model"`
+	Messages        []chatMessage  `json:"messages"`
+	Tools           []toolSpec     `json:"tools,omitempty"`
+	Stream          bool           `json:"stream"`
+	StreamOptions   *streamOptions `json:"stream_options,omitempty"`
+	ReasoningEffort string         `json:"reasoning_effort,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type toolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function functionCall `json:"function"`
+}
+
+type functionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type toolSpec struct {
+	Type     string       `json:"type"`
+	Function functionSpec `json:"function"`
+}
+
+type functionSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type chunk struct {
+	Choices []choice   `json:"choices"`
+	Usage   *usage     `json:"usage,omitempty"`
+	Error   *errorBody `json:"error,omitempty"`
+}
+
+type choice struct {
+	Index        int    `json:"index"`
+	Delta        delta  `json:"delta"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// delta is a streamed message fragment. Reasoning text arrives as
+// reasoning_content (vLLM, DeepSeek) or reasoning (Ollama, OpenRouter).
+type delta struct {
+	Content          string          `json:"content"`
+	ReasoningContent string          `json:"reasoning_content"`
+	Reasoning        string          `json:"reasoning"`
+	ToolCalls        []toolCallDelta `json:"tool_calls"`
+}
+
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type usage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+}
+
+type errorBody struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    any    `json:"code"` // string on OpenAI, number on some servers
+}
+
+func (e *errorBody) apiError(status int) *APIError {
+	code := ""
+	if e.Code != nil {
+		code = fmt.Sprint(e.Code)
+	}
+	return &APIError{StatusCode: status, Type: e.Type, Code: code, Message: e.Message}
+}
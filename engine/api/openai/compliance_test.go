@@ -0,0 +1,14 @@
+package openai_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(t *testing.T) (agentrun.Engine, agentrun.Session) {
+		return newFakeServer(t).engine(), agentrun.Session{}
+	})
+}
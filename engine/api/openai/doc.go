@@ -0,0 +1,54 @@
+// Package openai provides an engine for OpenAI-compatible chat completions
+// APIs (OpenAI, vLLM, llama.cpp server, Ollama, and gateways that speak
+// the same protocol).
+//
+// Unlike the CLI backends, no subprocess is involved: the engine streams
+// POST {BaseURL}/chat/completions over server-sent events and keeps the
+// conversation in memory, so every Send continues the same conversation.
+//
+//	engine := openai.NewEngine(
+//	    openai.WithBaseURL("http://localhost:11434/v1"),
+//	    openai.WithModel("qwen3"),
+//	    openai.WithTools(registry),
+//	)
+//	proc, err := engine.Start(ctx, agentrun.Session{})
+//	err = agentrun.RunTurn(ctx, proc, "What time is it?", handle)
+//
+// # Tool loop
+//
+// Tools from the engine's tool.Registry are advertised on every request.
+// When the model calls tools, the calls run in-process and in parallel via
+// tool.Registry.Run — emitting MessageToolUse and MessageToolResult — and
+// the results are sent back in a follow-up request. The loop ends when the model answers without tool
+// calls, or after OptionMaxTurns requests (default WithMaxTurns, 20) with
+// StopReason "max_turns". Tool errors are reported to the model as
+// "error: <message>" and flagged with Tool.IsError on the
+// MessageToolResult.
+//
+// # Streaming
+//
+// Text streams as MessageTextDelta and reasoning (reasoning_content or
+// reasoning deltas) as MessageThinkingDelta; each request's complete
+// reasoning and text follow as MessageThinking and MessageText. Each Send
+// ends with MessageResult carrying the final text, the usage summed over
+// the turn's requests, and the finish reason as StopReason. Output() must
+// be drained concurrently with Send.
+//
+// A failed request (APIError, transport error, cancelled ctx) discards the
+// turn from the conversation and is returned by Send; API errors are also
+// emitted as MessageError with ErrorCategory and the Retry-After header as
+// RetryAfter. The process stays usable. Stop cancels any
+// in-flight request.
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - Session.Model → model (falls back to WithModel; one is required)
+//   - OptionSystemPrompt → leading system message
+//   - OptionMaxTurns → request limit per Send
+//   - OptionEffort → reasoning_effort (low, medium, high; max → high;
+//     other values fail Start)
+//
+// Session.Prompt is not sent automatically, and OptionResumeID is ignored:
+// the conversation lives only in the Process.
+package openai
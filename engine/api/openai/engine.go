@@ -0,0 +1,84 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// Engine runs sessions against an OpenAI-compatible chat completions API.
+// Each Start opens an in-memory conversation; every Send streams one
+// completion (plus one per tool round) from the API.
+type Engine struct {
+	opts EngineOptions
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine creates an OpenAI-compatible engine.
+func NewEngine(opts ...EngineOption) *Engine {
+	return &Engine{opts: resolveEngineOptions(opts...)}
+}
+
+// Validate checks that the configured base URL is well-formed. It does
+// not contact the server.
+func (e *Engine) Validate() error {
+	if _, err := newClient(e.opts); err != nil {
+		return fmt.Errorf("%w: %w", agentrun.ErrUnavailable, err)
+	}
+	return nil
+}
+
+// Start resolves the session's model and options and emits MessageInit.
+// No request is made until Send. Session.Prompt is not sent automatically.
+func (e *Engine) Start(_ context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	startOpts := agentrun.ResolveOptions(opts...)
+	session = session.Clone()
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+	if session.Model == "" {
+		session.Model = e.opts.Model
+	}
+	if session.Model == "" {
+		return nil, errors.New("openai: no model: set Session.Model or WithModel")
+	}
+
+	c, err := newClient(e.opts)
+	if err != nil {
+		return nil, err
+	}
+	maxTurns, ok, err := agentrun.ParsePositiveIntOption(session.Options, agentrun.OptionMaxTurns)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %w", err)
+	}
+	if !ok {
+		maxTurns = e.opts.MaxTurns
+	}
+	if effort := agentrun.Effort(session.Options[agentrun.OptionEffort]); effort != "" && !effort.Valid() {
+		return nil, fmt.Errorf("openai: unknown effort %q: valid: low, medium, high, max", effort)
+	}
+
+	p := newProcess(c, session, maxTurns, e.opts)
+	p.emit(agentrun.Message{
+		Type:      agentrun.MessageInit,
+		Init:      &agentrun.InitMeta{Model: session.Model, AgentName: "openai"},
+		Timestamp: time.Now(),
+	})
+	return p, nil
+}
+
+// reasoningEffort maps OptionEffort to reasoning_effort. max has no
+// equivalent and maps to "high"; Start rejects unknown values.
+func reasoningEffort(opts map[string]string) string {
+	switch e := agentrun.Effort(opts[agentrun.OptionEffort]); e {
+	case agentrun.EffortLow, agentrun.EffortMedium, agentrun.EffortHigh:
+		return string(e)
+	case agentrun.EffortMax:
+		return string(agentrun.EffortHigh)
+	}
+	return ""
+}
@@ -0,0 +1,502 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/api/openai"
+	"github.com/dmora/agentrun/engine/api/tool"
+)
+
+const testTimeout = 10 * time.Second
+
+// --- Fake server ---
+
+// fakeServer is an httptest stand-in for /v1/chat/completions. Each
+// request is recorded and answered by reply, which writes the SSE body.
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []chatRequest
+	headers  []http.Header
+
+	reply func(w http.ResponseWriter, n int, req chatRequest)
+}
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role       string `json:"role"`
+		Content    string `json:"content"`
+		ToolCallID string `json:"tool_call_id"`
+		ToolCalls  []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tools"`
+	Stream          bool   `json:"stream"`
+	ReasoningEffort string `json:"reasoning_effort"`
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	f := &fakeServer{reply: textReply("Hello!")}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", f.handle)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeServer) handle(w http.ResponseWriter, r *http.Request) {
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.headers = append(f.headers, r.Header.Clone())
+	n := len(f.requests)
+	reply := f.reply
+	f.mu.Unlock()
+	reply(w, n, req)
+}
+
+func (f *fakeServer) request(i int) chatRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[i]
+}
+
+func (f *fakeServer) requestCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+func (f *fakeServer) engine(opts ...openai.EngineOption) *openai.Engine {
+	return openai.NewEngine(append([]openai.EngineOption{
+		openai.WithBaseURL(f.URL + "/v1"),
+		openai.WithModel("test-model"),
+	}, opts...)...)
+}
+
+// writeSSE writes chunks as data events followed by [DONE].
+func writeSSE(w http.ResponseWriter, chunks ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, c := range chunks {
+		fmt.Fprintf(w, "data: %s\n\n", c)
+		w.(http.Flusher).Flush()
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// textReply streams text in two deltas, then a stop and usage chunk.
+func textReply(text string) func(http.ResponseWriter, int, chatRequest) {
+	half := len(text) / 2
+	return func(w http.ResponseWriter, _ int, _ chatRequest) {
+		writeSSE(w,
+			fmt.Sprintf(`{"choices":[{"index":0,"delta":{"role":"assistant","content":%q}}]}`, text[:half]),
+			fmt.Sprintf(`{"choices":[{"index":0,"delta":{"content":%q}}]}`, text[half:]),
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"prompt_tokens_details":{"cached_tokens":3}}}`,
+		)
+	}
+}
+
+// toolThenText requests the "add" tool on the first request of a turn
+// (no tool message yet) and answers with the tool output afterwards.
+func toolThenText(w http.ResponseWriter, _ int, req chatRequest) {
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role == "tool" {
+		writeSSE(w,
+			fmt.Sprintf(`{"choices":[{"index":0,"delta":{"content":%q},"finish_reason":"stop"}]}`, "sum is "+last.Content),
+			`{"choices":[],"usage":{"prompt_tokens":20,"completion_tokens":5}}`,
+		)
+		return
+	}
+	writeSSE(w,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"add","arguments":"{\"a\":2,"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"b\":3}"}}]}}]}`,
+		`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":15,"completion_tokens":7}}`,
+	)
+}
+
+func addRegistry(t *testing.T) *tool.Registry {
+	t.Helper()
+	r, err := tool.NewRegistry(tool.Tool{
+		Name:        "add",
+		Description: "Adds two integers.",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"a":{"type":"integer"},"b":{"type":"integer"}}}`),
+		Handler: func(_ context.Context, input json.RawMessage) (json.RawMessage, error) {
+			var in struct{ A, B int }
+			if err := json.Unmarshal(input, &in); err != nil {
+				return nil, err
+			}
+			return json.Marshal(in.A + in.B)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// --- Helpers ---
+
+func start(t *testing.T, e *openai.Engine, session agentrun.Session) agentrun.Process {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	proc, err := e.Start(ctx, session)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	init := <-proc.Output()
+	if init.Type != agentrun.MessageInit {
+		t.Fatalf("first message = %+v, want init", init)
+	}
+	return proc
+}
+
+func turn(t *testing.T, proc agentrun.Process, message string) ([]agentrun.Message, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	var msgs []agentrun.Message
+	err := agentrun.RunTurn(ctx, proc, message, func(m agentrun.Message) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	return msgs, err
+}
+
+func ofType(msgs []agentrun.Message, typ agentrun.MessageType) []agentrun.Message {
+	var out []agentrun.Message
+	for _, m := range msgs {
+		if m.Type == typ {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// --- Tests ---
+
+func TestStart_Init(t *testing.T) {
+	f := newFakeServer(t)
+	proc, err := f.engine().Start(context.Background(), agentrun.Session{Model: "m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Stop(context.Background())
+	init := <-proc.Output()
+	if init.Type != agentrun.MessageInit || init.Init == nil || init.Init.Model != "m1" {
+		t.Errorf("init = %+v", init)
+	}
+	if f.requestCount() != 0 {
+		t.Error("Start must not make requests")
+	}
+}
+
+func TestStart_Errors(t *testing.T) {
+	if _, err := openai.NewEngine().Start(context.Background(), agentrun.Session{}); err == nil {
+		t.Error("Start without model should fail")
+	}
+	e := openai.NewEngine(openai.WithModel("m"))
+	_, err := e.Start(context.Background(), agentrun.Session{Options: map[string]string{agentrun.OptionMaxTurns: "zero"}})
+	if err == nil {
+		t.Error("Start with invalid max_turns should fail")
+	}
+	_, err = e.Start(context.Background(), agentrun.Session{Options: map[string]string{agentrun.OptionEffort: "extreme"}})
+	if err == nil || !strings.Contains(err.Error(), "unknown effort") {
+		t.Errorf("Start with unknown effort = %v, want error", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := openai.NewEngine().Validate(); err != nil {
+		t.Errorf("default Validate: %v", err)
+	}
+	err := openai.NewEngine(openai.WithBaseURL("ftp://x")).Validate()
+	if !errors.Is(err, agentrun.ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestSend_StreamsText(t *testing.T) {
+	f := newFakeServer(t)
+	proc := start(t, f.engine(openai.WithAPIKey("sk-test"), openai.WithHeader("X-Route", "a")), agentrun.Session{
+		Options: map[string]string{
+			agentrun.OptionSystemPrompt: "Be brief.",
+			agentrun.OptionEffort:       "max",
+		},
+	})
+
+	msgs, err := turn(t, proc, "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var streamed strings.Builder
+	for _, m := range ofType(msgs, agentrun.MessageTextDelta) {
+		streamed.WriteString(m.Content)
+	}
+	if streamed.String() != "Hello!" {
+		t.Errorf("deltas = %q", streamed.String())
+	}
+	if text := ofType(msgs, agentrun.MessageText); len(text) != 1 || text[0].Content != "Hello!" {
+		t.Errorf("text = %+v", text)
+	}
+	result := msgs[len(msgs)-1]
+	if result.Type != agentrun.MessageResult || result.Content != "Hello!" || result.StopReason != agentrun.StopEndTurn {
+		t.Fatalf("result = %+v", result)
+	}
+	want := agentrun.Usage{InputTokens: 10, OutputTokens: 4, CacheReadTokens: 3}
+	if result.Usage == nil || *result.Usage != want {
+		t.Errorf("usage = %+v, want %+v", result.Usage, want)
+	}
+
+	req := f.request(0)
+	if req.Model != "test-model" || !req.Stream || req.ReasoningEffort != "high" {
+		t.Errorf("request = %+v", req)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[0].Content != "Be brief." {
+		t.Errorf("messages = %+v", req.Messages)
+	}
+	f.mu.Lock()
+	h := f.headers[0]
+	f.mu.Unlock()
+	if h.Get("Authorization") != "Bearer sk-test" || h.Get("X-Route") != "a" {
+		t.Errorf("headers = %v", h)
+	}
+}
+
+func TestSend_MultiTurnHistory(t *testing.T) {
+	f := newFakeServer(t)
+	proc := start(t, f.engine(), agentrun.Session{})
+	if _, err := turn(t, proc, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := turn(t, proc, "second"); err != nil {
+		t.Fatal(err)
+	}
+	msgs := f.request(1).Messages
+	var roles []string
+	for _, m := range msgs {
+		roles = append(roles, m.Role+":"+m.Content)
+	}
+	want := "user:first assistant:Hello! user:second"
+	if got := strings.Join(roles, " "); got != want {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+}
+
+func TestSend_ThinkingDeltas(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, _ int, _ chatRequest) {
+		writeSSE(w,
+			`{"choices":[{"index":0,"delta":{"reasoning_content":"Let me "}}]}`,
+			`{"choices":[{"index":0,"delta":{"reasoning":"think."}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"42"},"finish_reason":"stop"}]}`,
+		)
+	}
+	proc := start(t, f.engine(), agentrun.Session{})
+	msgs, err := turn(t, proc, "q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := ofType(msgs, agentrun.MessageThinkingDelta); len(d) != 2 {
+		t.Errorf("thinking deltas = %+v", d)
+	}
+	if th := ofType(msgs, agentrun.MessageThinking); len(th) != 1 || th[0].Content != "Let me think." {
+		t.Errorf("thinking = %+v", th)
+	}
+	if r := msgs[len(msgs)-1]; r.Content != "42" || r.Usage != nil {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestSend_ToolLoop(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = toolThenText
+	proc := start(t, f.engine(openai.WithTools(addRegistry(t))), agentrun.Session{})
+
+	msgs, err := turn(t, proc, "add 2 and 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uses := ofType(msgs, agentrun.MessageToolUse)
+	if len(uses) != 1 || uses[0].Tool.Name != "add" || string(uses[0].Tool.Input) != `{"a":2,"b":3}` {
+		t.Fatalf("tool uses = %+v", uses)
+	}
+	results := ofType(msgs, agentrun.MessageToolResult)
+	if len(results) != 1 || string(results[0].Tool.Output) != "5" || results[0].Tool.IsError {
+		t.Fatalf("tool results = %+v", results)
+	}
+	result := msgs[len(msgs)-1]
+	if result.Content != "sum is 5" || result.Usage.InputTokens != 35 || result.Usage.OutputTokens != 12 {
+		t.Errorf("result = %+v usage %+v", result, result.Usage)
+	}
+
+	first := f.request(0)
+	if len(first.Tools) != 1 || first.Tools[0].Function.Name != "add" {
+		t.Errorf("tools = %+v", first.Tools)
+	}
+	second := f.request(1).Messages
+	if len(second) != 3 || second[1].Role != "assistant" || len(second[1].ToolCalls) != 1 ||
+		second[1].ToolCalls[0].ID != "call_1" || second[2].ToolCallID != "call_1" || second[2].Content != "5" {
+		t.Errorf("follow-up messages = %+v", second)
+	}
+}
+
+func TestSend_UnknownTool(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = toolThenText
+	proc := start(t, f.engine(), agentrun.Session{}) // no tools registered
+
+	msgs, err := turn(t, proc, "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := ofType(msgs, agentrun.MessageToolResult)
+	if len(results) != 1 || !results[0].Tool.IsError || results[0].ErrorCode != "" {
+		t.Fatalf("tool results = %+v", results)
+	}
+	if !strings.Contains(f.request(1).Messages[2].Content, "unknown tool") {
+		t.Errorf("tool message = %+v", f.request(1).Messages[2])
+	}
+}
+
+func TestSend_MaxTurns(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, n int, req chatRequest) {
+		// Always call the tool, never answer.
+		req.Messages = req.Messages[:1]
+		toolThenText(w, n, req)
+	}
+	proc := start(t, f.engine(openai.WithTools(addRegistry(t))), agentrun.Session{
+		Options: map[string]string{agentrun.OptionMaxTurns: "2"},
+	})
+
+	msgs, err := turn(t, proc, "loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := msgs[len(msgs)-1]; r.Type != agentrun.MessageResult || r.StopReason != agentrun.StopMaxTurns {
+		t.Errorf("result = %+v", r)
+	}
+	if n := f.requestCount(); n != 2 {
+		t.Errorf("requests = %d, want 2", n)
+	}
+}
+
+func TestSend_APIErrorDiscardsTurn(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, n int, req chatRequest) {
+		if n == 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "3")
+			w.Header().Set("x-ratelimit-limit-tokens", "1000")
+			w.Header().Set("x-ratelimit-remaining-tokens", "0")
+			w.Header().Set("x-ratelimit-reset-tokens", "3s")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`)
+			return
+		}
+		textReply("ok")(w, n, req)
+	}
+	proc := start(t, f.engine(), agentrun.Session{})
+
+	msgs, err := turn(t, proc, "lost")
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Code != "rate_limit_exceeded" {
+		t.Fatalf("err = %v, want 429 APIError", err)
+	}
+	if e := ofType(msgs, agentrun.MessageError); len(e) != 1 || e[0].ErrorCode != "rate_limit_exceeded" ||
+		e[0].ErrorCategory != agentrun.CategoryRateLimited || e[0].RetryAfter != 3*time.Second {
+		t.Errorf("errors = %+v", e)
+	}
+	if rl := agentrun.RateLimitOf(err); rl == nil || rl.Type != "tokens" || !rl.Exceeded || rl.Utilization != 1 ||
+		time.Until(rl.ResetsAt) > 3*time.Second {
+		t.Errorf("RateLimitOf = %+v", rl)
+	}
+
+	if _, err := turn(t, proc, "kept"); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := f.request(1).Messages; len(msgs) != 1 || msgs[0].Content != "kept" {
+		t.Errorf("history after failure = %+v", msgs)
+	}
+}
+
+func TestSend_StreamError(t *testing.T) {
+	f := newFakeServer(t)
+	f.reply = func(w http.ResponseWriter, _ int, _ chatRequest) {
+		writeSSE(w, `{"choices":[{"index":0,"delta":{"content":"par"}}]}`, `{"error":{"message":"overloaded","code":503}}`)
+	}
+	proc := start(t, f.engine(), agentrun.Session{})
+	_, err := turn(t, proc, "x")
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 0 || apiErr.Code != "503" {
+		t.Errorf("err = %v, want stream APIError", err)
+	}
+}
+
+func TestStop_CancelsInFlight(t *testing.T) {
+	f := newFakeServer(t)
+	started := make(chan struct{})
+	// Block until the client goes away.
+	f.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"index":0,"delta":{"content":"..."}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+	})
+	proc := start(t, f.engine(), agentrun.Session{})
+
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- proc.Send(context.Background(), "long") }()
+	go func() {
+		for range proc.Output() { //nolint:revive // drain
+		}
+	}()
+	<-started
+	if err := proc.Stop(context.Background()); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+	select {
+	case err := <-sendErr:
+		if !errors.Is(err, agentrun.ErrTerminated) {
+			t.Errorf("Send = %v, want ErrTerminated", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Send did not return after Stop")
+	}
+	if err := proc.Send(context.Background(), "again"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send after Stop = %v, want ErrTerminated", err)
+	}
+}
@@ -0,0 +1,150 @@
+package openai
+
+import (
+	"net/http"
+
+	"github.com/dmora/agentrun/engine/api/tool"
+)
+
+// Default engine configuration values.
+const (
+	defaultBaseURL      = "https://api.openai.com/v1"
+	defaultOutputBuffer = 4096
+	defaultMaxTurns     = 20
+	defaultMaxEventSize = 4 << 20 // 4 MB — max SSE line size
+)
+
+// EngineOptions holds resolved construction-time configuration for an
+// OpenAI-compatible engine.
+type EngineOptions struct {
+	// BaseURL is the API root that /chat/completions is appended to, e.g.
+	// "http://localhost:11434/v1" for Ollama or "http://localhost:8000/v1"
+	// for vLLM.
+	BaseURL string
+
+	// APIKey is sent as a Bearer token. Empty sends no Authorization
+	// header (local servers typically need none).
+	APIKey string
+
+	// Model is used when neither Session.Model nor agentrun.WithModel is set.
+	Model string
+
+	// Headers are added to every request (e.g. organization or routing
+	// headers required by a gateway).
+	Headers http.Header
+
+	// HTTPClient is used for all API requests. nil uses http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Tools are offered to the model on every request. nil offers none.
+	Tools *tool.Registry
+
+	// MaxTurns bounds the model requests per Send (one per tool round) when
+	// agentrun.OptionMaxTurns is not set.
+	MaxTurns int
+
+	// OutputBuffer is the channel buffer size for process output messages.
+	OutputBuffer int
+
+	// MaxEventSize is the maximum SSE line size in bytes.
+	MaxEventSize int
+}
+
+// EngineOption configures an Engine at construction time.
+type EngineOption func(*EngineOptions)
+
+// WithBaseURL sets the API root (default "https://api.openai.com/v1").
+func WithBaseURL(u string) EngineOption {
+	return func(o *EngineOptions) {
+		if u != "" {
+			o.BaseURL = u
+		}
+	}
+}
+
+// WithAPIKey sets the Bearer token sent with every request.
+func WithAPIKey(key string) EngineOption {
+	return func(o *EngineOptions) {
+		o.APIKey = key
+	}
+}
+
+// WithModel sets the default model for sessions that do not name one.
+func WithModel(model string) EngineOption {
+	return func(o *EngineOptions) {
+		o.Model = model
+	}
+}
+
+// WithHeader adds a header to every request.
+func WithHeader(key, value string) EngineOption {
+	return func(o *EngineOptions) {
+		if o.Headers == nil {
+			o.Headers = make(http.Header)
+		}
+		o.Headers.Add(key, value)
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for API requests. The client
+// should not set a short Timeout: responses stream for the whole
+// generation.
+func WithHTTPClient(c *http.Client) EngineOption {
+	return func(o *EngineOptions) {
+		o.HTTPClient = c
+	}
+}
+
+// WithTools sets the tools offered to the model. Tool calls are executed
+// in-process and their results sent back until the model stops calling
+// tools or MaxTurns is reached.
+func WithTools(r *tool.Registry) EngineOption {
+	return func(o *EngineOptions) {
+		o.Tools = r
+	}
+}
+
+// WithMaxTurns sets the default bound on model requests per Send.
+// Values <= 0 are ignored.
+func WithMaxTurns(n int) EngineOption {
+	return func(o *EngineOptions) {
+		if n > 0 {
+			o.MaxTurns = n
+		}
+	}
+}
+
+// WithOutputBuffer sets the channel buffer size for process output messages.
+// Values <= 0 are ignored.
+func WithOutputBuffer(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.OutputBuffer = size
+		}
+	}
+}
+
+// WithMaxEventSize sets the maximum SSE line size in bytes.
+// Values <= 0 are ignored.
+func WithMaxEventSize(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.MaxEventSize = size
+		}
+	}
+}
+
+func resolveEngineOptions(opts ...EngineOption) EngineOptions {
+	o := EngineOptions{
+		BaseURL:      defaultBaseURL,
+		MaxTurns:     defaultMaxTurns,
+		OutputBuffer: defaultOutputBuffer,
+		MaxEventSize: defaultMaxEventSize,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
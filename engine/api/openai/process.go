@@ -0,0 +1,412 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/api/tool"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/stoputil"
+)
+
+// process implements agentrun.Process for one in-memory conversation.
+type process struct {
+	client   *client
+	opts     EngineOptions
+	model    string
+	effort   string
+	maxTurns int
+	tools    []toolSpec
+
+	turnMu  sync.Mutex    // serializes turns; guards history
+	history []chatMessage // conversation so far, system prompt first
+
+	output       chan agentrun.Message
+	outputMu     sync.Mutex // guards output channel close
+	outputClosed bool
+	done         chan struct{}
+
+	termErr    error
+	stopping   atomic.Bool
+	stopOnce   sync.Once
+	finishOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var _ agentrun.Process = (*process)(nil)
+
+func newProcess(c *client, session agentrun.Session, maxTurns int, opts EngineOptions) *process {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &process{
+		client:   c,
+		opts:     opts,
+		model:    session.Model,
+		effort:   reasoningEffort(session.Options),
+		maxTurns: maxTurns,
+		tools:    toolSpecs(opts.Tools),
+		output:   make(chan agentrun.Message, opts.OutputBuffer),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	if sp := session.Options[agentrun.OptionSystemPrompt]; sp != "" {
+		p.history = append(p.history, chatMessage{Role: "system", Content: sp})
+	}
+	return p
+}
+
+// toolSpecs converts the registry into the request's tools array.
+func toolSpecs(r *tool.Registry) []toolSpec {
+	var specs []toolSpec
+	for _, t := range r.Tools() {
+		specs = append(specs, toolSpec{
+			Type: "function",
+			Function: functionSpec{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  t.Schema(),
+			},
+		})
+	}
+	return specs
+}
+
+// Output returns the channel for receiving messages from the agent.
+func (p *process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send appends message to the conversation and runs the turn: it streams
+// completions, executing requested tools between them, until the model
+// answers without tool calls or the turn limit is reached, then emits
+// MessageResult. Blocks until the turn ends; the caller must drain Output()
+// concurrently.
+//
+// On failure (API error, ctx expiry) the turn is discarded from the
+// conversation, MessageError is emitted for API errors, and the error is
+// returned. The process stays usable.
+func (p *process) Send(ctx context.Context, message string) error {
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+	p.turnMu.Lock()
+	defer p.turnMu.Unlock()
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+
+	// Stop cancels the in-flight request.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(p.ctx, cancel)()
+
+	mark := len(p.history)
+	p.history = append(p.history, chatMessage{Role: "user", Content: message})
+	if err := p.runTurn(ctx); err != nil {
+		p.history = p.history[:mark]
+		if p.stopping.Load() {
+			return agentrun.ErrTerminated
+		}
+		if ctx.Err() == nil {
+			p.emitError(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// runTurn runs completion rounds until the model stops calling tools or
+// maxTurns requests have been made, then emits MessageResult.
+func (p *process) runTurn(ctx context.Context) error {
+	var total agentrun.Usage
+	for n := 1; ; n++ {
+		r, err := p.complete(ctx)
+		if err != nil {
+			return err
+		}
+		addUsage(&total, r.usage)
+		p.history = append(p.history, r.assistantMessage())
+		p.emitRound(r)
+
+		if len(r.calls) == 0 {
+			p.emitResult(r.text.String(), finishStopReason(r.finish), &total)
+			return nil
+		}
+		if err := p.runTools(ctx, r.calls); err != nil {
+			return err
+		}
+		if n >= p.maxTurns {
+			p.emitResult(r.text.String(), agentrun.StopMaxTurns, &total)
+			return nil
+		}
+	}
+}
+
+// complete streams one completion of the current history, emitting text
+// and reasoning deltas as they arrive.
+func (p *process) complete(ctx context.Context) (*round, error) {
+	req := &chatRequest{
+		Model:           p.model,
+		Messages:        p.history,
+		Tools:           p.tools,
+		Stream:          true,
+		StreamOptions:   &streamOptions{IncludeUsage: true},
+		ReasoningEffort: p.effort,
+	}
+	r := &round{}
+	err := p.client.stream(ctx, req, func(ch *chunk) {
+		text, thinking := r.add(ch)
+		if thinking != "" {
+			p.emit(agentrun.Message{Type: agentrun.MessageThinkingDelta, Content: thinking})
+		}
+		if text != "" {
+			p.emit(agentrun.Message{Type: agentrun.MessageTextDelta, Content: text})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// emitRound emits the round's complete reasoning and text.
+func (p *process) emitRound(r *round) {
+	if r.thinking.Len() > 0 {
+		p.emit(agentrun.Message{Type: agentrun.MessageThinking, Content: r.thinking.String()})
+	}
+	if r.text.Len() > 0 {
+		p.emit(agentrun.Message{Type: agentrun.MessageText, Content: r.text.String()})
+	}
+}
+
+// runTools executes the round's tool calls in parallel (emitting
+// MessageToolUse and MessageToolResult) and appends the results to the
+// conversation in call order. Tool failures are reported to the model, not
+// returned; only ctx expiry aborts the turn.
+func (p *process) runTools(ctx context.Context, calls []toolCall) error {
+	toolCalls := make([]tool.Call, len(calls))
+	for i, c := range calls {
+		toolCalls[i] = tool.Call{ID: c.ID, Name: c.Function.Name, Input: toolInput(c.Function.Arguments)}
+	}
+	results, err := p.opts.Tools.Run(ctx, toolCalls, p.emit)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		p.history = append(p.history, chatMessage{Role: "tool", ToolCallID: res.Call.ID, Content: res.Text()})
+	}
+	return nil
+}
+
+// emitResult emits the turn's MessageResult.
+func (p *process) emitResult(text string, stop agentrun.StopReason, total *agentrun.Usage) {
+	msg := agentrun.Message{Type: agentrun.MessageResult, Content: text, StopReason: stop}
+	if *total != (agentrun.Usage{}) {
+		u := *total
+		msg.Usage = &u
+	}
+	p.emit(msg)
+}
+
+// emitError emits MessageError for a failed turn.
+func (p *process) emitError(err error) {
+	msg := agentrun.Message{Type: agentrun.MessageError, Content: errfmt.Truncate(err.Error())}
+	msg.ErrorCategory = agentrun.ErrorCategoryOf(err)
+	msg.RetryAfter = agentrun.RetryAfterOf(err)
+	msg.RateLimit = agentrun.RateLimitOf(err)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		msg.ErrorCode = errfmt.SanitizeCode(apiErr.Code)
+		if msg.ErrorCode == "" {
+			msg.ErrorCode = errfmt.SanitizeCode(apiErr.Type)
+		}
+	}
+	errcat.Apply(&msg)
+	p.emit(msg)
+}
+
+// --- round ---
+
+// round accumulates one streamed completion.
+type round struct {
+	text     strings.Builder
+	thinking strings.Builder
+	calls    []toolCall // by stream index
+	finish   string
+	usage    *usage
+}
+
+// add folds a chunk into the round and returns its text and reasoning
+// fragments. Only the first choice is used.
+func (r *round) add(ch *chunk) (text, thinking string) {
+	if ch.Usage != nil {
+		r.usage = ch.Usage
+	}
+	for _, c := range ch.Choices {
+		if c.Index != 0 {
+			continue
+		}
+		if c.FinishReason != "" {
+			r.finish = c.FinishReason
+		}
+		text = c.Delta.Content
+		thinking = c.Delta.ReasoningContent + c.Delta.Reasoning
+		r.text.WriteString(text)
+		r.thinking.WriteString(thinking)
+		for _, d := range c.Delta.ToolCalls {
+			r.addToolCall(d)
+		}
+	}
+	return text, thinking
+}
+
+// addToolCall merges a tool call fragment. The first fragment of a call
+// carries its ID and name; later ones append argument text.
+func (r *round) addToolCall(d toolCallDelta) {
+	if d.Index < 0 || d.Index > len(r.calls) {
+		return // out-of-order index; not produced by conforming servers
+	}
+	if d.Index == len(r.calls) {
+		r.calls = append(r.calls, toolCall{Type: "function"})
+	}
+	c := &r.calls[d.Index]
+	if d.ID != "" {
+		c.ID = d.ID
+	}
+	c.Function.Name += d.Function.Name
+	c.Function.Arguments += d.Function.Arguments
+}
+
+// assistantMessage returns the round as a conversation message.
+func (r *round) assistantMessage() chatMessage {
+	return chatMessage{Role: "assistant", Content: r.text.String(), ToolCalls: r.calls}
+}
+
+// --- helpers ---
+
+// toolInput returns call arguments as raw JSON, or as a JSON string when
+// the model produced invalid JSON. Empty arguments become "{}".
+func toolInput(args string) json.RawMessage {
+	if strings.TrimSpace(args) == "" {
+		return json.RawMessage(`{}`)
+	}
+	if json.Valid([]byte(args)) {
+		return json.RawMessage(args)
+	}
+	data, _ := json.Marshal(args)
+	return data
+}
+
+// finishStopReason maps finish_reason to a StopReason.
+func finishStopReason(reason string) agentrun.StopReason {
+	switch reason {
+	case "stop", "":
+		return agentrun.StopEndTurn
+	case "length":
+		return agentrun.StopMaxTokens
+	case "tool_calls", "function_call":
+		return agentrun.StopToolUse
+	}
+	return stoputil.Sanitize(reason)
+}
+
+// addUsage adds a round's usage to total.
+func addUsage(total *agentrun.Usage, u *usage) {
+	if u == nil {
+		return
+	}
+	total.InputTokens += u.PromptTokens
+	total.OutputTokens += u.CompletionTokens
+	if u.PromptTokensDetails != nil {
+		total.CacheReadTokens += u.PromptTokensDetails.CachedTokens
+	}
+	if u.CompletionTokensDetails != nil {
+		total.ThinkingTokens += u.CompletionTokensDetails.ReasoningTokens
+	}
+}
+
+// --- Lifecycle ---
+
+// Stop cancels any in-flight request and ends the process.
+// Safe to call multiple times.
+func (p *process) Stop(context.Context) error {
+	p.stopOnce.Do(func() {
+		p.stopping.Store(true)
+		p.cancel()
+		p.finish(agentrun.ErrTerminated)
+	})
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends.
+func (p *process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// terminated reports whether the process is stopping or has ended.
+func (p *process) terminated() bool {
+	if p.stopping.Load() {
+		return true
+	}
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// emit sends a message to the output channel. Blocks until delivered,
+// context is cancelled, or the channel is marked closed by finish().
+func (p *process) emit(msg agentrun.Message) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+	if p.outputClosed {
+		return
+	}
+	select {
+	case p.output <- msg:
+	case <-p.ctx.Done():
+	}
+}
+
+// finish sets the terminal error and closes done+output channels.
+// done closes before output so Err() is valid once a consumer's range
+// over Output() exits.
+func (p *process) finish(err error) {
+	p.finishOnce.Do(func() {
+		p.termErr = err
+		p.cancel()
+
+		close(p.done)
+
+		p.outputMu.Lock()
+		p.outputClosed = true
+		close(p.output)
+		p.outputMu.Unlock()
+	})
+}
@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestRound_ToolCallFragments(t *testing.T) {
+	r := &round{}
+	chunks := []chunk{
+		{Choices: []choice{{Delta: delta{ToolCalls: []toolCallDelta{tcd(0, "call_1", "get_", `{"ci`)}}}}},
+		{Choices: []choice{{Delta: delta{ToolCalls: []toolCallDelta{tcd(0, "", "weather", `ty":"Oslo"}`)}}}}},
+		{Choices: []choice{{Delta: delta{ToolCalls: []toolCallDelta{tcd(1, "call_2", "now", "")}}}}},
+		{Choices: []choice{{Delta: delta{ToolCalls: []toolCallDelta{tcd(5, "bad", "skip", "")}}, FinishReason: "tool_calls"}}},
+	}
+	for i := range chunks {
+		r.add(&chunks[i])
+	}
+	if len(r.calls) != 2 {
+		t.Fatalf("calls = %+v, want 2", r.calls)
+	}
+	if c := r.calls[0]; c.ID != "call_1" || c.Function.Name != "get_weather" || c.Function.Arguments != `{"city":"Oslo"}` {
+		t.Errorf("call 0 = %+v", c)
+	}
+	if c := r.calls[1]; c.ID != "call_2" || c.Function.Name != "now" {
+		t.Errorf("call 1 = %+v", c)
+	}
+	if r.finish != "tool_calls" {
+		t.Errorf("finish = %q", r.finish)
+	}
+}
+
+func TestRound_TextAndReasoning(t *testing.T) {
+	r := &round{}
+	text, thinking := r.add(&chunk{Choices: []choice{{Delta: delta{ReasoningContent: "hm"}}}})
+	if text != "" || thinking != "hm" {
+		t.Errorf("got (%q, %q)", text, thinking)
+	}
+	text, _ = r.add(&chunk{Choices: []choice{{Delta: delta{Content: "Hi"}}, {Index: 1, Delta: delta{Content: "ignored"}}}})
+	if text != "Hi" || r.text.String() != "Hi" || r.thinking.String() != "hm" {
+		t.Errorf("text = %q, round = (%q, %q)", text, r.text.String(), r.thinking.String())
+	}
+}
+
+func TestFinishStopReason(t *testing.T) {
+	tests := map[string]agentrun.StopReason{
+		"":               agentrun.StopEndTurn,
+		"stop":           agentrun.StopEndTurn,
+		"length":         agentrun.StopMaxTokens,
+		"tool_calls":     agentrun.StopToolUse,
+		"content_filter": "content_filter",
+	}
+	for in, want := range tests {
+		if got := finishStopReason(in); got != want {
+			t.Errorf("finishStopReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestToolInput(t *testing.T) {
+	tests := map[string]string{
+		"":        `{}`,
+		`{"a":1}`: `{"a":1}`,
+		`{"a":1`:  `"{\"a\":1"`,
+		"  \n":    `{}`,
+	}
+	for in, want := range tests {
+		if got := string(toolInput(in)); got != want {
+			t.Errorf("toolInput(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestReasoningEffort(t *testing.T) {
+	tests := map[string]string{"": "", "low": "low", "medium": "medium", "high": "high", "max": "high", "extreme": ""}
+	for in, want := range tests {
+		if got := reasoningEffort(map[string]string{agentrun.OptionEffort: in}); got != want {
+			t.Errorf("reasoningEffort(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func tcd(index int, id, name, args string) toolCallDelta {
+	d := toolCallDelta{Index: index, ID: id}
+	d.Function.Name = name
+	d.Function.Arguments = args
+	return d
+}
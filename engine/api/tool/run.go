@@ -0,0 +1,93 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// Call is one tool call requested by the model.
+type Call struct {
+	ID    string          // provider call ID, echoed back with the result
+	Name  string          // tool name
+	Input json.RawMessage // JSON arguments
+}
+
+// Result is the outcome of a Call.
+type Result struct {
+	Call   Call
+	Output json.RawMessage // handler output; nil on error
+	Err    error           // handler, lookup or timeout error
+}
+
+// Text renders the result as the text sent back to the model (see
+// ResultText).
+func (r Result) Text() string {
+	return ResultText(r.Output, r.Err)
+}
+
+// Run executes calls in parallel, each bounded by its tool's Timeout, and
+// returns their results in call order.
+//
+// If emit is non-nil, Run emits MessageToolUse for every call, in call
+// order, before any handler starts, then MessageToolResult for each call as
+// it completes. A failed call's result carries the error text as a JSON
+// string Output, with Tool.IsError set. emit is never called
+// concurrently.
+//
+// Tool failures are reported in Result.Err, not returned. Run returns
+// ctx.Err() if ctx is done once all calls have returned; results are then
+// incomplete and no MessageToolResult is emitted for the cancelled calls.
+func (r *Registry) Run(ctx context.Context, calls []Call, emit func(agentrun.Message)) ([]Result, error) {
+	var emitMu sync.Mutex
+	send := func(msg agentrun.Message) {
+		if emit == nil {
+			return
+		}
+		emitMu.Lock()
+		defer emitMu.Unlock()
+		emit(msg)
+	}
+
+	for _, c := range calls {
+		send(agentrun.Message{
+			Type: agentrun.MessageToolUse,
+			Tool: &agentrun.ToolCall{Name: c.Name, Input: c.Input},
+		})
+	}
+
+	results := make([]Result, len(calls))
+	var wg sync.WaitGroup
+	for i, c := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := r.Call(ctx, c.Name, c.Input)
+			results[i] = Result{Call: c, Output: out, Err: err}
+			if ctx.Err() == nil {
+				send(resultMessage(results[i]))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// resultMessage returns the MessageToolResult for res.
+func resultMessage(res Result) agentrun.Message {
+	msg := agentrun.Message{
+		Type: agentrun.MessageToolResult,
+		Tool: &agentrun.ToolCall{Name: res.Call.Name, Input: res.Call.Input, Output: res.Output},
+	}
+	if res.Err != nil {
+		msg.Tool.Output, _ = json.Marshal(res.Text())
+		msg.Tool.IsError = true
+	}
+	return msg
+}
@@ -0,0 +1,122 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// barrierTool blocks until n calls are in flight, proving parallelism.
+func barrierTool(name string, n int) Tool {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	return Tool{
+		Name: name,
+		Handler: func(ctx context.Context, input json.RawMessage) (json.RawMessage, error) {
+			wg.Done()
+			wg.Wait()
+			return input, nil
+		},
+	}
+}
+
+func TestRun_ParallelOrderedResults(t *testing.T) {
+	fail := Tool{
+		Name: "fail",
+		Handler: func(context.Context, json.RawMessage) (json.RawMessage, error) {
+			return nil, errors.New("nope")
+		},
+	}
+	r, _ := NewRegistry(barrierTool("wait", 2), fail)
+	calls := []Call{
+		{ID: "1", Name: "wait", Input: json.RawMessage(`1`)},
+		{ID: "2", Name: "fail", Input: json.RawMessage(`{}`)},
+		{ID: "3", Name: "wait", Input: json.RawMessage(`3`)},
+	}
+
+	var msgs []agentrun.Message
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := r.Run(ctx, calls, func(m agentrun.Message) { msgs = append(msgs, m) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, res := range results {
+		if res.Call.ID != calls[i].ID {
+			t.Errorf("result %d is for call %s", i, res.Call.ID)
+		}
+	}
+	if string(results[0].Output) != "1" || string(results[2].Output) != "3" {
+		t.Errorf("outputs = %s, %s", results[0].Output, results[2].Output)
+	}
+	if results[1].Err == nil || results[1].Text() != "error: nope" {
+		t.Errorf("fail result = %+v", results[1])
+	}
+
+	if len(msgs) != 6 {
+		t.Fatalf("messages = %+v", msgs)
+	}
+	for i := range 3 {
+		if msgs[i].Type != agentrun.MessageToolUse || msgs[i].Tool.Name != calls[i].Name {
+			t.Errorf("message %d = %+v, want tool use of %s", i, msgs[i], calls[i].Name)
+		}
+	}
+	var failed int
+	for _, m := range msgs[3:] {
+		if m.Type != agentrun.MessageToolResult {
+			t.Errorf("message = %+v, want tool result", m)
+		}
+		if m.ErrorCode != "" {
+			t.Errorf("tool result ErrorCode = %q, want unset", m.ErrorCode)
+		}
+		if m.Tool.IsError {
+			failed++
+			if string(m.Tool.Output) != `"error: nope"` {
+				t.Errorf("failed output = %s", m.Tool.Output)
+			}
+		}
+	}
+	if failed != 1 {
+		t.Errorf("failed results = %d, want 1", failed)
+	}
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	r, _ := NewRegistry(Tool{
+		Name: "block",
+		Handler: func(ctx context.Context, _ json.RawMessage) (json.RawMessage, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	var msgs []agentrun.Message
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := r.Run(ctx, []Call{{Name: "block"}}, func(m agentrun.Message) { msgs = append(msgs, m) })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(msgs) != 1 || msgs[0].Type != agentrun.MessageToolUse {
+		t.Errorf("messages = %+v, want only tool use", msgs)
+	}
+}
+
+func TestRun_NilEmit(t *testing.T) {
+	r, _ := NewRegistry(echoTool("echo"))
+	results, err := r.Run(context.Background(), []Call{{Name: "echo", Input: json.RawMessage(`"hi"`)}}, nil)
+	if err != nil || len(results) != 1 || results[0].Text() != "hi" {
+		t.Errorf("results = %+v, err = %v", results, err)
+	}
+}
@@ -0,0 +1,208 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Func builds a Tool from a typed Go function. The input schema is
+// generated from In with SchemaFor; the model's arguments are decoded into
+// In (absent arguments decode to the zero value) and the returned Out is
+// encoded as the tool result.
+//
+//	type weatherInput struct {
+//	    City  string `json:"city" description:"City name, e.g. Paris"`
+//	    Units string `json:"units,omitempty" description:"metric or imperial"`
+//	}
+//	weather, err := tool.Func("get_weather", "Returns the current weather.",
+//	    func(ctx context.Context, in weatherInput) (string, error) { ... })
+func Func[In, Out any](name, description string, fn func(context.Context, In) (Out, error)) (Tool, error) {
+	schema, err := SchemaFor[In]()
+	if err != nil {
+		return Tool{}, fmt.Errorf("tool: %s: %w", name, err)
+	}
+	t := Tool{
+		Name:        name,
+		Description: description,
+		InputSchema: schema,
+		Handler: func(ctx context.Context, input json.RawMessage) (json.RawMessage, error) {
+			var in In
+			if len(input) > 0 && string(input) != "null" {
+				if err := json.Unmarshal(input, &in); err != nil {
+					return nil, fmt.Errorf("invalid input: %w", err)
+				}
+			}
+			out, err := fn(ctx, in)
+			if err != nil {
+				return nil, err
+			}
+			return json.Marshal(out)
+		},
+	}
+	if err := t.validate(); err != nil {
+		return Tool{}, err
+	}
+	return t, nil
+}
+
+// SchemaFor returns the JSON Schema of T, which must be a struct (or
+// pointer to one) since tool inputs are JSON objects.
+//
+// Properties follow encoding/json naming: exported fields, json tag names,
+// "-" skipped, embedded structs flattened. A field is required unless it is
+// a pointer or tagged omitempty/omitzero. The description tag documents a
+// property. Recursive types are rejected.
+func SchemaFor[T any]() (json.RawMessage, error) {
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: input type %s is not a struct", t)
+	}
+	s, err := (&schemaGen{seen: map[reflect.Type]bool{}}).schema(t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+// schemaGen walks a type, tracking structs on the current path to detect
+// recursion.
+type schemaGen struct {
+	seen map[reflect.Type]bool
+}
+
+func (g *schemaGen) schema(t reflect.Type) (map[string]any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}, nil
+	case rawType:
+		return map[string]any{}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Interface:
+		return map[string]any{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as base64.
+			return map[string]any{"type": "string", "contentEncoding": "base64"}, nil
+		}
+		items, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("schema: map key type %s is not a string", t.Key())
+		}
+		values, err := g.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		return g.object(t)
+	}
+	return nil, fmt.Errorf("schema: unsupported type %s", t)
+}
+
+// object returns the schema of a struct type.
+func (g *schemaGen) object(t reflect.Type) (map[string]any, error) {
+	if g.seen[t] {
+		return nil, fmt.Errorf("schema: recursive type %s", t)
+	}
+	g.seen[t] = true
+	defer delete(g.seen, t)
+
+	props := map[string]any{}
+	required := []string{}
+	if err := g.fields(t, props, &required); err != nil {
+		return nil, err
+	}
+	s := map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s, nil
+}
+
+// fields adds t's fields to props, flattening embedded structs.
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) error {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := g.fields(ft, props, required); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s, err := g.schema(f.Type)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+		}
+		if d := f.Tag.Get("description"); d != "" {
+			s["description"] = d
+		}
+		props[name] = s
+		if f.Type.Kind() != reflect.Pointer && !hasOption(opts, "omitempty") && !hasOption(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+	return nil
+}
+
+func hasOption(opts, want string) bool {
+	for opts != "" {
+		var o string
+		o, opts, _ = strings.Cut(opts, ",")
+		if o == want {
+			return true
+		}
+	}
+	return false
+}
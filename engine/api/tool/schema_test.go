@@ -0,0 +1,113 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaBase struct {
+	ID string `json:"id" description:"Record ID"`
+}
+
+type schemaInput struct {
+	schemaBase
+	Name     string            `json:"name"`
+	Count    int               `json:"count,omitempty"`
+	Ratio    *float64          `json:"ratio"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]bool   `json:"labels,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	When     time.Time         `json:"when,omitzero"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Nested   struct{ On bool } `json:"nested"`
+	Default  string
+	Skipped  string `json:"-"`
+	internal string
+}
+
+func TestSchemaFor(t *testing.T) {
+	data, err := SchemaFor[schemaInput]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"additionalProperties":false,"properties":{` +
+		`"Default":{"type":"string"},` +
+		`"count":{"type":"integer"},` +
+		`"data":{"contentEncoding":"base64","type":"string"},` +
+		`"id":{"description":"Record ID","type":"string"},` +
+		`"labels":{"additionalProperties":{"type":"boolean"},"type":"object"},` +
+		`"name":{"type":"string"},` +
+		`"nested":{"additionalProperties":false,"properties":{"On":{"type":"boolean"}},"required":["On"],"type":"object"},` +
+		`"ratio":{"type":"number"},` +
+		`"raw":{},` +
+		`"tags":{"items":{"type":"string"},"type":"array"},` +
+		`"when":{"format":"date-time","type":"string"}},` +
+		`"required":["id","name","nested","Default"],"type":"object"}`
+	if string(data) != want {
+		t.Errorf("SchemaFor =\n%s\nwant\n%s", data, want)
+	}
+}
+
+type recursive struct {
+	Children []recursive `json:"children"`
+}
+
+func TestSchemaFor_Errors(t *testing.T) {
+	if _, err := SchemaFor[string](); err == nil || !strings.Contains(err.Error(), "not a struct") {
+		t.Errorf("string err = %v", err)
+	}
+	if _, err := SchemaFor[recursive](); err == nil || !strings.Contains(err.Error(), "recursive") {
+		t.Errorf("recursive err = %v", err)
+	}
+	if _, err := SchemaFor[struct{ M map[int]string }](); err == nil || !strings.Contains(err.Error(), "map key") {
+		t.Errorf("map err = %v", err)
+	}
+	if _, err := SchemaFor[struct{ C chan int }](); err == nil || !strings.Contains(err.Error(), "unsupported") {
+		t.Errorf("chan err = %v", err)
+	}
+}
+
+func TestFunc(t *testing.T) {
+	type in struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	add, err := Func("add", "Adds.", func(_ context.Context, in in) (int, error) {
+		if in.A < 0 {
+			return 0, errors.New("negative")
+		}
+		return in.A + in.B, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(add.Schema()), `"required":["a","b"]`) {
+		t.Errorf("schema = %s", add.Schema())
+	}
+	r, _ := NewRegistry(add)
+	ctx := context.Background()
+
+	if out, err := r.Call(ctx, "add", json.RawMessage(`{"a":2,"b":3}`)); err != nil || string(out) != "5" {
+		t.Errorf("add = %s, %v", out, err)
+	}
+	if out, err := r.Call(ctx, "add", nil); err != nil || string(out) != "0" {
+		t.Errorf("add(nil) = %s, %v", out, err)
+	}
+	if _, err := r.Call(ctx, "add", json.RawMessage(`{"a":"x"}`)); err == nil || !strings.Contains(err.Error(), "invalid input") {
+		t.Errorf("bad input err = %v", err)
+	}
+	if _, err := r.Call(ctx, "add", json.RawMessage(`{"a":-1}`)); err == nil || err.Error() != "negative" {
+		t.Errorf("handler err = %v", err)
+	}
+
+	if _, err := Func("bad name", "", func(context.Context, in) (int, error) { return 0, nil }); err == nil {
+		t.Error("Func with invalid name should fail")
+	}
+	if _, err := Func("s", "", func(context.Context, string) (int, error) { return 0, nil }); err == nil {
+		t.Error("Func with non-struct input should fail")
+	}
+}
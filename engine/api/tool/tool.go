@@ -0,0 +1,237 @@
+// Package tool defines Go-function tools for API engines that run their
+// own agent loop.
+//
+// A Tool pairs a name, description and JSON Schema with a Go handler. A
+// Registry holds the tools offered to the model; engines advertise
+// Registry.Tools to the API and execute the model's tool calls with
+// Registry.Run, which runs them in parallel under per-tool timeouts and
+// emits MessageToolUse and MessageToolResult.
+//
+// Func builds a Tool from a typed function, generating the input schema
+// from the input struct:
+//
+//	type timeInput struct {
+//	    Zone string `json:"zone,omitempty" description:"IANA time zone; default UTC"`
+//	}
+//	getTime, err := tool.Func("get_time", "Returns the current time.",
+//	    func(ctx context.Context, in timeInput) (string, error) {
+//	        loc, err := time.LoadLocation(in.Zone)
+//	        if err != nil {
+//	            return "", err
+//	        }
+//	        return time.Now().In(loc).Format(time.RFC3339), nil
+//	    })
+//	getTime.Timeout = 5 * time.Second
+//	reg, err := tool.NewRegistry(getTime)
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ErrUnknownTool is returned by Registry.Call for names not in the registry.
+var ErrUnknownTool = errors.New("tool: unknown tool")
+
+// validName matches tool names accepted by the OpenAI and Anthropic APIs.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// emptySchema is the input schema used when a Tool has none.
+var emptySchema = json.RawMessage(`{"type":"object","properties":{}}`)
+
+// Handler executes a tool call. input is the model's JSON arguments; the
+// returned JSON is sent back to the model as the tool result. A returned
+// error is reported to the model as a failed call rather than ending the
+// turn.
+type Handler func(ctx context.Context, input json.RawMessage) (json.RawMessage, error)
+
+// Tool is a function the model may call.
+type Tool struct {
+	// Name identifies the tool to the model. Must match ^[a-zA-Z0-9_-]{1,64}$.
+	Name string
+
+	// Description tells the model what the tool does and when to use it.
+	Description string
+
+	// InputSchema is the JSON Schema of the tool's input object.
+	// nil means the tool takes no arguments.
+	InputSchema json.RawMessage
+
+	// Handler executes the tool. Required.
+	Handler Handler
+
+	// Timeout bounds one call. Zero means no limit beyond the caller's ctx.
+	Timeout time.Duration
+}
+
+// Schema returns the tool's input schema, defaulting to an empty object.
+func (t Tool) Schema() json.RawMessage {
+	if len(t.InputSchema) == 0 {
+		return emptySchema
+	}
+	return t.InputSchema
+}
+
+// validate checks the tool's name, handler and schema.
+func (t Tool) validate() error {
+	if !validName.MatchString(t.Name) {
+		return fmt.Errorf("tool: invalid name %q", t.Name)
+	}
+	if t.Timeout < 0 {
+		return fmt.Errorf("tool: %s: negative timeout", t.Name)
+	}
+	if t.Handler == nil {
+		return fmt.Errorf("tool: %s: nil handler", t.Name)
+	}
+	if len(t.InputSchema) > 0 && !json.Valid(t.InputSchema) {
+		return fmt.Errorf("tool: %s: input schema is not valid JSON", t.Name)
+	}
+	return nil
+}
+
+// Registry is a set of uniquely named tools. Safe for concurrent use.
+// A nil *Registry is an empty registry.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	order []string // registration order, for stable tool listings
+}
+
+// NewRegistry creates a registry holding tools.
+// Returns an error if any tool is invalid or a name is registered twice.
+func NewRegistry(tools ...Tool) (*Registry, error) {
+	r := &Registry{}
+	for _, t := range tools {
+		if err := r.Register(t); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds t to the registry.
+// Returns an error if t is invalid or its name is already registered.
+func (r *Registry) Register(t Tool) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.tools[t.Name]; dup {
+		return fmt.Errorf("tool: duplicate name %q", t.Name)
+	}
+	if r.tools == nil {
+		r.tools = make(map[string]Tool)
+	}
+	r.tools[t.Name] = t
+	r.order = append(r.order, t.Name)
+	return nil
+}
+
+// Lookup returns the tool registered under name.
+func (r *Registry) Lookup(name string) (Tool, bool) {
+	if r == nil {
+		return Tool{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Tools returns the registered tools in registration order.
+func (r *Registry) Tools() []Tool {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tools := make([]Tool, 0, len(r.order))
+	for _, name := range r.order {
+		tools = append(tools, r.tools[name])
+	}
+	return tools
+}
+
+// Len returns the number of registered tools.
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tools)
+}
+
+// Call runs the named tool's handler with input, bounded by the tool's
+// Timeout. Handler panics are recovered and returned as errors. Returns
+// ErrUnknownTool (wrapped) for names not in the registry.
+//
+// Call returns as soon as ctx is done or the timeout expires, even if the
+// handler ignores its ctx; such a handler keeps running in the background
+// and its result is discarded. A timeout is returned as an error wrapping
+// context.DeadlineExceeded.
+func (r *Registry) Call(ctx context.Context, name string, input json.RawMessage) (json.RawMessage, error) {
+	t, ok := r.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTool, name)
+	}
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		out json.RawMessage
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := safeCall(ctx, t.Handler, input)
+		done <- result{out, err}
+	}()
+	select {
+	case res := <-done:
+		return res.out, res.err
+	case <-ctx.Done():
+		select {
+		case res := <-done: // finished as ctx expired
+			return res.out, res.err
+		default:
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && t.Timeout > 0 {
+			return nil, fmt.Errorf("timed out after %s: %w", t.Timeout, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// safeCall calls h with panic recovery.
+func safeCall(ctx context.Context, h Handler, input json.RawMessage) (out json.RawMessage, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("tool handler panic: %v", r)
+		}
+	}()
+	return h(ctx, input)
+}
+
+// ResultText renders a tool call's outcome as the text sent back to the
+// model: a JSON string output is unquoted, other JSON is passed through,
+// and an error becomes "error: <message>".
+func ResultText(output json.RawMessage, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	var s string
+	if json.Unmarshal(output, &s) == nil {
+		return s
+	}
+	return string(output)
+}
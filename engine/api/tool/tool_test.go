@@ -0,0 +1,121 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoTool(name string) Tool {
+	return Tool{
+		Name: name,
+		Handler: func(_ context.Context, input json.RawMessage) (json.RawMessage, error) {
+			return input, nil
+		},
+	}
+}
+
+func TestNewRegistry_Order(t *testing.T) {
+	r, err := NewRegistry(echoTool("b"), echoTool("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := r.Tools()
+	if len(tools) != 2 || tools[0].Name != "b" || tools[1].Name != "a" || r.Len() != 2 {
+		t.Errorf("Tools() = %v, want [b a]", tools)
+	}
+}
+
+func TestRegister_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		tool    Tool
+		wantErr string
+	}{
+		{"InvalidName", echoTool("has space"), "invalid name"},
+		{"EmptyName", echoTool(""), "invalid name"},
+		{"NilHandler", Tool{Name: "x"}, "nil handler"},
+		{"BadSchema", Tool{Name: "x", InputSchema: json.RawMessage(`{`), Handler: echoTool("x").Handler}, "not valid JSON"},
+		{"NegativeTimeout", Tool{Name: "x", Handler: echoTool("x").Handler, Timeout: -1}, "negative timeout"},
+		{"Duplicate", echoTool("dup"), "duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := NewRegistry(echoTool("dup"))
+			err := r.Register(tt.tool)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchema_Default(t *testing.T) {
+	if got := string(echoTool("x").Schema()); got != string(emptySchema) {
+		t.Errorf("Schema() = %s", got)
+	}
+}
+
+func TestCall(t *testing.T) {
+	r, _ := NewRegistry(echoTool("echo"), Tool{
+		Name: "boom",
+		Handler: func(context.Context, json.RawMessage) (json.RawMessage, error) {
+			panic("kaboom")
+		},
+	})
+
+	out, err := r.Call(context.Background(), "echo", json.RawMessage(`{"a":1}`))
+	if err != nil || string(out) != `{"a":1}` {
+		t.Errorf("echo = %s, %v", out, err)
+	}
+	if _, err := r.Call(context.Background(), "missing", nil); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("missing err = %v, want ErrUnknownTool", err)
+	}
+	if _, err := r.Call(context.Background(), "boom", nil); err == nil || !strings.Contains(err.Error(), "kaboom") {
+		t.Errorf("panic err = %v", err)
+	}
+}
+
+func TestCall_Timeout(t *testing.T) {
+	r, _ := NewRegistry(Tool{
+		Name:    "stuck",
+		Timeout: 20 * time.Millisecond,
+		Handler: func(context.Context, json.RawMessage) (json.RawMessage, error) {
+			select {} // ignores ctx
+		},
+	})
+	_, err := r.Call(context.Background(), "stuck", nil)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("err = %v, want timeout", err)
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	if r.Len() != 0 || r.Tools() != nil {
+		t.Error("nil registry should be empty")
+	}
+	if _, err := r.Call(context.Background(), "x", nil); !errors.Is(err, ErrUnknownTool) {
+		t.Errorf("err = %v, want ErrUnknownTool", err)
+	}
+}
+
+func TestResultText(t *testing.T) {
+	tests := []struct {
+		output json.RawMessage
+		err    error
+		want   string
+	}{
+		{json.RawMessage(`"plain"`), nil, "plain"},
+		{json.RawMessage(`{"n":1}`), nil, `{"n":1}`},
+		{nil, errors.New("nope"), "error: nope"},
+	}
+	for _, tt := range tests {
+		if got := ResultText(tt.output, tt.err); got != tt.want {
+			t.Errorf("ResultText(%s, %v) = %q, want %q", tt.output, tt.err, got, tt.want)
+		}
+	}
+}
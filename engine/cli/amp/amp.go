@@ -0,0 +1,245 @@
+package amp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/cli/internal/optutil"
+)
+
+// Session option keys specific to the Amp backend.
+// Namespaced with "amp." to prevent collision across backends.
+// Cross-cutting options (OptionMode, OptionHITL, OptionResumeID) are
+// defined in the root agentrun package.
+const (
+	// OptionDangerouslyAllowAll adds --dangerously-allow-all (run every
+	// tool without asking). Any non-empty value adds the flag.
+	// Ignored when root OptionMode or OptionHITL is set (independent surfaces).
+	OptionDangerouslyAllowAll = "amp.dangerously_allow_all"
+
+	// OptionAgentMode sets the --mode flag for new threads.
+	// Values should be AgentMode constants. Not applied on thread
+	// continuation (the mode is fixed when the thread is created).
+	OptionAgentMode = "amp.mode"
+)
+
+// AgentMode selects the Amp agent mode via --mode.
+type AgentMode string
+
+const (
+	AgentModeSmart AgentMode = "smart"
+	AgentModeRush  AgentMode = "rush"
+	AgentModeFree  AgentMode = "free"
+)
+
+// validAgentMode reports whether m is a recognized agent mode.
+func validAgentMode(m AgentMode) bool {
+	switch m {
+	case AgentModeSmart, AgentModeRush, AgentModeFree:
+		return true
+	}
+	return false
+}
+
+// validThreadID matches Amp thread IDs ("T-<uuid>" in practice).
+// Leading dashes are rejected so an ID is never parsed as a flag.
+var validThreadID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$`)
+
+const defaultBinary = "amp"
+
+// Backend is an Amp CLI backend for agentrun.
+// It implements cli.Spawner, cli.Parser, and cli.Resumer.
+//
+// Amp's execute mode does not read streaming input (no cli.Streamer or
+// cli.InputFormatter). Multi-turn conversation uses resume-per-turn:
+// each Send() spawns "amp threads continue <thread_id>".
+//
+// The thread ID is auto-captured from the first system/init event via atomic
+// write-once. It is per-session state: cli.Engine runs each session on a
+// Fork (cli.Forker), so one Engine can run concurrent sessions.
+type Backend struct {
+	binary   string
+	threadID atomic.Pointer[string] // write-once from first system/init
+	tools    toolNames              // tool_use_id → name, for tool results
+}
+
+// toolNames remembers the names of tool_use blocks until their
+// tool_result arrives (results carry only the tool_use_id).
+type toolNames struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+// Compile-time interface satisfaction checks.
+// Amp does NOT implement cli.Streamer or cli.InputFormatter.
+var (
+	_ cli.Backend = (*Backend)(nil)
+	_ cli.Spawner = (*Backend)(nil)
+	_ cli.Parser  = (*Backend)(nil)
+	_ cli.Resumer = (*Backend)(nil)
+	_ cli.Forker  = (*Backend)(nil)
+
+	_ cli.SessionValidator = (*Backend)(nil)
+)
+
+// Option configures a Backend at construction time.
+type Option func(*Backend)
+
+// WithBinary overrides the Amp CLI binary path.
+// Empty values are ignored; the default is "amp".
+func WithBinary(path string) Option {
+	return func(b *Backend) {
+		if path != "" {
+			b.binary = path
+		}
+	}
+}
+
+// New creates an Amp CLI backend with the given options.
+// The default binary is "amp".
+func New(opts ...Option) *Backend {
+	b := &Backend{binary: defaultBinary}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Fork returns a Backend with the same configuration and no captured
+// thread ID or pending tool names, for one session. cli.Engine forks on every Start.
+func (b *Backend) Fork() cli.Backend {
+	return &Backend{binary: b.binary}
+}
+
+// ValidateSession rejects ModePlan: Amp has no read-only mode, so a plan
+// session would run with Amp's own permission rules and could edit files.
+func (b *Backend) ValidateSession(session agentrun.Session) error {
+	return rejectPlan(session.Options)
+}
+
+// SpawnArgs builds exec.Cmd arguments for a new Amp thread.
+// When OptionResumeID is set and valid, continues that thread instead
+// (cold resume). Invalid option values are silently skipped per the
+// Spawner contract.
+func (b *Backend) SpawnArgs(session agentrun.Session) (string, []string) {
+	var args []string
+	if id := session.Options[agentrun.OptionResumeID]; id != "" && validateThreadID(id) == nil {
+		args = continueArgs(id)
+	} else {
+		args = []string{}
+		if m := AgentMode(session.Options[OptionAgentMode]); validAgentMode(m) {
+			args = append(args, "--mode", string(m))
+		}
+	}
+
+	prompt := session.Prompt
+	if jsonutil.ContainsNull(prompt) {
+		prompt = ""
+	}
+	args = appendCommonArgs(args, session.Options, prompt)
+	return b.binary, args
+}
+
+// ResumeArgs builds exec.Cmd arguments to continue an existing Amp thread.
+// The thread ID is resolved from:
+//  1. The atomic write-once ID captured from system/init (auto-capture)
+//  2. session.Options[OptionResumeID] (explicit fallback)
+//
+// Returns an error if no thread ID is available, if the message
+// contains null bytes, or if session options are invalid or ask for
+// ModePlan.
+func (b *Backend) ResumeArgs(session agentrun.Session, initialPrompt string) (string, []string, error) {
+	if err := optutil.ValidateModeHITL("amp", session.Options); err != nil {
+		return "", nil, err
+	}
+	if err := rejectPlan(session.Options); err != nil {
+		return "", nil, err
+	}
+
+	tid := b.resolveThreadID(session)
+	if tid == "" {
+		return "", nil, errors.New("amp: no thread ID available (not captured from init and not set via OptionResumeID)")
+	}
+	if err := validateThreadID(tid); err != nil {
+		return "", nil, err
+	}
+	if jsonutil.ContainsNull(initialPrompt) {
+		return "", nil, errors.New("amp: initial prompt contains null bytes")
+	}
+
+	args := appendCommonArgs(continueArgs(tid), session.Options, initialPrompt)
+	return b.binary, args, nil
+}
+
+// resolveThreadID returns the thread ID from the atomic store (auto-capture)
+// or from OptionResumeID. Stored ID takes precedence.
+func (b *Backend) resolveThreadID(session agentrun.Session) string {
+	if p := b.threadID.Load(); p != nil {
+		return *p
+	}
+	return session.Options[agentrun.OptionResumeID]
+}
+
+// continueArgs returns the subcommand that continues an existing thread.
+func continueArgs(threadID string) []string {
+	return []string{"threads", "continue", threadID}
+}
+
+// appendCommonArgs appends the permission flag, the execute prompt and
+// --stream-json. The prompt is attached with "=" so a prompt starting
+// with "-" is never parsed as a separate flag.
+//
+// Session.Model, SystemPrompt, MaxTurns, ThinkingBudget, Effort and
+// AddDirs are silently ignored (Amp has no flags for these; the model
+// follows the agent mode).
+func appendCommonArgs(args []string, opts map[string]string, prompt string) []string {
+	if resolveAllowAll(opts) {
+		args = append(args, "--dangerously-allow-all")
+	}
+	if prompt != "" {
+		args = append(args, "--execute="+prompt)
+	} else {
+		args = append(args, "--execute")
+	}
+	return append(args, "--stream-json")
+}
+
+// resolveAllowAll maps root-level OptionMode/OptionHITL and backend-specific
+// OptionDangerouslyAllowAll to --dangerously-allow-all.
+//
+// Root options and backend options are independent control surfaces:
+// when root options are set, OptionDangerouslyAllowAll is ignored.
+//
+// Key invariant: ModePlan ALWAYS suppresses --dangerously-allow-all, for
+// callers of SpawnArgs that skip ValidateSession.
+func resolveAllowAll(opts map[string]string) bool {
+	if optutil.RootOptionsSet(opts) {
+		if agentrun.Mode(opts[agentrun.OptionMode]) == agentrun.ModePlan {
+			return false
+		}
+		return agentrun.HITL(opts[agentrun.OptionHITL]) == agentrun.HITLOff
+	}
+	return opts[OptionDangerouslyAllowAll] != ""
+}
+
+// rejectPlan returns an error when opts ask for ModePlan.
+func rejectPlan(opts map[string]string) error {
+	if agentrun.Mode(opts[agentrun.OptionMode]) == agentrun.ModePlan {
+		return errors.New("amp: OptionMode plan is not supported: amp has no read-only mode")
+	}
+	return nil
+}
+
+// validateThreadID reports whether id is usable as a thread reference.
+func validateThreadID(id string) error {
+	if !validThreadID.MatchString(id) {
+		return fmt.Errorf("amp: invalid thread ID format: %q", id)
+	}
+	return nil
+}
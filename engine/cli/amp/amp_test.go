@@ -0,0 +1,205 @@
+package amp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+// Test constants.
+const testThreadID = "T-7f395a45-7fae-4983-8de0-d02e61d30183"
+
+// --- Constructor ---
+
+func TestNew_Default(t *testing.T) {
+	b := New()
+	if b.binary != defaultBinary {
+		t.Errorf("binary = %q, want %q", b.binary, defaultBinary)
+	}
+}
+
+func TestNew_WithBinary(t *testing.T) {
+	if New(WithBinary("/opt/bin/amp")).binary != "/opt/bin/amp" {
+		t.Error("WithBinary not applied")
+	}
+	if New(WithBinary("")).binary != defaultBinary {
+		t.Error("empty WithBinary should keep default")
+	}
+}
+
+// --- SpawnArgs ---
+
+func TestSpawnArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		want    []string
+	}{
+		{
+			name:    "Minimal",
+			session: agentrun.Session{Prompt: "hello"},
+			want:    []string{"--execute=hello", "--stream-json"},
+		},
+		{
+			name:    "EmptyPrompt",
+			session: agentrun.Session{},
+			want:    []string{"--execute", "--stream-json"},
+		},
+		{
+			name:    "NullBytePrompt",
+			session: agentrun.Session{Prompt: "a\x00b"},
+			want:    []string{"--execute", "--stream-json"},
+		},
+		{
+			name:    "DashPromptAttached",
+			session: agentrun.Session{Prompt: "--dangerously-allow-all"},
+			want:    []string{"--execute=--dangerously-allow-all", "--stream-json"},
+		},
+		{
+			name:    "ModelIgnored",
+			session: agentrun.Session{Prompt: "hi", Model: "claude-sonnet-4"},
+			want:    []string{"--execute=hi", "--stream-json"},
+		},
+		{
+			name: "AgentMode",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{OptionAgentMode: "rush"},
+			},
+			want: []string{"--mode", "rush", "--execute=hi", "--stream-json"},
+		},
+		{
+			name: "InvalidAgentModeSkipped",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{OptionAgentMode: "turbo"},
+			},
+			want: []string{"--execute=hi", "--stream-json"},
+		},
+		{
+			name: "HITLOff",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionHITL: "off"},
+			},
+			want: []string{"--dangerously-allow-all", "--execute=hi", "--stream-json"},
+		},
+		{
+			name: "PlanSuppressesAllowAll",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionMode: "plan", agentrun.OptionHITL: "off"},
+			},
+			want: []string{"--execute=hi", "--stream-json"},
+		},
+		{
+			name: "BackendAllowAll",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{OptionDangerouslyAllowAll: "true"},
+			},
+			want: []string{"--dangerously-allow-all", "--execute=hi", "--stream-json"},
+		},
+		{
+			name: "RootIgnoresBackendAllowAll",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionHITL: "on", OptionDangerouslyAllowAll: "true"},
+			},
+			want: []string{"--execute=hi", "--stream-json"},
+		},
+		{
+			name: "ResumeID",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionResumeID: testThreadID, OptionAgentMode: "rush"},
+			},
+			want: []string{"threads", "continue", testThreadID, "--execute=hi", "--stream-json"},
+		},
+		{
+			name: "InvalidResumeIDSkipped",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionResumeID: "-T"},
+			},
+			want: []string{"--execute=hi", "--stream-json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, args := New().SpawnArgs(tt.session)
+			if binary != defaultBinary {
+				t.Errorf("binary = %q", binary)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("args = %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
+
+// --- ResumeArgs ---
+
+func TestResumeArgs_CapturedThreadID(t *testing.T) {
+	b := New()
+	tid := testThreadID
+	b.threadID.Store(&tid)
+	_, args, err := b.ResumeArgs(agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "T-other", agentrun.OptionHITL: "off"},
+	}, "next")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"threads", "continue", testThreadID, "--dangerously-allow-all", "--execute=next", "--stream-json"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestResumeArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		prompt  string
+		wantErr string
+	}{
+		{"NoThreadID", agentrun.Session{}, "x", "no thread ID"},
+		{"InvalidThreadID", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: "T/1"}}, "x", "invalid thread ID"},
+		{"NullBytePrompt", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testThreadID}}, "a\x00b", "null bytes"},
+		{"InvalidHITL", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testThreadID, agentrun.OptionHITL: "maybe"}}, "x", "amp:"},
+		{"ModePlan", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testThreadID, agentrun.OptionMode: "plan"}}, "x", "plan is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := New().ResumeArgs(tt.session, tt.prompt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// --- ValidateSession ---
+
+func TestValidateSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    map[string]string
+		wantErr bool
+	}{
+		{"NoOptions", nil, false},
+		{"ModeAct", map[string]string{agentrun.OptionMode: "act", agentrun.OptionHITL: "off"}, false},
+		{"ModePlan", map[string]string{agentrun.OptionMode: "plan"}, true},
+		{"ModePlanHITLOff", map[string]string{agentrun.OptionMode: "plan", agentrun.OptionHITL: "off"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New().ValidateSession(agentrun.Session{Options: tt.opts})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package amp_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/amp"
+	"github.com/dmora/agentrun/enginetest/clitest"
+)
+
+func TestCompliance(t *testing.T) {
+	clitest.RunBackendTests(t, func() cli.Backend {
+		return amp.New()
+	})
+}
@@ -0,0 +1,50 @@
+// Package amp provides an Amp CLI backend for agentrun.
+//
+// This backend implements cli.Spawner, cli.Parser, and cli.Resumer to
+// drive Amp in execute mode ("--execute --stream-json"), translating its
+// nd-JSON output into agentrun.Message values. It does NOT implement
+// cli.Streamer or cli.InputFormatter — Amp uses resume-per-turn for
+// multi-turn conversation.
+//
+// # Resume-per-turn pattern
+//
+// Execute mode is single-shot: provide a prompt, get a response, process
+// exits. For multi-turn, each Send() spawns a new process via "amp threads
+// continue <thread_id> --execute=<prompt> --stream-json". The thread ID is
+// auto-captured from the first system/init event ("session_id") and stored
+// in the session's Backend fork (cli.Forker), so one Engine can run
+// concurrent sessions.
+//
+// Callers relying on auto-capture must wait for MessageInit before
+// calling Send, or supply OptionResumeID upfront.
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - OptionHITL → HITLOff → --dangerously-allow-all
+//   - OptionMode → ModePlan is rejected (Start and ResumeArgs fail): Amp
+//     has no read-only mode. ModeAct is accepted.
+//   - OptionResumeID → thread to continue (auto-captured or explicit cold
+//     resume). Consumers capture the thread ID from MessageInit.ResumeID.
+//
+// Backend-specific (namespaced with "amp." prefix):
+//   - OptionDangerouslyAllowAll → --dangerously-allow-all; ignored when
+//     OptionMode or OptionHITL is set
+//   - OptionAgentMode → --mode <smart|rush|free> (new threads only)
+//
+// Session.Model is ignored: Amp selects the model from the agent mode.
+//
+// # Event types
+//
+// The stream-json format follows Claude's: system (subtype init), user,
+// assistant, result. Assistant events carry complete content blocks —
+// text maps to MessageText, tool_use-only messages to MessageToolUse and
+// thinking-only messages to MessageThinking, with per-call usage and
+// stop_reason from the nested message. User events carrying tool_result
+// blocks map to MessageToolResult (the tool name is recovered from the
+// matching tool_use); prompt echoes are skipped.
+//
+// The result event's "result" field becomes MessageResult Content, with
+// token usage when reported. is_error results map to MessageError with
+// the subtype (e.g. "error_during_execution") as ErrorCode.
+package amp
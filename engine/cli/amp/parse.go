@@ -0,0 +1,281 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/stoputil"
+)
+
+// eventParser parses a raw JSON event into an agentrun.Message.
+// Returns cli.ErrSkipLine when the event produces no message.
+type eventParser func(b *Backend, raw map[string]any, msg *agentrun.Message) error
+
+// eventParsers dispatches Amp stream-json event types to their parser
+// functions. Adding a new event type = one map entry + one function.
+var eventParsers = map[string]eventParser{
+	"system":    (*Backend).parseSystem,
+	"user":      (*Backend).parseUser,
+	"assistant": (*Backend).parseAssistant,
+	"result":    (*Backend).parseResult,
+	"error":     (*Backend).parseError,
+}
+
+// ParseLine parses a single stream-json output line from Amp into a
+// Message. Returns cli.ErrSkipLine for blank lines and user prompt echoes.
+//
+// Amp emits 4 event types: system (subtype init), user, assistant, result;
+// top-level error events are handled defensively. Events carry a
+// "session_id" (the thread ID) but no timestamp (time.Now is used).
+func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
+	if strings.TrimSpace(line) == "" {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return agentrun.Message{}, fmt.Errorf("amp: invalid JSON: %w", err)
+	}
+
+	typeStr := jsonutil.GetString(raw, "type")
+	if typeStr == "" {
+		return agentrun.Message{}, fmt.Errorf("amp: missing or empty type field")
+	}
+
+	var msg agentrun.Message
+	msg.Raw = json.RawMessage(line)
+	msg.Timestamp = time.Now()
+
+	if parser, ok := eventParsers[typeStr]; ok {
+		if err := parser(b, raw, &msg); err != nil {
+			return agentrun.Message{}, err
+		}
+		return msg, nil
+	}
+
+	// Unknown event type → MessageSystem (graceful, not error).
+	msg.Type = agentrun.MessageSystem
+	msg.Content = typeStr
+	return msg, nil
+}
+
+// parseSystem handles system events with thread ID write-once logic.
+// The first init → MessageInit (ID captured when valid); later inits
+// (continued threads) and other subtypes → MessageSystem.
+func (b *Backend) parseSystem(raw map[string]any, msg *agentrun.Message) error {
+	subtype := jsonutil.GetString(raw, "subtype")
+	if subtype != "init" {
+		msg.Type = agentrun.MessageSystem
+		msg.Content = "system"
+		if subtype != "" {
+			msg.Content = "system/" + subtype
+		}
+		return nil
+	}
+
+	tid := jsonutil.GetString(raw, "session_id")
+	if tid != "" && validateThreadID(tid) == nil && b.threadID.CompareAndSwap(nil, &tid) {
+		msg.Type = agentrun.MessageInit
+		msg.ResumeID = tid
+		return nil
+	}
+
+	// First init without a usable thread ID — still emit MessageInit so
+	// the engine doesn't block waiting for init.
+	if b.threadID.Load() == nil {
+		msg.Type = agentrun.MessageInit
+		return nil
+	}
+
+	msg.Type = agentrun.MessageSystem
+	msg.Content = "init"
+	if tid != "" {
+		msg.Content = "init: " + tid
+	}
+	return nil
+}
+
+// parseUser handles user events. Tool results → MessageToolResult with
+// the tool name recovered from the matching tool_use; prompt echoes are
+// skipped.
+func (b *Backend) parseUser(raw map[string]any, msg *agentrun.Message) error {
+	content, _ := jsonutil.GetMap(raw, "message")["content"].([]any)
+	for _, c := range content {
+		block, ok := c.(map[string]any)
+		if !ok || jsonutil.GetString(block, "type") != "tool_result" {
+			continue
+		}
+		msg.Type = agentrun.MessageToolResult
+		msg.Tool = &agentrun.ToolCall{
+			Name:   b.tools.finish(jsonutil.GetString(block, "tool_use_id")),
+			Output: marshalField(block, "content"),
+		}
+		return nil
+	}
+	return cli.ErrSkipLine
+}
+
+// parseAssistant handles assistant events. Text blocks are concatenated
+// into MessageText; a message with only tool_use blocks → MessageToolUse;
+// a message with only thinking → MessageThinking. The last tool_use block
+// is attached as Tool (as in Claude's format). Per-call usage and the
+// stop reason are taken from the nested message.
+func (b *Backend) parseAssistant(raw map[string]any, msg *agentrun.Message) error {
+	message := jsonutil.GetMap(raw, "message")
+	content, _ := message["content"].([]any)
+
+	var text, thinking strings.Builder
+	for _, c := range content {
+		block, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch jsonutil.GetString(block, "type") {
+		case "text":
+			text.WriteString(jsonutil.GetString(block, "text"))
+		case "thinking":
+			thinking.WriteString(jsonutil.GetString(block, "thinking"))
+		case "tool_use":
+			name := jsonutil.GetString(block, "name")
+			b.tools.start(jsonutil.GetString(block, "id"), name)
+			msg.Tool = &agentrun.ToolCall{Name: name, Input: marshalField(block, "input")}
+		}
+	}
+
+	switch {
+	case text.Len() > 0:
+		msg.Type = agentrun.MessageText
+		msg.Content = text.String()
+	case msg.Tool != nil:
+		msg.Type = agentrun.MessageToolUse
+	case thinking.Len() > 0:
+		msg.Type = agentrun.MessageThinking
+		msg.Content = thinking.String()
+	default:
+		msg.Type = agentrun.MessageText
+	}
+
+	msg.Usage = extractUsage(message)
+	if sr := jsonutil.GetString(message, "stop_reason"); sr != "" {
+		msg.StopReason = stoputil.Sanitize(sr)
+	}
+	return nil
+}
+
+// parseResult handles the final result event. Successful results →
+// MessageResult with the full response as Content and usage when
+// reported; is_error results → MessageError with the subtype as code.
+func (b *Backend) parseResult(raw map[string]any, msg *agentrun.Message) error {
+	b.tools.reset()
+	if isErr, _ := raw["is_error"].(bool); isErr {
+		msg.Type = agentrun.MessageError
+		msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(raw, "subtype"))
+		message := jsonutil.GetString(raw, "error")
+		if message == "" {
+			message = jsonutil.GetString(raw, "result")
+		}
+		if message == "" {
+			message = "turn failed"
+		}
+		msg.Content = errfmt.Truncate(message)
+		errcat.Apply(msg)
+		return nil
+	}
+	msg.Type = agentrun.MessageResult
+	msg.Content = jsonutil.GetString(raw, "result")
+	msg.Usage = extractUsage(raw)
+	return nil
+}
+
+// parseError handles top-level error events.
+func (b *Backend) parseError(raw map[string]any, msg *agentrun.Message) error {
+	msg.Type = agentrun.MessageError
+	msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(raw, "code"))
+	message := jsonutil.GetString(raw, "message")
+	if message == "" {
+		message = jsonutil.GetString(raw, "error")
+	}
+	if message == "" {
+		message = "unknown error"
+	}
+	msg.Content = errfmt.Truncate(message)
+	errcat.Apply(msg)
+	return nil
+}
+
+// --- toolNames ---
+
+func (t *toolNames) start(id, name string) {
+	if id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.names == nil {
+		t.names = make(map[string]string)
+	}
+	t.names[id] = name
+}
+
+func (t *toolNames) finish(id string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name := t.names[id]
+	delete(t.names, id)
+	return name
+}
+
+func (t *toolNames) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.names)
+}
+
+// --- helpers ---
+
+// extractUsage extracts token usage from a source map's "usage" object.
+// Cost comes from the source root ("total_cost_usd") when reported.
+// Returns nil if no meaningful usage data is present (all fields zero).
+func extractUsage(source map[string]any) *agentrun.Usage {
+	u := &agentrun.Usage{}
+	if usage := jsonutil.GetMap(source, "usage"); usage != nil {
+		u.InputTokens = jsonutil.GetInt(usage, "input_tokens")
+		u.OutputTokens = jsonutil.GetInt(usage, "output_tokens")
+		u.CacheReadTokens = jsonutil.GetInt(usage, "cache_read_input_tokens")
+		u.CacheWriteTokens = jsonutil.GetInt(usage, "cache_creation_input_tokens")
+	}
+	cost := jsonutil.GetFloat(source, "total_cost_usd")
+	if math.IsInf(cost, 0) || math.IsNaN(cost) || cost < 0 {
+		cost = 0
+	}
+	u.CostUSD = cost
+
+	if u.InputTokens == 0 && u.OutputTokens == 0 &&
+		u.CacheReadTokens == 0 && u.CacheWriteTokens == 0 && u.CostUSD == 0 {
+		return nil
+	}
+	return u
+}
+
+// marshalField marshals m[key] to json.RawMessage if present, else returns nil.
+// On marshal failure, returns a diagnostic JSON string rather than nil to
+// avoid silent data loss.
+func marshalField(m map[string]any, key string) json.RawMessage {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf(`"[marshal error: %v]"`, err))
+	}
+	return data
+}
@@ -0,0 +1,153 @@
+package amp
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+)
+
+// --- system ---
+
+func TestParseLine_Init(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"system","subtype":"init","cwd":"/w","session_id":"` + testThreadID + `","tools":["Bash"],"mcp_servers":[]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageInit || msg.ResumeID != testThreadID {
+		t.Fatalf("got %+v", msg)
+	}
+	if b.resolveThreadID(agentrun.Session{}) != testThreadID {
+		t.Errorf("captured ID = %q", b.resolveThreadID(agentrun.Session{}))
+	}
+
+	// A continued thread's init is a system message.
+	msg, err = b.ParseLine(`{"type":"system","subtype":"init","session_id":"` + testThreadID + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "init: "+testThreadID {
+		t.Errorf("second init = %+v, want system", msg)
+	}
+}
+
+func TestParseLine_Init_InvalidID(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"system","subtype":"init","session_id":"--x"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageInit || msg.ResumeID != "" || b.resolveThreadID(agentrun.Session{}) != "" {
+		t.Errorf("got %+v, want MessageInit without ResumeID", msg)
+	}
+}
+
+// --- assistant / user ---
+
+func TestParseLine_AssistantText(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"assistant","message":{"type":"message","role":"assistant","content":[{"type":"text","text":"Hello"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"cache_creation_input_tokens":2,"cache_read_input_tokens":100,"output_tokens":5}},"parent_tool_use_id":null,"session_id":"` + testThreadID + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageText || msg.Content != "Hello" {
+		t.Fatalf("got %+v", msg)
+	}
+	if msg.StopReason != agentrun.StopEndTurn {
+		t.Errorf("StopReason = %q", msg.StopReason)
+	}
+	want := agentrun.Usage{InputTokens: 10, OutputTokens: 5, CacheReadTokens: 100, CacheWriteTokens: 2}
+	if msg.Usage == nil || *msg.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", msg.Usage, want)
+	}
+}
+
+func TestParseLine_AssistantThinking(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"assistant","message":{"content":[{"type":"thinking","thinking":"hmm"}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageThinking || msg.Content != "hmm" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestParseLine_ToolRoundTrip(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"cmd":"ls"}}],"stop_reason":"tool_use"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolUse || msg.Tool == nil || msg.Tool.Name != "Bash" {
+		t.Fatalf("got %+v", msg)
+	}
+	if string(msg.Tool.Input) != `{"cmd":"ls"}` {
+		t.Errorf("Input = %s", msg.Tool.Input)
+	}
+
+	msg, err = b.ParseLine(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"go.mod\n","is_error":false}]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolResult || msg.Tool.Name != "Bash" {
+		t.Fatalf("got %+v", msg)
+	}
+	if string(msg.Tool.Output) != `"go.mod\n"` {
+		t.Errorf("Output = %s", msg.Tool.Output)
+	}
+}
+
+func TestParseLine_UserEchoSkipped(t *testing.T) {
+	_, err := New().ParseLine(`{"type":"user","message":{"role":"user","content":[{"type":"text","text":"hi"}]}}`)
+	if !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("err = %v, want ErrSkipLine", err)
+	}
+}
+
+// --- result ---
+
+func TestParseLine_Result(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"result","subtype":"success","duration_ms":2100,"is_error":false,"num_turns":2,"result":"Done.","session_id":"` + testThreadID + `","usage":{"input_tokens":30,"output_tokens":12}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageResult || msg.Content != "Done." {
+		t.Fatalf("got %+v", msg)
+	}
+	if msg.Usage == nil || msg.Usage.InputTokens != 30 || msg.Usage.OutputTokens != 12 {
+		t.Errorf("Usage = %+v", msg.Usage)
+	}
+}
+
+func TestParseLine_ResultWithoutUsage(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"result","subtype":"success","is_error":false,"result":"ok"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Usage != nil {
+		t.Errorf("Usage = %+v, want nil", msg.Usage)
+	}
+}
+
+func TestParseLine_ResultError(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"result","subtype":"error_during_execution","is_error":true,"error":"boom"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageError || msg.ErrorCode != "error_during_execution" || msg.Content != "boom" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+// --- edge cases ---
+
+func TestParseLine_Unknown(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"future"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "future" {
+		t.Errorf("got %+v", msg)
+	}
+}
@@ -24,7 +24,8 @@
 // The Claude backend produces these [agentrun.MessageType] values:
 //
 //   - [agentrun.MessageInit] — session start (from "system/init" or "init" events)
-//   - [agentrun.MessageSystem] — system status messages
+//   - [agentrun.MessageSystem] — system status messages; "rate_limit_event"
+//     lines carry [agentrun.Message.RateLimit] (status "rejected" is exceeded)
 //   - [agentrun.MessageText] — assistant text, may include a [agentrun.ToolCall] via Message.Tool
 //   - [agentrun.MessageToolResult] — completed tool execution (from "tool" events)
 //   - [agentrun.MessageResult] — turn completion with optional usage data
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/cli"
 	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
 	"github.com/dmora/agentrun/engine/internal/errfmt"
 	"github.com/dmora/agentrun/engine/internal/stoputil"
 )
@@ -51,6 +53,8 @@ func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
 		parseResultMessage(raw, &msg)
 	case "error":
 		parseErrorMessage(raw, &msg)
+	case "rate_limit_event":
+		parseRateLimitEvent(raw, &msg)
 	case "stream_event":
 		// Two-level dispatch: stream_event wraps an inner event with its
 		// own type discriminator. See parseStreamEvent for the inner dispatch.
@@ -202,6 +206,38 @@ func parseErrorMessage(raw map[string]any, msg *agentrun.Message) {
 		msg.Content = jsonutil.GetString(raw, "error")
 	}
 	msg.Content = errfmt.Truncate(msg.Content)
+	errcat.Apply(msg)
+}
+
+// parseRateLimitEvent handles "rate_limit_event" lines, which report the
+// status of the account's usage limits: "allowed", "allowed_warning", or
+// "rejected" until resetsAt (Unix seconds).
+func parseRateLimitEvent(raw map[string]any, msg *agentrun.Message) {
+	msg.Type = agentrun.MessageSystem
+	info := jsonutil.GetMap(raw, "rate_limit_info")
+	status := errfmt.SanitizeCode(jsonutil.GetString(info, "status"))
+	msg.Content = "rate_limit_event: " + status
+
+	rl := agentrun.RateLimit{
+		Type:        errfmt.SanitizeCode(jsonutil.GetString(info, "rateLimitType")),
+		Exceeded:    status == "rejected",
+		Utilization: utilization(jsonutil.GetFloat(info, "utilization")),
+	}
+	if ts := jsonutil.GetFloat(info, "resetsAt"); ts > 0 && ts < 1e12 { // seconds; rejects milliseconds and overflow
+		rl.ResetsAt = time.Unix(int64(ts), 0).UTC()
+	}
+	if rl != (agentrun.RateLimit{}) {
+		msg.RateLimit = &rl
+	}
+}
+
+// utilization normalizes a reported utilization to a 0–1 fraction,
+// accepting percentages.
+func utilization(u float64) float64 {
+	if u > 1 {
+		u /= 100
+	}
+	return min(max(u, 0), 1)
 }
 
 // parseStreamEvent handles "stream_event" wrapper events from --include-partial-messages.
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/cli"
@@ -558,12 +559,35 @@ func TestParseLine_ErrorWithCode(t *testing.T) {
 	if msg.ErrorCode != "rate_limit" {
 		t.Errorf("ErrorCode = %q, want %q", msg.ErrorCode, "rate_limit")
 	}
+	if msg.ErrorCategory != agentrun.CategoryRateLimited {
+		t.Errorf("ErrorCategory = %q, want %q", msg.ErrorCategory, agentrun.CategoryRateLimited)
+	}
 	if msg.Content != "Too many requests" {
 		t.Errorf("content = %q, want %q", msg.Content, "Too many requests")
 	}
 	assertRawPopulated(t, msg)
 }
 
+func TestParseLine_RateLimitEvent(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"rate_limit_event","rate_limit_info":{"status":"rejected","resetsAt":1700018000,"rateLimitType":"seven_day","utilization":100}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := agentrun.RateLimit{Type: "seven_day", Exceeded: true, Utilization: 1, ResetsAt: time.Unix(1700018000, 0).UTC()}
+	if msg.Type != agentrun.MessageSystem || msg.RateLimit == nil || *msg.RateLimit != want {
+		t.Errorf("msg = %+v, RateLimit = %+v, want %+v", msg, msg.RateLimit, want)
+	}
+
+	msg, err = b.ParseLine(`{"type":"rate_limit_event"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.RateLimit != nil {
+		t.Errorf("missing rate_limit_info: type = %q, RateLimit = %+v", msg.Type, msg.RateLimit)
+	}
+}
+
 func TestParseLine_ErrorStringFallback(t *testing.T) {
 	b := New()
 	line := `{"type":"error","error":"something went wrong"}`
@@ -0,0 +1,42 @@
+// Package appserver provides a Codex engine backed by the long-lived
+// "codex app-server" JSON-RPC mode.
+//
+// Unlike the codex CLI backend, which spawns "codex exec resume" per turn,
+// this engine keeps one app-server subprocess alive for the whole session:
+// Start performs the initialize handshake and opens a thread (thread/start,
+// or thread/resume with OptionResumeID), and every Send runs a turn on it.
+// The app-server uses JSON-RPC without the "jsonrpc":"2.0" member.
+//
+//	engine := appserver.NewEngine()
+//	proc, err := engine.Start(ctx, agentrun.Session{CWD: dir})
+//
+// # Streaming
+//
+// Agent text and reasoning stream as MessageTextDelta and
+// MessageThinkingDelta; completed items arrive as MessageText,
+// MessageThinking, MessageToolUse and MessageToolResult. Each turn ends with
+// MessageResult carrying the turn's token usage and any declined approvals.
+// Output() must be drained concurrently with Send.
+// account/rateLimits/updated arrives as MessageSystem with a RateLimit for
+// the more used of the primary and secondary windows.
+//
+// # Steering
+//
+// Send while a turn is in flight steers that turn (turn/steer) instead of
+// queueing a new one: the message is added to the running turn and Send
+// returns once the app-server accepts it. Cancelling a Send's context
+// interrupts its turn (turn/interrupt).
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - Session.Model → thread model
+//   - OptionMode → ModePlan uses the read-only sandbox
+//   - OptionHITL → HITLOff never asks for approval (workspace-write sandbox
+//     unless ModePlan); otherwise approvals go to the ApprovalHandler
+//   - OptionEffort → per-turn reasoning effort (max → "xhigh")
+//   - OptionResumeID → thread/resume; MessageInit.ResumeID carries the thread ID
+//
+// Backend-specific: codex.OptionSandbox, honored when OptionMode and
+// OptionHITL are both unset (as in the exec backend).
+package appserver
@@ -0,0 +1,119 @@
+//go:build !windows
+
+package appserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/jsonrpc"
+)
+
+// Engine drives Codex through its long-lived JSON-RPC app-server.
+// Each Start spawns one "codex app-server" subprocess hosting one thread;
+// every Send runs a turn on it.
+type Engine struct {
+	opts EngineOptions
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine creates a Codex app-server engine.
+func NewEngine(opts ...EngineOption) *Engine {
+	return &Engine{opts: resolveEngineOptions(opts...)}
+}
+
+// Validate checks that the engine's binary is available on PATH.
+func (e *Engine) Validate() error {
+	_, err := e.resolveBinary()
+	return err
+}
+
+// resolveBinary resolves the configured binary via PATH.
+func (e *Engine) resolveBinary() (string, error) {
+	resolved, err := exec.LookPath(e.opts.Binary)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", agentrun.ErrUnavailable, e.opts.Binary, err)
+	}
+	return resolved, nil
+}
+
+// Start spawns the app-server, performs the initialize + thread handshake,
+// and returns a Process ready for multi-turn conversation.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	startOpts := agentrun.ResolveOptions(opts...)
+
+	session = session.Clone()
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+	if err := validateSession(session); err != nil {
+		return nil, err
+	}
+	if err := agentrun.ValidateEnv(session.Env); err != nil {
+		return nil, fmt.Errorf("codex app-server: %w", err)
+	}
+	env := agentrun.MergeEnv(os.Environ(), session.Env)
+
+	cmd, stdin, stdout, err := e.spawnSubprocess(session.CWD, env)
+	if err != nil {
+		return nil, err
+	}
+
+	p := newProcess(cmd, stdin, session, e.opts)
+	conn := jsonrpc.NewConn(stdout, stdin,
+		jsonrpc.WithoutVersion(),
+		jsonrpc.WithCancelMethod(""), // turns are cancelled with turn/interrupt
+		jsonrpc.WithMaxMessageSize(e.opts.MaxMessageSize),
+		jsonrpc.WithTrace(e.opts.WireTrace),
+		jsonrpc.WithRedactor(e.opts.WireRedactor),
+		jsonrpc.WithParseErrorHandler(func(_ []byte, err error) {
+			p.emit(agentrun.Message{
+				Type:      agentrun.MessageError,
+				Content:   fmt.Sprintf("codex app-server: malformed JSON: %v", err),
+				Timestamp: time.Now(),
+			})
+		}),
+	)
+	p.wire(conn)
+
+	hsCtx, hsCancel := context.WithTimeout(ctx, e.opts.HandshakeTimeout)
+	defer hsCancel()
+	if err := p.handshake(hsCtx); err != nil {
+		p.kill()
+		return nil, err
+	}
+	return p, nil
+}
+
+// spawnSubprocess resolves the binary and starts the app-server.
+func (e *Engine) spawnSubprocess(cwd string, env []string) (*exec.Cmd, io.WriteCloser, io.ReadCloser, error) {
+	resolvedBinary, err := e.resolveBinary()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cmd := exec.Command(resolvedBinary, e.opts.Args...)
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	cmd.Env = env
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("codex app-server: stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("codex app-server: stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, fmt.Errorf("codex app-server: start: %w", err)
+	}
+	return cmd, stdin, stdout, nil
+}
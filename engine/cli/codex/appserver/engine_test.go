@@ -0,0 +1,398 @@
+//go:build !windows
+
+package appserver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/codex/appserver"
+	"github.com/dmora/agentrun/engine/jsonrpc"
+)
+
+var (
+	mockBuildOnce  sync.Once
+	mockBinaryPath string
+	errMockBuild   error
+)
+
+const integrationTimeout = 10 * time.Second
+
+func buildMockBinary() {
+	dir, err := os.MkdirTemp("", "mock-app-server-*")
+	if err != nil {
+		errMockBuild = fmt.Errorf("tmpdir: %w", err)
+		return
+	}
+	mockBinaryPath = filepath.Join(dir, "mock-app-server")
+	cmd := exec.Command("go", "build", "-o", mockBinaryPath, "./testdata/mock-app-server/main.go")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		errMockBuild = fmt.Errorf("build mock: %w: %s", err, out)
+		os.RemoveAll(dir)
+	}
+}
+
+// newEngine returns an engine running the mock app-server in the given mode.
+func newEngine(t *testing.T, mode string, opts ...appserver.EngineOption) *appserver.Engine {
+	t.Helper()
+	mockBuildOnce.Do(buildMockBinary)
+	if errMockBuild != nil {
+		t.Fatalf("mock binary build failed: %v", errMockBuild)
+	}
+	wrapper := filepath.Join(t.TempDir(), "mock-app-server-wrapper")
+	script := fmt.Sprintf("#!/bin/sh\nexport CODEX_MOCK_MODE=%s\nexec %s \"$@\"\n", mode, mockBinaryPath)
+	if err := os.WriteFile(wrapper, []byte(script), 0o755); err != nil { //nolint:gosec // test wrapper must be executable
+		t.Fatalf("write wrapper: %v", err)
+	}
+	defaults := []appserver.EngineOption{appserver.WithBinary(wrapper)}
+	return appserver.NewEngine(append(defaults, opts...)...)
+}
+
+// start starts a session and registers cleanup. The first message
+// (MessageInit) is returned alongside the process.
+func start(t *testing.T, engine *appserver.Engine, session agentrun.Session) (agentrun.Process, agentrun.Message, context.Context) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	t.Cleanup(cancel)
+	proc, err := engine.Start(ctx, session)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc, <-proc.Output(), ctx
+}
+
+// runTurn sends message and collects output through MessageResult.
+func runTurn(t *testing.T, ctx context.Context, proc agentrun.Process, message string) []agentrun.Message {
+	t.Helper()
+	var msgs []agentrun.Message
+	err := agentrun.RunTurn(ctx, proc, message, func(m agentrun.Message) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("turn: %v", err)
+	}
+	return msgs
+}
+
+func ofType(msgs []agentrun.Message, mt agentrun.MessageType) []agentrun.Message {
+	var out []agentrun.Message
+	for _, m := range msgs {
+		if m.Type == mt {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func concat(msgs []agentrun.Message, mt agentrun.MessageType) string {
+	var b strings.Builder
+	for _, m := range ofType(msgs, mt) {
+		b.WriteString(m.Content)
+	}
+	return b.String()
+}
+
+func lastResult(t *testing.T, msgs []agentrun.Message) agentrun.Message {
+	t.Helper()
+	results := ofType(msgs, agentrun.MessageResult)
+	if len(results) == 0 {
+		t.Fatal("no MessageResult")
+	}
+	return results[len(results)-1]
+}
+
+// --- Tests ---
+
+func TestEngine_Start_Handshake(t *testing.T) {
+	_, init, _ := start(t, newEngine(t, ""), agentrun.Session{CWD: t.TempDir()})
+	if init.Type != agentrun.MessageInit {
+		t.Fatalf("first message = %q, want init", init.Type)
+	}
+	if init.ResumeID != "thr-new" {
+		t.Errorf("ResumeID = %q, want thr-new", init.ResumeID)
+	}
+	if init.Init == nil || init.Init.Model != "mock-model" || init.Init.AgentName != "mock_codex" || init.Init.AgentVersion != "1.2.3" {
+		t.Errorf("Init = %+v", init.Init)
+	}
+	if init.Process == nil || init.Process.PID <= 0 {
+		t.Errorf("Process = %+v, want PID", init.Process)
+	}
+}
+
+func TestEngine_Start_InitializeError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	defer cancel()
+	_, err := newEngine(t, "init-error").Start(ctx, agentrun.Session{})
+	if err == nil || !strings.Contains(err.Error(), "initialize") {
+		t.Fatalf("err = %v, want initialize error", err)
+	}
+}
+
+func TestEngine_Start_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+	}{
+		{"relative cwd", agentrun.Session{CWD: "rel"}},
+		{"bad mode", agentrun.Session{Options: map[string]string{agentrun.OptionMode: "yolo"}}},
+		{"bad effort", agentrun.Session{Options: map[string]string{agentrun.OptionEffort: "extreme"}}},
+		{"bad sandbox", agentrun.Session{Options: map[string]string{"codex.sandbox": "none"}}},
+	}
+	engine := appserver.NewEngine(appserver.WithBinary("sh"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := engine.Start(context.Background(), tt.session); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestEngine_Validate_MissingBinary(t *testing.T) {
+	err := appserver.NewEngine(appserver.WithBinary("no-such-codex-binary")).Validate()
+	if !errors.Is(err, agentrun.ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestEngine_ResumeID(t *testing.T) {
+	engine := newEngine(t, "")
+	_, init, _ := start(t, engine, agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "thr-existing"},
+	})
+	if init.ResumeID != "thr-existing" {
+		t.Errorf("ResumeID = %q, want thr-existing", init.ResumeID)
+	}
+
+	_, err := engine.Start(context.Background(), agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "thr-missing"},
+	})
+	if !errors.Is(err, agentrun.ErrSessionNotFound) {
+		t.Fatalf("err = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestEngine_Send_StreamsTurn(t *testing.T) {
+	proc, _, ctx := start(t, newEngine(t, ""), agentrun.Session{})
+	msgs := runTurn(t, ctx, proc, "hi")
+
+	if got := concat(msgs, agentrun.MessageTextDelta); got != "Hello world" {
+		t.Errorf("text deltas = %q, want %q", got, "Hello world")
+	}
+	if got := concat(msgs, agentrun.MessageText); got != "Hello world" {
+		t.Errorf("text = %q, want %q", got, "Hello world")
+	}
+	if got := concat(msgs, agentrun.MessageThinkingDelta); got != "thinking..." {
+		t.Errorf("thinking deltas = %q", got)
+	}
+	uses := ofType(msgs, agentrun.MessageToolUse)
+	if len(uses) != 1 || uses[0].Tool.Name != "command_execution" || string(uses[0].Tool.Input) != `"ls"` {
+		t.Errorf("tool uses = %+v", uses)
+	}
+	if len(ofType(msgs, agentrun.MessageToolResult)) != 1 {
+		t.Error("expected one tool result")
+	}
+	cw := ofType(msgs, agentrun.MessageContextWindow)
+	if len(cw) != 1 || cw[0].Usage.ContextSizeTokens != 1000 || cw[0].Usage.ContextUsedTokens != 15 {
+		t.Errorf("context window = %+v", cw)
+	}
+
+	res := lastResult(t, msgs)
+	if res.StopReason != agentrun.StopEndTurn {
+		t.Errorf("StopReason = %q, want end_turn", res.StopReason)
+	}
+	want := agentrun.Usage{InputTokens: 10, OutputTokens: 5, CacheReadTokens: 2, ThinkingTokens: 1}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", res.Usage, want)
+	}
+
+	// Second turn on the same subprocess.
+	msgs = runTurn(t, ctx, proc, "again")
+	if got := concat(msgs, agentrun.MessageText); got != "Hello world" {
+		t.Errorf("turn 2 text = %q", got)
+	}
+}
+
+func TestEngine_Send_FailedTurn(t *testing.T) {
+	proc, _, ctx := start(t, newEngine(t, "failed"), agentrun.Session{})
+	msgs := runTurn(t, ctx, proc, "hi")
+	errs := ofType(msgs, agentrun.MessageError)
+	if len(errs) != 1 || errs[0].Content != "model exploded" || errs[0].ErrorCode != "internalServerError" {
+		t.Errorf("errors = %+v", errs)
+	}
+	if res := lastResult(t, msgs); res.StopReason != "failed" {
+		t.Errorf("StopReason = %q, want failed", res.StopReason)
+	}
+}
+
+// traceWaiter returns a wire trace option and a function that blocks until
+// an inbound frame containing substr has been seen.
+func traceWaiter(t *testing.T, substr string) (appserver.EngineOption, func()) {
+	t.Helper()
+	seen := make(chan struct{})
+	var once sync.Once
+	opt := appserver.WithWireTrace(func(dir jsonrpc.Direction, frame []byte) {
+		if dir == jsonrpc.Inbound && strings.Contains(string(frame), substr) {
+			once.Do(func() { close(seen) })
+		}
+	})
+	return opt, func() {
+		select {
+		case <-seen:
+		case <-time.After(integrationTimeout):
+			t.Fatalf("timed out waiting for %q", substr)
+		}
+	}
+}
+
+func TestEngine_Send_Steer(t *testing.T) {
+	opt, waitStarted := traceWaiter(t, `"turn/started"`)
+	proc, _, ctx := start(t, newEngine(t, "slow", opt), agentrun.Session{})
+
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- proc.Send(ctx, "first") }()
+	waitStarted()
+
+	// A Send during the turn steers it and returns without waiting.
+	if err := proc.Send(ctx, "also this"); err != nil {
+		t.Fatalf("steer: %v", err)
+	}
+
+	var msgs []agentrun.Message
+	for m := range proc.Output() {
+		msgs = append(msgs, m)
+		if m.Type == agentrun.MessageResult {
+			break
+		}
+	}
+	if got := concat(msgs, agentrun.MessageText); got != "steered: also this" {
+		t.Errorf("text = %q, want steered input", got)
+	}
+	if len(ofType(msgs, agentrun.MessageResult)) != 1 {
+		t.Errorf("results = %d, want 1 (steering joins the running turn)", len(ofType(msgs, agentrun.MessageResult)))
+	}
+	if err := <-sendErr; err != nil {
+		t.Errorf("first send: %v", err)
+	}
+}
+
+func TestEngine_Send_CancelInterruptsTurn(t *testing.T) {
+	opt, waitStarted := traceWaiter(t, `"turn/started"`)
+	proc, _, ctx := start(t, newEngine(t, "slow", opt), agentrun.Session{})
+
+	turnCtx, cancel := context.WithCancel(ctx)
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- proc.Send(turnCtx, "long task") }()
+	waitStarted()
+	cancel()
+
+	if err := <-sendErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("send err = %v, want context.Canceled", err)
+	}
+	for m := range proc.Output() {
+		if m.Type == agentrun.MessageResult {
+			if m.StopReason != "interrupted" {
+				t.Errorf("StopReason = %q, want interrupted", m.StopReason)
+			}
+			return
+		}
+	}
+	t.Fatal("output closed without MessageResult")
+}
+
+func TestEngine_Approval(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []appserver.EngineOption
+		hitl        string
+		want        string
+		wantDenials int
+	}{
+		{"no handler declines", nil, "", "decision=decline", 1},
+		{"handler approves", []appserver.EngineOption{appserver.WithApprovalHandler(
+			func(_ context.Context, req appserver.ApprovalRequest) (bool, error) {
+				return req.Kind == "command_execution" && req.Command == "rm -rf /tmp/x", nil
+			})}, "", "decision=accept", 0},
+		{"handler denies", []appserver.EngineOption{appserver.WithApprovalHandler(
+			func(context.Context, appserver.ApprovalRequest) (bool, error) { return false, nil })}, "", "decision=decline", 1},
+		{"handler panics", []appserver.EngineOption{appserver.WithApprovalHandler(
+			func(context.Context, appserver.ApprovalRequest) (bool, error) { panic("boom") })}, "", "decision=decline", 0},
+		{"hitl off accepts", nil, "off", "decision=accept", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := agentrun.Session{Options: map[string]string{}}
+			if tt.hitl != "" {
+				session.Options[agentrun.OptionHITL] = tt.hitl
+			}
+			proc, _, ctx := start(t, newEngine(t, "approval", tt.opts...), session)
+			msgs := runTurn(t, ctx, proc, "do it")
+			if got := concat(msgs, agentrun.MessageText); got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+			if got := len(lastResult(t, msgs).Denials); got != tt.wantDenials {
+				t.Errorf("denials = %d, want %d", got, tt.wantDenials)
+			}
+		})
+	}
+}
+
+func TestEngine_WireFormat(t *testing.T) {
+	var mu sync.Mutex
+	var outbound []string
+	trace := appserver.WithWireTrace(func(dir jsonrpc.Direction, frame []byte) {
+		if dir == jsonrpc.Outbound {
+			mu.Lock()
+			outbound = append(outbound, string(frame))
+			mu.Unlock()
+		}
+	})
+	proc, _, ctx := start(t, newEngine(t, "", trace), agentrun.Session{
+		Model: "gpt-test",
+		Options: map[string]string{
+			agentrun.OptionMode:   string(agentrun.ModePlan),
+			agentrun.OptionEffort: string(agentrun.EffortMax),
+		},
+	})
+	runTurn(t, ctx, proc, "hi")
+
+	mu.Lock()
+	defer mu.Unlock()
+	all := strings.Join(outbound, "\n")
+	if strings.Contains(all, `"jsonrpc"`) {
+		t.Errorf("outbound frames carry a jsonrpc member:\n%s", all)
+	}
+	for _, want := range []string{
+		`"sandbox":"read-only"`,
+		`"approvalPolicy":"on-request"`,
+		`"model":"gpt-test"`,
+		`"effort":"xhigh"`,
+		`"method":"initialized"`,
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("outbound frames missing %s", want)
+		}
+	}
+}
+
+func TestEngine_Stop(t *testing.T) {
+	proc, _, _ := start(t, newEngine(t, ""), agentrun.Session{})
+	err := proc.Stop(context.Background())
+	if err != nil && !errors.Is(err, agentrun.ErrTerminated) {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := proc.Send(context.Background(), "hi"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("send after stop = %v, want ErrTerminated", err)
+	}
+}
@@ -0,0 +1,312 @@
+// notify.go maps Codex app-server notifications to agentrun.Message values.
+//
+// Stateless notifications dispatch through the notificationParsers map.
+// turn/completed and thread/tokenUsage/updated carry turn state and are
+// handled by the process (see process.go).
+//
+// Adding a new notification = one map entry + one function.
+package appserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+)
+
+// notificationParser converts notification params into a Message.
+// Returns nil to indicate the notification should be silently consumed.
+type notificationParser func(params json.RawMessage) *agentrun.Message
+
+// notificationParsers dispatches stateless server notifications.
+// Notifications not listed here (and not handled by the process) are ignored:
+// the app-server emits many bookkeeping events (MCP status, ...)
+// that have no agentrun equivalent.
+var notificationParsers = map[string]notificationParser{
+	MethodAgentDelta:     deltaParser(agentrun.MessageTextDelta),
+	MethodReasoningDelta: deltaParser(agentrun.MessageThinkingDelta),
+	MethodSummaryDelta:   deltaParser(agentrun.MessageThinkingDelta),
+	MethodItemStarted:    parseItemStarted,
+	MethodItemCompleted:  parseItemCompleted,
+	MethodError:          parseErrorNotification,
+	MethodRateLimits:     parseRateLimits,
+}
+
+// parseNotification maps a server notification to a Message, or nil.
+func parseNotification(method string, params json.RawMessage) *agentrun.Message {
+	parser, ok := notificationParsers[method]
+	if !ok {
+		return nil
+	}
+	m := parser(params)
+	if m == nil {
+		return nil
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	return m
+}
+
+// unmarshalError produces a MessageError for a notification that failed to decode.
+func unmarshalError(method string, err error) *agentrun.Message {
+	return &agentrun.Message{
+		Type:      agentrun.MessageError,
+		Content:   errfmt.Truncate(fmt.Sprintf("codex app-server: unmarshal %s: %v", method, err)),
+		Timestamp: time.Now(),
+	}
+}
+
+// --- Deltas ---
+
+// deltaParser returns a parser for item/*/delta notifications.
+// Empty deltas are consumed silently.
+func deltaParser(mt agentrun.MessageType) notificationParser {
+	return func(params json.RawMessage) *agentrun.Message {
+		var d deltaNotification
+		if err := json.Unmarshal(params, &d); err != nil {
+			return unmarshalError(string(mt), err)
+		}
+		if d.Delta == "" {
+			return nil
+		}
+		return &agentrun.Message{Type: mt, Content: d.Delta}
+	}
+}
+
+// --- Items ---
+
+// itemParser converts a decoded thread item into a Message.
+type itemParser func(item map[string]any) *agentrun.Message
+
+// startedItemParsers announce tool invocations as they begin.
+var startedItemParsers = map[string]itemParser{
+	"commandExecution": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolUse, "command_execution", marshalString(jsonutil.GetString(item, "command")), nil)
+	},
+	"fileChange": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolUse, "file_change", marshalValue(item["changes"]), nil)
+	},
+	"mcpToolCall": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolUse, mcpToolName(item), marshalValue(item["arguments"]), nil)
+	},
+	"webSearch": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolUse, "web_search", marshalString(jsonutil.GetString(item, "query")), nil)
+	},
+}
+
+// completedItemParsers convert finished items into complete messages.
+var completedItemParsers = map[string]itemParser{
+	"agentMessage": func(item map[string]any) *agentrun.Message {
+		return &agentrun.Message{Type: agentrun.MessageText, Content: jsonutil.GetString(item, "text")}
+	},
+	"reasoning": parseReasoningItem,
+	"commandExecution": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolResult, "command_execution", marshalString(jsonutil.GetString(item, "command")), marshalValue(item))
+	},
+	"fileChange": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolResult, "file_change", nil, marshalValue(item))
+	},
+	"mcpToolCall": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolResult, mcpToolName(item), marshalValue(item["arguments"]), marshalValue(item))
+	},
+	"webSearch": func(item map[string]any) *agentrun.Message {
+		return toolMessage(agentrun.MessageToolResult, "web_search", marshalString(jsonutil.GetString(item, "query")), marshalValue(item))
+	},
+	"userMessage": func(map[string]any) *agentrun.Message { return nil }, // echo of our own input
+}
+
+// parseItemStarted handles item/started. Only tool items produce a message;
+// text and reasoning items stream via deltas and complete via item/completed.
+func parseItemStarted(params json.RawMessage) *agentrun.Message {
+	return parseItem(MethodItemStarted, params, startedItemParsers, false)
+}
+
+// parseItemCompleted handles item/completed. Unknown item types surface as
+// MessageSystem ("item/completed/<type>") so new Codex items are visible.
+func parseItemCompleted(params json.RawMessage) *agentrun.Message {
+	return parseItem(MethodItemCompleted, params, completedItemParsers, true)
+}
+
+// parseItem decodes the item envelope and dispatches on item.type.
+func parseItem(method string, params json.RawMessage, parsers map[string]itemParser, reportUnknown bool) *agentrun.Message {
+	var n itemNotification
+	if err := json.Unmarshal(params, &n); err != nil {
+		return unmarshalError(method, err)
+	}
+	var item map[string]any
+	if err := json.Unmarshal(n.Item, &item); err != nil || item == nil {
+		return &agentrun.Message{Type: agentrun.MessageSystem, Content: method + ": missing item"}
+	}
+	itemType := jsonutil.GetString(item, "type")
+	if parser, ok := parsers[itemType]; ok {
+		return parser(item)
+	}
+	if !reportUnknown {
+		return nil
+	}
+	return &agentrun.Message{Type: agentrun.MessageSystem, Content: method + "/" + itemType}
+}
+
+// parseReasoningItem joins a reasoning item's summary (preferred) or raw
+// content parts into one MessageThinking.
+func parseReasoningItem(item map[string]any) *agentrun.Message {
+	text := joinStrings(item["summary"])
+	if text == "" {
+		text = joinStrings(item["content"])
+	}
+	if text == "" {
+		return nil
+	}
+	return &agentrun.Message{Type: agentrun.MessageThinking, Content: text}
+}
+
+// mcpToolName returns "server/tool" for MCP tool calls, or "mcp_tool_call".
+func mcpToolName(item map[string]any) string {
+	server, tool := jsonutil.GetString(item, "server"), jsonutil.GetString(item, "tool")
+	switch {
+	case server != "" && tool != "":
+		return server + "/" + tool
+	case tool != "":
+		return tool
+	default:
+		return "mcp_tool_call"
+	}
+}
+
+// --- Rate limits ---
+
+// parseRateLimits reports the most used of the primary and secondary
+// usage windows as a MessageSystem with RateLimit. A window at 100% is
+// exceeded until it resets.
+func parseRateLimits(params json.RawMessage) *agentrun.Message {
+	var n rateLimitsNotification
+	if err := json.Unmarshal(params, &n); err != nil {
+		return unmarshalError(MethodRateLimits, err)
+	}
+	name, w := "primary", n.RateLimits.Primary
+	if s := n.RateLimits.Secondary; s != nil && (w == nil || s.UsedPercent > w.UsedPercent) {
+		name, w = "secondary", s
+	}
+	if w == nil {
+		return nil
+	}
+	rl := &agentrun.RateLimit{
+		Type:        name,
+		Exceeded:    w.UsedPercent >= 100,
+		Utilization: min(max(w.UsedPercent/100, 0), 1),
+	}
+	if w.ResetsAt != nil && *w.ResetsAt > 0 {
+		rl.ResetsAt = time.Unix(*w.ResetsAt, 0).UTC()
+	}
+	return &agentrun.Message{
+		Type:      agentrun.MessageSystem,
+		Content:   fmt.Sprintf("rate limits: %s %.0f%% used", name, w.UsedPercent),
+		RateLimit: rl,
+	}
+}
+
+// --- Errors ---
+
+// parseErrorNotification handles the top-level error notification.
+// Errors the server will retry are reported as MessageSystem, not MessageError.
+func parseErrorNotification(params json.RawMessage) *agentrun.Message {
+	var n errorNotification
+	if err := json.Unmarshal(params, &n); err != nil {
+		return unmarshalError(MethodError, err)
+	}
+	msg := errorMessage(&n.Error)
+	if n.WillRetry {
+		msg.Type = agentrun.MessageSystem
+		msg.Content = "retrying: " + msg.Content
+		msg.ErrorCategory, msg.RetryAfter, msg.RateLimit = "", 0, nil
+	}
+	return msg
+}
+
+// errorMessage converts a Codex error object into a MessageError.
+// codexErrorInfo is either a bare string ("usageLimitExceeded") or an
+// object keyed by the variant ({"httpConnectionFailed": {...}}).
+func errorMessage(e *turnError) *agentrun.Message {
+	content := e.Message
+	if content == "" {
+		content = "unknown error"
+	}
+	msg := &agentrun.Message{
+		Type:      agentrun.MessageError,
+		Content:   errfmt.Truncate(content),
+		ErrorCode: errfmt.SanitizeCode(errorCode(e.CodexErrorInfo)),
+		Timestamp: time.Now(),
+	}
+	errcat.Apply(msg)
+	return msg
+}
+
+// errorCode extracts the variant name from codexErrorInfo.
+func errorCode(info json.RawMessage) string {
+	if len(info) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(info, &s) == nil {
+		return s
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(info, &obj) == nil && len(obj) == 1 {
+		for k := range obj {
+			return k
+		}
+	}
+	return ""
+}
+
+// --- Helpers ---
+
+// toolMessage builds a tool message.
+func toolMessage(mt agentrun.MessageType, name string, input, output json.RawMessage) *agentrun.Message {
+	return &agentrun.Message{
+		Type: mt,
+		Tool: &agentrun.ToolCall{Name: name, Input: input, Output: output},
+	}
+}
+
+// joinStrings joins a JSON array of strings with blank lines; other values yield "".
+func joinStrings(v any) string {
+	arr, ok := v.([]any)
+	if !ok {
+		return ""
+	}
+	parts := make([]string, 0, len(arr))
+	for _, p := range arr {
+		if s, ok := p.(string); ok && s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// marshalString converts a string to json.RawMessage; empty yields nil.
+func marshalString(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return marshalValue(s)
+}
+
+// marshalValue marshals v to json.RawMessage; nil yields nil.
+// On marshal failure, returns a diagnostic JSON string rather than nil.
+func marshalValue(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf(`"[marshal error: %v]"`, err))
+	}
+	return data
+}
@@ -0,0 +1,139 @@
+package appserver
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestParseNotification(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		params      string
+		wantType    agentrun.MessageType // "" means nil message
+		wantContent string
+		wantTool    string
+	}{
+		{"agent delta", MethodAgentDelta, `{"delta":"Hi"}`, agentrun.MessageTextDelta, "Hi", ""},
+		{"empty delta", MethodAgentDelta, `{"delta":""}`, "", "", ""},
+		{"reasoning delta", MethodReasoningDelta, `{"delta":"hmm"}`, agentrun.MessageThinkingDelta, "hmm", ""},
+		{"summary delta", MethodSummaryDelta, `{"delta":"plan"}`, agentrun.MessageThinkingDelta, "plan", ""},
+		{"agent message", MethodItemCompleted, `{"item":{"type":"agentMessage","text":"done"}}`, agentrun.MessageText, "done", ""},
+		{"reasoning summary", MethodItemCompleted, `{"item":{"type":"reasoning","summary":["a","b"]}}`, agentrun.MessageThinking, "a\n\nb", ""},
+		{"reasoning content fallback", MethodItemCompleted, `{"item":{"type":"reasoning","summary":[],"content":["raw"]}}`, agentrun.MessageThinking, "raw", ""},
+		{"empty reasoning", MethodItemCompleted, `{"item":{"type":"reasoning"}}`, "", "", ""},
+		{"user message echo", MethodItemCompleted, `{"item":{"type":"userMessage"}}`, "", "", ""},
+		{"unknown completed item", MethodItemCompleted, `{"item":{"type":"imageView"}}`, agentrun.MessageSystem, "item/completed/imageView", ""},
+		{"command started", MethodItemStarted, `{"item":{"type":"commandExecution","command":"ls"}}`, agentrun.MessageToolUse, "", "command_execution"},
+		{"command completed", MethodItemCompleted, `{"item":{"type":"commandExecution","command":"ls"}}`, agentrun.MessageToolResult, "", "command_execution"},
+		{"file change started", MethodItemStarted, `{"item":{"type":"fileChange","changes":[]}}`, agentrun.MessageToolUse, "", "file_change"},
+		{"mcp tool started", MethodItemStarted, `{"item":{"type":"mcpToolCall","server":"gh","tool":"search"}}`, agentrun.MessageToolUse, "", "gh/search"},
+		{"web search completed", MethodItemCompleted, `{"item":{"type":"webSearch","query":"go"}}`, agentrun.MessageToolResult, "", "web_search"},
+		{"agent message started", MethodItemStarted, `{"item":{"type":"agentMessage"}}`, "", "", ""},
+		{"missing item", MethodItemCompleted, `{}`, agentrun.MessageSystem, "item/completed: missing item", ""},
+		{"error", MethodError, `{"error":{"message":"boom"}}`, agentrun.MessageError, "boom", ""},
+		{"retrying error", MethodError, `{"error":{"message":"flaky"},"willRetry":true}`, agentrun.MessageSystem, "retrying: flaky", ""},
+		{"rate limits", MethodRateLimits, `{"rateLimits":{"primary":{"usedPercent":40,"windowDurationMins":300,"resetsAt":1700000000},"secondary":{"usedPercent":12}}}`, agentrun.MessageSystem, "rate limits: primary 40% used", ""},
+		{"no rate limit windows", MethodRateLimits, `{"rateLimits":{"primary":null,"secondary":null}}`, "", "", ""},
+		{"unknown method", "mcpServer/startupStatus/updated", `{}`, "", "", ""},
+		{"malformed params", MethodAgentDelta, `[1]`, agentrun.MessageError, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := parseNotification(tt.method, json.RawMessage(tt.params))
+			if tt.wantType == "" {
+				if msg != nil {
+					t.Fatalf("got %+v, want nil", msg)
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatal("got nil message")
+			}
+			if msg.Type != tt.wantType {
+				t.Errorf("type = %q, want %q", msg.Type, tt.wantType)
+			}
+			if tt.wantContent != "" && msg.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", msg.Content, tt.wantContent)
+			}
+			if tt.wantTool != "" && (msg.Tool == nil || msg.Tool.Name != tt.wantTool) {
+				t.Errorf("tool = %+v, want name %q", msg.Tool, tt.wantTool)
+			}
+			if msg.Timestamp.IsZero() {
+				t.Error("timestamp should be set")
+			}
+		})
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		info string
+		want string
+	}{
+		{``, ""},
+		{`"usageLimitExceeded"`, "usageLimitExceeded"},
+		{`{"httpConnectionFailed":{"httpStatusCode":502}}`, "httpConnectionFailed"},
+		{`{"a":1,"b":2}`, ""},
+		{`42`, ""},
+	}
+	for _, tt := range tests {
+		if got := errorCode(json.RawMessage(tt.info)); got != tt.want {
+			t.Errorf("errorCode(%s) = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestBuildInitMeta(t *testing.T) {
+	meta := buildInitMeta("codex_cli_rs/0.50.0 (Linux; x86_64) xterm", "gpt-5")
+	if meta == nil {
+		t.Fatal("expected meta")
+	}
+	if meta.AgentName != "codex_cli_rs" || meta.AgentVersion != "0.50.0" || meta.Model != "gpt-5" {
+		t.Errorf("meta = %+v", meta)
+	}
+	if got := buildInitMeta("", ""); got != nil {
+		t.Errorf("empty meta = %+v, want nil", got)
+	}
+}
+
+func TestThreadParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         map[string]string
+		wantSandbox  string
+		wantApproval string
+	}{
+		{"defaults", nil, "", ""},
+		{"backend sandbox", map[string]string{"codex.sandbox": "workspace-write"}, "workspace-write", ""},
+		{"plan wins", map[string]string{agentrun.OptionMode: "plan", agentrun.OptionHITL: "off", "codex.sandbox": "danger-full-access"}, "read-only", approvalNever},
+		{"hitl off", map[string]string{agentrun.OptionHITL: "off"}, "workspace-write", approvalNever},
+		{"hitl on", map[string]string{agentrun.OptionHITL: "on"}, "", approvalOnRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := threadParams(agentrun.Session{Options: tt.opts})
+			if p.Sandbox != tt.wantSandbox {
+				t.Errorf("sandbox = %q, want %q", p.Sandbox, tt.wantSandbox)
+			}
+			if p.ApprovalPolicy != tt.wantApproval {
+				t.Errorf("approvalPolicy = %q, want %q", p.ApprovalPolicy, tt.wantApproval)
+			}
+		})
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	msg := parseNotification(MethodRateLimits, json.RawMessage(
+		`{"rateLimits":{"primary":{"usedPercent":30},"secondary":{"usedPercent":100,"windowDurationMins":10080,"resetsAt":1700000000}}}`))
+	if msg == nil || msg.RateLimit == nil {
+		t.Fatalf("got %+v, want RateLimit", msg)
+	}
+	want := agentrun.RateLimit{Type: "secondary", Exceeded: true, Utilization: 1, ResetsAt: time.Unix(1700000000, 0).UTC()}
+	if *msg.RateLimit != want {
+		t.Errorf("RateLimit = %+v, want %+v", *msg.RateLimit, want)
+	}
+}
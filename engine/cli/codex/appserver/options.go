@@ -0,0 +1,181 @@
+package appserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmora/agentrun/engine/jsonrpc"
+)
+
+// Default engine configuration values.
+const (
+	defaultBinary           = "codex"
+	defaultOutputBuffer     = 4096 // handles ~4K notifications per turn without blocking
+	defaultGracePeriod      = 5 * time.Second
+	defaultHandshakeTimeout = 30 * time.Second
+	defaultApprovalTimeout  = 30 * time.Second
+	defaultMaxMessageSize   = 4 << 20 // 4 MB — max JSON-RPC message size for Conn scanner
+)
+
+// defaultArgs starts Codex in app-server mode.
+var defaultArgs = []string{"app-server"}
+
+// ApprovalRequest carries an app-server approval request to the handler.
+type ApprovalRequest struct {
+	ThreadID string
+	TurnID   string
+	ItemID   string
+	Kind     string // "command_execution" or "file_change"
+	Command  string // command line, for command_execution
+	CWD      string // working directory, for command_execution
+	Reason   string // optional explanation from the agent
+}
+
+// ApprovalHandler is called when the app-server asks the client to approve
+// a command execution or file change. Runs in a dedicated goroutine (not
+// blocking ReadLoop). Return true to accept.
+// If nil, approval requests are declined (unless HITL is off).
+type ApprovalHandler func(ctx context.Context, req ApprovalRequest) (approved bool, err error)
+
+// EngineOptions holds resolved construction-time configuration for an
+// app-server engine.
+type EngineOptions struct {
+	// Binary is the Codex executable name or path.
+	Binary string
+
+	// Args are the arguments passed to the binary (default ["app-server"]).
+	Args []string
+
+	// OutputBuffer is the channel buffer size for process output messages.
+	OutputBuffer int
+
+	// GracePeriod is the duration to wait after SIGTERM before sending SIGKILL.
+	GracePeriod time.Duration
+
+	// HandshakeTimeout is the deadline for initialize + thread/start during Start().
+	HandshakeTimeout time.Duration
+
+	// MaxMessageSize is the maximum JSON-RPC message size in bytes for the scanner.
+	MaxMessageSize int
+
+	// ApprovalTimeout is the deadline for the ApprovalHandler callback.
+	ApprovalTimeout time.Duration
+
+	// ApprovalHandler is called when the app-server requests approval.
+	ApprovalHandler ApprovalHandler
+
+	// WireTrace receives every JSON-RPC frame exchanged with the app-server.
+	WireTrace jsonrpc.TraceFunc
+
+	// WireRedactor rewrites frames before they reach WireTrace.
+	WireRedactor jsonrpc.Redactor
+}
+
+// EngineOption configures an Engine at construction time.
+type EngineOption func(*EngineOptions)
+
+// WithBinary sets the Codex executable name or path.
+func WithBinary(binary string) EngineOption {
+	return func(o *EngineOptions) {
+		if binary != "" {
+			o.Binary = binary
+		}
+	}
+}
+
+// WithArgs sets the arguments passed to the binary, replacing the default
+// ["app-server"].
+func WithArgs(args ...string) EngineOption {
+	return func(o *EngineOptions) {
+		o.Args = args
+	}
+}
+
+// WithOutputBuffer sets the channel buffer size for process output messages.
+// Values <= 0 are ignored.
+func WithOutputBuffer(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.OutputBuffer = size
+		}
+	}
+}
+
+// WithGracePeriod sets the duration to wait after SIGTERM before sending SIGKILL.
+// Values <= 0 are ignored.
+func WithGracePeriod(d time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		if d > 0 {
+			o.GracePeriod = d
+		}
+	}
+}
+
+// WithHandshakeTimeout sets the deadline for the initialize + thread handshake.
+// Values <= 0 are ignored.
+func WithHandshakeTimeout(d time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		if d > 0 {
+			o.HandshakeTimeout = d
+		}
+	}
+}
+
+// WithMaxMessageSize sets the maximum JSON-RPC message size in bytes.
+// The default is 4 MB. Zero or negative means unlimited.
+func WithMaxMessageSize(size int) EngineOption {
+	return func(o *EngineOptions) {
+		o.MaxMessageSize = size
+	}
+}
+
+// WithApprovalHandler sets the callback for command and file-change approvals.
+func WithApprovalHandler(h ApprovalHandler) EngineOption {
+	return func(o *EngineOptions) {
+		o.ApprovalHandler = h
+	}
+}
+
+// WithApprovalTimeout sets the deadline for the approval handler callback.
+// Values <= 0 are ignored.
+func WithApprovalTimeout(d time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		if d > 0 {
+			o.ApprovalTimeout = d
+		}
+	}
+}
+
+// WithWireTrace sets a callback receiving every JSON-RPC frame exchanged
+// with the app-server. The callback runs synchronously on the connection
+// and must not block.
+func WithWireTrace(fn jsonrpc.TraceFunc) EngineOption {
+	return func(o *EngineOptions) {
+		o.WireTrace = fn
+	}
+}
+
+// WithWireRedactor sets the redactor applied to frames before WireTrace.
+func WithWireRedactor(r jsonrpc.Redactor) EngineOption {
+	return func(o *EngineOptions) {
+		o.WireRedactor = r
+	}
+}
+
+func resolveEngineOptions(opts ...EngineOption) EngineOptions {
+	o := EngineOptions{
+		Binary:           defaultBinary,
+		Args:             defaultArgs,
+		OutputBuffer:     defaultOutputBuffer,
+		GracePeriod:      defaultGracePeriod,
+		HandshakeTimeout: defaultHandshakeTimeout,
+		MaxMessageSize:   defaultMaxMessageSize,
+		ApprovalTimeout:  defaultApprovalTimeout,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
@@ -0,0 +1,573 @@
+//go:build !windows
+
+package appserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/procutil"
+	"github.com/dmora/agentrun/engine/internal/stoputil"
+	"github.com/dmora/agentrun/engine/jsonrpc"
+)
+
+// process implements agentrun.Process for one app-server thread.
+type process struct {
+	conn *jsonrpc.Conn
+	// cmd is immutable after newProcess() returns — assigned once, never
+	// reassigned. processMetaSnapshot reads it without a lock.
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	session  agentrun.Session
+	hitl     agentrun.HITL
+	opts     EngineOptions
+	threadID string // set by handshake, read-only afterwards
+
+	output       chan agentrun.Message
+	outputMu     sync.Mutex // guards output channel close
+	outputClosed bool
+	done         chan struct{}
+
+	turnMu sync.Mutex // serializes turn/start; steering bypasses it
+	mu     sync.Mutex // guards turn and its fields
+	turn   *turnState // in-flight turn; nil between turns
+
+	termErr    error
+	stopping   atomic.Bool
+	stopOnce   sync.Once
+	finishOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// turnState tracks one turn from turn/start to turn/completed.
+type turnState struct {
+	id          string          // from the turn/start response; "" until ready
+	ready       chan struct{}   // closed once turn/start has been answered
+	done        chan struct{}   // closed after the turn's MessageResult is emitted
+	interrupted bool            // Send gave up on the turn and sent turn/interrupt
+	usage       *agentrun.Usage // latest per-turn token usage
+	denials     []agentrun.PermissionDenial
+}
+
+var _ agentrun.Process = (*process)(nil)
+
+// newProcess creates a process shell. The Conn and ReadLoop are wired up
+// by Engine.Start after construction.
+func newProcess(cmd *exec.Cmd, stdin io.WriteCloser, session agentrun.Session, opts EngineOptions) *process {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &process{
+		cmd:     cmd,
+		stdin:   stdin,
+		session: session,
+		hitl:    agentrun.HITL(session.Options[agentrun.OptionHITL]),
+		opts:    opts,
+		output:  make(chan agentrun.Message, opts.OutputBuffer),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// wire registers notification and approval handlers on conn and launches
+// ReadLoop in the background. Notifications are emitted from ReadLoop, so
+// consumers must drain Output() concurrently with Send.
+func (p *process) wire(conn *jsonrpc.Conn) {
+	p.conn = conn
+	for method := range notificationParsers {
+		conn.OnNotification(method, func(params json.RawMessage) {
+			if msg := parseNotification(method, params); msg != nil {
+				p.emit(*msg)
+			}
+		})
+	}
+	conn.OnNotification(MethodTurnCompleted, p.handleTurnCompleted)
+	conn.OnNotification(MethodTokenUsage, p.handleTokenUsage)
+	conn.OnMethod(MethodCommandApproval, p.approvalHandler("command_execution"))
+	conn.OnMethod(MethodFileChangeApproval, p.approvalHandler("file_change"))
+
+	go func() {
+		conn.ReadLoop()
+		if readErr := conn.Err(); readErr != nil {
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
+			_ = p.cmd.Wait() // reap zombie
+			p.finish(fmt.Errorf("codex app-server: reader: %w", readErr))
+			return
+		}
+		p.finish(procutil.WrapExitError(p.cmd.Wait()))
+	}()
+}
+
+// Output returns the channel for receiving messages from the agent.
+func (p *process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send transmits a user message to the thread.
+//
+// With no turn in flight, Send starts a turn and blocks until it completes
+// (MessageResult emitted) or ctx expires; on ctx expiry the turn is
+// interrupted. While a turn is in flight, Send steers it instead: the
+// message is appended to the running turn via turn/steer and Send returns
+// once the app-server accepts it. The running turn's MessageResult covers
+// the steered input.
+func (p *process) Send(ctx context.Context, message string) error {
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+	if t := p.activeTurn(); t != nil {
+		if steered, err := p.steer(ctx, t, message); steered {
+			return err
+		}
+	}
+
+	p.turnMu.Lock()
+	defer p.turnMu.Unlock()
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+
+	// An interrupted turn still owns the thread until turn/completed.
+	if t := p.currentTurn(); t != nil {
+		if err := p.waitTurn(ctx, t); err != nil {
+			return err
+		}
+	}
+	return p.runTurn(ctx, message)
+}
+
+// runTurn starts a turn and waits for its completion.
+func (p *process) runTurn(ctx context.Context, message string) error {
+	t := &turnState{ready: make(chan struct{}), done: make(chan struct{})}
+	p.mu.Lock()
+	p.turn = t
+	p.mu.Unlock()
+
+	params := turnStartParams{
+		ThreadID: p.threadID,
+		Input:    []userInput{{Type: "text", Text: message}},
+		Effort:   codexEffort[agentrun.Effort(p.session.Options[agentrun.OptionEffort])],
+	}
+	var result turnResult
+	if err := p.conn.Call(ctx, MethodTurnStart, params, &result); err != nil {
+		p.mu.Lock()
+		if p.turn == t {
+			p.turn = nil
+		}
+		p.mu.Unlock()
+		close(t.ready)
+		return fmt.Errorf("codex app-server: turn/start: %w", err)
+	}
+	p.mu.Lock()
+	t.id = result.Turn.ID
+	p.mu.Unlock()
+	close(t.ready)
+
+	select {
+	case <-t.done:
+		return nil
+	case <-p.done:
+		select {
+		case <-t.done:
+			return nil // completed just before the process exited
+		default:
+		}
+		return agentrun.ErrTerminated
+	case <-ctx.Done():
+		p.interrupt(t)
+		return ctx.Err()
+	}
+}
+
+// steer appends message to the in-flight turn t. Returns steered=false when
+// t finished before the steer landed, in which case the caller starts a new
+// turn instead.
+func (p *process) steer(ctx context.Context, t *turnState, message string) (steered bool, err error) {
+	select {
+	case <-t.ready:
+	case <-p.done:
+		return true, agentrun.ErrTerminated
+	case <-ctx.Done():
+		return true, ctx.Err()
+	}
+	p.mu.Lock()
+	id := t.id
+	p.mu.Unlock()
+	if id == "" {
+		return false, nil // turn/start failed
+	}
+
+	params := turnSteerParams{
+		ThreadID:       p.threadID,
+		Input:          []userInput{{Type: "text", Text: message}},
+		ExpectedTurnID: id,
+	}
+	err = p.conn.Call(ctx, MethodTurnSteer, params, nil)
+	if err == nil {
+		return true, nil
+	}
+	select {
+	case <-t.done:
+		return false, nil // raced with turn/completed
+	default:
+	}
+	return true, fmt.Errorf("codex app-server: turn/steer: %w", err)
+}
+
+// waitTurn blocks until t completes, the process ends, or ctx expires.
+func (p *process) waitTurn(ctx context.Context, t *turnState) error {
+	select {
+	case <-t.done:
+		return nil
+	case <-p.done:
+		return agentrun.ErrTerminated
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// interrupt marks t interrupted and asks the app-server to stop it.
+// Best-effort and asynchronous, so a stalled subprocess cannot block Send
+// from returning. The interrupted turn still ends with turn/completed.
+func (p *process) interrupt(t *turnState) {
+	p.mu.Lock()
+	t.interrupted = true
+	id := t.id
+	p.mu.Unlock()
+	go func() {
+		ctx, cancel := context.WithTimeout(p.ctx, p.opts.GracePeriod)
+		defer cancel()
+		_ = p.conn.Call(ctx, MethodTurnInterrupt, turnInterruptParams{ThreadID: p.threadID, TurnID: id}, nil)
+	}()
+}
+
+// activeTurn returns the in-flight turn if it can be steered.
+func (p *process) activeTurn() *turnState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.turn == nil || p.turn.interrupted {
+		return nil
+	}
+	return p.turn
+}
+
+// currentTurn returns the in-flight turn, interrupted or not.
+func (p *process) currentTurn() *turnState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.turn
+}
+
+// terminated reports whether the process is stopping or has ended.
+func (p *process) terminated() bool {
+	if p.stopping.Load() {
+		return true
+	}
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// --- Turn notifications ---
+
+// handleTurnCompleted ends the in-flight turn: emits MessageError for failed
+// turns, then MessageResult with the turn's usage and denials. Runs on ReadLoop.
+func (p *process) handleTurnCompleted(params json.RawMessage) {
+	var n turnNotification
+	if err := json.Unmarshal(params, &n); err != nil {
+		p.emit(*unmarshalError(MethodTurnCompleted, err))
+		return
+	}
+	p.mu.Lock()
+	t := p.turn
+	if t == nil || (t.id != "" && t.id != n.Turn.ID) {
+		p.mu.Unlock()
+		return // not ours (e.g., a turn whose start we abandoned)
+	}
+	p.turn = nil
+	usage, denials := t.usage, t.denials
+	p.mu.Unlock()
+
+	if n.Turn.Status == turnFailed && n.Turn.Error != nil {
+		p.emit(*errorMessage(n.Turn.Error))
+	}
+	p.emit(agentrun.Message{
+		Type:       agentrun.MessageResult,
+		StopReason: stopReason(n.Turn.Status),
+		Usage:      usage,
+		Denials:    denials,
+		Timestamp:  time.Now(),
+	})
+	close(t.done)
+}
+
+// stopReason maps a turn status to a StopReason. Completed turns end the
+// turn normally; other statuses pass through sanitized.
+func stopReason(status string) agentrun.StopReason {
+	if status == turnCompleted {
+		return agentrun.StopEndTurn
+	}
+	return stoputil.Sanitize(status)
+}
+
+// handleTokenUsage records the latest turn usage and emits
+// MessageContextWindow when the model's window is known. Runs on ReadLoop.
+func (p *process) handleTokenUsage(params json.RawMessage) {
+	var n tokenUsageNotification
+	if err := json.Unmarshal(params, &n); err != nil {
+		p.emit(*unmarshalError(MethodTokenUsage, err))
+		return
+	}
+	last := n.TokenUsage.Last
+	p.mu.Lock()
+	if p.turn != nil {
+		p.turn.usage = &agentrun.Usage{
+			InputTokens:     last.InputTokens,
+			OutputTokens:    last.OutputTokens,
+			CacheReadTokens: last.CachedInputTokens,
+			ThinkingTokens:  last.ReasoningOutputTokens,
+		}
+	}
+	p.mu.Unlock()
+
+	if size := n.TokenUsage.ModelContextWindow; size > 0 {
+		p.emit(agentrun.Message{
+			Type:      agentrun.MessageContextWindow,
+			Usage:     &agentrun.Usage{ContextSizeTokens: size, ContextUsedTokens: last.TotalTokens},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// --- Approvals ---
+
+// approvalHandler returns the method handler for one approval kind.
+// HITL off accepts everything. Otherwise the ApprovalHandler decides;
+// without one, requests are declined. Declines are recorded as denials on
+// the in-flight turn. Handler errors decline without recording a denial.
+// Runs in its own goroutine (jsonrpc.Conn dispatches requests async).
+func (p *process) approvalHandler(kind string) jsonrpc.MethodHandler {
+	return func(params json.RawMessage) (any, error) {
+		var req approvalParams
+		if err := json.Unmarshal(params, &req); err != nil {
+			p.emit(*unmarshalError(kind+" approval", err))
+			return approvalResult{Decision: decisionDecline}, nil
+		}
+		if p.hitl == agentrun.HITLOff {
+			return approvalResult{Decision: decisionAccept}, nil
+		}
+		if p.opts.ApprovalHandler == nil {
+			p.addDenial(kind, "no approval handler")
+			return approvalResult{Decision: decisionDecline}, nil
+		}
+
+		ctx, cancel := context.WithTimeout(p.ctx, p.opts.ApprovalTimeout)
+		defer cancel()
+		approved, err := safeCallApprovalHandler(ctx, p.opts.ApprovalHandler, ApprovalRequest{
+			ThreadID: req.ThreadID,
+			TurnID:   req.TurnID,
+			ItemID:   req.ItemID,
+			Kind:     kind,
+			Command:  req.Command,
+			CWD:      req.CWD,
+			Reason:   req.Reason,
+		})
+		if err != nil {
+			p.emit(agentrun.Message{
+				Type:      agentrun.MessageError,
+				Content:   errfmt.Truncate(fmt.Sprintf("codex app-server: approval handler error: %v", err)),
+				Timestamp: time.Now(),
+			})
+			return approvalResult{Decision: decisionDecline}, nil
+		}
+		if approved {
+			return approvalResult{Decision: decisionAccept}, nil
+		}
+		p.addDenial(kind, "denied by handler")
+		return approvalResult{Decision: decisionDecline}, nil
+	}
+}
+
+// addDenial records a declined approval on the in-flight turn, if any.
+func (p *process) addDenial(tool, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.turn == nil {
+		return
+	}
+	p.turn.denials = append(p.turn.denials, agentrun.PermissionDenial{
+		Tool:   errfmt.SanitizeCode(tool),
+		Reason: errfmt.Truncate(reason),
+	})
+}
+
+// safeCallApprovalHandler calls h with panic recovery.
+func safeCallApprovalHandler(ctx context.Context, h ApprovalHandler, req ApprovalRequest) (approved bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("approval handler panic: %v", r)
+		}
+	}()
+	return h(ctx, req)
+}
+
+// --- Handshake ---
+
+// handshake performs initialize + initialized + thread/start (or
+// thread/resume for OptionResumeID) and emits MessageInit.
+func (p *process) handshake(ctx context.Context) error {
+	var initResult initializeResult
+	params := initializeParams{ClientInfo: clientInfo{Name: clientName, Version: clientVersion}}
+	if err := p.conn.Call(ctx, MethodInitialize, params, &initResult); err != nil {
+		return fmt.Errorf("codex app-server: initialize: %w", err)
+	}
+	if err := p.conn.Notify(MethodInitialized, nil); err != nil {
+		return fmt.Errorf("codex app-server: initialized: %w", err)
+	}
+
+	var result threadResult
+	if resumeID := p.session.Options[agentrun.OptionResumeID]; resumeID != "" {
+		resume := threadResumeParams{ThreadID: resumeID, threadStartParams: threadParams(p.session)}
+		if err := p.conn.Call(ctx, MethodThreadResume, resume, &result); err != nil {
+			return fmt.Errorf("%w: thread/resume: %w", agentrun.ErrSessionNotFound, err)
+		}
+	} else if err := p.conn.Call(ctx, MethodThreadStart, threadParams(p.session), &result); err != nil {
+		return fmt.Errorf("codex app-server: thread/start: %w", err)
+	}
+	if result.Thread.ID == "" {
+		return errors.New("codex app-server: thread response has no thread id")
+	}
+	p.threadID = result.Thread.ID
+
+	p.emit(agentrun.Message{
+		Type:      agentrun.MessageInit,
+		ResumeID:  p.threadID,
+		Init:      buildInitMeta(initResult.UserAgent, result.Model),
+		Process:   p.processMetaSnapshot(),
+		Timestamp: time.Now(),
+	})
+	return nil
+}
+
+// processMetaSnapshot returns subprocess metadata for MessageInit enrichment.
+// Returns nil if cmd or its process is unavailable.
+func (p *process) processMetaSnapshot() *agentrun.ProcessMeta {
+	if p.cmd == nil || p.cmd.Process == nil || p.cmd.Process.Pid <= 0 {
+		return nil
+	}
+	return &agentrun.ProcessMeta{
+		PID:    p.cmd.Process.Pid,
+		Binary: p.cmd.Path,
+	}
+}
+
+// --- Lifecycle ---
+
+// Stop terminates the app-server. Safe to call multiple times.
+func (p *process) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		p.stopping.Store(true)
+
+		// Close stdin to signal EOF; the app-server exits on it.
+		if p.stdin != nil {
+			_ = p.stdin.Close()
+		}
+
+		// Cancel process context to unblock emit().
+		p.cancel()
+
+		// SIGTERM → grace → SIGKILL.
+		_ = procutil.Signal(p.cmd.Process, syscall.SIGTERM)
+
+		select {
+		case <-p.done:
+		case <-time.After(p.opts.GracePeriod):
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
+			<-p.done
+		case <-ctx.Done():
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
+			<-p.done
+		}
+	})
+
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends naturally.
+func (p *process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// emit sends a message to the output channel. Blocks until delivered,
+// context is cancelled, or the channel is marked closed by finish().
+// See the acp engine's emit for the locking rationale.
+func (p *process) emit(msg agentrun.Message) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+	if p.outputClosed {
+		return
+	}
+	select {
+	case p.output <- msg:
+	case <-p.ctx.Done():
+	}
+}
+
+// finish sets the terminal error and closes done+output channels.
+// done closes before output so Err() is valid once a consumer's range
+// over Output() exits.
+func (p *process) finish(err error) {
+	p.finishOnce.Do(func() {
+		if p.stopping.Load() {
+			err = agentrun.ErrTerminated
+		}
+		p.termErr = err
+		p.cancel() // unblock any emit() blocked in select
+
+		close(p.done)
+
+		p.outputMu.Lock()
+		p.outputClosed = true
+		close(p.output)
+		p.outputMu.Unlock()
+	})
+}
+
+// kill forcefully terminates the subprocess and waits for the ReadLoop
+// goroutine to call finish().
+func (p *process) kill() {
+	p.stopping.Store(true)
+	p.cancel()
+	_ = procutil.Signal(p.cmd.Process, os.Kill)
+	<-p.done
+}
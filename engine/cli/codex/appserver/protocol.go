@@ -0,0 +1,221 @@
+package appserver
+
+import "encoding/json"
+
+// Codex app-server JSON-RPC method names.
+const (
+	// Client → server requests.
+	MethodInitialize    = "initialize"
+	MethodThreadStart   = "thread/start"
+	MethodThreadResume  = "thread/resume"
+	MethodTurnStart     = "turn/start"
+	MethodTurnSteer     = "turn/steer"
+	MethodTurnInterrupt = "turn/interrupt"
+
+	// Client → server notifications.
+	MethodInitialized = "initialized"
+
+	// Server → client requests (approvals).
+	MethodCommandApproval    = "item/commandExecution/requestApproval"
+	MethodFileChangeApproval = "item/fileChange/requestApproval"
+
+	// Server → client notifications.
+	MethodTurnStarted      = "turn/started"
+	MethodTurnCompleted    = "turn/completed"
+	MethodItemStarted      = "item/started"
+	MethodItemCompleted    = "item/completed"
+	MethodAgentDelta       = "item/agentMessage/delta"
+	MethodReasoningDelta   = "item/reasoning/textDelta"
+	MethodSummaryDelta     = "item/reasoning/summaryTextDelta"
+	MethodTokenUsage       = "thread/tokenUsage/updated"
+	MethodError            = "error"
+	MethodThreadStarted    = "thread/started"
+	MethodCommandOutput    = "item/commandExecution/outputDelta"
+	MethodFileChangeOutput = "item/fileChange/outputDelta"
+	MethodRateLimits       = "account/rateLimits/updated"
+)
+
+// Client identity sent in initialize.
+const (
+	clientName    = "agentrun"
+	clientVersion = "0.1.0"
+)
+
+// Turn status values reported in turn/completed.
+const (
+	turnCompleted   = "completed"
+	turnInterrupted = "interrupted"
+	turnFailed      = "failed"
+)
+
+// Approval decisions returned for approval requests.
+const (
+	decisionAccept  = "accept"
+	decisionDecline = "decline"
+)
+
+// Approval policies sent in thread/start.
+const (
+	approvalNever     = "never"
+	approvalOnRequest = "on-request"
+)
+
+// --- Handshake ---
+
+type clientInfo struct {
+	Name    string `json:"name"`
+	Title   string `json:"title,omitempty"`
+	Version string `json:"version"`
+}
+
+type initializeParams struct {
+	ClientInfo clientInfo `json:"clientInfo"`
+}
+
+type initializeResult struct {
+	UserAgent string `json:"userAgent"`
+}
+
+// --- Threads ---
+
+type threadStartParams struct {
+	Model          string `json:"model,omitempty"`
+	CWD            string `json:"cwd,omitempty"`
+	ApprovalPolicy string `json:"approvalPolicy,omitempty"`
+	Sandbox        string `json:"sandbox,omitempty"`
+}
+
+type threadResumeParams struct {
+	ThreadID string `json:"threadId"`
+	threadStartParams
+}
+
+type thread struct {
+	ID string `json:"id"`
+}
+
+type threadResult struct {
+	Thread thread `json:"thread"`
+	Model  string `json:"model,omitempty"`
+}
+
+// --- Turns ---
+
+type userInput struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type turnStartParams struct {
+	ThreadID string      `json:"threadId"`
+	Input    []userInput `json:"input"`
+	Effort   string      `json:"effort,omitempty"`
+}
+
+type turnSteerParams struct {
+	ThreadID       string      `json:"threadId"`
+	Input          []userInput `json:"input"`
+	ExpectedTurnID string      `json:"expectedTurnId"`
+}
+
+type turnInterruptParams struct {
+	ThreadID string `json:"threadId"`
+	TurnID   string `json:"turnId"`
+}
+
+type turnError struct {
+	Message        string          `json:"message"`
+	CodexErrorInfo json.RawMessage `json:"codexErrorInfo,omitempty"`
+}
+
+type turn struct {
+	ID     string     `json:"id"`
+	Status string     `json:"status"`
+	Error  *turnError `json:"error,omitempty"`
+}
+
+type turnResult struct {
+	Turn turn `json:"turn"`
+}
+
+type turnNotification struct {
+	ThreadID string `json:"threadId"`
+	Turn     turn   `json:"turn"`
+}
+
+// --- Items ---
+
+type itemNotification struct {
+	ThreadID string          `json:"threadId"`
+	TurnID   string          `json:"turnId"`
+	Item     json.RawMessage `json:"item"`
+}
+
+type deltaNotification struct {
+	ThreadID string `json:"threadId"`
+	TurnID   string `json:"turnId"`
+	ItemID   string `json:"itemId"`
+	Delta    string `json:"delta"`
+}
+
+// --- Usage ---
+
+type tokenBreakdown struct {
+	InputTokens           int `json:"inputTokens"`
+	CachedInputTokens     int `json:"cachedInputTokens"`
+	OutputTokens          int `json:"outputTokens"`
+	ReasoningOutputTokens int `json:"reasoningOutputTokens"`
+	TotalTokens           int `json:"totalTokens"`
+}
+
+type tokenUsage struct {
+	Total              tokenBreakdown `json:"total"`
+	Last               tokenBreakdown `json:"last"`
+	ModelContextWindow int            `json:"modelContextWindow,omitempty"`
+}
+
+type tokenUsageNotification struct {
+	ThreadID   string     `json:"threadId"`
+	TurnID     string     `json:"turnId"`
+	TokenUsage tokenUsage `json:"tokenUsage"`
+}
+
+// --- Rate limits ---
+
+// rateLimitWindow is one usage window; UsedPercent is 0–100 and ResetsAt
+// is Unix seconds.
+type rateLimitWindow struct {
+	UsedPercent float64 `json:"usedPercent"`
+	ResetsAt    *int64  `json:"resetsAt"`
+}
+
+type rateLimitSnapshot struct {
+	Primary   *rateLimitWindow `json:"primary"`
+	Secondary *rateLimitWindow `json:"secondary"`
+}
+
+type rateLimitsNotification struct {
+	RateLimits rateLimitSnapshot `json:"rateLimits"`
+}
+
+// --- Errors ---
+
+type errorNotification struct {
+	Error     turnError `json:"error"`
+	WillRetry bool      `json:"willRetry"`
+}
+
+// --- Approvals ---
+
+type approvalParams struct {
+	ThreadID string `json:"threadId"`
+	TurnID   string `json:"turnId"`
+	ItemID   string `json:"itemId"`
+	Command  string `json:"command,omitempty"`
+	CWD      string `json:"cwd,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type approvalResult struct {
+	Decision string `json:"decision"`
+}
@@ -0,0 +1,104 @@
+// session.go maps agentrun.Session options onto app-server parameters.
+
+package appserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/codex"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/cli/internal/optutil"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+)
+
+// validateSession checks CWD and the mode, HITL, sandbox and effort options.
+func validateSession(session agentrun.Session) error {
+	if session.CWD != "" && !filepath.IsAbs(session.CWD) {
+		return fmt.Errorf("codex app-server: CWD must be an absolute path, got %q", session.CWD)
+	}
+	if err := optutil.ValidateModeHITL("codex app-server", session.Options); err != nil {
+		return err
+	}
+	if err := optutil.ValidateEffort("codex app-server", session.Options); err != nil {
+		return err
+	}
+	if optutil.RootOptionsSet(session.Options) {
+		return nil
+	}
+	if s := codex.Sandbox(session.Options[codex.OptionSandbox]); s != "" && !validSandbox(s) {
+		return fmt.Errorf("codex app-server: unknown sandbox %q: valid: read-only, workspace-write, danger-full-access", s)
+	}
+	return nil
+}
+
+// validSandbox reports whether s is a recognized sandbox value.
+func validSandbox(s codex.Sandbox) bool {
+	switch s {
+	case codex.SandboxReadOnly, codex.SandboxWorkspaceWrite, codex.SandboxFullAccess:
+		return true
+	default:
+		return false
+	}
+}
+
+// threadParams maps the session to thread/start (and thread/resume) params.
+//
+// Root options and codex.OptionSandbox are independent control surfaces,
+// as in the exec backend: when OptionMode or OptionHITL is set,
+// OptionSandbox is ignored. ModePlan always wins with a read-only sandbox.
+// HITLOff maps to approvalPolicy "never" (the app-server equivalent of
+// --full-auto); otherwise approvals are requested on demand and answered
+// by the ApprovalHandler.
+func threadParams(session agentrun.Session) threadStartParams {
+	params := threadStartParams{CWD: session.CWD}
+	if m := session.Model; m != "" && !jsonutil.ContainsNull(m) {
+		params.Model = m
+	}
+
+	opts := session.Options
+	if !optutil.RootOptionsSet(opts) {
+		params.Sandbox = string(codex.Sandbox(opts[codex.OptionSandbox]))
+		return params
+	}
+
+	params.ApprovalPolicy = approvalOnRequest
+	switch {
+	case agentrun.Mode(opts[agentrun.OptionMode]) == agentrun.ModePlan:
+		params.Sandbox = string(codex.SandboxReadOnly)
+	case agentrun.HITL(opts[agentrun.OptionHITL]) == agentrun.HITLOff:
+		params.Sandbox = string(codex.SandboxWorkspaceWrite)
+	}
+	if agentrun.HITL(opts[agentrun.OptionHITL]) == agentrun.HITLOff {
+		params.ApprovalPolicy = approvalNever
+	}
+	return params
+}
+
+// codexEffort maps root Effort values to Codex reasoning effort values.
+// Mirrors the exec backend's mapping (max → "xhigh").
+var codexEffort = map[agentrun.Effort]string{
+	agentrun.EffortLow:    "low",
+	agentrun.EffortMedium: "medium",
+	agentrun.EffortHigh:   "high",
+	agentrun.EffortMax:    "xhigh",
+}
+
+// buildInitMeta constructs InitMeta from the initialize userAgent
+// ("codex_cli_rs/0.50.0 (...)") and the thread's model.
+// Returns nil when no meaningful data is available (nil-guard contract).
+func buildInitMeta(userAgent, model string) *agentrun.InitMeta {
+	var meta agentrun.InitMeta
+	if product, _, _ := strings.Cut(userAgent, " "); product != "" {
+		name, version, _ := strings.Cut(product, "/")
+		meta.AgentName = errfmt.SanitizeCode(name)
+		meta.AgentVersion = errfmt.SanitizeCode(version)
+	}
+	meta.Model = errfmt.SanitizeCode(model)
+	if meta.Model == "" && meta.AgentName == "" && meta.AgentVersion == "" {
+		return nil
+	}
+	return &meta
+}
@@ -0,0 +1,209 @@
+//go:build ignore
+
+// Command mock-app-server simulates "codex app-server" for integration tests.
+// It speaks the header-less JSON-RPC variant (no "jsonrpc" member) over
+// stdin/stdout: initialize, initialized, thread/start, thread/resume,
+// turn/start, turn/steer, turn/interrupt.
+//
+// Environment variables control behavior:
+//
+//	CODEX_MOCK_MODE=approval   — request command approval during the turn and
+//	                             report the decision in the agent message
+//	CODEX_MOCK_MODE=slow       — keep the turn open until steered or interrupted
+//	CODEX_MOCK_MODE=failed     — complete the turn with status "failed"
+//	CODEX_MOCK_MODE=init-error — return a JSON-RPC error to initialize
+//
+// thread/resume fails for any thread ID other than "thr-existing".
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strconv"
+)
+
+type rpcMessage struct {
+	ID     *int64          `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var (
+	enc           = json.NewEncoder(os.Stdout)
+	scanner       = bufio.NewScanner(os.Stdin)
+	mode          = os.Getenv("CODEX_MOCK_MODE")
+	nextID  int64 = 100
+	turnSeq int
+	turnID  string // open turn in slow mode
+)
+
+func main() {
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		handle(&msg)
+	}
+}
+
+func handle(msg *rpcMessage) {
+	switch msg.Method {
+	case "initialize":
+		if mode == "init-error" {
+			respondError(msg.ID, -32600, "mock init error")
+			return
+		}
+		respond(msg.ID, map[string]any{"userAgent": "mock_codex/1.2.3 (test)"})
+	case "thread/start":
+		respond(msg.ID, map[string]any{"thread": map[string]any{"id": "thr-new"}, "model": "mock-model"})
+	case "thread/resume":
+		handleResume(msg)
+	case "turn/start":
+		handleTurnStart(msg)
+	case "turn/steer":
+		handleSteer(msg)
+	case "turn/interrupt":
+		respond(msg.ID, map[string]any{})
+		completeTurn(turnID, "interrupted", nil)
+		turnID = ""
+	}
+}
+
+func handleResume(msg *rpcMessage) {
+	var p struct {
+		ThreadID string `json:"threadId"`
+	}
+	_ = json.Unmarshal(msg.Params, &p)
+	if p.ThreadID != "thr-existing" {
+		respondError(msg.ID, -32600, "thread not found")
+		return
+	}
+	respond(msg.ID, map[string]any{"thread": map[string]any{"id": p.ThreadID}, "model": "mock-model"})
+}
+
+func handleTurnStart(msg *rpcMessage) {
+	turnSeq++
+	id := "turn-" + strconv.Itoa(turnSeq)
+	respond(msg.ID, map[string]any{"turn": map[string]any{"id": id, "status": "inProgress"}})
+	notify("turn/started", map[string]any{"threadId": "thr", "turn": map[string]any{"id": id, "status": "inProgress"}})
+
+	switch mode {
+	case "slow":
+		turnID = id
+		return
+	case "failed":
+		completeTurn(id, "failed", map[string]any{"message": "model exploded", "codexErrorInfo": "internalServerError"})
+		return
+	case "approval":
+		decision := requestApproval(id)
+		agentMessage(id, "decision="+decision)
+		completeTurn(id, "completed", nil)
+		return
+	}
+
+	notify("item/started", item(id, map[string]any{"type": "commandExecution", "id": "cmd-1", "command": "ls"}))
+	notify("item/completed", item(id, map[string]any{"type": "commandExecution", "id": "cmd-1", "command": "ls", "exitCode": 0}))
+	notify("item/reasoning/summaryTextDelta", delta(id, "thinking..."))
+	notify("item/agentMessage/delta", delta(id, "Hello "))
+	notify("item/agentMessage/delta", delta(id, "world"))
+	agentMessage(id, "Hello world")
+	notify("thread/tokenUsage/updated", map[string]any{
+		"threadId": "thr", "turnId": id,
+		"tokenUsage": map[string]any{
+			"total":              map[string]any{"inputTokens": 10, "outputTokens": 5, "totalTokens": 15},
+			"last":               map[string]any{"inputTokens": 10, "cachedInputTokens": 2, "outputTokens": 5, "reasoningOutputTokens": 1, "totalTokens": 15},
+			"modelContextWindow": 1000,
+		},
+	})
+	completeTurn(id, "completed", nil)
+}
+
+func handleSteer(msg *rpcMessage) {
+	var p struct {
+		Input []struct {
+			Text string `json:"text"`
+		} `json:"input"`
+		ExpectedTurnID string `json:"expectedTurnId"`
+	}
+	_ = json.Unmarshal(msg.Params, &p)
+	if turnID == "" || p.ExpectedTurnID != turnID {
+		respondError(msg.ID, -32600, "no active turn")
+		return
+	}
+	respond(msg.ID, map[string]any{"turnId": turnID})
+	text := ""
+	if len(p.Input) > 0 {
+		text = p.Input[0].Text
+	}
+	agentMessage(turnID, "steered: "+text)
+	completeTurn(turnID, "completed", nil)
+	turnID = ""
+}
+
+// requestApproval sends a command approval request and reads stdin until
+// its response arrives. Returns the decision.
+func requestApproval(turn string) string {
+	id := nextID
+	nextID++
+	_ = enc.Encode(map[string]any{
+		"id":     id,
+		"method": "item/commandExecution/requestApproval",
+		"params": map[string]any{"threadId": "thr", "turnId": turn, "itemId": "cmd-1", "command": "rm -rf /tmp/x", "cwd": "/tmp"},
+	})
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == nil || *msg.ID != id || msg.Method != "" {
+			continue
+		}
+		var r struct {
+			Decision string `json:"decision"`
+		}
+		_ = json.Unmarshal(msg.Result, &r)
+		return r.Decision
+	}
+	return ""
+}
+
+func agentMessage(turn, text string) {
+	notify("item/completed", item(turn, map[string]any{"type": "agentMessage", "id": "msg-" + turn, "text": text}))
+}
+
+func completeTurn(id, status string, turnErr map[string]any) {
+	t := map[string]any{"id": id, "status": status}
+	if turnErr != nil {
+		t["error"] = turnErr
+	}
+	notify("turn/completed", map[string]any{"threadId": "thr", "turn": t})
+}
+
+func item(turn string, it map[string]any) map[string]any {
+	return map[string]any{"threadId": "thr", "turnId": turn, "item": it}
+}
+
+func delta(turn, text string) map[string]any {
+	return map[string]any{"threadId": "thr", "turnId": turn, "itemId": "msg-" + turn, "delta": text}
+}
+
+func respond(id *int64, result any) {
+	data, _ := json.Marshal(result)
+	_ = enc.Encode(rpcMessage{ID: id, Result: data})
+}
+
+func respondError(id *int64, code int, message string) {
+	_ = enc.Encode(rpcMessage{ID: id, Error: &rpcError{Code: code, Message: message}})
+}
+
+func notify(method string, params any) {
+	data, _ := json.Marshal(params)
+	_ = enc.Encode(rpcMessage{Method: method, Params: data})
+}
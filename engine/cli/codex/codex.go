@@ -79,11 +79,14 @@ var noUUIDSentinel = "\x00"
 // cli.InputFormatter). Multi-turn conversation uses resume-per-turn:
 // each Send() spawns a new subprocess via "codex exec resume".
 //
-// One Backend instance per session. The thread ID is auto-captured
-// from the first thread.started event via atomic write-once.
+// The thread ID is auto-captured from the first thread.started event via
+// atomic write-once. It is per-session state: cli.Engine runs each
+// session on a Fork (cli.Forker), so one Engine can run concurrent
+// sessions.
 type Backend struct {
 	binary   string
 	threadID atomic.Pointer[string] // write-once from thread.started
+	progress itemProgress           // streamed text per in-flight item
 }
 
 // Compile-time interface satisfaction checks.
@@ -92,6 +95,7 @@ var (
 	_ cli.Spawner = (*Backend)(nil)
 	_ cli.Parser  = (*Backend)(nil)
 	_ cli.Resumer = (*Backend)(nil)
+	_ cli.Forker  = (*Backend)(nil)
 )
 
 // Option configures a Backend at construction time.
@@ -117,6 +121,12 @@ func New(opts ...Option) *Backend {
 	return b
 }
 
+// Fork returns a Backend with the same configuration and no captured
+// thread ID or item progress, for one session. cli.Engine forks on every Start.
+func (b *Backend) Fork() cli.Backend {
+	return &Backend{binary: b.binary}
+}
+
 // SpawnArgs builds exec.Cmd arguments for a new Codex session.
 // When OptionResumeID is set, produces "exec resume" subcommand.
 // Invalid option values are silently skipped per the Spawner contract.
@@ -164,8 +174,13 @@ func (b *Backend) ResumeArgs(session agentrun.Session, initialPrompt string) (st
 	return b.binary, args, nil
 }
 
-// ThreadID returns the auto-captured thread ID, or empty string if not yet
-// captured or if only a non-UUID sentinel was stored.
+// ThreadID returns the thread ID captured by this Backend's ParseLine,
+// or empty string if not yet captured or if only a non-UUID sentinel was
+// stored.
+//
+// Deprecated: cli.Engine runs each session on a Fork of the Backend, so
+// on the Backend passed to cli.NewEngine this always returns "". Read the
+// thread ID from MessageInit.ResumeID instead.
 func (b *Backend) ThreadID() string {
 	if p := b.threadID.Load(); p != nil && *p != noUUIDSentinel {
 		return *p
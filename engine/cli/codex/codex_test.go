@@ -805,6 +805,28 @@ func TestThreadID_AfterStore(t *testing.T) {
 	}
 }
 
+func TestFork_IsolatesThreadID(t *testing.T) {
+	b := New(WithBinary("/opt/codex"))
+	tid := testThreadID
+	b.threadID.CompareAndSwap(nil, &tid)
+
+	f, ok := b.Fork().(*Backend)
+	if !ok {
+		t.Fatalf("Fork() type = %T, want *Backend", b.Fork())
+	}
+	if f.binary != "/opt/codex" {
+		t.Errorf("fork binary = %q, want %q", f.binary, "/opt/codex")
+	}
+	if id := f.ThreadID(); id != "" {
+		t.Errorf("fork ThreadID() = %q, want empty", id)
+	}
+	other := "other-thread"
+	f.threadID.CompareAndSwap(nil, &other)
+	if id := b.ThreadID(); id != tid {
+		t.Errorf("original ThreadID() = %q, want %q", id, tid)
+	}
+}
+
 // --- resolveThreadID precedence ---
 
 func TestResolveThreadID_Precedence(t *testing.T) {
@@ -8,11 +8,12 @@
 //
 // # Resume-per-turn pattern
 //
-// Codex's exec command is single-shot: provide a message, get a
-// response, process exits. For multi-turn, each Send() spawns a new
-// process via "codex exec resume --json <thread_id> <prompt>".
-// The thread ID is auto-captured from the first thread.started event
-// and stored in the Backend (one instance per session).
+// Codex's exec command is single-shot: provide a message, get a response,
+// process exits. For multi-turn, each Send() spawns a new process via
+// "codex exec resume --json <thread_id> <prompt>". The thread ID is
+// auto-captured from the first thread.started event and stored in the
+// session's Backend fork (cli.Forker), so one Engine can run concurrent
+// sessions.
 //
 // Callers relying on auto-capture must wait for MessageInit before
 // calling Send, or supply OptionResumeID upfront.
@@ -46,15 +47,24 @@
 // # Event types
 //
 // Codex exec emits JSONL events with a top-level "type" field:
-// thread.started, turn.started, item.started, item.completed,
-// turn.completed, turn.failed, error.
+// thread.started, turn.started, item.started, item.updated,
+// item.completed, turn.completed, turn.failed, error.
 //
-// item.completed contains a nested "item" object with its own "type":
+// Item events contain a nested "item" object with its own "type":
 // agent_message, reasoning, command_execution, error, file_changes,
-// web_search, mcp_tool_call.
-//
-// Unlike Claude, Codex emits complete blocks (no streaming deltas)
-// and events lack a timestamp field (engine auto-sets via time.Now).
+// web_search, mcp_tool_call, todo_list.
+//
+// item.started and item.updated report live progress. Codex sends full
+// text snapshots; agent_message and reasoning snapshots are converted to
+// MessageTextDelta and MessageThinkingDelta carrying only the new text.
+// Tool items (command_execution, file_changes, web_search, mcp_tool_call,
+// todo_list) become MessageToolUse with the in-progress item as
+// Tool.Output; its "status" is "in_progress". Command output then
+// streams as MessageToolUseDelta carrying only the "aggregated_output"
+// added since the previous update. item.completed then emits the complete
+// MessageText, MessageThinking or MessageToolResult.
+//
+// Events lack a timestamp field (engine auto-sets via time.Now).
 //
 // # Minimum tested version
 //
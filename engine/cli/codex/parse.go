@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/cli"
 	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
 	"github.com/dmora/agentrun/engine/internal/errfmt"
 )
 
@@ -27,8 +29,8 @@ func isUUID(s string) bool {
 type eventParser func(raw map[string]any, msg *agentrun.Message)
 
 // eventParsers dispatches Codex event types to their parser functions.
-// thread.started is handled inline (needs Backend state for threadID CAS).
-// turn.started and item.started produce no message (ErrSkipLine).
+// thread.started, turn.started, item.started and item.updated are handled
+// inline (they need Backend state).
 var eventParsers = map[string]eventParser{
 	"item.completed": parseItemCompleted,
 	"turn.completed": parseTurnCompleted,
@@ -48,10 +50,24 @@ var itemParsers = map[string]itemParser{
 	"file_changes":      parseGenericTool("file_changes"),
 	"web_search":        parseGenericTool("web_search"),
 	"mcp_tool_call":     parseMCPToolCall,
+	"todo_list":         parseGenericTool("todo_list"),
+}
+
+// progressParsers dispatches tool item types within item.started and
+// item.updated events. Each produces MessageToolUse whose Tool.Output is
+// the in-progress item snapshot (status, todo items). Commands are
+// handled by Backend.parseCommandProgress, which tracks their output.
+var progressParsers = map[string]itemParser{
+	"file_changes":  parseToolProgress("file_changes"),
+	"web_search":    parseToolProgress("web_search"),
+	"mcp_tool_call": parseMCPToolProgress,
+	"todo_list":     parseToolProgress("todo_list"),
 }
 
 // ParseLine parses a single JSONL output line from codex exec into a Message.
-// Returns cli.ErrSkipLine for blank lines and no-op events (turn.started, item.started).
+// Returns cli.ErrSkipLine for blank lines, turn.started, and progress
+// events that carry nothing new (e.g., an agent_message update with no
+// additional text).
 func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
 	if strings.TrimSpace(line) == "" {
 		return agentrun.Message{}, cli.ErrSkipLine
@@ -77,9 +93,18 @@ func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
 		return msg, nil
 	}
 
-	// No-op events.
-	if typeStr == "turn.started" || typeStr == "item.started" {
+	switch typeStr {
+	case "turn.started":
+		// Item IDs restart with every exec process; drop stale progress.
+		b.progress.reset()
 		return agentrun.Message{}, cli.ErrSkipLine
+	case "item.started", "item.updated":
+		if err := b.parseItemProgress(raw, &msg); err != nil {
+			return agentrun.Message{}, err
+		}
+		return msg, nil
+	case "item.completed":
+		b.progress.done(jsonutil.GetString(jsonutil.GetMap(raw, "item"), "id"))
 	}
 
 	if parser, ok := eventParsers[typeStr]; ok {
@@ -126,6 +151,84 @@ func (b *Backend) parseThreadStarted(raw map[string]any, msg *agentrun.Message)
 	}
 }
 
+// parseItemProgress handles item.started and item.updated. Agent messages
+// and reasoning become MessageTextDelta and MessageThinkingDelta carrying
+// the text added since the previous event for the item; commands go to
+// parseCommandProgress; other tool items become MessageToolUse via
+// progressParsers. Other items are skipped — they are reported once
+// complete.
+func (b *Backend) parseItemProgress(raw map[string]any, msg *agentrun.Message) error {
+	item := jsonutil.GetMap(raw, "item")
+	if item == nil {
+		return cli.ErrSkipLine
+	}
+
+	itemType := jsonutil.GetString(item, "type")
+	switch itemType {
+	case "agent_message", "reasoning":
+		delta := b.progress.delta(jsonutil.GetString(item, "id"), jsonutil.GetString(item, "text"))
+		if delta == "" {
+			return cli.ErrSkipLine
+		}
+		msg.Type = agentrun.MessageTextDelta
+		if itemType == "reasoning" {
+			msg.Type = agentrun.MessageThinkingDelta
+		}
+		msg.Content = delta
+		return nil
+	case "command_execution":
+		return b.parseCommandProgress(jsonutil.GetString(raw, "type") == "item.started", item, msg)
+	}
+
+	if parser, ok := progressParsers[itemType]; ok {
+		parser(item, msg)
+		return nil
+	}
+	return cli.ErrSkipLine
+}
+
+// itemProgress tracks how much of each in-flight item's text has been
+// emitted as deltas. Codex reports full text snapshots; the difference
+// from the previous snapshot becomes the delta.
+type itemProgress struct {
+	mu      sync.Mutex
+	emitted map[string]int // item ID → bytes of text already emitted
+}
+
+// delta returns the text added since the previous snapshot of item id.
+// Items without an ID are not tracked and return the full text. A snapshot
+// shorter than what was already emitted yields no delta.
+func (p *itemProgress) delta(id, text string) string {
+	if id == "" {
+		return text
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.emitted == nil {
+		p.emitted = make(map[string]int)
+	}
+	n := p.emitted[id]
+	p.emitted[id] = len(text)
+	if n >= len(text) {
+		return ""
+	}
+	return text[n:]
+}
+
+// done forgets item id once it has completed.
+func (p *itemProgress) done(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.emitted, id)
+}
+
+// reset forgets all in-flight items.
+func (p *itemProgress) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.emitted)
+}
+
 // parseItemCompleted delegates to inner itemParsers based on item.type.
 func parseItemCompleted(raw map[string]any, msg *agentrun.Message) {
 	item := jsonutil.GetMap(raw, "item")
@@ -181,6 +284,7 @@ func parseItemError(item map[string]any, msg *agentrun.Message) {
 		message = "unknown error"
 	}
 	msg.Content = errfmt.Truncate(message)
+	errcat.Apply(msg)
 }
 
 // parseGenericTool returns an itemParser that marshals the full item as Tool.Output.
@@ -211,6 +315,50 @@ func parseMCPToolCall(item map[string]any, msg *agentrun.Message) {
 	}
 }
 
+// parseCommandProgress handles in-flight command_execution. item.started
+// → MessageToolUse with Tool.Input = command string and Tool.Output = item
+// snapshot. item.updated → MessageToolUseDelta whose Content is the
+// aggregated_output added since the previous event for the item; updates
+// with no new output are skipped.
+func (b *Backend) parseCommandProgress(started bool, item map[string]any, msg *agentrun.Message) error {
+	delta := b.progress.delta(jsonutil.GetString(item, "id"), jsonutil.GetString(item, "aggregated_output"))
+	tool := &agentrun.ToolCall{
+		Name:  "command_execution",
+		Input: marshalString(jsonutil.GetString(item, "command")),
+	}
+	if started {
+		tool.Output = marshalItem(item)
+		msg.Type = agentrun.MessageToolUse
+		msg.Tool = tool
+		return nil
+	}
+	if delta == "" {
+		return cli.ErrSkipLine
+	}
+	msg.Type = agentrun.MessageToolUseDelta
+	msg.Content = delta
+	msg.Tool = tool
+	return nil
+}
+
+// parseToolProgress returns an itemParser for in-flight tool items that
+// marshals the item snapshot as Tool.Output.
+func parseToolProgress(name string) itemParser {
+	return func(item map[string]any, msg *agentrun.Message) {
+		msg.Type = agentrun.MessageToolUse
+		msg.Tool = &agentrun.ToolCall{
+			Name:   name,
+			Output: marshalItem(item),
+		}
+	}
+}
+
+// parseMCPToolProgress handles in-flight mcp_tool_call → MessageToolUse.
+func parseMCPToolProgress(item map[string]any, msg *agentrun.Message) {
+	parseMCPToolCall(item, msg)
+	msg.Type = agentrun.MessageToolUse
+}
+
 // parseTurnCompleted handles turn.completed → MessageResult with usage.
 func parseTurnCompleted(raw map[string]any, msg *agentrun.Message) {
 	msg.Type = agentrun.MessageResult
@@ -231,6 +379,7 @@ func parseTurnFailed(raw map[string]any, msg *agentrun.Message) {
 		message = "turn failed"
 	}
 	msg.Content = errfmt.Truncate(message)
+	errcat.Apply(msg)
 }
 
 // parseTopLevelError handles top-level "error" events.
@@ -242,6 +391,7 @@ func parseTopLevelError(raw map[string]any, msg *agentrun.Message) {
 		message = "unknown error"
 	}
 	msg.Content = errfmt.Truncate(message)
+	errcat.Apply(msg)
 }
 
 // parseUsage extracts token usage from turn.completed events.
@@ -3,6 +3,7 @@ package codex
 import (
 	"encoding/json"
 	"errors"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -138,6 +139,189 @@ func TestParseLine_ItemStarted(t *testing.T) {
 	}
 }
 
+// --- item.started / item.updated progress ---
+
+func TestParseLine_ItemStarted_Command(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"item.started","item":{"id":"item_1","type":"command_execution","command":"go test ./...","aggregated_output":"","status":"in_progress"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageToolUse {
+		t.Errorf("Type = %q, want %q", msg.Type, agentrun.MessageToolUse)
+	}
+	if msg.Tool == nil || msg.Tool.Name != "command_execution" {
+		t.Fatalf("Tool = %+v, want command_execution", msg.Tool)
+	}
+	if string(msg.Tool.Input) != `"go test ./..."` {
+		t.Errorf("Input = %s, want command string", msg.Tool.Input)
+	}
+	var output map[string]any
+	if err := json.Unmarshal(msg.Tool.Output, &output); err != nil {
+		t.Fatalf("unmarshal Output: %v", err)
+	}
+	if output["status"] != "in_progress" {
+		t.Errorf("Output.status = %v, want in_progress", output["status"])
+	}
+}
+
+func TestParseLine_ItemUpdated_CommandOutput(t *testing.T) {
+	b := New()
+	if _, err := b.ParseLine(`{"type":"item.started","item":{"id":"item_1","type":"command_execution","command":"make","aggregated_output":"","status":"in_progress"}}`); err != nil {
+		t.Fatalf("item.started: %v", err)
+	}
+	var deltas []string
+	for _, out := range []string{"building...", `building...\ndone`, `building...\ndone`} {
+		msg, err := b.ParseLine(`{"type":"item.updated","item":{"id":"item_1","type":"command_execution","command":"make","aggregated_output":"` + out + `","status":"in_progress"}}`)
+		if errors.Is(err, cli.ErrSkipLine) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if msg.Type != agentrun.MessageToolUseDelta {
+			t.Errorf("Type = %q, want %q", msg.Type, agentrun.MessageToolUseDelta)
+		}
+		if msg.Tool == nil || msg.Tool.Name != "command_execution" || string(msg.Tool.Input) != `"make"` {
+			t.Errorf("Tool = %+v, want the make command", msg.Tool)
+		}
+		deltas = append(deltas, msg.Content)
+	}
+	if want := []string{"building...", "\ndone"}; !slices.Equal(deltas, want) {
+		t.Errorf("deltas = %q, want %q", deltas, want)
+	}
+}
+
+func TestParseLine_ItemUpdated_TodoList(t *testing.T) {
+	b := New()
+	line := `{"type":"item.updated","item":{"id":"item_0","type":"todo_list","items":[{"text":"write parser","completed":true},{"text":"add tests","completed":false}]}}`
+	msg, err := b.ParseLine(line)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageToolUse {
+		t.Errorf("Type = %q, want %q", msg.Type, agentrun.MessageToolUse)
+	}
+	if msg.Tool == nil || msg.Tool.Name != "todo_list" {
+		t.Fatalf("Tool = %+v, want todo_list", msg.Tool)
+	}
+	var output struct {
+		Items []struct {
+			Text      string `json:"text"`
+			Completed bool   `json:"completed"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(msg.Tool.Output, &output); err != nil {
+		t.Fatalf("unmarshal Output: %v", err)
+	}
+	if len(output.Items) != 2 || !output.Items[0].Completed || output.Items[1].Text != "add tests" {
+		t.Errorf("Output.items = %+v", output.Items)
+	}
+}
+
+func TestParseLine_ItemProgress_MCPToolCall(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"item.started","item":{"id":"item_2","type":"mcp_tool_call","server":"docs","tool_name":"search","status":"in_progress"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageToolUse {
+		t.Errorf("Type = %q, want %q", msg.Type, agentrun.MessageToolUse)
+	}
+	if msg.Tool == nil || msg.Tool.Name != "search" {
+		t.Errorf("Tool = %+v, want name 'search'", msg.Tool)
+	}
+}
+
+func TestParseLine_ItemProgress_AgentMessageDeltas(t *testing.T) {
+	b := New()
+	lines := []string{
+		`{"type":"item.started","item":{"id":"item_3","type":"agent_message","text":""}}`,
+		`{"type":"item.updated","item":{"id":"item_3","type":"agent_message","text":"Hello"}}`,
+		`{"type":"item.updated","item":{"id":"item_3","type":"agent_message","text":"Hello, world"}}`,
+		`{"type":"item.updated","item":{"id":"item_3","type":"agent_message","text":"Hello, world"}}`,
+	}
+	var deltas []string
+	for _, line := range lines {
+		msg, err := b.ParseLine(line)
+		if errors.Is(err, cli.ErrSkipLine) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if msg.Type != agentrun.MessageTextDelta {
+			t.Fatalf("Type = %q, want %q", msg.Type, agentrun.MessageTextDelta)
+		}
+		deltas = append(deltas, msg.Content)
+	}
+	if strings.Join(deltas, "|") != "Hello|, world" {
+		t.Errorf("deltas = %q, want [Hello , world]", deltas)
+	}
+
+	// item.completed still emits the complete text.
+	msg, err := b.ParseLine(`{"type":"item.completed","item":{"id":"item_3","type":"agent_message","text":"Hello, world"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageText || msg.Content != "Hello, world" {
+		t.Errorf("completed = %+v", msg)
+	}
+}
+
+func TestParseLine_ItemProgress_ReasoningDelta(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"item.updated","item":{"id":"item_4","type":"reasoning","text":"Considering"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageThinkingDelta || msg.Content != "Considering" {
+		t.Errorf("got %+v, want thinking delta", msg)
+	}
+}
+
+func TestParseLine_ItemProgress_ResetPerTurn(t *testing.T) {
+	b := New()
+	// Each exec process restarts item IDs; turn.started drops stale progress.
+	if _, err := b.ParseLine(`{"type":"item.updated","item":{"id":"item_0","type":"agent_message","text":"first turn"}}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := b.ParseLine(`{"type":"turn.started"}`); !errors.Is(err, cli.ErrSkipLine) {
+		t.Fatalf("turn.started err = %v, want ErrSkipLine", err)
+	}
+	msg, err := b.ParseLine(`{"type":"item.updated","item":{"id":"item_0","type":"agent_message","text":"second"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Content != "second" {
+		t.Errorf("Content = %q, want %q", msg.Content, "second")
+	}
+}
+
+func TestParseLine_ItemProgress_Skipped(t *testing.T) {
+	b := New()
+	for _, line := range []string{
+		`{"type":"item.updated"}`,
+		`{"type":"item.started","item":{"id":"item_5","type":"error","message":"x"}}`,
+		`{"type":"item.started","item":{"id":"item_6","type":"future_type"}}`,
+	} {
+		if _, err := b.ParseLine(line); !errors.Is(err, cli.ErrSkipLine) {
+			t.Errorf("ParseLine(%s) err = %v, want ErrSkipLine", line, err)
+		}
+	}
+}
+
+func TestParseLine_TodoListCompleted(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"item.completed","item":{"id":"item_0","type":"todo_list","items":[]}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageToolResult || msg.Tool == nil || msg.Tool.Name != "todo_list" {
+		t.Errorf("got %+v, want todo_list tool result", msg)
+	}
+}
+
 // --- item.completed/agent_message ---
 
 func TestParseLine_AgentMessage(t *testing.T) {
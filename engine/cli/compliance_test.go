@@ -0,0 +1,42 @@
+//go:build !windows
+
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/enginetest"
+)
+
+func TestCompliance_Streamer(t *testing.T) {
+	enginetest.RunEngineTests(t, func(t *testing.T) (agentrun.Engine, agentrun.Session) {
+		b := &testStreamerBackend{
+			testBackend: testBackend{parseFn: resultParser},
+			streamFn:    func(agentrun.Session) (string, []string) { return binCat, []string{} },
+			formatFn: func(msg string) ([]byte, error) {
+				return []byte(msg + "\n" + resultMarker + "\n"), nil
+			},
+		}
+		return cli.NewEngine(b), agentrun.Session{CWD: tempDir(t)}
+	})
+}
+
+// TestCompliance_Resumer covers resume-per-turn backends. The first
+// subprocess idles until the first Send replaces it; every later turn
+// runs in a new subprocess on a new Output channel.
+func TestCompliance_Resumer(t *testing.T) {
+	enginetest.RunEngineTests(t, func(t *testing.T) (agentrun.Engine, agentrun.Session) {
+		b := &testResumerBackend{
+			testBackend: testBackend{
+				spawnFn: func(agentrun.Session) (string, []string) { return binSleep, []string{"60"} },
+				parseFn: resultParser,
+			},
+			resumeFn: func(_ agentrun.Session, prompt string) (string, []string, error) {
+				return binPrintf, []string{"%s\\n" + resultMarker + "\\n", prompt}, nil
+			},
+		}
+		return cli.NewEngine(b), agentrun.Session{CWD: tempDir(t)}
+	})
+}
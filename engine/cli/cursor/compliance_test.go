@@ -0,0 +1,15 @@
+package cursor_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/cursor"
+	"github.com/dmora/agentrun/enginetest/clitest"
+)
+
+func TestCompliance(t *testing.T) {
+	clitest.RunBackendTests(t, func() cli.Backend {
+		return cursor.New()
+	})
+}
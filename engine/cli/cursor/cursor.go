@@ -0,0 +1,195 @@
+package cursor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/cli/internal/optutil"
+)
+
+// Session option keys specific to the Cursor backend.
+// Namespaced with "cursor." to prevent collision across backends.
+// Cross-cutting options (OptionMode, OptionHITL, OptionResumeID)
+// are defined in the root agentrun package.
+const (
+	// OptionForce adds --force (allow commands without approval).
+	// Any non-empty value adds the flag.
+	// Ignored when root OptionMode or OptionHITL is set (independent surfaces).
+	OptionForce = "cursor.force"
+)
+
+// validSessionID matches Cursor chat IDs accepted by --resume (UUIDs in
+// practice). Leading dashes are rejected so an ID is never parsed as a flag.
+var validSessionID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$`)
+
+const defaultBinary = "cursor-agent"
+
+// Backend is a Cursor Agent CLI backend for agentrun.
+// It implements cli.Spawner, cli.Parser, and cli.Resumer.
+//
+// cursor-agent has no streaming stdin input (no cli.Streamer or
+// cli.InputFormatter). Multi-turn conversation uses resume-per-turn:
+// each Send() spawns a new subprocess with --resume <chat_id>.
+//
+// The session ID is auto-captured from the first system/init event via atomic
+// write-once. It is per-session state: cli.Engine runs each session on a
+// Fork (cli.Forker), so one Engine can run concurrent sessions.
+type Backend struct {
+	binary    string
+	sessionID atomic.Pointer[string] // write-once from first system/init
+}
+
+// Compile-time interface satisfaction checks.
+// Cursor does NOT implement cli.Streamer or cli.InputFormatter.
+var (
+	_ cli.Backend = (*Backend)(nil)
+	_ cli.Spawner = (*Backend)(nil)
+	_ cli.Parser  = (*Backend)(nil)
+	_ cli.Resumer = (*Backend)(nil)
+	_ cli.Forker  = (*Backend)(nil)
+)
+
+// Option configures a Backend at construction time.
+type Option func(*Backend)
+
+// WithBinary overrides the cursor-agent binary path.
+// Empty values are ignored; the default is "cursor-agent".
+func WithBinary(path string) Option {
+	return func(b *Backend) {
+		if path != "" {
+			b.binary = path
+		}
+	}
+}
+
+// New creates a Cursor Agent CLI backend with the given options.
+// The default binary is "cursor-agent".
+func New(opts ...Option) *Backend {
+	b := &Backend{binary: defaultBinary}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Fork returns a Backend with the same configuration and no captured
+// session ID, for one session. cli.Engine forks on every Start.
+func (b *Backend) Fork() cli.Backend {
+	return &Backend{binary: b.binary}
+}
+
+// SpawnArgs builds exec.Cmd arguments for a new Cursor session.
+// When OptionResumeID is set and valid, adds --resume for cold resume.
+// Invalid option values are silently skipped per the Spawner contract.
+func (b *Backend) SpawnArgs(session agentrun.Session) (string, []string) {
+	args := baseArgs()
+	args = appendCommonArgs(args, session)
+
+	if id := session.Options[agentrun.OptionResumeID]; id != "" && validateSessionID(id) == nil {
+		args = append(args, "--resume", id)
+	}
+
+	// POSIX -- separator prevents prompt content from being parsed as flags.
+	args = append(args, "--")
+	if session.Prompt != "" && !jsonutil.ContainsNull(session.Prompt) {
+		args = append(args, session.Prompt)
+	}
+	return b.binary, args
+}
+
+// ResumeArgs builds exec.Cmd arguments to resume an existing Cursor session.
+// The session ID is resolved from:
+//  1. The atomic write-once ID captured from system/init (auto-capture)
+//  2. session.Options[OptionResumeID] (explicit fallback)
+//
+// Returns an error if no session ID is available, if the message
+// contains null bytes, or if session options are invalid.
+func (b *Backend) ResumeArgs(session agentrun.Session, initialPrompt string) (string, []string, error) {
+	if err := optutil.ValidateModeHITL("cursor", session.Options); err != nil {
+		return "", nil, err
+	}
+
+	sid := b.resolveSessionID(session)
+	if sid == "" {
+		return "", nil, errors.New("cursor: no session ID available (not captured from init and not set via OptionResumeID)")
+	}
+	if err := validateSessionID(sid); err != nil {
+		return "", nil, err
+	}
+	if jsonutil.ContainsNull(initialPrompt) {
+		return "", nil, errors.New("cursor: initial prompt contains null bytes")
+	}
+
+	args := baseArgs()
+	args = appendCommonArgs(args, session)
+	args = append(args, "--resume", sid, "--")
+	if initialPrompt != "" {
+		args = append(args, initialPrompt)
+	}
+	return b.binary, args, nil
+}
+
+// resolveSessionID returns the session ID from the atomic store (auto-capture)
+// or from OptionResumeID. Stored ID takes precedence.
+func (b *Backend) resolveSessionID(session agentrun.Session) string {
+	if p := b.sessionID.Load(); p != nil {
+		return *p
+	}
+	return session.Options[agentrun.OptionResumeID]
+}
+
+// baseArgs returns the common CLI flags for all command modes.
+func baseArgs() []string {
+	return []string{"--print", "--output-format", "stream-json"}
+}
+
+// appendCommonArgs appends model and permission flags.
+// SystemPrompt, MaxTurns, ThinkingBudget, Effort and AddDirs are silently
+// ignored (cursor-agent has no flags for these).
+func appendCommonArgs(args []string, session agentrun.Session) []string {
+	if m := session.Model; m != "" && !jsonutil.ContainsNull(m) && !strings.HasPrefix(m, "-") {
+		args = append(args, "--model", m)
+	}
+
+	planMode, force := resolvePolicy(session.Options)
+	if planMode {
+		args = append(args, "--mode", "plan")
+	}
+	if force {
+		args = append(args, "--force")
+	}
+	return args
+}
+
+// resolvePolicy maps root-level OptionMode/OptionHITL and backend-specific
+// OptionForce to --mode plan and --force.
+//
+// Root options and backend options are independent control surfaces:
+// when root options are set, OptionForce is ignored.
+//
+// Key invariant: ModePlan ALWAYS suppresses --force.
+//
+// Returns (planMode, force).
+func resolvePolicy(opts map[string]string) (bool, bool) {
+	if optutil.RootOptionsSet(opts) {
+		if agentrun.Mode(opts[agentrun.OptionMode]) == agentrun.ModePlan {
+			return true, false
+		}
+		return false, agentrun.HITL(opts[agentrun.OptionHITL]) == agentrun.HITLOff
+	}
+	return false, opts[OptionForce] != ""
+}
+
+// validateSessionID reports whether id is usable as a --resume value.
+func validateSessionID(id string) error {
+	if !validSessionID.MatchString(id) {
+		return fmt.Errorf("cursor: invalid session ID format: %q", id)
+	}
+	return nil
+}
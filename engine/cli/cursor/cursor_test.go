@@ -0,0 +1,153 @@
+package cursor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+// Test constants.
+const testSessionID = "9c1e2d3f-4a5b-6c7d-8e9f-0a1b2c3d4e5f"
+
+// --- Constructor ---
+
+func TestNew_Default(t *testing.T) {
+	b := New()
+	if b.binary != defaultBinary {
+		t.Errorf("binary = %q, want %q", b.binary, defaultBinary)
+	}
+	if New(WithBinary("")).binary != defaultBinary {
+		t.Error("empty WithBinary should keep default")
+	}
+	if New(WithBinary("/opt/cursor-agent")).binary != "/opt/cursor-agent" {
+		t.Error("WithBinary not applied")
+	}
+}
+
+// --- SpawnArgs ---
+
+func TestSpawnArgs(t *testing.T) {
+	base := []string{"--print", "--output-format", "stream-json"}
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		want    []string
+	}{
+		{
+			name:    "Minimal",
+			session: agentrun.Session{Prompt: "hello"},
+			want:    append(slices.Clone(base), "--", "hello"),
+		},
+		{
+			name:    "WithModel",
+			session: agentrun.Session{Prompt: "hi", Model: "sonnet-4"},
+			want:    append(slices.Clone(base), "--model", "sonnet-4", "--", "hi"),
+		},
+		{
+			name: "ResumeID",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionResumeID: testSessionID},
+			},
+			want: append(slices.Clone(base), "--resume", testSessionID, "--", "hi"),
+		},
+		{
+			name: "InvalidResumeIDSkipped",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionResumeID: "-x"},
+			},
+			want: append(slices.Clone(base), "--", "hi"),
+		},
+		{
+			name: "HITLOff",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionHITL: "off"},
+			},
+			want: append(slices.Clone(base), "--force", "--", "hi"),
+		},
+		{
+			name: "PlanSuppressesForce",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionMode: "plan", agentrun.OptionHITL: "off"},
+			},
+			want: append(slices.Clone(base), "--mode", "plan", "--", "hi"),
+		},
+		{
+			name: "BackendForce",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{OptionForce: "true"},
+			},
+			want: append(slices.Clone(base), "--force", "--", "hi"),
+		},
+		{
+			name: "RootIgnoresBackendForce",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionHITL: "on", OptionForce: "true"},
+			},
+			want: append(slices.Clone(base), "--", "hi"),
+		},
+		{
+			name:    "SeparatorPreventsInjection",
+			session: agentrun.Session{Prompt: "--force"},
+			want:    append(slices.Clone(base), "--", "--force"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, args := New().SpawnArgs(tt.session)
+			if binary != defaultBinary {
+				t.Errorf("binary = %q", binary)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("args = %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
+
+// --- ResumeArgs ---
+
+func TestResumeArgs_StoredSessionID(t *testing.T) {
+	b := New()
+	sid := testSessionID
+	b.sessionID.Store(&sid)
+	_, args, err := b.ResumeArgs(agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "other"},
+	}, "next")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"--print", "--output-format", "stream-json", "--resume", testSessionID, "--", "next"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestResumeArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		prompt  string
+		wantErr string
+	}{
+		{"NoSessionID", agentrun.Session{}, "x", "no session ID"},
+		{"InvalidSessionID", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: "a/b"}}, "x", "invalid session ID"},
+		{"NullBytePrompt", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testSessionID}}, "a\x00b", "null bytes"},
+		{"InvalidMode", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testSessionID, agentrun.OptionMode: "x"}}, "x", "unknown mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := New().ResumeArgs(tt.session, tt.prompt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package cursor provides a Cursor Agent CLI backend for agentrun.
+//
+// This backend implements cli.Spawner, cli.Parser, and cli.Resumer to
+// drive cursor-agent in headless print mode ("--print --output-format
+// stream-json"), translating its nd-JSON output into agentrun.Message
+// values. It does NOT implement cli.Streamer or cli.InputFormatter —
+// cursor-agent reads no streaming input, so multi-turn conversation
+// uses resume-per-turn.
+//
+// # Resume-per-turn pattern
+//
+// Each Send() spawns a new process with --resume <chat_id>. The chat ID is
+// auto-captured from the first system/init event ("session_id") and stored
+// in the session's Backend fork (cli.Forker), so one Engine can run
+// concurrent sessions.
+//
+// Callers relying on auto-capture must wait for MessageInit before
+// calling Send, or supply OptionResumeID upfront.
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - Session.Model → --model <model>
+//   - OptionMode → ModePlan → --mode plan
+//   - OptionHITL → HITLOff → --force (suppressed by ModePlan)
+//   - OptionResumeID → --resume (auto-captured or explicit cold resume).
+//     Consumers capture the chat ID from MessageInit.ResumeID.
+//
+// Backend-specific (namespaced with "cursor." prefix):
+//   - OptionForce → --force; ignored when OptionMode or OptionHITL is set
+//
+// # Event types
+//
+// The stream-json format follows Claude's: system (subtype init), user,
+// assistant, result, plus tool_call with subtypes started and completed.
+// tool_call wraps a single typed body ({"readToolCall": {"args": ...,
+// "result": ...}}); the tool name is the key without its "ToolCall"
+// suffix ("read", "write", "shell", ...), or function.name for generic
+// function calls. started maps to MessageToolUse (Input = args) and
+// completed to MessageToolResult (Input = args, Output = result).
+//
+// Assistant events carry complete text blocks (MessageText). The result
+// event's "result" field (the full response) becomes MessageResult
+// Content; is_error results map to MessageError.
+package cursor
@@ -0,0 +1,234 @@
+package cursor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+)
+
+// eventParser parses a raw JSON event into an agentrun.Message.
+type eventParser func(raw map[string]any, msg *agentrun.Message)
+
+// eventParsers dispatches Cursor event types to their parser functions.
+// system is handled inline (needs Backend state for session ID capture).
+// user events echo the prompt and produce no message (ErrSkipLine).
+var eventParsers = map[string]eventParser{
+	"assistant": parseAssistant,
+	"tool_call": parseToolCall,
+	"result":    parseResult,
+	"error":     parseError,
+}
+
+// ParseLine parses a single stream-json output line from cursor-agent into
+// a Message. Returns cli.ErrSkipLine for blank lines and user events.
+//
+// cursor-agent emits 5 event types: system (subtype init), user, assistant,
+// tool_call (subtypes started, completed), result. Events carry a
+// "session_id" but no timestamp (time.Now is used).
+func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
+	if strings.TrimSpace(line) == "" {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return agentrun.Message{}, fmt.Errorf("cursor: invalid JSON: %w", err)
+	}
+
+	typeStr := jsonutil.GetString(raw, "type")
+	if typeStr == "" {
+		return agentrun.Message{}, fmt.Errorf("cursor: missing or empty type field")
+	}
+
+	var msg agentrun.Message
+	msg.Raw = json.RawMessage(line)
+	msg.Timestamp = time.Now()
+
+	switch typeStr {
+	case "system":
+		b.parseSystem(raw, &msg)
+		return msg, nil
+	case "user":
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+
+	if parser, ok := eventParsers[typeStr]; ok {
+		parser(raw, &msg)
+		return msg, nil
+	}
+
+	// Unknown event type → MessageSystem (graceful).
+	msg.Type = agentrun.MessageSystem
+	msg.Content = typeStr
+	return msg, nil
+}
+
+// parseSystem handles system events. The first init → MessageInit with
+// the session ID captured (write-once); later inits (resumed turns) and
+// other subtypes → MessageSystem.
+func (b *Backend) parseSystem(raw map[string]any, msg *agentrun.Message) {
+	subtype := jsonutil.GetString(raw, "subtype")
+	if subtype != "init" {
+		msg.Type = agentrun.MessageSystem
+		msg.Content = "system"
+		if subtype != "" {
+			msg.Content = "system/" + subtype
+		}
+		return
+	}
+
+	sid := jsonutil.GetString(raw, "session_id")
+	if sid != "" && validateSessionID(sid) == nil && b.sessionID.CompareAndSwap(nil, &sid) {
+		msg.Type = agentrun.MessageInit
+		msg.ResumeID = sid
+		if model := errfmt.SanitizeCode(jsonutil.GetString(raw, "model")); model != "" {
+			msg.Init = &agentrun.InitMeta{Model: model}
+		}
+		return
+	}
+
+	// First init without a usable session ID — still emit MessageInit so
+	// the engine doesn't block waiting for init.
+	if b.sessionID.Load() == nil {
+		msg.Type = agentrun.MessageInit
+		return
+	}
+
+	msg.Type = agentrun.MessageSystem
+	msg.Content = "init"
+	if sid != "" {
+		msg.Content = "init: " + sid
+	}
+}
+
+// parseAssistant handles assistant events → MessageText, concatenating the
+// text blocks of message.content.
+func parseAssistant(raw map[string]any, msg *agentrun.Message) {
+	msg.Type = agentrun.MessageText
+	content, _ := jsonutil.GetMap(raw, "message")["content"].([]any)
+	var text strings.Builder
+	for _, c := range content {
+		block, ok := c.(map[string]any)
+		if !ok || jsonutil.GetString(block, "type") != "text" {
+			continue
+		}
+		text.WriteString(jsonutil.GetString(block, "text"))
+	}
+	msg.Content = text.String()
+}
+
+// parseToolCall handles tool_call events. subtype "started" →
+// MessageToolUse; "completed" → MessageToolResult with the tool's result
+// as Output. Other subtypes → MessageSystem.
+func parseToolCall(raw map[string]any, msg *agentrun.Message) {
+	subtype := jsonutil.GetString(raw, "subtype")
+	switch subtype {
+	case "started":
+		msg.Type = agentrun.MessageToolUse
+	case "completed":
+		msg.Type = agentrun.MessageToolResult
+	default:
+		msg.Type = agentrun.MessageSystem
+		msg.Content = "tool_call/" + subtype
+		return
+	}
+
+	name, call := toolCallBody(jsonutil.GetMap(raw, "tool_call"))
+	tool := &agentrun.ToolCall{Name: name}
+	if fn := jsonutil.GetMap(call, "function"); fn != nil {
+		// Generic function call: {"function": {"name": ..., "arguments": "<json>"}}.
+		tool.Name = jsonutil.GetString(fn, "name")
+		tool.Input = rawArguments(jsonutil.GetString(fn, "arguments"))
+	} else {
+		tool.Input = marshalField(call, "args")
+	}
+	if msg.Type == agentrun.MessageToolResult {
+		tool.Output = marshalField(call, "result")
+	}
+	msg.Tool = tool
+}
+
+// toolCallBody unwraps the single-key tool_call object
+// ({"readToolCall": {...}}) into a tool name ("read") and its body.
+// The generic {"function": {...}} form is returned as-is with an empty name.
+func toolCallBody(toolCall map[string]any) (string, map[string]any) {
+	if _, ok := toolCall["function"]; ok {
+		return "", toolCall
+	}
+	for key, v := range toolCall {
+		body, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		return strings.TrimSuffix(key, "ToolCall"), body
+	}
+	return "", nil
+}
+
+// parseResult handles result events. Successful results → MessageResult
+// with the full response text as Content; is_error → MessageError.
+func parseResult(raw map[string]any, msg *agentrun.Message) {
+	text := jsonutil.GetString(raw, "result")
+	if isErr, _ := raw["is_error"].(bool); isErr {
+		msg.Type = agentrun.MessageError
+		msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(raw, "subtype"))
+		if text == "" {
+			text = "turn failed"
+		}
+		msg.Content = errfmt.Truncate(text)
+		errcat.Apply(msg)
+		return
+	}
+	msg.Type = agentrun.MessageResult
+	msg.Content = text
+}
+
+// parseError handles top-level error events.
+func parseError(raw map[string]any, msg *agentrun.Message) {
+	msg.Type = agentrun.MessageError
+	msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(raw, "code"))
+	message := jsonutil.GetString(raw, "message")
+	if message == "" {
+		message = jsonutil.GetString(raw, "error")
+	}
+	if message == "" {
+		message = "unknown error"
+	}
+	msg.Content = errfmt.Truncate(message)
+	errcat.Apply(msg)
+}
+
+// rawArguments returns a function call's arguments string as raw JSON when
+// it is valid JSON, or as a JSON string otherwise.
+func rawArguments(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// marshalField marshals m[key] to json.RawMessage if present, else returns nil.
+// On marshal failure, returns a diagnostic JSON string rather than nil to
+// avoid silent data loss.
+func marshalField(m map[string]any, key string) json.RawMessage {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf(`"[marshal error: %v]"`, err))
+	}
+	return data
+}
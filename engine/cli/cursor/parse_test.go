@@ -0,0 +1,149 @@
+package cursor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+)
+
+// --- system ---
+
+func TestParseLine_Init(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"system","subtype":"init","apiKeySource":"login","cwd":"/w","session_id":"` + testSessionID + `","model":"Claude 4 Sonnet","permissionMode":"default"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageInit || msg.ResumeID != testSessionID {
+		t.Fatalf("got %+v", msg)
+	}
+	if b.resolveSessionID(agentrun.Session{}) != testSessionID {
+		t.Errorf("captured ID = %q", b.resolveSessionID(agentrun.Session{}))
+	}
+	if msg.Init == nil || msg.Init.Model == "" {
+		t.Errorf("Init = %+v, want model", msg.Init)
+	}
+
+	// A resumed turn's init is a system message.
+	msg, err = b.ParseLine(`{"type":"system","subtype":"init","session_id":"` + testSessionID + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem {
+		t.Errorf("second init Type = %q, want system", msg.Type)
+	}
+}
+
+func TestParseLine_Init_InvalidID(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"system","subtype":"init","session_id":"--bad"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageInit || msg.ResumeID != "" || b.resolveSessionID(agentrun.Session{}) != "" {
+		t.Errorf("got %+v, want MessageInit without ResumeID", msg)
+	}
+}
+
+func TestParseLine_UserSkipped(t *testing.T) {
+	_, err := New().ParseLine(`{"type":"user","message":{"role":"user","content":[{"type":"text","text":"hi"}]}}`)
+	if !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("err = %v, want ErrSkipLine", err)
+	}
+}
+
+// --- assistant ---
+
+func TestParseLine_Assistant(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hello, "},{"type":"text","text":"world"}]},"session_id":"s"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageText || msg.Content != "Hello, world" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+// --- tool_call ---
+
+func TestParseLine_ToolCallStarted(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"tool_call","subtype":"started","call_id":"c1","tool_call":{"readToolCall":{"args":{"path":"go.mod"}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolUse || msg.Tool == nil || msg.Tool.Name != "read" {
+		t.Fatalf("got %+v", msg)
+	}
+	if string(msg.Tool.Input) != `{"path":"go.mod"}` || msg.Tool.Output != nil {
+		t.Errorf("Tool = %+v", msg.Tool)
+	}
+}
+
+func TestParseLine_ToolCallCompleted(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"tool_call","subtype":"completed","call_id":"c1","tool_call":{"writeToolCall":{"args":{"path":"a.txt"},"result":{"success":{"linesCreated":3}}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolResult || msg.Tool.Name != "write" {
+		t.Fatalf("got %+v", msg)
+	}
+	if string(msg.Tool.Output) != `{"success":{"linesCreated":3}}` {
+		t.Errorf("Output = %s", msg.Tool.Output)
+	}
+}
+
+func TestParseLine_ToolCallFunction(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"tool_call","subtype":"started","tool_call":{"function":{"name":"grep","arguments":"{\"pattern\":\"TODO\"}"}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Tool == nil || msg.Tool.Name != "grep" || string(msg.Tool.Input) != `{"pattern":"TODO"}` {
+		t.Errorf("Tool = %+v", msg.Tool)
+	}
+}
+
+func TestParseLine_ToolCallUnknownSubtype(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"tool_call","subtype":"progress","tool_call":{}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "tool_call/progress" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+// --- result ---
+
+func TestParseLine_Result(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"result","subtype":"success","is_error":false,"duration_ms":1200,"result":"Done.","session_id":"s"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageResult || msg.Content != "Done." {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestParseLine_ResultError(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"result","subtype":"error","is_error":true,"result":"rate limited"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageError || msg.ErrorCode != "error" || msg.Content != "rate limited" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+// --- edge cases ---
+
+func TestParseLine_Unknown(t *testing.T) {
+	msg, err := New().ParseLine(`{"type":"future"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "future" {
+		t.Errorf("got %+v", msg)
+	}
+}
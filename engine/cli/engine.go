@@ -26,6 +26,10 @@ var _ agentrun.Engine = (*Engine)(nil)
 
 // NewEngine creates a CLI engine backed by the given Backend.
 // Use EngineOption functions to customize buffer sizes and grace period.
+//
+// Backends implementing Forker are forked on every Start, so one Engine
+// can run concurrent sessions. Other backends must not be shared by
+// concurrent sessions.
 func NewEngine(backend Backend, opts ...EngineOption) *Engine {
 	return &Engine{
 		backend: backend,
@@ -85,12 +89,23 @@ func (e *Engine) Start(_ context.Context, session agentrun.Session, opts ...agen
 		return nil, err
 	}
 
+	// Per-session backend state: each Process gets its own fork.
+	backend := e.backend
+	if f, ok := backend.(Forker); ok {
+		backend = f.Fork()
+	}
+
 	// Resolve capabilities once.
-	caps := resolveCapabilities(e.backend)
+	caps := resolveCapabilities(backend)
 
 	if err := validateSendCapability(caps); err != nil {
 		return nil, err
 	}
+	if v, ok := backend.(SessionValidator); ok {
+		if err := v.ValidateSession(session); err != nil {
+			return nil, err
+		}
+	}
 
 	// Determine mode: Streamer (stdin pipe) requires both Streamer and
 	// InputFormatter. Without a formatter, fall back to SpawnArgs even
@@ -101,7 +116,7 @@ func (e *Engine) Start(_ context.Context, session agentrun.Session, opts ...agen
 	if useStreamer {
 		binary, args = caps.streamer.StreamArgs(session)
 	} else {
-		binary, args = e.backend.SpawnArgs(session)
+		binary, args = backend.SpawnArgs(session)
 	}
 
 	resolvedBinary, err := exec.LookPath(binary)
@@ -120,7 +135,7 @@ func (e *Engine) Start(_ context.Context, session agentrun.Session, opts ...agen
 		return nil, fmt.Errorf("cli: start: %w", err)
 	}
 
-	return newProcess(e.backend, caps, session, e.opts, env, cmd, stdin, stdout), nil
+	return newProcess(backend, caps, session, e.opts, env, cmd, stdin, stdout), nil
 }
 
 // spawnCmd builds, configures, and starts an exec.Cmd.
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -128,6 +129,42 @@ func (b *testStreamerResumerBackend) ResumeArgs(s agentrun.Session, prompt strin
 	return b.resumeFn(s, prompt)
 }
 
+// testEOFBackend adds EOFParser to a Resumer backend.
+type testEOFBackend struct {
+	testResumerBackend
+	eofFn func() (agentrun.Message, error)
+}
+
+func (b *testEOFBackend) ParseEOF() (agentrun.Message, error) { return b.eofFn() }
+
+// testForkBackend is a Resumer backend whose forks tag parsed messages
+// with their fork number.
+type testForkBackend struct {
+	testResumerBackend
+	forks *atomic.Int32
+	id    int32
+}
+
+func (b *testForkBackend) Fork() cli.Backend {
+	f := *b
+	f.id = b.forks.Add(1)
+	return &f
+}
+
+func (b *testForkBackend) ParseLine(line string) (agentrun.Message, error) {
+	msg, err := b.testResumerBackend.ParseLine(line)
+	msg.Content = fmt.Sprintf("%d:%s", b.id, msg.Content)
+	return msg, err
+}
+
+// testValidatorBackend adds SessionValidator to a Resumer backend.
+type testValidatorBackend struct {
+	testResumerBackend
+	validateFn func(agentrun.Session) error
+}
+
+func (b *testValidatorBackend) ValidateSession(s agentrun.Session) error { return b.validateFn(s) }
+
 // echoBackend returns a minimal backend (Spawner+Parser only) that spawns
 // "echo" with session.Prompt. Has no send capability — Start() will reject it.
 // Use echoResumerBackend() for tests that need Start() to succeed.
@@ -701,6 +738,33 @@ func TestStart_NoSendCapability(t *testing.T) {
 	}
 }
 
+func TestStart_SessionValidatorRejects(t *testing.T) {
+	errPlan := errors.New("plan not supported")
+	var spawned bool
+	b := &testValidatorBackend{
+		testResumerBackend: *withResumer(testBackend{
+			spawnFn: func(_ agentrun.Session) (string, []string) {
+				spawned = true
+				return binSleep, []string{"60"}
+			},
+			parseFn: textParser,
+		}),
+		validateFn: func(s agentrun.Session) error {
+			if s.Options[agentrun.OptionMode] == string(agentrun.ModePlan) {
+				return errPlan
+			}
+			return nil
+		},
+	}
+	session := agentrun.Session{CWD: tempDir(t), Options: map[string]string{agentrun.OptionMode: "plan"}}
+	if _, err := cli.NewEngine(b).Start(testCtx(t), session); !errors.Is(err, errPlan) {
+		t.Fatalf("Start = %v, want the validator's error", err)
+	}
+	if spawned {
+		t.Error("SpawnArgs called after the session was rejected")
+	}
+}
+
 func TestSend_AfterStop(t *testing.T) {
 	b := withResumer(testBackend{
 		spawnFn: func(_ agentrun.Session) (string, []string) {
@@ -1108,6 +1172,71 @@ func TestReadLoop_SkipLine(t *testing.T) {
 	}
 }
 
+func TestReadLoop_EOFParser(t *testing.T) {
+	var lines []string
+	b := &testEOFBackend{
+		testResumerBackend: *withResumer(testBackend{
+			spawnFn: func(_ agentrun.Session) (string, []string) {
+				return binPrintf, []string{"one\ntwo"} // no trailing newline
+			},
+			parseFn: func(line string) (agentrun.Message, error) {
+				lines = append(lines, line)
+				return agentrun.Message{}, cli.ErrSkipLine
+			},
+		}),
+		eofFn: func() (agentrun.Message, error) {
+			return agentrun.Message{Type: agentrun.MessageResult, Content: strings.Join(lines, "|")}, nil
+		},
+	}
+	p, err := cli.NewEngine(b).Start(testCtx(t), agentrun.Session{CWD: tempDir(t)})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	msgs := drain(p)
+	if len(msgs) != 1 || msgs[0].Type != agentrun.MessageResult || msgs[0].Content != "one|two" {
+		t.Fatalf("messages = %+v, want one result after EOF", msgs)
+	}
+	if err := p.Wait(); err != nil {
+		t.Errorf("Wait = %v, want nil (EOF result satisfies the turn)", err)
+	}
+}
+
+func TestReadLoop_EOFParserSkip(t *testing.T) {
+	b := &testEOFBackend{
+		testResumerBackend: *echoResumerBackend(),
+		eofFn:              func() (agentrun.Message, error) { return agentrun.Message{}, cli.ErrSkipLine },
+	}
+	p, err := cli.NewEngine(b).Start(testCtx(t), agentrun.Session{CWD: tempDir(t)})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if msgs := drain(p); len(msgs) != 2 {
+		t.Fatalf("messages = %+v, want text and result only", msgs)
+	}
+}
+
+func TestStart_ForksBackend(t *testing.T) {
+	b := &testForkBackend{testResumerBackend: *echoResumerBackend(), forks: new(atomic.Int32)}
+	eng := cli.NewEngine(b)
+
+	seen := map[string]bool{}
+	for range 2 {
+		p, err := eng.Start(testCtx(t), agentrun.Session{CWD: tempDir(t), Prompt: "hi"})
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		msgs := drain(p)
+		if len(msgs) == 0 {
+			t.Fatal("no messages")
+		}
+		seen[msgs[0].Content] = true
+	}
+	if b.forks.Load() != 2 || !seen["1:hi"] || !seen["2:hi"] {
+		t.Errorf("forks = %d, first messages = %v; want one fork per Start", b.forks.Load(), seen)
+	}
+}
+
 func TestReadLoop_ParseError(t *testing.T) {
 	b := withResumer(testBackend{
 		spawnFn: func(_ agentrun.Session) (string, []string) {
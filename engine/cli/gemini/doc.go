@@ -0,0 +1,52 @@
+// Package gemini provides a Gemini CLI backend for agentrun.
+//
+// This backend implements cli.Spawner, cli.Parser, and cli.Resumer to
+// drive Gemini CLI in headless mode ("--output-format stream-json"),
+// translating its nd-JSON output into agentrun.Message values. It does
+// NOT implement cli.Streamer or cli.InputFormatter — Gemini uses
+// resume-per-turn for multi-turn conversation.
+//
+// # Resume-per-turn pattern
+//
+// Headless Gemini is single-shot: provide a prompt, get a response,
+// process exits. For multi-turn, each Send() spawns a new process with
+// --resume <session_id>. The session ID is auto-captured from the first
+// init event and stored in the session's Backend fork (cli.Forker), so one
+// Engine can run concurrent sessions.
+//
+// Callers relying on auto-capture must wait for MessageInit before
+// calling Send, or supply OptionResumeID upfront.
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - Session.Model → --model <model>
+//   - OptionMode → ModePlan → --approval-mode plan
+//   - OptionHITL → HITLOff → --approval-mode yolo (suppressed by ModePlan);
+//     otherwise --approval-mode default
+//   - OptionAddDirs → --include-directories (one flag per directory)
+//   - OptionResumeID → --resume (auto-captured or explicit cold resume).
+//     Consumers capture the session ID from MessageInit.ResumeID.
+//
+// Backend-specific (namespaced with "gemini." prefix):
+//   - OptionApprovalMode → --approval-mode (ApprovalDefault, ApprovalAutoEdit,
+//     ApprovalYolo, ApprovalPlan); ignored when OptionMode or OptionHITL is set
+//   - OptionSandbox → --sandbox
+//
+// The prompt is passed as "--prompt=<text>" so prompts beginning with a
+// dash are never parsed as flags.
+//
+// # Event types
+//
+// Gemini emits 6 JSON event types: init, message, tool_use, tool_result,
+// error, result. All events include a top-level "timestamp" field
+// (ISO 8601).
+//
+// Assistant text streams as message events with "delta": true, mapped to
+// MessageTextDelta. Gemini sends no final text block; the turn's
+// accumulated text is carried as Content on MessageResult instead.
+// tool_use and tool_result map to MessageToolUse and MessageToolResult
+// (the result's tool name is recovered from the matching tool_use).
+// Warnings (error events with severity "warning") map to MessageSystem.
+// A result with status "error" maps to MessageError.
+package gemini
@@ -0,0 +1,262 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/cli/internal/optutil"
+)
+
+// Session option keys specific to the Gemini backend.
+// Namespaced with "gemini." to prevent collision across backends.
+// Cross-cutting options (OptionMode, OptionHITL, OptionAddDirs,
+// OptionResumeID) are defined in the root agentrun package.
+const (
+	// OptionApprovalMode sets the --approval-mode flag.
+	// Values should be ApprovalMode constants.
+	// Ignored when root OptionMode or OptionHITL is set (independent surfaces).
+	OptionApprovalMode = "gemini.approval_mode"
+
+	// OptionSandbox enables the Gemini CLI sandbox (--sandbox).
+	// Any non-empty value adds the flag.
+	OptionSandbox = "gemini.sandbox"
+)
+
+// ApprovalMode controls tool approval via --approval-mode.
+type ApprovalMode string
+
+const (
+	ApprovalDefault  ApprovalMode = "default"
+	ApprovalAutoEdit ApprovalMode = "auto_edit"
+	ApprovalYolo     ApprovalMode = "yolo"
+	ApprovalPlan     ApprovalMode = "plan"
+)
+
+// validApprovalMode reports whether m is a recognized approval mode.
+func validApprovalMode(m ApprovalMode) bool {
+	switch m {
+	case ApprovalDefault, ApprovalAutoEdit, ApprovalYolo, ApprovalPlan:
+		return true
+	}
+	return false
+}
+
+// validSessionID matches Gemini session references accepted by --resume:
+// session UUIDs, "latest", or a session index. Leading dashes are rejected
+// so an ID can never be parsed as a flag.
+var validSessionID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$`)
+
+const defaultBinary = "gemini"
+
+// Backend is a Gemini CLI backend for agentrun.
+// It implements cli.Spawner, cli.Parser, and cli.Resumer.
+//
+// Gemini CLI does NOT support streaming input in headless mode (no
+// cli.Streamer or cli.InputFormatter). Multi-turn conversation uses
+// resume-per-turn: each Send() spawns a new subprocess with --resume <id>.
+//
+// The session ID is auto-captured from the first init event via atomic
+// write-once. It is per-session state: cli.Engine runs each session on a
+// Fork (cli.Forker), so one Engine can run concurrent sessions.
+type Backend struct {
+	binary    string
+	sessionID atomic.Pointer[string] // write-once from first init event
+	turn      turnState              // per-turn parser state
+}
+
+// turnState accumulates streamed assistant text and pending tool names
+// for the turn in progress. Reset on each init event.
+type turnState struct {
+	mu    sync.Mutex
+	text  strings.Builder
+	tools map[string]string // tool_id → tool_name, until the tool_result
+}
+
+// Compile-time interface satisfaction checks.
+// Gemini does NOT implement cli.Streamer or cli.InputFormatter.
+var (
+	_ cli.Backend = (*Backend)(nil)
+	_ cli.Spawner = (*Backend)(nil)
+	_ cli.Parser  = (*Backend)(nil)
+	_ cli.Resumer = (*Backend)(nil)
+	_ cli.Forker  = (*Backend)(nil)
+)
+
+// Option configures a Backend at construction time.
+type Option func(*Backend)
+
+// WithBinary overrides the Gemini CLI binary path.
+// Empty values are ignored; the default is "gemini".
+func WithBinary(path string) Option {
+	return func(b *Backend) {
+		if path != "" {
+			b.binary = path
+		}
+	}
+}
+
+// New creates a Gemini CLI backend with the given options.
+// The default binary is "gemini".
+func New(opts ...Option) *Backend {
+	b := &Backend{binary: defaultBinary}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Fork returns a Backend with the same configuration and no captured
+// session ID or turn state, for one session. cli.Engine forks on every Start.
+func (b *Backend) Fork() cli.Backend {
+	return &Backend{binary: b.binary}
+}
+
+// SpawnArgs builds exec.Cmd arguments for a new Gemini session.
+// When OptionResumeID is set and valid, adds --resume for cold resume.
+// Invalid option values are silently skipped per the Spawner contract.
+func (b *Backend) SpawnArgs(session agentrun.Session) (string, []string) {
+	args := baseArgs()
+	args = appendCommonArgs(args, session)
+
+	if id := session.Options[agentrun.OptionResumeID]; id != "" && validateSessionID(id) == nil {
+		args = append(args, "--resume", id)
+	}
+
+	if session.Prompt != "" && !jsonutil.ContainsNull(session.Prompt) {
+		args = append(args, promptArg(session.Prompt))
+	}
+	return b.binary, args
+}
+
+// ResumeArgs builds exec.Cmd arguments to resume an existing Gemini session.
+// The session ID is resolved from:
+//  1. The atomic write-once ID captured from init (auto-capture)
+//  2. session.Options[OptionResumeID] (explicit fallback)
+//
+// Returns an error if no session ID is available, if the message
+// contains null bytes, or if session options are invalid.
+func (b *Backend) ResumeArgs(session agentrun.Session, initialPrompt string) (string, []string, error) {
+	if err := validateSessionOptions(session.Options); err != nil {
+		return "", nil, err
+	}
+
+	sid := b.resolveSessionID(session)
+	if sid == "" {
+		return "", nil, errors.New("gemini: no session ID available (not captured from init and not set via OptionResumeID)")
+	}
+	if err := validateSessionID(sid); err != nil {
+		return "", nil, err
+	}
+	if jsonutil.ContainsNull(initialPrompt) {
+		return "", nil, errors.New("gemini: initial prompt contains null bytes")
+	}
+
+	args := baseArgs()
+	args = appendCommonArgs(args, session)
+	args = append(args, "--resume", sid)
+
+	if initialPrompt != "" {
+		args = append(args, promptArg(initialPrompt))
+	}
+	return b.binary, args, nil
+}
+
+// resolveSessionID returns the session ID from the atomic store (auto-capture)
+// or from OptionResumeID. Stored ID takes precedence.
+func (b *Backend) resolveSessionID(session agentrun.Session) string {
+	if p := b.sessionID.Load(); p != nil {
+		return *p
+	}
+	return session.Options[agentrun.OptionResumeID]
+}
+
+// baseArgs returns the common CLI flags for all command modes.
+func baseArgs() []string {
+	return []string{"--output-format", "stream-json"}
+}
+
+// promptArg returns the headless prompt flag. The prompt is attached with
+// "=" so a prompt starting with "-" is never parsed as a separate flag.
+func promptArg(prompt string) string {
+	return "--prompt=" + prompt
+}
+
+// appendCommonArgs appends model, approval, sandbox and directory flags.
+// SystemPrompt, MaxTurns, ThinkingBudget and Effort are silently ignored
+// (Gemini CLI has no flags for these).
+func appendCommonArgs(args []string, session agentrun.Session) []string {
+	if m := session.Model; m != "" && !jsonutil.ContainsNull(m) && !strings.HasPrefix(m, "-") {
+		args = append(args, "--model", m)
+	}
+
+	if mode := resolveApprovalMode(session.Options); mode != "" {
+		args = append(args, "--approval-mode", string(mode))
+	}
+
+	if session.Options[OptionSandbox] != "" {
+		args = append(args, "--sandbox")
+	}
+
+	return optutil.AppendAddDirs(args, session.Options, "--include-directories")
+}
+
+// resolveApprovalMode maps root-level OptionMode/OptionHITL and
+// backend-specific OptionApprovalMode to an --approval-mode value.
+//
+// Root options and backend options are independent control surfaces:
+// when root options are set, OptionApprovalMode is ignored.
+//
+// Key invariant: ModePlan ALWAYS wins over HITLOff — plan mode must never
+// be upgraded to yolo.
+//
+// Returns empty string when no flag should be emitted (CLI default).
+func resolveApprovalMode(opts map[string]string) ApprovalMode {
+	if optutil.RootOptionsSet(opts) {
+		mode := agentrun.Mode(opts[agentrun.OptionMode])
+		hitl := agentrun.HITL(opts[agentrun.OptionHITL])
+		switch {
+		case mode == agentrun.ModePlan:
+			return ApprovalPlan
+		case hitl == agentrun.HITLOff:
+			return ApprovalYolo
+		default:
+			return ApprovalDefault
+		}
+	}
+
+	// Root absent — use backend-specific option.
+	if m := ApprovalMode(opts[OptionApprovalMode]); validApprovalMode(m) {
+		return m
+	}
+	return ""
+}
+
+// validateSessionOptions performs strict validation of session options used
+// by ResumeArgs. Checks mode, HITL, and approval mode values.
+func validateSessionOptions(opts map[string]string) error {
+	if err := optutil.ValidateModeHITL("gemini", opts); err != nil {
+		return err
+	}
+	if optutil.RootOptionsSet(opts) {
+		return nil
+	}
+	if m := ApprovalMode(opts[OptionApprovalMode]); m != "" && !validApprovalMode(m) {
+		return fmt.Errorf("gemini: unknown approval mode %q: valid: default, auto_edit, yolo, plan", m)
+	}
+	return nil
+}
+
+// validateSessionID reports whether id is usable as a --resume value.
+func validateSessionID(id string) error {
+	if !validSessionID.MatchString(id) {
+		return fmt.Errorf("gemini: invalid session ID format: %q", id)
+	}
+	return nil
+}
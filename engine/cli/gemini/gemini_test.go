@@ -0,0 +1,228 @@
+package gemini
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+// Test constants.
+const testSessionID = "3f2b1c4d-5e6f-4a1b-9c8d-7e6f5a4b3c2d"
+
+// --- Constructor ---
+
+func TestNew_Default(t *testing.T) {
+	b := New()
+	if b.binary != defaultBinary {
+		t.Errorf("binary = %q, want %q", b.binary, defaultBinary)
+	}
+}
+
+func TestNew_WithBinary(t *testing.T) {
+	b := New(WithBinary("/opt/bin/gemini"))
+	if b.binary != "/opt/bin/gemini" {
+		t.Errorf("binary = %q, want %q", b.binary, "/opt/bin/gemini")
+	}
+	if New(WithBinary("")).binary != defaultBinary {
+		t.Error("empty WithBinary should keep default")
+	}
+}
+
+// --- SpawnArgs ---
+
+func TestSpawnArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		want    []string
+	}{
+		{
+			name:    "Minimal",
+			session: agentrun.Session{Prompt: "hello"},
+			want:    []string{"--output-format", "stream-json", "--prompt=hello"},
+		},
+		{
+			name:    "WithModel",
+			session: agentrun.Session{Prompt: "hi", Model: "gemini-2.5-pro"},
+			want:    []string{"--output-format", "stream-json", "--model", "gemini-2.5-pro", "--prompt=hi"},
+		},
+		{
+			name:    "LeadingDashPrompt",
+			session: agentrun.Session{Prompt: "--yolo"},
+			want:    []string{"--output-format", "stream-json", "--prompt=--yolo"},
+		},
+		{
+			name: "ResumeID",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionResumeID: testSessionID},
+			},
+			want: []string{"--output-format", "stream-json", "--resume", testSessionID, "--prompt=hi"},
+		},
+		{
+			name: "InvalidResumeIDSkipped",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionResumeID: "-evil"},
+			},
+			want: []string{"--output-format", "stream-json", "--prompt=hi"},
+		},
+		{
+			name: "AddDirs",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{agentrun.OptionAddDirs: "/a\nrelative\n/b"},
+			},
+			want: []string{"--output-format", "stream-json", "--include-directories", "/a", "--include-directories", "/b", "--prompt=hi"},
+		},
+		{
+			name: "Sandbox",
+			session: agentrun.Session{
+				Prompt:  "hi",
+				Options: map[string]string{OptionSandbox: "true"},
+			},
+			want: []string{"--output-format", "stream-json", "--sandbox", "--prompt=hi"},
+		},
+		{
+			name:    "NullBytePromptSkipped",
+			session: agentrun.Session{Prompt: "a\x00b"},
+			want:    []string{"--output-format", "stream-json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binary, args := New().SpawnArgs(tt.session)
+			if binary != defaultBinary {
+				t.Errorf("binary = %q", binary)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("args = %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
+
+// --- Approval mode ---
+
+func TestResolveApprovalMode(t *testing.T) {
+	tests := []struct {
+		name string
+		opts map[string]string
+		want ApprovalMode
+	}{
+		{"None", nil, ""},
+		{"Plan", map[string]string{agentrun.OptionMode: "plan"}, ApprovalPlan},
+		{"Act", map[string]string{agentrun.OptionMode: "act"}, ApprovalDefault},
+		{"HITLOff", map[string]string{agentrun.OptionHITL: "off"}, ApprovalYolo},
+		{"HITLOn", map[string]string{agentrun.OptionHITL: "on"}, ApprovalDefault},
+		{"PlanBeatsHITLOff", map[string]string{agentrun.OptionMode: "plan", agentrun.OptionHITL: "off"}, ApprovalPlan},
+		{"ActHITLOff", map[string]string{agentrun.OptionMode: "act", agentrun.OptionHITL: "off"}, ApprovalYolo},
+		{"BackendOption", map[string]string{OptionApprovalMode: "auto_edit"}, ApprovalAutoEdit},
+		{"BackendOptionInvalid", map[string]string{OptionApprovalMode: "bogus"}, ""},
+		{"RootWinsOverBackend", map[string]string{agentrun.OptionMode: "plan", OptionApprovalMode: "yolo"}, ApprovalPlan},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveApprovalMode(tt.opts); got != tt.want {
+				t.Errorf("resolveApprovalMode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpawnArgs_ApprovalMode(t *testing.T) {
+	_, args := New().SpawnArgs(agentrun.Session{
+		Prompt:  "hi",
+		Options: map[string]string{agentrun.OptionHITL: "off"},
+	})
+	want := []string{"--output-format", "stream-json", "--approval-mode", "yolo", "--prompt=hi"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+// --- ResumeArgs ---
+
+func TestResumeArgs_StoredSessionID(t *testing.T) {
+	b := New()
+	sid := testSessionID
+	b.sessionID.Store(&sid)
+	binary, args, err := b.ResumeArgs(agentrun.Session{Model: "gemini-2.5-flash"}, "next")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if binary != defaultBinary {
+		t.Errorf("binary = %q", binary)
+	}
+	want := []string{"--output-format", "stream-json", "--model", "gemini-2.5-flash", "--resume", testSessionID, "--prompt=next"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestResumeArgs_StoredTakesPrecedence(t *testing.T) {
+	b := New()
+	sid := testSessionID
+	b.sessionID.Store(&sid)
+	_, args, err := b.ResumeArgs(agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "latest"},
+	}, "x")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Contains(args, testSessionID) || slices.Contains(args, "latest") {
+		t.Errorf("args = %v, want stored session ID", args)
+	}
+}
+
+func TestResumeArgs_OptionResumeID(t *testing.T) {
+	_, args, err := New().ResumeArgs(agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "latest"},
+	}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"--output-format", "stream-json", "--resume", "latest"}
+	if !slices.Equal(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestResumeArgs_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		prompt  string
+		wantErr string
+	}{
+		{"NoSessionID", agentrun.Session{}, "x", "no session ID"},
+		{"InvalidSessionID", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: "a b"}}, "x", "invalid session ID"},
+		{"NullBytePrompt", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testSessionID}}, "a\x00b", "null bytes"},
+		{"InvalidMode", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testSessionID, agentrun.OptionMode: "fast"}}, "x", "unknown mode"},
+		{"InvalidHITL", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testSessionID, agentrun.OptionHITL: "maybe"}}, "x", "unknown hitl"},
+		{"InvalidApprovalMode", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: testSessionID, OptionApprovalMode: "bogus"}}, "x", "unknown approval mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := New().ResumeArgs(tt.session, tt.prompt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResumeArgs_ApprovalModeValidation_SkippedWhenRootSet(t *testing.T) {
+	_, _, err := New().ResumeArgs(agentrun.Session{
+		Options: map[string]string{
+			agentrun.OptionResumeID: testSessionID,
+			agentrun.OptionHITL:     "off",
+			OptionApprovalMode:      "bogus",
+		},
+	}, "x")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+)
+
+// eventParser parses a raw JSON event into an agentrun.Message.
+// Returns cli.ErrSkipLine when the event produces no message.
+type eventParser func(b *Backend, raw map[string]any, msg *agentrun.Message) error
+
+// eventParsers dispatches Gemini stream-json event types to their parser
+// functions. Adding a new event type = one map entry + one function.
+var eventParsers = map[string]eventParser{
+	"init":        (*Backend).parseInit,
+	"message":     (*Backend).parseMessage,
+	"tool_use":    (*Backend).parseToolUse,
+	"tool_result": (*Backend).parseToolResult,
+	"error":       (*Backend).parseError,
+	"result":      (*Backend).parseResult,
+}
+
+// ParseLine parses a single stream-json output line from Gemini CLI into a
+// Message. Returns cli.ErrSkipLine for blank lines and user message echoes.
+//
+// Gemini emits 6 event types: init, message, tool_use, tool_result, error,
+// result. All events include a top-level "timestamp" field (ISO 8601).
+func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
+	if strings.TrimSpace(line) == "" {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return agentrun.Message{}, fmt.Errorf("gemini: invalid JSON: %w", err)
+	}
+
+	typeStr := jsonutil.GetString(raw, "type")
+	if typeStr == "" {
+		return agentrun.Message{}, fmt.Errorf("gemini: missing or empty type field")
+	}
+
+	var msg agentrun.Message
+	msg.Raw = json.RawMessage(line)
+	msg.Timestamp = parseTimestamp(raw)
+
+	if parser, ok := eventParsers[typeStr]; ok {
+		if err := parser(b, raw, &msg); err != nil {
+			return agentrun.Message{}, err
+		}
+		return msg, nil
+	}
+
+	// Unknown event type → MessageSystem (graceful, not error).
+	msg.Type = agentrun.MessageSystem
+	msg.Content = typeStr
+	return msg, nil
+}
+
+// parseInit handles init events with session ID write-once logic.
+// Every process (first turn and each resume) starts with init, so it also
+// resets per-turn state. The first init → MessageInit (ID captured when
+// valid); subsequent → MessageSystem.
+func (b *Backend) parseInit(raw map[string]any, msg *agentrun.Message) error {
+	b.turn.reset()
+
+	sid := jsonutil.GetString(raw, "session_id")
+	if sid != "" && validateSessionID(sid) == nil {
+		if b.sessionID.CompareAndSwap(nil, &sid) {
+			msg.Type = agentrun.MessageInit
+			msg.ResumeID = sid
+			if model := errfmt.SanitizeCode(jsonutil.GetString(raw, "model")); model != "" {
+				msg.Init = &agentrun.InitMeta{Model: model}
+			}
+			return nil
+		}
+	}
+
+	// First init that didn't CAS (invalid or empty session_id) — still
+	// emit MessageInit so the engine doesn't block waiting for init.
+	if b.sessionID.Load() == nil {
+		msg.Type = agentrun.MessageInit
+		return nil
+	}
+
+	// Subsequent init (resumed turn) → system message.
+	msg.Type = agentrun.MessageSystem
+	msg.Content = "init"
+	if sid != "" {
+		msg.Content = "init: " + sid
+	}
+	return nil
+}
+
+// parseMessage handles message events. Assistant chunks ("delta": true)
+// become MessageTextDelta and are accumulated for the turn's MessageResult;
+// complete assistant messages become MessageText. User messages echo the
+// prompt and are skipped.
+func (b *Backend) parseMessage(raw map[string]any, msg *agentrun.Message) error {
+	if jsonutil.GetString(raw, "role") != "assistant" {
+		return cli.ErrSkipLine
+	}
+	content := jsonutil.GetString(raw, "content")
+	if delta, _ := raw["delta"].(bool); delta {
+		b.turn.appendText(content)
+		msg.Type = agentrun.MessageTextDelta
+		msg.Content = content
+		return nil
+	}
+	b.turn.replaceText(content)
+	msg.Type = agentrun.MessageText
+	msg.Content = content
+	return nil
+}
+
+// parseToolUse handles tool_use events → MessageToolUse.
+// Tool.Input = parameters object.
+func (b *Backend) parseToolUse(raw map[string]any, msg *agentrun.Message) error {
+	name := jsonutil.GetString(raw, "tool_name")
+	b.turn.startTool(jsonutil.GetString(raw, "tool_id"), name)
+	msg.Type = agentrun.MessageToolUse
+	msg.Tool = &agentrun.ToolCall{
+		Name:  name,
+		Input: marshalField(raw, "parameters"),
+	}
+	return nil
+}
+
+// parseToolResult handles tool_result events → MessageToolResult.
+// Tool.Name is recovered from the matching tool_use. Tool.Output is the
+// output string on success, or the error object when status is "error".
+func (b *Backend) parseToolResult(raw map[string]any, msg *agentrun.Message) error {
+	msg.Type = agentrun.MessageToolResult
+	tool := &agentrun.ToolCall{
+		Name:   b.turn.finishTool(jsonutil.GetString(raw, "tool_id")),
+		Output: marshalField(raw, "output"),
+	}
+	if jsonutil.GetString(raw, "status") == "error" {
+		if errOut := marshalField(raw, "error"); errOut != nil {
+			tool.Output = errOut
+		}
+	}
+	msg.Tool = tool
+	return nil
+}
+
+// parseError handles error events. Warnings (severity "warning") are
+// non-fatal and become MessageSystem; everything else is MessageError.
+func (b *Backend) parseError(raw map[string]any, msg *agentrun.Message) error {
+	message := jsonutil.GetString(raw, "message")
+	if jsonutil.GetString(raw, "severity") == "warning" {
+		msg.Type = agentrun.MessageSystem
+		msg.Content = errfmt.Truncate("warning: " + message)
+		return nil
+	}
+	msg.Type = agentrun.MessageError
+	msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(raw, "code"))
+	if message == "" {
+		message = "unknown error"
+	}
+	msg.Content = errfmt.Truncate(message)
+	errcat.Apply(msg)
+	return nil
+}
+
+// parseResult handles the final result event. status "success" →
+// MessageResult with usage and the turn's accumulated assistant text as
+// Content; status "error" → MessageError (as for a failed turn).
+func (b *Backend) parseResult(raw map[string]any, msg *agentrun.Message) error {
+	text := b.turn.takeText()
+	if jsonutil.GetString(raw, "status") == "error" {
+		msg.Type = agentrun.MessageError
+		errObj := jsonutil.GetMap(raw, "error")
+		msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(errObj, "type"))
+		message := jsonutil.GetString(errObj, "message")
+		if message == "" {
+			message = "turn failed"
+		}
+		msg.Content = errfmt.Truncate(message)
+		errcat.Apply(msg)
+		return nil
+	}
+	msg.Type = agentrun.MessageResult
+	msg.Content = text
+	msg.Usage = parseStats(raw)
+	return nil
+}
+
+// --- turnState ---
+
+func (s *turnState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text.Reset()
+	clear(s.tools)
+}
+
+func (s *turnState) appendText(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text.WriteString(text)
+}
+
+func (s *turnState) replaceText(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.text.Reset()
+	s.text.WriteString(text)
+}
+
+func (s *turnState) takeText() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := s.text.String()
+	s.text.Reset()
+	return text
+}
+
+func (s *turnState) startTool(id, name string) {
+	if id == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tools == nil {
+		s.tools = make(map[string]string)
+	}
+	s.tools[id] = name
+}
+
+func (s *turnState) finishTool(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := s.tools[id]
+	delete(s.tools, id)
+	return name
+}
+
+// --- helpers ---
+
+// parseTimestamp extracts an ISO 8601 timestamp from the "timestamp" field.
+// Returns time.Now() if the field is missing or invalid.
+func parseTimestamp(raw map[string]any) time.Time {
+	if ts := jsonutil.GetString(raw, "timestamp"); ts != "" {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// parseStats extracts token usage from a result event.
+// Path: raw.stats.{input_tokens, output_tokens, cached}
+// Returns nil if no stats map is present or all counts are zero.
+func parseStats(raw map[string]any) *agentrun.Usage {
+	stats := jsonutil.GetMap(raw, "stats")
+	if stats == nil {
+		return nil
+	}
+	u := &agentrun.Usage{
+		InputTokens:     jsonutil.GetInt(stats, "input_tokens"),
+		OutputTokens:    jsonutil.GetInt(stats, "output_tokens"),
+		CacheReadTokens: jsonutil.GetInt(stats, "cached"),
+	}
+	if u.InputTokens == 0 && u.OutputTokens == 0 && u.CacheReadTokens == 0 {
+		return nil
+	}
+	return u
+}
+
+// marshalField marshals m[key] to json.RawMessage if present, else returns nil.
+// On marshal failure, returns a diagnostic JSON string rather than nil to
+// avoid silent data loss.
+func marshalField(m map[string]any, key string) json.RawMessage {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf(`"[marshal error: %v]"`, err))
+	}
+	return data
+}
@@ -0,0 +1,207 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+)
+
+// --- init ---
+
+func TestParseLine_Init(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"init","timestamp":"2025-10-10T12:00:00.000Z","session_id":"` + testSessionID + `","model":"gemini-2.5-pro"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Type != agentrun.MessageInit {
+		t.Errorf("Type = %q, want %q", msg.Type, agentrun.MessageInit)
+	}
+	if msg.ResumeID != testSessionID || b.resolveSessionID(agentrun.Session{}) != testSessionID {
+		t.Errorf("ResumeID = %q, captured ID = %q", msg.ResumeID, b.resolveSessionID(agentrun.Session{}))
+	}
+	if msg.Init == nil || msg.Init.Model != "gemini-2.5-pro" {
+		t.Errorf("Init = %+v", msg.Init)
+	}
+	want := time.Date(2025, 10, 10, 12, 0, 0, 0, time.UTC)
+	if !msg.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want %v", msg.Timestamp, want)
+	}
+}
+
+func TestParseLine_Init_Subsequent(t *testing.T) {
+	b := New()
+	line := `{"type":"init","session_id":"` + testSessionID + `"}`
+	if _, err := b.ParseLine(line); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.ParseLine(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "init: "+testSessionID {
+		t.Errorf("got %+v, want system message", msg)
+	}
+}
+
+func TestParseLine_Init_InvalidID(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"init","session_id":"bad id"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageInit || msg.ResumeID != "" || b.resolveSessionID(agentrun.Session{}) != "" {
+		t.Errorf("got %+v, want MessageInit without ResumeID", msg)
+	}
+}
+
+// --- message ---
+
+func TestParseLine_MessageDeltas(t *testing.T) {
+	b := New()
+	for _, chunk := range []string{"Hello", ", world"} {
+		msg, err := b.ParseLine(`{"type":"message","role":"assistant","content":"` + chunk + `","delta":true}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != agentrun.MessageTextDelta || msg.Content != chunk {
+			t.Errorf("got %+v, want delta %q", msg, chunk)
+		}
+	}
+	msg, err := b.ParseLine(`{"type":"result","status":"success","stats":{"input_tokens":120,"output_tokens":8,"cached":40,"total_tokens":168}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageResult || msg.Content != "Hello, world" {
+		t.Errorf("result = %+v, want accumulated text", msg)
+	}
+	want := agentrun.Usage{InputTokens: 120, OutputTokens: 8, CacheReadTokens: 40}
+	if msg.Usage == nil || *msg.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", msg.Usage, want)
+	}
+
+	// Text does not leak into the next turn.
+	msg, _ = b.ParseLine(`{"type":"result","status":"success"}`)
+	if msg.Content != "" || msg.Usage != nil {
+		t.Errorf("second result = %+v, want empty", msg)
+	}
+}
+
+func TestParseLine_MessageComplete(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"message","role":"assistant","content":"Done."}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageText || msg.Content != "Done." {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestParseLine_UserMessageSkipped(t *testing.T) {
+	b := New()
+	_, err := b.ParseLine(`{"type":"message","role":"user","content":"prompt"}`)
+	if !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("err = %v, want ErrSkipLine", err)
+	}
+}
+
+// --- tools ---
+
+func TestParseLine_ToolUseAndResult(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"tool_use","tool_name":"read_file","tool_id":"t1","parameters":{"path":"go.mod"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolUse || msg.Tool == nil || msg.Tool.Name != "read_file" {
+		t.Fatalf("tool_use = %+v", msg)
+	}
+	if string(msg.Tool.Input) != `{"path":"go.mod"}` {
+		t.Errorf("Input = %s", msg.Tool.Input)
+	}
+
+	msg, err = b.ParseLine(`{"type":"tool_result","tool_id":"t1","status":"success","output":"module x"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolResult || msg.Tool.Name != "read_file" {
+		t.Fatalf("tool_result = %+v", msg)
+	}
+	if string(msg.Tool.Output) != `"module x"` {
+		t.Errorf("Output = %s", msg.Tool.Output)
+	}
+}
+
+func TestParseLine_ToolResultError(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"tool_result","tool_id":"t9","status":"error","error":{"type":"FILE_NOT_FOUND","message":"no such file"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageToolResult || msg.Tool.Name != "" {
+		t.Fatalf("got %+v", msg)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(msg.Tool.Output, &out); err != nil || out["type"] != "FILE_NOT_FOUND" {
+		t.Errorf("Output = %s, want error object", msg.Tool.Output)
+	}
+}
+
+// --- errors ---
+
+func TestParseLine_Error(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"error","severity":"error","message":"quota exceeded"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageError || msg.Content != "quota exceeded" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestParseLine_Warning(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"error","severity":"warning","message":"loop detected"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "warning: loop detected" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestParseLine_ResultError(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"result","status":"error","error":{"type":"FatalAuthenticationError","message":"login required"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageError || msg.ErrorCode != "FatalAuthenticationError" || msg.Content != "login required" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+// --- edge cases ---
+
+func TestParseLine_Unknown(t *testing.T) {
+	b := New()
+	msg, err := b.ParseLine(`{"type":"future_event"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != agentrun.MessageSystem || msg.Content != "future_event" {
+		t.Errorf("got %+v", msg)
+	}
+}
+
+func TestParseLine_MissingType(t *testing.T) {
+	if _, err := New().ParseLine(`{"content":"x"}`); err == nil || errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("err = %v, want parse error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package cli_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/amp"
+	"github.com/dmora/agentrun/engine/cli/claude"
+	"github.com/dmora/agentrun/engine/cli/codex"
+	"github.com/dmora/agentrun/engine/cli/cursor"
+	"github.com/dmora/agentrun/engine/cli/gemini"
+	"github.com/dmora/agentrun/engine/cli/opencode"
+	"github.com/dmora/agentrun/engine/cli/spec"
+	"github.com/dmora/agentrun/enginetest/clitest"
+)
+
+// TestGolden replays every backend's testdata/golden corpus.
+func TestGolden(t *testing.T) {
+	acme, err := spec.Load("spec/testdata/acme.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backends := []struct {
+		name   string // package directory
+		parser func() cli.Parser
+	}{
+		{"amp", func() cli.Parser { return amp.New() }},
+		{"claude", func() cli.Parser { return claude.New() }},
+		{"codex", func() cli.Parser { return codex.New() }},
+		{"cursor", func() cli.Parser { return cursor.New() }},
+		{"gemini", func() cli.Parser { return gemini.New() }},
+		{"opencode", func() cli.Parser { return opencode.New() }},
+		{"spec", func() cli.Parser {
+			b, err := spec.New(acme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			clitest.RunGoldenTests(t, filepath.Join(b.name, "testdata", "golden"), b.parser)
+		})
+	}
+}
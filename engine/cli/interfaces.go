@@ -15,10 +15,10 @@ var ErrSkipLine = errors.New("cli: skip line")
 // Every CLI backend must implement Spawner.
 //
 // SpawnArgs is a pure argument builder — it must not fail. Backends that
-// need to validate session state should do so in their constructor or in
-// Engine.Validate. Implementations MUST return arguments suitable for
-// exec.Cmd (pre-split argv) and MUST NOT pass arguments through a shell
-// interpreter.
+// need to validate session state should do so in their constructor, in
+// Engine.Validate, or by implementing SessionValidator. Implementations
+// MUST return arguments suitable for exec.Cmd (pre-split argv) and MUST NOT
+// pass arguments through a shell interpreter.
 type Spawner interface {
 	SpawnArgs(session agentrun.Session) (binary string, args []string)
 }
@@ -61,9 +61,46 @@ type Streamer interface {
 	StreamArgs(session agentrun.Session) (binary string, args []string)
 }
 
+// EOFParser emits a final message when the subprocess closes stdout, for
+// CLIs whose output has no end-of-turn event (e.g. plain text output).
+// EOFParser is optional — the CLIEngine discovers it via type assertion
+// and calls ParseEOF once per subprocess, after its last line.
+//
+// ParseEOF returns ErrSkipLine when there is nothing to emit. Any other
+// non-nil error is surfaced as MessageError, as for ParseLine.
+type EOFParser interface {
+	ParseEOF() (agentrun.Message, error)
+}
+
+// SessionValidator rejects sessions a backend cannot run as asked, such
+// as an OptionMode the CLI has no equivalent for. SessionValidator is
+// optional — the CLIEngine discovers it via type assertion and calls
+// ValidateSession in Start, before SpawnArgs or StreamArgs; a non-nil
+// error fails Start.
+type SessionValidator interface {
+	ValidateSession(session agentrun.Session) error
+}
+
+// Forker creates per-session backend state. Backends that capture state
+// from their output (session IDs, pending tool names) implement Forker so
+// one Engine can run concurrent sessions. Forker is optional — the
+// CLIEngine discovers it via type assertion and calls Fork once per
+// Start, driving that Process (spawn, parse, resume) with the fork:
+//
+//	if f, ok := backend.(Forker); ok {
+//	    backend = f.Fork()
+//	}
+//
+// Fork must return a Backend with the same configuration and fresh state.
+// State captured by a fork is not visible on the original Backend;
+// consumers read session IDs from MessageInit.ResumeID.
+type Forker interface {
+	Fork() Backend
+}
+
 // Backend is the minimum interface a CLI backend must implement.
-// Optional capabilities (Resumer, Streamer, InputFormatter) are
-// discovered via type assertion at runtime.
+// Optional capabilities (Resumer, Streamer, InputFormatter, EOFParser,
+// Forker) are discovered via type assertion at runtime.
 //
 // Backends must implement at least one send path for [Engine.Start] to
 // succeed: either Streamer+InputFormatter or Resumer. Start returns
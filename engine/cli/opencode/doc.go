@@ -10,9 +10,10 @@
 //
 // OpenCode's run command is single-shot: provide a message, get a
 // response, process exits. For multi-turn, each Send() spawns a new
-// process with --session <id> to resume the conversation. The session
-// ID is auto-captured from the first step_start event and stored in the
-// Backend (one instance per session).
+// process with --session <id> to resume the conversation. The session ID
+// is auto-captured from the first step_start event and stored in the
+// session's Backend fork (cli.Forker), so one Engine can run concurrent
+// sessions.
 //
 // Callers relying on auto-capture must wait for MessageInit before
 // calling Send, or supply OptionResumeID upfront.
@@ -37,7 +38,9 @@
 //
 // OpenCode emits 6 JSON event types: step_start, text, tool_use,
 // step_finish, reasoning, error. All events include a top-level
-// "timestamp" field (millisecond Unix epoch) and "sessionID".
+// "timestamp" field (millisecond Unix epoch) and "sessionID". Provider
+// API errors carry the HTTP status and response headers, which set the
+// error's category, RetryAfter and, for a 429, RateLimit.
 //
 // Unlike Claude, OpenCode emits complete blocks (no streaming deltas)
 // and reports tool_use after completion (input + output together).
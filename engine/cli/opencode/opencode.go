@@ -58,8 +58,10 @@ const defaultBinary = "opencode"
 // cli.InputFormatter). Multi-turn conversation uses resume-per-turn:
 // each Send() spawns a new subprocess with --session <id>.
 //
-// One Backend instance per session. The session ID is auto-captured
-// from the first step_start event via atomic write-once.
+// The session ID is auto-captured from the first step_start event via
+// atomic write-once. It is per-session state: cli.Engine runs each
+// session on a Fork (cli.Forker), so one Engine can run concurrent
+// sessions.
 type Backend struct {
 	binary    string
 	sessionID atomic.Pointer[string] // write-once from first step_start
@@ -72,6 +74,7 @@ var (
 	_ cli.Spawner = (*Backend)(nil)
 	_ cli.Parser  = (*Backend)(nil)
 	_ cli.Resumer = (*Backend)(nil)
+	_ cli.Forker  = (*Backend)(nil)
 )
 
 // Option configures a Backend at construction time.
@@ -97,6 +100,12 @@ func New(opts ...Option) *Backend {
 	return b
 }
 
+// Fork returns a Backend with the same configuration and no captured
+// session ID, for one session. cli.Engine forks on every Start.
+func (b *Backend) Fork() cli.Backend {
+	return &Backend{binary: b.binary}
+}
+
 // SpawnArgs builds exec.Cmd arguments for a new OpenCode session.
 // When OptionResumeID is set and valid, adds --session for cold resume.
 // Invalid option values are silently skipped per the Spawner contract.
@@ -221,7 +230,12 @@ func appendCommonArgs(args []string, session agentrun.Session) []string {
 	return args
 }
 
-// SessionID returns the auto-captured session ID, or empty string if not yet captured.
+// SessionID returns the session ID captured by this Backend's ParseLine,
+// or empty string if not yet captured.
+//
+// Deprecated: cli.Engine runs each session on a Fork of the Backend, so
+// on the Backend passed to cli.NewEngine this always returns "". Read the
+// session ID from MessageInit.ResumeID instead.
 func (b *Backend) SessionID() string {
 	if p := b.sessionID.Load(); p != nil {
 		return *p
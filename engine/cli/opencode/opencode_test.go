@@ -416,6 +416,28 @@ func TestSessionID_AfterStore(t *testing.T) {
 	}
 }
 
+func TestFork_IsolatesSessionID(t *testing.T) {
+	b := New(WithBinary("/opt/opencode"))
+	sid := "ses_test1234567890123456789"
+	b.sessionID.CompareAndSwap(nil, &sid)
+
+	f, ok := b.Fork().(*Backend)
+	if !ok {
+		t.Fatalf("Fork() type = %T, want *Backend", b.Fork())
+	}
+	if f.binary != "/opt/opencode" {
+		t.Errorf("fork binary = %q, want %q", f.binary, "/opt/opencode")
+	}
+	if id := f.SessionID(); id != "" {
+		t.Errorf("fork SessionID() = %q, want empty", id)
+	}
+	other := "ses_other123456789012345678"
+	f.sessionID.CompareAndSwap(nil, &other)
+	if id := b.SessionID(); id != sid {
+		t.Errorf("original SessionID() = %q, want %q", id, sid)
+	}
+}
+
 // --- validateSessionID ---
 
 func Test_validateSessionID(t *testing.T) {
@@ -3,12 +3,14 @@ package opencode
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/cli"
 	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/internal/errcat"
 	"github.com/dmora/agentrun/engine/internal/errfmt"
 )
 
@@ -156,15 +158,42 @@ func parseError(raw map[string]any, msg *agentrun.Message) {
 
 	// OpenCode wire format uses "name" for error code (not "code").
 	msg.ErrorCode = errfmt.SanitizeCode(jsonutil.GetString(errObj, "name"))
-	message := ""
-	if data := jsonutil.GetMap(errObj, "data"); data != nil {
-		message = jsonutil.GetString(data, "message")
-	}
+	data := jsonutil.GetMap(errObj, "data")
+	message := jsonutil.GetString(data, "message")
 	// Fallback: error.message directly if data.message is empty.
 	if message == "" {
 		message = jsonutil.GetString(errObj, "message")
 	}
 	msg.Content = errfmt.Truncate(message)
+	applyAPIErrorData(data, msg)
+	errcat.Apply(msg)
+}
+
+// applyAPIErrorData refines an APIError from the provider response it
+// carries: the HTTP status decides the category when the name and message
+// do not, and the response headers supply RetryAfter and, for a 429,
+// RateLimit.
+func applyAPIErrorData(data map[string]any, msg *agentrun.Message) {
+	status := jsonutil.GetInt(data, "statusCode")
+	if status == 0 {
+		return
+	}
+	if c := errcat.Classify(msg.ErrorCode, msg.Content); c == "" || c == agentrun.CategoryInternal {
+		if s := errcat.FromStatus(status); s != "" {
+			c = s
+		}
+		msg.ErrorCategory = c
+	}
+	headers := http.Header{}
+	for k, v := range jsonutil.GetMap(data, "responseHeaders") {
+		if s, ok := v.(string); ok {
+			headers.Set(k, s)
+		}
+	}
+	msg.RetryAfter = errcat.RetryAfterHeader(headers.Get("Retry-After"), msg.Timestamp)
+	if status == http.StatusTooManyRequests {
+		msg.RateLimit = errcat.RateLimitHeaders(headers, msg.Timestamp)
+	}
 }
 
 // parseTimestamp extracts a millisecond Unix timestamp from the "timestamp" field.
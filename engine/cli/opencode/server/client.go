@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dmora/agentrun"
+)
+
+// maxErrorBody bounds how much of a non-2xx response body is kept in StatusError.
+const maxErrorBody = 4 << 10
+
+// Session is an OpenCode session as reported by the server.
+type Session struct {
+	ID        string      `json:"id"`
+	Title     string      `json:"title,omitempty"`
+	ParentID  string      `json:"parentID,omitempty"`
+	Directory string      `json:"directory,omitempty"`
+	Time      SessionTime `json:"time"`
+}
+
+// SessionTime holds session timestamps in milliseconds since the Unix epoch.
+type SessionTime struct {
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+}
+
+// StatusError is returned for non-2xx responses from the server.
+type StatusError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("opencode server: %s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Client is a minimal client for the OpenCode server HTTP API.
+// Safe for concurrent use.
+type Client struct {
+	baseURL   *url.URL
+	http      *http.Client
+	directory string
+}
+
+// NewClient returns a client for the server at baseURL (e.g.
+// "http://127.0.0.1:4096"). A nil httpClient uses http.DefaultClient.
+// directory, when non-empty, scopes every request to that project directory.
+func NewClient(baseURL string, httpClient *http.Client, directory string) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("opencode server: invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("opencode server: invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: u, http: httpClient, directory: directory}, nil
+}
+
+// ListSessions returns all sessions known to the server.
+func (c *Client) ListSessions(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	err := c.do(ctx, http.MethodGet, "/session", nil, &sessions)
+	return sessions, err
+}
+
+// GetSession returns one session. Unknown IDs yield an error wrapping
+// agentrun.ErrSessionNotFound.
+func (c *Client) GetSession(ctx context.Context, id string) (Session, error) {
+	var s Session
+	err := c.do(ctx, http.MethodGet, "/session/"+url.PathEscape(id), nil, &s)
+	return s, notFound(err)
+}
+
+// CreateSession creates a new session, optionally titled.
+func (c *Client) CreateSession(ctx context.Context, title string) (Session, error) {
+	var s Session
+	err := c.do(ctx, http.MethodPost, "/session", createSessionRequest{Title: title}, &s)
+	return s, err
+}
+
+// ForkSession copies session id into a new session. A non-empty messageID
+// forks at that message; otherwise the whole history is copied.
+func (c *Client) ForkSession(ctx context.Context, id, messageID string) (Session, error) {
+	var s Session
+	err := c.do(ctx, http.MethodPost, "/session/"+url.PathEscape(id)+"/fork", forkRequest{MessageID: messageID}, &s)
+	return s, notFound(err)
+}
+
+// Abort stops the session's in-flight turn, if any.
+func (c *Client) Abort(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/session/"+url.PathEscape(id)+"/abort", nil, nil)
+}
+
+// promptAsync submits a prompt without waiting for the reply; progress
+// arrives on the event stream.
+func (c *Client) promptAsync(ctx context.Context, id string, req promptRequest) error {
+	return c.do(ctx, http.MethodPost, "/session/"+url.PathEscape(id)+"/prompt_async", req, nil)
+}
+
+// respondPermission answers a permission request.
+func (c *Client) respondPermission(ctx context.Context, sessionID, permissionID, response string) error {
+	path := "/session/" + url.PathEscape(sessionID) + "/permissions/" + url.PathEscape(permissionID)
+	return c.do(ctx, http.MethodPost, path, permissionResponse{Response: response}, nil)
+}
+
+// openEvents opens the server-sent event stream. The caller closes the body.
+func (c *Client) openEvents(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("/event"), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("opencode server: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("opencode server: GET /event: %w", err)
+	}
+	if err := checkStatus(resp, http.MethodGet, "/event"); err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do performs a JSON request. body and result may be nil.
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("opencode server: marshal %s %s: %w", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(path), reader)
+	if err != nil {
+		return fmt.Errorf("opencode server: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("opencode server: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, method, path); err != nil {
+		return err
+	}
+	if result == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("opencode server: decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// endpoint returns the absolute URL for path, scoped to the directory.
+func (c *Client) endpoint(path string) string {
+	u := *c.baseURL
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	if c.directory != "" {
+		q := u.Query()
+		q.Set("directory", c.directory)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// checkStatus converts a non-2xx response into a *StatusError, consuming
+// (a bounded prefix of) the body. The body is closed on error.
+func checkStatus(resp *http.Response, method, path string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &StatusError{
+		Method:     method,
+		Path:       path,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(data)),
+	}
+}
+
+// notFound wraps 404 responses with agentrun.ErrSessionNotFound.
+func notFound(err error) error {
+	var se *StatusError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", agentrun.ErrSessionNotFound, err)
+	}
+	return err
+}
+
+// --- Wire types ---
+
+type createSessionRequest struct {
+	Title string `json:"title,omitempty"`
+}
+
+type forkRequest struct {
+	MessageID string `json:"messageID,omitempty"`
+}
+
+type modelRef struct {
+	ProviderID string `json:"providerID"`
+	ModelID    string `json:"modelID"`
+}
+
+type textPartInput struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type promptRequest struct {
+	Model *modelRef       `json:"model,omitempty"`
+	Agent string          `json:"agent,omitempty"`
+	Parts []textPartInput `json:"parts"`
+}
+
+type permissionResponse struct {
+	Response string `json:"response"`
+}
@@ -0,0 +1,44 @@
+// Package server provides an OpenCode engine backed by the HTTP API of
+// "opencode serve".
+//
+// Unlike the opencode CLI backend, which spawns "opencode run" per turn and
+// parses its nd-JSON output, this engine talks to a long-lived server: Start
+// spawns "opencode serve" (or, with WithBaseURL, attaches to a running
+// server), subscribes to its server-sent event stream and creates a session.
+// Every Send posts a prompt to that session and returns when it goes idle.
+//
+//	engine := server.NewEngine()
+//	proc, err := engine.Start(ctx, agentrun.Session{CWD: dir})
+//
+// Client exposes the session endpoints (ListSessions, GetSession,
+// CreateSession, ForkSession, Abort) for use outside a Process.
+//
+// # Streaming
+//
+// Agent text and reasoning stream as MessageTextDelta and
+// MessageThinkingDelta. Finished parts are rewritten as the CLI's events and
+// parsed by opencode.Backend, so completed text, reasoning, tool results and
+// errors match the CLI backend message for message. Tools also emit
+// MessageToolUse when they start running. Each turn ends with MessageResult
+// carrying the turn's accumulated usage and cost and any rejected
+// permissions. Output() must be drained concurrently with Send.
+//
+// Cancelling a Send's context aborts its turn; the turn still ends with
+// MessageResult, with StopReason "aborted". Stop aborts any in-flight turn
+// and terminates a spawned server; an attached server keeps running.
+//
+// # Supported options
+//
+// Cross-cutting (root package):
+//   - Session.Model → per-prompt model, as "provider/model"
+//   - Session.CWD → project directory (spawn working directory and the
+//     directory query parameter on every request)
+//   - OptionHITL → HITLOff approves every permission request; otherwise
+//     requests go to the PermissionHandler
+//   - OptionAgentID → per-prompt agent
+//   - OptionResumeID → resume an existing session; MessageInit.ResumeID
+//     carries the session ID
+//
+// Backend-specific (engine/cli/opencode): OptionTitle names new sessions and
+// OptionFork forks the resumed session instead of continuing it.
+package server
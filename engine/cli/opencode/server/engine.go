@@ -0,0 +1,139 @@
+//go:build !windows
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/cli/opencode"
+)
+
+// Engine drives OpenCode through its HTTP server API. Each Start either
+// spawns a dedicated "opencode serve" subprocess or, with WithBaseURL,
+// attaches to a running server, then opens (or resumes) one session.
+type Engine struct {
+	opts EngineOptions
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine creates an OpenCode server engine.
+func NewEngine(opts ...EngineOption) *Engine {
+	return &Engine{opts: resolveEngineOptions(opts...)}
+}
+
+// Validate checks that the configured base URL is well-formed or, when
+// spawning, that the binary is available on PATH. It does not contact the
+// server.
+func (e *Engine) Validate() error {
+	if e.opts.BaseURL != "" {
+		if _, err := NewClient(e.opts.BaseURL, nil, ""); err != nil {
+			return fmt.Errorf("%w: %w", agentrun.ErrUnavailable, err)
+		}
+		return nil
+	}
+	_, err := e.resolveBinary()
+	return err
+}
+
+// resolveBinary resolves the configured binary via PATH.
+func (e *Engine) resolveBinary() (string, error) {
+	resolved, err := exec.LookPath(e.opts.Binary)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", agentrun.ErrUnavailable, e.opts.Binary, err)
+	}
+	return resolved, nil
+}
+
+// Start connects to (or spawns) an OpenCode server, opens the event
+// stream, and creates a session — or resumes OptionResumeID, forking it
+// when opencode.OptionFork is set. Emits MessageInit with the session ID.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	startOpts := agentrun.ResolveOptions(opts...)
+	session = session.Clone()
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+	if err := e.validateSession(session); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.opts.StartupTimeout)
+	defer cancel()
+
+	srv, baseURL, err := e.connect(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewClient(baseURL, e.opts.HTTPClient, session.CWD)
+	if err != nil {
+		srv.stop(context.Background(), e.opts.GracePeriod)
+		return nil, err
+	}
+
+	p := newProcess(client, srv, session, e.opts)
+	if err := p.open(ctx); err != nil {
+		p.abandon()
+		return nil, err
+	}
+	return p, nil
+}
+
+// validateSession checks CWD, environment and option values.
+func (e *Engine) validateSession(session agentrun.Session) error {
+	if session.CWD != "" && !filepath.IsAbs(session.CWD) {
+		return fmt.Errorf("opencode server: CWD must be an absolute path, got %q", session.CWD)
+	}
+	if err := agentrun.ValidateEnv(session.Env); err != nil {
+		return fmt.Errorf("opencode server: %w", err)
+	}
+	if e.opts.BaseURL != "" && len(session.Env) > 0 {
+		return errors.New("opencode server: Session.Env is not supported when attaching to a running server")
+	}
+	if id := session.Options[agentrun.OptionResumeID]; jsonutil.ContainsNull(id) {
+		return errors.New("opencode server: resume ID contains null bytes")
+	}
+	if t := session.Options[opencode.OptionTitle]; jsonutil.ContainsNull(t) {
+		return errors.New("opencode server: title contains null bytes")
+	}
+	return nil
+}
+
+// connect returns the server to talk to: the configured base URL, or a
+// freshly spawned server (srv non-nil) scoped to the session's CWD and Env.
+func (e *Engine) connect(ctx context.Context, session agentrun.Session) (*serverProcess, string, error) {
+	if e.opts.BaseURL != "" {
+		return nil, e.opts.BaseURL, nil
+	}
+	binary, err := e.resolveBinary()
+	if err != nil {
+		return nil, "", err
+	}
+	env := agentrun.MergeEnv(os.Environ(), session.Env)
+	srv, err := spawnServer(ctx, binary, e.opts.Args, session.CWD, env)
+	if err != nil {
+		return nil, "", err
+	}
+	return srv, srv.baseURL, nil
+}
+
+// promptRequestFor builds the prompt_async body for a turn.
+// Session.Model is "provider/model"; values without a provider are skipped.
+func promptRequestFor(session agentrun.Session, message string) promptRequest {
+	req := promptRequest{Parts: []textPartInput{{Type: "text", Text: message}}}
+	if provider, model, ok := strings.Cut(session.Model, "/"); ok && provider != "" && model != "" {
+		req.Model = &modelRef{ProviderID: provider, ModelID: model}
+	}
+	if id := session.Options[agentrun.OptionAgentID]; id != "" && !jsonutil.ContainsNull(id) {
+		req.Agent = id
+	}
+	return req
+}
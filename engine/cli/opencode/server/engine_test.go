@@ -0,0 +1,767 @@
+//go:build !windows
+
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/opencode"
+	"github.com/dmora/agentrun/engine/cli/opencode/server"
+)
+
+const integrationTimeout = 10 * time.Second
+
+// --- Fake server ---
+
+// fakeServer is an httptest stand-in for "opencode serve". Prompts are
+// acknowledged immediately; onPrompt then publishes the turn's events.
+type fakeServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	subs        map[chan string]bool
+	sessions    map[string]server.Session
+	nextID      int
+	prompts     []promptBody
+	aborts      []string
+	replies     map[string]string // permission ID → response
+	directories []string
+	turns       int
+
+	onPrompt func(f *fakeServer, sessionID, text string)
+	onAbort  func(f *fakeServer, sessionID string)
+	onReply  func(f *fakeServer, sessionID, permissionID, response string)
+}
+
+type promptBody struct {
+	Model *struct {
+		ProviderID string `json:"providerID"`
+		ModelID    string `json:"modelID"`
+	} `json:"model"`
+	Agent string `json:"agent"`
+	Parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"parts"`
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	f := &fakeServer{
+		subs:     make(map[chan string]bool),
+		sessions: make(map[string]server.Session),
+		replies:  make(map[string]string),
+		onPrompt: replyTurn,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /event", f.handleEvents)
+	mux.HandleFunc("GET /session", f.handleList)
+	mux.HandleFunc("POST /session", f.handleCreate)
+	mux.HandleFunc("GET /session/{id}", f.handleGet)
+	mux.HandleFunc("POST /session/{id}/fork", f.handleFork)
+	mux.HandleFunc("POST /session/{id}/abort", f.handleAbort)
+	mux.HandleFunc("POST /session/{id}/prompt_async", f.handlePrompt)
+	mux.HandleFunc("POST /session/{id}/permissions/{pid}", f.handlePermission)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		f.closeStreams()
+		f.Close()
+	})
+	return f
+}
+
+func (f *fakeServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ch := make(chan string, 1024)
+	f.mu.Lock()
+	f.subs[ch] = true
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case data, ok := <-ch:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			f.mu.Lock()
+			delete(f.subs, ch)
+			f.mu.Unlock()
+			return
+		}
+	}
+}
+
+// closeStreams ends every open event stream.
+func (f *fakeServer) closeStreams() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		close(ch)
+		delete(f.subs, ch)
+	}
+}
+
+// publish sends a bus event to every subscriber.
+func (f *fakeServer) publish(typ string, props any) {
+	data, _ := json.Marshal(map[string]any{"type": typ, "properties": props})
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs {
+		ch <- string(data)
+	}
+}
+
+func (f *fakeServer) recordDirectory(r *http.Request) {
+	f.mu.Lock()
+	f.directories = append(f.directories, r.URL.Query().Get("directory"))
+	f.mu.Unlock()
+}
+
+func (f *fakeServer) addSession(parentID, title string) server.Session {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	s := server.Session{ID: fmt.Sprintf("ses_%03d", f.nextID), Title: title, ParentID: parentID}
+	f.sessions[s.ID] = s
+	return s
+}
+
+func (f *fakeServer) lookup(w http.ResponseWriter, r *http.Request) (server.Session, bool) {
+	f.mu.Lock()
+	s, ok := f.sessions[r.PathValue("id")]
+	f.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"name":"NotFoundError"}`, http.StatusNotFound)
+	}
+	return s, ok
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeServer) handleList(w http.ResponseWriter, r *http.Request) {
+	f.recordDirectory(r)
+	f.mu.Lock()
+	list := make([]server.Session, 0, len(f.sessions))
+	for _, s := range f.sessions {
+		list = append(list, s)
+	}
+	f.mu.Unlock()
+	writeJSON(w, list)
+}
+
+func (f *fakeServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	f.recordDirectory(r)
+	var body struct {
+		Title string `json:"title"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	writeJSON(w, f.addSession("", body.Title))
+}
+
+func (f *fakeServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if s, ok := f.lookup(w, r); ok {
+		writeJSON(w, s)
+	}
+}
+
+func (f *fakeServer) handleFork(w http.ResponseWriter, r *http.Request) {
+	if s, ok := f.lookup(w, r); ok {
+		writeJSON(w, f.addSession(s.ID, s.Title))
+	}
+}
+
+func (f *fakeServer) handleAbort(w http.ResponseWriter, r *http.Request) {
+	s, ok := f.lookup(w, r)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	f.aborts = append(f.aborts, s.ID)
+	onAbort := f.onAbort
+	f.mu.Unlock()
+	writeJSON(w, true)
+	if onAbort != nil {
+		go onAbort(f, s.ID)
+	}
+}
+
+func (f *fakeServer) handlePrompt(w http.ResponseWriter, r *http.Request) {
+	s, ok := f.lookup(w, r)
+	if !ok {
+		return
+	}
+	var body promptBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Parts) == 0 {
+		http.Error(w, "bad prompt", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.prompts = append(f.prompts, body)
+	onPrompt := f.onPrompt
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+	go onPrompt(f, s.ID, body.Parts[0].Text)
+}
+
+func (f *fakeServer) handlePermission(w http.ResponseWriter, r *http.Request) {
+	s, ok := f.lookup(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Response string `json:"response"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	pid := r.PathValue("pid")
+	f.mu.Lock()
+	f.replies[pid] = body.Response
+	onReply := f.onReply
+	f.mu.Unlock()
+	writeJSON(w, true)
+	if onReply != nil {
+		go onReply(f, s.ID, pid, body.Response)
+	}
+}
+
+// --- Scripted turns ---
+
+func (f *fakeServer) part(p map[string]any, delta string) {
+	props := map[string]any{"part": p}
+	if delta != "" {
+		props["delta"] = delta
+	}
+	f.publish("message.part.updated", props)
+}
+
+func (f *fakeServer) idle(sessionID string) {
+	f.publish("session.idle", map[string]any{"sessionID": sessionID})
+}
+
+// replyTurn echoes the prompt back as a user message, then streams an
+// assistant text reply, one tool call and a step-finish with usage.
+// Events for an unrelated session are interleaved and must be ignored.
+func replyTurn(f *fakeServer, sid, text string) {
+	f.mu.Lock()
+	f.turns++
+	n := f.turns
+	f.mu.Unlock()
+	id := func(prefix string) string { return fmt.Sprintf("%s_%d", prefix, n) }
+	f.publish("message.updated", map[string]any{"info": map[string]any{"id": id("msg_u"), "sessionID": sid, "role": "user"}})
+	f.part(map[string]any{"id": id("prt_u"), "sessionID": sid, "messageID": id("msg_u"), "type": "text", "text": text, "time": map[string]any{"start": 1, "end": 1}}, "")
+	f.publish("message.updated", map[string]any{"info": map[string]any{"id": id("msg_a"), "sessionID": sid, "role": "assistant"}})
+	f.part(map[string]any{"id": id("prt_x"), "sessionID": "ses_other", "messageID": id("msg_x"), "type": "text", "text": "other", "time": map[string]any{"start": 1, "end": 2}}, "other")
+	f.part(map[string]any{"id": id("prt_1"), "sessionID": sid, "messageID": id("msg_a"), "type": "text", "text": "Hel", "time": map[string]any{"start": 1}}, "Hel")
+	f.part(map[string]any{"id": id("prt_1"), "sessionID": sid, "messageID": id("msg_a"), "type": "text", "text": "Hello", "time": map[string]any{"start": 1, "end": 2}}, "lo")
+	tool := map[string]any{"id": id("prt_2"), "sessionID": sid, "messageID": id("msg_a"), "type": "tool", "tool": "bash", "callID": "call_1"}
+	tool["state"] = map[string]any{"status": "running", "input": map[string]any{"command": "ls"}}
+	f.part(tool, "")
+	tool["state"] = map[string]any{"status": "completed", "input": map[string]any{"command": "ls"}, "output": "a.go"}
+	f.part(tool, "")
+	f.part(map[string]any{"id": id("prt_3"), "sessionID": sid, "messageID": id("msg_a"), "type": "step-finish", "cost": 0.25, "tokens": map[string]any{"input": 100, "output": 20, "reasoning": 5, "cache": map[string]any{"read": 7, "write": 0}}}, "")
+	f.idle("ses_other")
+	f.idle(sid)
+}
+
+// --- Helpers ---
+
+// start attaches to f and registers cleanup. The first message
+// (MessageInit) is returned alongside the process.
+func start(t *testing.T, f *fakeServer, session agentrun.Session, opts ...server.EngineOption) (agentrun.Process, agentrun.Message, context.Context) {
+	t.Helper()
+	engine := server.NewEngine(append([]server.EngineOption{server.WithBaseURL(f.URL)}, opts...)...)
+	return startEngine(t, engine, session)
+}
+
+func startEngine(t *testing.T, engine *server.Engine, session agentrun.Session) (agentrun.Process, agentrun.Message, context.Context) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), integrationTimeout)
+	t.Cleanup(cancel)
+	proc, err := engine.Start(ctx, session)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc, <-proc.Output(), ctx
+}
+
+// runTurn sends message and collects output through MessageResult.
+func runTurn(t *testing.T, ctx context.Context, proc agentrun.Process, message string) []agentrun.Message {
+	t.Helper()
+	var msgs []agentrun.Message
+	err := agentrun.RunTurn(ctx, proc, message, func(m agentrun.Message) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	return msgs
+}
+
+func ofType(msgs []agentrun.Message, mt agentrun.MessageType) []agentrun.Message {
+	var out []agentrun.Message
+	for _, m := range msgs {
+		if m.Type == mt {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func lastResult(t *testing.T, msgs []agentrun.Message) agentrun.Message {
+	t.Helper()
+	if len(msgs) == 0 || msgs[len(msgs)-1].Type != agentrun.MessageResult {
+		t.Fatalf("turn did not end with MessageResult: %+v", msgs)
+	}
+	return msgs[len(msgs)-1]
+}
+
+// --- Start ---
+
+func TestEngine_Start_CreatesSession(t *testing.T) {
+	f := newFakeServer(t)
+	cwd := t.TempDir()
+	_, init, _ := start(t, f, agentrun.Session{
+		CWD:     cwd,
+		Options: map[string]string{opencode.OptionTitle: "refactor"},
+	})
+	if init.Type != agentrun.MessageInit || init.ResumeID != "ses_001" {
+		t.Fatalf("init = %+v", init)
+	}
+	if init.Init == nil || init.Init.AgentName != "opencode" {
+		t.Errorf("Init = %+v", init.Init)
+	}
+	if init.Process != nil {
+		t.Errorf("Process = %+v, want nil when attached", init.Process)
+	}
+
+	client, err := server.NewClient(f.URL, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := client.GetSession(context.Background(), "ses_001")
+	if err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+	if s.Title != "refactor" {
+		t.Errorf("title = %q", s.Title)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.directories) == 0 || f.directories[0] != cwd {
+		t.Errorf("directory query = %q, want %q", f.directories, cwd)
+	}
+}
+
+func TestEngine_Start_Resume(t *testing.T) {
+	f := newFakeServer(t)
+	existing := f.addSession("", "old")
+	_, init, _ := start(t, f, agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: existing.ID},
+	})
+	if init.ResumeID != existing.ID {
+		t.Errorf("ResumeID = %q, want %q", init.ResumeID, existing.ID)
+	}
+}
+
+func TestEngine_Start_ResumeNotFound(t *testing.T) {
+	f := newFakeServer(t)
+	engine := server.NewEngine(server.WithBaseURL(f.URL))
+	_, err := engine.Start(context.Background(), agentrun.Session{
+		Options: map[string]string{agentrun.OptionResumeID: "ses_missing"},
+	})
+	if !errors.Is(err, agentrun.ErrSessionNotFound) {
+		t.Fatalf("err = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestEngine_Start_Fork(t *testing.T) {
+	f := newFakeServer(t)
+	existing := f.addSession("", "old")
+	_, init, _ := start(t, f, agentrun.Session{
+		Options: map[string]string{
+			agentrun.OptionResumeID: existing.ID,
+			opencode.OptionFork:     "true",
+		},
+	})
+	if init.ResumeID == existing.ID || init.ResumeID == "" {
+		t.Fatalf("ResumeID = %q, want a new forked session", init.ResumeID)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sessions[init.ResumeID].ParentID != existing.ID {
+		t.Errorf("fork parent = %q, want %q", f.sessions[init.ResumeID].ParentID, existing.ID)
+	}
+}
+
+func TestEngine_Start_InvalidSession(t *testing.T) {
+	f := newFakeServer(t)
+	engine := server.NewEngine(server.WithBaseURL(f.URL))
+	tests := []struct {
+		name    string
+		session agentrun.Session
+	}{
+		{"relative CWD", agentrun.Session{CWD: "rel"}},
+		{"env when attached", agentrun.Session{Env: map[string]string{"A": "1"}}},
+		{"null resume ID", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: "a\x00b"}}},
+		{"null title", agentrun.Session{Options: map[string]string{opencode.OptionTitle: "a\x00b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := engine.Start(context.Background(), tt.session); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestEngine_Validate(t *testing.T) {
+	if err := server.NewEngine(server.WithBaseURL("ftp://x")).Validate(); !errors.Is(err, agentrun.ErrUnavailable) {
+		t.Errorf("bad URL: err = %v, want ErrUnavailable", err)
+	}
+	if err := server.NewEngine(server.WithBaseURL("http://127.0.0.1:1")).Validate(); err != nil {
+		t.Errorf("valid URL: %v", err)
+	}
+	if err := server.NewEngine(server.WithBinary("agentrun-no-such-opencode")).Validate(); !errors.Is(err, agentrun.ErrUnavailable) {
+		t.Errorf("missing binary: err = %v, want ErrUnavailable", err)
+	}
+}
+
+// --- Turns ---
+
+func TestEngine_Send_StreamsTurn(t *testing.T) {
+	f := newFakeServer(t)
+	proc, _, ctx := start(t, f, agentrun.Session{
+		Model:   "anthropic/claude-sonnet",
+		Options: map[string]string{agentrun.OptionAgentID: "build"},
+	})
+	msgs := runTurn(t, ctx, proc, "list files")
+
+	var types []agentrun.MessageType
+	for _, m := range msgs {
+		types = append(types, m.Type)
+	}
+	want := []agentrun.MessageType{
+		agentrun.MessageTextDelta, agentrun.MessageTextDelta, agentrun.MessageText,
+		agentrun.MessageToolUse, agentrun.MessageToolResult, agentrun.MessageResult,
+	}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Fatalf("types = %v, want %v", types, want)
+	}
+	if text := ofType(msgs, agentrun.MessageText); text[0].Content != "Hello" {
+		t.Errorf("text = %q", text[0].Content)
+	}
+	if tool := ofType(msgs, agentrun.MessageToolResult)[0].Tool; tool.Name != "bash" || string(tool.Output) != `"a.go"` {
+		t.Errorf("tool = %+v", tool)
+	}
+
+	result := lastResult(t, msgs)
+	if result.StopReason != agentrun.StopEndTurn {
+		t.Errorf("StopReason = %q", result.StopReason)
+	}
+	wantUsage := agentrun.Usage{InputTokens: 100, OutputTokens: 20, ThinkingTokens: 5, CacheReadTokens: 7, CostUSD: 0.25}
+	if result.Usage == nil || *result.Usage != wantUsage {
+		t.Errorf("Usage = %+v, want %+v", result.Usage, wantUsage)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := f.prompts[0]
+	if p.Model == nil || p.Model.ProviderID != "anthropic" || p.Model.ModelID != "claude-sonnet" {
+		t.Errorf("model = %+v", p.Model)
+	}
+	if p.Agent != "build" || p.Parts[0].Text != "list files" {
+		t.Errorf("prompt = %+v", p)
+	}
+}
+
+func TestEngine_Send_MultipleTurns(t *testing.T) {
+	f := newFakeServer(t)
+	proc, _, ctx := start(t, f, agentrun.Session{})
+	for i := range 3 {
+		msgs := runTurn(t, ctx, proc, fmt.Sprintf("turn %d", i))
+		if lastResult(t, msgs).Usage.InputTokens != 100 {
+			t.Errorf("turn %d: usage not reset between turns", i)
+		}
+	}
+}
+
+func TestEngine_Send_SessionError(t *testing.T) {
+	f := newFakeServer(t)
+	f.onPrompt = func(f *fakeServer, sid, _ string) {
+		f.publish("session.error", map[string]any{"sessionID": sid, "error": map[string]any{"name": "ProviderAuthError", "data": map[string]any{"message": "invalid key"}}})
+		f.idle(sid)
+	}
+	proc, _, ctx := start(t, f, agentrun.Session{})
+	msgs := runTurn(t, ctx, proc, "hi")
+	errs := ofType(msgs, agentrun.MessageError)
+	if len(errs) != 1 || errs[0].ErrorCode != "ProviderAuthError" || errs[0].Content != "invalid key" {
+		t.Fatalf("errors = %+v", errs)
+	}
+	lastResult(t, msgs)
+}
+
+func TestEngine_Send_CancelAbortsTurn(t *testing.T) {
+	f := newFakeServer(t)
+	f.onPrompt = func(*fakeServer, string, string) {} // never finishes on its own
+	f.onAbort = func(f *fakeServer, sid string) {
+		f.publish("session.error", map[string]any{"sessionID": sid, "error": map[string]any{"name": "MessageAbortedError"}})
+		f.idle(sid)
+	}
+	proc, _, ctx := start(t, f, agentrun.Session{})
+
+	sendCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := proc.Send(sendCtx, "long task"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send err = %v, want DeadlineExceeded", err)
+	}
+
+	// The aborted turn still completes, without surfacing the abort error.
+	for m := range proc.Output() {
+		if m.Type == agentrun.MessageError {
+			t.Fatalf("unexpected error message: %+v", m)
+		}
+		if m.Type == agentrun.MessageResult {
+			if m.StopReason != "aborted" {
+				t.Errorf("StopReason = %q, want aborted", m.StopReason)
+			}
+			break
+		}
+	}
+	f.mu.Lock()
+	aborts := len(f.aborts)
+	f.mu.Unlock()
+	if aborts != 1 {
+		t.Errorf("aborts = %d, want 1", aborts)
+	}
+
+	// The session is usable again.
+	f.mu.Lock()
+	f.onPrompt = replyTurn
+	f.mu.Unlock()
+	lastResult(t, runTurn(t, ctx, proc, "again"))
+}
+
+// permissionTurn asks for a bash permission and finishes once answered.
+func permissionTurn(f *fakeServer, sid, _ string) {
+	f.publish("permission.updated", map[string]any{"id": "per_1", "sessionID": sid, "type": "bash", "title": "rm -rf build", "callID": "call_1"})
+}
+
+func finishOnReply(f *fakeServer, sid, _, _ string) { f.idle(sid) }
+
+func TestEngine_Permission(t *testing.T) {
+	tests := []struct {
+		name        string
+		hitl        agentrun.HITL
+		handler     server.PermissionHandler
+		wantReply   string
+		wantDenials int
+	}{
+		{"hitl off", agentrun.HITLOff, nil, "once", 0},
+		{"no handler", agentrun.HITLOn, nil, "reject", 1},
+		{"approve", agentrun.HITLOn, func(context.Context, server.PermissionRequest) (bool, error) { return true, nil }, "once", 0},
+		{"deny", agentrun.HITLOn, func(context.Context, server.PermissionRequest) (bool, error) { return false, nil }, "reject", 1},
+		{"panic", agentrun.HITLOn, func(context.Context, server.PermissionRequest) (bool, error) { panic("boom") }, "reject", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeServer(t)
+			f.onPrompt = permissionTurn
+			f.onReply = finishOnReply
+			var opts []server.EngineOption
+			if tt.handler != nil {
+				opts = append(opts, server.WithPermissionHandler(tt.handler))
+			}
+			proc, _, ctx := start(t, f, agentrun.Session{
+				Options: map[string]string{agentrun.OptionHITL: string(tt.hitl)},
+			}, opts...)
+			result := lastResult(t, runTurn(t, ctx, proc, "clean"))
+
+			f.mu.Lock()
+			reply := f.replies["per_1"]
+			f.mu.Unlock()
+			if reply != tt.wantReply {
+				t.Errorf("reply = %q, want %q", reply, tt.wantReply)
+			}
+			if len(result.Denials) != tt.wantDenials {
+				t.Errorf("denials = %+v, want %d", result.Denials, tt.wantDenials)
+			}
+			if tt.wantDenials > 0 && result.Denials[0].Tool != "bash" {
+				t.Errorf("denial tool = %q", result.Denials[0].Tool)
+			}
+		})
+	}
+}
+
+func TestEngine_PermissionHandler_Request(t *testing.T) {
+	f := newFakeServer(t)
+	f.onPrompt = permissionTurn
+	f.onReply = finishOnReply
+	got := make(chan server.PermissionRequest, 1)
+	proc, init, ctx := start(t, f, agentrun.Session{}, server.WithPermissionHandler(
+		func(_ context.Context, req server.PermissionRequest) (bool, error) {
+			got <- req
+			return true, nil
+		}))
+	runTurn(t, ctx, proc, "clean")
+	req := <-got
+	want := server.PermissionRequest{SessionID: init.ResumeID, PermissionID: "per_1", Type: "bash", Title: "rm -rf build", CallID: "call_1"}
+	if req != want {
+		t.Errorf("request = %+v, want %+v", req, want)
+	}
+}
+
+// --- Lifecycle ---
+
+func TestEngine_Stop_Attached(t *testing.T) {
+	f := newFakeServer(t)
+	f.onPrompt = func(*fakeServer, string, string) {}
+	proc, init, ctx := start(t, f, agentrun.Session{})
+
+	sendErr := make(chan error, 1)
+	go func() { sendErr <- proc.Send(ctx, "long task") }()
+	for {
+		f.mu.Lock()
+		n := len(f.prompts)
+		f.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := proc.Stop(ctx); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+	if err := <-sendErr; !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send = %v, want ErrTerminated", err)
+	}
+	if err := proc.Send(ctx, "x"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send after Stop = %v, want ErrTerminated", err)
+	}
+	f.mu.Lock()
+	aborts := f.aborts
+	f.mu.Unlock()
+	if len(aborts) != 1 || aborts[0] != init.ResumeID {
+		t.Errorf("aborts = %v, want [%s]", aborts, init.ResumeID)
+	}
+
+	// The attached server keeps running.
+	client, _ := server.NewClient(f.URL, nil, "")
+	if _, err := client.ListSessions(ctx); err != nil {
+		t.Errorf("ListSessions after Stop: %v", err)
+	}
+}
+
+func TestEngine_StreamClosed(t *testing.T) {
+	f := newFakeServer(t)
+	proc, _, _ := start(t, f, agentrun.Session{})
+	f.closeStreams()
+	err := proc.Wait()
+	if err == nil || errors.Is(err, agentrun.ErrTerminated) {
+		t.Fatalf("Wait = %v, want stream error", err)
+	}
+	if !strings.Contains(err.Error(), "event stream") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// spawnScript writes a stand-in for "opencode serve" running body.
+func spawnScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "opencode")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil { //nolint:gosec // test script must be executable
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func TestEngine_Spawn(t *testing.T) {
+	f := newFakeServer(t)
+	binary := spawnScript(t, fmt.Sprintf("echo \"opencode server listening on %s\"\nexec sleep 30", f.URL))
+	engine := server.NewEngine(server.WithBinary(binary), server.WithGracePeriod(time.Second))
+	proc, init, ctx := startEngine(t, engine, agentrun.Session{})
+	if init.Process == nil || init.Process.PID <= 0 {
+		t.Fatalf("Process = %+v, want subprocess metadata", init.Process)
+	}
+	lastResult(t, runTurn(t, ctx, proc, "hi"))
+	if err := proc.Stop(ctx); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+}
+
+func TestEngine_Spawn_ExitsEarly(t *testing.T) {
+	binary := spawnScript(t, "echo 'config error' >&2\nexit 3")
+	engine := server.NewEngine(server.WithBinary(binary))
+	_, err := engine.Start(context.Background(), agentrun.Session{})
+	var exitErr *agentrun.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("err = %v, want ExitError code 3", err)
+	}
+}
+
+// --- Client ---
+
+func TestClient_ListSessions(t *testing.T) {
+	f := newFakeServer(t)
+	f.addSession("", "a")
+	f.addSession("", "b")
+	client, err := server.NewClient(f.URL+"/", nil, "/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := client.ListSessions(context.Background())
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("got %d sessions, want 2", len(sessions))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.directories[0] != "/work" {
+		t.Errorf("directory = %q", f.directories[0])
+	}
+}
+
+func TestClient_StatusError(t *testing.T) {
+	f := newFakeServer(t)
+	client, _ := server.NewClient(f.URL, nil, "")
+	err := client.Abort(context.Background(), "ses_missing")
+	var se *server.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Fatalf("err = %v, want 404 StatusError", err)
+	}
+	if !strings.Contains(se.Error(), "NotFoundError") {
+		t.Errorf("Error() = %q, want body included", se.Error())
+	}
+}
+
+func TestNewClient_InvalidURL(t *testing.T) {
+	for _, u := range []string{"", "ftp://host", "://bad"} {
+		if _, err := server.NewClient(u, nil, ""); err == nil {
+			t.Errorf("NewClient(%q): expected error", u)
+		}
+	}
+}
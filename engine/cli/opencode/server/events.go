@@ -0,0 +1,295 @@
+// events.go reads the server's SSE stream and maps its events onto the
+// opencode CLI backend's nd-JSON vocabulary.
+//
+// The server publishes bus events ({"type": ..., "properties": ...}). Parts
+// carry the same shapes "opencode run --format json" prints, so finished
+// text, reasoning and tool parts are rewritten as CLI events (text,
+// reasoning, tool_use, error) and parsed by opencode.Backend.ParseLine —
+// both engines produce identical messages for the same content. Streaming
+// deltas, tool starts and turn completion have no CLI equivalent and are
+// mapped here directly.
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/opencode"
+)
+
+// Bus event types consumed by the engine.
+const (
+	eventPartUpdated    = "message.part.updated"
+	eventMessageUpdated = "message.updated"
+	eventSessionIdle    = "session.idle"
+	eventSessionError   = "session.error"
+	eventPermission     = "permission.updated"
+)
+
+// event is one server-sent bus event.
+type event struct {
+	Type       string          `json:"type"`
+	Properties json.RawMessage `json:"properties"`
+}
+
+// readEvents parses a text/event-stream body and calls fn for each event's
+// JSON data. Multi-line data fields are joined with "\n" per the SSE spec;
+// comments and non-data fields are ignored. Returns nil at EOF.
+func readEvents(r io.Reader, maxSize int, fn func(data []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64<<10, maxSize)), maxSize)
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if len(data) > 0 {
+				fn(data)
+				data = nil
+			}
+			continue
+		}
+		value, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue // comment, event:, id:, retry:
+		}
+		value = bytes.TrimPrefix(value, []byte(" "))
+		if len(data) > 0 {
+			data = append(data, '\n')
+		}
+		data = append(data, value...)
+	}
+	if len(data) > 0 {
+		fn(data)
+	}
+	return scanner.Err()
+}
+
+// --- Wire shapes ---
+
+type partTime struct {
+	Start int64 `json:"start,omitempty"`
+	End   int64 `json:"end,omitempty"`
+}
+
+type toolState struct {
+	Status string          `json:"status"`
+	Input  json.RawMessage `json:"input,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type tokenCache struct {
+	Read  int `json:"read"`
+	Write int `json:"write"`
+}
+
+type partTokens struct {
+	Input     int        `json:"input"`
+	Output    int        `json:"output"`
+	Reasoning int        `json:"reasoning"`
+	Cache     tokenCache `json:"cache"`
+}
+
+// part is a message part (text, reasoning, tool, step-start, step-finish, ...).
+type part struct {
+	ID        string      `json:"id"`
+	SessionID string      `json:"sessionID"`
+	MessageID string      `json:"messageID"`
+	Type      string      `json:"type"`
+	Text      string      `json:"text,omitempty"`
+	Tool      string      `json:"tool,omitempty"`
+	CallID    string      `json:"callID,omitempty"`
+	State     *toolState  `json:"state,omitempty"`
+	Time      *partTime   `json:"time,omitempty"`
+	Tokens    *partTokens `json:"tokens,omitempty"`
+	Cost      float64     `json:"cost,omitempty"`
+}
+
+type partUpdated struct {
+	Part  part   `json:"part"`
+	Delta string `json:"delta,omitempty"`
+}
+
+type messageInfo struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionID"`
+	Role      string `json:"role"`
+}
+
+type messageUpdated struct {
+	Info messageInfo `json:"info"`
+}
+
+type sessionEvent struct {
+	SessionID string          `json:"sessionID"`
+	Error     json.RawMessage `json:"error,omitempty"`
+}
+
+type permissionEvent struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionID"`
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	CallID    string `json:"callID,omitempty"`
+}
+
+// --- Translation ---
+
+// translator maps one session's part events to messages. Not safe for
+// concurrent use; the event loop owns it.
+type translator struct {
+	parser   *opencode.Backend
+	users    map[string]bool // message IDs with role "user"
+	finished map[string]bool // part IDs already emitted as complete
+	started  map[string]bool // tool part IDs already emitted as MessageToolUse
+	usage    *agentrun.Usage // accumulated step-finish usage for the current turn
+}
+
+func newTranslator() *translator {
+	return &translator{
+		parser:   opencode.New(),
+		users:    make(map[string]bool),
+		finished: make(map[string]bool),
+		started:  make(map[string]bool),
+	}
+}
+
+// messageUpdated records message roles so user parts (our own prompt
+// echoed back) are not reported as agent output.
+func (tr *translator) messageUpdated(m *messageUpdated) {
+	if m.Info.Role == "user" {
+		tr.users[m.Info.ID] = true
+	}
+}
+
+// partUpdated maps a part update to zero or more messages.
+func (tr *translator) partUpdated(u *partUpdated, raw json.RawMessage) []agentrun.Message {
+	p := &u.Part
+	if tr.users[p.MessageID] || tr.finished[p.ID] {
+		return nil
+	}
+	switch p.Type {
+	case "text":
+		return tr.streamed(p, u.Delta, agentrun.MessageTextDelta, "text", raw)
+	case "reasoning":
+		return tr.streamed(p, u.Delta, agentrun.MessageThinkingDelta, "reasoning", raw)
+	case "tool":
+		return tr.tool(p, raw)
+	case "step-finish":
+		tr.finished[p.ID] = true
+		tr.addUsage(p)
+	}
+	return nil
+}
+
+// streamed emits a delta while the part streams and the complete block
+// (via the CLI parser) once the part has ended.
+func (tr *translator) streamed(p *part, delta string, deltaType agentrun.MessageType, cliType string, raw json.RawMessage) []agentrun.Message {
+	var out []agentrun.Message
+	if delta != "" {
+		out = append(out, agentrun.Message{Type: deltaType, Content: delta, Timestamp: time.Now()})
+	}
+	if p.Time != nil && p.Time.End > 0 {
+		tr.finished[p.ID] = true
+		out = append(out, tr.parse(cliType, p, raw))
+	}
+	return out
+}
+
+// tool emits MessageToolUse when a tool starts running and the CLI's
+// tool_use event (MessageToolResult) once it completes or fails.
+func (tr *translator) tool(p *part, raw json.RawMessage) []agentrun.Message {
+	if p.State == nil {
+		return nil
+	}
+	switch p.State.Status {
+	case "running":
+		if tr.started[p.ID] {
+			return nil
+		}
+		tr.started[p.ID] = true
+		return []agentrun.Message{{
+			Type:      agentrun.MessageToolUse,
+			Tool:      &agentrun.ToolCall{Name: p.Tool, Input: p.State.Input},
+			Raw:       raw,
+			Timestamp: time.Now(),
+		}}
+	case "completed", "error":
+		tr.finished[p.ID] = true
+		return []agentrun.Message{tr.parse("tool_use", p, raw)}
+	}
+	return nil
+}
+
+// parse rewrites p as a CLI event of the given type and runs it through the
+// opencode parser. Raw is replaced with the original server event.
+func (tr *translator) parse(cliType string, p *part, raw json.RawMessage) agentrun.Message {
+	return tr.parseLine(map[string]any{
+		"type":      cliType,
+		"timestamp": time.Now().UnixMilli(),
+		"sessionID": p.SessionID,
+		"part":      p,
+	}, raw)
+}
+
+// sessionError maps a session.error payload through the CLI "error" event.
+func (tr *translator) sessionError(e *sessionEvent, raw json.RawMessage) agentrun.Message {
+	var errObj any = map[string]any{"name": "UnknownError"}
+	if len(e.Error) > 0 {
+		errObj = e.Error
+	}
+	return tr.parseLine(map[string]any{
+		"type":      "error",
+		"timestamp": time.Now().UnixMilli(),
+		"sessionID": e.SessionID,
+		"error":     errObj,
+	}, raw)
+}
+
+// parseLine marshals a CLI event and parses it with the opencode backend.
+func (tr *translator) parseLine(cliEvent map[string]any, raw json.RawMessage) agentrun.Message {
+	line, err := json.Marshal(cliEvent)
+	if err != nil {
+		return agentrun.Message{
+			Type:      agentrun.MessageError,
+			Content:   fmt.Sprintf("opencode server: marshal event: %v", err),
+			Timestamp: time.Now(),
+		}
+	}
+	msg, err := tr.parser.ParseLine(string(line))
+	if err != nil {
+		return agentrun.Message{Type: agentrun.MessageError, Content: err.Error(), Timestamp: time.Now()}
+	}
+	msg.Raw = raw
+	return msg
+}
+
+// addUsage accumulates a step-finish part's tokens and cost.
+func (tr *translator) addUsage(p *part) {
+	if p.Tokens == nil && p.Cost == 0 {
+		return
+	}
+	if tr.usage == nil {
+		tr.usage = &agentrun.Usage{}
+	}
+	if t := p.Tokens; t != nil {
+		tr.usage.InputTokens += t.Input
+		tr.usage.OutputTokens += t.Output
+		tr.usage.ThinkingTokens += t.Reasoning
+		tr.usage.CacheReadTokens += t.Cache.Read
+		tr.usage.CacheWriteTokens += t.Cache.Write
+	}
+	tr.usage.CostUSD += p.Cost
+}
+
+// takeUsage returns and resets the accumulated turn usage.
+func (tr *translator) takeUsage() *agentrun.Usage {
+	u := tr.usage
+	tr.usage = nil
+	return u
+}
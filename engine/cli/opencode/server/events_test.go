@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestReadEvents(t *testing.T) {
+	stream := ": keepalive\n" +
+		"event: message\n" +
+		"data: {\"a\":1}\n" +
+		"\n" +
+		"data:{\"b\":\n" +
+		"data: 2}\n" +
+		"id: 7\n" +
+		"\n" +
+		"\n" +
+		"data: {\"c\":3}" // no trailing blank line
+	var got []string
+	if err := readEvents(strings.NewReader(stream), 1<<10, func(data []byte) {
+		got = append(got, string(data))
+	}); err != nil {
+		t.Fatalf("readEvents: %v", err)
+	}
+	want := []string{`{"a":1}`, "{\"b\":\n2}", `{"c":3}`}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadEvents_TooLarge(t *testing.T) {
+	stream := "data: " + strings.Repeat("x", 256) + "\n\n"
+	err := readEvents(strings.NewReader(stream), 64, func([]byte) {})
+	if err == nil {
+		t.Fatal("expected error for oversized event")
+	}
+}
+
+// update decodes a message.part.updated properties payload.
+func update(t *testing.T, props string) (*partUpdated, json.RawMessage) {
+	t.Helper()
+	var u partUpdated
+	if err := json.Unmarshal([]byte(props), &u); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return &u, json.RawMessage(props)
+}
+
+func TestTranslator_TextStreaming(t *testing.T) {
+	tr := newTranslator()
+
+	u, raw := update(t, `{"part":{"id":"p1","sessionID":"s","messageID":"m","type":"text","text":"Hel","time":{"start":1}},"delta":"Hel"}`)
+	msgs := tr.partUpdated(u, raw)
+	if len(msgs) != 1 || msgs[0].Type != agentrun.MessageTextDelta || msgs[0].Content != "Hel" {
+		t.Fatalf("delta: got %+v", msgs)
+	}
+
+	u, raw = update(t, `{"part":{"id":"p1","sessionID":"s","messageID":"m","type":"text","text":"Hello","time":{"start":1,"end":2}},"delta":"lo"}`)
+	msgs = tr.partUpdated(u, raw)
+	if len(msgs) != 2 {
+		t.Fatalf("final: got %d messages, want 2", len(msgs))
+	}
+	if msgs[0].Type != agentrun.MessageTextDelta || msgs[0].Content != "lo" {
+		t.Errorf("final delta = %+v", msgs[0])
+	}
+	if msgs[1].Type != agentrun.MessageText || msgs[1].Content != "Hello" {
+		t.Errorf("final text = %+v", msgs[1])
+	}
+	if string(msgs[1].Raw) != string(raw) {
+		t.Errorf("Raw = %s, want server event", msgs[1].Raw)
+	}
+
+	// Updates after completion are ignored.
+	if msgs := tr.partUpdated(u, raw); len(msgs) != 0 {
+		t.Errorf("repeat: got %+v, want none", msgs)
+	}
+}
+
+func TestTranslator_Reasoning(t *testing.T) {
+	tr := newTranslator()
+	u, raw := update(t, `{"part":{"id":"r1","sessionID":"s","messageID":"m","type":"reasoning","text":"hmm","time":{"start":1,"end":2}},"delta":"hmm"}`)
+	msgs := tr.partUpdated(u, raw)
+	if len(msgs) != 2 || msgs[0].Type != agentrun.MessageThinkingDelta || msgs[1].Type != agentrun.MessageThinking {
+		t.Fatalf("got %+v", msgs)
+	}
+	if msgs[1].Content != "hmm" {
+		t.Errorf("thinking = %q", msgs[1].Content)
+	}
+}
+
+func TestTranslator_UserPartsSkipped(t *testing.T) {
+	tr := newTranslator()
+	tr.messageUpdated(&messageUpdated{Info: messageInfo{ID: "u1", SessionID: "s", Role: "user"}})
+	u, raw := update(t, `{"part":{"id":"p","sessionID":"s","messageID":"u1","type":"text","text":"prompt","time":{"start":1,"end":2}}}`)
+	if msgs := tr.partUpdated(u, raw); len(msgs) != 0 {
+		t.Errorf("got %+v, want none for user part", msgs)
+	}
+}
+
+func TestTranslator_Tool(t *testing.T) {
+	tr := newTranslator()
+
+	pending, raw := update(t, `{"part":{"id":"t1","sessionID":"s","messageID":"m","type":"tool","tool":"bash","callID":"c1","state":{"status":"pending"}}}`)
+	if msgs := tr.partUpdated(pending, raw); len(msgs) != 0 {
+		t.Errorf("pending: got %+v, want none", msgs)
+	}
+
+	running, raw := update(t, `{"part":{"id":"t1","sessionID":"s","messageID":"m","type":"tool","tool":"bash","callID":"c1","state":{"status":"running","input":{"command":"ls"}}}}`)
+	msgs := tr.partUpdated(running, raw)
+	if len(msgs) != 1 || msgs[0].Type != agentrun.MessageToolUse {
+		t.Fatalf("running: got %+v", msgs)
+	}
+	if msgs[0].Tool.Name != "bash" || string(msgs[0].Tool.Input) != `{"command":"ls"}` {
+		t.Errorf("running tool = %+v", msgs[0].Tool)
+	}
+	if msgs := tr.partUpdated(running, raw); len(msgs) != 0 {
+		t.Errorf("repeated running: got %+v, want none", msgs)
+	}
+
+	done, raw := update(t, `{"part":{"id":"t1","sessionID":"s","messageID":"m","type":"tool","tool":"bash","callID":"c1","state":{"status":"completed","input":{"command":"ls"},"output":"a.go"}}}`)
+	msgs = tr.partUpdated(done, raw)
+	if len(msgs) != 1 || msgs[0].Type != agentrun.MessageToolResult {
+		t.Fatalf("completed: got %+v", msgs)
+	}
+	if string(msgs[0].Tool.Output) != `"a.go"` {
+		t.Errorf("output = %s", msgs[0].Tool.Output)
+	}
+}
+
+func TestTranslator_Usage(t *testing.T) {
+	tr := newTranslator()
+	for _, id := range []string{"f1", "f2"} {
+		u, raw := update(t, `{"part":{"id":"`+id+`","sessionID":"s","messageID":"m","type":"step-finish","cost":0.5,"tokens":{"input":10,"output":5,"reasoning":2,"cache":{"read":3,"write":1}}}}`)
+		if msgs := tr.partUpdated(u, raw); len(msgs) != 0 {
+			t.Errorf("step-finish: got %+v, want none", msgs)
+		}
+	}
+	got := tr.takeUsage()
+	want := agentrun.Usage{InputTokens: 20, OutputTokens: 10, ThinkingTokens: 4, CacheReadTokens: 6, CacheWriteTokens: 2, CostUSD: 1}
+	if got == nil || *got != want {
+		t.Errorf("usage = %+v, want %+v", got, want)
+	}
+	if tr.takeUsage() != nil {
+		t.Error("takeUsage should reset")
+	}
+}
+
+func TestTranslator_SessionError(t *testing.T) {
+	tr := newTranslator()
+	e := &sessionEvent{SessionID: "s", Error: json.RawMessage(`{"name":"ProviderAuthError","data":{"message":"bad key"}}`)}
+	msg := tr.sessionError(e, json.RawMessage(`{}`))
+	if msg.Type != agentrun.MessageError || msg.ErrorCode != "ProviderAuthError" || msg.Content != "bad key" {
+		t.Errorf("got %+v", msg)
+	}
+
+	msg = tr.sessionError(&sessionEvent{SessionID: "s"}, nil)
+	if msg.Type != agentrun.MessageError || msg.ErrorCode != "UnknownError" {
+		t.Errorf("missing error: got %+v", msg)
+	}
+}
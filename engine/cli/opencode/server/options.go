@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Default engine configuration values.
+const (
+	defaultBinary            = "opencode"
+	defaultOutputBuffer      = 4096
+	defaultGracePeriod       = 5 * time.Second
+	defaultStartupTimeout    = 30 * time.Second
+	defaultPermissionTimeout = 30 * time.Second
+	defaultMaxEventSize      = 4 << 20 // 4 MB — max SSE event size
+)
+
+// defaultArgs starts a loopback server on a free port; the listening URL is
+// read from the server's startup output.
+var defaultArgs = []string{"serve", "--hostname", "127.0.0.1", "--port", "0"}
+
+// PermissionRequest carries an OpenCode permission request to the handler.
+type PermissionRequest struct {
+	SessionID    string
+	PermissionID string
+	Type         string // permission kind, e.g. "bash", "edit", "webfetch"
+	Title        string // human-readable description from the server
+	CallID       string // tool call the permission gates, if any
+}
+
+// PermissionHandler is called when the server asks the client to approve a
+// tool action. Runs in a dedicated goroutine (not blocking the event
+// stream). Return true to approve once.
+// If nil, permission requests are rejected (unless HITL is off).
+type PermissionHandler func(ctx context.Context, req PermissionRequest) (approved bool, err error)
+
+// EngineOptions holds resolved construction-time configuration for an
+// OpenCode server engine.
+type EngineOptions struct {
+	// BaseURL attaches to an already running server instead of spawning one.
+	BaseURL string
+
+	// Binary is the OpenCode executable used to spawn "opencode serve".
+	Binary string
+
+	// Args are the arguments passed to Binary when spawning.
+	Args []string
+
+	// HTTPClient is used for all API requests. nil uses a default client.
+	HTTPClient *http.Client
+
+	// OutputBuffer is the channel buffer size for process output messages.
+	OutputBuffer int
+
+	// GracePeriod is the duration to wait after SIGTERM before sending
+	// SIGKILL to a spawned server.
+	GracePeriod time.Duration
+
+	// StartupTimeout bounds spawning the server plus session setup in Start().
+	StartupTimeout time.Duration
+
+	// MaxEventSize is the maximum SSE event size in bytes.
+	MaxEventSize int
+
+	// PermissionTimeout is the deadline for the PermissionHandler callback.
+	PermissionTimeout time.Duration
+
+	// PermissionHandler is called when the server requests permission.
+	PermissionHandler PermissionHandler
+}
+
+// EngineOption configures an Engine at construction time.
+type EngineOption func(*EngineOptions)
+
+// WithBaseURL attaches to a running OpenCode server (e.g.
+// "http://127.0.0.1:4096") instead of spawning "opencode serve".
+// Stopping a Process then leaves the server running.
+func WithBaseURL(u string) EngineOption {
+	return func(o *EngineOptions) {
+		o.BaseURL = u
+	}
+}
+
+// WithBinary sets the OpenCode executable name or path used when spawning.
+func WithBinary(binary string) EngineOption {
+	return func(o *EngineOptions) {
+		if binary != "" {
+			o.Binary = binary
+		}
+	}
+}
+
+// WithArgs replaces the arguments used to spawn the server. The server
+// must print its listening URL (http://host:port) on stdout or stderr.
+func WithArgs(args ...string) EngineOption {
+	return func(o *EngineOptions) {
+		o.Args = args
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for API requests. The client
+// must not set a Timeout: the event stream is a long-lived response.
+func WithHTTPClient(c *http.Client) EngineOption {
+	return func(o *EngineOptions) {
+		o.HTTPClient = c
+	}
+}
+
+// WithOutputBuffer sets the channel buffer size for process output messages.
+// Values <= 0 are ignored.
+func WithOutputBuffer(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.OutputBuffer = size
+		}
+	}
+}
+
+// WithGracePeriod sets the duration to wait after SIGTERM before sending
+// SIGKILL to a spawned server. Values <= 0 are ignored.
+func WithGracePeriod(d time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		if d > 0 {
+			o.GracePeriod = d
+		}
+	}
+}
+
+// WithStartupTimeout sets the deadline for server startup and session
+// setup. Values <= 0 are ignored.
+func WithStartupTimeout(d time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		if d > 0 {
+			o.StartupTimeout = d
+		}
+	}
+}
+
+// WithMaxEventSize sets the maximum SSE event size in bytes.
+// Values <= 0 are ignored.
+func WithMaxEventSize(size int) EngineOption {
+	return func(o *EngineOptions) {
+		if size > 0 {
+			o.MaxEventSize = size
+		}
+	}
+}
+
+// WithPermissionHandler sets the callback for permission requests.
+func WithPermissionHandler(h PermissionHandler) EngineOption {
+	return func(o *EngineOptions) {
+		o.PermissionHandler = h
+	}
+}
+
+// WithPermissionTimeout sets the deadline for the permission handler callback.
+// Values <= 0 are ignored.
+func WithPermissionTimeout(d time.Duration) EngineOption {
+	return func(o *EngineOptions) {
+		if d > 0 {
+			o.PermissionTimeout = d
+		}
+	}
+}
+
+func resolveEngineOptions(opts ...EngineOption) EngineOptions {
+	o := EngineOptions{
+		Binary:            defaultBinary,
+		Args:              defaultArgs,
+		OutputBuffer:      defaultOutputBuffer,
+		GracePeriod:       defaultGracePeriod,
+		StartupTimeout:    defaultStartupTimeout,
+		MaxEventSize:      defaultMaxEventSize,
+		PermissionTimeout: defaultPermissionTimeout,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
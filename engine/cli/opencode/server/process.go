@@ -0,0 +1,494 @@
+//go:build !windows
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli/opencode"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/procutil"
+)
+
+// Permission responses accepted by the server.
+const (
+	permissionOnce   = "once"
+	permissionReject = "reject"
+)
+
+// abortedErrorName is the session.error name reported for aborted turns.
+const abortedErrorName = "MessageAbortedError"
+
+// process implements agentrun.Process for one OpenCode server session.
+type process struct {
+	client    *Client
+	srv       *serverProcess // nil when attached to an external server
+	session   agentrun.Session
+	hitl      agentrun.HITL
+	opts      EngineOptions
+	sessionID string // set by open, read-only afterwards
+
+	events io.ReadCloser // SSE body; owned by the event loop once started
+	tr     *translator   // event loop only
+
+	output       chan agentrun.Message
+	outputMu     sync.Mutex // guards output channel close
+	outputClosed bool
+	done         chan struct{}
+
+	turnMu sync.Mutex // serializes turns
+	mu     sync.Mutex // guards turn and its fields
+	turn   *turnState // in-flight turn; nil between turns
+
+	termErr    error
+	stopping   atomic.Bool
+	stopOnce   sync.Once
+	finishOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// turnState tracks one prompt from submission to session.idle.
+type turnState struct {
+	done        chan struct{} // closed after the turn's MessageResult is emitted
+	interrupted bool          // Send gave up on the turn and aborted it
+	denials     []agentrun.PermissionDenial
+}
+
+var _ agentrun.Process = (*process)(nil)
+
+func newProcess(client *Client, srv *serverProcess, session agentrun.Session, opts EngineOptions) *process {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &process{
+		client:  client,
+		srv:     srv,
+		session: session,
+		hitl:    agentrun.HITL(session.Options[agentrun.OptionHITL]),
+		opts:    opts,
+		tr:      newTranslator(),
+		output:  make(chan agentrun.Message, opts.OutputBuffer),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// open subscribes to events, resolves the session, emits MessageInit and
+// starts the event loop. The stream is opened first so no event for the
+// session can be missed.
+func (p *process) open(ctx context.Context) error {
+	events, err := p.client.openEvents(p.ctx)
+	if err != nil {
+		return err
+	}
+	p.events = events
+
+	s, err := p.resolveSession(ctx)
+	if err != nil {
+		return err
+	}
+	p.sessionID = s.ID
+
+	p.emit(agentrun.Message{
+		Type:      agentrun.MessageInit,
+		ResumeID:  s.ID,
+		Init:      &agentrun.InitMeta{AgentName: "opencode"},
+		Process:   p.srv.processMeta(),
+		Timestamp: time.Now(),
+	})
+	go p.eventLoop()
+	return nil
+}
+
+// resolveSession creates a session, or resumes OptionResumeID (forking it
+// when opencode.OptionFork is set).
+func (p *process) resolveSession(ctx context.Context) (Session, error) {
+	opts := p.session.Options
+	id := opts[agentrun.OptionResumeID]
+	if id == "" {
+		return p.client.CreateSession(ctx, opts[opencode.OptionTitle])
+	}
+	if opts[opencode.OptionFork] != "" {
+		return p.client.ForkSession(ctx, id, "")
+	}
+	return p.client.GetSession(ctx, id)
+}
+
+// abandon tears down a process whose open failed. No messages are emitted.
+func (p *process) abandon() {
+	p.stopping.Store(true)
+	p.cancel()
+	if p.events != nil {
+		_ = p.events.Close()
+	}
+	p.srv.stop(context.Background(), p.opts.GracePeriod)
+	p.finish(agentrun.ErrTerminated)
+}
+
+// eventLoop dispatches stream events until the stream ends, then finishes
+// the process.
+func (p *process) eventLoop() {
+	err := readEvents(p.events, p.opts.MaxEventSize, p.dispatch)
+	_ = p.events.Close()
+	switch {
+	case p.stopping.Load():
+		p.finish(agentrun.ErrTerminated)
+	case p.srv != nil && p.serverExited():
+		p.finish(procutil.WrapExitError(p.srv.waitErr))
+	case err != nil:
+		p.finish(fmt.Errorf("opencode server: event stream: %w", err))
+	default:
+		p.finish(fmt.Errorf("opencode server: event stream closed: %w", io.ErrUnexpectedEOF))
+	}
+}
+
+// serverExited waits briefly for a spawned server to exit after its event
+// stream ended, reporting whether it did.
+func (p *process) serverExited() bool {
+	select {
+	case <-p.srv.exited:
+		return true
+	case <-time.After(p.opts.GracePeriod):
+		return false
+	}
+}
+
+// dispatch handles one event. Events for other sessions are ignored.
+func (p *process) dispatch(data []byte) {
+	var ev event
+	if err := json.Unmarshal(data, &ev); err != nil {
+		p.emit(agentrun.Message{
+			Type:      agentrun.MessageError,
+			Content:   fmt.Sprintf("opencode server: malformed event: %v", err),
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	switch ev.Type {
+	case eventPartUpdated:
+		var u partUpdated
+		if json.Unmarshal(ev.Properties, &u) == nil && u.Part.SessionID == p.sessionID {
+			for _, m := range p.tr.partUpdated(&u, data) {
+				p.emit(m)
+			}
+		}
+	case eventMessageUpdated:
+		var m messageUpdated
+		if json.Unmarshal(ev.Properties, &m) == nil && m.Info.SessionID == p.sessionID {
+			p.tr.messageUpdated(&m)
+		}
+	case eventSessionIdle:
+		var s sessionEvent
+		if json.Unmarshal(ev.Properties, &s) == nil && s.SessionID == p.sessionID {
+			p.completeTurn()
+		}
+	case eventSessionError:
+		var s sessionEvent
+		if json.Unmarshal(ev.Properties, &s) == nil && s.SessionID == p.sessionID && !p.abortedError(&s) {
+			p.emit(p.tr.sessionError(&s, data))
+		}
+	case eventPermission:
+		var req permissionEvent
+		if json.Unmarshal(ev.Properties, &req) == nil && req.SessionID == p.sessionID {
+			go p.handlePermission(req)
+		}
+	}
+}
+
+// abortedError reports whether s is the abort notice for a turn this
+// process interrupted, which is expected and not surfaced as an error.
+func (p *process) abortedError(s *sessionEvent) bool {
+	var e struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(s.Error, &e) != nil || e.Name != abortedErrorName {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.turn != nil && p.turn.interrupted
+}
+
+// completeTurn ends the in-flight turn with MessageResult. Interrupted
+// turns report StopReason "aborted".
+func (p *process) completeTurn() {
+	p.mu.Lock()
+	t := p.turn
+	p.turn = nil
+	p.mu.Unlock()
+	if t == nil {
+		return // idle without a turn of ours (e.g., another client's prompt)
+	}
+	stop := agentrun.StopEndTurn
+	if t.interrupted {
+		stop = "aborted"
+	}
+	p.emit(agentrun.Message{
+		Type:       agentrun.MessageResult,
+		StopReason: stop,
+		Usage:      p.tr.takeUsage(),
+		Denials:    t.denials,
+		Timestamp:  time.Now(),
+	})
+	close(t.done)
+}
+
+// --- Send ---
+
+// Output returns the channel for receiving messages from the agent.
+func (p *process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send submits a prompt and blocks until the session goes idle (turn
+// complete, MessageResult emitted) or ctx expires, in which case the turn
+// is aborted. The caller must drain Output() concurrently.
+func (p *process) Send(ctx context.Context, message string) error {
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+	p.turnMu.Lock()
+	defer p.turnMu.Unlock()
+	if p.terminated() {
+		return agentrun.ErrTerminated
+	}
+
+	// An aborted turn still owns the session until it goes idle.
+	p.mu.Lock()
+	prev := p.turn
+	p.mu.Unlock()
+	if prev != nil {
+		if err := p.waitTurn(ctx, prev); err != nil {
+			return err
+		}
+	}
+
+	t := &turnState{done: make(chan struct{})}
+	p.mu.Lock()
+	p.turn = t
+	p.mu.Unlock()
+	if err := p.client.promptAsync(ctx, p.sessionID, promptRequestFor(p.session, message)); err != nil {
+		p.mu.Lock()
+		if p.turn == t {
+			p.turn = nil
+		}
+		p.mu.Unlock()
+		return err
+	}
+
+	if err := p.waitTurn(ctx, t); err != nil {
+		if ctx.Err() != nil {
+			p.abort(t)
+		}
+		return err
+	}
+	return nil
+}
+
+// waitTurn blocks until t completes, the process ends, or ctx expires.
+func (p *process) waitTurn(ctx context.Context, t *turnState) error {
+	select {
+	case <-t.done:
+		return nil
+	case <-p.done:
+		select {
+		case <-t.done:
+			return nil // completed just before the process ended
+		default:
+		}
+		return agentrun.ErrTerminated
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// abort marks t interrupted and asks the server to stop it. Best-effort
+// and asynchronous; the session still goes idle, completing the turn.
+func (p *process) abort(t *turnState) {
+	p.mu.Lock()
+	t.interrupted = true
+	p.mu.Unlock()
+	go func() {
+		ctx, cancel := context.WithTimeout(p.ctx, p.opts.GracePeriod)
+		defer cancel()
+		_ = p.client.Abort(ctx, p.sessionID)
+	}()
+}
+
+// terminated reports whether the process is stopping or has ended.
+func (p *process) terminated() bool {
+	if p.stopping.Load() {
+		return true
+	}
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// --- Permissions ---
+
+// handlePermission answers a permission request. HITL off approves once.
+// Otherwise the PermissionHandler decides; without one the request is
+// rejected. Rejections are recorded as denials on the in-flight turn;
+// handler errors reject without recording a denial.
+func (p *process) handlePermission(req permissionEvent) {
+	response := p.decidePermission(req)
+	ctx, cancel := context.WithTimeout(p.ctx, p.opts.PermissionTimeout)
+	defer cancel()
+	if err := p.client.respondPermission(ctx, p.sessionID, req.ID, response); err != nil && p.ctx.Err() == nil {
+		p.emit(agentrun.Message{
+			Type:      agentrun.MessageError,
+			Content:   errfmt.Truncate(err.Error()),
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// decidePermission returns the server response for req.
+func (p *process) decidePermission(req permissionEvent) string {
+	if p.hitl == agentrun.HITLOff {
+		return permissionOnce
+	}
+	if p.opts.PermissionHandler == nil {
+		p.addDenial(req.Type, "no permission handler")
+		return permissionReject
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, p.opts.PermissionTimeout)
+	defer cancel()
+	approved, err := safeCallPermissionHandler(ctx, p.opts.PermissionHandler, PermissionRequest{
+		SessionID:    req.SessionID,
+		PermissionID: req.ID,
+		Type:         req.Type,
+		Title:        req.Title,
+		CallID:       req.CallID,
+	})
+	if err != nil {
+		p.emit(agentrun.Message{
+			Type:      agentrun.MessageError,
+			Content:   errfmt.Truncate(fmt.Sprintf("opencode server: permission handler error: %v", err)),
+			Timestamp: time.Now(),
+		})
+		return permissionReject
+	}
+	if approved {
+		return permissionOnce
+	}
+	p.addDenial(req.Type, "denied by handler")
+	return permissionReject
+}
+
+// addDenial records a rejected permission on the in-flight turn, if any.
+func (p *process) addDenial(tool, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.turn == nil {
+		return
+	}
+	p.turn.denials = append(p.turn.denials, agentrun.PermissionDenial{
+		Tool:   errfmt.SanitizeCode(tool),
+		Reason: errfmt.Truncate(reason),
+	})
+}
+
+// safeCallPermissionHandler calls h with panic recovery.
+func safeCallPermissionHandler(ctx context.Context, h PermissionHandler, req PermissionRequest) (approved bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("permission handler panic: %v", r)
+		}
+	}()
+	return h(ctx, req)
+}
+
+// --- Lifecycle ---
+
+// Stop aborts any in-flight turn, closes the event stream and, for a
+// spawned server, terminates it. An attached server keeps running.
+// Safe to call multiple times.
+func (p *process) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		p.stopping.Store(true)
+
+		p.mu.Lock()
+		inTurn := p.turn != nil
+		p.mu.Unlock()
+		if inTurn {
+			abortCtx, cancel := context.WithTimeout(ctx, p.opts.GracePeriod)
+			_ = p.client.Abort(abortCtx, p.sessionID)
+			cancel()
+		}
+
+		// Cancelling the process context closes the event stream request
+		// and unblocks emit(); the event loop then finishes the process.
+		p.cancel()
+		p.srv.stop(ctx, p.opts.GracePeriod)
+	})
+
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends.
+func (p *process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// emit sends a message to the output channel. Blocks until delivered,
+// context is cancelled, or the channel is marked closed by finish().
+func (p *process) emit(msg agentrun.Message) {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	p.outputMu.Lock()
+	defer p.outputMu.Unlock()
+	if p.outputClosed {
+		return
+	}
+	select {
+	case p.output <- msg:
+	case <-p.ctx.Done():
+	}
+}
+
+// finish sets the terminal error and closes done+output channels.
+// done closes before output so Err() is valid once a consumer's range
+// over Output() exits.
+func (p *process) finish(err error) {
+	p.finishOnce.Do(func() {
+		if p.stopping.Load() {
+			err = agentrun.ErrTerminated
+		}
+		p.termErr = err
+		p.cancel()
+
+		close(p.done)
+
+		p.outputMu.Lock()
+		p.outputClosed = true
+		close(p.output)
+		p.outputMu.Unlock()
+	})
+}
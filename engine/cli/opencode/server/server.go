@@ -0,0 +1,117 @@
+//go:build !windows
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"syscall"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/procutil"
+)
+
+// listenURLPattern finds the listening URL in the server's startup output
+// ("opencode server listening on http://127.0.0.1:4096").
+var listenURLPattern = regexp.MustCompile(`https?://[^\s"']+`)
+
+// serverProcess is a spawned "opencode serve" subprocess.
+type serverProcess struct {
+	cmd     *exec.Cmd
+	baseURL string
+	exited  chan struct{} // closed after cmd.Wait returns
+	waitErr error         // valid after exited is closed
+}
+
+// spawnServer starts the server and waits until it prints its listening URL.
+// stdout and stderr are both scanned; output after the URL is discarded.
+func spawnServer(ctx context.Context, binary string, args []string, cwd string, env []string) (*serverProcess, error) {
+	cmd := exec.Command(binary, args...)
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	cmd.Env = env
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("opencode server: start: %w", err)
+	}
+
+	s := &serverProcess{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		s.waitErr = cmd.Wait()
+		_ = pw.Close()
+		close(s.exited)
+	}()
+
+	found := make(chan string, 1)
+	go scanListenURL(pr, found)
+
+	select {
+	case u, ok := <-found:
+		if ok {
+			s.baseURL = u
+			return s, nil
+		}
+		<-s.exited
+		if err := procutil.WrapExitError(s.waitErr); err != nil {
+			return nil, fmt.Errorf("opencode server: exited before listening: %w", err)
+		}
+		return nil, errors.New("opencode server: exited without printing a listen URL")
+	case <-ctx.Done():
+		s.stop(context.Background(), 0)
+		return nil, fmt.Errorf("opencode server: waiting for listen URL: %w", ctx.Err())
+	}
+}
+
+// scanListenURL sends the first URL found in r on found (closing it if r
+// ends first), then drains r so the subprocess never blocks on output.
+func scanListenURL(r io.Reader, found chan<- string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if u := listenURLPattern.FindString(scanner.Text()); u != "" {
+			found <- u
+			_, _ = io.Copy(io.Discard, r)
+			return
+		}
+	}
+	close(found)
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// stop terminates the server: SIGTERM, then SIGKILL after grace or when
+// ctx expires. Safe on a nil receiver (attached mode).
+func (s *serverProcess) stop(ctx context.Context, grace time.Duration) {
+	if s == nil {
+		return
+	}
+	_ = procutil.Signal(s.cmd.Process, syscall.SIGTERM)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-s.exited:
+	case <-timer.C:
+		_ = procutil.Signal(s.cmd.Process, os.Kill)
+		<-s.exited
+	case <-ctx.Done():
+		_ = procutil.Signal(s.cmd.Process, os.Kill)
+		<-s.exited
+	}
+}
+
+// processMeta returns subprocess metadata for MessageInit enrichment.
+// Returns nil for attached servers.
+func (s *serverProcess) processMeta() *agentrun.ProcessMeta {
+	if s == nil || s.cmd.Process == nil || s.cmd.Process.Pid <= 0 {
+		return nil
+	}
+	return &agentrun.ProcessMeta{PID: s.cmd.Process.Pid, Binary: s.cmd.Path}
+}
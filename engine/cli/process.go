@@ -16,6 +16,7 @@ import (
 
 	"github.com/dmora/agentrun"
 	"github.com/dmora/agentrun/engine/internal/lineread"
+	"github.com/dmora/agentrun/engine/internal/procutil"
 )
 
 // capabilities holds resolved optional interfaces for a process.
@@ -24,6 +25,7 @@ type capabilities struct {
 	resumer   Resumer
 	streamer  Streamer
 	formatter InputFormatter
+	eof       EOFParser
 }
 
 func resolveCapabilities(backend Backend) capabilities {
@@ -37,17 +39,10 @@ func resolveCapabilities(backend Backend) capabilities {
 	if f, ok := backend.(InputFormatter); ok {
 		caps.formatter = f
 	}
-	return caps
-}
-
-// signalProcess sends sig to a process, returning nil if the process
-// has already exited (os.ErrProcessDone).
-func signalProcess(proc *os.Process, sig os.Signal) error {
-	err := proc.Signal(sig)
-	if errors.Is(err, os.ErrProcessDone) {
-		return nil
+	if e, ok := backend.(EOFParser); ok {
+		caps.eof = e
 	}
-	return err
+	return caps
 }
 
 // process implements agentrun.Process for CLI subprocess sessions.
@@ -127,7 +122,7 @@ func (p *process) Send(ctx context.Context, message string) error {
 
 	// Check if the session has ended.
 	select {
-	case <-p.done:
+	case <-p.doneChan():
 		// For Resumer backends, a clean subprocess exit (termErr == nil) is
 		// the normal end of a turn, not the end of the session. Restart by
 		// spawning a new subprocess with ResumeArgs.
@@ -203,41 +198,74 @@ func (p *process) Stop(ctx context.Context) error {
 		cancelRead()
 
 		// Send SIGTERM for graceful termination.
-		_ = signalProcess(cmd.Process, syscall.SIGTERM)
+		_ = procutil.Signal(cmd.Process, syscall.SIGTERM)
 
 		// Wait for readLoop to finish, with grace period.
 		select {
 		case <-p.cmdDone:
 		case <-time.After(p.opts.GracePeriod):
-			_ = signalProcess(cmd.Process, os.Kill)
+			_ = procutil.Signal(cmd.Process, os.Kill)
 			<-p.cmdDone
 		case <-ctx.Done():
-			_ = signalProcess(cmd.Process, os.Kill)
+			_ = procutil.Signal(cmd.Process, os.Kill)
 			<-p.cmdDone
 		}
 	})
 
 	// Block until finish() completes (output channel closed).
-	<-p.done
-	return p.termErr
+	<-p.doneChan()
+	return p.terminalErr()
 }
 
-// Wait blocks until the session ends naturally.
+// Wait blocks until the session ends naturally. For Resumer backends it
+// returns at the end of every turn; see Resumable.
 func (p *process) Wait() error {
-	<-p.done
-	return p.termErr
+	<-p.doneChan()
+	return p.terminalErr()
 }
 
 // Err returns the terminal error, or nil if still running.
 func (p *process) Err() error {
 	select {
-	case <-p.done:
-		return p.termErr
+	case <-p.doneChan():
+		return p.terminalErr()
 	default:
 		return nil
 	}
 }
 
+// Resumable reports whether the next Send continues the session after
+// Output has closed: true for Resumer backends while the last subprocess
+// exited cleanly and Stop has not been called.
+func (p *process) Resumable() bool {
+	if p.caps.resumer == nil || p.stopping.Load() {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.done:
+		return p.termErr == nil
+	default:
+		return true
+	}
+}
+
+// doneChan returns the current turn's done channel, which
+// resumeAfterCleanExit replaces under mu.
+func (p *process) doneChan() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
+
+// terminalErr reads termErr under mu; resumeAfterCleanExit resets it.
+func (p *process) terminalErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.termErr
+}
+
 // finish sets the terminal error and closes output+done channels.
 // Called exactly once via sync.Once.
 //
@@ -260,7 +288,7 @@ func (p *process) readLoop(ctx context.Context, stdout io.ReadCloser) {
 
 	defer func() {
 		if r := recover(); r != nil {
-			_ = signalProcess(p.cmd.Process, os.Kill)
+			_ = procutil.Signal(p.cmd.Process, os.Kill)
 			panicErr = fmt.Errorf("cli: parser panic: %v", r)
 		}
 
@@ -275,7 +303,7 @@ func (p *process) readLoop(ctx context.Context, stdout io.ReadCloser) {
 		case scanErr != nil:
 			waitErr = fmt.Errorf("cli: reader: %w", scanErr)
 		default:
-			waitErr = wrapExitError(waitErr)
+			waitErr = procutil.WrapExitError(waitErr)
 			if waitErr == nil && p.awaitingResult.Load() {
 				waitErr = agentrun.ErrNoResult
 			}
@@ -310,7 +338,7 @@ func (p *process) readLoop(ctx context.Context, stdout io.ReadCloser) {
 			// Channel full; error preserved in scanErr, surfaced via finish().
 		}
 		p.mu.Lock()
-		_ = signalProcess(p.cmd.Process, os.Kill)
+		_ = procutil.Signal(p.cmd.Process, os.Kill)
 		p.mu.Unlock()
 	}
 }
@@ -327,14 +355,18 @@ func (p *process) scanLines(ctx context.Context, stdout io.ReadCloser) error {
 
 	for {
 		line, err := lr.ReadLineString()
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
+		eof := errors.Is(err, io.EOF)
+		if err != nil && !eof {
 			return err
 		}
-		msg, skip, backendError := p.parseLine(line)
+		if eof && p.caps.eof == nil {
+			return nil
+		}
+		msg, skip, backendError := p.parse(line, eof)
 		if skip {
+			if eof {
+				return nil
+			}
 			continue
 		}
 
@@ -350,6 +382,9 @@ func (p *process) scanLines(ctx context.Context, stdout io.ReadCloser) error {
 		case <-ctx.Done():
 			return nil
 		}
+		if eof {
+			return nil
+		}
 	}
 }
 
@@ -369,13 +404,20 @@ func (p *process) enrichMessage(msg *agentrun.Message, lastStopReason agentrun.S
 	return lastStopReason, maxCallFill
 }
 
-// parseLine delegates to the backend parser and wraps parse errors as
-// MessageError messages. Returns (msg, skip, backendError):
+// parse delegates a line (or, at eof, the end of output) to the backend
+// parser and wraps parse errors as MessageError messages. Returns
+// (msg, skip, backendError):
 //   - skip=true: line should be ignored (ErrSkipLine)
 //   - backendError=true: backend emitted MessageError (turn abort boundary,
 //     caller must reset maxCallFill). False for synthetic parse errors.
-func (p *process) parseLine(line string) (agentrun.Message, bool, bool) {
-	msg, err := p.backend.ParseLine(line)
+func (p *process) parse(line string, eof bool) (agentrun.Message, bool, bool) {
+	var msg agentrun.Message
+	var err error
+	if eof {
+		msg, err = p.caps.eof.ParseEOF()
+	} else {
+		msg, err = p.backend.ParseLine(line)
+	}
 	if errors.Is(err, ErrSkipLine) {
 		return agentrun.Message{}, true, false
 	}
@@ -392,26 +434,6 @@ func (p *process) parseLine(line string) (agentrun.Message, bool, bool) {
 	return msg, false, backendError
 }
 
-// wrapExitError converts a non-zero *exec.ExitError to *agentrun.ExitError.
-// nil → nil, non-ExitError → passthrough, code 0 → nil (clean exit).
-// Preserves the error chain via ExitError.Unwrap.
-//
-// NOTE: intentionally duplicated in engine/acp/process.go — keep in sync.
-func wrapExitError(err error) error {
-	if err == nil {
-		return nil
-	}
-	var ee *exec.ExitError
-	if !errors.As(err, &ee) {
-		return err
-	}
-	code := ee.ExitCode()
-	if code == 0 {
-		return nil
-	}
-	return &agentrun.ExitError{Code: code, Err: err}
-}
-
 // processMetaSnapshot returns subprocess metadata for MessageInit enrichment.
 // Returns nil if cmd or its process is unavailable.
 //
@@ -530,13 +552,13 @@ func (p *process) replaceSubprocess(ctx context.Context, message string) error {
 	p.mu.Unlock()
 
 	oldCancel()
-	_ = signalProcess(oldCmd.Process, syscall.SIGTERM)
+	_ = procutil.Signal(oldCmd.Process, syscall.SIGTERM)
 
 	// Wait for old readLoop to finish.
 	select {
 	case <-p.cmdDone:
 	case <-ctx.Done():
-		_ = signalProcess(oldCmd.Process, os.Kill)
+		_ = procutil.Signal(oldCmd.Process, os.Kill)
 		<-p.cmdDone
 		p.failReplacement(ctx.Err())
 		return ctx.Err()
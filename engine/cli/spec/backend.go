@@ -0,0 +1,338 @@
+package spec
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/internal/jsonutil"
+	"github.com/dmora/agentrun/engine/cli/internal/optutil"
+)
+
+// Backend is a CLI backend driven by a Spec.
+// It implements cli.Spawner, cli.Parser, cli.Resumer and cli.EOFParser.
+// Specs with a stream template yield a *StreamBackend instead, which adds
+// cli.Streamer and cli.InputFormatter.
+//
+// The session ID is auto-captured from the first event matched by a rule
+// with a resume_id path, via atomic write-once. It is per-session state:
+// cli.Engine runs each session on a Fork (cli.Forker), so one Engine can
+// run concurrent sessions.
+type Backend struct {
+	spec      *compiled
+	binary    string
+	sessionID atomic.Pointer[string] // write-once from output
+
+	mu       sync.Mutex // guards the fields below (text mode)
+	text     []string   // text message contents since the last result
+	hasInit  bool       // MessageInit already emitted
+	resulted bool       // a MessageResult was parsed since the last EOF
+}
+
+// StreamBackend is a Backend whose spec declares a stream template.
+type StreamBackend struct {
+	*Backend
+}
+
+// Compile-time interface satisfaction checks.
+var (
+	_ cli.Backend        = (*Backend)(nil)
+	_ cli.Resumer        = (*Backend)(nil)
+	_ cli.EOFParser      = (*Backend)(nil)
+	_ cli.Forker         = (*Backend)(nil)
+	_ cli.Forker         = (*StreamBackend)(nil)
+	_ cli.Streamer       = (*StreamBackend)(nil)
+	_ cli.InputFormatter = (*StreamBackend)(nil)
+)
+
+// Option configures a Backend at construction time.
+type Option func(*Backend)
+
+// WithBinary overrides the spec's binary path.
+// Empty values are ignored.
+func WithBinary(path string) Option {
+	return func(b *Backend) {
+		if path != "" {
+			b.binary = path
+		}
+	}
+}
+
+// New validates s and creates a backend for one session. The result is a
+// *Backend, or a *StreamBackend when s declares a stream template.
+func New(s *Spec, opts ...Option) (cli.Backend, error) {
+	c, err := s.compile()
+	if err != nil {
+		return nil, err
+	}
+	b := &Backend{spec: c, binary: s.Binary}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if len(s.Stream) > 0 {
+		return &StreamBackend{Backend: b}, nil
+	}
+	return b, nil
+}
+
+// Fork returns a Backend with the same spec and binary and no captured
+// state, for one session. cli.Engine forks on every Start.
+func (b *Backend) Fork() cli.Backend {
+	return &Backend{spec: b.spec, binary: b.binary}
+}
+
+// Fork returns a StreamBackend with fresh state.
+func (b *StreamBackend) Fork() cli.Backend {
+	return &StreamBackend{Backend: b.Backend.Fork().(*Backend)}
+}
+
+// SpawnArgs builds exec.Cmd arguments for a new session from the spawn
+// template. {session_id} resolves to a valid OptionResumeID (cold resume).
+// Invalid values are silently dropped per the Spawner contract.
+func (b *Backend) SpawnArgs(session agentrun.Session) (string, []string) {
+	args, _ := b.expand(b.spec.Spawn, session, session.Prompt, b.optionSessionID(session), false)
+	return b.binary, args
+}
+
+// ResumeArgs builds exec.Cmd arguments to continue the session from the
+// resume template. The session ID is resolved from:
+//  1. The atomic write-once ID captured from output (auto-capture)
+//  2. session.Options[OptionResumeID] (explicit fallback)
+//
+// Returns an error if the spec has no resume template, no valid session ID
+// is available, the message contains null bytes, or a mapped option has an
+// invalid value.
+func (b *Backend) ResumeArgs(session agentrun.Session, initialPrompt string) (string, []string, error) {
+	name := b.spec.Name
+	if len(b.spec.Resume) == 0 {
+		return "", nil, fmt.Errorf("%s: spec has no resume template", name)
+	}
+	if err := optutil.ValidateModeHITL(name, session.Options); err != nil {
+		return "", nil, err
+	}
+	if err := optutil.ValidateEffort(name, session.Options); err != nil {
+		return "", nil, err
+	}
+
+	id := b.capturedSessionID()
+	if id == "" {
+		id = session.Options[agentrun.OptionResumeID]
+	}
+	if id == "" {
+		return "", nil, fmt.Errorf("%s: no session ID available (not captured from output and not set via OptionResumeID)", name)
+	}
+	if !b.spec.sessionID.MatchString(id) {
+		return "", nil, fmt.Errorf("%s: invalid session ID format: %q", name, id)
+	}
+	if jsonutil.ContainsNull(initialPrompt) {
+		return "", nil, fmt.Errorf("%s: initial prompt contains null bytes", name)
+	}
+
+	args, err := b.expand(b.spec.Resume, session, initialPrompt, id, true)
+	if err != nil {
+		return "", nil, err
+	}
+	return b.binary, args, nil
+}
+
+// StreamArgs builds exec.Cmd arguments for the long-lived streaming
+// process. The prompt is not included; it is written via FormatInput.
+func (b *StreamBackend) StreamArgs(session agentrun.Session) (string, []string) {
+	args, _ := b.expand(b.spec.Stream, session, "", b.optionSessionID(session), false)
+	return b.binary, args
+}
+
+// FormatInput renders the spec's input template for message, followed by
+// a newline. Returns an error for messages containing null bytes.
+func (b *StreamBackend) FormatInput(message string) ([]byte, error) {
+	if jsonutil.ContainsNull(message) {
+		return nil, fmt.Errorf("%s: message contains null bytes", b.spec.Name)
+	}
+	quoted, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("%s: encode message: %w", b.spec.Name, err)
+	}
+	line := strings.ReplaceAll(b.spec.Input, "{message}", string(quoted))
+	return []byte(line + "\n"), nil
+}
+
+// capturedSessionID returns the auto-captured session ID, or empty string
+// if not yet captured.
+func (b *Backend) capturedSessionID() string {
+	if p := b.sessionID.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// optionSessionID returns OptionResumeID when it is a valid session ID.
+func (b *Backend) optionSessionID(session agentrun.Session) string {
+	if id := session.Options[agentrun.OptionResumeID]; b.spec.sessionID.MatchString(id) {
+		return id
+	}
+	return ""
+}
+
+// --- argv expansion ---
+
+// expand renders an argv template. Values that are empty or invalid
+// resolve empty and drop their element or group. When strict, invalid
+// mapped option values are returned as errors instead.
+func (b *Backend) expand(tmpl []Arg, session agentrun.Session, prompt, sessionID string, strict bool) ([]string, error) {
+	args := []string{}
+	for _, arg := range tmpl {
+		if len(arg) == 1 && arg[0] == "{options}" {
+			flags, err := b.optionArgs(session.Options, strict)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, flags...)
+			continue
+		}
+		group := make([]string, 0, len(arg))
+		for _, el := range arg {
+			v, ok := b.render(el, session, prompt, sessionID)
+			if !ok {
+				group = nil
+				break
+			}
+			group = append(group, v)
+		}
+		args = append(args, group...)
+	}
+	return args, nil
+}
+
+// render substitutes the placeholders in el. ok is false when any of them
+// resolves empty.
+func (b *Backend) render(el string, session agentrun.Session, prompt, sessionID string) (string, bool) {
+	whole := placeholder.FindStringIndex(el)
+	standalone := whole != nil && whole[0] == 0 && whole[1] == len(el)
+
+	ok := true
+	out := placeholder.ReplaceAllStringFunc(el, func(ref string) string {
+		m := placeholder.FindStringSubmatch(ref)
+		var v string
+		switch m[1] {
+		case "prompt":
+			v = prompt
+			if jsonutil.ContainsNull(v) {
+				v = ""
+			}
+		case "model":
+			v = safeValue(session.Model, standalone)
+		case "session_id":
+			v = sessionID
+		case "option":
+			v = safeValue(session.Options[m[2]], standalone)
+		}
+		if v == "" {
+			ok = false
+		}
+		return v
+	})
+	return out, ok
+}
+
+// safeValue returns v unless it contains null bytes or, when it would
+// form a whole argument, starts with "-" (it would parse as a flag).
+func safeValue(v string, standalone bool) string {
+	if jsonutil.ContainsNull(v) || (standalone && strings.HasPrefix(v, "-")) {
+		return ""
+	}
+	return v
+}
+
+// optionArgs maps session options to flags in spec order.
+func (b *Backend) optionArgs(opts map[string]string, strict bool) ([]string, error) {
+	args := []string{}
+	for _, o := range b.spec.Options {
+		if strict && o.SpawnOnly {
+			continue
+		}
+		v, set := opts[o.Key]
+		if !set || v == "" {
+			continue
+		}
+		flags, err := b.optionFlags(o, v)
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("%s: option %s: %w", b.spec.Name, o.Key, err)
+			}
+			continue
+		}
+		args = append(args, flags...)
+	}
+	return args, nil
+}
+
+// optionFlags returns the args for one option value.
+func (b *Backend) optionFlags(o OptionSpec, v string) ([]string, error) {
+	if jsonutil.ContainsNull(v) {
+		return nil, errors.New("value contains null bytes")
+	}
+	if len(o.Values) > 0 {
+		flags, ok := o.Values[v]
+		if !ok {
+			return nil, fmt.Errorf("unknown value %q: valid: %s", v, strings.Join(sortedKeys(o.Values), ", "))
+		}
+		return flags, nil
+	}
+	if o.Bool {
+		on, _, err := agentrun.ParseBoolOption(map[string]string{o.Key: v}, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !on {
+			return nil, nil
+		}
+		return []string{o.Flag}, nil
+	}
+
+	values := []string{v}
+	if o.List {
+		values = agentrun.ParseListOption(map[string]string{o.Key: v}, o.Key)
+	}
+	var args []string
+	for _, val := range values {
+		if err := b.checkValue(o, val); err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(o.Flag, "=") {
+			args = append(args, o.Flag+val)
+		} else {
+			args = append(args, o.Flag, val)
+		}
+	}
+	return args, nil
+}
+
+// checkValue validates a flag value against Enum, Pattern and the
+// leading-dash rule.
+func (b *Backend) checkValue(o OptionSpec, v string) error {
+	if len(o.Enum) > 0 && !slices.Contains(o.Enum, v) {
+		return fmt.Errorf("unknown value %q: valid: %s", v, strings.Join(o.Enum, ", "))
+	}
+	if re := b.spec.patterns[o.Key]; re != nil && !re.MatchString(v) {
+		return fmt.Errorf("value %q does not match %s", v, re)
+	}
+	if !strings.HasSuffix(o.Flag, "=") && strings.HasPrefix(v, "-") {
+		return fmt.Errorf("value %q must not start with a dash", v)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,23 @@
+package spec_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/spec"
+	"github.com/dmora/agentrun/enginetest/clitest"
+)
+
+func TestCompliance(t *testing.T) {
+	s, err := spec.Load("testdata/acme.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clitest.RunBackendTests(t, func() cli.Backend {
+		b, err := spec.New(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	})
+}
@@ -0,0 +1,63 @@
+// Package spec provides a CLI backend configured from a declarative spec
+// instead of Go code.
+//
+// A Spec declares the binary, argv templates for spawn, resume and
+// streaming, how session options map to flags, and how output lines map
+// to agentrun.Message values — by JSON path for CLIs that print one JSON
+// event per line, or by regular expression for plain text output.
+//
+//	s, err := spec.Load("acme.json")
+//	backend, err := spec.New(s)
+//	engine := cli.NewEngine(backend)
+//
+// Specs are JSON; unknown fields are rejected. The module has no YAML
+// dependency — convert YAML to JSON (e.g. with sigs.k8s.io/yaml) before
+// Parse.
+//
+// # Argv templates
+//
+// Each template element is a string or a group of strings. Placeholders:
+// {prompt}, {model}, {session_id}, {option:KEY}, and {options}, which
+// splices the flags produced by the option mappings. A group is dropped
+// when any of its placeholders resolves empty, so
+// ["--model", "{model}"] disappears without a model and
+// ["--resume", "{session_id}"] in the spawn template gives cold resume
+// via OptionResumeID.
+//
+// Values are never passed through a shell. Values with null bytes resolve
+// empty, as do model, session ID and option values that would form a
+// whole argument starting with "-". The prompt is passed as-is: prefer
+// "--prompt={prompt}" or a preceding "--" so a prompt starting with "-"
+// is not parsed as a flag.
+//
+// # Send paths
+//
+// A resume template gives resume-per-turn: each Send spawns it with the
+// session ID captured from output (resume_id paths) or OptionResumeID,
+// validated against SessionIDPattern. A stream template plus an input
+// template gives a long-lived process fed through stdin; New then returns
+// a *StreamBackend.
+//
+// # Option mappings
+//
+// Each OptionSpec maps one session option key — root options such as
+// "mode", "hitl", "effort" and "add_dirs", or backend-namespaced keys — to
+// flags: a flag with the value (optionally constrained by enum and
+// pattern), a boolean flag, one flag per list entry, or a fixed value →
+// args table. SpawnArgs silently skips invalid values; ResumeArgs returns
+// them as errors, and validates OptionMode, OptionHITL and OptionEffort.
+//
+// # Output rules
+//
+// For JSON output, the first event rule whose "when" conditions hold
+// produces the message; content, resume_id, model, stop_reason,
+// error_code, tool and usage fields are paths into the event
+// ("message.content.*.text"). Unmatched events become MessageSystem.
+//
+// For plain text output, the first line rule whose regular expression
+// matches produces the message, with $1/${name} templates for content and
+// other fields; unmatched lines are text. Plain text CLIs have no
+// end-of-turn event, so the backend emits MessageResult with the turn's
+// text when the process closes stdout (cli.EOFParser) unless a rule
+// already produced a result.
+package spec
@@ -0,0 +1,341 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/errfmt"
+	"github.com/dmora/agentrun/engine/internal/stoputil"
+)
+
+// ParseLine parses a single output line into a Message according to the
+// spec's event rules (FormatJSON) or line rules (FormatText). Returns
+// cli.ErrSkipLine for blank lines and lines matched by "skip" rules.
+func (b *Backend) ParseLine(line string) (agentrun.Message, error) {
+	if strings.TrimSpace(line) == "" {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+	if b.spec.Format == FormatText {
+		return b.parseText(line)
+	}
+	return b.parseJSON(line)
+}
+
+// ParseEOF ends the turn of a text-mode CLI: unless a line rule already
+// produced MessageResult, it emits one carrying the turn's text lines.
+// JSON specs report results through their event rules, so ParseEOF
+// returns cli.ErrSkipLine for them.
+func (b *Backend) ParseEOF() (agentrun.Message, error) {
+	if b.spec.Format != FormatText {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	text, resulted := b.text, b.resulted
+	b.text, b.resulted = nil, false
+	if resulted {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+	return agentrun.Message{
+		Type:       agentrun.MessageResult,
+		Content:    strings.Join(text, "\n"),
+		StopReason: agentrun.StopEndTurn,
+		Timestamp:  time.Now(),
+	}, nil
+}
+
+// --- JSON events ---
+
+func (b *Backend) parseJSON(line string) (agentrun.Message, error) {
+	var raw any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return agentrun.Message{}, fmt.Errorf("%s: invalid JSON: %w", b.spec.Name, err)
+	}
+	if _, ok := raw.(map[string]any); !ok {
+		return agentrun.Message{}, fmt.Errorf("%s: event is not a JSON object", b.spec.Name)
+	}
+
+	msg := agentrun.Message{Raw: json.RawMessage(line), Timestamp: time.Now()}
+	for i := range b.spec.Events {
+		r := &b.spec.Events[i]
+		if !matches(raw, r.When) {
+			continue
+		}
+		if r.Type == TypeSkip {
+			return agentrun.Message{}, cli.ErrSkipLine
+		}
+		b.applyEvent(r, raw, &msg)
+		return msg, nil
+	}
+
+	// Unknown event type → MessageSystem (graceful, not error).
+	typePath := b.spec.TypePath
+	if typePath == "" {
+		typePath = "type"
+	}
+	msg.Type = agentrun.MessageSystem
+	msg.Content = lookupString(raw, typePath)
+	return msg, nil
+}
+
+// applyEvent fills msg from the event according to r.
+func (b *Backend) applyEvent(r *EventRule, raw any, msg *agentrun.Message) {
+	msg.Type = agentrun.MessageType(r.Type)
+	if r.Content != "" {
+		msg.Content = lookupString(raw, r.Content)
+	}
+	if r.ResumeID != "" {
+		b.captureSessionID(lookupString(raw, r.ResumeID))
+	}
+	if msg.Type == agentrun.MessageInit && b.markInit(msg) && r.Model != "" {
+		msg.Init.Model = lookupString(raw, r.Model)
+	}
+	if r.StopReason != "" {
+		if sr := lookupString(raw, r.StopReason); sr != "" {
+			msg.StopReason = stoputil.Sanitize(sr)
+		}
+	}
+	if r.ErrorCode != "" {
+		msg.ErrorCode = errfmt.SanitizeCode(lookupString(raw, r.ErrorCode))
+	}
+	if msg.Type == agentrun.MessageError {
+		msg.Content = errfmt.Truncate(msg.Content)
+		errcat.Apply(msg)
+	}
+	if r.Tool != nil {
+		if name := lookupString(raw, r.Tool.Name); name != "" {
+			msg.Tool = &agentrun.ToolCall{
+				Name:   name,
+				Input:  lookupRaw(raw, r.Tool.Input),
+				Output: lookupRaw(raw, r.Tool.Output),
+			}
+		}
+	}
+	if r.Usage != nil {
+		msg.Usage = extractUsage(raw, r.Usage)
+	}
+}
+
+// captureSessionID stores id once, if valid.
+func (b *Backend) captureSessionID(id string) {
+	if id != "" && b.spec.sessionID.MatchString(id) {
+		b.sessionID.CompareAndSwap(nil, &id)
+	}
+}
+
+// matches reports whether every When condition holds.
+func matches(raw any, when map[string]string) bool {
+	for path, want := range when {
+		vals := lookup(raw, path)
+		if len(vals) == 0 {
+			return false
+		}
+		if want == "*" {
+			continue
+		}
+		found := false
+		for _, v := range vals {
+			if s, ok := scalarString(v); ok && s == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// extractUsage reads token counts and cost. Returns nil when none is
+// present.
+func extractUsage(raw any, p *UsagePaths) *agentrun.Usage {
+	u := agentrun.Usage{
+		InputTokens:      lookupInt(raw, p.InputTokens),
+		OutputTokens:     lookupInt(raw, p.OutputTokens),
+		CacheReadTokens:  lookupInt(raw, p.CacheReadTokens),
+		CacheWriteTokens: lookupInt(raw, p.CacheWriteTokens),
+		ThinkingTokens:   lookupInt(raw, p.ThinkingTokens),
+	}
+	if p.CostUSD != "" {
+		if f, ok := lookupFloat(raw, p.CostUSD); ok && f >= 0 && !math.IsInf(f, 0) {
+			u.CostUSD = f
+		}
+	}
+	if u == (agentrun.Usage{}) {
+		return nil
+	}
+	return &u
+}
+
+// --- paths ---
+
+// lookup returns the values at path: dot-separated object keys, array
+// indices, and "*" to visit every array element.
+func lookup(v any, path string) []any {
+	if path == "" {
+		return nil
+	}
+	vals := []any{v}
+	for _, seg := range strings.Split(path, ".") {
+		var next []any
+		for _, cur := range vals {
+			switch c := cur.(type) {
+			case map[string]any:
+				if child, ok := c[seg]; ok {
+					next = append(next, child)
+				}
+			case []any:
+				if seg == "*" {
+					next = append(next, c...)
+				} else if i, err := strconv.Atoi(seg); err == nil && i >= 0 && i < len(c) {
+					next = append(next, c[i])
+				}
+			}
+		}
+		vals = next
+	}
+	return vals
+}
+
+// lookupString concatenates the scalar values at path.
+func lookupString(v any, path string) string {
+	var sb strings.Builder
+	for _, val := range lookup(v, path) {
+		if s, ok := scalarString(val); ok {
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
+
+// lookupRaw returns the first value at path as raw JSON.
+func lookupRaw(v any, path string) json.RawMessage {
+	vals := lookup(v, path)
+	if len(vals) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(vals[0])
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// lookupInt returns the first number at path, or 0 when absent, negative
+// or out of range.
+func lookupInt(v any, path string) int {
+	f, ok := lookupFloat(v, path)
+	if !ok || f < 0 || f > math.MaxInt32 {
+		return 0
+	}
+	return int(f)
+}
+
+// lookupFloat returns the first number at path.
+func lookupFloat(v any, path string) (float64, bool) {
+	for _, val := range lookup(v, path) {
+		if f, ok := val.(float64); ok && !math.IsNaN(f) {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// scalarString formats strings, numbers and booleans; other values
+// (objects, arrays, null) are not scalars.
+func scalarString(v any) (string, bool) {
+	switch s := v.(type) {
+	case string:
+		return s, true
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(s), true
+	}
+	return "", false
+}
+
+// --- plain text ---
+
+func (b *Backend) parseText(line string) (agentrun.Message, error) {
+	msg := agentrun.Message{Timestamp: time.Now()}
+	for i, re := range b.spec.lines {
+		m := re.FindStringSubmatchIndex(line)
+		if m == nil {
+			continue
+		}
+		r := &b.spec.Lines[i]
+		if r.Type == TypeSkip {
+			return agentrun.Message{}, cli.ErrSkipLine
+		}
+		expand := func(tmpl string) string {
+			return string(re.ExpandString(nil, tmpl, line, m))
+		}
+		msg.Type = agentrun.MessageType(r.Type)
+		msg.Content = line
+		if r.Content != "" {
+			msg.Content = expand(r.Content)
+		}
+		if r.ResumeID != "" {
+			b.captureSessionID(expand(r.ResumeID))
+		}
+		if r.ToolName != "" {
+			msg.Tool = &agentrun.ToolCall{Name: expand(r.ToolName)}
+		}
+		if r.ErrorCode != "" {
+			msg.ErrorCode = errfmt.SanitizeCode(expand(r.ErrorCode))
+		}
+		errcat.Apply(&msg)
+		return b.recordText(msg)
+	}
+
+	if b.spec.Unmatched == TypeSkip {
+		return agentrun.Message{}, cli.ErrSkipLine
+	}
+	msg.Type = agentrun.MessageText
+	msg.Content = line
+	return b.recordText(msg)
+}
+
+// recordText tracks the turn's text for ParseEOF.
+func (b *Backend) recordText(msg agentrun.Message) (agentrun.Message, error) {
+	if msg.Type == agentrun.MessageInit {
+		b.markInit(&msg)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch msg.Type {
+	case agentrun.MessageText:
+		b.text = append(b.text, msg.Content)
+	case agentrun.MessageResult:
+		b.resulted = true
+		b.text = nil
+	}
+	return msg, nil
+}
+
+// markInit fills InitMeta and ResumeID on the first MessageInit and
+// reports true. Later inits (each resumed process prints one) become
+// MessageSystem "init".
+func (b *Backend) markInit(msg *agentrun.Message) bool {
+	b.mu.Lock()
+	first := !b.hasInit
+	b.hasInit = true
+	b.mu.Unlock()
+	if !first {
+		msg.Type = agentrun.MessageSystem
+		msg.Content = "init"
+		return false
+	}
+	msg.Init = &agentrun.InitMeta{AgentName: b.spec.Name}
+	msg.ResumeID = b.capturedSessionID()
+	return true
+}
@@ -0,0 +1,193 @@
+package spec_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/spec"
+)
+
+// resumeID returns the session ID b resumes without OptionResumeID: the
+// one it captured from output.
+func resumeID(b *spec.Backend) string {
+	_, args, err := b.ResumeArgs(agentrun.Session{}, "")
+	if err != nil {
+		return ""
+	}
+	for i, arg := range args {
+		if (arg == "--resume" || arg == "--session") && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestParseLine_JSON(t *testing.T) {
+	b := loadAcme(t)
+
+	init, err := b.ParseLine(`{"type":"session","subtype":"started","session_id":"s-1","model":"acme-large"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if init.Type != agentrun.MessageInit || init.ResumeID != "s-1" || init.Init == nil ||
+		init.Init.Model != "acme-large" || init.Init.AgentName != "acme" || resumeID(b) != "s-1" {
+		t.Errorf("init = %+v (%+v)", init, init.Init)
+	}
+	if len(init.Raw) == 0 || init.Timestamp.IsZero() {
+		t.Error("init should carry Raw and Timestamp")
+	}
+
+	// A resumed process prints another init: system message, ID kept.
+	again, _ := b.ParseLine(`{"type":"session","subtype":"started","session_id":"s-2"}`)
+	if again.Type != agentrun.MessageSystem || again.Content != "init" || resumeID(b) != "s-1" {
+		t.Errorf("second init = %+v, id %q", again, resumeID(b))
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want agentrun.Message
+	}{
+		{"Delta", `{"type":"delta","text":"Hel"}`, agentrun.Message{Type: agentrun.MessageTextDelta, Content: "Hel"}},
+		{"TextBlocks", `{"type":"message","content":[{"type":"text","text":"Hello "},{"type":"text","text":"world"}]}`,
+			agentrun.Message{Type: agentrun.MessageText, Content: "Hello world"}},
+		{"ToolCall", `{"type":"message","content":[{"type":"tool_call","name":"read","args":{"path":"a.go"}}]}`,
+			agentrun.Message{Type: agentrun.MessageToolUse, Tool: &agentrun.ToolCall{Name: "read", Input: []byte(`{"path":"a.go"}`)}}},
+		{"ToolResult", `{"type":"tool_done","name":"read","output":"package a"}`,
+			agentrun.Message{Type: agentrun.MessageToolResult, Tool: &agentrun.ToolCall{Name: "read", Output: []byte(`"package a"`)}}},
+		{"Error", `{"type":"done","error":{"code":"rate_limit","message":"slow down"}}`,
+			agentrun.Message{Type: agentrun.MessageError, Content: "slow down", ErrorCode: "rate_limit"}},
+		{"Result", `{"type":"done","answer":"42","reason":"end_turn","usage":{"in":10,"out":5,"cost":0.01}}`,
+			agentrun.Message{Type: agentrun.MessageResult, Content: "42", StopReason: agentrun.StopEndTurn,
+				Usage: &agentrun.Usage{InputTokens: 10, OutputTokens: 5, CostUSD: 0.01}}},
+		{"Unknown", `{"type":"progress","pct":50}`, agentrun.Message{Type: agentrun.MessageSystem, Content: "progress"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.ParseLine(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertMessage(t, got, tt.want)
+		})
+	}
+
+	if _, err := b.ParseLine(`{"type":"heartbeat"}`); !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("heartbeat err = %v, want ErrSkipLine", err)
+	}
+	if _, err := b.ParseLine(`[1,2]`); err == nil || errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("array err = %v, want parse error", err)
+	}
+	if _, err := b.ParseEOF(); !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("JSON ParseEOF err = %v, want ErrSkipLine", err)
+	}
+}
+
+func TestParseLine_Text(t *testing.T) {
+	s, err := spec.Parse([]byte(`{
+		"name": "plain",
+		"binary": "plain",
+		"spawn": ["ask", "--", "{prompt}"],
+		"resume": ["ask", "--session", "{session_id}", "--", "{prompt}"],
+		"format": "text",
+		"lines": [
+			{"match": "^session: (?P<id>\\S+)$", "type": "init", "resume_id": "${id}"},
+			{"match": "^> running (\\w+)", "type": "tool_use", "tool_name": "$1", "content": "$1"},
+			{"match": "^ERROR \\[(\\w+)\\] (.*)$", "type": "error", "error_code": "$1", "content": "$2"},
+			{"match": "^\\s*\\.\\.\\.$", "type": "skip"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := spec.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := backend.(*spec.Backend)
+
+	parse := func(line string) agentrun.Message {
+		t.Helper()
+		msg, err := b.ParseLine(line)
+		if err != nil {
+			t.Fatalf("ParseLine(%q): %v", line, err)
+		}
+		return msg
+	}
+
+	init := parse("session: abc-1")
+	if init.Type != agentrun.MessageInit || init.ResumeID != "abc-1" || resumeID(b) != "abc-1" {
+		t.Errorf("init = %+v", init)
+	}
+	assertMessage(t, parse("> running grep on src"), agentrun.Message{
+		Type: agentrun.MessageToolUse, Content: "grep", Tool: &agentrun.ToolCall{Name: "grep"},
+	})
+	if _, err := b.ParseLine("   ..."); !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("skip rule err = %v", err)
+	}
+	assertMessage(t, parse("The answer"), agentrun.Message{Type: agentrun.MessageText, Content: "The answer"})
+	assertMessage(t, parse("is 42."), agentrun.Message{Type: agentrun.MessageText, Content: "is 42."})
+
+	res, err := b.ParseEOF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMessage(t, res, agentrun.Message{Type: agentrun.MessageResult, Content: "The answer\nis 42.", StopReason: agentrun.StopEndTurn})
+
+	// Next turn: an error line, then EOF still ends the turn.
+	assertMessage(t, parse("ERROR [quota] out of credits"), agentrun.Message{
+		Type: agentrun.MessageError, Content: "out of credits", ErrorCode: "quota",
+	})
+	if res, _ := b.ParseEOF(); res.Type != agentrun.MessageResult || res.Content != "" {
+		t.Errorf("second EOF = %+v", res)
+	}
+}
+
+func TestParseEOF_AfterResultRule(t *testing.T) {
+	s, err := spec.Parse([]byte(`{
+		"name": "plain", "binary": "plain",
+		"spawn": ["{prompt}"], "resume": ["{session_id}", "{prompt}"],
+		"format": "text", "unmatched": "skip",
+		"lines": [{"match": "^DONE: (.*)$", "type": "result", "content": "$1"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := spec.New(s)
+	p := b.(*spec.Backend)
+	if _, err := p.ParseLine("noise"); !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("unmatched err = %v, want ErrSkipLine", err)
+	}
+	if msg, _ := p.ParseLine("DONE: ok"); msg.Type != agentrun.MessageResult || msg.Content != "ok" {
+		t.Errorf("result = %+v", msg)
+	}
+	if _, err := p.ParseEOF(); !errors.Is(err, cli.ErrSkipLine) {
+		t.Errorf("EOF after result err = %v, want ErrSkipLine", err)
+	}
+}
+
+// assertMessage compares the fields the spec rules set.
+func assertMessage(t *testing.T, got, want agentrun.Message) {
+	t.Helper()
+	if got.Type != want.Type || got.Content != want.Content || got.ErrorCode != want.ErrorCode || got.StopReason != want.StopReason {
+		t.Errorf("message = {%s %q code=%q stop=%q}, want {%s %q code=%q stop=%q}",
+			got.Type, got.Content, got.ErrorCode, got.StopReason, want.Type, want.Content, want.ErrorCode, want.StopReason)
+	}
+	switch {
+	case (got.Tool == nil) != (want.Tool == nil):
+		t.Errorf("tool = %+v, want %+v", got.Tool, want.Tool)
+	case got.Tool != nil:
+		if got.Tool.Name != want.Tool.Name || string(got.Tool.Input) != string(want.Tool.Input) || string(got.Tool.Output) != string(want.Tool.Output) {
+			t.Errorf("tool = {%s %s %s}, want {%s %s %s}", got.Tool.Name, got.Tool.Input, got.Tool.Output,
+				want.Tool.Name, want.Tool.Input, want.Tool.Output)
+		}
+	}
+	switch {
+	case (got.Usage == nil) != (want.Usage == nil):
+		t.Errorf("usage = %+v, want %+v", got.Usage, want.Usage)
+	case got.Usage != nil && *got.Usage != *want.Usage:
+		t.Errorf("usage = %+v, want %+v", *got.Usage, *want.Usage)
+	}
+}
@@ -0,0 +1,439 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dmora/agentrun"
+)
+
+// Output formats.
+const (
+	FormatJSON = "json" // one JSON event per line (default)
+	FormatText = "text" // plain text lines matched by regular expressions
+)
+
+// TypeSkip is the rule type that consumes a line without a message.
+const TypeSkip = "skip"
+
+// defaultSessionIDPattern is used when Spec.SessionIDPattern is empty.
+// Leading dashes are rejected so an ID is never parsed as a flag.
+const defaultSessionIDPattern = `^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$`
+
+// validName matches backend names; the name prefixes error messages.
+var validName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// Spec declares a CLI backend: how to build its argv and how to map its
+// output lines to messages. Specs are usually loaded from JSON with Parse
+// or Load.
+type Spec struct {
+	// Name identifies the backend in error messages and MessageInit.
+	Name string `json:"name"`
+
+	// Binary is the executable, resolved via PATH. Required.
+	Binary string `json:"binary"`
+
+	// Spawn is the argv template for a new session. Required.
+	Spawn []Arg `json:"spawn"`
+
+	// Resume is the argv template for continuing a session on each Send
+	// (resume-per-turn). Must reference {session_id}.
+	Resume []Arg `json:"resume,omitempty"`
+
+	// Stream is the argv template for a long-lived process that reads
+	// user messages from stdin. Requires Input.
+	Stream []Arg `json:"stream,omitempty"`
+
+	// Input is the stdin line written per message in streaming mode.
+	// {message} is replaced by the message as a JSON string (quoted), so
+	// the template is typically a JSON object; a newline is appended.
+	Input string `json:"input,omitempty"`
+
+	// SessionIDPattern validates session IDs, whether captured from
+	// output or given via OptionResumeID. Defaults to
+	// ^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$.
+	SessionIDPattern string `json:"session_id_pattern,omitempty"`
+
+	// Options maps session options to flags, spliced in at {options}.
+	Options []OptionSpec `json:"options,omitempty"`
+
+	// Format is FormatJSON (default) or FormatText.
+	Format string `json:"format,omitempty"`
+
+	// Events map JSON lines to messages (FormatJSON). The first rule
+	// whose When conditions all hold applies; unmatched events become
+	// MessageSystem with the value at TypePath as Content.
+	Events []EventRule `json:"events,omitempty"`
+
+	// TypePath locates the event type reported for unmatched JSON
+	// events. Defaults to "type".
+	TypePath string `json:"type_path,omitempty"`
+
+	// Lines map plain text lines to messages (FormatText). The first
+	// matching rule applies; unmatched lines become Unmatched messages.
+	Lines []LineRule `json:"lines,omitempty"`
+
+	// Unmatched is the message type for text lines no rule matches:
+	// "text" (default) or "skip".
+	Unmatched string `json:"unmatched,omitempty"`
+}
+
+// Arg is one element of an argv template. In JSON it is either a string
+// or an array of strings (a group). Placeholders:
+//
+//   - {prompt}: the prompt (Session.Prompt, or the message on resume)
+//   - {model}: Session.Model
+//   - {session_id}: the captured or OptionResumeID session ID
+//   - {option:KEY}: the raw value of session option KEY
+//   - {options}: alone in a string element, splices the flags produced by
+//     Spec.Options
+//
+// A group is emitted only when every placeholder in it resolves to a
+// non-empty value, so a flag is dropped together with its value:
+// ["--model", "{model}"]. A string element whose placeholder resolves
+// empty is dropped.
+type Arg []string
+
+// UnmarshalJSON accepts a string or an array of strings.
+func (a *Arg) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = Arg{s}
+		return nil
+	}
+	var group []string
+	if err := json.Unmarshal(data, &group); err != nil {
+		return errors.New("argument must be a string or an array of strings")
+	}
+	if len(group) == 0 {
+		return errors.New("argument group must not be empty")
+	}
+	*a = group
+	return nil
+}
+
+// MarshalJSON writes single-element args as strings.
+func (a Arg) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// OptionSpec maps one session option to flags. Exactly one of Flag or
+// Values must be set.
+type OptionSpec struct {
+	// Key is the session option key, e.g. agentrun.OptionEffort
+	// ("effort") or a backend-namespaced key ("mycli.sandbox").
+	Key string `json:"key"`
+
+	// Flag is emitted followed by the option value ("--effort", "high").
+	// A Flag ending in "=" is joined with the value ("--effort=high").
+	Flag string `json:"flag,omitempty"`
+
+	// Bool emits Flag alone when the option parses as true.
+	Bool bool `json:"bool,omitempty"`
+
+	// List emits Flag once per newline-separated entry
+	// (agentrun.ParseListOption), as for agentrun.OptionAddDirs.
+	List bool `json:"list,omitempty"`
+
+	// Enum restricts Flag values.
+	Enum []string `json:"enum,omitempty"`
+
+	// Pattern is a regular expression Flag values must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Values maps each accepted option value to the args it produces,
+	// e.g. {"plan": ["--sandbox", "read-only"], "act": []}.
+	Values map[string][]string `json:"values,omitempty"`
+
+	// SpawnOnly skips the option when continuing a session.
+	SpawnOnly bool `json:"spawn_only,omitempty"`
+}
+
+// EventRule maps a JSON event to a message. Fields other than When and
+// Type are paths into the event: dot-separated object keys, array
+// indices, and "*" to visit every array element (text of all visited
+// elements is concatenated).
+type EventRule struct {
+	// When lists path → value conditions that must all hold. The value
+	// "*" only requires the path to be present.
+	When map[string]string `json:"when"`
+
+	// Type is the agentrun.MessageType to emit, or "skip".
+	Type string `json:"type"`
+
+	Content    string `json:"content,omitempty"`
+	ResumeID   string `json:"resume_id,omitempty"` // session ID, captured once for {session_id}
+	Model      string `json:"model,omitempty"`     // InitMeta.Model
+	StopReason string `json:"stop_reason,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+
+	Tool  *ToolPaths  `json:"tool,omitempty"`
+	Usage *UsagePaths `json:"usage,omitempty"`
+}
+
+// ToolPaths locate a tool call in an event. Input and Output are taken as
+// raw JSON.
+type ToolPaths struct {
+	Name   string `json:"name"`
+	Input  string `json:"input,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+// UsagePaths locate token counts and cost in an event.
+type UsagePaths struct {
+	InputTokens      string `json:"input_tokens,omitempty"`
+	OutputTokens     string `json:"output_tokens,omitempty"`
+	CacheReadTokens  string `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens string `json:"cache_write_tokens,omitempty"`
+	ThinkingTokens   string `json:"thinking_tokens,omitempty"`
+	CostUSD          string `json:"cost_usd,omitempty"`
+}
+
+// LineRule maps a plain text line to a message. Content, ResumeID,
+// ToolName and ErrorCode are regexp.Expand templates over Match ($1,
+// ${name}); Content defaults to the whole line.
+type LineRule struct {
+	Match string `json:"match"`
+	Type  string `json:"type"`
+
+	Content   string `json:"content,omitempty"`
+	ResumeID  string `json:"resume_id,omitempty"`
+	ToolName  string `json:"tool_name,omitempty"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+// Parse decodes a JSON spec and validates it. Unknown fields are errors.
+// YAML specs can be converted with any YAML-to-JSON library first.
+func Parse(data []byte) (*Spec, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var s Spec
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("spec: %w", err)
+	}
+	if _, err := s.compile(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Load reads and parses the JSON spec at path.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("spec: %w", err)
+	}
+	return Parse(data)
+}
+
+// Validate reports the first problem with the spec.
+func (s *Spec) Validate() error {
+	_, err := s.compile()
+	return err
+}
+
+// --- compilation ---
+
+// compiled is a validated spec with its regular expressions built.
+type compiled struct {
+	*Spec
+	sessionID *regexp.Regexp
+	patterns  map[string]*regexp.Regexp // OptionSpec.Key → Pattern
+	lines     []*regexp.Regexp          // parallel to Spec.Lines
+}
+
+// placeholder matches {name} and {option:KEY} references.
+var placeholder = regexp.MustCompile(`\{([a-z_]+)(?::([^{}]+))?\}`)
+
+func (s *Spec) compile() (*compiled, error) {
+	if !validName.MatchString(s.Name) {
+		return nil, fmt.Errorf("spec: invalid name %q: must match %s", s.Name, validName)
+	}
+	fail := func(format string, args ...any) (*compiled, error) {
+		return nil, fmt.Errorf("spec: %s: "+format, append([]any{s.Name}, args...)...)
+	}
+	if s.Binary == "" || strings.ContainsRune(s.Binary, 0) {
+		return fail("binary is required")
+	}
+
+	c := &compiled{Spec: s, patterns: map[string]*regexp.Regexp{}}
+	pattern := s.SessionIDPattern
+	if pattern == "" {
+		pattern = defaultSessionIDPattern
+	}
+	var err error
+	if c.sessionID, err = regexp.Compile(pattern); err != nil {
+		return fail("session_id_pattern: %v", err)
+	}
+
+	if len(s.Spawn) == 0 {
+		return fail("spawn template is required")
+	}
+	if len(s.Resume) == 0 && len(s.Stream) == 0 {
+		return fail("resume or stream template is required to send messages")
+	}
+	for _, t := range []struct {
+		name string
+		args []Arg
+	}{{"spawn", s.Spawn}, {"resume", s.Resume}, {"stream", s.Stream}} {
+		if err := checkTemplate(t.args); err != nil {
+			return fail("%s: %v", t.name, err)
+		}
+	}
+	if len(s.Resume) > 0 && !templateUses(s.Resume, "session_id") {
+		return fail("resume template must reference {session_id}")
+	}
+	if len(s.Stream) > 0 {
+		if templateUses(s.Stream, "prompt") {
+			return fail("stream template must not reference {prompt}: messages are written to stdin")
+		}
+		if !strings.Contains(s.Input, "{message}") {
+			return fail("stream template requires an input template with {message}")
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, o := range s.Options {
+		if err := c.compileOption(o, seen); err != nil {
+			return fail("options[%d]: %v", i, err)
+		}
+	}
+
+	switch s.Format {
+	case "", FormatJSON:
+		if len(s.Lines) > 0 {
+			return fail("lines rules require format %q", FormatText)
+		}
+		for i, r := range s.Events {
+			if err := checkEventRule(r); err != nil {
+				return fail("events[%d]: %v", i, err)
+			}
+		}
+	case FormatText:
+		if len(s.Events) > 0 {
+			return fail("events rules require format %q", FormatJSON)
+		}
+		for i, r := range s.Lines {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return fail("lines[%d]: %v", i, err)
+			}
+			if err := checkType(r.Type); err != nil {
+				return fail("lines[%d]: %v", i, err)
+			}
+			c.lines = append(c.lines, re)
+		}
+		switch s.Unmatched {
+		case "", string(agentrun.MessageText), TypeSkip:
+		default:
+			return fail("unmatched must be %q or %q", agentrun.MessageText, TypeSkip)
+		}
+	default:
+		return fail("unknown format %q: valid: %s, %s", s.Format, FormatJSON, FormatText)
+	}
+	return c, nil
+}
+
+func (c *compiled) compileOption(o OptionSpec, seen map[string]bool) error {
+	if o.Key == "" {
+		return errors.New("key is required")
+	}
+	if seen[o.Key] {
+		return fmt.Errorf("duplicate key %q", o.Key)
+	}
+	seen[o.Key] = true
+	if o.Key == agentrun.OptionResumeID {
+		return errors.New("resume_id is mapped through {session_id}")
+	}
+	if (o.Flag == "") == (len(o.Values) == 0) {
+		return fmt.Errorf("%s: exactly one of flag or values is required", o.Key)
+	}
+	if len(o.Values) > 0 && (o.Bool || o.List || len(o.Enum) > 0 || o.Pattern != "") {
+		return fmt.Errorf("%s: values cannot be combined with bool, list, enum or pattern", o.Key)
+	}
+	if o.Bool && o.List {
+		return fmt.Errorf("%s: bool and list are exclusive", o.Key)
+	}
+	if o.Pattern != "" {
+		re, err := regexp.Compile(o.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern: %w", o.Key, err)
+		}
+		c.patterns[o.Key] = re
+	}
+	return nil
+}
+
+// checkTemplate rejects unknown placeholders and misplaced {options}.
+func checkTemplate(args []Arg) error {
+	for _, arg := range args {
+		for _, el := range arg {
+			if strings.ContainsRune(el, 0) {
+				return errors.New("argument contains null bytes")
+			}
+			for _, m := range placeholder.FindAllStringSubmatch(el, -1) {
+				switch m[1] {
+				case "prompt", "model", "session_id":
+				case "option":
+					if m[2] == "" {
+						return fmt.Errorf("%s: missing option key", m[0])
+					}
+				case "options":
+					if el != "{options}" || len(arg) != 1 {
+						return errors.New("{options} must be a string element of its own")
+					}
+				default:
+					return fmt.Errorf("unknown placeholder %s", m[0])
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// templateUses reports whether args reference the named placeholder.
+func templateUses(args []Arg, name string) bool {
+	for _, arg := range args {
+		for _, el := range arg {
+			for _, m := range placeholder.FindAllStringSubmatch(el, -1) {
+				if m[1] == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func checkEventRule(r EventRule) error {
+	if len(r.When) == 0 {
+		return errors.New("when is required")
+	}
+	if err := checkType(r.Type); err != nil {
+		return err
+	}
+	if r.Tool != nil && r.Tool.Name == "" {
+		return errors.New("tool.name is required")
+	}
+	return nil
+}
+
+// checkType accepts agentrun message types and "skip".
+func checkType(t string) error {
+	switch agentrun.MessageType(t) {
+	case agentrun.MessageText, agentrun.MessageToolUse, agentrun.MessageToolResult,
+		agentrun.MessageError, agentrun.MessageSystem, agentrun.MessageInit,
+		agentrun.MessageResult, agentrun.MessageTextDelta, agentrun.MessageToolUseDelta,
+		agentrun.MessageThinkingDelta, agentrun.MessageThinking, TypeSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown message type %q", t)
+}
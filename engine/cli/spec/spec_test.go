@@ -0,0 +1,215 @@
+package spec_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/spec"
+)
+
+func loadAcme(t *testing.T, opts ...spec.Option) *spec.Backend {
+	t.Helper()
+	s, err := spec.Load("testdata/acme.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := spec.New(s, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*spec.Backend)
+}
+
+func TestSpawnArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		want    []string
+	}{
+		{
+			name:    "Minimal",
+			session: agentrun.Session{Prompt: "hi"},
+			want:    []string{"run", "--json", "--prompt=hi"},
+		},
+		{
+			name: "ModelOptionsAndColdResume",
+			session: agentrun.Session{Prompt: "-dash", Model: "m1", Options: map[string]string{
+				agentrun.OptionResumeID: "s-123",
+				agentrun.OptionMode:     "plan",
+				agentrun.OptionHITL:     "off",
+				agentrun.OptionEffort:   "high",
+				agentrun.OptionAddDirs:  "/a\n/b",
+				"acme.verbose":          "yes",
+				"acme.profile":          "work",
+			}},
+			want: []string{
+				"run", "--model", "m1", "--resume", "s-123",
+				"--read-only", "--yes", "--effort", "high", "--dir", "/a", "--dir", "/b",
+				"--verbose", "--profile=work", "--json", "--prompt=-dash",
+			},
+		},
+		{
+			name: "InvalidValuesSkipped",
+			session: agentrun.Session{Prompt: "hi\x00", Model: "-evil", Options: map[string]string{
+				agentrun.OptionResumeID: "-bad",
+				agentrun.OptionMode:     "yolo",
+				agentrun.OptionEffort:   "max",
+				agentrun.OptionAddDirs:  "-x",
+				"acme.verbose":          "maybe",
+				"acme.profile":          "Work1",
+			}},
+			want: []string{"run", "--json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin, args := loadAcme(t).SpawnArgs(tt.session)
+			if bin != "acme" {
+				t.Errorf("binary = %q", bin)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("args = %q\nwant   %q", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumeArgs(t *testing.T) {
+	b := loadAcme(t, spec.WithBinary("/opt/acme"))
+	if _, err := b.ParseLine(`{"type":"session","subtype":"started","session_id":"s-42"}`); err != nil {
+		t.Fatal(err)
+	}
+	bin, args, err := b.ResumeArgs(agentrun.Session{Options: map[string]string{
+		agentrun.OptionResumeID: "ignored",
+		agentrun.OptionEffort:   "high", // spawn_only
+		agentrun.OptionMode:     "plan",
+	}}, "next")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"run", "--resume", "s-42", "--read-only", "--json", "--prompt=next"}
+	if bin != "/opt/acme" || !reflect.DeepEqual(args, want) {
+		t.Errorf("ResumeArgs = %q %q, want %q", bin, args, want)
+	}
+}
+
+func TestResumeArgs_Errors(t *testing.T) {
+	withID := func(opts map[string]string) agentrun.Session {
+		opts[agentrun.OptionResumeID] = "s-1"
+		return agentrun.Session{Options: opts}
+	}
+	tests := []struct {
+		name    string
+		session agentrun.Session
+		prompt  string
+		wantErr string
+	}{
+		{"NoID", agentrun.Session{}, "x", "no session ID"},
+		{"BadID", agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: "a b"}}, "x", "invalid session ID"},
+		{"NullPrompt", withID(map[string]string{}), "x\x00", "null bytes"},
+		{"BadMode", withID(map[string]string{agentrun.OptionMode: "yolo"}), "x", "unknown mode"},
+		{"BadEffort", withID(map[string]string{agentrun.OptionEffort: "extreme"}), "x", "unknown effort"},
+		{"BadBool", withID(map[string]string{"acme.verbose": "maybe"}), "x", "acme.verbose"},
+		{"BadPattern", withID(map[string]string{"acme.profile": "A"}), "x", "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := loadAcme(t).ResumeArgs(tt.session, tt.prompt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), "acme: ") {
+				t.Errorf("err = %v, want acme: prefix", err)
+			}
+		})
+	}
+}
+
+func TestStreamBackend(t *testing.T) {
+	s, err := spec.Parse([]byte(`{
+		"name": "chatty",
+		"binary": "chatty",
+		"spawn": ["--json", "{prompt}"],
+		"stream": ["--stdin", ["--model", "{model}"]],
+		"input": "{\"type\":\"user\",\"text\":{message}}",
+		"events": [{"when": {"type": "end"}, "type": "result"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := spec.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, ok := b.(*spec.StreamBackend)
+	if !ok {
+		t.Fatalf("New = %T, want *spec.StreamBackend", b)
+	}
+	var _ cli.Streamer = sb
+
+	if _, args := sb.StreamArgs(agentrun.Session{Model: "m"}); !reflect.DeepEqual(args, []string{"--stdin", "--model", "m"}) {
+		t.Errorf("StreamArgs = %q", args)
+	}
+	data, err := sb.FormatInput("say \"hi\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"user","text":"say \"hi\"\n"}` + "\n"; string(data) != want {
+		t.Errorf("FormatInput = %q, want %q", data, want)
+	}
+	if _, err := sb.FormatInput("x\x00"); err == nil {
+		t.Error("FormatInput with null bytes should fail")
+	}
+	if _, _, err := sb.ResumeArgs(agentrun.Session{Options: map[string]string{agentrun.OptionResumeID: "s1"}}, "x"); err == nil {
+		t.Error("ResumeArgs without resume template should fail")
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	base := `"name":"x","binary":"x","spawn":["{prompt}"],"resume":["{session_id}","{prompt}"]`
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"UnknownField", `{` + base + `,"bogus":1}`, "unknown field"},
+		{"BadName", `{"name":"X Y","binary":"x","spawn":["a"],"resume":["{session_id}"]}`, "invalid name"},
+		{"NoBinary", `{"name":"x","spawn":["a"],"resume":["{session_id}"]}`, "binary is required"},
+		{"NoSpawn", `{"name":"x","binary":"x","resume":["{session_id}"]}`, "spawn template is required"},
+		{"NoSendPath", `{"name":"x","binary":"x","spawn":["a"]}`, "resume or stream"},
+		{"ResumeWithoutID", `{"name":"x","binary":"x","spawn":["a"],"resume":["b"]}`, "must reference {session_id}"},
+		{"UnknownPlaceholder", `{"name":"x","binary":"x","spawn":["{nope}"],"resume":["{session_id}"]}`, "unknown placeholder"},
+		{"OptionsInGroup", `{"name":"x","binary":"x","spawn":[["a","{options}"]],"resume":["{session_id}"]}`, "{options}"},
+		{"EmptyGroup", `{"name":"x","binary":"x","spawn":[[]],"resume":["{session_id}"]}`, "must not be empty"},
+		{"StreamPrompt", `{"name":"x","binary":"x","spawn":["a"],"stream":["{prompt}"],"input":"{message}"}`, "must not reference {prompt}"},
+		{"StreamNoInput", `{"name":"x","binary":"x","spawn":["a"],"stream":["s"]}`, "input template"},
+		{"BadPattern", `{` + base + `,"session_id_pattern":"("}`, "session_id_pattern"},
+		{"OptionNoFlag", `{` + base + `,"options":[{"key":"k"}]}`, "exactly one of flag or values"},
+		{"OptionDup", `{` + base + `,"options":[{"key":"k","flag":"-k"},{"key":"k","flag":"-k"}]}`, "duplicate key"},
+		{"OptionResumeID", `{` + base + `,"options":[{"key":"resume_id","flag":"-r"}]}`, "{session_id}"},
+		{"OptionMixed", `{` + base + `,"options":[{"key":"k","values":{"a":[]},"bool":true}]}`, "cannot be combined"},
+		{"BadFormat", `{` + base + `,"format":"xml"}`, "unknown format"},
+		{"EventNoWhen", `{` + base + `,"events":[{"type":"text"}]}`, "when is required"},
+		{"EventBadType", `{` + base + `,"events":[{"when":{"a":"b"},"type":"bogus"}]}`, "unknown message type"},
+		{"LinesInJSON", `{` + base + `,"lines":[{"match":"x","type":"text"}]}`, "require format"},
+		{"BadLineRegex", `{` + base + `,"format":"text","lines":[{"match":"(","type":"text"}]}`, "lines[0]"},
+		{"BadUnmatched", `{` + base + `,"format":"text","unmatched":"error"}`, "unmatched"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := spec.Parse([]byte(tt.json))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	if _, err := spec.Load("testdata/missing.json"); err == nil {
+		t.Error("Load of a missing file should fail")
+	}
+}
@@ -0,0 +1,226 @@
+// Package errcat maps backend error codes and messages to
+// agentrun.ErrorCategory and extracts retry-after hints, shared by every
+// backend parser and engine.
+package errcat
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// rule maps any of its needles (substrings) to a category. Rules are
+// checked in order, so more specific categories come first.
+type rule struct {
+	cat     agentrun.ErrorCategory
+	needles []string
+}
+
+// codeRules match normalized error codes: lowercase with "_", "-", "."
+// and spaces removed, so "rate_limit_error", "RateLimitError" and
+// "usageLimitExceeded" all compare alike.
+var codeRules = []rule{
+	{agentrun.CategoryContextExceeded, []string{"contextlength", "contextwindow", "contextexceeded", "prompttoolong"}},
+	{agentrun.CategoryRateLimited, []string{"ratelimit", "usagelimit", "quota", "toomanyrequests", "resourceexhausted", "429"}},
+	{agentrun.CategoryOverloaded, []string{"overloaded", "unavailable", "capacity", "connectionfailed", "disconnected", "502", "503", "504", "529"}},
+	{agentrun.CategoryAuth, []string{"auth", "permissionerror", "forbidden", "apikey", "credential", "login", "401", "403"}},
+	{agentrun.CategoryInvalidRequest, []string{"invalidrequest", "badrequest", "invalidparam", "invalidargument", "notfound", "400", "404"}},
+	{agentrun.CategoryToolFailed, []string{"tool", "sandbox"}},
+	{agentrun.CategoryInternal, []string{"internal", "servererror", "apierror", "duringexecution", "500"}},
+}
+
+// messageRules match lowercase error text, for backends that report no
+// code or an uninformative one. Phrases are narrower than code needles
+// because free text mentions words like "tool" in passing.
+var messageRules = []rule{
+	{agentrun.CategoryContextExceeded, []string{"context window", "context length", "context_length", "prompt is too long", "maximum context", "too many tokens", "input is too long"}},
+	{agentrun.CategoryRateLimited, []string{"rate limit", "rate_limit", "too many requests", "usage limit", "quota", "resource_exhausted", "resource exhausted"}},
+	{agentrun.CategoryOverloaded, []string{"overloaded", "service unavailable", "temporarily unavailable", "at capacity", "stream disconnected"}},
+	{agentrun.CategoryAuth, []string{"unauthorized", "authentication", "not authenticated", "login required", "invalid api key", "api key", "forbidden"}},
+	{agentrun.CategoryInvalidRequest, []string{"invalid request", "invalid_request", "bad request", "unknown model", "model not found", "invalid parameter"}},
+	{agentrun.CategoryToolFailed, []string{"tool call failed", "tool_call failed", "tool failed", "tool error"}},
+	{agentrun.CategoryInternal, []string{"internal server error", "internal error"}},
+}
+
+var codeReplacer = strings.NewReplacer("_", "", "-", "", ".", "", " ", "")
+
+// Classify returns the category for a backend error code and message.
+// The code decides when it matches a rule; the message is the fallback.
+// Generic codes are refined by the message: "api_error: rate limited" is
+// a rate limit, and providers report context overflow as a plain invalid
+// request ("invalid_request_error: prompt is too long"). Returns "" when
+// neither matches.
+func Classify(code, message string) agentrun.ErrorCategory {
+	byCode := match(codeReplacer.Replace(strings.ToLower(code)), codeRules)
+	switch byCode {
+	case "", agentrun.CategoryInternal, agentrun.CategoryInvalidRequest:
+	default:
+		return byCode
+	}
+	byMessage := match(strings.ToLower(message), messageRules)
+	switch {
+	case byCode == "",
+		byCode == agentrun.CategoryInternal && byMessage != "",
+		byMessage == agentrun.CategoryContextExceeded:
+		return byMessage
+	}
+	return byCode
+}
+
+func match(s string, rules []rule) agentrun.ErrorCategory {
+	if s == "" {
+		return ""
+	}
+	for _, r := range rules {
+		for _, n := range r.needles {
+			if strings.Contains(s, n) {
+				return r.cat
+			}
+		}
+	}
+	return ""
+}
+
+// FromStatus returns the category for an HTTP status code, or "" for
+// statuses that carry no category.
+func FromStatus(status int) agentrun.ErrorCategory {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return agentrun.CategoryRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return agentrun.CategoryAuth
+	case status == http.StatusBadGateway || status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout || status == 529: // Anthropic "overloaded"
+		return agentrun.CategoryOverloaded
+	case status >= 500:
+		return agentrun.CategoryInternal
+	case status >= 400:
+		return agentrun.CategoryInvalidRequest
+	}
+	return ""
+}
+
+// Apply sets msg.ErrorCategory and msg.RetryAfter from msg.ErrorCode and
+// msg.Content when msg is a MessageError without a category, and marks
+// msg.RateLimit exceeded (allocating it if needed) for rate_limited
+// errors. Parsers call it after filling the error fields.
+func Apply(msg *agentrun.Message) {
+	if msg.Type != agentrun.MessageError {
+		return
+	}
+	if msg.ErrorCategory == "" {
+		msg.ErrorCategory = Classify(msg.ErrorCode, msg.Content)
+	}
+	if msg.RetryAfter == 0 {
+		msg.RetryAfter = RetryAfter(msg.Content)
+	}
+	if msg.ErrorCategory == agentrun.CategoryRateLimited {
+		var rl agentrun.RateLimit
+		if msg.RateLimit != nil {
+			rl = *msg.RateLimit // copy: the caller may share it with an error
+		}
+		rl.Exceeded = true
+		msg.RateLimit = &rl
+	}
+}
+
+var (
+	// "try again in 1m30.5s", "retry after 20ms".
+	goDurationHint = regexp.MustCompile(`(?i)\b(?:retry|try again)\s+(?:after|in)\s+((?:\d+(?:\.\d+)?(?:ms|h|m|s))+)\b`)
+	// "retry after 30 seconds", "try again in 2 days 3 hours, and 5 minutes".
+	unitHint = regexp.MustCompile(`(?i)\b(?:retry|try again)\s+(?:after|in)\s+(` + unitTerm + `(?:[\s,]+(?:and\s+)?` + unitTerm + `)*)`)
+	unitPart = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*([a-z]+)`)
+)
+
+const unitTerm = `\d+(?:\.\d+)?\s*(?:milliseconds?|seconds?|secs?|minutes?|mins?|hours?|hrs?|days?)\b`
+
+var units = map[byte]time.Duration{'m': time.Minute, 's': time.Second, 'h': time.Hour, 'd': 24 * time.Hour}
+
+// RetryAfter extracts a retry hint such as "try again in 20s" or "retry
+// after 30 seconds" from error text. Returns 0 when there is none.
+func RetryAfter(text string) time.Duration {
+	if m := goDurationHint.FindStringSubmatch(text); m != nil {
+		if d, err := time.ParseDuration(m[1]); err == nil && d > 0 {
+			return d
+		}
+	}
+	m := unitHint.FindStringSubmatch(text)
+	if m == nil {
+		return 0
+	}
+	var total time.Duration
+	for _, part := range unitPart.FindAllStringSubmatch(m[1], -1) {
+		n, err := strconv.ParseFloat(part[1], 64)
+		if err != nil {
+			return 0
+		}
+		unit := strings.ToLower(part[2])
+		if strings.HasPrefix(unit, "milli") {
+			total += time.Duration(n * float64(time.Millisecond))
+		} else {
+			total += time.Duration(n * float64(units[unit[0]]))
+		}
+	}
+	return max(total, 0)
+}
+
+// RetryAfterHeader parses an HTTP Retry-After value — delay seconds or an
+// HTTP date relative to now. Returns 0 when absent, malformed or past.
+func RetryAfterHeader(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// rateLimitKinds are the limits reported in Anthropic and OpenAI headers.
+var rateLimitKinds = []string{"requests", "tokens", "input-tokens", "output-tokens"}
+
+// RateLimitHeaders returns the most consumed limit in Anthropic
+// (anthropic-ratelimit-<kind>-limit/-remaining/-reset, RFC 3339 reset) or
+// OpenAI (x-ratelimit-limit/remaining/reset-<kind>, duration reset)
+// response headers, with relative resets taken from now. Returns nil when
+// no limit is reported.
+func RateLimitHeaders(h http.Header, now time.Time) *agentrun.RateLimit {
+	var best *agentrun.RateLimit
+	for _, kind := range rateLimitKinds {
+		limit, remaining, reset := h.Get("anthropic-ratelimit-"+kind+"-limit"),
+			h.Get("anthropic-ratelimit-"+kind+"-remaining"), h.Get("anthropic-ratelimit-"+kind+"-reset")
+		var resetsAt time.Time
+		if limit != "" {
+			resetsAt, _ = time.Parse(time.RFC3339, reset)
+		} else {
+			limit, remaining, reset = h.Get("x-ratelimit-limit-"+kind),
+				h.Get("x-ratelimit-remaining-"+kind), h.Get("x-ratelimit-reset-"+kind)
+			if d, err := time.ParseDuration(reset); err == nil && d >= 0 {
+				resetsAt = now.Add(d)
+			}
+		}
+		l, err1 := strconv.Atoi(limit)
+		r, err2 := strconv.Atoi(remaining)
+		if err1 != nil || err2 != nil || l <= 0 {
+			continue
+		}
+		rl := &agentrun.RateLimit{
+			Type:        strings.ReplaceAll(kind, "-", "_"),
+			Exceeded:    r <= 0,
+			Utilization: min(max(1-float64(r)/float64(l), 0), 1),
+			ResetsAt:    resetsAt,
+		}
+		if best == nil || rl.Utilization > best.Utilization {
+			best = rl
+		}
+	}
+	return best
+}
@@ -0,0 +1,177 @@
+package errcat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		code, message string
+		want          agentrun.ErrorCategory
+	}{
+		// Claude / Anthropic error types.
+		{"rate_limit_error", "", agentrun.CategoryRateLimited},
+		{"authentication_error", "", agentrun.CategoryAuth},
+		{"permission_error", "", agentrun.CategoryAuth},
+		{"overloaded_error", "", agentrun.CategoryOverloaded},
+		{"invalid_request_error", "max_tokens: must be positive", agentrun.CategoryInvalidRequest},
+		{"invalid_request_error", "prompt is too long: 210000 tokens > 200000 maximum", agentrun.CategoryContextExceeded},
+		{"api_error", "", agentrun.CategoryInternal},
+		{"api_error", "Overloaded", agentrun.CategoryOverloaded},
+		// Codex error variants.
+		{"usageLimitExceeded", "", agentrun.CategoryRateLimited},
+		{"contextWindowExceeded", "", agentrun.CategoryContextExceeded},
+		{"httpConnectionFailed", "", agentrun.CategoryOverloaded},
+		{"internalServerError", "", agentrun.CategoryInternal},
+		{"unauthorized", "", agentrun.CategoryAuth},
+		{"sandboxError", "", agentrun.CategoryToolFailed},
+		// OpenAI codes.
+		{"context_length_exceeded", "", agentrun.CategoryContextExceeded},
+		{"insufficient_quota", "", agentrun.CategoryRateLimited},
+		{"invalid_api_key", "", agentrun.CategoryAuth},
+		// Gemini, Amp, ACP.
+		{"FatalAuthenticationError", "", agentrun.CategoryAuth},
+		{"error_during_execution", "", agentrun.CategoryInternal},
+		{"tool_call_failed", "", agentrun.CategoryToolFailed},
+		// Message fallback.
+		{"", "You exceeded your current quota", agentrun.CategoryRateLimited},
+		{"", "Authentication required", agentrun.CategoryAuth},
+		{"", "The service is temporarily unavailable", agentrun.CategoryOverloaded},
+		{"APIError", "rate limited", agentrun.CategoryRateLimited},
+		{"APIError", "boom", agentrun.CategoryInternal},
+		{"error", "something odd", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.code, tt.message); got != tt.want {
+			t.Errorf("Classify(%q, %q) = %q, want %q", tt.code, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestFromStatus(t *testing.T) {
+	tests := map[int]agentrun.ErrorCategory{
+		200: "",
+		400: agentrun.CategoryInvalidRequest,
+		401: agentrun.CategoryAuth,
+		403: agentrun.CategoryAuth,
+		404: agentrun.CategoryInvalidRequest,
+		429: agentrun.CategoryRateLimited,
+		500: agentrun.CategoryInternal,
+		503: agentrun.CategoryOverloaded,
+		529: agentrun.CategoryOverloaded,
+	}
+	for status, want := range tests {
+		if got := FromStatus(status); got != want {
+			t.Errorf("FromStatus(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"Rate limit reached. Please try again in 1m30.5s.", 90*time.Second + 500*time.Millisecond},
+		{"please try again in 20ms", 20 * time.Millisecond},
+		{"Retry after 30 seconds", 30 * time.Second},
+		{"try again in 2 minutes", 2 * time.Minute},
+		{"retry after 1.5 hours", 90 * time.Minute},
+		{"try again in 250 milliseconds", 250 * time.Millisecond},
+		{"You've hit your usage limit. Try again in 4 days 3 hours, and 20 minutes.", 4*24*time.Hour + 3*time.Hour + 20*time.Minute},
+		{"try again later", 0},
+		{"retry after 0 seconds", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := RetryAfter(tt.text); got != tt.want {
+			t.Errorf("RetryAfter(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"120", 2 * time.Minute},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := RetryAfterHeader(tt.value, now); got != tt.want {
+			t.Errorf("RetryAfterHeader(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	msg := agentrun.Message{Type: agentrun.MessageError, ErrorCode: "rate_limit", Content: "slow down; retry after 10 seconds"}
+	Apply(&msg)
+	if msg.ErrorCategory != agentrun.CategoryRateLimited || msg.RetryAfter != 10*time.Second {
+		t.Errorf("Apply = %q, %v", msg.ErrorCategory, msg.RetryAfter)
+	}
+	if msg.RateLimit == nil || !msg.RateLimit.Exceeded {
+		t.Errorf("Apply RateLimit = %+v, want exceeded", msg.RateLimit)
+	}
+
+	shared := &agentrun.RateLimit{Type: "tokens"}
+	limited := agentrun.Message{Type: agentrun.MessageError, ErrorCategory: agentrun.CategoryRateLimited, RateLimit: shared}
+	Apply(&limited)
+	if shared.Exceeded || limited.RateLimit.Type != "tokens" || !limited.RateLimit.Exceeded {
+		t.Errorf("Apply RateLimit = %+v, shared = %+v", limited.RateLimit, shared)
+	}
+
+	keep := agentrun.Message{Type: agentrun.MessageError, ErrorCode: "rate_limit", ErrorCategory: agentrun.CategoryToolFailed}
+	Apply(&keep)
+	if keep.ErrorCategory != agentrun.CategoryToolFailed {
+		t.Errorf("Apply overwrote category: %q", keep.ErrorCategory)
+	}
+
+	text := agentrun.Message{Type: agentrun.MessageText, Content: "rate limit"}
+	Apply(&text)
+	if text.ErrorCategory != "" {
+		t.Errorf("Apply set category on %s", text.Type)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	anthropic := http.Header{}
+	anthropic.Set("anthropic-ratelimit-requests-limit", "50")
+	anthropic.Set("anthropic-ratelimit-requests-remaining", "40")
+	anthropic.Set("anthropic-ratelimit-requests-reset", "2025-01-01T12:00:10Z")
+	anthropic.Set("anthropic-ratelimit-input-tokens-limit", "1000")
+	anthropic.Set("anthropic-ratelimit-input-tokens-remaining", "0")
+	anthropic.Set("anthropic-ratelimit-input-tokens-reset", "2025-01-01T12:01:00Z")
+	got := RateLimitHeaders(anthropic, now)
+	want := agentrun.RateLimit{Type: "input_tokens", Exceeded: true, Utilization: 1, ResetsAt: now.Add(time.Minute)}
+	if got == nil || *got != want {
+		t.Errorf("anthropic = %+v, want %+v", got, want)
+	}
+
+	openai := http.Header{}
+	openai.Set("x-ratelimit-limit-requests", "100")
+	openai.Set("x-ratelimit-remaining-requests", "25")
+	openai.Set("x-ratelimit-reset-requests", "6m0s")
+	got = RateLimitHeaders(openai, now)
+	want = agentrun.RateLimit{Type: "requests", Utilization: 0.75, ResetsAt: now.Add(6 * time.Minute)}
+	if got == nil || *got != want {
+		t.Errorf("openai = %+v, want %+v", got, want)
+	}
+
+	if got := RateLimitHeaders(http.Header{"Retry-After": {"1"}}, now); got != nil {
+		t.Errorf("no limit headers = %+v, want nil", got)
+	}
+}
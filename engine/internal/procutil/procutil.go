@@ -0,0 +1,39 @@
+// Package procutil provides shared subprocess signaling and exit-status
+// handling for engines that spawn agent processes.
+package procutil
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/dmora/agentrun"
+)
+
+// Signal sends sig to a process, returning nil if the process has
+// already exited (os.ErrProcessDone).
+func Signal(proc *os.Process, sig os.Signal) error {
+	err := proc.Signal(sig)
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// WrapExitError converts a non-zero *exec.ExitError to *agentrun.ExitError.
+// nil → nil, non-ExitError → passthrough, code 0 → nil (clean exit).
+// Preserves the error chain via ExitError.Unwrap.
+func WrapExitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return err
+	}
+	code := ee.ExitCode()
+	if code == 0 {
+		return nil
+	}
+	return &agentrun.ExitError{Code: code, Err: err}
+}
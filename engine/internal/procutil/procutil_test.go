@@ -0,0 +1,44 @@
+//go:build !windows
+
+package procutil
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/dmora/agentrun"
+)
+
+func TestWrapExitError_NonZero(t *testing.T) {
+	err := WrapExitError(exec.Command("sh", "-c", "exit 3").Run())
+	var exitErr *agentrun.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("got %v, want *agentrun.ExitError with code 3", err)
+	}
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		t.Error("chain should still reach *exec.ExitError")
+	}
+}
+
+func TestWrapExitError_Passthrough(t *testing.T) {
+	if err := WrapExitError(nil); err != nil {
+		t.Errorf("nil: got %v", err)
+	}
+	other := errors.New("boom")
+	if err := WrapExitError(other); err != other {
+		t.Errorf("non-exit error: got %v, want it unchanged", err)
+	}
+}
+
+func TestSignal_ExitedProcess(t *testing.T) {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Signal(cmd.Process, os.Kill); err != nil {
+		t.Errorf("got %v, want nil for an exited process", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Package sse provides a minimal text/event-stream reader shared by the
+// HTTP API engines.
+//
+// Only the fields the engines need are interpreted: "event" names the
+// event and "data" lines are joined with "\n" per the SSE specification.
+// Comments, "id" and "retry" fields are ignored.
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Event is one dispatched server-sent event.
+type Event struct {
+	// Name is the "event" field, or empty for the default message event.
+	Name string
+
+	// Data is the event's data, with multi-line data joined by "\n".
+	Data []byte
+}
+
+// Read parses a text/event-stream body and calls fn for each event that
+// carries data. maxSize bounds a single line in bytes. Reading stops at
+// the first error returned by fn, which Read returns. Returns nil at EOF.
+func Read(r io.Reader, maxSize int, fn func(Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64<<10, maxSize)), maxSize)
+	var (
+		name string
+		data []byte
+		seen bool // a data field was read since the last dispatch
+	)
+	dispatch := func() error {
+		ev := Event{Name: name, Data: data}
+		name, data, seen = "", nil, false
+		return fn(ev)
+	}
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if seen {
+				if err := dispatch(); err != nil {
+					return err
+				}
+			}
+			name = ""
+			continue
+		}
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(field) {
+		case "event":
+			name = string(value)
+		case "data":
+			if seen {
+				data = append(data, '\n')
+			}
+			data = append(data, value...)
+			seen = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if seen {
+		return dispatch()
+	}
+	return nil
+}
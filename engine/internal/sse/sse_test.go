@@ -0,0 +1,73 @@
+package sse
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, input string, maxSize int) ([]Event, error) {
+	t.Helper()
+	var events []Event
+	err := Read(strings.NewReader(input), maxSize, func(ev Event) error {
+		events = append(events, ev)
+		return nil
+	})
+	return events, err
+}
+
+func TestRead_Events(t *testing.T) {
+	input := ": keep-alive\n\n" +
+		"data: {\"a\":1}\n\n" +
+		"event: message_start\ndata: {\"b\":2}\n\n" +
+		"data: line1\ndata:line2\nid: 7\n\n" +
+		"data: [DONE]"
+	events, err := readAll(t, input, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{Data: []byte(`{"a":1}`)},
+		{Name: "message_start", Data: []byte(`{"b":2}`)},
+		{Data: []byte("line1\nline2")},
+		{Data: []byte("[DONE]")},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %q", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i].Name != want[i].Name || string(events[i].Data) != string(want[i].Data) {
+			t.Errorf("event %d = {%q %q}, want {%q %q}", i, events[i].Name, events[i].Data, want[i].Name, want[i].Data)
+		}
+	}
+}
+
+func TestRead_EventNameWithoutData(t *testing.T) {
+	events, err := readAll(t, "event: ping\n\ndata: x\n\n", 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Name != "" {
+		t.Errorf("events = %q, want one unnamed event", events)
+	}
+}
+
+func TestRead_CallbackError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := Read(strings.NewReader("data: 1\n\ndata: 2\n\n"), 1024, func(Event) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("err = %v, calls = %d; want stop after 1 call", err, calls)
+	}
+}
+
+func TestRead_MaxSize(t *testing.T) {
+	_, err := readAll(t, "data: "+strings.Repeat("x", 100)+"\n\n", 32)
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("err = %v, want bufio.ErrTooLong", err)
+	}
+}
@@ -0,0 +1,505 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/internal/errcat"
+	"github.com/dmora/agentrun/engine/internal/lineread"
+)
+
+// Standard and well-known JSON-RPC 2.0 error codes.
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeInternalError    = -32603
+	CodeServerError      = -32000 // generic application error from a handler
+	CodeRequestCancelled = -32800 // LSP/ACP: request cancelled via $/cancel_request
+)
+
+// NotificationHandler handles an inbound notification. Runs synchronously in
+// ReadLoop, so inbound ordering is preserved; it must not block for long.
+type NotificationHandler func(params json.RawMessage)
+
+// MethodHandler handles an inbound method call. Runs in a dedicated
+// goroutine; the returned value is marshaled as the result. A non-nil error
+// is sent as an error response — an *Error keeps its code, any other error
+// is sent as CodeServerError.
+type MethodHandler func(params json.RawMessage) (any, error)
+
+// ExtensionHandler handles extension methods: underscore-prefixed method
+// names (e.g. "_zed.dev/workspace") with no handler of their own.
+// For calls it runs like a MethodHandler; for notifications it runs
+// synchronously in ReadLoop and its return values are ignored.
+type ExtensionHandler func(method string, params json.RawMessage) (any, error)
+
+// Conn is a bidirectional JSON-RPC 2.0 multiplexer over newline-delimited JSON.
+//
+// Conn serializes outbound messages (Call, Notify) via a mutex-protected writer
+// and dispatches inbound messages (responses, notifications, method calls) in
+// ReadLoop. All handlers must be registered before ReadLoop starts.
+//
+// The synchronization model uses sync.Mutex + map[int64]pendingCall for pending
+// calls. On ReadLoop exit, all pending calls are released with an error —
+// preventing goroutine leaks.
+type Conn struct {
+	mu sync.Mutex // guards w and pending
+	w  io.Writer
+
+	nextID  atomic.Int64
+	pending map[int64]pendingCall
+
+	calls     atomic.Uint64
+	abandoned atomic.Uint64
+
+	notifyHandlers map[string]NotificationHandler
+	methodHandlers map[string]MethodHandler
+	extHandler     ExtensionHandler
+
+	opts options
+	lr   *lineread.Reader
+
+	done    chan struct{}
+	readErr atomic.Value // stores error (nil = no error)
+}
+
+// pendingCall is an in-flight Call awaiting its response.
+type pendingCall struct {
+	ch         chan *response
+	method     string
+	started    time.Time
+	onResponse func()
+}
+
+// NewConn creates a JSON-RPC 2.0 connection reading from r and writing to w.
+// Register handlers, then call ReadLoop in a goroutine to start processing
+// inbound messages.
+func NewConn(r io.Reader, w io.Writer, opts ...Option) *Conn {
+	o := resolveOptions(opts...)
+	c := &Conn{
+		w:              w,
+		pending:        make(map[int64]pendingCall),
+		notifyHandlers: make(map[string]NotificationHandler),
+		methodHandlers: make(map[string]MethodHandler),
+		opts:           o,
+		done:           make(chan struct{}),
+	}
+	initBuf := 4096
+	if o.maxMessageSize > 0 && o.maxMessageSize < initBuf {
+		initBuf = o.maxMessageSize
+	}
+	c.lr = lineread.NewReader(r, initBuf, o.maxMessageSize)
+	return c
+}
+
+// OnNotification registers a handler for notifications (no id field).
+// Must be called before ReadLoop starts.
+func (c *Conn) OnNotification(method string, h NotificationHandler) {
+	c.notifyHandlers[method] = h
+}
+
+// OnMethod registers a handler for peer-initiated method calls (has id field,
+// expects response). Must be called before ReadLoop starts.
+func (c *Conn) OnMethod(method string, h MethodHandler) {
+	c.methodHandlers[method] = h
+}
+
+// OnExtension registers a catch-all handler for underscore-prefixed methods
+// without a handler of their own. Without it, extension calls are answered
+// with CodeMethodNotFound and extension notifications are ignored.
+// Must be called before ReadLoop starts.
+func (c *Conn) OnExtension(h ExtensionHandler) {
+	c.extHandler = h
+}
+
+// Call sends a request and blocks until the response arrives, ctx expires,
+// or the per-call timeout (WithCallTimeout) elapses. An abandoned call is
+// reported to the peer via the cancel notification (WithCancelMethod).
+// result, when non-nil, receives the unmarshaled result.
+func (c *Conn) Call(ctx context.Context, method string, params, result any, opts ...CallOption) error {
+	var co callOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&co)
+		}
+	}
+	if c.opts.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.callTimeout)
+		defer cancel()
+	}
+
+	id := c.nextID.Add(1)
+	ch := make(chan *response, 1)
+	c.mu.Lock()
+	c.pending[id] = pendingCall{ch: ch, method: method, started: time.Now(), onResponse: co.onResponse}
+	c.mu.Unlock()
+	c.calls.Add(1)
+
+	if err := c.send(&request{JSONRPC: c.version(), ID: &id, Method: method, Params: params}); err != nil {
+		c.forget(id)
+		return fmt.Errorf("jsonrpc: send %s: %w", method, err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		return handleCallResponse(resp, ok, method, result)
+	case <-ctx.Done():
+		if !c.forget(id) {
+			// Response arrived just before ctx cancellation — use it
+			// rather than discarding a successful result.
+			resp, ok := <-ch
+			return handleCallResponse(resp, ok, method, result)
+		}
+		c.abandoned.Add(1)
+		c.cancelRemote(id)
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification (no id, no response expected).
+func (c *Conn) Notify(method string, params any) error {
+	return c.send(&request{JSONRPC: c.version(), Method: method, Params: params})
+}
+
+// ReadLoop reads and dispatches inbound messages until the reader closes or
+// an unrecoverable error occurs. On exit, all pending calls are released with
+// an error. Must be called exactly once.
+func (c *Conn) ReadLoop() {
+	defer close(c.done)
+	defer c.drainPending()
+
+	for {
+		line, err := c.lr.ReadLine()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.readErr.Store(err)
+			}
+			return
+		}
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		c.trace(Inbound, line)
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			if c.opts.onParseError != nil {
+				c.opts.onParseError(append([]byte(nil), line...), err)
+			}
+			continue
+		}
+		c.dispatch(&msg)
+	}
+}
+
+// Err returns the ReadLoop error after it exits. Returns nil if ReadLoop
+// hasn't finished or exited cleanly (reader closed with no read error).
+func (c *Conn) Err() error {
+	if v := c.readErr.Load(); v != nil {
+		return v.(error)
+	}
+	return nil
+}
+
+// Done returns a channel that is closed when ReadLoop exits.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stats is a point-in-time snapshot of a connection's outbound calls.
+type Stats struct {
+	// Pending is the number of calls awaiting a response.
+	Pending int
+	// PendingByMethod breaks Pending down by method name.
+	PendingByMethod map[string]int
+	// OldestPending is the age of the longest-waiting call; zero when idle.
+	OldestPending time.Duration
+	// Calls is the total number of calls sent.
+	Calls uint64
+	// Abandoned counts calls given up on (context cancelled or timed out)
+	// before a response arrived.
+	Abandoned uint64
+}
+
+// Stats returns a snapshot of pending-call metrics.
+func (c *Conn) Stats() Stats {
+	now := time.Now()
+	c.mu.Lock()
+	s := Stats{
+		Pending:         len(c.pending),
+		PendingByMethod: make(map[string]int, len(c.pending)),
+	}
+	for _, pc := range c.pending {
+		s.PendingByMethod[pc.method]++
+		if age := now.Sub(pc.started); age > s.OldestPending {
+			s.OldestPending = age
+		}
+	}
+	c.mu.Unlock()
+	s.Calls = c.calls.Load()
+	s.Abandoned = c.abandoned.Load()
+	return s
+}
+
+// --- Internal ---
+
+// send serializes and writes one message. Thread-safe.
+func (c *Conn) send(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trace(Outbound, data)
+	_, err = c.w.Write(append(data, '\n'))
+	return err
+}
+
+// version returns the "jsonrpc" member for outbound messages.
+func (c *Conn) version() string {
+	if c.opts.omitVersion {
+		return ""
+	}
+	return "2.0"
+}
+
+// trace reports a frame to the trace callback, redacted when configured.
+func (c *Conn) trace(dir Direction, frame []byte) {
+	if c.opts.trace == nil {
+		return
+	}
+	if c.opts.redact != nil {
+		frame = c.opts.redact(frame)
+	}
+	c.opts.trace(dir, frame)
+}
+
+// forget removes a pending call. Returns false if the response already
+// claimed it.
+func (c *Conn) forget(id int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[id]; !ok {
+		return false
+	}
+	delete(c.pending, id)
+	return true
+}
+
+// cancelRemote tells the peer to stop working on an abandoned call.
+// Best-effort: the connection may already be closing.
+func (c *Conn) cancelRemote(id int64) {
+	if c.opts.cancelMethod == "" {
+		return
+	}
+	_ = c.Notify(c.opts.cancelMethod, map[string]int64{"requestId": id})
+}
+
+// dispatch routes an inbound message to the appropriate handler.
+func (c *Conn) dispatch(msg *message) {
+	switch {
+	case msg.ID != nil && msg.Method == "":
+		c.handleResponse(msg) // response: id + result or error
+	case msg.ID != nil:
+		c.handleMethodCall(msg) // peer call: id + method
+	case msg.Method != "":
+		c.handleNotification(msg) // notification: method, no id
+	}
+}
+
+// handleResponse delivers a response to the waiting Call goroutine.
+func (c *Conn) handleResponse(msg *message) {
+	c.mu.Lock()
+	pc, ok := c.pending[*msg.ID]
+	if ok {
+		delete(c.pending, *msg.ID)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return // duplicate, unsolicited, or abandoned — drop
+	}
+	if pc.onResponse != nil {
+		pc.onResponse()
+	}
+	pc.ch <- &response{Result: msg.Result, Error: msg.Error}
+}
+
+// handleMethodCall dispatches a peer call to its handler in a dedicated
+// goroutine and sends the response back.
+func (c *Conn) handleMethodCall(msg *message) {
+	h := c.methodHandler(msg.Method)
+	if h == nil {
+		c.sendError(*msg.ID, CodeMethodNotFound, "method not found: "+msg.Method)
+		return
+	}
+
+	// Run handler in a dedicated goroutine to avoid blocking ReadLoop.
+	id := *msg.ID
+	params := msg.Params
+	go func() {
+		result, err := h(params)
+		if err != nil {
+			var rpcErr *Error
+			if errors.As(err, &rpcErr) {
+				c.sendError(id, rpcErr.Code, rpcErr.Message)
+				return
+			}
+			c.sendError(id, CodeServerError, err.Error())
+			return
+		}
+		c.sendResult(id, result)
+	}()
+}
+
+// methodHandler resolves the handler for a peer call, falling back to the
+// extension handler for underscore-prefixed methods.
+func (c *Conn) methodHandler(method string) MethodHandler {
+	if h, ok := c.methodHandlers[method]; ok {
+		return h
+	}
+	if c.extHandler != nil && isExtension(method) {
+		ext := c.extHandler
+		return func(params json.RawMessage) (any, error) { return ext(method, params) }
+	}
+	return nil
+}
+
+// handleNotification dispatches a notification to its handler.
+// Unknown notifications are silently ignored.
+func (c *Conn) handleNotification(msg *message) {
+	if h, ok := c.notifyHandlers[msg.Method]; ok {
+		h(msg.Params)
+		return
+	}
+	if c.extHandler != nil && isExtension(msg.Method) {
+		_, _ = c.extHandler(msg.Method, msg.Params)
+	}
+}
+
+// isExtension reports whether method is an extension method name.
+func isExtension(method string) bool {
+	return strings.HasPrefix(method, "_")
+}
+
+// sendResult sends a success response.
+// Send errors are intentionally ignored: these run in handler goroutines
+// during ReadLoop, and the connection may already be closing. The peer
+// will time out if it never receives a response.
+func (c *Conn) sendResult(id int64, result any) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		c.sendError(id, CodeInternalError, "marshal result: "+err.Error())
+		return
+	}
+	_ = c.send(&response{JSONRPC: c.version(), ID: &id, Result: data}) // best-effort
+}
+
+// sendError sends an error response.
+// Send errors are intentionally ignored (same rationale as sendResult).
+func (c *Conn) sendError(id int64, code int, message string) {
+	_ = c.send(&response{JSONRPC: c.version(), ID: &id, Error: &wireError{Code: code, Message: message}}) // best-effort
+}
+
+// drainPending closes all pending call channels so blocked callers unblock.
+func (c *Conn) drainPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, pc := range c.pending {
+		close(pc.ch)
+		delete(c.pending, id)
+	}
+}
+
+// handleCallResponse processes a response received from a pending call channel.
+func handleCallResponse(resp *response, ok bool, method string, result any) error {
+	if !ok {
+		return fmt.Errorf("jsonrpc: %s: connection closed", method)
+	}
+	if resp.Error != nil {
+		return &Error{Code: resp.Error.Code, Message: resp.Error.Message}
+	}
+	if result != nil && resp.Result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("jsonrpc: unmarshal %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// --- Wire types ---
+
+// request is an outbound request or notification.
+type request struct {
+	JSONRPC string `json:"jsonrpc,omitempty"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// message is a generic inbound message (request, response, or notification).
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *wireError      `json:"error,omitempty"`
+}
+
+// response is an outbound response.
+type response struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      *int64          `json:"id,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *wireError      `json:"error,omitempty"`
+}
+
+// wireError is a JSON-RPC 2.0 error object.
+type wireError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a JSON-RPC error returned by Call when the peer answers with an
+// error response. Method handlers may also return an *Error to control the
+// code sent to the peer.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// ErrorCategory classifies the error by its message (agents report rate
+// limits and auth failures as server errors), then by its code. Protocol
+// errors are invalid requests; a cancelled request has no category.
+func (e *Error) ErrorCategory() agentrun.ErrorCategory {
+	if cat := errcat.Classify("", e.Message); cat != "" {
+		return cat
+	}
+	switch {
+	case e.Code == CodeRequestCancelled:
+		return ""
+	case e.Code == CodeParseError, e.Code == CodeInvalidRequest,
+		e.Code == CodeMethodNotFound, e.Code == CodeInvalidParams:
+		return agentrun.CategoryInvalidRequest
+	case e.Code == CodeInternalError, e.Code <= CodeServerError && e.Code >= -32099:
+		return agentrun.CategoryInternal
+	}
+	return ""
+}
@@ -1,4 +1,4 @@
-package acp
+package jsonrpc
 
 import (
 	"context"
@@ -10,6 +10,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/dmora/agentrun"
 )
 
 const testTimeout = 5 * time.Second
@@ -17,7 +19,7 @@ const testTimeout = 5 * time.Second
 // testPeer simulates the remote side of a JSON-RPC connection.
 // It reads requests from the Conn's writer and sends raw bytes to the Conn's reader.
 type testPeer struct {
-	reqCh  chan rpcMessage    // requests/notifications read from Conn output
+	reqCh  chan message       // requests/notifications read from Conn output
 	sendFn func([]byte) error // write raw bytes to Conn's read pipe
 	close  func()             // close the write end of the read pipe
 	dec    *json.Decoder      // reads from Conn's write pipe
@@ -26,7 +28,7 @@ type testPeer struct {
 
 // newTestConn creates a Conn wired to a testPeer via io.Pipe.
 // The peer's readLoop goroutine is started automatically.
-func newTestConn(t *testing.T) (*Conn, *testPeer) {
+func newTestConn(t *testing.T, opts ...Option) (*Conn, *testPeer) {
 	t.Helper()
 
 	// Conn reads from pr1, peer writes to pw1.
@@ -34,10 +36,10 @@ func newTestConn(t *testing.T) (*Conn, *testPeer) {
 	// Conn writes to pw2, peer reads from pr2.
 	pr2, pw2 := io.Pipe()
 
-	conn := newConn(pr1, pw2, connConfig{})
+	conn := NewConn(pr1, pw2, opts...)
 
 	peer := &testPeer{
-		reqCh: make(chan rpcMessage, 10),
+		reqCh: make(chan message, 10),
 		sendFn: func(b []byte) error {
 			_, err := pw1.Write(b)
 			return err
@@ -51,7 +53,7 @@ func newTestConn(t *testing.T) (*Conn, *testPeer) {
 	go func() {
 		defer close(peer.done)
 		for {
-			var msg rpcMessage
+			var msg message
 			if err := peer.dec.Decode(&msg); err != nil {
 				return
 			}
@@ -83,14 +85,14 @@ func (p *testPeer) sendJSON(t *testing.T, v any) {
 }
 
 // readRequest reads the next request from the peer's channel with a timeout.
-func (p *testPeer) readRequest(t *testing.T) rpcMessage {
+func (p *testPeer) readRequest(t *testing.T) message {
 	t.Helper()
 	select {
 	case msg := <-p.reqCh:
 		return msg
 	case <-time.After(testTimeout):
 		t.Fatal("timeout waiting for request from Conn")
-		return rpcMessage{}
+		return message{}
 	}
 }
 
@@ -101,7 +103,7 @@ func (p *testPeer) respond(t *testing.T, id int64, result any) {
 	if err != nil {
 		t.Fatalf("marshal result: %v", err)
 	}
-	resp := rpcResponse{
+	resp := response{
 		JSONRPC: "2.0",
 		ID:      &id,
 		Result:  data,
@@ -112,10 +114,10 @@ func (p *testPeer) respond(t *testing.T, id int64, result any) {
 // respondError sends a JSON-RPC error response.
 func (p *testPeer) respondError(t *testing.T, id int64, code int, message string) {
 	t.Helper()
-	resp := rpcResponse{
+	resp := response{
 		JSONRPC: "2.0",
 		ID:      &id,
-		Error: &rpcError{
+		Error: &wireError{
 			Code:    code,
 			Message: message,
 		},
@@ -181,7 +183,7 @@ func TestConn_Call_Error(t *testing.T) {
 
 	rpcErr, ok := asRPCError(err)
 	if !ok {
-		t.Fatalf("error type = %T, want *RPCError", err)
+		t.Fatalf("error type = %T, want *Error", err)
 	}
 	if rpcErr.Code != -32600 {
 		t.Errorf("code = %d, want %d", rpcErr.Code, -32600)
@@ -191,6 +193,27 @@ func TestConn_Call_Error(t *testing.T) {
 	}
 }
 
+func TestError_ErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  Error
+		want agentrun.ErrorCategory
+	}{
+		{Error{Code: CodeInvalidParams, Message: "missing sessionId"}, agentrun.CategoryInvalidRequest},
+		{Error{Code: CodeMethodNotFound, Message: "unknown method"}, agentrun.CategoryInvalidRequest},
+		{Error{Code: CodeInternalError, Message: "panic"}, agentrun.CategoryInternal},
+		{Error{Code: -32042, Message: "boom"}, agentrun.CategoryInternal},
+		{Error{Code: CodeServerError, Message: "Authentication required"}, agentrun.CategoryAuth},
+		{Error{Code: CodeInternalError, Message: "rate limit exceeded"}, agentrun.CategoryRateLimited},
+		{Error{Code: CodeRequestCancelled, Message: "cancelled"}, ""},
+		{Error{Code: 7, Message: "custom"}, ""},
+	}
+	for _, tt := range tests {
+		if got := agentrun.ErrorCategoryOf(fmt.Errorf("wrapped: %w", &tt.err)); got != tt.want {
+			t.Errorf("ErrorCategoryOf(%v) = %q, want %q", &tt.err, got, tt.want)
+		}
+	}
+}
+
 func TestConn_Call_Timeout(t *testing.T) {
 	conn, _ := newTestConn(t)
 	go conn.ReadLoop()
@@ -291,7 +314,7 @@ func TestConn_MethodCall_AutoRespond(t *testing.T) {
 
 	// Send a method call (has id + method).
 	id := int64(42)
-	methodCall := rpcMessage{
+	methodCall := message{
 		JSONRPC: "2.0",
 		ID:      &id,
 		Method:  "test/method",
@@ -327,7 +350,7 @@ func TestConn_MethodCall_ErrorResponse(t *testing.T) {
 	go conn.ReadLoop()
 
 	id := int64(7)
-	peer.sendJSON(t, rpcMessage{
+	peer.sendJSON(t, message{
 		JSONRPC: "2.0",
 		ID:      &id,
 		Method:  "test/method",
@@ -348,7 +371,7 @@ func TestConn_MethodCall_NotFound(t *testing.T) {
 	go conn.ReadLoop()
 
 	id := int64(99)
-	peer.sendJSON(t, rpcMessage{
+	peer.sendJSON(t, message{
 		JSONRPC: "2.0",
 		ID:      &id,
 		Method:  "unknown/method",
@@ -437,7 +460,7 @@ func TestConn_ResponseNotificationInterleave(t *testing.T) {
 	go func() { errCh2 <- conn.Call(ctx, "q2", nil, &res2) }()
 
 	// Read both requests — arrival order is non-deterministic.
-	rawReqs := [2]rpcMessage{peer.readRequest(t), peer.readRequest(t)}
+	rawReqs := [2]message{peer.readRequest(t), peer.readRequest(t)}
 
 	// Map method→ID for deterministic response targeting.
 	idByMethod := make(map[string]int64, 2)
@@ -479,6 +502,54 @@ func TestConn_ResponseNotificationInterleave(t *testing.T) {
 	}
 }
 
+func TestConn_Call_OnResponseRunsBeforeLaterNotifications(t *testing.T) {
+	conn, peer := newTestConn(t)
+
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	notified := make(chan struct{}, 2)
+	conn.OnNotification("update", func(params json.RawMessage) {
+		var p struct{ Value string }
+		_ = json.Unmarshal(params, &p)
+		record(p.Value)
+		notified <- struct{}{}
+	})
+	go conn.ReadLoop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- conn.Call(ctx, "load", nil, nil, OnResponse(func() { record("response") })) }()
+
+	req := peer.readRequest(t)
+	peer.sendJSON(t, map[string]any{"jsonrpc": "2.0", "method": "update", "params": map[string]string{"value": "before"}})
+	peer.respond(t, *req.ID, nil)
+	peer.sendJSON(t, map[string]any{"jsonrpc": "2.0", "method": "update", "params": map[string]string{"value": "after"}})
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	for range 2 {
+		select {
+		case <-notified:
+		case <-time.After(testTimeout):
+			t.Fatal("timeout waiting for notification")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(events, ","); got != "before,response,after" {
+		t.Errorf("events = %s, want before,response,after", got)
+	}
+}
+
 func TestConn_DuplicateResponseID(t *testing.T) {
 	conn, peer := newTestConn(t)
 	go conn.ReadLoop()
@@ -636,7 +707,7 @@ func TestConn_Call_SendFailure(t *testing.T) {
 	pr, pw := io.Pipe()
 	pw.Close() // broken pipe — writes will fail
 
-	conn := newConn(pr, pw, connConfig{})
+	conn := NewConn(pr, pw)
 	go conn.ReadLoop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
@@ -673,7 +744,7 @@ func FuzzConn_DecodeMessage(f *testing.F) {
 		r := strings.NewReader(string(data) + "\n")
 		w := io.Discard
 
-		conn := newConn(r, w, connConfig{})
+		conn := NewConn(r, w)
 		conn.OnNotification("test", func(_ json.RawMessage) {})
 
 		done := make(chan struct{})
@@ -693,7 +764,7 @@ func FuzzConn_DecodeMessage(f *testing.F) {
 func TestConn_LargeMessage(t *testing.T) {
 	// Message larger than internal buffer (4096 default) but within maxMessageSize.
 	pr, pw := io.Pipe()
-	conn := newConn(pr, io.Discard, connConfig{maxMessageSize: 1 << 20})
+	conn := NewConn(pr, io.Discard, WithMaxMessageSize(1<<20))
 
 	received := make(chan json.RawMessage, 1)
 	conn.OnNotification("big", func(params json.RawMessage) {
@@ -729,7 +800,7 @@ func TestConn_LargeMessage(t *testing.T) {
 func TestConn_MaxMessageSizeExceeded(t *testing.T) {
 	pr, pw := io.Pipe()
 	// Set a small maxMessageSize — message will exceed it.
-	conn := newConn(pr, io.Discard, connConfig{maxMessageSize: 100})
+	conn := NewConn(pr, io.Discard, WithMaxMessageSize(100))
 	go conn.ReadLoop()
 
 	// Send a message larger than 100 bytes.
@@ -753,7 +824,7 @@ func TestConn_MaxMessageSizeExceeded(t *testing.T) {
 func TestConn_MaxMessageSizeZero_Unlimited(t *testing.T) {
 	pr, pw := io.Pipe()
 	// maxMessageSize=0 → unlimited.
-	conn := newConn(pr, io.Discard, connConfig{maxMessageSize: 0})
+	conn := NewConn(pr, io.Discard, WithMaxMessageSize(0))
 
 	received := make(chan json.RawMessage, 1)
 	conn.OnNotification("big", func(params json.RawMessage) {
@@ -789,11 +860,250 @@ func TestConn_MaxMessageSizeZero_Unlimited(t *testing.T) {
 	pr.Close()
 }
 
-// asRPCError extracts an *RPCError from err.
-func asRPCError(err error) (*RPCError, bool) {
-	var rpcErr *RPCError
+// asRPCError extracts an *Error from err.
+func asRPCError(err error) (*Error, bool) {
+	var rpcErr *Error
 	if errors.As(err, &rpcErr) {
 		return rpcErr, true
 	}
 	return nil, false
 }
+
+// --- Cancellation, timeouts, extensions, tracing, stats ---
+
+func TestConn_Call_CancelNotifiesPeer(t *testing.T) {
+	conn, peer := newTestConn(t)
+	go conn.ReadLoop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- conn.Call(ctx, "slow", nil, nil) }()
+
+	req := peer.readRequest(t)
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Call error = %v, want context.Canceled", err)
+	}
+
+	note := peer.readRequest(t)
+	if note.Method != DefaultCancelMethod || note.ID != nil {
+		t.Fatalf("got %+v, want %s notification", note, DefaultCancelMethod)
+	}
+	var params struct {
+		RequestID int64 `json:"requestId"`
+	}
+	if err := json.Unmarshal(note.Params, &params); err != nil {
+		t.Fatalf("unmarshal cancel params: %v", err)
+	}
+	if params.RequestID != *req.ID {
+		t.Errorf("requestId = %d, want %d", params.RequestID, *req.ID)
+	}
+
+	// A late response for the abandoned call is dropped.
+	peer.respond(t, *req.ID, map[string]string{"late": "yes"})
+	if s := conn.Stats(); s.Pending != 0 || s.Abandoned != 1 || s.Calls != 1 {
+		t.Errorf("stats = %+v, want 0 pending, 1 abandoned, 1 call", s)
+	}
+}
+
+func TestConn_Call_CancelMethodDisabled(t *testing.T) {
+	conn, peer := newTestConn(t, WithCancelMethod(""))
+	go conn.ReadLoop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- conn.Call(ctx, "slow", nil, nil) }()
+	peer.readRequest(t)
+	cancel()
+	<-errCh
+
+	if err := conn.Notify("marker", nil); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if next := peer.readRequest(t); next.Method != "marker" {
+		t.Errorf("next frame = %q, want marker (no cancel notification)", next.Method)
+	}
+}
+
+func TestConn_WithCallTimeout(t *testing.T) {
+	conn, peer := newTestConn(t, WithCallTimeout(50*time.Millisecond))
+	go conn.ReadLoop()
+
+	err := conn.Call(context.Background(), "slow", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+	peer.readRequest(t) // the call
+	if note := peer.readRequest(t); note.Method != DefaultCancelMethod {
+		t.Errorf("method = %q, want %q", note.Method, DefaultCancelMethod)
+	}
+}
+
+func TestConn_Stats_Pending(t *testing.T) {
+	conn, peer := newTestConn(t)
+	go conn.ReadLoop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- conn.Call(ctx, "a", nil, nil) }()
+	go func() { errCh <- conn.Call(ctx, "b", nil, nil) }()
+	r1, r2 := peer.readRequest(t), peer.readRequest(t)
+
+	s := conn.Stats()
+	if s.Pending != 2 || s.PendingByMethod["a"] != 1 || s.PendingByMethod["b"] != 1 {
+		t.Errorf("stats = %+v, want a and b pending", s)
+	}
+	if s.OldestPending <= 0 {
+		t.Errorf("OldestPending = %v, want > 0", s.OldestPending)
+	}
+
+	peer.respond(t, *r1.ID, nil)
+	peer.respond(t, *r2.ID, nil)
+	for range 2 {
+		if err := <-errCh; err != nil {
+			t.Fatalf("call: %v", err)
+		}
+	}
+	if s := conn.Stats(); s.Pending != 0 || s.OldestPending != 0 || s.Calls != 2 {
+		t.Errorf("stats after responses = %+v", s)
+	}
+}
+
+func TestConn_MethodCall_ErrorCodePreserved(t *testing.T) {
+	conn, peer := newTestConn(t)
+	conn.OnMethod("test/method", func(_ json.RawMessage) (any, error) {
+		return nil, fmt.Errorf("wrapped: %w", &Error{Code: CodeInvalidParams, Message: "bad"})
+	})
+	go conn.ReadLoop()
+
+	id := int64(3)
+	peer.sendJSON(t, message{JSONRPC: "2.0", ID: &id, Method: "test/method"})
+	resp := peer.readRequest(t)
+	if resp.Error == nil || resp.Error.Code != CodeInvalidParams || resp.Error.Message != "bad" {
+		t.Errorf("error = %+v, want code %d", resp.Error, CodeInvalidParams)
+	}
+}
+
+func TestConn_Extension(t *testing.T) {
+	conn, peer := newTestConn(t)
+
+	notes := make(chan string, 1)
+	conn.OnExtension(func(method string, params json.RawMessage) (any, error) {
+		if method == "_vendor/ping" {
+			return map[string]string{"echo": string(params)}, nil
+		}
+		notes <- method
+		return nil, nil
+	})
+	go conn.ReadLoop()
+
+	id := int64(5)
+	peer.sendJSON(t, message{JSONRPC: "2.0", ID: &id, Method: "_vendor/ping", Params: json.RawMessage(`1`)})
+	resp := peer.readRequest(t)
+	if resp.Error != nil || string(resp.Result) != `{"echo":"1"}` {
+		t.Errorf("response = %+v (result %s)", resp, resp.Result)
+	}
+
+	peer.sendJSON(t, map[string]any{"jsonrpc": "2.0", "method": "_vendor/event"})
+	select {
+	case m := <-notes:
+		if m != "_vendor/event" {
+			t.Errorf("notification method = %q", m)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("extension notification not delivered")
+	}
+
+	// Non-extension unknown methods are still rejected.
+	id2 := int64(6)
+	peer.sendJSON(t, message{JSONRPC: "2.0", ID: &id2, Method: "vendor/ping"})
+	if resp := peer.readRequest(t); resp.Error == nil || resp.Error.Code != CodeMethodNotFound {
+		t.Errorf("response = %+v, want method not found", resp)
+	}
+}
+
+func TestConn_Trace_Redacted(t *testing.T) {
+	var mu sync.Mutex
+	var frames []string
+	conn, peer := newTestConn(t,
+		WithTrace(func(dir Direction, frame []byte) {
+			mu.Lock()
+			frames = append(frames, dir.String()+" "+string(frame))
+			mu.Unlock()
+		}),
+		WithRedactor(RedactFields("token")),
+	)
+	go conn.ReadLoop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- conn.Call(ctx, "auth", map[string]string{"token": "secret"}, nil) }()
+	req := peer.readRequest(t)
+
+	// Inspect the wire: redaction must not touch real traffic.
+	var params map[string]string
+	_ = json.Unmarshal(mustMarshal(t, req.Params), &params)
+	if params["token"] != "secret" {
+		t.Errorf("wire token = %q, want unredacted", params["token"])
+	}
+
+	peer.respond(t, *req.ID, map[string]string{"token": "issued"})
+	if err := <-errCh; err != nil {
+		t.Fatalf("call: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(frames) != 2 {
+		t.Fatalf("traced %d frames, want 2: %v", len(frames), frames)
+	}
+	if !strings.HasPrefix(frames[0], "out ") || !strings.HasPrefix(frames[1], "in ") {
+		t.Errorf("directions = %v", frames)
+	}
+	for _, f := range frames {
+		if strings.Contains(f, "secret") || strings.Contains(f, "issued") {
+			t.Errorf("frame not redacted: %s", f)
+		}
+		if !strings.Contains(f, RedactedValue) {
+			t.Errorf("frame missing redaction marker: %s", f)
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return data
+}
+
+func TestConn_WithoutVersion(t *testing.T) {
+	pr, pw := io.Pipe()
+	var buf strings.Builder
+	var mu sync.Mutex
+	conn := NewConn(pr, writerFunc(func(b []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(b)
+	}), WithoutVersion())
+	t.Cleanup(func() { pw.Close() })
+
+	if err := conn.Notify("initialized", nil); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.TrimSpace(buf.String()); got != `{"method":"initialized"}` {
+		t.Errorf("wire = %s, want no jsonrpc member", got)
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
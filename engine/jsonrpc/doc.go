@@ -0,0 +1,19 @@
+// Package jsonrpc provides a bidirectional JSON-RPC 2.0 connection over
+// newline-delimited JSON, as spoken by subprocess agent protocols such as
+// ACP (Agent Client Protocol).
+//
+// A Conn multiplexes outbound calls and notifications with inbound
+// responses, notifications and peer-initiated method calls:
+//
+//	conn := jsonrpc.NewConn(stdout, stdin, jsonrpc.WithTrace(logFrame))
+//	conn.OnNotification("session/update", handleUpdate)
+//	conn.OnMethod("session/request_permission", handlePermission)
+//	go conn.ReadLoop()
+//	err := conn.Call(ctx, "initialize", params, &result)
+//
+// Beyond the core protocol, Conn adds what long-lived agent connections
+// need in practice: peer-side cancellation of abandoned calls
+// ($/cancel_request), per-call timeouts, a wire-trace hook with redaction,
+// a catch-all handler for underscore-prefixed extension methods, and
+// pending-call metrics via Stats.
+package jsonrpc
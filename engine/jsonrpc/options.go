@@ -0,0 +1,114 @@
+package jsonrpc
+
+import "time"
+
+// DefaultCancelMethod is the notification sent to the peer when a Call is
+// abandoned (context cancelled or timed out) before its response arrives.
+// Params are {"requestId": <id>}, following the LSP/ACP convention.
+const DefaultCancelMethod = "$/cancel_request"
+
+// options holds resolved construction-time configuration for a Conn.
+type options struct {
+	maxMessageSize int
+	onParseError   func(line []byte, err error)
+	trace          TraceFunc
+	redact         Redactor
+	cancelMethod   string
+	callTimeout    time.Duration
+	omitVersion    bool
+}
+
+// Option configures a Conn at construction time.
+type Option func(*options)
+
+// WithMaxMessageSize sets the maximum inbound message size in bytes.
+// Zero or negative means unlimited.
+func WithMaxMessageSize(size int) Option {
+	return func(o *options) {
+		o.maxMessageSize = size
+	}
+}
+
+// WithParseErrorHandler sets a callback for inbound lines that look like JSON
+// objects but fail to decode. The line is a copy owned by the callback.
+// Runs synchronously in ReadLoop.
+func WithParseErrorHandler(fn func(line []byte, err error)) Option {
+	return func(o *options) {
+		o.onParseError = fn
+	}
+}
+
+// WithTrace sets a callback invoked with every frame read from or written to
+// the wire, after redaction (see WithRedactor).
+func WithTrace(fn TraceFunc) Option {
+	return func(o *options) {
+		o.trace = fn
+	}
+}
+
+// WithRedactor sets the function applied to frames before they reach the
+// trace callback. Has no effect without WithTrace. The wire itself is never
+// modified.
+func WithRedactor(r Redactor) Option {
+	return func(o *options) {
+		o.redact = r
+	}
+}
+
+// WithCancelMethod sets the notification sent to the peer when a Call is
+// abandoned. The default is DefaultCancelMethod; an empty method disables
+// peer-side cancellation.
+func WithCancelMethod(method string) Option {
+	return func(o *options) {
+		o.cancelMethod = method
+	}
+}
+
+// WithCallTimeout bounds every Call by d, in addition to its context.
+// Values <= 0 are ignored (no per-call timeout, the default).
+func WithCallTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.callTimeout = d
+		}
+	}
+}
+
+// WithoutVersion omits the "jsonrpc":"2.0" member from outbound messages,
+// for peers that speak the header-less JSON-RPC variant (e.g. the Codex
+// app-server). Inbound messages are accepted with or without it.
+func WithoutVersion() Option {
+	return func(o *options) {
+		o.omitVersion = true
+	}
+}
+
+func resolveOptions(opts ...Option) options {
+	o := options{cancelMethod: DefaultCancelMethod}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// callOptions holds per-call configuration.
+type callOptions struct {
+	onResponse func()
+}
+
+// CallOption configures a single Call.
+type CallOption func(*callOptions)
+
+// OnResponse sets a hook that runs on the ReadLoop goroutine when the call's
+// response arrives, before any later inbound message is dispatched. Use it to
+// switch notification handling at exactly the response boundary (e.g., to
+// stop treating updates as history replay once a load call returns).
+// The hook does not run if the call is abandoned or the connection closes.
+// It must not block.
+func OnResponse(fn func()) CallOption {
+	return func(o *callOptions) {
+		o.onResponse = fn
+	}
+}
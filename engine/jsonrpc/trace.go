@@ -0,0 +1,79 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Direction identifies which way a traced frame travelled.
+type Direction int
+
+const (
+	// Inbound frames were read from the peer.
+	Inbound Direction = iota
+	// Outbound frames were written to the peer.
+	Outbound
+)
+
+// String returns "in" or "out".
+func (d Direction) String() string {
+	if d == Outbound {
+		return "out"
+	}
+	return "in"
+}
+
+// TraceFunc receives every wire frame (one JSON message, without the
+// trailing newline). Runs synchronously on the reading or writing goroutine
+// while the connection's write lock may be held: it must not block and must
+// not call back into the Conn. frame is only valid for the duration of the
+// call.
+type TraceFunc func(dir Direction, frame []byte)
+
+// Redactor rewrites a frame before it is traced, e.g. to mask credentials
+// or prompt content. It must not modify frame in place.
+type Redactor func(frame []byte) []byte
+
+// RedactedValue replaces masked values in frames rewritten by RedactFields.
+const RedactedValue = "[REDACTED]"
+
+// RedactFields returns a Redactor that replaces the value of every object
+// member whose key matches one of fields (case-insensitive), at any depth,
+// with RedactedValue. Frames that are not valid JSON are replaced entirely,
+// so redaction fails closed.
+func RedactFields(fields ...string) Redactor {
+	keys := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keys[strings.ToLower(f)] = true
+	}
+	return func(frame []byte) []byte {
+		var v any
+		if err := json.Unmarshal(frame, &v); err != nil {
+			return []byte(`"` + RedactedValue + `"`)
+		}
+		out, err := json.Marshal(redactValue(v, keys))
+		if err != nil {
+			return []byte(`"` + RedactedValue + `"`)
+		}
+		return out
+	}
+}
+
+// redactValue walks a decoded JSON value, masking members named in keys.
+func redactValue(v any, keys map[string]bool) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if keys[strings.ToLower(k)] {
+				t[k] = RedactedValue
+				continue
+			}
+			t[k] = redactValue(child, keys)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = redactValue(child, keys)
+		}
+	}
+	return v
+}
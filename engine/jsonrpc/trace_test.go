@@ -0,0 +1,30 @@
+package jsonrpc
+
+import "testing"
+
+func TestRedactFields(t *testing.T) {
+	r := RedactFields("apiKey", "text")
+	tests := []struct {
+		name, in, want string
+	}{
+		{"top level", `{"apiKey":"k","id":1}`, `{"apiKey":"[REDACTED]","id":1}`},
+		{"case insensitive", `{"APIKEY":"k"}`, `{"APIKEY":"[REDACTED]"}`},
+		{"nested", `{"params":{"prompt":[{"type":"text","text":"hi"}]}}`, `{"params":{"prompt":[{"text":"[REDACTED]","type":"text"}]}}`},
+		{"object value", `{"text":{"a":1}}`, `{"text":"[REDACTED]"}`},
+		{"untouched", `{"id":1}`, `{"id":1}`},
+		{"invalid json fails closed", `{"apiKey":`, `"[REDACTED]"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(r([]byte(tt.in))); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirection_String(t *testing.T) {
+	if Inbound.String() != "in" || Outbound.String() != "out" {
+		t.Errorf("got %q/%q", Inbound, Outbound)
+	}
+}
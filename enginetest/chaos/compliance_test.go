@@ -0,0 +1,37 @@
+package chaos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+	"github.com/dmora/agentrun/enginetest/chaos"
+	"github.com/dmora/agentrun/enginetest/fake"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		return chaos.NewEngine(fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))), agentrun.Session{}
+	})
+}
+
+func TestCompliance_ResumePerTurn(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		inner := fake.NewEngine(fake.WithResumePerTurn(), fake.WithDefaultTurn(fake.TextTurn("ok")))
+		return chaos.NewEngine(inner), agentrun.Session{}
+	})
+}
+
+// Faults that never lose a MessageResult keep the wrapper compliant.
+func TestCompliance_BenignFaults(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		inner := fake.NewEngine(fake.WithDefaultTurn(fake.BlockingTextTurn("ok")))
+		return chaos.NewEngine(inner,
+			chaos.WithSeed(7),
+			chaos.WithDelay(0.5, time.Millisecond),
+			chaos.WithDrop(0.5, agentrun.MessageText),
+			chaos.WithSlowConsumer(time.Microsecond),
+		), agentrun.Session{}
+	})
+}
@@ -0,0 +1,27 @@
+// Package chaos wraps an [agentrun.Process] or [agentrun.Engine] with
+// configurable fault injection, for testing that code built on agentrun
+// survives misbehaving agents.
+//
+// Faults are drawn from a seeded random source, so a failing run can be
+// replayed with the same seed:
+//
+//	eng := chaos.NewEngine(claudeEngine,
+//	    chaos.WithSeed(42),
+//	    chaos.WithDrop(0.05, agentrun.MessageTextDelta),
+//	    chaos.WithDuplicateDeltas(0.1),
+//	    chaos.WithSendError(0.02, nil),
+//	    chaos.WithExitError(0.01, 1, 137),
+//	)
+//	runOrchestrator(ctx, eng) // code under test
+//
+// Output faults — delays, drops, duplicated deltas, a slow consumer,
+// premature close with [agentrun.ErrNoResult], crashes with
+// [agentrun.ExitError] — are decided per message in Output order, and
+// Send faults per Send call, each from its own random stream. The fault
+// sequence is therefore reproducible whenever the wrapped process emits
+// the same messages; wall-clock timing is not.
+//
+// The wrapper works with any engine, including the fake sub-package. With
+// no faults configured it forwards everything unchanged and follows the
+// [agentrun.Process] contract.
+package chaos
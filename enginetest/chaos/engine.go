@@ -0,0 +1,54 @@
+package chaos
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// Engine wraps an agentrun.Engine so every started process injects the
+// configured faults.
+type Engine struct {
+	inner agentrun.Engine
+	opts  Options
+
+	mu    sync.Mutex
+	procs []*Process
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine wraps inner. The n-th process started (from zero) is seeded
+// with Seed+n, so runs that start processes in the same order see the
+// same faults.
+func NewEngine(inner agentrun.Engine, opts ...Option) *Engine {
+	return &Engine{inner: inner, opts: resolve(opts)}
+}
+
+// Start starts a session on the wrapped engine and wraps its process.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	inner, err := e.inner.Start(ctx, session, opts...)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o := e.opts
+	o.Seed += uint64(len(e.procs))
+	p := wrap(inner, o)
+	e.procs = append(e.procs, p)
+	return p, nil
+}
+
+// Validate delegates to the wrapped engine.
+func (e *Engine) Validate() error {
+	return e.inner.Validate()
+}
+
+// Processes returns every process started so far, in Start order.
+func (e *Engine) Processes() []*Process {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Process(nil), e.procs...)
+}
@@ -0,0 +1,140 @@
+package chaos
+
+import (
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// Options holds resolved fault-injection configuration. Rates are
+// probabilities in [0, 1]; zero disables the fault.
+type Options struct {
+	// Seed seeds the random source. Processes started through Engine use
+	// Seed plus their start index.
+	Seed uint64
+
+	// DelayRate is the chance that a message is held back for a random
+	// duration up to MaxDelay before delivery.
+	DelayRate float64
+	MaxDelay  time.Duration
+
+	// DropRate is the chance that a message is discarded. DropTypes limits
+	// drops to those message types; empty means any type.
+	DropRate  float64
+	DropTypes []agentrun.MessageType
+
+	// DuplicateRate is the chance that a delta message is delivered twice.
+	DuplicateRate float64
+
+	// SendErrRate is the chance that Send fails with SendErr without
+	// reaching the wrapped process.
+	SendErrRate float64
+	SendErr     error
+
+	// CloseRate is the chance, per message before a MessageResult, that
+	// the wrapped process is stopped and Output closes with
+	// agentrun.ErrNoResult.
+	CloseRate float64
+
+	// ExitRate is the chance, per message before a MessageResult, that the
+	// wrapped process is stopped and Output closes with an
+	// *agentrun.ExitError whose Code is picked from ExitCodes.
+	ExitRate  float64
+	ExitCodes []int
+
+	// ConsumerDelay pauses after every delivered message before the next
+	// one is read from the wrapped process, like a slow consumer.
+	ConsumerDelay time.Duration
+}
+
+// Option configures fault injection.
+type Option func(*Options)
+
+// WithSeed sets the random seed (default 0).
+func WithSeed(seed uint64) Option {
+	return func(o *Options) {
+		o.Seed = seed
+	}
+}
+
+// WithDelay holds back each message with probability rate for a random
+// duration up to maxDelay.
+func WithDelay(rate float64, maxDelay time.Duration) Option {
+	return func(o *Options) {
+		o.DelayRate = clamp(rate)
+		o.MaxDelay = max(maxDelay, 0)
+	}
+}
+
+// WithDrop discards each message of the given types (any type when none
+// are given) with probability rate.
+func WithDrop(rate float64, types ...agentrun.MessageType) Option {
+	return func(o *Options) {
+		o.DropRate = clamp(rate)
+		o.DropTypes = types
+	}
+}
+
+// WithDuplicateDeltas delivers each delta message twice with probability
+// rate.
+func WithDuplicateDeltas(rate float64) Option {
+	return func(o *Options) {
+		o.DuplicateRate = clamp(rate)
+	}
+}
+
+// WithSendError fails each Send with probability rate. A nil err means
+// ErrInjected.
+func WithSendError(rate float64, err error) Option {
+	return func(o *Options) {
+		o.SendErrRate = clamp(rate)
+		if err == nil {
+			err = ErrInjected
+		}
+		o.SendErr = err
+	}
+}
+
+// WithPrematureClose ends the session with agentrun.ErrNoResult with
+// probability rate at each message before a MessageResult.
+func WithPrematureClose(rate float64) Option {
+	return func(o *Options) {
+		o.CloseRate = clamp(rate)
+	}
+}
+
+// WithExitError ends the session with an *agentrun.ExitError with
+// probability rate at each message before a MessageResult. The exit code
+// is picked at random from codes (default 1).
+func WithExitError(rate float64, codes ...int) Option {
+	return func(o *Options) {
+		o.ExitRate = clamp(rate)
+		if len(codes) == 0 {
+			codes = []int{1}
+		}
+		o.ExitCodes = codes
+	}
+}
+
+// WithSlowConsumer pauses for d after every delivered message, applying
+// backpressure to the wrapped process.
+func WithSlowConsumer(d time.Duration) Option {
+	return func(o *Options) {
+		o.ConsumerDelay = max(d, 0)
+	}
+}
+
+func clamp(rate float64) float64 {
+	if !(rate > 0) { // also catches NaN
+		return 0
+	}
+	return min(rate, 1)
+}
+
+func resolve(opts []Option) Options {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,327 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/filter"
+)
+
+// ErrInjected is the default error returned by an injected Send failure.
+var ErrInjected = errors.New("chaos: injected send error")
+
+// Fault names an injected fault.
+type Fault string
+
+// Faults recorded by Process.
+const (
+	FaultDelay     Fault = "delay"
+	FaultDrop      Fault = "drop"
+	FaultDuplicate Fault = "duplicate"
+	FaultSendError Fault = "send_error"
+	FaultClose     Fault = "close"
+	FaultExit      Fault = "exit"
+)
+
+// Injection records one injected fault.
+type Injection struct {
+	Fault   Fault
+	Message agentrun.MessageType // affected message type; empty for FaultSendError
+	Time    time.Time
+}
+
+// Process wraps an agentrun.Process and injects faults into its Output
+// and Send. A single goroutine reads the wrapped Output and forwards to
+// an unbuffered channel, so every delivery waits for the consumer.
+type Process struct {
+	inner agentrun.Process
+	opts  Options
+
+	output  chan agentrun.Message
+	done    chan struct{}
+	stop    chan struct{}
+	resumed chan struct{} // signaled by each successful Send
+
+	outRand  *rand.Rand // used only by the forwarding goroutine
+	sendMu   sync.Mutex // guards sendRand
+	sendRand *rand.Rand
+
+	mu         sync.Mutex // guards injections
+	injections []Injection
+
+	termErr  error
+	stopOnce sync.Once
+}
+
+var _ agentrun.Process = (*Process)(nil)
+
+// Wrap returns a Process that forwards to inner with the configured
+// faults. The wrapper owns inner: consume Output and call Stop on the
+// wrapper, not on inner.
+func Wrap(inner agentrun.Process, opts ...Option) *Process {
+	return wrap(inner, resolve(opts))
+}
+
+func wrap(inner agentrun.Process, o Options) *Process {
+	p := &Process{
+		inner:    inner,
+		opts:     o,
+		output:   make(chan agentrun.Message),
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		resumed:  make(chan struct{}, 1),
+		outRand:  rand.New(rand.NewPCG(o.Seed, 0)),
+		sendRand: rand.New(rand.NewPCG(o.Seed, 1)),
+	}
+	go p.forward()
+	return p
+}
+
+// Output returns the channel for receiving messages from the agent.
+func (p *Process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send forwards message to the wrapped process, or fails with the
+// configured error without forwarding.
+func (p *Process) Send(ctx context.Context, message string) error {
+	if p.ended() || p.stopping() {
+		return agentrun.ErrTerminated
+	}
+	p.sendMu.Lock()
+	fail := roll(p.sendRand, p.opts.SendErrRate)
+	p.sendMu.Unlock()
+	if fail {
+		p.record(FaultSendError, "")
+		return p.opts.SendErr
+	}
+	if err := p.inner.Send(ctx, message); err != nil {
+		return err
+	}
+	select {
+	case p.resumed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Stop stops the wrapped process. Idempotent; blocks until Output is
+// closed and returns the terminal error.
+func (p *Process) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		_ = p.inner.Stop(ctx)
+	})
+	select {
+	case <-p.done:
+		return p.termErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until the session ends.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *Process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// Injections returns the faults injected so far, in order.
+func (p *Process) Injections() []Injection {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.injections)
+}
+
+// forward relays the wrapped Output, injecting output faults, until the
+// wrapped process ends, Stop is called, or a crash is injected. A
+// resume-per-turn process (agentrun.Resumable) closes Output after every
+// turn; forward then waits for the next Send and reads the new channel.
+func (p *Process) forward() {
+	out := p.inner.Output()
+	var resumed <-chan struct{} // set while between turns
+	for {
+		select {
+		case msg, ok := <-out:
+			if !ok {
+				if !agentrun.Resumable(p.inner) {
+					p.finish(p.inner.Err())
+					return
+				}
+				out, resumed = nil, p.resumed
+				continue
+			}
+			if err := p.crash(msg); err != nil {
+				p.abort(err)
+				return
+			}
+			if !p.relay(msg) {
+				p.abort(nil)
+				return
+			}
+		case <-resumed:
+			out, resumed = p.inner.Output(), nil
+		case <-p.stop:
+			p.abort(nil)
+			return
+		}
+	}
+}
+
+// crash decides whether the session dies at msg and returns the injected
+// terminal error.
+func (p *Process) crash(msg agentrun.Message) error {
+	if msg.Type == agentrun.MessageResult {
+		return nil
+	}
+	if roll(p.outRand, p.opts.CloseRate) {
+		p.record(FaultClose, msg.Type)
+		return agentrun.ErrNoResult
+	}
+	if roll(p.outRand, p.opts.ExitRate) {
+		p.record(FaultExit, msg.Type)
+		code := p.opts.ExitCodes[p.outRand.IntN(len(p.opts.ExitCodes))]
+		return &agentrun.ExitError{Code: code}
+	}
+	return nil
+}
+
+// relay delivers msg with delay, drop and duplicate faults applied.
+// Returns false if Stop was called first.
+func (p *Process) relay(msg agentrun.Message) bool {
+	if p.droppable(msg.Type) && roll(p.outRand, p.opts.DropRate) {
+		p.record(FaultDrop, msg.Type)
+		return true
+	}
+	if roll(p.outRand, p.opts.DelayRate) {
+		p.record(FaultDelay, msg.Type)
+		if !p.sleep(time.Duration(p.outRand.Int64N(int64(p.opts.MaxDelay) + 1))) {
+			return false
+		}
+	}
+	if !p.emit(msg) {
+		return false
+	}
+	if filter.IsDelta(msg.Type) && roll(p.outRand, p.opts.DuplicateRate) {
+		p.record(FaultDuplicate, msg.Type)
+		if !p.emit(msg) {
+			return false
+		}
+	}
+	return p.sleep(p.opts.ConsumerDelay)
+}
+
+func (p *Process) droppable(t agentrun.MessageType) bool {
+	return len(p.opts.DropTypes) == 0 || slices.Contains(p.opts.DropTypes, t)
+}
+
+// emit sends msg on Output. Returns false if Stop was called first.
+func (p *Process) emit(msg agentrun.Message) bool {
+	select {
+	case p.output <- msg:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// sleep waits for d. Returns false if Stop was called first.
+func (p *Process) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// abort stops the wrapped process, drains its Output so it can exit, and
+// finishes with err — or with the wrapped terminal error when err is nil
+// (Stop was called). A resume-per-turn process may open a new Output
+// channel for a turn that began before Stop, so each one is drained.
+func (p *Process) abort(err error) {
+	stopped := make(chan struct{})
+	go func() {
+		_ = p.inner.Stop(context.Background())
+		close(stopped)
+	}()
+	out := p.inner.Output()
+	for {
+		for range out {
+		}
+		if next := p.inner.Output(); next != out {
+			out = next
+			continue
+		}
+		<-stopped
+		if next := p.inner.Output(); next != out {
+			out = next
+			continue
+		}
+		break
+	}
+	if err == nil {
+		err = p.inner.Err()
+	}
+	p.finish(err)
+}
+
+// finish sets the terminal error and closes done, then output, so Err is
+// stable by the time a consumer sees Output closed. Called once, by the
+// forwarding goroutine.
+func (p *Process) finish(err error) {
+	p.termErr = err
+	close(p.done)
+	close(p.output)
+}
+
+func (p *Process) record(f Fault, t agentrun.MessageType) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.injections = append(p.injections, Injection{Fault: f, Message: t, Time: time.Now()})
+}
+
+func (p *Process) ended() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Process) stopping() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// roll reports whether an event with probability rate happens. A zero
+// rate consumes no randomness, so disabled faults leave the sequence of
+// enabled ones unchanged.
+func roll(r *rand.Rand, rate float64) bool {
+	return rate > 0 && r.Float64() < rate
+}
@@ -0,0 +1,234 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/chaos"
+	"github.com/dmora/agentrun/enginetest/fake"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// deltaTurn streams n text deltas and ends with a result.
+func deltaTurn(n int) fake.Turn {
+	var msgs []agentrun.Message
+	for i := range n {
+		msgs = append(msgs, agentrun.Message{Type: agentrun.MessageTextDelta, Content: strconv.Itoa(i)})
+	}
+	msgs = append(msgs, agentrun.Message{Type: agentrun.MessageResult})
+	return fake.Turn{Messages: msgs}
+}
+
+func wrap(t *testing.T, turn fake.Turn, opts ...chaos.Option) *chaos.Process {
+	t.Helper()
+	inner, err := fake.NewEngine(fake.WithInit(), fake.WithDefaultTurn(turn)).Start(testCtx(t), agentrun.Session{})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	proc := chaos.Wrap(inner, opts...)
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc
+}
+
+// turn sends a message and collects Output until MessageResult or close.
+func turn(t *testing.T, proc agentrun.Process) []agentrun.Message {
+	t.Helper()
+	if err := proc.Send(testCtx(t), "go"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	var msgs []agentrun.Message
+	for {
+		select {
+		case msg, ok := <-proc.Output():
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+			if msg.Type == agentrun.MessageResult {
+				return msgs
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("timed out waiting for output")
+		}
+	}
+}
+
+func faults(injections []chaos.Injection) []chaos.Fault {
+	out := make([]chaos.Fault, 0, len(injections))
+	for _, in := range injections {
+		out = append(out, in.Fault)
+	}
+	return out
+}
+
+func TestWrap_NoFaultsForwardsUnchanged(t *testing.T) {
+	proc := wrap(t, deltaTurn(5))
+	msgs := turn(t, proc)
+	if len(msgs) != 6 || msgs[5].Type != agentrun.MessageResult {
+		t.Fatalf("got %d messages, want 5 deltas and a result", len(msgs))
+	}
+	if got := proc.Injections(); len(got) != 0 {
+		t.Errorf("Injections = %v, want none", got)
+	}
+}
+
+func TestWrap_SeedReproducible(t *testing.T) {
+	opts := []chaos.Option{
+		chaos.WithSeed(99),
+		chaos.WithDrop(0.3, agentrun.MessageTextDelta),
+		chaos.WithDuplicateDeltas(0.3),
+	}
+	run := func() ([]agentrun.Message, []chaos.Fault) {
+		proc := wrap(t, deltaTurn(50), opts...)
+		return turn(t, proc), faults(proc.Injections())
+	}
+	msgs1, faults1 := run()
+	msgs2, faults2 := run()
+	if len(faults1) == 0 {
+		t.Fatal("no faults injected")
+	}
+	if !slices.Equal(faults1, faults2) || len(msgs1) != len(msgs2) {
+		t.Errorf("same seed gave different runs: %v vs %v", faults1, faults2)
+	}
+}
+
+func TestWrap_DropAndDuplicate(t *testing.T) {
+	proc := wrap(t, deltaTurn(40),
+		chaos.WithSeed(1),
+		chaos.WithDrop(0.25, agentrun.MessageTextDelta),
+		chaos.WithDuplicateDeltas(0.25),
+	)
+	msgs := turn(t, proc)
+
+	var drops, dups int
+	for _, in := range proc.Injections() {
+		switch in.Fault {
+		case chaos.FaultDrop:
+			drops++
+		case chaos.FaultDuplicate:
+			dups++
+		}
+	}
+	if drops == 0 || dups == 0 {
+		t.Fatalf("drops = %d, duplicates = %d, want both > 0", drops, dups)
+	}
+	if want := 40 - drops + dups + 1; len(msgs) != want {
+		t.Errorf("got %d messages, want %d", len(msgs), want)
+	}
+	if msgs[len(msgs)-1].Type != agentrun.MessageResult {
+		t.Error("result was dropped; drop types should exclude it")
+	}
+}
+
+func TestWrap_SendError(t *testing.T) {
+	sentinel := errors.New("boom")
+	proc := wrap(t, deltaTurn(1), chaos.WithSendError(1, sentinel))
+	if err := proc.Send(testCtx(t), "go"); !errors.Is(err, sentinel) {
+		t.Fatalf("Send = %v, want %v", err, sentinel)
+	}
+	if got := faults(proc.Injections()); !slices.Equal(got, []chaos.Fault{chaos.FaultSendError}) {
+		t.Errorf("Injections = %v", got)
+	}
+}
+
+func TestWrap_SendErrorDefault(t *testing.T) {
+	proc := wrap(t, deltaTurn(1), chaos.WithSendError(1, nil))
+	if err := proc.Send(testCtx(t), "go"); !errors.Is(err, chaos.ErrInjected) {
+		t.Fatalf("Send = %v, want ErrInjected", err)
+	}
+}
+
+func TestWrap_PrematureClose(t *testing.T) {
+	proc := wrap(t, deltaTurn(3), chaos.WithPrematureClose(1))
+	msgs := turn(t, proc)
+	if len(msgs) != 0 {
+		t.Errorf("got %d messages before close, want 0", len(msgs))
+	}
+	if err := proc.Err(); !errors.Is(err, agentrun.ErrNoResult) {
+		t.Errorf("Err = %v, want ErrNoResult", err)
+	}
+	if err := proc.Stop(testCtx(t)); !errors.Is(err, agentrun.ErrNoResult) {
+		t.Errorf("Stop = %v, want ErrNoResult", err)
+	}
+	if err := proc.Send(testCtx(t), "again"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send after close = %v, want ErrTerminated", err)
+	}
+}
+
+func TestWrap_ExitError(t *testing.T) {
+	proc := wrap(t, deltaTurn(3), chaos.WithSeed(3), chaos.WithExitError(1, 137))
+	turn(t, proc)
+	code, ok := agentrun.ExitCode(proc.Wait())
+	if !ok || code != 137 {
+		t.Errorf("ExitCode = %d, %v; want 137, true", code, ok)
+	}
+}
+
+func TestWrap_DelayAndSlowConsumer(t *testing.T) {
+	const pause = 5 * time.Millisecond
+	proc := wrap(t, deltaTurn(4), chaos.WithSlowConsumer(pause), chaos.WithDelay(1, pause))
+	start := time.Now()
+	turn(t, proc)
+	// Four deltas each pause after delivery before the result is read.
+	if elapsed := time.Since(start); elapsed < 4*pause {
+		t.Errorf("turn took %v, want >= %v", elapsed, 4*pause)
+	}
+	if got := faults(proc.Injections()); len(got) != 5 {
+		t.Errorf("Injections = %v, want a delay per message", got)
+	}
+}
+
+func TestWrap_StopInterruptsDelay(t *testing.T) {
+	proc := wrap(t, deltaTurn(1), chaos.WithDelay(1, time.Hour))
+	if err := proc.Send(testCtx(t), "go"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	// Wait until the delay holds the first message.
+	deadline := time.Now().Add(testTimeout)
+	for len(proc.Injections()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := proc.Stop(testCtx(t)); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+	if _, ok := <-proc.Output(); ok {
+		t.Error("Output delivered a message after Stop")
+	}
+}
+
+func TestEngine_SeedsPerProcess(t *testing.T) {
+	inner := fake.NewEngine(fake.WithInit(), fake.WithDefaultTurn(deltaTurn(30)))
+	eng := chaos.NewEngine(inner, chaos.WithSeed(5), chaos.WithDrop(0.5, agentrun.MessageTextDelta))
+	var delivered [][]string
+	for range 2 {
+		proc, err := eng.Start(testCtx(t), agentrun.Session{})
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+		var contents []string
+		for _, msg := range turn(t, proc) {
+			contents = append(contents, msg.Content)
+		}
+		delivered = append(delivered, contents)
+	}
+	if n := len(eng.Processes()); n != 2 {
+		t.Fatalf("Processes = %d, want 2", n)
+	}
+	if slices.Equal(delivered[0], delivered[1]) {
+		t.Error("processes dropped the same deltas; want per-process seeds")
+	}
+}
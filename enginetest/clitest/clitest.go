@@ -13,6 +13,9 @@ import (
 //   - Claude: ^[a-zA-Z0-9_-]{1,128}$
 //   - OpenCode: ^ses_[a-zA-Z0-9]{20,40}$
 //   - Codex: any non-empty, non-null string
+//   - Gemini: ^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$
+//   - Cursor: ^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$
+//   - Amp: ^[a-zA-Z0-9][a-zA-Z0-9_-]{0,127}$
 const universalResumeID = "ses_abcdefghij1234567890abcd"
 
 // RunBackendTests runs all applicable compliance suites for a [cli.Backend].
@@ -20,4 +20,35 @@
 //	        return mybackend.New()
 //	    })
 //	}
+//
+// # Fake agent binary
+//
+// [NewFakeAgent] builds a scriptable fake agent CLI (once per test binary)
+// and returns its path, so backends can be tested end to end through
+// cli.Engine — resume flows, crashes and signals included — without
+// hand-written mock programs. Scripts match argv, read stdin lines, emit
+// stdout and stderr lines with delays, and exit with codes or signals:
+//
+//	agent := clitest.NewFakeAgent(t, `
+//	match ^exec resume
+//	emit {"type":"turn.completed"}
+//
+//	match ^exec
+//	emit {"type":"thread.started","thread_id":"…"}
+//	signal KILL
+//	`)
+//	eng := cli.NewEngine(codex.New(codex.WithBinary(agent.Path)))
+//
+// See the fakeagent command for the full script syntax.
+//
+// # Golden transcripts
+//
+// [RunGoldenTests] replays recorded CLI output (testdata/golden/*.jsonl,
+// blank lines between turns) through a fresh Parser and compares the
+// messages to sibling .golden files, so upstream format changes show up
+// as a diff. [CheckTranscript] adds backend-independent checks: one
+// MessageResult per turn and consistent Usage. After an intended parser
+// change, rewrite the backend's golden files and review the diff:
+//
+//	CLITEST_UPDATE_GOLDEN=1 go test ./engine/cli -run TestGolden/codex
 package clitest
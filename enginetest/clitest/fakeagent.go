@@ -0,0 +1,139 @@
+//go:build !windows
+
+package clitest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakeAgentPkg is the import path of the fake agent command.
+const fakeAgentPkg = "github.com/dmora/agentrun/enginetest/clitest/fakeagent"
+
+var (
+	fakeAgentOnce sync.Once
+	fakeAgentBin  string
+	errFakeAgent  error
+)
+
+// buildFakeAgent compiles the fake agent once per test binary into a
+// fixed per-user cache directory, so repeated runs reuse one path instead
+// of leaking a temp dir each. The build goes to a temp name and is renamed
+// into place, so concurrently running test binaries never see a partial
+// executable.
+func buildFakeAgent() {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	dir := filepath.Join(base, "agentrun-fakeagent")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		errFakeAgent = fmt.Errorf("cache dir: %w", err)
+		return
+	}
+	tmp, err := os.CreateTemp(dir, "fakeagent-*.tmp")
+	if err != nil {
+		errFakeAgent = fmt.Errorf("cache dir: %w", err)
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	cmd := exec.Command("go", "build", "-o", tmp.Name(), fakeAgentPkg)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		errFakeAgent = fmt.Errorf("build fakeagent: %w: %s", err, out)
+		return
+	}
+	fakeAgentBin = filepath.Join(dir, "fakeagent")
+	if err := os.Rename(tmp.Name(), fakeAgentBin); err != nil {
+		errFakeAgent = fmt.Errorf("install fakeagent: %w", err)
+	}
+}
+
+// FakeAgent is a scripted stand-in for an agent CLI binary. Point a
+// backend at Path (e.g. codex.WithBinary(agent.Path)) to drive it end to
+// end through cli.Engine. See the fakeagent command for the script syntax.
+type FakeAgent struct {
+	// Path is an executable that runs the fake agent with its script.
+	Path string
+
+	log string
+}
+
+// NewFakeAgent builds the fake agent binary (once per test binary) and
+// returns a FakeAgent that plays script on every invocation. Files live in
+// t.TempDir.
+//
+// Each spawn re-reads the script and selects a section by argv, so one
+// script can cover the initial spawn and later resume spawns:
+//
+//	agent := clitest.NewFakeAgent(t, `
+//	match ^exec --json
+//	emit {"type":"thread.started","thread_id":"…"}
+//	emit {"type":"turn.completed"}
+//
+//	match ^exec resume
+//	exit 1
+//	`)
+func NewFakeAgent(t *testing.T, script string) *FakeAgent {
+	t.Helper()
+	fakeAgentOnce.Do(buildFakeAgent)
+	if errFakeAgent != nil {
+		t.Fatalf("clitest: %v", errFakeAgent)
+	}
+
+	dir := t.TempDir()
+	scriptPath := filepath.Join(dir, "script")
+	if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+		t.Fatalf("clitest: write script: %v", err)
+	}
+	a := &FakeAgent{
+		Path: filepath.Join(dir, "fakeagent"),
+		log:  filepath.Join(dir, "invocations"),
+	}
+	wrapper := fmt.Sprintf("#!/bin/sh\nFAKEAGENT_SCRIPT='%s' FAKEAGENT_LOG='%s' exec '%s' \"$@\"\n",
+		scriptPath, a.log, fakeAgentBin)
+	if err := os.WriteFile(a.Path, []byte(wrapper), 0o600); err != nil {
+		t.Fatalf("clitest: write wrapper: %v", err)
+	}
+	if err := os.Chmod(a.Path, 0o755); err != nil {
+		t.Fatalf("clitest: chmod wrapper: %v", err)
+	}
+	return a
+}
+
+// Invocations returns the argv (without the program name) of every spawn
+// of the agent so far, in order.
+func (a *FakeAgent) Invocations(t *testing.T) [][]string {
+	t.Helper()
+	f, err := os.Open(a.log)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("clitest: open invocation log: %v", err)
+	}
+	defer f.Close()
+
+	var calls [][]string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var args []string
+		if err := json.Unmarshal(sc.Bytes(), &args); err != nil {
+			t.Fatalf("clitest: invocation log: %v", err)
+		}
+		calls = append(calls, args)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("clitest: invocation log: %v", err)
+	}
+	return calls
+}
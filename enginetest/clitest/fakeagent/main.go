@@ -0,0 +1,112 @@
+//go:build !windows
+
+// Command fakeagent is a scriptable stand-in for agent CLIs in end-to-end
+// tests. It reads a script from the file named by $FAKEAGENT_SCRIPT and
+// plays it against its argv, stdin, stdout and stderr. Tests normally
+// build and wrap it via clitest.NewFakeAgent rather than invoking it
+// directly.
+//
+// # Script syntax
+//
+// One command per line; blank lines and lines starting with # are ignored.
+//
+//	match <regexp>       start a section run when argv matches
+//	expect-args <regexp> fail unless argv matches
+//	read                 read one stdin line (EOF ends the run, exit 0)
+//	read-match <regexp>  read one stdin line and fail unless it matches
+//	emit <text>          write text and a newline to stdout
+//	stderr <text>        write text and a newline to stderr
+//	sleep <duration>     pause, e.g. 50ms
+//	exit <code>          exit with the given status
+//	signal <name>        send TERM, KILL, INT, HUP or QUIT to itself
+//	ignore <name>        ignore a signal, e.g. to force SIGKILL escalation
+//	loop ... end         repeat the enclosed commands until stdin EOF
+//
+// argv is the arguments after the program name, joined by single spaces.
+// The first match section whose regexp matches argv runs; commands before
+// the first match line run when no section matches. Running off the end of
+// a section exits 0.
+//
+// emit and stderr text expands ${input} (last stdin line), ${input_json}
+// (the same as a JSON string literal), ${args} (argv) and ${N} (submatch
+// N of the section's match regexp).
+//
+// Script and expectation failures are reported on stderr with exit
+// status 2. When $FAKEAGENT_LOG is set, each invocation appends its argv
+// as a JSON array line to that file.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	args := os.Args[1:]
+	if err := logInvocation(os.Getenv("FAKEAGENT_LOG"), args); err != nil {
+		return fail(err)
+	}
+
+	src, err := os.ReadFile(os.Getenv("FAKEAGENT_SCRIPT"))
+	if err != nil {
+		return fail(fmt.Errorf("%w: read script: %w", errScript, err))
+	}
+	s, err := parse(string(src))
+	if err != nil {
+		return fail(fmt.Errorf("%w: %w", errScript, err))
+	}
+
+	r := &runner{
+		args:   args,
+		stdin:  newStdinScanner(os.Stdin),
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		kill: func(sig syscall.Signal) error {
+			signal.Reset(sig)
+			return syscall.Kill(os.Getpid(), sig)
+		},
+		ignore: func(sig syscall.Signal) { signal.Ignore(sig) },
+	}
+	err = r.run(s)
+	var exitErr *exitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	default:
+		return fail(err)
+	}
+}
+
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, err)
+	return exitScriptError
+}
+
+// logInvocation appends args as one JSON line to path. No-op when path
+// is empty.
+func logInvocation(path string, args []string) error {
+	if path == "" {
+		return nil
+	}
+	line, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%w: log: %w", errScript, err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,273 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errScript marks failures of the script itself or of an expectation
+// (argv or stdin mismatch). The agent exits with exitScriptError.
+var errScript = errors.New("fakeagent")
+
+// exitScriptError is the exit status for script and expectation failures.
+const exitScriptError = 2
+
+// signals maps script signal names to signals.
+var signals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+}
+
+// step is one parsed script command. Loop steps carry their body.
+type step struct {
+	line int
+	cmd  string
+	arg  string
+	re   *regexp.Regexp // match, expect-args, read-match
+	body []step         // loop
+}
+
+// section is a run of steps selected by a match regexp. The default
+// section (steps before the first match line) has a nil match.
+type section struct {
+	match *regexp.Regexp
+	steps []step
+}
+
+// script is a parsed fake agent script.
+type script struct {
+	sections []section
+}
+
+// parse parses a script. See the package documentation for the syntax.
+func parse(src string) (*script, error) {
+	s := &script{sections: []section{{}}}
+	var loop *step
+	for i, raw := range strings.Split(src, "\n") {
+		n := i + 1
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		st := step{line: n, cmd: cmd, arg: arg}
+
+		switch cmd {
+		case "match":
+			if loop != nil {
+				return nil, fmt.Errorf("line %d: match inside loop", n)
+			}
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			s.sections = append(s.sections, section{match: re})
+			continue
+		case "loop":
+			if loop != nil {
+				return nil, fmt.Errorf("line %d: nested loop", n)
+			}
+			loop = &st
+			continue
+		case "end":
+			if loop == nil {
+				return nil, fmt.Errorf("line %d: end without loop", n)
+			}
+			st, loop = *loop, nil
+		case "expect-args", "read-match":
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			st.re = re
+		case "sleep":
+			if _, err := time.ParseDuration(arg); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+		case "exit":
+			if _, err := strconv.Atoi(arg); err != nil {
+				return nil, fmt.Errorf("line %d: exit code: %w", n, err)
+			}
+		case "signal", "ignore":
+			if _, ok := signals[arg]; !ok {
+				return nil, fmt.Errorf("line %d: unknown signal %q", n, arg)
+			}
+		case "emit", "stderr", "read":
+		default:
+			return nil, fmt.Errorf("line %d: unknown command %q", n, cmd)
+		}
+
+		if loop != nil {
+			loop.body = append(loop.body, st)
+			continue
+		}
+		sec := &s.sections[len(s.sections)-1]
+		sec.steps = append(sec.steps, st)
+	}
+	if loop != nil {
+		return nil, fmt.Errorf("line %d: loop without end", loop.line)
+	}
+	return s, nil
+}
+
+// selectSection returns the first match section whose regexp matches argv,
+// falling back to the default section. Returns nil when only match
+// sections exist and none matches.
+func (s *script) selectSection(argv string) *section {
+	for i := 1; i < len(s.sections); i++ {
+		if s.sections[i].match.MatchString(argv) {
+			return &s.sections[i]
+		}
+	}
+	if len(s.sections) == 1 || len(s.sections[0].steps) > 0 {
+		return &s.sections[0]
+	}
+	return nil
+}
+
+// runner executes a script section against injected I/O.
+type runner struct {
+	args   []string
+	stdin  *bufio.Scanner
+	stdout io.Writer
+	stderr io.Writer
+
+	// kill delivers a signal to the agent; ignore stops delivery of one.
+	kill   func(syscall.Signal) error
+	ignore func(syscall.Signal)
+
+	groups []string // submatches of the selected section's match regexp
+	input  string   // last stdin line
+	eof    bool     // stdin reached EOF
+}
+
+// errEOF ends the run cleanly when read hits end of stdin.
+var errEOF = errors.New("stdin closed")
+
+// exitError carries an exit status requested by the script.
+type exitError struct{ code int }
+
+func (e *exitError) Error() string { return "exit " + strconv.Itoa(e.code) }
+
+// run selects the section for r.args and executes it. Returns nil on a
+// clean end (script exhausted or stdin EOF), *exitError on an exit
+// command, or an error wrapping errScript.
+func (r *runner) run(s *script) error {
+	argv := strings.Join(r.args, " ")
+	sec := s.selectSection(argv)
+	if sec == nil {
+		return fmt.Errorf("%w: no section matches argv %q", errScript, argv)
+	}
+	if sec.match != nil {
+		r.groups = sec.match.FindStringSubmatch(argv)
+	}
+	err := r.steps(sec.steps)
+	if errors.Is(err, errEOF) {
+		return nil
+	}
+	return err
+}
+
+func (r *runner) steps(steps []step) error {
+	for _, st := range steps {
+		if err := r.step(st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runner) step(st step) error {
+	switch st.cmd {
+	case "expect-args":
+		argv := strings.Join(r.args, " ")
+		if !st.re.MatchString(argv) {
+			return fmt.Errorf("%w: line %d: argv %q does not match %q", errScript, st.line, argv, st.re)
+		}
+	case "read":
+		return r.read()
+	case "read-match":
+		if err := r.read(); err != nil {
+			return err
+		}
+		if !st.re.MatchString(r.input) {
+			return fmt.Errorf("%w: line %d: stdin %q does not match %q", errScript, st.line, r.input, st.re)
+		}
+	case "emit":
+		fmt.Fprintln(r.stdout, r.expand(st.arg))
+	case "stderr":
+		fmt.Fprintln(r.stderr, r.expand(st.arg))
+	case "sleep":
+		d, _ := time.ParseDuration(st.arg)
+		time.Sleep(d)
+	case "exit":
+		code, _ := strconv.Atoi(st.arg)
+		return &exitError{code: code}
+	case "signal":
+		if err := r.kill(signals[st.arg]); err != nil {
+			return fmt.Errorf("%w: line %d: %w", errScript, st.line, err)
+		}
+		// Wait for delivery; the default action terminates the agent.
+		time.Sleep(time.Second)
+	case "ignore":
+		r.ignore(signals[st.arg])
+	case "loop":
+		for {
+			if err := r.steps(st.body); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// read reads one stdin line into r.input. Returns errEOF at end of input.
+func (r *runner) read() error {
+	if r.eof || !r.stdin.Scan() {
+		r.eof = true
+		return errEOF
+	}
+	r.input = r.stdin.Text()
+	return nil
+}
+
+// expand substitutes ${input}, ${input_json}, ${args} and ${N} (match
+// submatch N) in s.
+func (r *runner) expand(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	inputJSON, _ := json.Marshal(r.input)
+	pairs := []string{
+		"${input}", r.input,
+		"${input_json}", string(inputJSON),
+		"${args}", strings.Join(r.args, " "),
+	}
+	for i, g := range r.groups {
+		pairs = append(pairs, "${"+strconv.Itoa(i)+"}", g)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// newStdinScanner returns a line scanner over stdin with room for long
+// protocol lines.
+func newStdinScanner(f *os.File) *bufio.Scanner {
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return sc
+}
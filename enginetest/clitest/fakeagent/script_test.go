@@ -0,0 +1,173 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// runScript parses src and runs it with args and stdin, returning stdout,
+// stderr and the run error.
+func runScript(t *testing.T, src string, args []string, stdin string) (string, string, error) {
+	t.Helper()
+	s, err := parse(src)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	r := &runner{
+		args:   args,
+		stdin:  bufio.NewScanner(strings.NewReader(stdin)),
+		stdout: &stdout,
+		stderr: &stderr,
+		kill:   func(syscall.Signal) error { return errors.New("kill disabled") },
+		ignore: func(syscall.Signal) {},
+	}
+	err = r.run(s)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"unknown_command", "frobnicate"},
+		{"bad_regexp", "match ("},
+		{"bad_duration", "sleep soon"},
+		{"bad_exit_code", "exit one"},
+		{"unknown_signal", "signal USR9"},
+		{"nested_loop", "loop\nloop\nend\nend"},
+		{"end_without_loop", "end"},
+		{"loop_without_end", "loop\nread"},
+		{"match_in_loop", "loop\nmatch x\nend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parse(tt.src); err == nil {
+				t.Errorf("parse(%q) = nil error, want error", tt.src)
+			}
+		})
+	}
+}
+
+func TestRun_EmitAndStderr(t *testing.T) {
+	stdout, stderr, err := runScript(t, "# comment\n\nemit hello\nstderr oops\nemit bye", nil, "")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if stdout != "hello\nbye\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if stderr != "oops\n" {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+func TestRun_SectionSelection(t *testing.T) {
+	src := `
+emit default
+match ^exec resume (\S+)
+emit resume ${1}
+match ^exec
+emit exec ${args}
+`
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"exec", "resume", "t1"}, "resume t1\n"},
+		{[]string{"exec", "--json"}, "exec exec --json\n"},
+		{[]string{"other"}, "default\n"},
+	}
+	for _, tt := range tests {
+		stdout, _, err := runScript(t, src, tt.args, "")
+		if err != nil {
+			t.Fatalf("run %q: %v", tt.args, err)
+		}
+		if stdout != tt.want {
+			t.Errorf("run %q stdout = %q, want %q", tt.args, stdout, tt.want)
+		}
+	}
+}
+
+func TestRun_NoSectionMatches(t *testing.T) {
+	_, _, err := runScript(t, "match ^exec\nemit x", []string{"other"}, "")
+	if !errors.Is(err, errScript) {
+		t.Errorf("err = %v, want errScript", err)
+	}
+}
+
+func TestRun_ExpectArgs(t *testing.T) {
+	if _, _, err := runScript(t, "expect-args --json", []string{"exec", "--json"}, ""); err != nil {
+		t.Errorf("matching argv: %v", err)
+	}
+	if _, _, err := runScript(t, "expect-args --json", []string{"exec"}, ""); !errors.Is(err, errScript) {
+		t.Errorf("mismatching argv: err = %v, want errScript", err)
+	}
+}
+
+func TestRun_ReadLoopUntilEOF(t *testing.T) {
+	src := "emit ready\nloop\nread\nemit got ${input_json}\nend\nemit unreachable"
+	stdout, _, err := runScript(t, src, nil, "a\nb \"q\"\n")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := "ready\ngot \"a\"\ngot \"b \\\"q\\\"\"\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestRun_ReadMatch(t *testing.T) {
+	if _, _, err := runScript(t, "read-match ^hi", nil, "hello\n"); !errors.Is(err, errScript) {
+		t.Errorf("err = %v, want errScript", err)
+	}
+	stdout, _, err := runScript(t, "read-match ^hi\nemit ${input}", nil, "hi there\n")
+	if err != nil || stdout != "hi there\n" {
+		t.Errorf("stdout = %q, err = %v", stdout, err)
+	}
+}
+
+func TestRun_Exit(t *testing.T) {
+	stdout, _, err := runScript(t, "emit a\nexit 7\nemit b", nil, "")
+	var exitErr *exitError
+	if !errors.As(err, &exitErr) || exitErr.code != 7 {
+		t.Fatalf("err = %v, want exit 7", err)
+	}
+	if stdout != "a\n" {
+		t.Errorf("stdout = %q, want commands after exit skipped", stdout)
+	}
+}
+
+func TestRun_SignalAndIgnore(t *testing.T) {
+	s, err := parse("ignore TERM\nsignal KILL")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	var killed, ignored []syscall.Signal
+	r := &runner{
+		stdin:  bufio.NewScanner(strings.NewReader("")),
+		stdout: &bytes.Buffer{},
+		stderr: &bytes.Buffer{},
+		kill: func(sig syscall.Signal) error {
+			killed = append(killed, sig)
+			return errors.New("stop here")
+		},
+		ignore: func(sig syscall.Signal) { ignored = append(ignored, sig) },
+	}
+	if err := r.run(s); !errors.Is(err, errScript) {
+		t.Errorf("err = %v, want errScript from failed kill", err)
+	}
+	if len(ignored) != 1 || ignored[0] != syscall.SIGTERM {
+		t.Errorf("ignored = %v, want [SIGTERM]", ignored)
+	}
+	if len(killed) != 1 || killed[0] != syscall.SIGKILL {
+		t.Errorf("killed = %v, want [SIGKILL]", killed)
+	}
+}
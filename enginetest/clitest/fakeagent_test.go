@@ -0,0 +1,169 @@
+//go:build !windows
+
+package clitest_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/claude"
+	"github.com/dmora/agentrun/engine/cli/codex"
+	"github.com/dmora/agentrun/enginetest/clitest"
+)
+
+const testThreadID = "a1b2c3d4-e5f6-7890-abcd-ef1234567890"
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func startCodex(t *testing.T, agent *clitest.FakeAgent) agentrun.Process {
+	t.Helper()
+	eng := cli.NewEngine(codex.New(codex.WithBinary(agent.Path)))
+	proc, err := eng.Start(testCtx(t), agentrun.Session{CWD: t.TempDir(), Prompt: "hello"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc
+}
+
+func texts(msgs []agentrun.Message) []string {
+	var out []string
+	for _, m := range msgs {
+		if m.Type == agentrun.MessageText {
+			out = append(out, m.Content)
+		}
+	}
+	return out
+}
+
+func TestFakeAgent_ResumeFlow(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+match ^exec --json .*-- hello$
+emit {"type":"thread.started","thread_id":"`+testThreadID+`"}
+emit {"type":"item.completed","item":{"id":"i1","type":"agent_message","text":"first"}}
+emit {"type":"turn.completed"}
+
+match ^exec resume --json .*-- (\S+) (.*)$
+emit {"type":"item.completed","item":{"id":"i1","type":"agent_message","text":"${2} on ${1}"}}
+emit {"type":"turn.completed"}
+`)
+	proc := startCodex(t, agent)
+	ctx := testCtx(t)
+
+	// Drain to close: the first subprocess exits after its turn, and Send
+	// then resumes the thread in a new one.
+	var first []agentrun.Message
+	for msg := range proc.Output() {
+		first = append(first, msg)
+	}
+	if got := texts(first); !slices.Equal(got, []string{"first"}) {
+		t.Errorf("first turn texts = %q, want [first]", got)
+	}
+
+	if err := proc.Send(ctx, "again"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	var msgs []agentrun.Message
+	for msg := range proc.Output() {
+		msgs = append(msgs, msg)
+	}
+	want := "again on " + testThreadID
+	if got := texts(msgs); !slices.Equal(got, []string{want}) {
+		t.Errorf("resume turn texts = %q, want [%s]", got, want)
+	}
+
+	calls := agent.Invocations(t)
+	if len(calls) != 2 {
+		t.Fatalf("invocations = %d, want 2", len(calls))
+	}
+	if !slices.Contains(calls[1], testThreadID) || calls[1][1] != "resume" {
+		t.Errorf("resume argv = %q, want exec resume with thread ID", calls[1])
+	}
+}
+
+func TestFakeAgent_CrashExitCode(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+emit {"type":"thread.started","thread_id":"`+testThreadID+`"}
+stderr boom
+exit 3
+`)
+	proc := startCodex(t, agent)
+	for range proc.Output() { //nolint:revive // drain until close
+	}
+	if code, ok := agentrun.ExitCode(proc.Err()); !ok || code != 3 {
+		t.Errorf("ExitCode(%v) = %d, %v; want 3, true", proc.Err(), code, ok)
+	}
+}
+
+func TestFakeAgent_CrashSignal(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+emit {"type":"thread.started","thread_id":"`+testThreadID+`"}
+signal KILL
+`)
+	proc := startCodex(t, agent)
+	for range proc.Output() { //nolint:revive // drain until close
+	}
+	if code, ok := agentrun.ExitCode(proc.Err()); !ok || code != -1 {
+		t.Errorf("ExitCode(%v) = %d, %v; want -1, true", proc.Err(), code, ok)
+	}
+}
+
+func TestFakeAgent_ExpectArgsMismatch(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+expect-args --model gpt-5
+emit {"type":"turn.completed"}
+`)
+	proc := startCodex(t, agent)
+	for range proc.Output() { //nolint:revive // drain until close
+	}
+	if code, _ := agentrun.ExitCode(proc.Err()); code != 2 {
+		t.Errorf("Err = %v, want exit status 2 for argv mismatch", proc.Err())
+	}
+}
+
+func TestFakeAgent_StdinLoop(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+expect-args --input-format stream-json
+emit {"type":"system","subtype":"init","session_id":"fake-session"}
+loop
+read-match "type":"user"
+sleep 10ms
+emit {"type":"result","result":"ok"}
+end
+`)
+	eng := cli.NewEngine(claude.New(claude.WithBinary(agent.Path)))
+	ctx := testCtx(t)
+	proc, err := eng.Start(ctx, agentrun.Session{CWD: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = proc.Stop(context.Background()) }()
+
+	for _, msg := range []string{"one", "two"} {
+		var result string
+		if err := agentrun.RunTurn(ctx, proc, msg, func(m agentrun.Message) error {
+			if m.Type == agentrun.MessageResult {
+				result = m.Content
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("RunTurn(%q): %v", msg, err)
+		}
+		if result != "ok" {
+			t.Errorf("RunTurn(%q) result = %q, want ok", msg, result)
+		}
+	}
+	if calls := agent.Invocations(t); len(calls) != 1 || !strings.Contains(strings.Join(calls[0], " "), "stream-json") {
+		t.Errorf("invocations = %q, want one streaming spawn", calls)
+	}
+}
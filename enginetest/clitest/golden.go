@@ -0,0 +1,273 @@
+package clitest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+)
+
+// UpdateGoldenEnv names the environment variable that makes
+// RunGoldenTests rewrite golden files from the current parser output
+// when set to a non-empty value:
+//
+//	CLITEST_UPDATE_GOLDEN=1 go test ./engine/cli -run TestGolden/codex
+const UpdateGoldenEnv = "CLITEST_UPDATE_GOLDEN"
+
+// maxFixtureLine bounds one fixture line, matching the CLI engine default.
+const maxFixtureLine = 16 << 20
+
+// RunGoldenTests parses every *.jsonl fixture in dir with a fresh Parser
+// from factory and compares the normalized messages to the sibling
+// .golden file (fixture name with .jsonl replaced). Each fixture also
+// passes [CheckTranscript]. Set [UpdateGoldenEnv] to rewrite the golden
+// files after an intended parser change; review the diff before committing.
+//
+// A fixture is recorded CLI stdout. Blank lines separate turns — one per
+// subprocess for resume-per-turn backends — and mark where the CLI engine
+// would reach EOF, so [cli.EOFParser] backends are flushed there.
+func RunGoldenTests(t *testing.T, dir string, factory func() cli.Parser) {
+	t.Helper()
+
+	fixtures, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		t.Fatalf("glob fixtures: %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("no *.jsonl fixtures in %s", dir)
+	}
+	update := os.Getenv(UpdateGoldenEnv) != ""
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".jsonl")
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(fixture)
+			if err != nil {
+				t.Fatalf("open fixture: %v", err)
+			}
+			defer f.Close()
+
+			turns, err := ParseTranscript(factory(), f)
+			if err != nil {
+				t.Fatalf("parse fixture: %v", err)
+			}
+			CheckTranscript(t, turns)
+
+			got, err := formatGolden(turns)
+			if err != nil {
+				t.Fatalf("format golden: %v", err)
+			}
+			golden := strings.TrimSuffix(fixture, ".jsonl") + ".golden"
+			if update {
+				if err := os.WriteFile(golden, got, 0o600); err != nil {
+					t.Fatalf("write golden: %v", err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden (set %s=1 to create): %v", UpdateGoldenEnv, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("parser output differs from %s (set %s=1 to accept):\n%s",
+					filepath.Base(golden), UpdateGoldenEnv, lineDiff(string(want), string(got)))
+			}
+		})
+	}
+}
+
+// ParseTranscript runs p over a recorded fixture and returns the messages
+// of each turn, as the CLI engine would deliver them: ErrSkipLine lines
+// are dropped and parse errors become MessageError. Blank lines end a
+// turn; [cli.EOFParser] backends get ParseEOF at every turn end.
+func ParseTranscript(p cli.Parser, r io.Reader) ([][]agentrun.Message, error) {
+	eof, _ := p.(cli.EOFParser)
+
+	var turns [][]agentrun.Message
+	var turn []agentrun.Message
+	add := func(msg agentrun.Message, err error) {
+		if errors.Is(err, cli.ErrSkipLine) {
+			return
+		}
+		if err != nil {
+			msg = agentrun.Message{Type: agentrun.MessageError, Content: fmt.Sprintf("cli: parse: %v", err)}
+		}
+		turn = append(turn, msg)
+	}
+	endTurn := func() {
+		if eof != nil {
+			add(eof.ParseEOF())
+		}
+		if len(turn) > 0 {
+			turns = append(turns, turn)
+		}
+		turn = nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxFixtureLine)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			endTurn()
+			continue
+		}
+		add(p.ParseLine(line))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	endTurn()
+	return turns, nil
+}
+
+// CheckTranscript verifies backend-independent invariants on parsed turns:
+// exactly one MessageResult per turn (a failed turn may end in
+// MessageError instead), field exclusivity (no StopReason on MessageInit
+// or MessageError, Denials only on MessageResult, ResumeID and Init only
+// on MessageInit, ErrorCode, ErrorCategory and RetryAfter only on
+// MessageError, RateLimit only on MessageSystem or MessageError), and
+// consistent Usage (non-nil only with data, non-negative counts, finite
+// cost, context fill within the window).
+func CheckTranscript(t *testing.T, turns [][]agentrun.Message) {
+	t.Helper()
+	if len(turns) == 0 {
+		t.Error("transcript has no turns")
+	}
+	for i, turn := range turns {
+		results, failed := 0, false
+		for j, msg := range turn {
+			where := fmt.Sprintf("turn %d message %d (%s)", i+1, j+1, msg.Type)
+			switch msg.Type {
+			case agentrun.MessageResult:
+				results++
+			case agentrun.MessageError:
+				failed = true
+			}
+			checkExclusiveFields(t, where, msg)
+			if msg.Usage != nil {
+				checkUsage(t, where, msg.Usage)
+			}
+		}
+		if results > 1 || results == 0 && !failed {
+			t.Errorf("turn %d has %d MessageResult, want 1", i+1, results)
+		}
+	}
+}
+
+func checkExclusiveFields(t *testing.T, where string, msg agentrun.Message) {
+	t.Helper()
+	if msg.Type == "" {
+		t.Errorf("%s: empty Type", where)
+	}
+	// Other messages may carry a StopReason forward to the turn's result
+	// (Claude message_delta, Amp assistant); the CLI engine moves it there
+	// before delivery.
+	if (msg.Type == agentrun.MessageInit || msg.Type == agentrun.MessageError) && msg.StopReason != "" {
+		t.Errorf("%s: StopReason %q on %s", where, msg.StopReason, msg.Type)
+	}
+	if msg.Type != agentrun.MessageResult && msg.Denials != nil {
+		t.Errorf("%s: Denials outside MessageResult", where)
+	}
+	if msg.Type != agentrun.MessageInit && (msg.ResumeID != "" || msg.Init != nil) {
+		t.Errorf("%s: ResumeID or Init outside MessageInit", where)
+	}
+	if msg.Type != agentrun.MessageError && (msg.ErrorCode != "" || msg.ErrorCategory != "" || msg.RetryAfter != 0) {
+		t.Errorf("%s: ErrorCode, ErrorCategory or RetryAfter outside MessageError", where)
+	}
+	if msg.Type != agentrun.MessageSystem && msg.Type != agentrun.MessageError && msg.RateLimit != nil {
+		t.Errorf("%s: RateLimit outside MessageSystem or MessageError", where)
+	}
+	if in := msg.Init; in != nil && in.Model == "" && in.AgentName == "" && in.AgentVersion == "" && in.Engine == "" {
+		t.Errorf("%s: non-nil Init without data", where)
+	}
+}
+
+func checkUsage(t *testing.T, where string, u *agentrun.Usage) {
+	t.Helper()
+	if *u == (agentrun.Usage{}) {
+		t.Errorf("%s: non-nil Usage without data", where)
+	}
+	counts := map[string]int{
+		"InputTokens":       u.InputTokens,
+		"OutputTokens":      u.OutputTokens,
+		"CacheReadTokens":   u.CacheReadTokens,
+		"CacheWriteTokens":  u.CacheWriteTokens,
+		"ThinkingTokens":    u.ThinkingTokens,
+		"ContextSizeTokens": u.ContextSizeTokens,
+		"ContextUsedTokens": u.ContextUsedTokens,
+	}
+	for name, n := range counts {
+		if n < 0 {
+			t.Errorf("%s: Usage.%s = %d, want >= 0", where, name, n)
+		}
+	}
+	if u.CostUSD < 0 || math.IsNaN(u.CostUSD) || math.IsInf(u.CostUSD, 0) {
+		t.Errorf("%s: Usage.CostUSD = %v, want finite >= 0", where, u.CostUSD)
+	}
+	if u.ContextSizeTokens > 0 && u.ContextUsedTokens > u.ContextSizeTokens {
+		t.Errorf("%s: Usage.ContextUsedTokens %d exceeds ContextSizeTokens %d",
+			where, u.ContextUsedTokens, u.ContextSizeTokens)
+	}
+}
+
+// formatGolden renders turns as one JSON object per message, with a blank
+// line between turns. Timestamp and Raw are dropped: the first varies per
+// run and the second repeats the fixture line.
+func formatGolden(turns [][]agentrun.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, turn := range turns {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		for _, msg := range turn {
+			msg.Raw = nil
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return nil, err
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(data, &fields); err != nil {
+				return nil, err
+			}
+			delete(fields, "timestamp")
+			data, err = json.Marshal(fields) // map keys marshal sorted
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// lineDiff returns the lines that differ between want and got, prefixed
+// with their line number.
+func lineDiff(want, got string) string {
+	w := strings.Split(want, "\n")
+	g := strings.Split(got, "\n")
+	var b strings.Builder
+	for i := range max(len(w), len(g)) {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "line %d:\n  want: %s\n  got:  %s\n", i+1, wl, gl)
+		}
+	}
+	return b.String()
+}
@@ -1,7 +1,31 @@
 // Package enginetest provides compliance test suites for agentrun implementations.
 //
-// CLI backend compliance tests live in the clitest sub-package.
-// Root-level Engine/Process compliance is planned for a future release.
+// Test authors call [RunEngineTests] with a [Factory] that returns the
+// [agentrun.Engine] under test and a Session to start on it. The suite
+// drives the lifecycle contracts documented on [agentrun.Process]: RunTurn
+// correctness, Stop idempotent and blocking, Send after Stop returning
+// [agentrun.ErrTerminated], Err stable once Output is closed, no goroutine
+// leaks, and concurrent use under the race detector.
 //
-// See enginetest/clitest for usage examples.
+// Example usage in an engine test file:
+//
+//	package myengine_test
+//
+//	import (
+//	    "testing"
+//	    "github.com/dmora/agentrun"
+//	    "github.com/dmora/agentrun/engine/myengine"
+//	    "github.com/dmora/agentrun/enginetest"
+//	)
+//
+//	func TestCompliance(t *testing.T) {
+//	    enginetest.RunEngineTests(t, func(t *testing.T) (agentrun.Engine, agentrun.Session) {
+//	        return myengine.NewEngine(), agentrun.Session{CWD: t.TempDir()}
+//	    })
+//	}
+//
+// CLI backend compliance tests live in the clitest sub-package. The fake
+// sub-package provides a scripted in-memory Engine for unit-testing code
+// built on agentrun, and the chaos sub-package wraps any Engine or Process
+// with seeded fault injection for resilience tests.
 package enginetest
@@ -0,0 +1,406 @@
+package enginetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+const (
+	// suiteTimeout bounds each subtest's context.
+	suiteTimeout = 10 * time.Second
+
+	// settleTimeout bounds operations that must complete promptly once the
+	// session has ended: Wait after Stop, draining a closed Output, a
+	// repeated Stop.
+	settleTimeout = 2 * time.Second
+
+	// stressSessions is the number of concurrent sessions in the Stress suite.
+	stressSessions = 4
+)
+
+// Factory returns the [agentrun.Engine] under test and the Session to start
+// on it. It is called once per subtest so engines may hold per-test state
+// (fake servers, temp dirs) registered with t.Cleanup.
+//
+// Start(session) must not begin a turn on its own: it may emit MessageInit,
+// but the first MessageResult must follow a Send. Every Send must produce a
+// turn that ends with MessageResult. Output may stay open between turns or,
+// for resume-per-turn engines ([agentrun.Resumable]), close after each turn
+// and be replaced by the next Send; the suite calls Output again for every
+// turn.
+type Factory func(t *testing.T) (agentrun.Engine, agentrun.Session)
+
+// RunEngineTests runs all lifecycle compliance suites for an
+// [agentrun.Engine] and the [agentrun.Process] handles it returns.
+//
+// The goroutine leak check compares snapshots of all goroutines in the test
+// binary, so RunEngineTests must not run in parallel with other tests.
+func RunEngineTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("RunTurn", func(t *testing.T) { RunTurnTests(t, factory) })
+	t.Run("Stop", func(t *testing.T) { RunStopTests(t, factory) })
+	t.Run("Err", func(t *testing.T) { RunErrTests(t, factory) })
+	t.Run("Leak", func(t *testing.T) { RunLeakTests(t, factory) })
+	t.Run("Stress", func(t *testing.T) { RunStressTests(t, factory) })
+}
+
+// RunTurnTests tests [agentrun.RunTurn] against the engine: each turn
+// returns nil and ends with exactly one MessageResult.
+func RunTurnTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("SingleTurn", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		checkTurn(ctx, t, proc, "hello")
+	})
+
+	t.Run("MultiTurn", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		checkTurn(ctx, t, proc, "first")
+		checkTurn(ctx, t, proc, "second")
+	})
+
+	t.Run("HandlerErrorStopsDrain", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		errHandler := errors.New("enginetest: handler stop")
+		err := agentrun.RunTurn(ctx, proc, "hello", func(agentrun.Message) error {
+			return errHandler
+		})
+		if !errors.Is(err, errHandler) {
+			t.Errorf("RunTurn error = %v, want handler error", err)
+		}
+	})
+}
+
+// RunStopTests tests the Stop contract: idempotent, blocking until the
+// session has ended, and terminal for Send.
+func RunStopTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("Blocking", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		_ = proc.Stop(ctx)
+		drainWithin(t, proc, settleTimeout)
+		waitWithin(t, proc, settleTimeout)
+	})
+
+	t.Run("Idempotent", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		first := proc.Stop(ctx)
+
+		second := make(chan error, 1)
+		go func() { second <- proc.Stop(ctx) }()
+		select {
+		case err := <-second:
+			if !sameErr(first, err) {
+				t.Errorf("second Stop = %v, want %v", err, first)
+			}
+		case <-time.After(settleTimeout):
+			t.Fatal("second Stop did not return")
+		}
+	})
+
+	t.Run("AfterTurn", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		checkTurn(ctx, t, proc, "hello")
+		_ = proc.Stop(ctx)
+		drainWithin(t, proc, settleTimeout)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		errs := make([]error, stressSessions)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = proc.Stop(ctx)
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs[1:] {
+			if !sameErr(errs[0], err) {
+				t.Errorf("Stop[%d] = %v, Stop[0] = %v; want equal", i+1, err, errs[0])
+			}
+		}
+	})
+
+	t.Run("SendAfterStop", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		_ = proc.Stop(ctx)
+		if err := proc.Send(ctx, "hello"); !errors.Is(err, agentrun.ErrTerminated) {
+			t.Errorf("Send after Stop = %v, want ErrTerminated", err)
+		}
+	})
+
+	t.Run("SendAfterStopAfterTurn", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		checkTurn(ctx, t, proc, "hello")
+		_ = proc.Stop(ctx)
+		if err := proc.Send(ctx, "again"); !errors.Is(err, agentrun.ErrTerminated) {
+			t.Errorf("Send after Stop = %v, want ErrTerminated", err)
+		}
+		if agentrun.Resumable(proc) {
+			t.Error("Resumable after Stop = true, want false")
+		}
+	})
+}
+
+// RunErrTests tests that the terminal error is stable once Output is
+// closed: Err returns the same value on every call and matches Wait and
+// Stop.
+func RunErrTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("StableAfterOutputClosed", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		checkTurn(ctx, t, proc, "hello")
+
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for range proc.Output() { //nolint:revive // drain until close
+			}
+		}()
+		stopErr := proc.Stop(ctx)
+		select {
+		case <-drained:
+		case <-time.After(settleTimeout):
+			t.Fatal("Output not closed after Stop")
+		}
+
+		first := proc.Err()
+		for range 3 {
+			if err := proc.Err(); !sameErr(first, err) {
+				t.Fatalf("Err changed after Output closed: %v, then %v", first, err)
+			}
+		}
+		if waitErr := waitWithin(t, proc, settleTimeout); !sameErr(first, waitErr) {
+			t.Errorf("Wait = %v, Err = %v; want equal", waitErr, first)
+		}
+		if !sameErr(first, stopErr) {
+			t.Errorf("Stop = %v, Err = %v; want equal", stopErr, first)
+		}
+	})
+
+	t.Run("TerminatedOrClean", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+		checkTurn(ctx, t, proc, "hello")
+		_ = proc.Stop(ctx)
+		drainWithin(t, proc, settleTimeout)
+		// User-initiated stops produce ErrTerminated, never ExitError.
+		if _, ok := agentrun.ExitCode(proc.Err()); ok {
+			t.Errorf("Err after Stop = %v, want nil or ErrTerminated", proc.Err())
+		}
+	})
+}
+
+// RunLeakTests tests that a full session lifecycle leaves no goroutines
+// behind once Stop returns and Output is drained.
+func RunLeakTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		eng, session := factory(t)
+		before := goroutines()
+
+		func() {
+			ctx, cancel := context.WithTimeout(context.Background(), suiteTimeout)
+			defer cancel()
+			proc, err := eng.Start(ctx, session)
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			checkTurn(ctx, t, proc, "hello")
+			_ = proc.Stop(ctx)
+			drainWithin(t, proc, settleTimeout)
+		}()
+
+		checkNoLeak(t, before, settleTimeout)
+	})
+
+	t.Run("StopWithoutTurn", func(t *testing.T) {
+		eng, session := factory(t)
+		before := goroutines()
+
+		func() {
+			ctx, cancel := context.WithTimeout(context.Background(), suiteTimeout)
+			defer cancel()
+			proc, err := eng.Start(ctx, session)
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			_ = proc.Stop(ctx)
+			drainWithin(t, proc, settleTimeout)
+		}()
+
+		checkNoLeak(t, before, settleTimeout)
+	})
+}
+
+// RunStressTests exercises concurrent use for the race detector: several
+// sessions on one Engine, and concurrent Output/Err/Stop calls on one
+// Process. Run with -race for full value.
+func RunStressTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	t.Run("ConcurrentSessions", func(t *testing.T) {
+		eng, session := factory(t)
+		ctx := suiteCtx(t)
+		var wg sync.WaitGroup
+		for range stressSessions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				proc, err := eng.Start(ctx, session)
+				if err != nil {
+					t.Errorf("Start: %v", err)
+					return
+				}
+				defer func() { _ = proc.Stop(context.Background()) }()
+				for _, msg := range []string{"first", "second"} {
+					if err := agentrun.RunTurn(ctx, proc, msg, func(agentrun.Message) error { return nil }); err != nil {
+						t.Errorf("RunTurn(%q): %v", msg, err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("ConcurrentAccessors", func(t *testing.T) {
+		ctx := suiteCtx(t)
+		proc := start(ctx, t, factory)
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for range stressSessions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						_ = proc.Output()
+						_ = proc.Err()
+					}
+				}
+			}()
+		}
+
+		if err := agentrun.RunTurn(ctx, proc, "hello", func(agentrun.Message) error { return nil }); err != nil {
+			t.Errorf("RunTurn: %v", err)
+		}
+		_ = proc.Stop(ctx)
+		close(stop)
+		wg.Wait()
+		drainWithin(t, proc, settleTimeout)
+	})
+}
+
+// --- helpers ---
+
+func suiteCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), suiteTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// start creates an engine from factory and starts its session. The process
+// is stopped on cleanup.
+func start(ctx context.Context, t *testing.T, factory Factory) agentrun.Process {
+	t.Helper()
+	eng, session := factory(t)
+	proc, err := eng.Start(ctx, session)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc
+}
+
+// checkTurn runs one turn and checks it ends with exactly one MessageResult.
+func checkTurn(ctx context.Context, t *testing.T, proc agentrun.Process, message string) {
+	t.Helper()
+	var msgs []agentrun.Message
+	err := agentrun.RunTurn(ctx, proc, message, func(m agentrun.Message) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunTurn(%q): %v", message, err)
+	}
+	results := 0
+	for _, m := range msgs {
+		if m.Type == agentrun.MessageResult {
+			results++
+		}
+	}
+	if results != 1 {
+		t.Fatalf("RunTurn(%q) saw %d MessageResult, want 1", message, results)
+	}
+	if last := msgs[len(msgs)-1]; last.Type != agentrun.MessageResult {
+		t.Fatalf("RunTurn(%q) last message = %q, want %q", message, last.Type, agentrun.MessageResult)
+	}
+}
+
+// drainWithin drains Output and fails if it is not closed within d.
+func drainWithin(t *testing.T, proc agentrun.Process, d time.Duration) {
+	t.Helper()
+	timeout := time.After(d)
+	for {
+		select {
+		case _, ok := <-proc.Output():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Output not closed within %v", d)
+		}
+	}
+}
+
+// waitWithin calls Wait and fails if it does not return within d.
+func waitWithin(t *testing.T, proc agentrun.Process, d time.Duration) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- proc.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		t.Fatalf("Wait did not return within %v", d)
+		return nil
+	}
+}
+
+// sameErr reports whether a and b are both nil or have the same message.
+// Terminal errors may be non-comparable types, so == is not safe.
+func sameErr(a, b error) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Error() == b.Error()
+}
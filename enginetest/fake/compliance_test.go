@@ -0,0 +1,27 @@
+package fake_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+	"github.com/dmora/agentrun/enginetest/fake"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		return fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok"))), agentrun.Session{}
+	})
+}
+
+func TestCompliance_ResumePerTurn(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		return fake.NewEngine(fake.WithResumePerTurn(), fake.WithDefaultTurn(fake.TextTurn("ok"))), agentrun.Session{}
+	})
+}
+
+func TestCompliance_Blocking(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		return fake.NewEngine(fake.WithDefaultTurn(fake.BlockingTextTurn("ok"))), agentrun.Session{}
+	})
+}
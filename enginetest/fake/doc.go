@@ -0,0 +1,27 @@
+// Package fake provides a programmable in-memory [agentrun.Engine] for
+// unit-testing code built on agentrun, without subprocesses or network.
+//
+// Each Send consumes the next scripted [Turn]: the messages it emits (with
+// optional delays), a Send error, whether Send blocks until the turn is
+// emitted (like ACP and API engines) or returns at once (like CLI
+// streaming), and whether the process ends abruptly afterwards.
+// [WithResumePerTurn] closes Output after every turn, like spawn-per-turn
+// CLI engines, so wrappers can be tested against [agentrun.Resumable]
+// processes. The
+// Process follows the [agentrun.Process] contract — Stop is idempotent and
+// blocking, Send after Stop returns [agentrun.ErrTerminated], Err is stable
+// once Output is closed — so [agentrun.RunTurn] and the filter package
+// work against it unchanged.
+//
+// Engines and processes record what they were asked to do for assertions:
+//
+//	eng := fake.NewEngine(fake.WithTurns(
+//	    fake.TextTurn("hello"),
+//	    fake.Turn{End: true, EndErr: &agentrun.ExitError{Code: 1}},
+//	))
+//	runOrchestrator(ctx, eng) // code under test
+//
+//	proc := eng.Processes()[0]
+//	if got := proc.Sent(); !slices.Equal(got, []string{"plan", "build"}) { … }
+//	if !proc.Stopped() { … }
+package fake
@@ -0,0 +1,94 @@
+package fake
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// Engine is a scripted in-memory agentrun.Engine. Every Start returns a
+// new *Process driven by the engine's turn script.
+type Engine struct {
+	opts Options
+
+	mu     sync.Mutex
+	starts []agentrun.Session
+	procs  []*Process
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine creates a fake engine. Use Option functions to script turns
+// and failures.
+func NewEngine(opts ...Option) *Engine {
+	o := Options{
+		Init: []agentrun.Message{{
+			Type:     agentrun.MessageInit,
+			ResumeID: "fake-session",
+			Init:     &agentrun.InitMeta{AgentName: "fake"},
+		}},
+		OutputBuffer: defaultOutputBuffer,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Engine{opts: o}
+}
+
+// Start records the session and returns a running *Process. Start
+// options override Session fields as in real engines. A non-empty Prompt
+// is sent as the first message, consuming the first turn.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	startOpts := agentrun.ResolveOptions(opts...)
+	session = session.Clone()
+	if startOpts.Prompt != "" {
+		session.Prompt = startOpts.Prompt
+	}
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+
+	e.mu.Lock()
+	e.starts = append(e.starts, session)
+	e.mu.Unlock()
+	if e.opts.StartErr != nil {
+		return nil, e.opts.StartErr
+	}
+
+	p := newProcess(e.opts)
+	if session.Prompt != "" {
+		if err := p.send(ctx, session.Prompt, false); err != nil {
+			_ = p.Stop(ctx)
+			return nil, err
+		}
+	}
+
+	e.mu.Lock()
+	e.procs = append(e.procs, p)
+	e.mu.Unlock()
+	return p, nil
+}
+
+// Validate returns the error set by WithValidateError, or nil.
+func (e *Engine) Validate() error {
+	return e.opts.ValidateErr
+}
+
+// Starts returns the sessions passed to Start, in order, after start
+// options were applied. Failed starts are included.
+func (e *Engine) Starts() []agentrun.Session {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]agentrun.Session(nil), e.starts...)
+}
+
+// Processes returns the processes created by successful Starts, in order.
+func (e *Engine) Processes() []*Process {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Process(nil), e.procs...)
+}
@@ -0,0 +1,93 @@
+package fake
+
+import "github.com/dmora/agentrun"
+
+// Default engine configuration values.
+const defaultOutputBuffer = 64
+
+// Options holds resolved construction-time configuration for an Engine.
+type Options struct {
+	// Init is emitted on Output when a process starts. The default is a
+	// single MessageInit with ResumeID "fake-session".
+	Init []agentrun.Message
+
+	// Turns are consumed in order, one per Send, by every started process.
+	Turns []Turn
+
+	// DefaultTurn, when non-nil, answers every Send after Turns run out.
+	// Without it such a Send returns ErrNoTurn.
+	DefaultTurn *Turn
+
+	// StartErr is returned by Engine.Start when non-nil.
+	StartErr error
+
+	// ValidateErr is returned by Engine.Validate.
+	ValidateErr error
+
+	// OutputBuffer is the channel buffer size for process output messages.
+	OutputBuffer int
+
+	// ResumePerTurn makes processes behave like spawn-per-turn CLI
+	// engines: Output closes after every turn and the next Send opens a
+	// new channel, and the process reports agentrun.Resumable.
+	ResumePerTurn bool
+}
+
+// Option configures an Engine at construction time.
+type Option func(*Options)
+
+// WithInit replaces the messages emitted when a process starts. Call with
+// no arguments to emit nothing.
+func WithInit(msgs ...agentrun.Message) Option {
+	return func(o *Options) {
+		o.Init = msgs
+	}
+}
+
+// WithTurns appends scripted turns, consumed in order, one per Send.
+func WithTurns(turns ...Turn) Option {
+	return func(o *Options) {
+		o.Turns = append(o.Turns, turns...)
+	}
+}
+
+// WithDefaultTurn sets the turn that answers every Send once the scripted
+// turns run out.
+func WithDefaultTurn(t Turn) Option {
+	return func(o *Options) {
+		o.DefaultTurn = &t
+	}
+}
+
+// WithStartError makes Engine.Start fail with err.
+func WithStartError(err error) Option {
+	return func(o *Options) {
+		o.StartErr = err
+	}
+}
+
+// WithValidateError makes Engine.Validate return err.
+func WithValidateError(err error) Option {
+	return func(o *Options) {
+		o.ValidateErr = err
+	}
+}
+
+// WithResumePerTurn makes Output close after every turn, with the next
+// Send opening a new channel, and the process report
+// [agentrun.Resumable] until it ends — like spawn-per-turn CLI engines.
+func WithResumePerTurn() Option {
+	return func(o *Options) {
+		o.ResumePerTurn = true
+	}
+}
+
+// WithOutputBuffer sets the output channel buffer size (default 64).
+// Zero makes Output unbuffered, so every message waits for the consumer.
+func WithOutputBuffer(size int) Option {
+	return func(o *Options) {
+		if size >= 0 {
+			o.OutputBuffer = size
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// Call method names recorded by Process.
+const (
+	MethodSend = "Send"
+	MethodStop = "Stop"
+)
+
+// Call records one Send or Stop call on a Process.
+type Call struct {
+	Method  string    // MethodSend or MethodStop
+	Message string    // Send message; empty for Stop
+	Time    time.Time // when the call was made
+}
+
+// Process is a scripted agentrun.Process created by Engine.Start.
+//
+// Turns play one at a time, in Send order, on a chain of goroutines: each
+// waits for the previous turn before emitting, so only one goroutine
+// writes to Output at a time.
+type Process struct {
+	opts Options
+
+	done chan struct{}
+	stop chan struct{}
+
+	mu       sync.Mutex // guards the fields below
+	output   chan agentrun.Message
+	closed   bool // output is closed
+	inTurn   int  // turns queued on output; ResumePerTurn closes it at zero
+	calls    []Call
+	next     int           // index of the next scripted turn
+	last     chan struct{} // closed when the most recently queued turn has played
+	stopping bool
+	wg       sync.WaitGroup // turn goroutines; Add under mu while !stopping
+
+	termErr    error
+	stopOnce   sync.Once
+	finishOnce sync.Once
+}
+
+var _ agentrun.Process = (*Process)(nil)
+
+// request is one queued turn, emitted on out. err is set before done
+// closes when the turn was cut short.
+type request struct {
+	turn Turn
+	out  chan agentrun.Message
+	send bool // queued by Send, not the start messages
+	done chan struct{}
+	err  error
+}
+
+func newProcess(opts Options) *Process {
+	p := &Process{
+		opts:   opts,
+		output: make(chan agentrun.Message, opts.OutputBuffer),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	p.enqueue(&request{turn: Turn{Messages: opts.Init}, out: p.output, done: make(chan struct{})})
+	return p
+}
+
+// Output returns the channel for receiving messages from the agent. With
+// WithResumePerTurn it is the current turn's channel.
+func (p *Process) Output() <-chan agentrun.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.output
+}
+
+// Send plays the next scripted turn. It returns the turn's SendErr, or
+// ErrNoTurn when the script is exhausted. Blocking turns wait until their
+// messages have been consumed from Output; the caller must drain Output
+// concurrently.
+func (p *Process) Send(ctx context.Context, message string) error {
+	return p.send(ctx, message, true)
+}
+
+// send queues the next turn. block=false never waits, even for blocking
+// turns; Start uses it for the session prompt, before anyone drains Output.
+func (p *Process) send(ctx context.Context, message string, block bool) error {
+	p.mu.Lock()
+	p.calls = append(p.calls, Call{Method: MethodSend, Message: message, Time: time.Now()})
+	if p.stopping || p.ended() {
+		p.mu.Unlock()
+		return agentrun.ErrTerminated
+	}
+	turn, ok := p.nextTurn()
+	if !ok {
+		p.mu.Unlock()
+		return ErrNoTurn
+	}
+	if turn.SendErr != nil {
+		p.mu.Unlock()
+		return turn.SendErr
+	}
+	if p.closed {
+		// ResumePerTurn: the previous turn closed Output.
+		p.output = make(chan agentrun.Message, p.opts.OutputBuffer)
+		p.closed = false
+	}
+	p.inTurn++
+	req := &request{turn: turn, out: p.output, send: true, done: make(chan struct{})}
+	p.enqueueLocked(req)
+	p.mu.Unlock()
+
+	if !block || !turn.Block {
+		return nil
+	}
+	select {
+	case <-req.done:
+		return req.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nextTurn returns the next scripted turn, falling back to the default
+// turn. Must hold mu.
+func (p *Process) nextTurn() (Turn, bool) {
+	if p.next < len(p.opts.Turns) {
+		p.next++
+		return p.opts.Turns[p.next-1], true
+	}
+	if p.opts.DefaultTurn != nil {
+		return *p.opts.DefaultTurn, true
+	}
+	return Turn{}, false
+}
+
+func (p *Process) enqueue(req *request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enqueueLocked(req)
+}
+
+// enqueueLocked chains req after the last queued turn. Must hold mu with
+// stopping false.
+func (p *Process) enqueueLocked(req *request) {
+	prev := p.last
+	link := make(chan struct{})
+	p.last = link
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(link)
+		if prev != nil {
+			<-prev
+		}
+		p.play(req)
+	}()
+}
+
+// play emits req's messages and, for End turns, finishes the process.
+// With ResumePerTurn, the last turn queued on Output closes it.
+func (p *Process) play(req *request) {
+	if p.ended() {
+		req.err = agentrun.ErrTerminated
+		close(req.done)
+		return
+	}
+	for _, msg := range req.turn.Messages {
+		if !p.wait(req.turn.Delay) || !p.emit(req.out, msg) {
+			req.err = agentrun.ErrTerminated
+			close(req.done)
+			return
+		}
+	}
+	close(req.done)
+	if req.turn.End {
+		p.finish(req.turn.EndErr)
+		return
+	}
+	if req.send {
+		p.endTurn()
+	}
+}
+
+// endTurn counts a played turn off Output and, with ResumePerTurn,
+// closes Output when no other turn is queued on it.
+func (p *Process) endTurn() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inTurn--
+	if p.opts.ResumePerTurn && p.inTurn == 0 && !p.closed {
+		close(p.output)
+		p.closed = true
+	}
+}
+
+// wait sleeps for d. Returns false if Stop was called first.
+func (p *Process) wait(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// emit sends msg on out. Returns false if Stop was called first.
+func (p *Process) emit(out chan<- agentrun.Message, msg agentrun.Message) bool {
+	select {
+	case out <- stamp(msg):
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// Stop terminates the session: in-flight and queued turns are abandoned
+// and the process ends with ErrTerminated unless it already ended.
+// Idempotent; blocks until Output is closed.
+func (p *Process) Stop(context.Context) error {
+	p.mu.Lock()
+	p.calls = append(p.calls, Call{Method: MethodStop, Time: time.Now()})
+	p.mu.Unlock()
+
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopping = true
+		p.mu.Unlock()
+		close(p.stop)
+		p.wg.Wait()
+		p.finish(agentrun.ErrTerminated)
+	})
+	<-p.done
+	return p.termErr
+}
+
+// Resumable reports whether a Send may follow Output closing: true with
+// WithResumePerTurn until the process ends or Stop is called.
+func (p *Process) Resumable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.opts.ResumePerTurn && !p.stopping && !p.ended()
+}
+
+// Wait blocks until the session ends.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *Process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// finish sets the terminal error and closes done, then output, so Err is
+// stable by the time a consumer sees Output closed. Only the goroutine
+// that plays an End turn, or Stop after all turn goroutines exited, calls
+// it — never while a message is being emitted.
+func (p *Process) finish(err error) {
+	p.finishOnce.Do(func() {
+		p.termErr = err
+		close(p.done)
+		p.mu.Lock()
+		if !p.closed {
+			close(p.output)
+			p.closed = true
+		}
+		p.mu.Unlock()
+	})
+}
+
+func (p *Process) ended() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Calls returns every Send and Stop call made so far, in order, including
+// calls that failed.
+func (p *Process) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Call(nil), p.calls...)
+}
+
+// Sent returns the messages passed to Send, in order.
+func (p *Process) Sent() []string {
+	var sent []string
+	for _, c := range p.Calls() {
+		if c.Method == MethodSend {
+			sent = append(sent, c.Message)
+		}
+	}
+	return sent
+}
+
+// Stopped reports whether Stop has been called.
+func (p *Process) Stopped() bool {
+	for _, c := range p.Calls() {
+		if c.Method == MethodStop {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package fake_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/filter"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func start(t *testing.T, eng *fake.Engine, session agentrun.Session) agentrun.Process {
+	t.Helper()
+	proc, err := eng.Start(testCtx(t), session)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc
+}
+
+// runTurn runs one turn and returns the messages it produced.
+func runTurn(ctx context.Context, t *testing.T, proc agentrun.Process, message string) ([]agentrun.Message, error) {
+	t.Helper()
+	var msgs []agentrun.Message
+	err := agentrun.RunTurn(ctx, proc, message, func(m agentrun.Message) error {
+		msgs = append(msgs, m)
+		return nil
+	})
+	return msgs, err
+}
+
+func types(msgs []agentrun.Message) []agentrun.MessageType {
+	out := make([]agentrun.MessageType, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, m.Type)
+	}
+	return out
+}
+
+func TestProcess_ScriptedTurns(t *testing.T) {
+	eng := fake.NewEngine(fake.WithTurns(fake.TextTurn("one"), fake.BlockingTextTurn("two")))
+	proc := start(t, eng, agentrun.Session{})
+	ctx := testCtx(t)
+
+	first, err := runTurn(ctx, t, proc, "a")
+	if err != nil {
+		t.Fatalf("turn 1: %v", err)
+	}
+	want := []agentrun.MessageType{agentrun.MessageInit, agentrun.MessageText, agentrun.MessageResult}
+	if got := types(first); !slices.Equal(got, want) {
+		t.Errorf("turn 1 types = %v, want %v", got, want)
+	}
+	if first[1].Content != "one" || first[1].Timestamp.IsZero() {
+		t.Errorf("turn 1 text = %+v, want content one with timestamp", first[1])
+	}
+
+	second, err := runTurn(ctx, t, proc, "b")
+	if err != nil {
+		t.Fatalf("turn 2: %v", err)
+	}
+	if second[0].Content != "two" {
+		t.Errorf("turn 2 text = %q, want two", second[0].Content)
+	}
+
+	if err := proc.Send(ctx, "c"); !errors.Is(err, fake.ErrNoTurn) {
+		t.Errorf("Send past script = %v, want ErrNoTurn", err)
+	}
+	if got := eng.Processes()[0].Sent(); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("Sent = %q, want [a b c]", got)
+	}
+}
+
+func TestProcess_SendErr(t *testing.T) {
+	errBoom := errors.New("boom")
+	eng := fake.NewEngine(fake.WithTurns(fake.Turn{SendErr: errBoom}, fake.TextTurn("ok")))
+	proc := start(t, eng, agentrun.Session{})
+	ctx := testCtx(t)
+
+	if _, err := runTurn(ctx, t, proc, "a"); !errors.Is(err, errBoom) {
+		t.Errorf("turn 1 = %v, want boom", err)
+	}
+	if _, err := runTurn(ctx, t, proc, "b"); err != nil {
+		t.Errorf("turn 2 after SendErr = %v, want nil", err)
+	}
+}
+
+func TestProcess_BlockingSendWaitsForDrain(t *testing.T) {
+	eng := fake.NewEngine(fake.WithInit(), fake.WithOutputBuffer(0),
+		fake.WithTurns(fake.BlockingTextTurn("hi")))
+	proc := start(t, eng, agentrun.Session{})
+	ctx := testCtx(t)
+
+	sent := make(chan error, 1)
+	go func() { sent <- proc.Send(ctx, "a") }()
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v before Output was drained", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	<-proc.Output()
+	<-proc.Output()
+	if err := <-sent; err != nil {
+		t.Errorf("Send = %v, want nil", err)
+	}
+}
+
+func TestProcess_EndSimulatesCrash(t *testing.T) {
+	crash := &agentrun.ExitError{Code: 137}
+	eng := fake.NewEngine(fake.WithTurns(fake.Turn{
+		Messages: []agentrun.Message{{Type: agentrun.MessageText, Content: "partial"}},
+		End:      true,
+		EndErr:   crash,
+	}))
+	proc := start(t, eng, agentrun.Session{})
+	ctx := testCtx(t)
+
+	msgs, err := runTurn(ctx, t, proc, "a")
+	if code, ok := agentrun.ExitCode(err); !ok || code != 137 {
+		t.Errorf("RunTurn = %v, want exit 137", err)
+	}
+	if got := types(msgs); !slices.Contains(got, agentrun.MessageText) {
+		t.Errorf("types = %v, want partial text before crash", got)
+	}
+	if !errors.Is(proc.Wait(), crash) || !errors.Is(proc.Stop(ctx), crash) {
+		t.Errorf("Wait/Stop after crash = %v/%v, want crash error", proc.Wait(), proc.Stop(ctx))
+	}
+	if err := proc.Send(ctx, "b"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send after crash = %v, want ErrTerminated", err)
+	}
+}
+
+func TestProcess_StopDuringDelay(t *testing.T) {
+	eng := fake.NewEngine(fake.WithTurns(fake.Turn{
+		Messages: fake.TextTurn("slow").Messages,
+		Delay:    time.Hour,
+		Block:    true,
+	}))
+	proc := start(t, eng, agentrun.Session{})
+	ctx := testCtx(t)
+
+	sent := make(chan error, 1)
+	go func() { sent <- proc.Send(ctx, "a") }()
+	time.Sleep(20 * time.Millisecond)
+	if err := proc.Stop(ctx); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+	if err := <-sent; !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("blocked Send = %v, want ErrTerminated", err)
+	}
+
+	calls := eng.Processes()[0].Calls()
+	if len(calls) != 2 || calls[0].Method != fake.MethodSend || calls[1].Method != fake.MethodStop {
+		t.Fatalf("calls = %+v, want Send then Stop", calls)
+	}
+	if calls[1].Time.Before(calls[0].Time) {
+		t.Errorf("Stop time %v before Send time %v", calls[1].Time, calls[0].Time)
+	}
+	if !eng.Processes()[0].Stopped() {
+		t.Error("Stopped() = false after Stop")
+	}
+}
+
+func TestProcess_ResumePerTurn(t *testing.T) {
+	eng := fake.NewEngine(fake.WithResumePerTurn(), fake.WithDefaultTurn(fake.TextTurn("ok")))
+	proc := start(t, eng, agentrun.Session{})
+	ctx := testCtx(t)
+
+	for _, prompt := range []string{"one", "two"} {
+		if _, err := runTurn(ctx, t, proc, prompt); err != nil {
+			t.Fatalf("RunTurn(%s): %v", prompt, err)
+		}
+		select {
+		case _, ok := <-proc.Output():
+			if ok {
+				t.Fatalf("%s: message after MessageResult, want Output closed", prompt)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%s: Output still open after the turn", prompt)
+		}
+		if !agentrun.Resumable(proc) || proc.Err() != nil {
+			t.Fatalf("%s: Resumable = false or Err = %v between turns", prompt, proc.Err())
+		}
+	}
+
+	if err := proc.Stop(ctx); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Stop = %v, want ErrTerminated", err)
+	}
+	if agentrun.Resumable(proc) {
+		t.Error("Resumable after Stop = true, want false")
+	}
+}
+
+func TestEngine_StartPromptConsumesFirstTurn(t *testing.T) {
+	eng := fake.NewEngine(fake.WithTurns(fake.BlockingTextTurn("from prompt"), fake.TextTurn("from send")))
+	proc, err := eng.Start(testCtx(t), agentrun.Session{Model: "m1"},
+		agentrun.WithPrompt("hello"), agentrun.WithModel("m2"))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = proc.Stop(context.Background()) }()
+
+	var texts []string
+	for msg := range filter.Filter(testCtx(t), proc.Output(), agentrun.MessageText, agentrun.MessageResult) {
+		if msg.Type == agentrun.MessageResult {
+			break
+		}
+		texts = append(texts, msg.Content)
+	}
+	if !slices.Equal(texts, []string{"from prompt"}) {
+		t.Errorf("texts = %q, want [from prompt]", texts)
+	}
+
+	starts := eng.Starts()
+	if len(starts) != 1 || starts[0].Prompt != "hello" || starts[0].Model != "m2" {
+		t.Errorf("Starts = %+v, want prompt hello and model m2", starts)
+	}
+	if got := eng.Processes()[0].Sent(); !slices.Equal(got, []string{"hello"}) {
+		t.Errorf("Sent = %q, want [hello]", got)
+	}
+}
+
+func TestEngine_Errors(t *testing.T) {
+	errStart := errors.New("no agent")
+	errValidate := errors.New("not installed")
+	eng := fake.NewEngine(fake.WithStartError(errStart), fake.WithValidateError(errValidate))
+
+	if err := eng.Validate(); !errors.Is(err, errValidate) {
+		t.Errorf("Validate = %v, want %v", err, errValidate)
+	}
+	if _, err := eng.Start(testCtx(t), agentrun.Session{}); !errors.Is(err, errStart) {
+		t.Errorf("Start = %v, want %v", err, errStart)
+	}
+	if len(eng.Starts()) != 1 || len(eng.Processes()) != 0 {
+		t.Errorf("Starts = %d, Processes = %d; want 1, 0", len(eng.Starts()), len(eng.Processes()))
+	}
+}
@@ -0,0 +1,62 @@
+package fake
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// ErrNoTurn is returned by Send when the scripted turns are exhausted and
+// no default turn is set.
+var ErrNoTurn = errors.New("fake: no scripted turn left")
+
+// Turn scripts the process response to one Send.
+type Turn struct {
+	// Messages are emitted on Output in order. Zero Timestamps are set
+	// at emit time. Include a MessageResult to complete the turn for
+	// RunTurn; TextTurn does so.
+	Messages []agentrun.Message
+
+	// Delay is waited before each message.
+	Delay time.Duration
+
+	// SendErr, when non-nil, is returned by Send and nothing is emitted.
+	// The turn is consumed and the process stays usable.
+	SendErr error
+
+	// Block makes Send wait until every message has been consumed from
+	// Output, like ACP and API engines. Otherwise Send returns as soon as
+	// the turn is queued, like CLI streaming engines.
+	Block bool
+
+	// End terminates the process after Messages are emitted: Output
+	// closes and Err and Wait return EndErr (nil for a clean exit).
+	// Use it to simulate crashes, e.g. EndErr: &agentrun.ExitError{Code: 1}.
+	End    bool
+	EndErr error
+}
+
+// TextTurn returns a turn that emits text as MessageText followed by a
+// MessageResult with StopEndTurn.
+func TextTurn(text string) Turn {
+	return Turn{Messages: []agentrun.Message{
+		{Type: agentrun.MessageText, Content: text},
+		{Type: agentrun.MessageResult, StopReason: agentrun.StopEndTurn},
+	}}
+}
+
+// BlockingTextTurn is TextTurn with Block set.
+func BlockingTextTurn(text string) Turn {
+	t := TextTurn(text)
+	t.Block = true
+	return t
+}
+
+// stamp returns msg with Timestamp set to now when zero.
+func stamp(msg agentrun.Message) agentrun.Message {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	return msg
+}
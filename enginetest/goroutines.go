@@ -0,0 +1,90 @@
+package enginetest
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benignFrames marks goroutines that outlive a session by design: pooled
+// HTTP connections, test servers, the testing framework and the runtime.
+// A goroutine whose stack contains any of these is not reported as a leak.
+var benignFrames = []string{
+	"net/http.(*persistConn)",
+	"net/http.(*conn).serve",
+	"net/http.(*Server).Serve",
+	"net/http/httptest.",
+	"testing.(*T).Run",
+	"testing.tRunner",
+	"testing.runTests",
+	"testing.(*M).",
+	"os/signal.",
+	"runtime.goexit0",
+	"runtime/trace.",
+}
+
+// goroutines returns the stacks of all goroutines keyed by goroutine header
+// ("goroutine N"), excluding the caller's own goroutine.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for i, g := range bytes.Split(buf, []byte("\n\n")) {
+		if i == 0 {
+			continue // current goroutine
+		}
+		s := string(g)
+		id, _, _ := strings.Cut(s, " [")
+		stacks[id] = s
+	}
+	return stacks
+}
+
+// leaked returns stacks of goroutines absent from before and not benign.
+func leaked(before map[string]string) []string {
+	var out []string
+	for id, stack := range goroutines() {
+		if _, ok := before[id]; ok || benign(stack) {
+			continue
+		}
+		out = append(out, stack)
+	}
+	return out
+}
+
+func benign(stack string) bool {
+	for _, f := range benignFrames {
+		if strings.Contains(stack, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNoLeak polls until no goroutines leaked relative to before, failing
+// with their stacks if some remain after d.
+func checkNoLeak(t *testing.T, before map[string]string, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for {
+		extra := leaked(before)
+		if len(extra) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutine(s) leaked after Stop:\n\n%s", len(extra), strings.Join(extra, "\n\n"))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -3,6 +3,7 @@ package agentrun
 import (
 	"errors"
 	"strconv"
+	"time"
 )
 
 // Sentinel errors for engine operations.
@@ -65,3 +66,37 @@ func ExitCode(err error) (int, bool) {
 	}
 	return 0, false
 }
+
+// ErrorCategoryOf returns the category of the first error in err's chain
+// that reports one through an ErrorCategory() ErrorCategory method, such
+// as API errors from the api engines and JSON-RPC errors from ACP agents.
+// Returns "" when none does.
+func ErrorCategoryOf(err error) ErrorCategory {
+	var c interface{ ErrorCategory() ErrorCategory }
+	if errors.As(err, &c) {
+		return c.ErrorCategory()
+	}
+	return ""
+}
+
+// RetryAfterOf returns the retry hint of the first error in err's chain
+// that reports one through a RetryAfter() time.Duration method. Returns 0
+// when none does.
+func RetryAfterOf(err error) time.Duration {
+	var r interface{ RetryAfter() time.Duration }
+	if errors.As(err, &r) {
+		return r.RetryAfter()
+	}
+	return 0
+}
+
+// RateLimitOf returns the rate limit of the first error in err's chain
+// that reports one through a RateLimit() *RateLimit method. Returns nil
+// when none does.
+func RateLimitOf(err error) *RateLimit {
+	var r interface{ RateLimit() *RateLimit }
+	if errors.As(err, &r) {
+		return r.RateLimit()
+	}
+	return nil
+}
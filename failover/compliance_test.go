@@ -0,0 +1,28 @@
+package failover_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/failover"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		return failover.NewEngine([]failover.Backend{
+			{Name: "primary", Engine: fake.NewEngine(fake.WithValidateError(agentrun.ErrUnavailable))},
+			{Name: "secondary", Engine: fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))},
+		}, failover.WithFailoverOn(agentrun.CategoryRateLimited)), agentrun.Session{}
+	})
+}
+
+func TestCompliance_ResumePerTurn(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		return failover.NewEngine([]failover.Backend{
+			{Name: "primary", Engine: fake.NewEngine(fake.WithResumePerTurn(), fake.WithDefaultTurn(fake.TextTurn("ok")))},
+			{Name: "secondary", Engine: fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))},
+		}, failover.WithFailoverOn(agentrun.CategoryRateLimited)), agentrun.Session{}
+	})
+}
@@ -0,0 +1,32 @@
+// Package failover starts agent sessions on the first available of a
+// prioritized list of engines.
+//
+// [NewEngine] takes [Backend] values in order of preference. Start skips
+// a backend whose Validate fails (a missing binary reports
+// [agentrun.ErrUnavailable]) and moves on when its Start returns an error,
+// so a session lands on Codex or an ACP agent when Claude is not installed
+// or not logged in. Each backend may replace the model and translate the
+// session's namespaced Options to its own; model names and options rarely
+// carry over between backends.
+//
+//	eng := failover.NewEngine([]failover.Backend{
+//	    {Name: "claude", Engine: cli.NewEngine(claude.New())},
+//	    {Name: "codex", Engine: cli.NewEngine(codex.New()), Model: "gpt-5-codex",
+//	        Translate: func(s agentrun.Session) agentrun.Session {
+//	            s.Options["codex.sandbox"] = "workspace-write"
+//	            return s
+//	        }},
+//	}, failover.WithFailoverOn(agentrun.CategoryRateLimited))
+//
+// With [WithFailoverOn], a running session also moves when its backend
+// reports a MessageError (or a Send error) in one of the given categories
+// and a later backend exists. The turn in flight is sent to the next
+// backend once it starts, so a RunTurn in progress completes there; the
+// old process is stopped and its error is not relayed. Conversation
+// history is not carried over. If no later backend starts, the error is
+// relayed and the session stays where it was.
+//
+// Every MessageInit carries the serving backend's name in
+// [agentrun.InitMeta].Engine, and each failover is announced with a
+// MessageSystem notice. [Process.Backend] reports the current backend.
+package failover
@@ -0,0 +1,153 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dmora/agentrun"
+)
+
+// Backend is one engine in the failover order.
+type Backend struct {
+	// Name identifies the backend in InitMeta.Engine and in failover
+	// notices. Defaults to its position in the list, counting from 1.
+	Name string
+
+	// Engine starts sessions on this backend.
+	Engine agentrun.Engine
+
+	// Model, when set, replaces Session.Model and any WithModel start
+	// option: model names rarely carry over between backends.
+	Model string
+
+	// Translate adapts the session to this backend, e.g. mapping
+	// namespaced Options ("claude.*" to "codex.*"). It receives a copy,
+	// after Model is applied, and may modify it. Nil leaves the session
+	// unchanged.
+	Translate func(agentrun.Session) agentrun.Session
+}
+
+// session returns s adapted to b.
+func (b Backend) session(s agentrun.Session) agentrun.Session {
+	s = s.Clone()
+	if b.Model != "" {
+		s.Model = b.Model
+	}
+	if b.Translate != nil {
+		s = b.Translate(s)
+	}
+	return s
+}
+
+// Engine is an agentrun.Engine that starts each session on the first of a
+// prioritized list of backends that validates and starts.
+type Engine struct {
+	backends []Backend
+	opts     Options
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine returns an Engine that tries backends in order.
+func NewEngine(backends []Backend, opts ...Option) *Engine {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	bs := make([]Backend, len(backends))
+	for i, b := range backends {
+		if b.Name == "" {
+			b.Name = strconv.Itoa(i + 1)
+		}
+		bs[i] = b
+	}
+	return &Engine{backends: bs, opts: o}
+}
+
+// Start starts the session on the first backend whose Validate succeeds
+// and whose Start returns no error, and returns a *Process. Start options
+// are folded into the session so a mid-session failover reuses the
+// timeout but not the original prompt: the next backend starts without a
+// prompt and receives the turn in flight through Send. If every backend fails, the error
+// joins each backend's error; it returns ctx.Err() if ctx ends first.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	startOpts := agentrun.ResolveOptions(opts...)
+	session = session.Clone()
+	if startOpts.Prompt != "" {
+		session.Prompt = startOpts.Prompt
+	}
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+	var restartOpts []agentrun.Option
+	if startOpts.Timeout > 0 {
+		restartOpts = append(restartOpts, agentrun.WithTimeout(startOpts.Timeout))
+	}
+
+	g, err := e.startFrom(ctx, 0, session, restartOpts)
+	if err != nil {
+		return nil, err
+	}
+	return newProcess(e, session, restartOpts, g), nil
+}
+
+// Validate returns nil if any backend validates, and otherwise every
+// backend's error joined, so errors.Is(err, agentrun.ErrUnavailable)
+// holds when no backend is installed.
+func (e *Engine) Validate() error {
+	if len(e.backends) == 0 {
+		return errNoBackends
+	}
+	var errs []error
+	for _, b := range e.backends {
+		err := b.Engine.Validate()
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+	}
+	return fmt.Errorf("failover: no engine available: %w", errors.Join(errs...))
+}
+
+var errNoBackends = errors.New("failover: no backends")
+
+// startFrom starts session on the first usable backend at index i or
+// later.
+func (e *Engine) startFrom(ctx context.Context, i int, session agentrun.Session, opts []agentrun.Option) (*generation, error) {
+	if i >= len(e.backends) {
+		return nil, errNoBackends
+	}
+	var errs []error
+	for ; i < len(e.backends); i++ {
+		b := e.backends[i]
+		if err := b.Engine.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+			continue
+		}
+		proc, err := b.Engine.Start(ctx, b.session(session), opts...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+			continue
+		}
+		return &generation{
+			proc:    proc,
+			index:   i,
+			name:    b.Name,
+			trip:    make(chan agentrun.Message, 1),
+			resumed: make(chan struct{}, 1),
+			lost:    make(chan agentrun.Message, 1),
+			settled: make(chan struct{}),
+		}, nil
+	}
+	return nil, fmt.Errorf("failover: no engine started: %w", errors.Join(errs...))
+}
+
+// hasNext reports whether a backend follows index i.
+func (e *Engine) hasNext(i int) bool {
+	return i+1 < len(e.backends)
+}
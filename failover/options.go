@@ -0,0 +1,36 @@
+package failover
+
+import (
+	"slices"
+
+	"github.com/dmora/agentrun"
+)
+
+// Options holds resolved failover configuration.
+type Options struct {
+	// FailoverOn lists the error categories that move a running session
+	// to the next backend. Empty means failover happens only at Start.
+	FailoverOn []agentrun.ErrorCategory
+}
+
+// Option configures an Engine.
+type Option func(*Options)
+
+// WithFailoverOn moves a running session to the next backend when it
+// reports a MessageError in one of categories, e.g.
+// agentrun.CategoryRateLimited. Repeated calls add categories; the empty
+// category is ignored.
+func WithFailoverOn(categories ...agentrun.ErrorCategory) Option {
+	return func(o *Options) {
+		for _, c := range categories {
+			if c != "" && !slices.Contains(o.FailoverOn, c) {
+				o.FailoverOn = append(o.FailoverOn, c)
+			}
+		}
+	}
+}
+
+// triggers reports whether category c moves a running session.
+func (o Options) triggers(c agentrun.ErrorCategory) bool {
+	return c != "" && slices.Contains(o.FailoverOn, c)
+}
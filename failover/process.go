@@ -0,0 +1,444 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// generation is one process started for the session on one backend.
+type generation struct {
+	proc  agentrun.Process
+	index int    // position in Engine.backends
+	name  string // Backend.Name
+
+	// trip carries a failed Send's error to the relay, for engines that
+	// return it without emitting a MessageError.
+	trip chan agentrun.Message
+
+	// resumed is signaled by each successful Send, which opens a new
+	// Output channel on resume-per-turn engines.
+	resumed chan struct{}
+
+	// lost carries the error of a failed resend of the turn in flight;
+	// relay handles it like a MessageError on Output.
+	lost chan agentrun.Message
+
+	settled    chan struct{} // closed once failover from this generation is decided
+	settleOnce sync.Once
+	replaced   bool // set before settled closes when a later backend took over
+	exhausted  bool // a failover attempt failed; relay only
+}
+
+func (g *generation) settle(replaced bool) {
+	g.settleOnce.Do(func() {
+		g.replaced = replaced
+		close(g.settled)
+	})
+}
+
+// Process is an agentrun.Process created by Engine.Start. One goroutine
+// relays the current backend's Output and moves the session to the next
+// backend when it reports an error in a failover category.
+type Process struct {
+	eng       *Engine
+	session   agentrun.Session // failover template, without the prompt
+	startOpts []agentrun.Option
+
+	ctx    context.Context // canceled when the process ends or is stopped
+	cancel context.CancelFunc
+
+	output chan agentrun.Message
+	done   chan struct{}
+	stop   chan struct{}
+
+	mu       sync.Mutex // guards the fields below
+	cur      *generation
+	ready    chan struct{} // closed when cur is set again after a failover
+	pending  string        // prompt of the turn in flight
+	stopping bool
+
+	termErr  error
+	stopOnce sync.Once
+}
+
+var _ agentrun.Process = (*Process)(nil)
+
+func newProcess(e *Engine, session agentrun.Session, startOpts []agentrun.Option, g *generation) *Process {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Process{
+		eng:       e,
+		session:   session,
+		startOpts: startOpts,
+		ctx:       ctx,
+		cancel:    cancel,
+		output:    make(chan agentrun.Message),
+		done:      make(chan struct{}),
+		stop:      make(chan struct{}),
+		cur:       g,
+		ready:     make(chan struct{}),
+		pending:   session.Prompt,
+	}
+	p.session.Prompt = "" // failover sends the turn in flight instead
+	go p.run(g)
+	return p
+}
+
+// Output returns the channel for receiving messages from the agent. It
+// spans failovers and closes when the session ends.
+func (p *Process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send transmits message to the current backend. During a failover it
+// waits for the next backend. If Send fails with an error in a failover
+// category, or because a failover stopped the process under it, Send
+// waits for the outcome and returns nil when the next backend took over:
+// the failover sends message to that backend.
+func (p *Process) Send(ctx context.Context, message string) error {
+	g, err := p.acquire(ctx, message)
+	if err != nil {
+		return err
+	}
+	err = g.proc.Send(ctx, message)
+	if err == nil {
+		select {
+		case g.resumed <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	if !p.eng.hasNext(g.index) {
+		return err
+	}
+	if category := agentrun.ErrorCategoryOf(err); p.eng.opts.triggers(category) {
+		msg := agentrun.Message{
+			Type:          agentrun.MessageError,
+			Content:       err.Error(),
+			ErrorCategory: category,
+			Timestamp:     time.Now(),
+		}
+		select {
+		case g.trip <- msg:
+		default:
+		}
+	} else if !errors.Is(err, agentrun.ErrTerminated) {
+		return err
+	}
+	select {
+	case <-g.settled:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if g.replaced {
+		return nil
+	}
+	return err
+}
+
+// acquire waits for a live generation and records message as the turn in
+// flight, atomically, so a failover that begins afterwards carries it.
+func (p *Process) acquire(ctx context.Context, message string) (*generation, error) {
+	for {
+		p.mu.Lock()
+		if p.stopping || p.ended() {
+			p.mu.Unlock()
+			return nil, agentrun.ErrTerminated
+		}
+		if g := p.cur; g != nil {
+			p.pending = message
+			p.mu.Unlock()
+			return g, nil
+		}
+		ready := p.ready
+		p.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-p.done:
+			return nil, agentrun.ErrTerminated
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Stop stops the current backend's process and ends the session.
+// Idempotent; blocks until Output is closed.
+func (p *Process) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopping = true
+		g := p.cur
+		p.mu.Unlock()
+		close(p.stop)
+		p.cancel() // abort a failover in progress
+		if g != nil {
+			_ = g.proc.Stop(ctx)
+		}
+	})
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *Process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// Backend returns the name of the backend serving the session; during a
+// failover, the one being replaced.
+func (p *Process) Backend() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cur == nil {
+		return ""
+	}
+	return p.cur.name
+}
+
+// run relays each generation until the session ends.
+func (p *Process) run(g *generation) {
+	for {
+		trigger, fromSend, ok := p.relay(g)
+		if !ok {
+			g.settle(false)
+			p.finish(g.proc.Err())
+			return
+		}
+		next := p.failover(g, trigger)
+		if next == nil {
+			g.exhausted = true
+			g.settle(false)
+			// Send returns its own error; don't report it twice.
+			if !fromSend {
+				p.emit(trigger)
+			}
+			continue
+		}
+		g = next
+	}
+}
+
+// relay forwards g's Output, tagging MessageInit with the backend name.
+// It returns the first error that should move the session, with
+// fromSend set if it came from a failed Send, or ok false once g has
+// ended. A resume-per-turn process (agentrun.Resumable) closes Output
+// after every turn; relay then waits for the next Send and reads the new
+// channel.
+func (p *Process) relay(g *generation) (trigger agentrun.Message, fromSend, ok bool) {
+	// After Stop, keep draining so the process can exit.
+	discard := p.stopped()
+	eligible := func() bool {
+		return !discard && !g.exhausted && p.eng.hasNext(g.index)
+	}
+	out := g.proc.Output()
+	var resumed, stop <-chan struct{} // set while between turns
+	for {
+		select {
+		case msg, open := <-out:
+			if !open {
+				if !agentrun.Resumable(g.proc) {
+					return agentrun.Message{}, false, false
+				}
+				out, resumed, stop = nil, g.resumed, p.stop
+				continue
+			}
+			switch msg.Type {
+			case agentrun.MessageInit:
+				tag(&msg, g.name)
+			case agentrun.MessageResult:
+				p.mu.Lock()
+				p.pending = ""
+				p.mu.Unlock()
+			case agentrun.MessageError:
+				if eligible() && p.eng.opts.triggers(msg.ErrorCategory) {
+					return msg, false, true
+				}
+			}
+			if !discard && !p.emit(msg) {
+				discard = true
+			}
+		case msg := <-g.trip:
+			if eligible() {
+				return msg, true, true
+			}
+		case msg := <-g.lost:
+			if eligible() && p.eng.opts.triggers(msg.ErrorCategory) {
+				return msg, false, true
+			}
+			if !discard && !p.emit(msg) {
+				discard = true
+			}
+		case <-resumed:
+			out, resumed, stop = g.proc.Output(), nil, nil
+		case <-stop:
+			return agentrun.Message{}, false, false
+		}
+	}
+}
+
+// failover starts the session on the backends after g's and sends it the
+// turn in flight. On success it retires g and returns the new generation;
+// it returns nil if no backend started or Stop was called, and g carries
+// on.
+func (p *Process) failover(g *generation, trigger agentrun.Message) *generation {
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		return nil
+	}
+	p.cur = nil
+	p.ready = make(chan struct{})
+	pending := p.pending
+	p.mu.Unlock()
+
+	p.notice(fmt.Sprintf("failover: %s: %s: %s; trying the next engine", g.name, trigger.ErrorCategory, trigger.Content))
+	next, err := p.eng.startFrom(p.ctx, g.index+1, p.session, p.startOpts)
+
+	p.mu.Lock()
+	if err != nil || p.stopping {
+		p.cur = g
+		close(p.ready)
+		stopping := p.stopping
+		p.mu.Unlock()
+		if next != nil {
+			retire(next)
+		}
+		if stopping {
+			// Stop found no current process; stop g while relay drains it.
+			go func() { _ = g.proc.Stop(context.Background()) }()
+		} else {
+			p.notice(fmt.Sprintf("failover: no engine took over: %v; staying on %s", err, g.name))
+		}
+		return nil
+	}
+	p.cur = next
+	close(p.ready)
+	p.mu.Unlock()
+
+	g.settle(true)
+	retire(g)
+	p.notice("failover: switched to " + next.name)
+	if pending != "" {
+		// Not every engine runs Session.Prompt, and Send may block for
+		// the whole turn while relay reads its Output.
+		go p.resend(next, pending)
+	}
+	return next
+}
+
+// resend sends the turn in flight to g, which took over from a failed
+// backend. A failed resend reaches relay through g.lost.
+func (p *Process) resend(g *generation, message string) {
+	err := g.proc.Send(p.ctx, message)
+	if err == nil {
+		select {
+		case g.resumed <- struct{}{}:
+		default:
+		}
+		return
+	}
+	if p.ctx.Err() != nil {
+		return
+	}
+	g.lost <- agentrun.Message{
+		Type:          agentrun.MessageError,
+		Content:       err.Error(),
+		ErrorCategory: agentrun.ErrorCategoryOf(err),
+		Timestamp:     time.Now(),
+	}
+}
+
+// retire stops g, draining its Output so the process can exit. A
+// resume-per-turn process may open a new Output channel for a turn that
+// began before Stop, so each channel is drained in turn.
+func retire(g *generation) {
+	stopped := make(chan struct{})
+	go func() {
+		_ = g.proc.Stop(context.Background())
+		close(stopped)
+	}()
+	out := g.proc.Output()
+	for {
+		for range out {
+		}
+		if next := g.proc.Output(); next != out {
+			out = next
+			continue
+		}
+		<-stopped
+		if next := g.proc.Output(); next != out {
+			out = next
+			continue
+		}
+		return
+	}
+}
+
+// tag sets InitMeta.Engine on msg without modifying the original InitMeta.
+func tag(msg *agentrun.Message, name string) {
+	var init agentrun.InitMeta
+	if msg.Init != nil {
+		init = *msg.Init
+	}
+	init.Engine = name
+	msg.Init = &init
+}
+
+// notice emits a MessageSystem about a failover step.
+func (p *Process) notice(content string) {
+	p.emit(agentrun.Message{Type: agentrun.MessageSystem, Content: content, Timestamp: time.Now()})
+}
+
+// emit sends msg on Output. Returns false if Stop was called first.
+func (p *Process) emit(msg agentrun.Message) bool {
+	select {
+	case p.output <- msg:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// finish sets the terminal error and closes done, then output, so Err is
+// stable by the time a consumer sees Output closed. Called once, by run.
+func (p *Process) finish(err error) {
+	p.cancel()
+	p.termErr = err
+	close(p.done)
+	close(p.output)
+}
+
+func (p *Process) ended() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Process) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,315 @@
+package failover_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/failover"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// rateLimitedTurn reports a rate limit without ending the process.
+var rateLimitedTurn = fake.Turn{Messages: []agentrun.Message{{
+	Type:          agentrun.MessageError,
+	Content:       "usage limit reached",
+	ErrorCategory: agentrun.CategoryRateLimited,
+}}}
+
+// categoryError is an error that reports an ErrorCategory.
+type categoryError agentrun.ErrorCategory
+
+func (e categoryError) Error() string { return "api: " + string(e) }
+
+func (e categoryError) ErrorCategory() agentrun.ErrorCategory { return agentrun.ErrorCategory(e) }
+
+func backends(engines ...*fake.Engine) []failover.Backend {
+	bs := make([]failover.Backend, len(engines))
+	for i, eng := range engines {
+		bs[i] = failover.Backend{Name: fmt.Sprintf("e%d", i+1), Engine: eng}
+	}
+	return bs
+}
+
+func start(t *testing.T, eng *failover.Engine, s agentrun.Session) *failover.Process {
+	t.Helper()
+	proc, err := eng.Start(testCtx(t), s)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc.(*failover.Process)
+}
+
+// collect runs one turn and returns every message it produced.
+func collect(t *testing.T, proc agentrun.Process, prompt string) ([]agentrun.Message, error) {
+	t.Helper()
+	var got []agentrun.Message
+	err := agentrun.RunTurn(testCtx(t), proc, prompt, func(msg agentrun.Message) error {
+		got = append(got, msg)
+		return nil
+	})
+	return got, err
+}
+
+func engines(msgs []agentrun.Message) []string {
+	var names []string
+	for _, msg := range msgs {
+		if msg.Type == agentrun.MessageInit {
+			names = append(names, msg.Init.Engine)
+		}
+	}
+	return names
+}
+
+func notices(msgs []agentrun.Message) string {
+	var b strings.Builder
+	for _, msg := range msgs {
+		if msg.Type == agentrun.MessageSystem {
+			b.WriteString(msg.Content + "\n")
+		}
+	}
+	return b.String()
+}
+
+func TestStart_SkipsUnavailable(t *testing.T) {
+	missing := fake.NewEngine(fake.WithValidateError(fmt.Errorf("claude: %w", agentrun.ErrUnavailable)))
+	ok := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("hi")))
+	proc := start(t, failover.NewEngine(backends(missing, ok)), agentrun.Session{})
+
+	got, err := collect(t, proc, "hello")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if names := engines(got); !slices.Equal(names, []string{"e2"}) {
+		t.Errorf("InitMeta.Engine = %v, want [e2]", names)
+	}
+	if got[0].Init.AgentName != "fake" {
+		t.Errorf("InitMeta = %+v, want the backend's fields kept", got[0].Init)
+	}
+	if len(missing.Starts()) != 0 {
+		t.Error("unavailable backend was started")
+	}
+	if proc.Backend() != "e2" {
+		t.Errorf("Backend = %q, want e2", proc.Backend())
+	}
+}
+
+func TestStart_FallsBackOnStartError(t *testing.T) {
+	broken := fake.NewEngine(fake.WithStartError(errors.New("auth expired")))
+	ok := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("hi")))
+	proc := start(t, failover.NewEngine(backends(broken, ok)), agentrun.Session{Prompt: "p"})
+	if proc.Backend() != "e2" || len(ok.Starts()) != 1 || ok.Starts()[0].Prompt != "p" {
+		t.Errorf("Backend = %q, starts = %+v", proc.Backend(), ok.Starts())
+	}
+}
+
+func TestStart_AllFail(t *testing.T) {
+	eng := failover.NewEngine(backends(
+		fake.NewEngine(fake.WithValidateError(agentrun.ErrUnavailable)),
+		fake.NewEngine(fake.WithStartError(errors.New("boom"))),
+	))
+	_, err := eng.Start(testCtx(t), agentrun.Session{})
+	if !errors.Is(err, agentrun.ErrUnavailable) || !strings.Contains(err.Error(), "e2: boom") {
+		t.Errorf("Start = %v, want every backend's error", err)
+	}
+	if err := eng.Validate(); err != nil {
+		t.Errorf("Validate = %v, want nil while e2 validates", err)
+	}
+}
+
+func TestValidate_NoneAvailable(t *testing.T) {
+	eng := failover.NewEngine(backends(
+		fake.NewEngine(fake.WithValidateError(agentrun.ErrUnavailable)),
+		fake.NewEngine(fake.WithValidateError(agentrun.ErrUnavailable)),
+	))
+	if err := eng.Validate(); !errors.Is(err, agentrun.ErrUnavailable) {
+		t.Errorf("Validate = %v, want ErrUnavailable", err)
+	}
+	if err := failover.NewEngine(nil).Validate(); err == nil {
+		t.Error("Validate with no backends succeeded")
+	}
+}
+
+func TestStart_TranslatesSession(t *testing.T) {
+	a := fake.NewEngine(fake.WithStartError(errors.New("down")))
+	b := fake.NewEngine()
+	eng := failover.NewEngine([]failover.Backend{
+		{Name: "claude", Engine: a},
+		{Name: "codex", Engine: b, Model: "gpt-5", Translate: func(s agentrun.Session) agentrun.Session {
+			s.Options["codex.sandbox"] = s.Options["claude.mode"]
+			delete(s.Options, "claude.mode")
+			return s
+		}},
+	})
+	s := agentrun.Session{Model: "sonnet", Options: map[string]string{"claude.mode": "plan"}}
+	start(t, eng, s)
+
+	got := b.Starts()[0]
+	if got.Model != "gpt-5" || got.Options["codex.sandbox"] != "plan" || got.Options["claude.mode"] != "" {
+		t.Errorf("codex session = %+v", got)
+	}
+	if a.Starts()[0].Model != "sonnet" || s.Options["claude.mode"] != "plan" {
+		t.Error("session modified for other backends or the caller")
+	}
+}
+
+func TestFailover_MidSession(t *testing.T) {
+	claude := fake.NewEngine(fake.WithTurns(fake.TextTurn("one"), rateLimitedTurn))
+	codex := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("two")))
+	eng := failover.NewEngine(backends(claude, codex), failover.WithFailoverOn(agentrun.CategoryRateLimited))
+	proc := start(t, eng, agentrun.Session{})
+
+	if _, err := collect(t, proc, "first"); err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	got, err := collect(t, proc, "second")
+	if err != nil {
+		t.Fatalf("second turn: %v", err)
+	}
+	if last := got[len(got)-1]; last.Type != agentrun.MessageResult {
+		t.Fatalf("last message = %+v, want the turn completed on codex", last)
+	}
+	if names := engines(got); !slices.Equal(names, []string{"e2"}) {
+		t.Errorf("InitMeta.Engine = %v, want [e2]", names)
+	}
+	n := notices(got)
+	if !strings.Contains(n, "e1: rate_limited: usage limit reached") || !strings.Contains(n, "switched to e2") {
+		t.Errorf("notices = %q", n)
+	}
+	for _, msg := range got {
+		if msg.Type == agentrun.MessageError {
+			t.Errorf("error relayed despite failover: %+v", msg)
+		}
+	}
+	if p := codex.Processes(); len(p) != 1 || !slices.Equal(p[0].Sent(), []string{"second"}) {
+		t.Errorf("codex processes = %d, want one sent the interrupted prompt", len(p))
+	}
+	if proc.Backend() != "e2" {
+		t.Errorf("Backend = %q, want e2", proc.Backend())
+	}
+}
+
+func TestFailover_SendError(t *testing.T) {
+	claude := fake.NewEngine(fake.WithTurns(fake.Turn{SendErr: categoryError(agentrun.CategoryOverloaded)}))
+	codex := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))
+	eng := failover.NewEngine(backends(claude, codex), failover.WithFailoverOn(agentrun.CategoryOverloaded))
+	proc := start(t, eng, agentrun.Session{})
+
+	got, err := collect(t, proc, "go")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if !strings.Contains(notices(got), "switched to e2") || !slices.Equal(codex.Processes()[0].Sent(), []string{"go"}) {
+		t.Errorf("messages = %+v", got)
+	}
+}
+
+// promptless is an engine that, like ACP and the API engines, does not
+// run Session.Prompt at Start.
+type promptless struct{ *fake.Engine }
+
+func (e promptless) Start(ctx context.Context, s agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	s.Prompt = ""
+	return e.Engine.Start(ctx, s, opts...)
+}
+
+func TestFailover_TargetIgnoresPrompt(t *testing.T) {
+	claude := fake.NewEngine(fake.WithTurns(fake.TextTurn("one"), rateLimitedTurn))
+	codex := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("two")))
+	eng := failover.NewEngine([]failover.Backend{
+		{Name: "e1", Engine: claude},
+		{Name: "e2", Engine: promptless{codex}},
+	}, failover.WithFailoverOn(agentrun.CategoryRateLimited))
+	proc := start(t, eng, agentrun.Session{})
+
+	if _, err := collect(t, proc, "first"); err != nil {
+		t.Fatalf("first turn: %v", err)
+	}
+	got, err := collect(t, proc, "second")
+	if err != nil {
+		t.Fatalf("second turn: %v", err)
+	}
+	if last := got[len(got)-1]; last.Type != agentrun.MessageResult || got[len(got)-2].Content != "two" {
+		t.Errorf("messages = %+v, want the turn completed on e2", got)
+	}
+	if sent := codex.Processes()[0].Sent(); !slices.Equal(sent, []string{"second"}) {
+		t.Errorf("e2 sent = %q, want [second]", sent)
+	}
+}
+
+func TestFailover_OtherCategoriesRelayed(t *testing.T) {
+	claude := fake.NewEngine(fake.WithTurns(fake.Turn{Messages: []agentrun.Message{
+		{Type: agentrun.MessageError, Content: "bad input", ErrorCategory: agentrun.CategoryInvalidRequest},
+		{Type: agentrun.MessageResult},
+	}}))
+	codex := fake.NewEngine()
+	eng := failover.NewEngine(backends(claude, codex), failover.WithFailoverOn(agentrun.CategoryRateLimited))
+	proc := start(t, eng, agentrun.Session{})
+
+	got, err := collect(t, proc, "go")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if !slices.ContainsFunc(got, func(m agentrun.Message) bool { return m.Type == agentrun.MessageError }) {
+		t.Errorf("messages = %+v, want the error relayed", got)
+	}
+	if len(codex.Starts()) != 0 {
+		t.Error("failed over on a category not configured")
+	}
+}
+
+func TestFailover_NoReplacement(t *testing.T) {
+	claude := fake.NewEngine(fake.WithTurns(fake.Turn{Messages: []agentrun.Message{
+		rateLimitedTurn.Messages[0],
+		{Type: agentrun.MessageResult},
+	}}, fake.TextTurn("still here")))
+	codex := fake.NewEngine(fake.WithStartError(errors.New("not logged in")))
+	eng := failover.NewEngine(backends(claude, codex), failover.WithFailoverOn(agentrun.CategoryRateLimited))
+	proc := start(t, eng, agentrun.Session{})
+
+	got, err := collect(t, proc, "go")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if !strings.Contains(notices(got), "not logged in; staying on e1") {
+		t.Errorf("notices = %q", notices(got))
+	}
+	if !slices.ContainsFunc(got, func(m agentrun.Message) bool { return m.Type == agentrun.MessageError }) {
+		t.Errorf("messages = %+v, want the original error relayed", got)
+	}
+	if _, err := collect(t, proc, "again"); err != nil || proc.Backend() != "e1" {
+		t.Errorf("next turn = %v on %q, want e1 still serving", err, proc.Backend())
+	}
+}
+
+func TestFailover_LastBackendRelays(t *testing.T) {
+	only := fake.NewEngine(fake.WithTurns(fake.Turn{Messages: []agentrun.Message{
+		rateLimitedTurn.Messages[0],
+		{Type: agentrun.MessageResult},
+	}}))
+	eng := failover.NewEngine(backends(only), failover.WithFailoverOn(agentrun.CategoryRateLimited))
+	proc := start(t, eng, agentrun.Session{})
+
+	got, err := collect(t, proc, "go")
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if n := notices(got); n != "" {
+		t.Errorf("notices = %q, want none with no backend left", n)
+	}
+}
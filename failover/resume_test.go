@@ -0,0 +1,69 @@
+//go:build !windows
+
+package failover_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/codex"
+	"github.com/dmora/agentrun/enginetest/clitest"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/failover"
+)
+
+// TestProcess_ResumePerTurnEngine serves turns from a spawn-per-turn CLI
+// engine, whose Output closes after every turn, then fails over from it.
+func TestProcess_ResumePerTurnEngine(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+match ^exec --json .*-- first$
+emit {"type":"thread.started","thread_id":"a1b2c3d4-e5f6-7890-abcd-ef1234567890"}
+emit {"type":"item.completed","item":{"id":"i1","type":"agent_message","text":"one"}}
+emit {"type":"turn.completed"}
+
+match ^exec resume --json .*-- \S+ second$
+emit {"type":"item.completed","item":{"id":"i2","type":"agent_message","text":"two"}}
+emit {"type":"turn.completed"}
+
+match ^exec resume --json .*-- \S+ third$
+emit {"type":"turn.failed","error":{"message":"usage limit reached"}}
+`)
+	backup := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("three")))
+	eng := failover.NewEngine([]failover.Backend{
+		{Name: "codex", Engine: cli.NewEngine(codex.New(codex.WithBinary(agent.Path)))},
+		{Name: "backup", Engine: backup},
+	}, failover.WithFailoverOn(agentrun.CategoryRateLimited))
+	proc := start(t, eng, agentrun.Session{CWD: t.TempDir(), Prompt: "first"})
+
+	var texts []string
+	for msg := range proc.Output() {
+		if msg.Type == agentrun.MessageText {
+			texts = append(texts, msg.Content)
+		}
+		if msg.Type == agentrun.MessageResult {
+			break
+		}
+	}
+	for _, prompt := range []string{"second", "third"} {
+		msgs, err := collect(t, proc, prompt)
+		if err != nil {
+			t.Fatalf("RunTurn(%s): %v", prompt, err)
+		}
+		for _, msg := range msgs {
+			if msg.Type == agentrun.MessageText {
+				texts = append(texts, msg.Content)
+			}
+		}
+	}
+	if want := []string{"one", "two", "three"}; !slices.Equal(texts, want) {
+		t.Errorf("texts = %q, want %q", texts, want)
+	}
+	if proc.Backend() != "backup" {
+		t.Errorf("Backend = %q, want backup", proc.Backend())
+	}
+	if procs := backup.Processes(); len(procs) != 1 || !slices.Equal(procs[0].Sent(), []string{"third"}) {
+		t.Errorf("backup processes = %d, want one sent the third prompt", len(procs))
+	}
+}
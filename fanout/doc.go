@@ -0,0 +1,29 @@
+// Package fanout runs one prompt on several agents in parallel for
+// side-by-side comparison.
+//
+// [Start] starts the same [agentrun.Session] on every [Target] at once,
+// sends Session.Prompt as one turn to each, and stops each process when
+// its turn ends. Messages from all targets are merged on [Run.Events],
+// tagged with the target name; [Run.Wait] returns one [Result] per target
+// with the final text, usage, cost, stop reason and duration. A target
+// that fails to start or errors mid-turn reports it in Result.Err without
+// affecting the others.
+//
+//	run, err := fanout.Start(ctx, agentrun.Session{CWD: repo, Prompt: task}, []fanout.Target{
+//	    {Name: "claude", Engine: cli.NewEngine(claude.New())},
+//	    {Name: "codex", Engine: cli.NewEngine(codex.New()), Model: "gpt-5-codex"},
+//	    {Name: "opencode", Engine: cli.NewEngine(opencode.New())},
+//	}, fanout.WithCopyCWD(""))
+//	for ev := range run.Events() {
+//	    fmt.Printf("[%s] %s\n", ev.Target, ev.Message.Content)
+//	}
+//	for _, r := range run.Wait() {
+//	    fmt.Printf("%s: $%.4f in %v (%s)\n", r.Target, r.CostUSD, r.Duration, r.StopReason)
+//	}
+//
+// Agents that edit files would trip over each other in one directory;
+// [WithCopyCWD] gives each target its own copy of Session.CWD and reports
+// it in Result.CWD, so the resulting trees can be diffed. Copies are not
+// removed. [Collect] is Start followed by Wait for callers that only need
+// the results.
+package fanout
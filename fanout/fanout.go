@@ -0,0 +1,214 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// Target is one engine to run the session on.
+type Target struct {
+	// Name tags the target's events and result. Defaults to its position
+	// in the list, counting from 1.
+	Name string
+
+	// Engine starts the target's session.
+	Engine agentrun.Engine
+
+	// Model, when set, replaces Session.Model for this target.
+	Model string
+
+	// Translate adapts the session to this target, e.g. mapping
+	// namespaced Options. It receives a copy, after Model is applied, and
+	// may modify it. Nil leaves the session unchanged.
+	Translate func(agentrun.Session) agentrun.Session
+}
+
+// session returns s adapted to t.
+func (t Target) session(s agentrun.Session) agentrun.Session {
+	s = s.Clone()
+	if t.Model != "" {
+		s.Model = t.Model
+	}
+	if t.Translate != nil {
+		s = t.Translate(s)
+	}
+	return s
+}
+
+// Event is a message from one target.
+type Event struct {
+	Target  string // Target.Name
+	Message agentrun.Message
+}
+
+// Result summarizes one target's turn.
+type Result struct {
+	Target string // Target.Name
+
+	// Text is the MessageResult content, or the turn's MessageText
+	// joined when the result carries none.
+	Text string
+
+	// Usage is the MessageResult usage; nil when not reported.
+	Usage *agentrun.Usage
+
+	// CostUSD is Usage.CostUSD, or zero when not reported.
+	CostUSD float64
+
+	// StopReason is the MessageResult stop reason.
+	StopReason agentrun.StopReason
+
+	// Duration is from Start to the end of the turn, including startup.
+	Duration time.Duration
+
+	// CWD is the directory the target ran in: a copy of Session.CWD with
+	// WithCopyCWD.
+	CWD string
+
+	// Err is the error that ended the target early, from copying the
+	// directory, Start, or the turn.
+	Err error
+}
+
+// Run is a fan-out in progress, created by Start.
+type Run struct {
+	events  chan Event
+	results []Result
+}
+
+// ErrNoPrompt is returned by Start when Session.Prompt is empty.
+var ErrNoPrompt = errors.New("fanout: session has no prompt")
+
+// Start starts session on every target in parallel and sends
+// Session.Prompt as one turn to each. Each process is stopped when its
+// turn ends. Canceling ctx ends every target early.
+//
+// Events from all targets are merged on Run.Events; the caller must read
+// it until it closes, or call Run.Wait, or the targets stall.
+func Start(ctx context.Context, session agentrun.Session, targets []Target, opts ...Option) (*Run, error) {
+	if session.Prompt == "" {
+		return nil, ErrNoPrompt
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("fanout: no targets")
+	}
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := &Run{
+		events:  make(chan Event),
+		results: make([]Result, len(targets)),
+	}
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		if t.Name == "" {
+			t.Name = strconv.Itoa(i + 1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.results[i] = r.run(ctx, t, session, o)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(r.events)
+	}()
+	return r, nil
+}
+
+// Events returns the merged messages of every target, tagged by target.
+// Messages of one target arrive in order. Closes when every target has
+// finished.
+func (r *Run) Events() <-chan Event {
+	return r.events
+}
+
+// Wait discards events not yet received, blocks until every target has
+// finished, and returns the results in target order. Call it after
+// Events has closed or instead of reading Events.
+func (r *Run) Wait() []Result {
+	for range r.events {
+	}
+	return slices.Clone(r.results)
+}
+
+// Collect runs Start and Wait.
+func Collect(ctx context.Context, session agentrun.Session, targets []Target, opts ...Option) ([]Result, error) {
+	r, err := Start(ctx, session, targets, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return r.Wait(), nil
+}
+
+// run runs one target's turn.
+func (r *Run) run(ctx context.Context, t Target, session agentrun.Session, o Options) (res Result) {
+	res.Target = t.Name
+	start := time.Now()
+	defer func() {
+		if res.Duration == 0 {
+			res.Duration = time.Since(start)
+		}
+		if res.Err != nil {
+			res.Err = fmt.Errorf("fanout: %s: %w", t.Name, res.Err)
+		}
+	}()
+
+	s := t.session(session)
+	prompt := s.Prompt
+	s.Prompt = ""
+	if o.CopyCWD {
+		dir, err := copyCWD(s.CWD, o.CopyDir, t.Name)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		s.CWD = dir
+	}
+	res.CWD = s.CWD
+
+	proc, err := t.Engine.Start(ctx, s)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer func() { _ = proc.Stop(context.Background()) }()
+
+	var text strings.Builder
+	res.Err = agentrun.RunTurn(ctx, proc, prompt, func(msg agentrun.Message) error {
+		switch msg.Type {
+		case agentrun.MessageText:
+			text.WriteString(msg.Content)
+		case agentrun.MessageResult:
+			res.Text = msg.Content
+			res.StopReason = msg.StopReason
+			if msg.Usage != nil {
+				u := *msg.Usage
+				res.Usage = &u
+				res.CostUSD = u.CostUSD
+			}
+		}
+		select {
+		case r.events <- Event{Target: t.Name, Message: msg}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	res.Duration = time.Since(start)
+	if res.Text == "" {
+		res.Text = text.String()
+	}
+	return res
+}
@@ -0,0 +1,166 @@
+package fanout_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/fanout"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// resultTurn emits text and a result with usage.
+func resultTurn(text string, cost float64) fake.Turn {
+	return fake.Turn{Messages: []agentrun.Message{
+		{Type: agentrun.MessageText, Content: text},
+		{
+			Type:       agentrun.MessageResult,
+			StopReason: agentrun.StopEndTurn,
+			Usage:      &agentrun.Usage{InputTokens: 10, OutputTokens: 5, CostUSD: cost},
+		},
+	}}
+}
+
+func TestStart_MergesAndSummarizes(t *testing.T) {
+	claude := fake.NewEngine(fake.WithDefaultTurn(resultTurn("from claude", 0.02)))
+	codex := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("from codex")))
+	run, err := fanout.Start(testCtx(t), agentrun.Session{CWD: "/w", Prompt: "fix it"}, []fanout.Target{
+		{Name: "claude", Engine: claude},
+		{Name: "codex", Engine: codex, Model: "gpt-5"},
+	})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	seen := map[string][]agentrun.MessageType{}
+	for ev := range run.Events() {
+		seen[ev.Target] = append(seen[ev.Target], ev.Message.Type)
+	}
+	for _, name := range []string{"claude", "codex"} {
+		types := seen[name]
+		if len(types) == 0 || types[len(types)-1] != agentrun.MessageResult {
+			t.Errorf("%s events = %v, want ending in result", name, types)
+		}
+	}
+
+	results := run.Wait()
+	if len(results) != 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	c := results[0]
+	if c.Target != "claude" || c.Err != nil || c.Text != "from claude" || c.StopReason != agentrun.StopEndTurn ||
+		c.CostUSD != 0.02 || c.Usage == nil || c.Usage.OutputTokens != 5 || c.Duration <= 0 || c.CWD != "/w" {
+		t.Errorf("claude result = %+v", c)
+	}
+	if x := results[1]; x.Target != "codex" || x.Text != "from codex" || x.Usage != nil {
+		t.Errorf("codex result = %+v", x)
+	}
+	if s := codex.Starts()[0]; s.Model != "gpt-5" || s.Prompt != "" {
+		t.Errorf("codex session = %+v, want model set and prompt sent as a turn", s)
+	}
+}
+
+func TestCollect_PerTargetErrors(t *testing.T) {
+	results, err := fanout.Collect(testCtx(t), agentrun.Session{Prompt: "go"}, []fanout.Target{
+		{Engine: fake.NewEngine(fake.WithStartError(errors.New("not installed")))},
+		{Engine: fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))},
+	})
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if r := results[0]; r.Target != "1" || r.Err == nil || !strings.Contains(r.Err.Error(), "fanout: 1: not installed") {
+		t.Errorf("first result = %+v", r)
+	}
+	if r := results[1]; r.Target != "2" || r.Err != nil || r.Text != "ok" {
+		t.Errorf("second result = %+v", r)
+	}
+}
+
+func TestStart_Invalid(t *testing.T) {
+	eng := fake.NewEngine()
+	if _, err := fanout.Start(testCtx(t), agentrun.Session{}, []fanout.Target{{Engine: eng}}); !errors.Is(err, fanout.ErrNoPrompt) {
+		t.Errorf("Start without prompt = %v, want ErrNoPrompt", err)
+	}
+	if _, err := fanout.Start(testCtx(t), agentrun.Session{Prompt: "x"}, nil); err == nil {
+		t.Error("Start without targets succeeded")
+	}
+}
+
+func TestStart_CopyCWD(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "pkg", "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hasLink := os.Symlink("pkg/main.go", filepath.Join(src, "link.go")) == nil
+
+	a := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("a")))
+	b := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("b")))
+	results, err := fanout.Collect(testCtx(t), agentrun.Session{CWD: src, Prompt: "go"},
+		[]fanout.Target{{Name: "a", Engine: a}, {Name: "b", Engine: b}},
+		fanout.WithCopyCWD(t.TempDir()))
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	if results[0].CWD == results[1].CWD {
+		t.Fatal("targets share a directory")
+	}
+	for i, eng := range []*fake.Engine{a, b} {
+		r := results[i]
+		if r.Err != nil || r.CWD == src || eng.Starts()[0].CWD != r.CWD {
+			t.Fatalf("result %+v, started in %q", r, eng.Starts()[0].CWD)
+		}
+		if got, err := os.ReadFile(filepath.Join(r.CWD, "pkg", "main.go")); err != nil || string(got) != "package main\n" {
+			t.Errorf("%s: copied file = %q, %v", r.Target, got, err)
+		}
+		if hasLink {
+			if link, err := os.Readlink(filepath.Join(r.CWD, "link.go")); err != nil || link != "pkg/main.go" {
+				t.Errorf("%s: symlink = %q, %v", r.Target, link, err)
+			}
+		}
+	}
+}
+
+func TestStart_CopyCWDWithoutCWD(t *testing.T) {
+	results, err := fanout.Collect(testCtx(t), agentrun.Session{Prompt: "go"},
+		[]fanout.Target{{Engine: fake.NewEngine()}}, fanout.WithCopyCWD(t.TempDir()))
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if results[0].Err == nil {
+		t.Error("copy of an empty CWD succeeded")
+	}
+}
+
+func TestStart_Cancel(t *testing.T) {
+	slow := fake.NewEngine(fake.WithDefaultTurn(fake.Turn{
+		Messages: []agentrun.Message{{Type: agentrun.MessageResult}},
+		Delay:    time.Minute,
+	}))
+	ctx, cancel := context.WithCancel(testCtx(t))
+	run, err := fanout.Start(ctx, agentrun.Session{Prompt: "go"}, []fanout.Target{{Engine: slow}})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	cancel()
+	if r := run.Wait()[0]; !errors.Is(r.Err, context.Canceled) {
+		t.Errorf("result = %+v, want Canceled", r)
+	}
+}
@@ -0,0 +1,24 @@
+package fanout
+
+// Options holds resolved fan-out configuration.
+type Options struct {
+	// CopyCWD runs each target in its own copy of Session.CWD, so agents
+	// that edit files do not interfere. Copies are left in place for
+	// inspection; see Result.CWD.
+	CopyCWD bool
+
+	// CopyDir is where copies are made. Empty means os.TempDir.
+	CopyDir string
+}
+
+// Option configures a fan-out Run.
+type Option func(*Options)
+
+// WithCopyCWD runs each target in a fresh copy of Session.CWD created
+// under dir (os.TempDir when empty). The caller removes the copies.
+func WithCopyCWD(dir string) Option {
+	return func(o *Options) {
+		o.CopyCWD = true
+		o.CopyDir = dir
+	}
+}
@@ -73,6 +73,9 @@ const (
 
 	// MessageToolUseDelta is partial tool use input JSON from streaming output.
 	// Content holds a JSON fragment. Emitted during incremental tool input.
+	// The Codex CLI backend also emits it for a running command: Content
+	// holds the output added since the previous delta and Tool names the
+	// command.
 	MessageToolUseDelta MessageType = "tool_use_delta"
 
 	// MessageThinkingDelta is partial thinking content from streaming output.
@@ -126,6 +129,25 @@ type Message struct {
 	// structured error code. Empty means no code was provided.
 	ErrorCode string `json:"error_code,omitempty"`
 
+	// ErrorCategory is the backend-independent class of the error, mapped
+	// from ErrorCode and Content by the backend. Set exclusively on
+	// MessageError messages. Empty means the error could not be
+	// classified; see the ErrorCategory constants.
+	ErrorCategory ErrorCategory `json:"error_category,omitempty"`
+
+	// RetryAfter is how long the backend asked to wait before retrying.
+	// Set exclusively on MessageError messages, and only when the backend
+	// reported a hint (a Retry-After header or "try again in …" text).
+	// Serialized as integer nanoseconds.
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+
+	// RateLimit describes a backend rate or usage limit. Set on
+	// MessageSystem when the backend reports limit status (Claude
+	// rate_limit_event, Codex app-server account/rateLimits/updated) and on
+	// MessageError when a limit was hit (every rate_limited error). Nil on
+	// all other messages.
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
 	// ResumeID is the backend-assigned session identifier for resume.
 	// Set exclusively on MessageInit messages. Consumers persist this value
 	// and pass it back via OptionResumeID to resume the session later.
@@ -164,6 +186,16 @@ type Message struct {
 	//   - Codex/OpenCode: not populated (no structured denial reporting).
 	Denials []PermissionDenial `json:"denials,omitempty"`
 
+	// Replay marks conversation history re-streamed by the agent while
+	// resuming a session, as opposed to output of the current turn.
+	// Replayed messages arrive after MessageInit and before any live output.
+	// Consumers rebuilding a transcript should render them as history.
+	//
+	// Currently set by the ACP engine for updates received during
+	// session/load. False for all live output and for backends that do not
+	// replay history on resume.
+	Replay bool `json:"replay,omitempty"`
+
 	// Raw is the original unparsed JSON from the backend.
 	// Backends populate this for pass-through or debugging.
 	Raw json.RawMessage `json:"raw,omitempty"`
@@ -184,6 +216,10 @@ type ToolCall struct {
 
 	// Output is the tool's result as raw JSON.
 	Output json.RawMessage `json:"output,omitempty"`
+
+	// IsError marks a tool result whose Output describes a failure of the
+	// call rather than the tool's output.
+	IsError bool `json:"is_error,omitempty"`
 }
 
 // StopReason indicates why an agent's turn ended.
@@ -200,6 +236,10 @@ const (
 	// StopEndTurn means the agent completed its response normally.
 	StopEndTurn StopReason = "end_turn"
 
+	// StopMaxTurns means the turn ended because the agent's tool loop
+	// reached its request limit (OptionMaxTurns).
+	StopMaxTurns StopReason = "max_turns"
+
 	// StopMaxTokens means the response was truncated due to token limits.
 	StopMaxTokens StopReason = "max_tokens"
 
@@ -207,6 +247,69 @@ const (
 	StopToolUse StopReason = "tool_use"
 )
 
+// ErrorCategory classifies a MessageError (or a Go error, see
+// [ErrorCategoryOf]) independently of the backend that produced it.
+// Backends map their native error codes to these values; consumers branch
+// on the category and keep ErrorCode for logging.
+//
+// Like StopReason, this is output vocabulary: consumers should treat
+// unknown values like an empty category.
+type ErrorCategory string
+
+const (
+	// CategoryRateLimited means a rate, usage or quota limit was hit.
+	// Retrying after the limit resets can succeed; see Message.RetryAfter.
+	CategoryRateLimited ErrorCategory = "rate_limited"
+
+	// CategoryAuth means authentication or authorization failed (missing
+	// login, invalid API key, forbidden). Retrying will not help.
+	CategoryAuth ErrorCategory = "auth"
+
+	// CategoryOverloaded means the provider is temporarily unable to serve
+	// (overloaded, unavailable, timeouts). Retrying later can succeed.
+	CategoryOverloaded ErrorCategory = "overloaded"
+
+	// CategoryContextExceeded means the conversation no longer fits in the
+	// model's context window.
+	CategoryContextExceeded ErrorCategory = "context_exceeded"
+
+	// CategoryInvalidRequest means the request was rejected as malformed
+	// or unsupported (bad parameters, unknown model).
+	CategoryInvalidRequest ErrorCategory = "invalid_request"
+
+	// CategoryToolFailed means a tool invocation failed.
+	CategoryToolFailed ErrorCategory = "tool_failed"
+
+	// CategoryInternal means the agent or provider failed internally.
+	CategoryInternal ErrorCategory = "internal"
+)
+
+// Transient reports whether errors of this category may succeed when
+// retried later (CategoryRateLimited, CategoryOverloaded).
+func (c ErrorCategory) Transient() bool {
+	return c == CategoryRateLimited || c == CategoryOverloaded
+}
+
+// RateLimit describes the state of a backend rate or usage limit.
+// Fields the backend did not report are zero.
+type RateLimit struct {
+	// Type is the backend's name for the limit, e.g. "five_hour" or
+	// "seven_day" (Claude), "primary" or "secondary" (Codex), "requests"
+	// or "tokens" (API engines). Empty when not reported.
+	Type string `json:"type,omitempty"`
+
+	// Exceeded is true when the limit is hit and requests are rejected
+	// until it resets. False for status and warning reports.
+	Exceeded bool `json:"exceeded,omitempty"`
+
+	// Utilization is the fraction of the limit consumed, from 0 to 1.
+	Utilization float64 `json:"utilization,omitempty"`
+
+	// ResetsAt is when the limit resets. Zero when the backend reported no
+	// absolute time; Message.RetryAfter may still carry a relative hint.
+	ResetsAt time.Time `json:"resets_at,omitzero"`
+}
+
 // Usage contains token usage data from the agent's model.
 type Usage struct {
 	// InputTokens is the number of input tokens consumed by the model for
@@ -294,6 +397,11 @@ type InitMeta struct {
 	// Currently populated by ACP backends only.
 	// Sanitized: control chars rejected, truncated to 128 bytes at parse time.
 	AgentVersion string `json:"agent_version,omitempty"`
+
+	// Engine names the engine that served the session when a composite
+	// engine chose among several (failover.Backend.Name).
+	// Empty for sessions started on a single engine.
+	Engine string `json:"engine,omitempty"`
 }
 
 // ProcessMeta describes the OS subprocess backing a session.
@@ -0,0 +1,24 @@
+package pool_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/pool"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		inner := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))
+		return pool.New(inner, pool.WithMaxActive(2)), agentrun.Session{}
+	})
+}
+
+func TestCompliance_ResumePerTurn(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		inner := fake.NewEngine(fake.WithResumePerTurn(), fake.WithDefaultTurn(fake.TextTurn("ok")))
+		return pool.New(inner, pool.WithMaxActive(2)), agentrun.Session{}
+	})
+}
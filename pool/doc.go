@@ -0,0 +1,33 @@
+// Package pool runs many agent sessions on one engine within concurrency
+// limits.
+//
+// [New] wraps an [agentrun.Engine]. Each Start takes a slot that is held
+// until the returned process ends (Stop, crash, or exit); Starts beyond
+// the limit wait in a queue and return ctx.Err() if ctx is done first.
+// Spawn-per-turn engines ([agentrun.Resumable]) keep the slot between
+// turns, until Stop or a turn that cannot be resumed.
+//
+//	p := pool.New(cli.NewEngine(claude.New()),
+//	    pool.WithMaxActive(32),
+//	    pool.WithDefaultKeyQuota(4),       // at most 4 sessions per repo
+//	    pool.WithKeyQuota("monorepo", 8),
+//	)
+//	proc, err := p.Start(ctx, agentrun.Session{
+//	    CWD: dir,
+//	    Options: map[string]string{
+//	        pool.OptionKey:      "acme/api",
+//	        pool.OptionPriority: "10",
+//	    },
+//	})
+//
+// Sessions are grouped by [OptionKey] (a tenant, repository, or any other
+// string) for per-key quotas. Queued Starts are served by [OptionPriority],
+// highest first; within a priority, the key with the fewest active
+// sessions goes first, so one busy key cannot starve the others, then the
+// earliest Start. Both options are removed before the session reaches the
+// wrapped engine.
+//
+// [Pool.Drain] shuts the pool down: queued and new Starts fail with
+// [ErrDraining] and every live process is stopped. [Pool.Stats] reports
+// active sessions and queue depth, overall and per key.
+package pool
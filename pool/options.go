@@ -0,0 +1,64 @@
+package pool
+
+// defaultMaxActive is the default limit on concurrent sessions.
+const defaultMaxActive = 8
+
+// Options holds resolved pool configuration.
+type Options struct {
+	// MaxActive is the number of sessions that may run at once (default 8).
+	// A session holds its slot from Start until its process ends.
+	MaxActive int
+
+	// KeyQuotas limits concurrent sessions per key. Keys without an entry
+	// use DefaultKeyQuota.
+	KeyQuotas map[string]int
+
+	// DefaultKeyQuota limits concurrent sessions for keys not in
+	// KeyQuotas. Zero means only MaxActive applies.
+	DefaultKeyQuota int
+}
+
+// Option configures a Pool.
+type Option func(*Options)
+
+// WithMaxActive sets the number of sessions that may run at once. Values
+// below 1 are ignored.
+func WithMaxActive(n int) Option {
+	return func(o *Options) {
+		if n >= 1 {
+			o.MaxActive = n
+		}
+	}
+}
+
+// WithKeyQuota limits concurrent sessions for key. Zero removes the limit
+// for key, even when a default quota is set; negative values are ignored.
+func WithKeyQuota(key string, n int) Option {
+	return func(o *Options) {
+		if n < 0 {
+			return
+		}
+		if o.KeyQuotas == nil {
+			o.KeyQuotas = make(map[string]int)
+		}
+		o.KeyQuotas[key] = n
+	}
+}
+
+// WithDefaultKeyQuota limits concurrent sessions for every key without
+// its own quota. Negative values are ignored.
+func WithDefaultKeyQuota(n int) Option {
+	return func(o *Options) {
+		if n >= 0 {
+			o.DefaultKeyQuota = n
+		}
+	}
+}
+
+// quota returns the concurrent session limit for key; 0 means none.
+func (o Options) quota(key string) int {
+	if n, ok := o.KeyQuotas[key]; ok {
+		return n
+	}
+	return o.DefaultKeyQuota
+}
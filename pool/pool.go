@@ -0,0 +1,326 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// Session option keys read by the pool. Namespaced with "pool." and
+// removed from the session before it reaches the wrapped engine.
+const (
+	// OptionKey names the tenant, repository or other group the session
+	// counts against for per-key quotas. Empty is a key of its own.
+	OptionKey = "pool.key"
+
+	// OptionPriority is a decimal integer; queued Starts with a higher
+	// priority are served first. Default 0.
+	OptionPriority = "pool.priority"
+)
+
+// ErrDraining is returned by Start once Drain has been called, including
+// to Starts that were queued at the time.
+var ErrDraining = errors.New("pool: draining")
+
+// Pool is an agentrun.Engine that limits how many sessions of the wrapped
+// engine run at once. Starts beyond the limits wait in a queue ordered by
+// priority; within a priority, the key with the fewest active sessions
+// goes first, then the earliest Start. A Pool is safe for concurrent use.
+type Pool struct {
+	inner agentrun.Engine
+	opts  Options
+
+	mu       sync.Mutex // guards the fields below
+	active   int
+	byKey    map[string]int // active sessions per key
+	queue    []*waiter
+	seq      uint64
+	procs    map[uint64]*Process // live processes by waiter seq
+	draining bool
+	drained  chan struct{} // closed when active reaches 0 after Drain
+}
+
+var _ agentrun.Engine = (*Pool)(nil)
+
+// waiter is a queued Start.
+type waiter struct {
+	key      string
+	priority int
+	seq      uint64
+	ready    chan struct{} // closed when granted a slot or rejected
+	err      error         // set before ready closes on rejection
+}
+
+// New wraps inner with the limits configured by opts.
+func New(inner agentrun.Engine, opts ...Option) *Pool {
+	o := Options{MaxActive: defaultMaxActive}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Pool{
+		inner: inner,
+		opts:  o,
+		byKey: make(map[string]int),
+		procs: make(map[uint64]*Process),
+	}
+}
+
+// Start waits for a slot, then starts the session on the wrapped engine.
+// The slot is held until the returned *Process is stopped or ends; a
+// process that can resume another turn keeps it between turns. Start
+// returns ctx.Err() if ctx is done while queued, and ErrDraining after
+// Drain.
+func (p *Pool) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	key, priority, session, err := splitOptions(session)
+	if err != nil {
+		return nil, err
+	}
+	w, err := p.acquire(ctx, key, priority)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := p.inner.Start(ctx, session, opts...)
+	if err != nil {
+		p.release(w)
+		return nil, err
+	}
+	proc := newProcess(inner)
+
+	p.mu.Lock()
+	draining := p.draining
+	if !draining {
+		p.procs[w.seq] = proc
+	}
+	p.mu.Unlock()
+	if draining {
+		_ = proc.Stop(ctx)
+		p.release(w)
+		return nil, ErrDraining
+	}
+
+	go func() {
+		proc.hold()
+		p.release(w)
+	}()
+	return proc, nil
+}
+
+// Validate delegates to the wrapped engine.
+func (p *Pool) Validate() error {
+	return p.inner.Validate()
+}
+
+// Drain rejects new and queued Starts with ErrDraining, stops every live
+// process, and waits until all have ended. It returns ctx.Err() if ctx is
+// done first; processes still stopping keep their slots until they end.
+// Drain may be called more than once.
+func (p *Pool) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.draining {
+		p.draining = true
+		p.drained = make(chan struct{})
+		for _, w := range p.queue {
+			w.err = ErrDraining
+			close(w.ready)
+		}
+		p.queue = nil
+		if p.active == 0 {
+			close(p.drained)
+		}
+	}
+	procs := make([]*Process, 0, len(p.procs))
+	for _, proc := range p.procs {
+		procs = append(procs, proc)
+	}
+	drained := p.drained
+	p.mu.Unlock()
+
+	for _, proc := range procs {
+		go func() { _ = proc.Stop(ctx) }()
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire takes a slot for key, queueing until one is free. The returned
+// waiter identifies the slot.
+func (p *Pool) acquire(ctx context.Context, key string, priority int) (*waiter, error) {
+	p.mu.Lock()
+	if p.draining {
+		p.mu.Unlock()
+		return nil, ErrDraining
+	}
+	p.seq++
+	w := &waiter{key: key, priority: priority, seq: p.seq, ready: make(chan struct{})}
+	p.queue = append(p.queue, w)
+	p.dispatch()
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return nil, w.err
+		}
+		return w, nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-w.ready:
+		// Granted (or rejected) while ctx ended; give the slot back.
+		if w.err == nil {
+			p.releaseLocked(w.key)
+		}
+	default:
+		p.remove(w)
+	}
+	return nil, ctx.Err()
+}
+
+// release frees w's slot and forgets its process.
+func (p *Pool) release(w *waiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.procs, w.seq)
+	p.releaseLocked(w.key)
+}
+
+func (p *Pool) releaseLocked(key string) {
+	p.active--
+	if p.byKey[key]--; p.byKey[key] <= 0 {
+		delete(p.byKey, key)
+	}
+	if p.draining {
+		if p.active == 0 {
+			close(p.drained)
+		}
+		return
+	}
+	p.dispatch()
+}
+
+// dispatch grants free slots to queued waiters. Callers hold mu.
+func (p *Pool) dispatch() {
+	for p.active < p.opts.MaxActive {
+		i := p.next()
+		if i < 0 {
+			return
+		}
+		w := p.queue[i]
+		p.queue = append(p.queue[:i], p.queue[i+1:]...)
+		p.active++
+		p.byKey[w.key]++
+		close(w.ready)
+	}
+}
+
+// next returns the index of the waiter to serve next, or -1 when every
+// queued key is at its quota. Order: higher priority, then fewer active
+// sessions for the key, then earlier arrival.
+func (p *Pool) next() int {
+	best := -1
+	for i, w := range p.queue {
+		if q := p.opts.quota(w.key); q > 0 && p.byKey[w.key] >= q {
+			continue
+		}
+		if best < 0 || p.before(w, p.queue[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func (p *Pool) before(a, b *waiter) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if na, nb := p.byKey[a.key], p.byKey[b.key]; na != nb {
+		return na < nb
+	}
+	return a.seq < b.seq
+}
+
+func (p *Pool) remove(w *waiter) {
+	for i, q := range p.queue {
+		if q == w {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// splitOptions extracts the pool options and returns the session without
+// them.
+func splitOptions(session agentrun.Session) (key string, priority int, _ agentrun.Session, _ error) {
+	key, hasKey := session.Options[OptionKey]
+	prio, hasPrio := session.Options[OptionPriority]
+	if !hasKey && !hasPrio {
+		return "", 0, session, nil
+	}
+	if hasPrio {
+		n, err := strconv.Atoi(prio)
+		if err != nil {
+			return "", 0, session, fmt.Errorf("pool: invalid %s %q: must be an integer", OptionPriority, prio)
+		}
+		priority = n
+	}
+	session = session.Clone()
+	delete(session.Options, OptionKey)
+	delete(session.Options, OptionPriority)
+	return key, priority, session, nil
+}
+
+// Stats is a snapshot of pool usage.
+type Stats struct {
+	Active   int                 // sessions holding a slot, including ones starting
+	Queued   int                 // Starts waiting for a slot
+	Max      int                 // MaxActive
+	Draining bool                // Drain has been called
+	Keys     map[string]KeyStats // per key; keys with no active or queued sessions are omitted
+}
+
+// KeyStats is a snapshot of one key's usage.
+type KeyStats struct {
+	Active int
+	Queued int
+	Quota  int // 0 means no per-key limit
+}
+
+// Stats returns a snapshot of pool usage.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := Stats{
+		Active:   p.active,
+		Queued:   len(p.queue),
+		Max:      p.opts.MaxActive,
+		Draining: p.draining,
+		Keys:     make(map[string]KeyStats),
+	}
+	for key, n := range p.byKey {
+		ks := s.Keys[key]
+		ks.Active = n
+		s.Keys[key] = ks
+	}
+	for _, w := range p.queue {
+		ks := s.Keys[w.key]
+		ks.Queued++
+		s.Keys[w.key] = ks
+	}
+	for key, ks := range s.Keys {
+		ks.Quota = p.opts.quota(key)
+		s.Keys[key] = ks
+	}
+	return s
+}
@@ -0,0 +1,305 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/pool"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func session(key string, priority int) agentrun.Session {
+	return agentrun.Session{Options: map[string]string{
+		pool.OptionKey:      key,
+		pool.OptionPriority: strconv.Itoa(priority),
+	}}
+}
+
+// result is the outcome of a Start run in the background.
+type result struct {
+	name string
+	proc agentrun.Process
+	err  error
+}
+
+// startAsync starts s in the background and waits until the pool has
+// queued it, so queue order is deterministic.
+func startAsync(t *testing.T, p *pool.Pool, ctx context.Context, name string, s agentrun.Session, out chan<- result) {
+	t.Helper()
+	queued := p.Stats().Queued
+	go func() {
+		proc, err := p.Start(ctx, s)
+		out <- result{name, proc, err}
+	}()
+	waitFor(t, func() bool { return p.Stats().Queued > queued })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func recv(t *testing.T, ch <-chan result) result {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for Start")
+		return result{}
+	}
+}
+
+func mustStart(t *testing.T, p *pool.Pool, s agentrun.Session) agentrun.Process {
+	t.Helper()
+	proc, err := p.Start(testCtx(t), s)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc
+}
+
+func stop(t *testing.T, proc agentrun.Process) {
+	t.Helper()
+	if err := proc.Stop(testCtx(t)); err != nil && !errors.Is(err, agentrun.ErrTerminated) {
+		t.Fatalf("Stop: %v", err)
+	}
+}
+
+func TestPool_LimitsActive(t *testing.T) {
+	p := pool.New(fake.NewEngine(), pool.WithMaxActive(2))
+	a := mustStart(t, p, agentrun.Session{})
+	mustStart(t, p, agentrun.Session{})
+
+	out := make(chan result, 1)
+	startAsync(t, p, testCtx(t), "c", agentrun.Session{}, out)
+	if s := p.Stats(); s.Active != 2 || s.Queued != 1 || s.Max != 2 {
+		t.Fatalf("Stats = %+v, want 2 active, 1 queued", s)
+	}
+
+	stop(t, a)
+	r := recv(t, out)
+	if r.err != nil {
+		t.Fatalf("queued Start: %v", r.err)
+	}
+	defer r.proc.Stop(context.Background())
+	if s := p.Stats(); s.Active != 2 || s.Queued != 0 {
+		t.Errorf("Stats = %+v, want 2 active, 0 queued", s)
+	}
+}
+
+func TestPool_PriorityOrder(t *testing.T) {
+	p := pool.New(fake.NewEngine(), pool.WithMaxActive(1))
+	first := mustStart(t, p, agentrun.Session{})
+
+	out := make(chan result, 3)
+	ctx := testCtx(t)
+	startAsync(t, p, ctx, "low", session("k", 0), out)
+	startAsync(t, p, ctx, "high", session("k", 5), out)
+	startAsync(t, p, ctx, "mid", session("k", 1), out)
+
+	prev := first
+	for _, want := range []string{"high", "mid", "low"} {
+		stop(t, prev)
+		r := recv(t, out)
+		if r.err != nil || r.name != want {
+			t.Fatalf("served %q (err %v), want %q", r.name, r.err, want)
+		}
+		prev = r.proc
+	}
+	stop(t, prev)
+}
+
+func TestPool_FairAcrossKeys(t *testing.T) {
+	p := pool.New(fake.NewEngine(), pool.WithMaxActive(2))
+	busy := mustStart(t, p, session("busy", 0))
+	mustStart(t, p, session("busy", 0))
+
+	out := make(chan result, 2)
+	ctx := testCtx(t)
+	startAsync(t, p, ctx, "busy", session("busy", 0), out)
+	startAsync(t, p, ctx, "quiet", session("quiet", 0), out)
+
+	stop(t, busy)
+	if r := recv(t, out); r.err != nil || r.name != "quiet" {
+		t.Fatalf("served %q (err %v), want the key with fewer active sessions", r.name, r.err)
+	} else {
+		defer r.proc.Stop(context.Background())
+	}
+	if s := p.Stats(); s.Keys["busy"].Queued != 1 {
+		t.Errorf("Stats.Keys = %+v, want busy still queued", s.Keys)
+	}
+}
+
+func TestPool_KeyQuota(t *testing.T) {
+	p := pool.New(fake.NewEngine(),
+		pool.WithMaxActive(10),
+		pool.WithDefaultKeyQuota(1),
+		pool.WithKeyQuota("big", 2),
+	)
+	a := mustStart(t, p, session("a", 0))
+	mustStart(t, p, session("big", 0))
+	mustStart(t, p, session("big", 0))
+
+	out := make(chan result, 2)
+	ctx := testCtx(t)
+	startAsync(t, p, ctx, "a2", session("a", 0), out)
+	startAsync(t, p, ctx, "big3", session("big", 9), out)
+	if s := p.Stats(); s.Active != 3 || s.Queued != 2 ||
+		s.Keys["a"] != (pool.KeyStats{Active: 1, Queued: 1, Quota: 1}) ||
+		s.Keys["big"] != (pool.KeyStats{Active: 2, Queued: 1, Quota: 2}) {
+		t.Fatalf("Stats = %+v", s)
+	}
+
+	stop(t, a)
+	if r := recv(t, out); r.err != nil || r.name != "a2" {
+		t.Fatalf("served %q (err %v), want a2 (big is at quota despite its priority)", r.name, r.err)
+	} else {
+		defer r.proc.Stop(context.Background())
+	}
+}
+
+func TestPool_CancelWhileQueued(t *testing.T) {
+	p := pool.New(fake.NewEngine(), pool.WithMaxActive(1))
+	mustStart(t, p, agentrun.Session{})
+
+	ctx, cancel := context.WithCancel(testCtx(t))
+	out := make(chan result, 1)
+	startAsync(t, p, ctx, "x", agentrun.Session{}, out)
+	cancel()
+	if r := recv(t, out); !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("Start = %v, want Canceled", r.err)
+	}
+	if s := p.Stats(); s.Active != 1 || s.Queued != 0 {
+		t.Errorf("Stats = %+v, want the canceled Start removed", s)
+	}
+}
+
+func TestPool_StartError(t *testing.T) {
+	want := errors.New("no binary")
+	p := pool.New(fake.NewEngine(fake.WithStartError(want)), pool.WithMaxActive(1))
+	if _, err := p.Start(testCtx(t), agentrun.Session{}); !errors.Is(err, want) {
+		t.Fatalf("Start = %v, want %v", err, want)
+	}
+	if s := p.Stats(); s.Active != 0 {
+		t.Errorf("Stats = %+v, want the slot released", s)
+	}
+}
+
+func TestPool_OptionsStripped(t *testing.T) {
+	inner := fake.NewEngine()
+	p := pool.New(inner)
+	s := session("repo", 3)
+	s.Options["other"] = "kept"
+	mustStart(t, p, s)
+
+	got := inner.Starts()[0].Options
+	if _, ok := got[pool.OptionKey]; ok || got[pool.OptionPriority] != "" || got["other"] != "kept" {
+		t.Errorf("inner options = %v, want pool options removed", got)
+	}
+	if s.Options[pool.OptionKey] != "repo" {
+		t.Error("caller's session was modified")
+	}
+}
+
+func TestPool_InvalidPriority(t *testing.T) {
+	p := pool.New(fake.NewEngine())
+	s := agentrun.Session{Options: map[string]string{pool.OptionPriority: "high"}}
+	if _, err := p.Start(testCtx(t), s); err == nil {
+		t.Fatal("Start with invalid priority succeeded")
+	}
+}
+
+func TestPool_Drain(t *testing.T) {
+	inner := fake.NewEngine()
+	p := pool.New(inner, pool.WithMaxActive(2))
+	a := mustStart(t, p, agentrun.Session{})
+	b := mustStart(t, p, agentrun.Session{})
+
+	out := make(chan result, 1)
+	startAsync(t, p, testCtx(t), "queued", agentrun.Session{}, out)
+
+	if err := p.Drain(testCtx(t)); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if r := recv(t, out); !errors.Is(r.err, pool.ErrDraining) {
+		t.Errorf("queued Start = %v, want ErrDraining", r.err)
+	}
+	for _, proc := range []agentrun.Process{a, b} {
+		if proc.Err() == nil {
+			t.Error("live process not stopped by Drain")
+		}
+	}
+	if _, err := p.Start(testCtx(t), agentrun.Session{}); !errors.Is(err, pool.ErrDraining) {
+		t.Errorf("Start after Drain = %v, want ErrDraining", err)
+	}
+	if s := p.Stats(); s.Active != 0 || s.Queued != 0 || !s.Draining {
+		t.Errorf("Stats = %+v, want empty and draining", s)
+	}
+	if err := p.Drain(testCtx(t)); err != nil {
+		t.Errorf("second Drain: %v", err)
+	}
+}
+
+func TestPool_DrainDeadline(t *testing.T) {
+	release := make(chan struct{})
+	p := pool.New(&slowStopEngine{Engine: fake.NewEngine(), release: release})
+	mustStart(t, p, agentrun.Session{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want DeadlineExceeded", err)
+	}
+	if s := p.Stats(); s.Active != 1 {
+		t.Errorf("Stats = %+v, want the stopping process to keep its slot", s)
+	}
+	close(release)
+	if err := p.Drain(testCtx(t)); err != nil {
+		t.Errorf("Drain after release: %v", err)
+	}
+}
+
+// slowStopEngine starts processes whose Stop blocks until release closes.
+type slowStopEngine struct {
+	*fake.Engine
+	release chan struct{}
+}
+
+func (e *slowStopEngine) Start(ctx context.Context, s agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	proc, err := e.Engine.Start(ctx, s, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &slowStopProcess{Process: proc, release: e.release}, nil
+}
+
+type slowStopProcess struct {
+	agentrun.Process
+	release chan struct{}
+}
+
+func (p *slowStopProcess) Stop(ctx context.Context) error {
+	<-p.release
+	return p.Process.Stop(ctx)
+}
@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// Process is an agentrun.Process created by Pool.Start. It forwards the
+// wrapped process unchanged and holds the pool slot until the session
+// ends: on a resume-per-turn engine (agentrun.Resumable) Wait returns
+// after every turn, so the slot is kept while a Send can resume it.
+type Process struct {
+	inner agentrun.Process
+
+	resumed  chan struct{} // signaled by each successful Send
+	stopped  chan struct{} // closed once Stop has stopped inner
+	stopOnce sync.Once
+}
+
+var _ agentrun.Process = (*Process)(nil)
+
+func newProcess(inner agentrun.Process) *Process {
+	return &Process{
+		inner:   inner,
+		resumed: make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Output returns the channel for receiving messages from the agent.
+func (p *Process) Output() <-chan agentrun.Message {
+	return p.inner.Output()
+}
+
+// Send forwards message to the wrapped process.
+func (p *Process) Send(ctx context.Context, message string) error {
+	if err := p.inner.Send(ctx, message); err != nil {
+		return err
+	}
+	select {
+	case p.resumed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Stop stops the wrapped process and releases its slot.
+func (p *Process) Stop(ctx context.Context) error {
+	err := p.inner.Stop(ctx)
+	p.stopOnce.Do(func() { close(p.stopped) })
+	return err
+}
+
+// Wait blocks until the wrapped process's Wait returns.
+func (p *Process) Wait() error {
+	return p.inner.Wait()
+}
+
+// Err returns the wrapped process's terminal error.
+func (p *Process) Err() error {
+	return p.inner.Err()
+}
+
+// Resumable reports whether the wrapped process can resume another turn.
+func (p *Process) Resumable() bool {
+	return agentrun.Resumable(p.inner)
+}
+
+// Unwrap returns the process started by the wrapped engine.
+func (p *Process) Unwrap() agentrun.Process {
+	return p.inner
+}
+
+// hold blocks until the session has ended: the wrapped process is
+// stopped, or its Wait returned and it cannot resume.
+func (p *Process) hold() {
+	for {
+		_ = p.inner.Wait()
+		if !agentrun.Resumable(p.inner) {
+			return
+		}
+		select {
+		case <-p.resumed:
+		case <-p.stopped:
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+//go:build !windows
+
+package pool_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/codex"
+	"github.com/dmora/agentrun/enginetest/clitest"
+	"github.com/dmora/agentrun/pool"
+)
+
+// TestPool_ResumePerTurnHoldsSlot runs a spawn-per-turn CLI engine, whose
+// Wait returns after every turn: the slot must stay taken between turns
+// and be released by Stop.
+func TestPool_ResumePerTurnHoldsSlot(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+match ^exec --json .*-- first$
+emit {"type":"thread.started","thread_id":"a1b2c3d4-e5f6-7890-abcd-ef1234567890"}
+emit {"type":"item.completed","item":{"id":"i1","type":"agent_message","text":"one"}}
+emit {"type":"turn.completed"}
+
+match ^exec resume --json .*-- \S+ (.*)$
+emit {"type":"item.completed","item":{"id":"i2","type":"agent_message","text":"re: ${1}"}}
+emit {"type":"turn.completed"}
+`)
+	p := pool.New(cli.NewEngine(codex.New(codex.WithBinary(agent.Path))), pool.WithMaxActive(1))
+	ctx := testCtx(t)
+	proc := mustStart(t, p, agentrun.Session{CWD: t.TempDir(), Prompt: "first"})
+	if !agentrun.Resumable(proc) {
+		t.Fatal("pooled process of a resume-per-turn engine is not Resumable")
+	}
+
+	var texts []string
+	for msg := range proc.Output() {
+		if msg.Type == agentrun.MessageText {
+			texts = append(texts, msg.Content)
+		}
+	}
+	if err := proc.Wait(); err != nil {
+		t.Fatalf("Wait after first turn: %v", err)
+	}
+
+	out := make(chan result, 1)
+	startAsync(t, p, ctx, "queued", agentrun.Session{CWD: t.TempDir(), Prompt: "first"}, out)
+	if s := p.Stats(); s.Active != 1 || s.Queued != 1 {
+		t.Fatalf("Stats between turns = %+v, want the slot still held", s)
+	}
+
+	err := agentrun.RunTurn(ctx, proc, "second", func(m agentrun.Message) error {
+		if m.Type == agentrun.MessageText {
+			texts = append(texts, m.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if want := []string{"one", "re: second"}; !slices.Equal(texts, want) {
+		t.Errorf("texts = %q, want %q", texts, want)
+	}
+	if s := p.Stats(); s.Active != 1 || s.Queued != 1 {
+		t.Fatalf("Stats after second turn = %+v, want the slot still held", s)
+	}
+
+	stop(t, proc)
+	r := recv(t, out)
+	if r.err != nil {
+		t.Fatalf("queued Start: %v", r.err)
+	}
+	stop(t, r.proc)
+}
@@ -17,7 +17,8 @@ import "context"
 // or retry middleware.
 type Process interface {
 	// Output returns the channel for receiving messages from the agent.
-	// The channel is closed when the session ends (normally or on error).
+	// The channel is closed when the session ends (normally or on error),
+	// or at the end of every turn for engines where [Resumable] is true.
 	// The first message may be of type MessageInit for engines that
 	// perform a handshake.
 	//
@@ -49,3 +50,17 @@ type Process interface {
 	// Output channel is closed to distinguish clean exit from failure.
 	Err() error
 }
+
+// Resumable reports whether proc's session continues after its Output
+// channel closes. Resume-per-turn CLI engines close Output at the end of
+// every turn and open a new channel on the next Send; wrappers that relay
+// Output use Resumable to tell the end of a turn from the end of the
+// session, and call Output again after the next Send.
+//
+// Returns the result of proc's Resumable() bool method, or false when
+// proc has none. The method must return false once the session has ended
+// for good: after Stop, or when the last turn failed.
+func Resumable(proc Process) bool {
+	r, ok := proc.(interface{ Resumable() bool })
+	return ok && r.Resumable()
+}
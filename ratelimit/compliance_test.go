@@ -0,0 +1,24 @@
+package ratelimit_test
+
+import (
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/ratelimit"
+)
+
+func TestCompliance(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		inner := fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok")))
+		return ratelimit.NewEngine(inner), agentrun.Session{}
+	})
+}
+
+func TestCompliance_ResumePerTurn(t *testing.T) {
+	enginetest.RunEngineTests(t, func(*testing.T) (agentrun.Engine, agentrun.Session) {
+		inner := fake.NewEngine(fake.WithResumePerTurn(), fake.WithDefaultTurn(fake.TextTurn("ok")))
+		return ratelimit.NewEngine(inner), agentrun.Session{}
+	})
+}
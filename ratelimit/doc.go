@@ -0,0 +1,23 @@
+// Package ratelimit holds new sessions while a backend's rate or usage
+// limit is exhausted.
+//
+// Backends report limits on [agentrun.Message]: a MessageSystem with a
+// RateLimit for status reports, and a MessageError with category
+// [agentrun.CategoryRateLimited] (and an exceeded RateLimit) when a limit
+// is hit. A [Gate] observes those messages and records when the limit
+// resets — RateLimit.ResetsAt when the backend reports it, otherwise
+// Message.RetryAfter, otherwise a fallback of one minute. [Gate.Wait]
+// blocks until then.
+//
+// [NewEngine] wraps an [agentrun.Engine] so every Process it starts feeds
+// its Output and Send errors to a Gate, and Start waits on that Gate:
+//
+//	gate := ratelimit.NewGate(0)
+//	eng := ratelimit.NewEngine(cli.NewEngine(claude.New()), ratelimit.WithGate(gate))
+//	proc, err := eng.Start(ctx, session) // waits while the limit is hit
+//
+// Share one Gate between engines that draw on the same account, so a
+// limit hit by one session holds new sessions on all of them. Running
+// sessions are not paused; Start returns early with an error wrapping
+// [context.DeadlineExceeded] when ctx expires before the reset.
+package ratelimit
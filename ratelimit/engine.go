@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/dmora/agentrun"
+)
+
+// Engine wraps an agentrun.Engine so Start waits while a rate limit is
+// hit and every started session reports limits to the Gate.
+type Engine struct {
+	inner agentrun.Engine
+	opts  Options
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine wraps inner with the Gate configured by opts.
+func NewEngine(inner agentrun.Engine, opts ...Option) *Engine {
+	var o Options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Gate == nil {
+		o.Gate = NewGate(0)
+	}
+	return &Engine{inner: inner, opts: o}
+}
+
+// Start waits for the Gate, then starts the session on the wrapped engine
+// and returns a *Process that reports limits to the Gate.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	if err := e.opts.Gate.Wait(ctx); err != nil {
+		return nil, err
+	}
+	proc, err := e.inner.Start(ctx, session, opts...)
+	if err != nil {
+		e.opts.Gate.ObserveError(err)
+		return nil, err
+	}
+	return newProcess(proc, e.opts.Gate), nil
+}
+
+// Validate delegates to the wrapped engine.
+func (e *Engine) Validate() error {
+	return e.inner.Validate()
+}
+
+// Gate returns the Gate the engine observes and waits on.
+func (e *Engine) Gate() *Gate {
+	return e.opts.Gate
+}
@@ -0,0 +1,120 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/ratelimit"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// limitedTurn fails the turn with a rate limit error carrying retryAfter.
+func limitedTurn(retryAfter time.Duration) fake.Turn {
+	return fake.Turn{Messages: []agentrun.Message{
+		{
+			Type:          agentrun.MessageError,
+			Content:       "rate limited",
+			ErrorCategory: agentrun.CategoryRateLimited,
+			RetryAfter:    retryAfter,
+			RateLimit:     &agentrun.RateLimit{Exceeded: true},
+		},
+		{Type: agentrun.MessageResult},
+	}}
+}
+
+func TestEngine_StartWaitsForReset(t *testing.T) {
+	inner := fake.NewEngine(fake.WithTurns(limitedTurn(50*time.Millisecond)), fake.WithDefaultTurn(fake.TextTurn("ok")))
+	eng := ratelimit.NewEngine(inner)
+	ctx := testCtx(t)
+
+	proc, err := eng.Start(ctx, agentrun.Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Stop(context.Background())
+	var got []agentrun.Message
+	if err := agentrun.RunTurn(ctx, proc, "hi", func(m agentrun.Message) error {
+		got = append(got, m)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(got); n < 2 || got[n-2].ErrorCategory != agentrun.CategoryRateLimited {
+		t.Fatalf("messages = %+v, want forwarded unchanged", got)
+	}
+
+	reset := eng.Gate().Until()
+	if time.Until(reset) <= 0 {
+		t.Fatalf("gate open after rate limit (Until %v)", reset)
+	}
+	proc2, err := eng.Start(ctx, agentrun.Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc2.Stop(context.Background())
+	if time.Now().Before(reset) {
+		t.Error("Start returned before the reset")
+	}
+}
+
+func TestEngine_SharedGate(t *testing.T) {
+	gate := ratelimit.NewGate(0)
+	a := ratelimit.NewEngine(fake.NewEngine(fake.WithDefaultTurn(limitedTurn(time.Hour))), ratelimit.WithGate(gate))
+	b := ratelimit.NewEngine(fake.NewEngine(fake.WithDefaultTurn(fake.TextTurn("ok"))), ratelimit.WithGate(gate))
+	ctx := testCtx(t)
+
+	proc, err := a.Start(ctx, agentrun.Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Stop(context.Background())
+	if err := agentrun.RunTurn(ctx, proc, "hi", func(agentrun.Message) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if _, err := b.Start(short, agentrun.Session{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Start on sibling engine = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestProcess_SendErrorClosesGate(t *testing.T) {
+	inner := fake.NewEngine(fake.WithDefaultTurn(fake.Turn{SendErr: &limitErr{retryAfter: time.Hour}}))
+	eng := ratelimit.NewEngine(inner)
+
+	proc, err := eng.Start(testCtx(t), agentrun.Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proc.Stop(context.Background())
+	if err := proc.Send(testCtx(t), "hi"); agentrun.ErrorCategoryOf(err) != agentrun.CategoryRateLimited {
+		t.Fatalf("Send = %v, want the rate limit error", err)
+	}
+	if time.Until(eng.Gate().Until()) < 59*time.Minute {
+		t.Errorf("Until = %v, want about an hour from now", eng.Gate().Until())
+	}
+}
+
+func TestEngine_StartErrorPassesThrough(t *testing.T) {
+	want := errors.New("no binary")
+	eng := ratelimit.NewEngine(fake.NewEngine(fake.WithStartError(want)))
+	if _, err := eng.Start(testCtx(t), agentrun.Session{}); !errors.Is(err, want) {
+		t.Fatalf("Start = %v, want %v", err, want)
+	}
+	if !eng.Gate().Until().IsZero() {
+		t.Error("gate closed by an unrelated start error")
+	}
+}
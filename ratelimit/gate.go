@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// defaultFallback is how long a Gate closes for a limit hit that reports
+// no reset time.
+const defaultFallback = time.Minute
+
+// Gate records when a rate limit resets. It is safe for concurrent use.
+type Gate struct {
+	fallback time.Duration
+
+	mu    sync.Mutex // guards until
+	until time.Time
+}
+
+// NewGate returns an open Gate. fallback is how long to close the gate
+// for a limit hit that reports neither a reset time nor a retry hint;
+// zero or negative means one minute.
+func NewGate(fallback time.Duration) *Gate {
+	if fallback <= 0 {
+		fallback = defaultFallback
+	}
+	return &Gate{fallback: fallback}
+}
+
+// Observe closes the gate until the reset time when msg reports a limit
+// that was hit: an exceeded RateLimit, or a rate_limited MessageError.
+// Other messages are ignored.
+func (g *Gate) Observe(msg agentrun.Message) {
+	rl := msg.RateLimit
+	hit := rl != nil && rl.Exceeded ||
+		msg.Type == agentrun.MessageError && msg.ErrorCategory == agentrun.CategoryRateLimited
+	if !hit {
+		return
+	}
+	var resetsAt time.Time
+	if rl != nil {
+		resetsAt = rl.ResetsAt
+	}
+	g.close(resetsAt, msg.RetryAfter, msg.Timestamp)
+}
+
+// ObserveError closes the gate when err reports a limit that was hit, as
+// the API engines' APIError does. See [agentrun.ErrorCategoryOf] and
+// [agentrun.RateLimitOf].
+func (g *Gate) ObserveError(err error) {
+	rl := agentrun.RateLimitOf(err)
+	if agentrun.ErrorCategoryOf(err) != agentrun.CategoryRateLimited && (rl == nil || !rl.Exceeded) {
+		return
+	}
+	var resetsAt time.Time
+	if rl != nil {
+		resetsAt = rl.ResetsAt
+	}
+	g.close(resetsAt, agentrun.RetryAfterOf(err), time.Time{})
+}
+
+// close moves the reset time to resetsAt, or to since+retryAfter, or to
+// now+fallback, whichever is known first. The reset time only moves
+// forward.
+func (g *Gate) close(resetsAt time.Time, retryAfter time.Duration, since time.Time) {
+	if resetsAt.IsZero() {
+		if since.IsZero() {
+			since = time.Now()
+		}
+		if retryAfter <= 0 {
+			retryAfter = g.fallback
+		}
+		resetsAt = since.Add(retryAfter)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if resetsAt.After(g.until) {
+		g.until = resetsAt
+	}
+}
+
+// Until returns when the gate opens. A time in the past (or the zero
+// time) means it is open.
+func (g *Gate) Until() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.until
+}
+
+// Wait blocks until the gate is open or ctx is done. When ctx has a
+// deadline before the reset, Wait returns at once with an error wrapping
+// [context.DeadlineExceeded].
+func (g *Gate) Wait(ctx context.Context) error {
+	for {
+		until := g.Until()
+		d := time.Until(until)
+		if d <= 0 {
+			return nil
+		}
+		if dl, ok := ctx.Deadline(); ok && dl.Before(until) {
+			return fmt.Errorf("ratelimit: limit resets at %s, after the deadline: %w",
+				until.Format(time.RFC3339), context.DeadlineExceeded)
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+			// The reset may have moved while waiting; check again.
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("ratelimit: waiting for reset at %s: %w",
+				until.Format(time.RFC3339), ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/ratelimit"
+)
+
+func TestGate_Observe(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	resetsAt := ts.Add(time.Hour)
+	tests := []struct {
+		name string
+		msg  agentrun.Message
+		want time.Time // zero means the gate stays open
+	}{
+		{
+			name: "exceeded limit with reset time",
+			msg: agentrun.Message{Type: agentrun.MessageSystem, Timestamp: ts,
+				RateLimit: &agentrun.RateLimit{Type: "five_hour", Exceeded: true, ResetsAt: resetsAt}},
+			want: resetsAt,
+		},
+		{
+			name: "rate limited error with retry hint",
+			msg: agentrun.Message{Type: agentrun.MessageError, Timestamp: ts,
+				ErrorCategory: agentrun.CategoryRateLimited, RetryAfter: 30 * time.Second},
+			want: ts.Add(30 * time.Second),
+		},
+		{
+			name: "rate limited error without hint",
+			msg: agentrun.Message{Type: agentrun.MessageError, Timestamp: ts,
+				ErrorCategory: agentrun.CategoryRateLimited, RateLimit: &agentrun.RateLimit{Exceeded: true}},
+			want: ts.Add(2 * time.Minute),
+		},
+		{
+			name: "warning",
+			msg: agentrun.Message{Type: agentrun.MessageSystem, Timestamp: ts,
+				RateLimit: &agentrun.RateLimit{Utilization: 0.9, ResetsAt: resetsAt}},
+		},
+		{
+			name: "other error",
+			msg: agentrun.Message{Type: agentrun.MessageError, Timestamp: ts,
+				ErrorCategory: agentrun.CategoryOverloaded, RetryAfter: time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := ratelimit.NewGate(2 * time.Minute)
+			g.Observe(tt.msg)
+			if got := g.Until(); !got.Equal(tt.want) {
+				t.Errorf("Until = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGate_OnlyMovesForward(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	g := ratelimit.NewGate(0)
+	g.Observe(limited(ts.Add(time.Hour)))
+	g.Observe(limited(ts.Add(time.Minute)))
+	if got := g.Until(); !got.Equal(ts.Add(time.Hour)) {
+		t.Errorf("Until = %v, want %v", got, ts.Add(time.Hour))
+	}
+}
+
+// limitErr reports a rate limit like the API engines' APIError.
+type limitErr struct{ retryAfter time.Duration }
+
+func (e *limitErr) Error() string                         { return "429" }
+func (e *limitErr) ErrorCategory() agentrun.ErrorCategory { return agentrun.CategoryRateLimited }
+func (e *limitErr) RetryAfter() time.Duration             { return e.retryAfter }
+
+func TestGate_ObserveError(t *testing.T) {
+	g := ratelimit.NewGate(0)
+	g.ObserveError(errors.New("boom"))
+	if !g.Until().IsZero() {
+		t.Fatalf("Until = %v after unrelated error, want zero", g.Until())
+	}
+
+	before := time.Now()
+	g.ObserveError(&limitErr{retryAfter: time.Hour})
+	if got := g.Until(); got.Before(before.Add(time.Hour)) || got.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Until = %v, want about an hour from now", got)
+	}
+}
+
+func TestGate_Wait(t *testing.T) {
+	g := ratelimit.NewGate(0)
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait on open gate: %v", err)
+	}
+
+	reset := time.Now().Add(30 * time.Millisecond)
+	g.Observe(limited(reset))
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if time.Now().Before(reset) {
+		t.Error("Wait returned before the reset")
+	}
+}
+
+func TestGate_WaitDeadlineBeforeReset(t *testing.T) {
+	g := ratelimit.NewGate(0)
+	g.Observe(limited(time.Now().Add(time.Hour)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	start := time.Now()
+	err := g.Wait(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want DeadlineExceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Wait blocked although the deadline is before the reset")
+	}
+}
+
+func TestGate_WaitCanceled(t *testing.T) {
+	g := ratelimit.NewGate(0)
+	g.Observe(limited(time.Now().Add(time.Hour)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if err := g.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait = %v, want Canceled", err)
+	}
+}
+
+// limited returns a message reporting a limit hit until resetsAt.
+func limited(resetsAt time.Time) agentrun.Message {
+	return agentrun.Message{
+		Type:      agentrun.MessageSystem,
+		RateLimit: &agentrun.RateLimit{Exceeded: true, ResetsAt: resetsAt},
+	}
+}
@@ -0,0 +1,21 @@
+package ratelimit
+
+// Options holds resolved Engine configuration.
+type Options struct {
+	// Gate records limits hit by the engine's sessions and holds Start
+	// until they reset. Defaults to a new Gate per Engine.
+	Gate *Gate
+}
+
+// Option configures an Engine.
+type Option func(*Options)
+
+// WithGate sets the Gate the engine observes and waits on. Pass the same
+// Gate to engines that share an account. A nil g is ignored.
+func WithGate(g *Gate) Option {
+	return func(o *Options) {
+		if g != nil {
+			o.Gate = g
+		}
+	}
+}
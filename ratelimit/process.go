@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/dmora/agentrun"
+)
+
+// Process is an agentrun.Process created by Engine.Start. It forwards the
+// wrapped process unchanged and reports its messages and Send errors to
+// the Gate.
+type Process struct {
+	inner agentrun.Process
+	gate  *Gate
+
+	output  chan agentrun.Message
+	done    chan struct{}
+	stop    chan struct{}
+	resumed chan struct{} // signaled by each successful Send
+
+	termErr  error
+	stopOnce sync.Once
+}
+
+var _ agentrun.Process = (*Process)(nil)
+
+func newProcess(inner agentrun.Process, gate *Gate) *Process {
+	p := &Process{
+		inner:   inner,
+		gate:    gate,
+		output:  make(chan agentrun.Message),
+		done:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		resumed: make(chan struct{}, 1),
+	}
+	go p.forward()
+	return p
+}
+
+// Output returns the channel for receiving messages from the agent.
+func (p *Process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send forwards message to the wrapped process.
+func (p *Process) Send(ctx context.Context, message string) error {
+	err := p.inner.Send(ctx, message)
+	if err != nil {
+		p.gate.ObserveError(err)
+		return err
+	}
+	select {
+	case p.resumed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Stop stops the wrapped process. Idempotent; blocks until Output is
+// closed and returns the terminal error.
+func (p *Process) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		_ = p.inner.Stop(ctx)
+	})
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *Process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// forward relays the wrapped Output until the session ends. A
+// resume-per-turn process (agentrun.Resumable) closes Output after every
+// turn; forward then waits for the next Send and reads the new channel.
+// After Stop it keeps draining, so the wrapped process can exit, but
+// delivers nothing.
+func (p *Process) forward() {
+	discard := false
+	for {
+		for msg := range p.inner.Output() {
+			p.gate.Observe(msg)
+			if !discard && !p.emit(msg) {
+				discard = true
+			}
+		}
+		if !p.resumes() {
+			break
+		}
+	}
+	err := p.inner.Err()
+	if err != nil {
+		p.gate.ObserveError(err)
+	}
+	p.termErr = err
+	close(p.done)
+	close(p.output)
+}
+
+// resumes reports whether the wrapped process goes on after its Output
+// closed: it is resumable and a Send resumed it before Stop.
+func (p *Process) resumes() bool {
+	if !agentrun.Resumable(p.inner) {
+		return false
+	}
+	select {
+	case <-p.resumed:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// emit sends msg on Output. Returns false if Stop was called first.
+func (p *Process) emit(msg agentrun.Message) bool {
+	select {
+	case p.output <- msg:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
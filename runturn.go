@@ -11,6 +11,9 @@ import "context"
 // returns an error, the drain stops and RunTurn returns the Send error.
 // If the handler returns an error, the drain stops and RunTurn returns it.
 // If the channel closes without MessageResult, RunTurn returns proc.Err().
+// A channel that closes while Send is still in flight is re-read after
+// Send returns, for resume-per-turn engines (see [Resumable]) that open a
+// new channel for each turn.
 // Context cancellation stops both Send and the drain.
 //
 // The caller should provide a context with a deadline or timeout. The Send
@@ -31,10 +34,28 @@ func RunTurn(ctx context.Context, proc Process, message string, handler func(Mes
 // or context cancellation. Checks sendCh for Send errors.
 func drainOutput(ctx context.Context, proc Process, sendCh <-chan error, handler func(Message) error) error {
 	for {
+		out := proc.Output()
 		select {
-		case msg, ok := <-proc.Output():
+		case msg, ok := <-out:
 			if !ok {
-				return channelClosed(proc, sendCh)
+				if sendCh == nil {
+					return proc.Err()
+				}
+				// Resume-per-turn engines close the previous turn's
+				// channel and open a new one when Send starts the turn.
+				select {
+				case err := <-sendCh:
+					if err != nil {
+						return err
+					}
+					sendCh = nil
+					if proc.Output() != out {
+						continue
+					}
+					return proc.Err()
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
 			if err := handler(msg); err != nil {
 				return err
@@ -55,15 +76,6 @@ func drainOutput(ctx context.Context, proc Process, sendCh <-chan error, handler
 	}
 }
 
-// channelClosed handles Output() channel close: returns Send error if any,
-// otherwise returns proc.Err().
-func channelClosed(proc Process, sendCh <-chan error) error {
-	if err := collectSendError(sendCh); err != nil {
-		return err
-	}
-	return proc.Err()
-}
-
 // collectSendError drains the Send error channel without blocking.
 func collectSendError(sendCh <-chan error) error {
 	select {
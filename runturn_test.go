@@ -3,6 +3,7 @@ package agentrun
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 )
@@ -218,3 +219,60 @@ func TestRunTurn_MessagePassthrough(t *testing.T) {
 		t.Fatal("timed out waiting for Send to be called")
 	}
 }
+
+// resumingProcess closes Output after every turn and opens a new channel
+// on Send, like resume-per-turn CLI engines.
+type resumingProcess struct {
+	mockProcess
+	mu  sync.Mutex
+	cur chan Message
+}
+
+func (p *resumingProcess) Output() <-chan Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cur
+}
+
+func (p *resumingProcess) Send(_ context.Context, message string) error {
+	time.Sleep(5 * time.Millisecond) // let RunTurn see the closed channel first
+	ch := make(chan Message, 2)
+	ch <- Message{Type: MessageText, Content: message}
+	ch <- Message{Type: MessageResult}
+	close(ch)
+	p.mu.Lock()
+	p.cur = ch
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *resumingProcess) Resumable() bool { return true }
+
+func TestRunTurn_ResumedOutput(t *testing.T) {
+	prev := make(chan Message)
+	close(prev) // the previous turn's channel
+	p := &resumingProcess{mockProcess: *newMockProcess(), cur: prev}
+
+	for _, prompt := range []string{"second", "third"} {
+		var msgs []Message
+		err := RunTurn(context.Background(), p, prompt, func(msg Message) error {
+			msgs = append(msgs, msg)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("RunTurn(%q): %v", prompt, err)
+		}
+		if len(msgs) != 2 || msgs[0].Content != prompt || msgs[1].Type != MessageResult {
+			t.Fatalf("RunTurn(%q) msgs = %v, want the new turn's text and result", prompt, msgs)
+		}
+	}
+}
+
+func TestResumable(t *testing.T) {
+	if !Resumable(&resumingProcess{}) {
+		t.Error("Resumable = false for a process reporting true")
+	}
+	if Resumable(newMockProcess()) {
+		t.Error("Resumable = true for a process without the method")
+	}
+}
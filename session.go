@@ -76,7 +76,8 @@ const (
 	// OptionAddDirs specifies additional directories the agent may access
 	// beyond CWD. Value is newline-separated absolute paths.
 	//
-	// Backend support: Claude (--add-dir), Codex (--add-dir).
+	// Backend support: Claude (--add-dir), Codex (--add-dir),
+	// Gemini (--include-directories).
 	// Backends without directory scoping silently ignore this option.
 	OptionAddDirs = "add_dirs"
 )
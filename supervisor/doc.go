@@ -0,0 +1,29 @@
+// Package supervisor restarts agent sessions that crash mid-turn.
+//
+// [NewEngine] wraps an [agentrun.Engine]. Every Process it starts watches
+// the wrapped process: when Output closes with a retryable error (by
+// default an [agentrun.ExitError] or [agentrun.ErrNoResult]), it starts a
+// new process on the same engine with [agentrun.OptionResumeID] set to
+// the last ResumeID seen on MessageInit, after an exponential backoff.
+// Consumers keep reading the same Output channel and calling Send on the
+// same Process; each recovery is announced with a MessageSystem notice.
+// On spawn-per-turn engines ([agentrun.Resumable]) the end of each turn
+// closes only the wrapped process's Output; the session lives on.
+//
+//	eng := supervisor.NewEngine(cli.NewEngine(claude.New()),
+//	    supervisor.WithMaxRetries(5),
+//	    supervisor.WithResend(true),
+//	)
+//	proc, err := eng.Start(ctx, session)
+//	err = agentrun.RunTurn(ctx, proc, "fix the tests", handle)
+//
+// With [WithResend], the prompt of the interrupted turn is sent to the
+// restarted process, so a RunTurn in flight completes on the new process.
+// Without it the turn is abandoned and the next Send goes to the new
+// process. A session that crashed before reporting a ResumeID is started
+// afresh.
+//
+// The retry budget counts consecutive restarts without a completed turn;
+// every MessageResult refills it. Errors from the first Start are
+// returned as is — supervision begins once a session is running.
+package supervisor
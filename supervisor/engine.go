@@ -0,0 +1,58 @@
+package supervisor
+
+import (
+	"context"
+
+	"github.com/dmora/agentrun"
+)
+
+// Engine wraps an agentrun.Engine so every started session is supervised.
+type Engine struct {
+	inner agentrun.Engine
+	opts  Options
+}
+
+var _ agentrun.Engine = (*Engine)(nil)
+
+// NewEngine wraps inner with supervision configured by opts.
+func NewEngine(inner agentrun.Engine, opts ...Option) *Engine {
+	o := Options{
+		MaxRetries: defaultMaxRetries,
+		Backoff:    defaultBackoff,
+		MaxBackoff: defaultMaxBackoff,
+		Retryable:  Retryable,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Engine{inner: inner, opts: o}
+}
+
+// Start starts the session on the wrapped engine and returns a
+// supervising *Process. Start options are folded into the session so
+// restarts reuse the model and timeout but not the original prompt.
+func (e *Engine) Start(ctx context.Context, session agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	startOpts := agentrun.ResolveOptions(opts...)
+	session = session.Clone()
+	if startOpts.Prompt != "" {
+		session.Prompt = startOpts.Prompt
+	}
+	if startOpts.Model != "" {
+		session.Model = startOpts.Model
+	}
+	var restartOpts []agentrun.Option
+	if startOpts.Timeout > 0 {
+		restartOpts = append(restartOpts, agentrun.WithTimeout(startOpts.Timeout))
+	}
+
+	proc, err := e.inner.Start(ctx, session, restartOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return newProcess(e, session, restartOpts, proc), nil
+}
+
+// Validate delegates to the wrapped engine.
+func (e *Engine) Validate() error {
+	return e.inner.Validate()
+}
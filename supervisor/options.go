@@ -0,0 +1,100 @@
+package supervisor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// Default supervision values.
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = 30 * time.Second
+	backoffMultiplier = 2
+)
+
+// Options holds resolved supervision configuration.
+type Options struct {
+	// MaxRetries is the number of consecutive restarts allowed without a
+	// completed turn (default 3). Zero disables restarts.
+	MaxRetries int
+
+	// Backoff is the wait before the first restart; it doubles for each
+	// further consecutive restart, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable reports whether a terminal error warrants a restart. The
+	// default is [Retryable].
+	Retryable func(error) bool
+
+	// Resend sends the prompt of the interrupted turn to the restarted
+	// process.
+	Resend bool
+}
+
+// Option configures supervision.
+type Option func(*Options)
+
+// WithMaxRetries sets the number of consecutive restarts allowed without
+// a completed turn. Negative values are ignored.
+func WithMaxRetries(n int) Option {
+	return func(o *Options) {
+		if n >= 0 {
+			o.MaxRetries = n
+		}
+	}
+}
+
+// WithBackoff sets the initial restart delay and its cap. Negative values
+// are ignored.
+func WithBackoff(initial, maxDelay time.Duration) Option {
+	return func(o *Options) {
+		if initial >= 0 {
+			o.Backoff = initial
+		}
+		if maxDelay >= 0 {
+			o.MaxBackoff = maxDelay
+		}
+	}
+}
+
+// WithRetryable replaces the error classifier. A nil fn is ignored.
+func WithRetryable(fn func(error) bool) Option {
+	return func(o *Options) {
+		if fn != nil {
+			o.Retryable = fn
+		}
+	}
+}
+
+// WithResend controls whether the interrupted turn's prompt is re-sent to
+// the restarted process (default false).
+func WithResend(on bool) Option {
+	return func(o *Options) {
+		o.Resend = on
+	}
+}
+
+// Retryable is the default classifier: unexpected subprocess exits
+// ([agentrun.ExitError]) and processes that ended without a result
+// ([agentrun.ErrNoResult]). User stops ([agentrun.ErrTerminated]) are
+// never retried.
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, agentrun.ErrTerminated) {
+		return false
+	}
+	var exitErr *agentrun.ExitError
+	return errors.As(err, &exitErr) || errors.Is(err, agentrun.ErrNoResult)
+}
+
+// delay returns the backoff before restart attempt n (from 1).
+func (o Options) delay(n int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < n && d < o.MaxBackoff; i++ {
+		d *= backoffMultiplier
+	}
+	return min(d, o.MaxBackoff)
+}
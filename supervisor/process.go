@@ -0,0 +1,446 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmora/agentrun"
+)
+
+// generation is one process started for the session.
+type generation struct {
+	proc    agentrun.Process
+	dead    chan struct{} // closed after proc's Output has closed for good
+	resumed chan struct{} // signaled by each successful Send
+
+	// lost carries the error of a failed resend of the interrupted turn;
+	// relay forwards it to Output.
+	lost chan agentrun.Message
+}
+
+func newGeneration(proc agentrun.Process) *generation {
+	return &generation{
+		proc:    proc,
+		dead:    make(chan struct{}),
+		resumed: make(chan struct{}, 1),
+		lost:    make(chan agentrun.Message, 1),
+	}
+}
+
+// sent records a successful Send, which opens a new Output channel on
+// resume-per-turn engines.
+func (g *generation) sent() {
+	select {
+	case g.resumed <- struct{}{}:
+	default:
+	}
+}
+
+// Process is a supervised agentrun.Process created by Engine.Start. One
+// goroutine relays the current generation's Output and restarts the
+// session when it ends with a retryable error.
+type Process struct {
+	eng       *Engine
+	session   agentrun.Session // restart template, without the prompt
+	startOpts []agentrun.Option
+
+	ctx    context.Context // canceled when the process ends or is stopped
+	cancel context.CancelFunc
+
+	output chan agentrun.Message
+	done   chan struct{}
+	stop   chan struct{}
+
+	mu       sync.Mutex // guards the fields below
+	cur      *generation
+	ready    chan struct{} // closed when cur is replaced after a restart
+	pending  string        // prompt of the turn in flight
+	resumeID string
+	restarts int
+	stopping bool
+
+	termErr  error
+	stopOnce sync.Once
+}
+
+var _ agentrun.Process = (*Process)(nil)
+
+func newProcess(e *Engine, session agentrun.Session, startOpts []agentrun.Option, proc agentrun.Process) *Process {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Process{
+		eng:       e,
+		session:   session,
+		startOpts: startOpts,
+		ctx:       ctx,
+		cancel:    cancel,
+		output:    make(chan agentrun.Message),
+		done:      make(chan struct{}),
+		stop:      make(chan struct{}),
+		cur:       newGeneration(proc),
+		ready:     make(chan struct{}),
+		pending:   session.Prompt,
+	}
+	go p.run(p.cur)
+	return p
+}
+
+// Output returns the channel for receiving messages from the agent. It
+// spans restarts and closes when the session ends for good.
+func (p *Process) Output() <-chan agentrun.Message {
+	return p.output
+}
+
+// Send transmits message to the current process. During a restart it
+// waits for the new process. If the process dies under Send, Send waits
+// for the restart and then re-sends, or returns nil when the restart
+// re-sends it itself (WithResend).
+func (p *Process) Send(ctx context.Context, message string) error {
+	g, err := p.acquire(ctx, message)
+	if err != nil {
+		return err
+	}
+	err = g.proc.Send(ctx, message)
+	if err == nil {
+		g.sent()
+	}
+	if !errors.Is(err, agentrun.ErrTerminated) {
+		return err
+	}
+	select {
+	case <-g.dead:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	next, err := p.acquire(ctx, message)
+	if err != nil {
+		return err
+	}
+	if p.eng.opts.Resend {
+		return nil
+	}
+	if err := next.proc.Send(ctx, message); err != nil {
+		return err
+	}
+	next.sent()
+	return nil
+}
+
+// acquire waits for a live generation and records message as the turn in
+// flight, atomically, so a restart that begins afterwards resends it.
+func (p *Process) acquire(ctx context.Context, message string) (*generation, error) {
+	for {
+		p.mu.Lock()
+		if p.stopping || p.ended() {
+			p.mu.Unlock()
+			return nil, agentrun.ErrTerminated
+		}
+		if g := p.cur; g != nil {
+			p.pending = message
+			p.mu.Unlock()
+			return g, nil
+		}
+		ready := p.ready
+		p.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-p.done:
+			return nil, agentrun.ErrTerminated
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Stop stops the current process and ends supervision. Idempotent;
+// blocks until Output is closed.
+func (p *Process) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopping = true
+		g := p.cur
+		p.mu.Unlock()
+		close(p.stop)
+		p.cancel() // abort a restart in progress
+		if g != nil {
+			_ = g.proc.Stop(ctx)
+		}
+	})
+	<-p.done
+	return p.termErr
+}
+
+// Wait blocks until the session ends for good.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.termErr
+}
+
+// Err returns the terminal error, or nil if still running.
+func (p *Process) Err() error {
+	select {
+	case <-p.done:
+		return p.termErr
+	default:
+		return nil
+	}
+}
+
+// ResumeID returns the last non-empty ResumeID seen on MessageInit.
+func (p *Process) ResumeID() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumeID
+}
+
+// Restarts returns the number of successful restarts so far.
+func (p *Process) Restarts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.restarts
+}
+
+// run relays each generation until the session ends for good.
+func (p *Process) run(g *generation) {
+	attempts := 0
+	for {
+		err := p.relay(g, &attempts)
+
+		p.mu.Lock()
+		p.cur = nil
+		p.ready = make(chan struct{})
+		stopping := p.stopping
+		p.mu.Unlock()
+		close(g.dead)
+
+		if stopping || !p.eng.opts.Retryable(err) {
+			p.finish(err)
+			return
+		}
+		next, err := p.restart(err, &attempts)
+		if next == nil {
+			p.finish(err)
+			return
+		}
+		g = next
+	}
+}
+
+// relay forwards g's Output until the process ends and returns its
+// terminal error. A resume-per-turn process (agentrun.Resumable) closes
+// Output after every turn; relay then waits for the next Send and reads
+// the new channel. A MessageResult ends the turn in flight and refills
+// the retry budget.
+func (p *Process) relay(g *generation, attempts *int) error {
+	discard := false
+	for {
+		p.relayTurn(g, attempts, &discard)
+		if !agentrun.Resumable(g.proc) || !p.awaitSend(g, &discard) {
+			return g.proc.Err()
+		}
+	}
+}
+
+// awaitSend waits between turns for the next successful Send on g,
+// forwarding a failed resend's error meanwhile. Returns false if Stop
+// was called first.
+func (p *Process) awaitSend(g *generation, discard *bool) bool {
+	for {
+		select {
+		case <-g.resumed:
+			return true
+		case msg := <-g.lost:
+			p.forward(msg, discard)
+		case <-p.stop:
+			return false
+		}
+	}
+}
+
+// relayTurn forwards one Output channel of g, and any failed resend,
+// until the channel closes.
+func (p *Process) relayTurn(g *generation, attempts *int, discard *bool) {
+	out := g.proc.Output()
+	for {
+		var msg agentrun.Message
+		select {
+		case m, ok := <-out:
+			if !ok {
+				return
+			}
+			msg = m
+		case msg = <-g.lost:
+		}
+		switch msg.Type {
+		case agentrun.MessageInit:
+			if msg.ResumeID != "" {
+				p.mu.Lock()
+				p.resumeID = msg.ResumeID
+				p.mu.Unlock()
+			}
+		case agentrun.MessageResult:
+			*attempts = 0
+			p.mu.Lock()
+			p.pending = ""
+			p.mu.Unlock()
+		}
+		p.forward(msg, discard)
+	}
+}
+
+// forward emits msg unless Stop was called. After Stop, relay keeps
+// draining so the process can exit.
+func (p *Process) forward(msg agentrun.Message, discard *bool) {
+	if !*discard && !p.emit(msg) {
+		*discard = true
+	}
+}
+
+// restart starts a replacement process with backoff until one starts,
+// the retry budget runs out, or Stop is called. It returns nil and the
+// error to end with on failure.
+func (p *Process) restart(cause error, attempts *int) (*generation, error) {
+	opts := p.eng.opts
+	for *attempts < opts.MaxRetries {
+		*attempts++
+		delay := opts.delay(*attempts)
+		p.notice(fmt.Sprintf("supervisor: session ended: %v; restarting in %v (attempt %d of %d)",
+			cause, delay, *attempts, opts.MaxRetries))
+		if !p.sleep(delay) {
+			return nil, agentrun.ErrTerminated
+		}
+
+		session, id, pending := p.restartSession()
+		proc, err := p.eng.inner.Start(p.ctx, session, p.startOpts...)
+		if err != nil {
+			if p.stopped() {
+				return nil, agentrun.ErrTerminated
+			}
+			cause = err
+			continue
+		}
+
+		p.mu.Lock()
+		if p.stopping {
+			p.mu.Unlock()
+			_ = proc.Stop(context.Background())
+			return nil, agentrun.ErrTerminated
+		}
+		g := newGeneration(proc)
+		p.cur = g
+		p.restarts++
+		close(p.ready)
+		p.mu.Unlock()
+
+		if id != "" {
+			p.notice("supervisor: resumed session " + id)
+		} else {
+			p.notice("supervisor: started a new session (no resume ID)")
+		}
+		if opts.Resend && pending != "" {
+			// Not every engine runs Session.Prompt, and Send may block
+			// for the whole turn while relay reads its Output.
+			go p.resend(g, pending)
+		}
+		return g, nil
+	}
+	return nil, cause
+}
+
+// restartSession returns the session to restart with, the resume ID it
+// carries and the prompt of the interrupted turn.
+func (p *Process) restartSession() (agentrun.Session, string, string) {
+	p.mu.Lock()
+	id, pending := p.resumeID, p.pending
+	p.mu.Unlock()
+
+	session := p.session.Clone()
+	session.Prompt = ""
+	if id != "" {
+		if session.Options == nil {
+			session.Options = make(map[string]string)
+		}
+		session.Options[agentrun.OptionResumeID] = id
+	}
+	return session, id, pending
+}
+
+// resend sends the interrupted turn to g. If g dies first, the next
+// restart resends it again; any other failure reaches relay through
+// g.lost.
+func (p *Process) resend(g *generation, message string) {
+	err := g.proc.Send(p.ctx, message)
+	if err == nil {
+		g.sent()
+		return
+	}
+	if errors.Is(err, agentrun.ErrTerminated) || p.ctx.Err() != nil {
+		return
+	}
+	g.lost <- agentrun.Message{
+		Type:          agentrun.MessageError,
+		Content:       "supervisor: resend: " + err.Error(),
+		ErrorCategory: agentrun.ErrorCategoryOf(err),
+		Timestamp:     time.Now(),
+	}
+}
+
+// notice emits a MessageSystem about a recovery step.
+func (p *Process) notice(content string) {
+	p.emit(agentrun.Message{Type: agentrun.MessageSystem, Content: content, Timestamp: time.Now()})
+}
+
+// emit sends msg on Output. Returns false if Stop was called first.
+func (p *Process) emit(msg agentrun.Message) bool {
+	select {
+	case p.output <- msg:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// sleep waits for d. Returns false if Stop was called first.
+func (p *Process) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return !p.stopped()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// finish sets the terminal error and closes done, then output, so Err is
+// stable by the time a consumer sees Output closed. Called once, by run.
+func (p *Process) finish(err error) {
+	p.cancel()
+	p.termErr = err
+	close(p.done)
+	close(p.output)
+}
+
+func (p *Process) ended() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Process) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
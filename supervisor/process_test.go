@@ -0,0 +1,262 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/enginetest/fake"
+	"github.com/dmora/agentrun/supervisor"
+)
+
+const testTimeout = 5 * time.Second
+
+func testCtx(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// seqEngine starts its n-th session on engines[n], repeating the last.
+type seqEngine struct {
+	mu      sync.Mutex
+	engines []*fake.Engine
+	n       int
+}
+
+func (e *seqEngine) Start(ctx context.Context, s agentrun.Session, opts ...agentrun.Option) (agentrun.Process, error) {
+	e.mu.Lock()
+	eng := e.engines[min(e.n, len(e.engines)-1)]
+	e.n++
+	e.mu.Unlock()
+	return eng.Start(ctx, s, opts...)
+}
+
+func (e *seqEngine) Validate() error { return nil }
+
+func initMsg(id string) agentrun.Message {
+	return agentrun.Message{Type: agentrun.MessageInit, ResumeID: id}
+}
+
+// crashTurn emits partial text and exits with code 1.
+var crashTurn = fake.Turn{
+	Messages: []agentrun.Message{{Type: agentrun.MessageText, Content: "partial"}},
+	End:      true,
+	EndErr:   &agentrun.ExitError{Code: 1},
+}
+
+var fastBackoff = supervisor.WithBackoff(time.Millisecond, 5*time.Millisecond)
+
+func start(t *testing.T, eng agentrun.Engine, opts ...supervisor.Option) *supervisor.Process {
+	t.Helper()
+	proc, err := supervisor.NewEngine(eng, opts...).Start(testCtx(t), agentrun.Session{CWD: "/w"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = proc.Stop(context.Background()) })
+	return proc.(*supervisor.Process)
+}
+
+// next reads one message from Output.
+func next(t *testing.T, proc agentrun.Process) (agentrun.Message, bool) {
+	t.Helper()
+	select {
+	case msg, ok := <-proc.Output():
+		return msg, ok
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for output")
+		return agentrun.Message{}, false
+	}
+}
+
+// drain reads Output until it closes and returns the system notices.
+func drain(t *testing.T, proc agentrun.Process) []string {
+	t.Helper()
+	var notices []string
+	for {
+		msg, ok := next(t, proc)
+		if !ok {
+			return notices
+		}
+		if msg.Type == agentrun.MessageSystem {
+			notices = append(notices, msg.Content)
+		}
+	}
+}
+
+func TestProcess_ResumesAndResendsInterruptedTurn(t *testing.T) {
+	first := fake.NewEngine(fake.WithInit(initMsg("s1")), fake.WithTurns(crashTurn))
+	second := fake.NewEngine(fake.WithInit(initMsg("s1")), fake.WithTurns(fake.TextTurn("done")))
+	proc := start(t, &seqEngine{engines: []*fake.Engine{first, second}}, fastBackoff, supervisor.WithResend(true))
+
+	var texts, notices []string
+	err := agentrun.RunTurn(testCtx(t), proc, "fix it", func(m agentrun.Message) error {
+		switch m.Type {
+		case agentrun.MessageText:
+			texts = append(texts, m.Content)
+		case agentrun.MessageSystem:
+			notices = append(notices, m.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if strings.Join(texts, ",") != "partial,done" {
+		t.Errorf("texts = %v, want [partial done]", texts)
+	}
+	if len(notices) != 2 || !strings.Contains(notices[0], "exit status 1") || !strings.Contains(notices[1], "resumed session s1") {
+		t.Errorf("notices = %q", notices)
+	}
+
+	starts := second.Starts()
+	if len(starts) != 1 {
+		t.Fatalf("second engine starts = %d, want 1", len(starts))
+	}
+	if got := starts[0]; got.Prompt != "" || got.Options[agentrun.OptionResumeID] != "s1" || got.CWD != "/w" {
+		t.Errorf("restart session = %+v", got)
+	}
+	if sent := second.Processes()[0].Sent(); len(sent) != 1 || sent[0] != "fix it" {
+		t.Errorf("restart sent = %q, want [fix it]", sent)
+	}
+	if proc.Restarts() != 1 || proc.ResumeID() != "s1" {
+		t.Errorf("Restarts = %d, ResumeID = %q", proc.Restarts(), proc.ResumeID())
+	}
+}
+
+func TestProcess_WithoutResendAbandonsTurn(t *testing.T) {
+	first := fake.NewEngine(fake.WithInit(initMsg("s1")), fake.WithTurns(crashTurn))
+	second := fake.NewEngine(fake.WithInit(initMsg("s1")), fake.WithTurns(fake.TextTurn("next")))
+	proc := start(t, &seqEngine{engines: []*fake.Engine{first, second}}, fastBackoff)
+
+	if err := proc.Send(testCtx(t), "fix it"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for {
+		msg, ok := next(t, proc)
+		if !ok {
+			t.Fatalf("Output closed: %v", proc.Err())
+		}
+		if msg.Type == agentrun.MessageSystem && strings.Contains(msg.Content, "resumed") {
+			break
+		}
+	}
+	if got := second.Starts()[0].Prompt; got != "" {
+		t.Errorf("restart prompt = %q, want empty", got)
+	}
+
+	var result string
+	err := agentrun.RunTurn(testCtx(t), proc, "again", func(m agentrun.Message) error {
+		if m.Type == agentrun.MessageText {
+			result = m.Content
+		}
+		return nil
+	})
+	if err != nil || result != "next" {
+		t.Errorf("RunTurn = %v, text %q; want nil, next", err, result)
+	}
+}
+
+func TestProcess_RetryBudgetExhausted(t *testing.T) {
+	eng := fake.NewEngine(fake.WithInit(initMsg("s1")), fake.WithDefaultTurn(crashTurn))
+	proc := start(t, eng, fastBackoff, supervisor.WithResend(true), supervisor.WithMaxRetries(2))
+	if err := proc.Send(testCtx(t), "go"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	notices := drain(t, proc)
+	if code, ok := agentrun.ExitCode(proc.Err()); !ok || code != 1 {
+		t.Errorf("Err = %v, want exit status 1", proc.Err())
+	}
+	if proc.Restarts() != 2 || len(eng.Starts()) != 3 {
+		t.Errorf("Restarts = %d, starts = %d; want 2, 3", proc.Restarts(), len(eng.Starts()))
+	}
+	if len(notices) != 4 || !strings.Contains(notices[2], "attempt 2 of 2") {
+		t.Errorf("notices = %q", notices)
+	}
+}
+
+func TestProcess_NonRetryableError(t *testing.T) {
+	fatal := errors.New("fatal")
+	eng := fake.NewEngine(fake.WithTurns(fake.Turn{End: true, EndErr: fatal}))
+	proc := start(t, eng, fastBackoff)
+	if err := proc.Send(testCtx(t), "go"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if notices := drain(t, proc); len(notices) != 0 {
+		t.Errorf("notices = %q, want none", notices)
+	}
+	if !errors.Is(proc.Err(), fatal) || len(eng.Starts()) != 1 {
+		t.Errorf("Err = %v, starts = %d; want fatal, 1", proc.Err(), len(eng.Starts()))
+	}
+}
+
+func TestProcess_CustomRetryable(t *testing.T) {
+	eng := fake.NewEngine(fake.WithTurns(crashTurn))
+	proc := start(t, eng, fastBackoff, supervisor.WithRetryable(func(error) bool { return false }))
+	if err := proc.Send(testCtx(t), "go"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	drain(t, proc)
+	if _, ok := agentrun.ExitCode(proc.Err()); !ok || len(eng.Starts()) != 1 {
+		t.Errorf("Err = %v, starts = %d; want exit error, 1", proc.Err(), len(eng.Starts()))
+	}
+}
+
+func TestProcess_StopDuringBackoff(t *testing.T) {
+	eng := fake.NewEngine(fake.WithTurns(crashTurn))
+	proc := start(t, eng, supervisor.WithBackoff(time.Hour, time.Hour))
+	if err := proc.Send(testCtx(t), "go"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	for {
+		msg, ok := next(t, proc)
+		if !ok {
+			t.Fatal("Output closed before the restart notice")
+		}
+		if msg.Type == agentrun.MessageSystem {
+			break
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- proc.Stop(context.Background()) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, agentrun.ErrTerminated) {
+			t.Errorf("Stop = %v, want ErrTerminated", err)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Stop blocked during backoff")
+	}
+	if err := proc.Send(testCtx(t), "again"); !errors.Is(err, agentrun.ErrTerminated) {
+		t.Errorf("Send after Stop = %v, want ErrTerminated", err)
+	}
+	if len(eng.Starts()) != 1 {
+		t.Errorf("starts = %d, want 1", len(eng.Starts()))
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{agentrun.ErrTerminated, false},
+		{errors.New("other"), false},
+		{agentrun.ErrNoResult, true},
+		{&agentrun.ExitError{Code: 137}, true},
+		{errors.Join(agentrun.ErrTerminated, &agentrun.ExitError{Code: 1}), false},
+	}
+	for _, tt := range tests {
+		if got := supervisor.Retryable(tt.err); got != tt.want {
+			t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+//go:build !windows
+
+package supervisor_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dmora/agentrun"
+	"github.com/dmora/agentrun/engine/cli"
+	"github.com/dmora/agentrun/engine/cli/codex"
+	"github.com/dmora/agentrun/enginetest/clitest"
+	"github.com/dmora/agentrun/supervisor"
+)
+
+const testThreadID = "a1b2c3d4-e5f6-7890-abcd-ef1234567890"
+
+// TestProcess_ResumePerTurnEngine supervises a spawn-per-turn CLI engine,
+// whose Output closes after every turn: the session must survive each
+// turn, and a crash in the second turn must resume the thread.
+func TestProcess_ResumePerTurnEngine(t *testing.T) {
+	agent := clitest.NewFakeAgent(t, `
+match ^exec --json .*-- first$
+emit {"type":"thread.started","thread_id":"`+testThreadID+`"}
+emit {"type":"item.completed","item":{"id":"i1","type":"agent_message","text":"one"}}
+emit {"type":"turn.completed"}
+
+match ^exec resume --json .*-- \S+ second$
+emit {"type":"item.completed","item":{"id":"i2","type":"agent_message","text":"partial"}}
+exit 1
+
+match ^exec resume --json .*-- \S+ third$
+emit {"type":"item.completed","item":{"id":"i3","type":"agent_message","text":"three"}}
+emit {"type":"turn.completed"}
+
+match ^exec resume --json .*-- \S+$
+emit {"type":"thread.started","thread_id":"`+testThreadID+`"}
+sleep 1m
+`)
+	eng := supervisor.NewEngine(cli.NewEngine(codex.New(codex.WithBinary(agent.Path))), fastBackoff)
+	p, err := eng.Start(testCtx(t), agentrun.Session{CWD: t.TempDir(), Prompt: "first"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Stop(context.Background()) })
+	proc := p.(*supervisor.Process)
+
+	// until reads Output up to and including the first message for which
+	// stop is true, and returns the text seen on the way.
+	until := func(stop func(agentrun.Message) bool) []string {
+		t.Helper()
+		var texts []string
+		for {
+			msg, ok := next(t, proc)
+			if !ok {
+				t.Fatalf("Output closed early: %v (texts %q)", proc.Err(), texts)
+			}
+			if msg.Type == agentrun.MessageText {
+				texts = append(texts, msg.Content)
+			}
+			if stop(msg) {
+				return texts
+			}
+		}
+	}
+	isResult := func(m agentrun.Message) bool { return m.Type == agentrun.MessageResult }
+
+	if got := until(isResult); !slices.Equal(got, []string{"one"}) {
+		t.Errorf("first turn texts = %q, want [one]", got)
+	}
+
+	if err := proc.Send(testCtx(t), "second"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := until(func(m agentrun.Message) bool {
+		return m.Type == agentrun.MessageSystem && strings.Contains(m.Content, "resumed session "+testThreadID)
+	})
+	if !slices.Equal(got, []string{"partial"}) {
+		t.Errorf("second turn texts = %q, want [partial]", got)
+	}
+
+	var third []string
+	err = agentrun.RunTurn(testCtx(t), proc, "third", func(m agentrun.Message) error {
+		if m.Type == agentrun.MessageText {
+			third = append(third, m.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if !slices.Equal(third, []string{"three"}) {
+		t.Errorf("third turn texts = %q, want [three]", third)
+	}
+	if proc.Restarts() != 1 || proc.ResumeID() != testThreadID {
+		t.Errorf("Restarts = %d, ResumeID = %q", proc.Restarts(), proc.ResumeID())
+	}
+}